@@ -9,25 +9,66 @@ import (
 	"syscall"
 	"time"
 
+	"cloud.google.com/go/storage"
+
+	"dojo-manager/backend/internal/blob"
 	"dojo-manager/backend/internal/config"
+	"dojo-manager/backend/internal/domain/activity"
 	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/audit"
+	"dojo-manager/backend/internal/domain/badges"
+	"dojo-manager/backend/internal/domain/benchmarks"
+	"dojo-manager/backend/internal/domain/birthdays"
+	"dojo-manager/backend/internal/domain/chat"
+	"dojo-manager/backend/internal/domain/chatops"
+	"dojo-manager/backend/internal/domain/claims"
+	"dojo-manager/backend/internal/domain/classgoals"
+	"dojo-manager/backend/internal/domain/dashboard"
+	"dojo-manager/backend/internal/domain/demo"
+	"dojo-manager/backend/internal/domain/devices"
+	"dojo-manager/backend/internal/domain/digest"
 	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/families"
+	"dojo-manager/backend/internal/domain/impersonation"
+	"dojo-manager/backend/internal/domain/inbound"
+	"dojo-manager/backend/internal/domain/leads"
+	"dojo-manager/backend/internal/domain/logins"
+	"dojo-manager/backend/internal/domain/maintenance"
+	"dojo-manager/backend/internal/domain/media"
 	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/domain/memberships"
+	"dojo-manager/backend/internal/domain/metering"
 	"dojo-manager/backend/internal/domain/notifications"
+	"dojo-manager/backend/internal/domain/packages"
 	"dojo-manager/backend/internal/domain/profile"
+	"dojo-manager/backend/internal/domain/pushtokens"
 	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/domain/recurring"
+	"dojo-manager/backend/internal/domain/reminders"
 	"dojo-manager/backend/internal/domain/retention"
 	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/domain/sheets"
+	"dojo-manager/backend/internal/domain/shop"
 	"dojo-manager/backend/internal/domain/stats"
 	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/domain/tags"
+	"dojo-manager/backend/internal/domain/timetable"
+	"dojo-manager/backend/internal/domain/transfers"
 	"dojo-manager/backend/internal/domain/user"
+	"dojo-manager/backend/internal/events"
 	"dojo-manager/backend/internal/firebase"
 	apihttp "dojo-manager/backend/internal/http"
+	"dojo-manager/backend/internal/planlimit"
+	"dojo-manager/backend/internal/subscribers"
 )
 
 func main() {
 	ctx := context.Background()
-	cfg := config.Load()
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	log.Printf("config (%s): project=%s stripe=%v registry=%v", cfg.Profile, cfg.ProjectID, cfg.Stripe.Enabled(), cfg.DojoRegistryEnabled)
 
 	app, err := firebase.NewApp(ctx, cfg)
 	if err != nil {
@@ -52,28 +93,255 @@ func main() {
 	attendanceRepo := attendance.NewRepo(fs.Client)
 	ranksRepo := ranks.NewRepo(fs.Client)
 
+	// Data residency: dojos listed in dojoRegistry live in a regional database.
+	// Everything that reads a dojo's sessions or attendance resolves it here.
+	var dojoDBs firebase.ClientResolver = firebase.DefaultResolver{Client: fs.Client}
+	if cfg.DojoRegistryEnabled {
+		registry := firebase.NewDojoRegistry(fs.Client, cfg.ProjectID, firebase.CredentialOptions()...)
+		defer registry.Close()
+		dojoDBs = registry
+		dojoRepo.SetDojoRegistry(registry)
+		sessionRepo.SetClientResolver(registry)
+		attendanceRepo.SetClientResolver(registry)
+		log.Println("dojo registry enabled (per-dojo databases)")
+	}
+
+	// Background workers stop on shutdown
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	// Stripe service (optional - only if configured). Services that create
+	// capped resources take it as their plan limiter; without it nothing is capped.
+	// The pro shop takes it for payment links.
+	var stripeSvc *stripedom.Service
+	var limits planlimit.PlanLimiter = planlimit.Unlimited{}
+	var payments shop.Payments
+	if cfg.Stripe.Enabled() {
+		stripeSvc = stripedom.NewService(fs.Client, stripedom.Config{
+			SecretKey:            cfg.Stripe.SecretKey,
+			WebhookSecret:        cfg.Stripe.WebhookSecret,
+			PriceProMonthly:      cfg.Stripe.PriceProMonthly,
+			PriceProYearly:       cfg.Stripe.PriceProYearly,
+			PriceBusinessMonthly: cfg.Stripe.PriceBusinessMonthly,
+			PriceBusinessYearly:  cfg.Stripe.PriceBusinessYearly,
+			AppURL:               cfg.AppURL,
+		})
+		stripeSvc.SetClientResolver(dojoDBs)
+		limits = stripeSvc
+		payments = stripeSvc
+		log.Println("Stripe service initialized")
+	}
+
 	// Services
 	dojoSvc := dojo.NewService(dojoRepo, userRepo)
-	sessionSvc := session.NewService(sessionRepo, dojoRepo)
+	sessionSvc := session.NewService(sessionRepo, dojoRepo, limits)
 	attendanceSvc := attendance.NewService(attendanceRepo, dojoRepo)
 	ranksSvc := ranks.NewService(ranksRepo, dojoRepo)
 	statsSvc := stats.NewService(fs.Client)
-	notificationsSvc := notifications.NewService(fs.Client)
-	membersSvc := members.NewService(fs.Client, dojoRepo)
+	statsSvc.SetClientResolver(dojoDBs)
+	notificationsSvc := notifications.NewService(fs.Client, limits)
+	membersSvc := members.NewService(fs.Client, dojoRepo, limits)
 	profileSvc := profile.NewService(fs.Client, authClient)
+	profileSvc.SetMembersService(membersSvc)
 	retentionSvc := retention.NewService(fs.Client, dojoRepo)
+	retentionSvc.SetClientResolver(dojoDBs)
+	dashboardSvc := dashboard.NewService(dojoRepo, sessionSvc, attendanceSvc, retentionSvc)
+	activitySvc := activity.NewService(fs.Client)
+	retentionSvc.SetActivityService(activitySvc)
+	dashboardSvc.SetActivityService(activitySvc)
+	remindersSvc := reminders.NewService(fs.Client)
+	packagesSvc := packages.NewService(fs.Client, dojoRepo)
+	shopSvc := shop.NewService(fs.Client, dojoRepo, payments)
+	recurringSvc := recurring.NewService(fs.Client, dojoRepo, sessionSvc)
+	timetableSvc := timetable.NewService(fs.Client, dojoRepo, sessionSvc, attendanceSvc)
+	timetableSvc.SetRecurringService(recurringSvc)
+	familiesSvc := families.NewService(fs.Client, dojoRepo)
+	benchmarksSvc := benchmarks.NewService(fs.Client, dojoRepo, attendanceSvc)
+	membershipsSvc := memberships.NewService(fs.Client, dojoRepo, sessionSvc, attendanceSvc)
+	pushTokensSvc := pushtokens.NewService(fs.Client)
+	classGoalsSvc := classgoals.NewService(fs.Client, dojoRepo, sessionSvc, attendanceSvc)
+	birthdaysSvc := birthdays.NewService(fs.Client, dojoRepo)
+	digestSvc := digest.NewService(fs.Client, dojoRepo, attendanceSvc, ranksSvc, notificationsSvc)
+	chatSvc := chat.NewService(fs.Client, dojoRepo)
+	chatOpsSvc := chatops.NewService(fs.Client)
+	devicesSvc := devices.NewService(fs.Client, dojoRepo)
+	auditSvc := audit.NewService(fs.Client)
+	loginsSvc := logins.NewService(fs.Client)
+	loginsSvc.SetAuditService(auditSvc)
+	impersonationSvc := impersonation.NewService(fs.Client, authClient, auditSvc)
+	claimsSvc := claims.NewService(fs.Client, authClient, dojoRepo)
+	demoSvc := demo.NewService(fs.Client, dojoRepo)
+	demoSvc.SetClientResolver(dojoDBs)
+	transfersSvc := transfers.NewService(fs.Client, dojoRepo, membersSvc, ranksRepo, attendanceSvc, auditSvc)
+	maintenanceSvc := maintenance.NewService(fs.Client)
+	mediaSvc := media.NewService(fs.Client, dojoRepo)
+	badgesSvc := badges.NewService(fs.Client, dojoRepo, attendanceSvc)
+	tagsSvc := tags.NewService(fs.Client, dojoRepo, sessionSvc, attendanceSvc)
+	maintenanceSvc.SetForced(cfg.MaintenanceMode, cfg.MaintenanceMessage)
+	if cfg.MaintenanceMode {
+		log.Println("MAINTENANCE_MODE on, the API is read-only")
+	}
 
-	// Stripe service (optional - only if configured)
-	var stripeSvc *stripedom.Service
-	stripeCfg := stripedom.LoadConfig()
-	if stripeCfg.SecretKey != "" {
-		stripeSvc = stripedom.NewService(fs.Client, stripeCfg)
-		log.Println("Stripe service initialized")
+	// Push reminders and the weekly timetable push need FCM; email reminders
+	// and the in-app timetable notification work without it
+	if msg, err := app.Messaging(ctx); err == nil {
+		remindersSvc.SetMessagingClient(msg)
+		remindersSvc.SetTokenService(pushTokensSvc)
+		remindersSvc.SetClassServices(sessionSvc, attendanceSvc)
+		remindersSvc.SetFamilyService(familiesSvc)
+		timetableSvc.SetMessagingClient(msg)
+		timetableSvc.SetTokenService(pushTokensSvc)
+	} else {
+		log.Printf("FCM messaging unavailable, push reminders disabled: %v", err)
+	}
+
+	// Usage metering (product analytics / usage-based billing)
+	meter := metering.NewRecorder(fs.Client, metering.NewFirestoreSink(fs.Client))
+	membersSvc.SetMeteringRecorder(meter)
+	sessionSvc.SetMeteringRecorder(meter)
+	notificationsSvc.SetMeteringRecorder(meter)
+	attendanceSvc.SetSessionService(sessionSvc)
+	notificationsSvc.SetClassServices(sessionSvc, attendanceSvc)
+	statsSvc.SetSessionService(sessionSvc)
+	statsSvc.SetAttendanceService(attendanceSvc)
+	statsSvc.SetScanBudgets(stats.ScanBudgets{
+		Dojo:       cfg.ScanBudgets.DojoStats,
+		Member:     cfg.ScanBudgets.MemberStats,
+		Attendance: cfg.ScanBudgets.AttendanceStats,
+		Programs:   cfg.ScanBudgets.ProgramStats,
+		Cohorts:    cfg.ScanBudgets.Cohorts,
+	})
+	retentionSvc.SetScanBudget(cfg.ScanBudgets.RetentionAlerts)
+	dashboardSvc.SetStatsService(statsSvc)
+
+	// Member timeline includes attendance milestones
+	membersSvc.SetAttendanceService(attendanceSvc)
+
+	// Staff can find members by email
+	membersSvc.SetAuthClient(authClient)
+
+	// Dojos can require a verified email to join
+	dojoSvc.SetAuthClient(authClient)
+
+	// Punch-card members spend a credit per check-in
+	attendanceSvc.SetPackagesService(packagesSvc)
+
+	// Family view shows each member's attendance
+	familiesSvc.SetAttendanceService(attendanceSvc)
+
+	// Staff can announce by emailing the dojo's private address
+	var inboundSvc *inbound.Service
+	if cfg.InboundEmail.Enabled() {
+		inboundSvc = inbound.NewService(fs.Client, dojoRepo, notificationsSvc, inbound.Config{
+			Domain:            cfg.InboundEmail.Domain,
+			Secret:            cfg.InboundEmail.Secret,
+			MailgunSigningKey: cfg.InboundEmail.MailgunSigningKey,
+		})
+		inboundSvc.SetAuthClient(authClient)
+	} else {
+		log.Println("INBOUND_EMAIL_DOMAIN not set, announce-by-email disabled")
+	}
+
+	// Dojos can put a contact form on their own site; enquiries become leads
+	var leadsSvc *leads.Service
+	if cfg.ContactForm.Enabled() {
+		leadsSvc = leads.NewService(fs.Client, dojoRepo, leads.Config{
+			CaptchaSecret:    cfg.ContactForm.CaptchaSecret,
+			CaptchaVerifyURL: cfg.ContactForm.CaptchaVerifyURL,
+		})
+	} else {
+		log.Println("CAPTCHA_SECRET not set, public contact form disabled")
+	}
+
+	// Dojos can push their roster and attendance into a Google Sheet
+	var sheetsSvc *sheets.Service
+	if cfg.Sheets.Enabled() {
+		sheetsSvc, err = sheets.NewService(ctx, fs.Client, sheets.Config{
+			ServiceAccountEmail: cfg.Sheets.ServiceAccountEmail,
+		}, firebase.CredentialOptions()...)
+		if err != nil {
+			log.Printf("Google Sheets unavailable, sheet sync disabled: %v", err)
+			sheetsSvc = nil
+		} else {
+			sheetsSvc.SetClientResolver(dojoDBs)
+		}
+	} else {
+		log.Println("SHEETS_SERVICE_ACCOUNT_EMAIL not set, Google Sheets sync disabled")
+	}
+
+	// Domains publish events; check-in metering, the owner's Slack/Discord
+	// webhook, the stats cache, guardian pushes, recurring bookings and the
+	// staff digest react to them; role changes resync custom claims
+	bus := events.NewBus()
+	subscribers.Register(bus, subscribers.Deps{
+		Meter:      meter,
+		ChatOps:    chatOpsSvc,
+		Attendance: attendanceSvc,
+		Sessions:   sessionSvc,
+		Stats:      statsSvc,
+		Reminders:  remindersSvc,
+		Recurring:  recurringSvc,
+		Digest:     digestSvc,
+		Dojos:      dojoRepo,
+		Activity:   activitySvc,
+		Claims:     claimsSvc,
+		Tags:       tagsSvc,
+	})
+	dojoSvc.SetEventBus(bus)
+	attendanceSvc.SetEventBus(bus)
+	membersSvc.SetEventBus(bus)
+	retentionSvc.SetChatOps(chatOpsSvc)
+
+	// Gallery photos are uploaded straight to storage via signed URLs;
+	// archived attendance is exported to the same store. LOCAL_STORAGE_DIR
+	// keeps both on disk in development.
+	var store blob.Store
+	switch {
+	case cfg.LocalStorageDir != "":
+		if local, err := blob.NewLocal(cfg.LocalStorageDir, cfg.LocalStorageURL); err == nil {
+			store = local
+			log.Printf("Storing uploads in %s (served at %s%s)", cfg.LocalStorageDir, cfg.LocalStorageURL, blob.LocalPath)
+		} else {
+			log.Printf("Local storage unavailable, gallery uploads, profile photos and attendance archival disabled: %v", err)
+		}
+	case cfg.StorageBucket != "":
+		if storageClient, err := storage.NewClient(ctx, firebase.CredentialOptions()...); err == nil {
+			defer storageClient.Close()
+			store = blob.NewGCS(storageClient.Bucket(cfg.StorageBucket), cfg.SignedURLServiceAccountEmail)
+		} else {
+			log.Printf("Cloud Storage unavailable, gallery uploads, profile photos and attendance archival disabled: %v", err)
+		}
+	default:
+		log.Println("FIREBASE_STORAGE_BUCKET not set, gallery uploads, profile photos and attendance archival disabled")
+	}
+	if store != nil {
+		mediaSvc.SetStorage(store)
+		attendanceSvc.SetArchiveStore(store)
+		profileSvc.SetStorage(store)
+	}
+
+	// Stripe wiring (optional - only if configured)
+	if stripeSvc != nil {
+		// Webhook events are queued by the handler and applied in the background
+		stripeSvc.StartEventWorker(workerCtx)
+
+		// Dojo deletion cancels / resumes the subscription
+		dojoSvc.SetStripeService(stripeSvc)
+
+		// Owner dashboard shows plan usage
+		dashboardSvc.SetStripeService(stripeSvc)
+
+		// Class packages are sold via one-time checkout
+		packagesSvc.SetStripeService(stripeSvc)
+
+		// Family memberships share one subscription billed per member
+		familiesSvc.SetStripeService(stripeSvc)
+
+		// Gallery storage quota depends on the plan
+		mediaSvc.SetStripeService(stripeSvc)
 
-		// ★ Inject Stripe service into other services for plan limit checks
-		sessionSvc.SetStripeService(stripeSvc)
-		membersSvc.SetStripeService(stripeSvc)
-		notificationsSvc.SetStripeService(stripeSvc)
+		// Failed plan payments are published for the chat webhook
+		stripeSvc.SetEventBus(bus)
 	} else {
 		log.Println("STRIPE_SECRET_KEY not set, Stripe features disabled")
 	}
@@ -94,13 +362,44 @@ func main() {
 		ProfileSvc:       profileSvc,
 		StripeSvc:        stripeSvc,
 		RetentionSvc:     retentionSvc,
+		DashboardSvc:     dashboardSvc,
+		RemindersSvc:     remindersSvc,
+		PackagesSvc:      packagesSvc,
+		ShopSvc:          shopSvc,
+		RecurringSvc:     recurringSvc,
+		TimetableSvc:     timetableSvc,
+		FamiliesSvc:      familiesSvc,
+		BenchmarksSvc:    benchmarksSvc,
+		MembershipsSvc:   membershipsSvc,
+		PushTokensSvc:    pushTokensSvc,
+		MaintenanceSvc:   maintenanceSvc,
+		ClassGoalsSvc:    classGoalsSvc,
+		ChatSvc:          chatSvc,
+		DevicesSvc:       devicesSvc,
+		AuditSvc:         auditSvc,
+		LoginsSvc:        loginsSvc,
+		MediaSvc:         mediaSvc,
+		BadgesSvc:        badgesSvc,
+		BirthdaysSvc:     birthdaysSvc,
+		DigestSvc:        digestSvc,
+		ChatOpsSvc:       chatOpsSvc,
+		InboundSvc:       inboundSvc,
+		LeadsSvc:         leadsSvc,
+		SheetsSvc:        sheetsSvc,
+		ImpersonationSvc: impersonationSvc,
+		DemoSvc:          demoSvc,
+		TransfersSvc:     transfersSvc,
+		ActivitySvc:      activitySvc,
+		ClaimsSvc:        claimsSvc,
+		TagsSvc:          tagsSvc,
+		Storage:          store,
 	})
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
 		Handler:      router,
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 20 * time.Second,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
 		IdleTimeout:  60 * time.Second,
 	}
 
@@ -120,5 +419,6 @@ func main() {
 	defer cancel()
 
 	log.Println("shutting down...")
+	stopWorkers()
 	_ = srv.Shutdown(ctxShutdown)
 }
\ No newline at end of file
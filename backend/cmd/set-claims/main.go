@@ -26,10 +26,17 @@ func main() {
 		log.Fatalf("app.Auth: %v", err)
 	}
 
-	claims := map[string]interface{}{
-		"roles": []string{"staff"},
-		"staff": true,
+	u, err := authClient.GetUser(ctx, *uid)
+	if err != nil {
+		log.Fatalf("GetUser: %v", err)
+	}
+	// keep the other claims, such as the API's per-dojo dojoRoles
+	claims := map[string]interface{}{}
+	for k, v := range u.CustomClaims {
+		claims[k] = v
 	}
+	claims["roles"] = []string{"staff"}
+	claims["staff"] = true
 
 	if err := authClient.SetCustomUserClaims(ctx, *uid, claims); err != nil {
 		log.Fatalf("SetCustomUserClaims: %v", err)
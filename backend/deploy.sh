@@ -12,13 +12,18 @@ docker build --platform linux/amd64 -t ${IMAGE_NAME} .
 echo "📤 Pushing to Container Registry..."
 docker push ${IMAGE_NAME}
 
+# APP_ENV=prod refuses to boot without a Stripe key and webhook signing
+# secret. Both must exist in Secret Manager before the first deploy:
+#   printf '%s' "sk_live_..." | gcloud secrets create STRIPE_SECRET_KEY --data-file=-
+#   printf '%s' "whsec_..." | gcloud secrets create STRIPE_WEBHOOK_SECRET --data-file=-
+# and the Cloud Run service account needs roles/secretmanager.secretAccessor.
 echo "🚀 Deploying to Cloud Run..."
 gcloud run deploy ${SERVICE_NAME} \
   --image ${IMAGE_NAME} \
   --region ${REGION} \
   --platform managed \
   --allow-unauthenticated \
-  --set-env-vars="FIREBASE_PROJECT_ID=${PROJECT_ID},ALLOWED_ORIGINS=https://dojo-manager-94b96.web.app,PORT=8080,STRIPE_PRICE_PRO_MONTHLY=price_1SxaV3P4p3bl8wFbyN4xoJtJ,STRIPE_PRICE_PRO_YEARLY=price_1SxaZNP4p3bl8wFbOLGYhIH2,STRIPE_PRICE_BUSINESS_MONTHLY=price_1SxaZNP4p3bl8wFbCDHUsNYR,STRIPE_PRICE_BUSINESS_YEARLY=price_1SxaauP4p3bl8wFbb7sns5LG" \
-  --set-secrets="STRIPE_SECRET_KEY=STRIPE_SECRET_KEY:latest"
+  --set-env-vars="APP_ENV=prod,FIREBASE_PROJECT_ID=${PROJECT_ID},ALLOWED_ORIGINS=https://dojo-manager-94b96.web.app,PORT=8080,STRIPE_PRICE_PRO_MONTHLY=price_1SxaV3P4p3bl8wFbyN4xoJtJ,STRIPE_PRICE_PRO_YEARLY=price_1SxaZNP4p3bl8wFbOLGYhIH2,STRIPE_PRICE_BUSINESS_MONTHLY=price_1SxaZNP4p3bl8wFbCDHUsNYR,STRIPE_PRICE_BUSINESS_YEARLY=price_1SxaauP4p3bl8wFbb7sns5LG" \
+  --set-secrets="STRIPE_SECRET_KEY=STRIPE_SECRET_KEY:latest,STRIPE_WEBHOOK_SECRET=STRIPE_WEBHOOK_SECRET:latest"
 
 echo "✅ Done!"
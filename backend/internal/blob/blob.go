@@ -0,0 +1,120 @@
+// Package blob is the object storage shared by the API's features: gallery
+// photos, archived attendance and direct uploads. Store has a Cloud Storage
+// implementation for deployments and a local-disk one for development.
+// Features work on a scoped view (ForDojo, Within) so one dojo's objects
+// cannot be named from another dojo's request.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotExist   = errors.New("object does not exist")
+	ErrBadName    = errors.New("invalid object name")
+	ErrOutOfScope = errors.New("object is outside the allowed prefix")
+)
+
+func IsErrNotExist(err error) bool {
+	return errors.Is(err, ErrNotExist)
+}
+
+func IsErrBadName(err error) bool {
+	return errors.Is(err, ErrBadName)
+}
+
+func IsErrOutOfScope(err error) bool {
+	return errors.Is(err, ErrOutOfScope)
+}
+
+// maxNameLength is Cloud Storage's limit on object names
+const maxNameLength = 1024
+
+// Attrs describes a stored object
+type Attrs struct {
+	Name            string            `json:"name"`
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	Size            int64             `json:"size"`
+	Updated         time.Time         `json:"updated"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// WriteOptions are set on an object as it is written
+type WriteOptions struct {
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+}
+
+// Writer writes one object. Nothing is visible until Close succeeds; Abort
+// discards what was written.
+type Writer interface {
+	io.Writer
+	Close() error
+	Abort(err error)
+}
+
+// URLOptions describe a signed URL. Method is GET (the default) or PUT. For
+// PUT, ContentType must be sent as is and MaxBytes, if set, caps the body.
+type URLOptions struct {
+	Method      string
+	Expires     time.Time
+	ContentType string
+	MaxBytes    int64
+}
+
+// SignedURL lets a client read or write one object without credentials.
+// Headers must be sent with the request.
+type SignedURL struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// Store is a bucket of objects named by slash-separated paths
+type Store interface {
+	// SignedURL signs a direct GET or PUT of the object
+	SignedURL(name string, opts URLOptions) (*SignedURL, error)
+	// Attrs returns the object's attributes, ErrNotExist if there is none
+	Attrs(ctx context.Context, name string) (*Attrs, error)
+	// NewReader reads the object, ErrNotExist if there is none. The caller
+	// closes it.
+	NewReader(ctx context.Context, name string) (io.ReadCloser, error)
+	// NewWriter creates or replaces the object
+	NewWriter(ctx context.Context, name string, opts WriteOptions) (Writer, error)
+	// UpdateMetadata merges metadata into the object's custom metadata
+	UpdateMetadata(ctx context.Context, name string, metadata map[string]string) (*Attrs, error)
+	// Delete removes the object; a missing object is not an error
+	Delete(ctx context.Context, name string) error
+	// Move renames the object, replacing any object at dst
+	Move(ctx context.Context, src, dst string) error
+	// List calls fn for each object whose name starts with prefix, in name
+	// order, stopping at the first error fn returns
+	List(ctx context.Context, prefix string, fn func(*Attrs) error) error
+}
+
+// ValidName checks an object name: relative, with no empty, "." or ".."
+// segments, so it maps to one path on every backend
+func ValidName(name string) error {
+	if name == "" || len(name) > maxNameLength || strings.HasPrefix(name, "/") || strings.ContainsAny(name, "\\\x00\r\n") {
+		return fmt.Errorf("%w: %q", ErrBadName, name)
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return fmt.Errorf("%w: %q", ErrBadName, name)
+		}
+	}
+	return nil
+}
+
+// DojoPrefix is the prefix of every object that belongs to a dojo
+func DojoPrefix(dojoID string) string {
+	return "dojos/" + dojoID + "/"
+}
@@ -0,0 +1,429 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalPath is where the router serves a Local store's signed URLs
+const LocalPath = "/dev-storage"
+
+// metaDir holds attributes and in-flight writes under a Local root; it is
+// not a valid first segment of an object name there
+const metaDir = ".blobmeta"
+
+// Local is a Store in a directory, for development without Cloud Storage.
+// Signed URLs point at Handler, mounted by the router at LocalPath; they are
+// HMAC-signed with a key made at startup, so they do not survive a restart.
+type Local struct {
+	root    string
+	baseURL string
+	key     []byte
+}
+
+// NewLocal stores objects under root. apiURL is the API's origin as clients
+// reach it (e.g. http://localhost:8080).
+func NewLocal(root, apiURL string) (*Local, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, metaDir, "tmp"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", root, err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &Local{root: root, baseURL: strings.TrimRight(apiURL, "/") + LocalPath, key: key}, nil
+}
+
+// localMeta is what Cloud Storage keeps beside the object's content
+type localMeta struct {
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+func (l *Local) check(name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	if name == metaDir || strings.HasPrefix(name, metaDir+"/") {
+		return fmt.Errorf("%w: %q", ErrBadName, name)
+	}
+	return nil
+}
+
+func (l *Local) path(name string) string {
+	return filepath.Join(l.root, filepath.FromSlash(name))
+}
+
+func (l *Local) metaPath(name string) string {
+	return filepath.Join(l.root, metaDir, filepath.FromSlash(name)+".json")
+}
+
+func (l *Local) readMeta(name string) (localMeta, error) {
+	var m localMeta
+	b, err := os.ReadFile(l.metaPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(b, &m)
+}
+
+func (l *Local) writeMeta(name string, m localMeta) error {
+	p := l.metaPath(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o644)
+}
+
+func (l *Local) SignedURL(name string, opts URLOptions) (*SignedURL, error) {
+	if err := l.check(name); err != nil {
+		return nil, err
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodGet
+	}
+	if opts.Method != http.MethodGet && opts.Method != http.MethodPut {
+		return nil, fmt.Errorf("unsupported signed url method %s", opts.Method)
+	}
+	if opts.Method == http.MethodGet {
+		opts.ContentType, opts.MaxBytes = "", 0
+	}
+
+	q := url.Values{}
+	q.Set("method", opts.Method)
+	q.Set("expires", strconv.FormatInt(opts.Expires.Unix(), 10))
+	headers := map[string]string{}
+	if opts.ContentType != "" {
+		q.Set("contentType", opts.ContentType)
+		headers["Content-Type"] = opts.ContentType
+	}
+	if opts.MaxBytes > 0 {
+		q.Set("maxBytes", strconv.FormatInt(opts.MaxBytes, 10))
+	}
+	q.Set("signature", l.sign(name, q))
+
+	segs := strings.Split(name, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return &SignedURL{
+		URL:       l.baseURL + "/" + strings.Join(segs, "/") + "?" + q.Encode(),
+		Method:    opts.Method,
+		Headers:   headers,
+		ExpiresAt: opts.Expires.UTC(),
+	}, nil
+}
+
+func (l *Local) sign(name string, q url.Values) string {
+	mac := hmac.New(sha256.New, l.key)
+	for _, part := range []string{q.Get("method"), name, q.Get("expires"), q.Get("contentType"), q.Get("maxBytes")} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) Attrs(ctx context.Context, name string) (*Attrs, error) {
+	if err := l.check(name); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(l.path(name))
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m, err := l.readMeta(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attributes of %s: %w", name, err)
+	}
+	return &Attrs{
+		Name:            name,
+		ContentType:     m.ContentType,
+		ContentEncoding: m.ContentEncoding,
+		Size:            fi.Size(),
+		Updated:         fi.ModTime().UTC(),
+		Metadata:        m.Metadata,
+	}, nil
+}
+
+func (l *Local) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if _, err := l.Attrs(ctx, name); err != nil {
+		return nil, err
+	}
+	return os.Open(l.path(name))
+}
+
+func (l *Local) NewWriter(ctx context.Context, name string, opts WriteOptions) (Writer, error) {
+	if err := l.check(name); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Join(l.root, metaDir, "tmp"), "write-*")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{
+		l:    l,
+		f:    f,
+		name: name,
+		meta: localMeta{ContentType: opts.ContentType, ContentEncoding: opts.ContentEncoding, Metadata: opts.Metadata},
+	}, nil
+}
+
+func (l *Local) UpdateMetadata(ctx context.Context, name string, metadata map[string]string) (*Attrs, error) {
+	if _, err := l.Attrs(ctx, name); err != nil {
+		return nil, err
+	}
+	m, err := l.readMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	if m.Metadata == nil {
+		m.Metadata = map[string]string{}
+	}
+	for k, v := range metadata {
+		m.Metadata[k] = v
+	}
+	if err := l.writeMeta(name, m); err != nil {
+		return nil, err
+	}
+	return l.Attrs(ctx, name)
+}
+
+func (l *Local) Delete(ctx context.Context, name string) error {
+	if err := l.check(name); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(l.metaPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Move(ctx context.Context, src, dst string) error {
+	if err := l.check(src); err != nil {
+		return err
+	}
+	if err := l.check(dst); err != nil {
+		return err
+	}
+	if src == dst {
+		return nil
+	}
+	if _, err := l.Attrs(ctx, src); err != nil {
+		return err
+	}
+	m, err := l.readMeta(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path(dst)), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(l.path(src), l.path(dst)); err != nil {
+		return err
+	}
+	if err := l.writeMeta(dst, m); err != nil {
+		return err
+	}
+	if err := os.Remove(l.metaPath(src)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) List(ctx context.Context, prefix string, fn func(*Attrs) error) error {
+	return filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			// skip the attributes and directories that cannot hold a match
+			if name == metaDir || (name != "." && !strings.HasPrefix(name+"/", prefix) && !strings.HasPrefix(prefix, name+"/")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		a, err := l.Attrs(ctx, name)
+		if err != nil {
+			return err
+		}
+		return fn(a)
+	})
+}
+
+type localWriter struct {
+	l    *Local
+	f    *os.File
+	name string
+	meta localMeta
+}
+
+func (w *localWriter) Write(p []byte) (int, error) { return w.f.Write(p) }
+
+// Close moves the written file into place, then records its attributes
+func (w *localWriter) Close() error {
+	if err := w.f.Close(); err != nil {
+		_ = os.Remove(w.f.Name())
+		return err
+	}
+	dst := w.l.path(w.name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		_ = os.Remove(w.f.Name())
+		return err
+	}
+	if err := os.Rename(w.f.Name(), dst); err != nil {
+		_ = os.Remove(w.f.Name())
+		return err
+	}
+	return w.l.writeMeta(w.name, w.meta)
+}
+
+func (w *localWriter) Abort(err error) {
+	_ = w.f.Close()
+	_ = os.Remove(w.f.Name())
+}
+
+// Handler serves the signed URLs of the store, like Cloud Storage would: GET
+// returns the object, PUT stores the body once the Content-Type and size
+// limits signed into the URL are met. Mount it with http.StripPrefix(LocalPath).
+func (l *Local) Handler() http.Handler {
+	return http.HandlerFunc(l.serve)
+}
+
+func (l *Local) serve(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if err := l.check(name); err != nil {
+		http.Error(w, "invalid object name", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	method := q.Get("method")
+	if method != r.Method && !(method == http.MethodGet && r.Method == http.MethodHead) {
+		http.Error(w, "method does not match the signature", http.StatusForbidden)
+		return
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		http.Error(w, "signed url has expired", http.StatusForbidden)
+		return
+	}
+	if !hmac.Equal([]byte(q.Get("signature")), []byte(l.sign(name, q))) {
+		http.Error(w, "signature does not match", http.StatusForbidden)
+		return
+	}
+
+	switch method {
+	case http.MethodGet:
+		l.serveGet(w, r, name)
+	case http.MethodPut:
+		l.servePut(w, r, name, q)
+	}
+}
+
+func (l *Local) serveGet(w http.ResponseWriter, r *http.Request, name string) {
+	a, err := l.Attrs(r.Context(), name)
+	if IsErrNotExist(err) {
+		http.Error(w, "no such object", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Open(l.path(name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	if a.ContentType != "" {
+		w.Header().Set("Content-Type", a.ContentType)
+	}
+	if a.ContentEncoding != "" {
+		w.Header().Set("Content-Encoding", a.ContentEncoding)
+	}
+	http.ServeContent(w, r, "", a.Updated, f)
+}
+
+func (l *Local) servePut(w http.ResponseWriter, r *http.Request, name string, q url.Values) {
+	contentType := r.Header.Get("Content-Type")
+	if want := q.Get("contentType"); want != "" && contentType != want {
+		http.Error(w, "Content-Type does not match the signature", http.StatusForbidden)
+		return
+	}
+	body := io.Reader(r.Body)
+	if maxBytes, _ := strconv.ParseInt(q.Get("maxBytes"), 10, 64); maxBytes > 0 {
+		if r.ContentLength > maxBytes {
+			http.Error(w, "body exceeds the signed size", http.StatusBadRequest)
+			return
+		}
+		body = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+
+	wr, err := l.NewWriter(r.Context(), name, WriteOptions{ContentType: contentType})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := io.Copy(wr, body); err != nil {
+		wr.Abort(err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "body exceeds the signed size", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := wr.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+var _ Store = (*Local)(nil)
@@ -0,0 +1,101 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// scoped is the part of a store under one prefix. Names are still full
+// names; those outside the prefix are refused.
+type scoped struct {
+	store  Store
+	prefix string
+}
+
+// Within confines store to the objects under prefix, which should end in "/"
+func Within(store Store, prefix string) Store {
+	return &scoped{store: store, prefix: prefix}
+}
+
+// ForDojo confines store to the dojo's objects (DojoPrefix)
+func ForDojo(store Store, dojoID string) (Store, error) {
+	if dojoID == "" || dojoID == "." || dojoID == ".." || strings.ContainsAny(dojoID, "/\\") {
+		return nil, fmt.Errorf("%w: invalid dojo id %q", ErrBadName, dojoID)
+	}
+	return Within(store, DojoPrefix(dojoID)), nil
+}
+
+func (s *scoped) check(name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(name, s.prefix) {
+		return fmt.Errorf("%w: %q is not under %q", ErrOutOfScope, name, s.prefix)
+	}
+	return nil
+}
+
+func (s *scoped) SignedURL(name string, opts URLOptions) (*SignedURL, error) {
+	if err := s.check(name); err != nil {
+		return nil, err
+	}
+	return s.store.SignedURL(name, opts)
+}
+
+func (s *scoped) Attrs(ctx context.Context, name string) (*Attrs, error) {
+	if err := s.check(name); err != nil {
+		return nil, err
+	}
+	return s.store.Attrs(ctx, name)
+}
+
+func (s *scoped) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := s.check(name); err != nil {
+		return nil, err
+	}
+	return s.store.NewReader(ctx, name)
+}
+
+func (s *scoped) NewWriter(ctx context.Context, name string, opts WriteOptions) (Writer, error) {
+	if err := s.check(name); err != nil {
+		return nil, err
+	}
+	return s.store.NewWriter(ctx, name, opts)
+}
+
+func (s *scoped) UpdateMetadata(ctx context.Context, name string, metadata map[string]string) (*Attrs, error) {
+	if err := s.check(name); err != nil {
+		return nil, err
+	}
+	return s.store.UpdateMetadata(ctx, name, metadata)
+}
+
+func (s *scoped) Delete(ctx context.Context, name string) error {
+	if err := s.check(name); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, name)
+}
+
+func (s *scoped) Move(ctx context.Context, src, dst string) error {
+	if err := s.check(src); err != nil {
+		return err
+	}
+	if err := s.check(dst); err != nil {
+		return err
+	}
+	return s.store.Move(ctx, src, dst)
+}
+
+// List lists the whole scope when prefix is empty
+func (s *scoped) List(ctx context.Context, prefix string, fn func(*Attrs) error) error {
+	if prefix == "" {
+		prefix = s.prefix
+	}
+	if !strings.HasPrefix(prefix, s.prefix) {
+		return fmt.Errorf("%w: %q is not under %q", ErrOutOfScope, prefix, s.prefix)
+	}
+	return s.store.List(ctx, prefix, fn)
+}
@@ -2,54 +2,368 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// Profile is the deployment environment. It decides which settings are
+// required and which Stripe key mode is allowed.
+type Profile string
+
+const (
+	ProfileDev     Profile = "dev"
+	ProfileStaging Profile = "staging"
+	ProfileProd    Profile = "prod"
 )
 
 type Config struct {
+	Profile                      Profile
 	ProjectID                    string
 	Port                         string
 	AllowedOrigins               []string
+	AppURL                       string // web app origin, for links in API responses
 	StorageBucket                string
-	StripeSecretKey              string
-	StripeWebhookSecret          string
 	SignedURLServiceAccountEmail string
+
+	// LocalStorageDir keeps uploads on local disk instead of Cloud Storage
+	// (dev only); their signed URLs are served from LocalStorageURL, the
+	// API's origin as the browser sees it
+	LocalStorageDir string
+	LocalStorageURL string
+
+	// DojoRegistryEnabled routes dojo data to per-dojo databases via dojoRegistry
+	DojoRegistryEnabled bool
+
+	// MaintenanceMode makes the API read-only on boot, on top of the
+	// system/maintenance switch in Firestore
+	MaintenanceMode    bool
+	MaintenanceMessage string
+
+	Stripe       StripeConfig
+	HTTP         HTTPConfig
+	InboundEmail InboundEmailConfig
+	ContactForm  ContactFormConfig
+	Sheets       SheetsConfig
+	ScanBudgets  ScanBudgetConfig
+}
+
+// StripeConfig holds the Stripe keys and plan price IDs. SecretKey and
+// WebhookSecret may be Secret Manager references (see secrets.go).
+type StripeConfig struct {
+	SecretKey            string
+	WebhookSecret        string
+	PriceProMonthly      string
+	PriceProYearly       string
+	PriceBusinessMonthly string
+	PriceBusinessYearly  string
+}
+
+// Enabled reports whether Stripe billing is configured
+func (c StripeConfig) Enabled() bool { return c.SecretKey != "" }
+
+// InboundEmailConfig holds the email-to-announcement gateway. Mail to
+// <token>@Domain is posted by the provider to /v1/inbound-email, which checks
+// ?secret=Secret (SendGrid Inbound Parse) or the Mailgun signature. Both
+// secrets may be Secret Manager references.
+type InboundEmailConfig struct {
+	Domain            string
+	Secret            string
+	MailgunSigningKey string
+}
+
+// Enabled reports whether the inbound email gateway is configured
+func (c InboundEmailConfig) Enabled() bool {
+	return c.Domain != "" && (c.Secret != "" || c.MailgunSigningKey != "")
+}
+
+// ContactFormConfig holds the captcha check of the public contact form.
+// The default VerifyURL is Cloudflare Turnstile; hCaptcha and reCAPTCHA
+// answer the same siteverify request at their own URL. CaptchaSecret may be a
+// Secret Manager reference.
+type ContactFormConfig struct {
+	CaptchaSecret    string
+	CaptchaVerifyURL string
 }
 
-func Load() Config {
+// Enabled reports whether the public contact form is configured
+func (c ContactFormConfig) Enabled() bool { return c.CaptchaSecret != "" }
+
+// SheetsConfig holds the Google Sheets integration. The API writes to the
+// spreadsheets dojos link as its own service account (application default
+// credentials, or FIREBASE_SERVICE_ACCOUNT_JSON); owners share their sheet
+// with ServiceAccountEmail, that account's address.
+type SheetsConfig struct {
+	ServiceAccountEmail string
+}
+
+// Enabled reports whether the Google Sheets integration is configured
+func (c SheetsConfig) Enabled() bool { return c.ServiceAccountEmail != "" }
+
+// HTTPConfig holds server timeouts. WriteTimeout is the server's hard limit
+// for writing a response. Handler contexts expire earlier (RequestTimeout, or
+// SlowRequestTimeout for scan-heavy endpoints and jobs) so there is still
+// time to answer.
+type HTTPConfig struct {
+	WriteTimeout       time.Duration
+	RequestTimeout     time.Duration
+	SlowRequestTimeout time.Duration
+}
+
+// ScanBudgetConfig caps the documents one request of each report endpoint
+// reads (SCAN_BUDGET_*). A report that reaches its cap stops scanning and is
+// returned flagged partial.
+type ScanBudgetConfig struct {
+	DojoStats       int
+	MemberStats     int
+	AttendanceStats int // shared by the period and the one it is compared with
+	ProgramStats    int
+	Cohorts         int
+	RetentionAlerts int
+}
+
+// Load reads the environment, resolves Secret Manager references and
+// validates the result. It fails on the first boot instead of on the first
+// request that needs a missing setting.
+func Load(ctx context.Context) (Config, error) {
 	// FIREBASE_PROJECT_ID または GOOGLE_CLOUD_PROJECT を読む
 	projectID := getenv("FIREBASE_PROJECT_ID", "")
 	if projectID == "" {
 		projectID = getenv("GOOGLE_CLOUD_PROJECT", "")
 	}
-	
-	port := getenv("PORT", "8080")
-	origins := getenv("ALLOWED_ORIGINS", "http://localhost:3000")
+
 	storageBucket := getenv("FIREBASE_STORAGE_BUCKET", "")
 	if storageBucket == "" && projectID != "" {
 		storageBucket = projectID + ".appspot.com"
 	}
-	stripeSecretKey := getenv("STRIPE_SECRET_KEY", "")
-	stripeWebhookSecret := getenv("STRIPE_WEBHOOK_SECRET", "")
-	signedURLServiceAccountEmail := getenv("SIGNED_URL_SERVICE_ACCOUNT_EMAIL", "")
 
 	allowed := []string{}
-	for _, o := range strings.Split(origins, ",") {
+	for _, o := range strings.Split(getenv("ALLOWED_ORIGINS", "http://localhost:3000"), ",") {
 		o = strings.TrimSpace(o)
 		if o != "" {
 			allowed = append(allowed, o)
 		}
 	}
 
-	return Config{
+	cfg := Config{
+		Profile:                      Profile(strings.ToLower(getenv("APP_ENV", string(ProfileDev)))),
 		ProjectID:                    projectID,
-		Port:                         port,
+		Port:                         getenv("PORT", "8080"),
 		AllowedOrigins:               allowed,
+		AppURL:                       strings.TrimRight(getenv("APP_URL", ""), "/"),
 		StorageBucket:                storageBucket,
-		StripeSecretKey:              stripeSecretKey,
-		StripeWebhookSecret:          stripeWebhookSecret,
-		SignedURLServiceAccountEmail: signedURLServiceAccountEmail,
+		SignedURLServiceAccountEmail: getenv("SIGNED_URL_SERVICE_ACCOUNT_EMAIL", ""),
+		LocalStorageDir:              getenv("LOCAL_STORAGE_DIR", ""),
+		LocalStorageURL:              strings.TrimRight(getenv("LOCAL_STORAGE_URL", "http://localhost:"+getenv("PORT", "8080")), "/"),
+		DojoRegistryEnabled:          getenv("DOJO_REGISTRY_ENABLED", "") == "true",
+		MaintenanceMode:              getenv("MAINTENANCE_MODE", "") == "true",
+		MaintenanceMessage:           getenv("MAINTENANCE_MESSAGE", ""),
+		Stripe: StripeConfig{
+			SecretKey:            getenv("STRIPE_SECRET_KEY", ""),
+			WebhookSecret:        getenv("STRIPE_WEBHOOK_SECRET", ""),
+			PriceProMonthly:      getenv("STRIPE_PRICE_PRO_MONTHLY", ""),
+			PriceProYearly:       getenv("STRIPE_PRICE_PRO_YEARLY", ""),
+			PriceBusinessMonthly: getenv("STRIPE_PRICE_BUSINESS_MONTHLY", ""),
+			PriceBusinessYearly:  getenv("STRIPE_PRICE_BUSINESS_YEARLY", ""),
+		},
+		HTTP: HTTPConfig{
+			WriteTimeout:       getduration("HTTP_WRITE_TIMEOUT", 20*time.Second),
+			RequestTimeout:     getduration("REQUEST_TIMEOUT", 10*time.Second),
+			SlowRequestTimeout: getduration("SLOW_REQUEST_TIMEOUT", 18*time.Second),
+		},
+		InboundEmail: InboundEmailConfig{
+			Domain:            strings.ToLower(getenv("INBOUND_EMAIL_DOMAIN", "")),
+			Secret:            getenv("INBOUND_EMAIL_SECRET", ""),
+			MailgunSigningKey: getenv("MAILGUN_SIGNING_KEY", ""),
+		},
+		ContactForm: ContactFormConfig{
+			CaptchaSecret:    getenv("CAPTCHA_SECRET", ""),
+			CaptchaVerifyURL: getenv("CAPTCHA_VERIFY_URL", "https://challenges.cloudflare.com/turnstile/v0/siteverify"),
+		},
+		Sheets: SheetsConfig{
+			ServiceAccountEmail: getenv("SHEETS_SERVICE_ACCOUNT_EMAIL", ""),
+		},
+		ScanBudgets: ScanBudgetConfig{
+			DojoStats:       getint("SCAN_BUDGET_DOJO_STATS", 50000),
+			MemberStats:     getint("SCAN_BUDGET_MEMBER_STATS", 20000),
+			AttendanceStats: getint("SCAN_BUDGET_ATTENDANCE_STATS", 100000),
+			ProgramStats:    getint("SCAN_BUDGET_PROGRAM_STATS", 100000),
+			Cohorts:         getint("SCAN_BUDGET_COHORTS", 200000),
+			RetentionAlerts: getint("SCAN_BUDGET_RETENTION_ALERTS", 100000),
+		},
 	}
+
+	cfg.HTTP.clamp()
+
+	if err := resolveSecrets(ctx, &cfg); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Validate checks required settings for the profile and reports every
+// problem at once
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	switch c.Profile {
+	case ProfileDev, ProfileStaging, ProfileProd:
+	default:
+		add("APP_ENV must be one of dev, staging, prod (got %q)", c.Profile)
+	}
+	deployed := c.Profile == ProfileStaging || c.Profile == ProfileProd
+
+	if _, err := strconv.Atoi(c.Port); err != nil {
+		add("PORT must be a number (got %q)", c.Port)
+	}
+	if deployed && c.ProjectID == "" {
+		add("FIREBASE_PROJECT_ID or GOOGLE_CLOUD_PROJECT is required in %s", c.Profile)
+	}
+	if len(c.AllowedOrigins) == 0 {
+		add("ALLOWED_ORIGINS must list at least one origin")
+	}
+	if c.Profile == ProfileProd {
+		for _, o := range c.AllowedOrigins {
+			if o == "*" || strings.Contains(o, "localhost") {
+				add("ALLOWED_ORIGINS must not contain %q in prod", o)
+			}
+		}
+	}
+
+	if c.Stripe.Enabled() {
+		live := strings.HasPrefix(c.Stripe.SecretKey, "sk_live_") || strings.HasPrefix(c.Stripe.SecretKey, "rk_live_")
+		if c.Profile != ProfileProd && live {
+			add("STRIPE_SECRET_KEY must be a test key outside prod")
+		}
+		if c.Stripe.WebhookSecret == "" {
+			add("STRIPE_WEBHOOK_SECRET is required when STRIPE_SECRET_KEY is set")
+		}
+		if deployed {
+			for name, v := range map[string]string{
+				"STRIPE_PRICE_PRO_MONTHLY":      c.Stripe.PriceProMonthly,
+				"STRIPE_PRICE_PRO_YEARLY":       c.Stripe.PriceProYearly,
+				"STRIPE_PRICE_BUSINESS_MONTHLY": c.Stripe.PriceBusinessMonthly,
+				"STRIPE_PRICE_BUSINESS_YEARLY":  c.Stripe.PriceBusinessYearly,
+			} {
+				if v == "" {
+					add("%s is required in %s", name, c.Profile)
+				}
+			}
+		}
+	} else if c.Profile == ProfileProd {
+		add("STRIPE_SECRET_KEY is required in prod")
+	}
+
+	if deployed && c.LocalStorageDir != "" {
+		add("LOCAL_STORAGE_DIR is for development only, not %s", c.Profile)
+	}
+
+	if c.InboundEmail.Domain != "" && !c.InboundEmail.Enabled() {
+		add("INBOUND_EMAIL_SECRET or MAILGUN_SIGNING_KEY is required when INBOUND_EMAIL_DOMAIN is set")
+	}
+
+	if c.ContactForm.Enabled() && !strings.HasPrefix(c.ContactForm.CaptchaVerifyURL, "https://") {
+		add("CAPTCHA_VERIFY_URL must be an https URL (got %q)", c.ContactForm.CaptchaVerifyURL)
+	}
+
+	if c.Sheets.Enabled() && !strings.Contains(c.Sheets.ServiceAccountEmail, "@") {
+		add("SHEETS_SERVICE_ACCOUNT_EMAIL must be an email address (got %q)", c.Sheets.ServiceAccountEmail)
+	}
+
+	// clamp leaves handlers a second less than the write timeout
+	if c.HTTP.WriteTimeout <= time.Second {
+		add("HTTP_WRITE_TIMEOUT must be longer than 1s (got %s)", c.HTTP.WriteTimeout)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// clamp shortens handler timeouts that leave no time to write the (possibly
+// partial) response, with a warning instead of failing boot
+func (h *HTTPConfig) clamp() {
+	if limit := h.WriteTimeout - time.Second; h.SlowRequestTimeout > limit {
+		log.Printf("config: SLOW_REQUEST_TIMEOUT %s is not 1s below HTTP_WRITE_TIMEOUT %s, using %s", h.SlowRequestTimeout, h.WriteTimeout, limit)
+		h.SlowRequestTimeout = limit
+	}
+	if h.RequestTimeout > h.SlowRequestTimeout {
+		log.Printf("config: REQUEST_TIMEOUT %s exceeds SLOW_REQUEST_TIMEOUT, using %s", h.RequestTimeout, h.SlowRequestTimeout)
+		h.RequestTimeout = h.SlowRequestTimeout
+	}
+}
+
+// Redacted returns the configuration with secrets masked, for logs and the
+// admin config endpoint
+func (c Config) Redacted() map[string]any {
+	return map[string]any{
+		"profile":                      c.Profile,
+		"projectId":                    c.ProjectID,
+		"port":                         c.Port,
+		"allowedOrigins":               c.AllowedOrigins,
+		"appUrl":                       c.AppURL,
+		"storageBucket":                c.StorageBucket,
+		"signedUrlServiceAccountEmail": c.SignedURLServiceAccountEmail,
+		"localStorageDir":              c.LocalStorageDir,
+		"localStorageUrl":              c.LocalStorageURL,
+		"dojoRegistryEnabled":          c.DojoRegistryEnabled,
+		"maintenanceMode":              c.MaintenanceMode,
+		"maintenanceMessage":           c.MaintenanceMessage,
+		"stripe": map[string]any{
+			"secretKey":            redact(c.Stripe.SecretKey),
+			"webhookSecret":        redact(c.Stripe.WebhookSecret),
+			"priceProMonthly":      c.Stripe.PriceProMonthly,
+			"priceProYearly":       c.Stripe.PriceProYearly,
+			"priceBusinessMonthly": c.Stripe.PriceBusinessMonthly,
+			"priceBusinessYearly":  c.Stripe.PriceBusinessYearly,
+		},
+		"http": map[string]any{
+			"writeTimeout":       c.HTTP.WriteTimeout.String(),
+			"requestTimeout":     c.HTTP.RequestTimeout.String(),
+			"slowRequestTimeout": c.HTTP.SlowRequestTimeout.String(),
+		},
+		"inboundEmail": map[string]any{
+			"domain":            c.InboundEmail.Domain,
+			"secret":            redact(c.InboundEmail.Secret),
+			"mailgunSigningKey": redact(c.InboundEmail.MailgunSigningKey),
+		},
+		"contactForm": map[string]any{
+			"captchaSecret":    redact(c.ContactForm.CaptchaSecret),
+			"captchaVerifyUrl": c.ContactForm.CaptchaVerifyURL,
+		},
+		"sheets": map[string]any{
+			"serviceAccountEmail": c.Sheets.ServiceAccountEmail,
+		},
+		"scanBudgets": map[string]any{
+			"dojoStats":       c.ScanBudgets.DojoStats,
+			"memberStats":     c.ScanBudgets.MemberStats,
+			"attendanceStats": c.ScanBudgets.AttendanceStats,
+			"programStats":    c.ScanBudgets.ProgramStats,
+			"cohorts":         c.ScanBudgets.Cohorts,
+			"retentionAlerts": c.ScanBudgets.RetentionAlerts,
+		},
+	}
+}
+
+// redact keeps a secret's prefix (e.g. sk_test_) so the key mode stays visible
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if i := strings.LastIndex(secret, "_"); i > 0 && i < 12 {
+		return secret[:i+1] + "****"
+	}
+	return "****"
 }
 
 func getenv(key, def string) string {
@@ -59,3 +373,21 @@ func getenv(key, def string) string {
 	}
 	return v
 }
+
+// getduration reads a Go duration ("15s", "2m"); invalid values fall back to def
+func getduration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// getint reads a positive integer; invalid values fall back to def
+func getint(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
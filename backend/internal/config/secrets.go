@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// Secret values can be given as Secret Manager references instead of
+// plaintext env vars:
+//
+//	STRIPE_SECRET_KEY=sm://stripe-secret-key                     (latest version in ProjectID)
+//	STRIPE_SECRET_KEY=sm://projects/p/secrets/stripe-secret-key/versions/3
+const secretRefPrefix = "sm://"
+
+// resolveSecrets replaces Secret Manager references in cfg with their values
+func resolveSecrets(ctx context.Context, cfg *Config) error {
+	fields := map[string]*string{
+		"STRIPE_SECRET_KEY":     &cfg.Stripe.SecretKey,
+		"STRIPE_WEBHOOK_SECRET": &cfg.Stripe.WebhookSecret,
+		"INBOUND_EMAIL_SECRET":  &cfg.InboundEmail.Secret,
+		"MAILGUN_SIGNING_KEY":   &cfg.InboundEmail.MailgunSigningKey,
+		"CAPTCHA_SECRET":        &cfg.ContactForm.CaptchaSecret,
+	}
+
+	var svc *secretmanager.Service
+	for name, field := range fields {
+		ref, ok := strings.CutPrefix(*field, secretRefPrefix)
+		if !ok {
+			continue
+		}
+		if svc == nil {
+			var err error
+			if svc, err = secretmanager.NewService(ctx, credentialOptions()...); err != nil {
+				return fmt.Errorf("secret manager client: %w", err)
+			}
+		}
+
+		version, err := secretVersionName(ref, cfg.ProjectID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		resp, err := svc.Projects.Secrets.Versions.Access(version).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("%s: failed to access %s: %w", name, version, err)
+		}
+		value, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+		if err != nil {
+			return fmt.Errorf("%s: failed to decode secret payload: %w", name, err)
+		}
+		*field = strings.TrimSpace(string(value))
+	}
+	return nil
+}
+
+// secretVersionName expands a reference to projects/*/secrets/*/versions/*
+func secretVersionName(ref, projectID string) (string, error) {
+	if !strings.HasPrefix(ref, "projects/") {
+		if projectID == "" {
+			return "", fmt.Errorf("short secret reference %q needs a project id", ref)
+		}
+		ref = "projects/" + projectID + "/secrets/" + ref
+	}
+	if !strings.Contains(ref, "/versions/") {
+		ref += "/versions/latest"
+	}
+	if strings.Count(ref, "/") != 5 {
+		return "", fmt.Errorf("malformed secret reference %q", ref)
+	}
+	return ref, nil
+}
+
+// credentialOptions mirrors firebase.CredentialOptions (which imports this
+// package, so it cannot be used here)
+func credentialOptions() []option.ClientOption {
+	if json := os.Getenv("FIREBASE_SERVICE_ACCOUNT_JSON"); json != "" {
+		return []option.ClientOption{option.WithCredentialsJSON([]byte(json))}
+	}
+	return nil
+}
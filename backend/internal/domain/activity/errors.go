@@ -0,0 +1,16 @@
+package activity
+
+import "errors"
+
+var (
+	ErrBadRequest  = errors.New("bad request")
+	ErrRateLimited = errors.New("rate limited")
+)
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
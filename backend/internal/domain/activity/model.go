@@ -0,0 +1,47 @@
+package activity
+
+import "time"
+
+// UserMonth is users/{uid}/appActivity/{YYYY-MM}: how often the user
+// opened the app on each day of the month
+type UserMonth struct {
+	Month     string           `firestore:"month"`
+	Days      map[string]int64 `firestore:"days"` // day of month ("16") → opens
+	UpdatedAt time.Time        `firestore:"updatedAt"`
+}
+
+// mask is the month's days with an open, bit d-1 for day d
+func (m UserMonth) mask() int64 {
+	var mask int64
+	for day, n := range m.Days {
+		if d, ok := dayOfMonth(day); ok && n > 0 {
+			mask |= 1 << (d - 1)
+		}
+	}
+	return mask
+}
+
+// DojoMonth is dojos/{dojoId}/appActivity/{YYYY-MM}: per member, the days
+// of the month they opened the app, as a bitmask (bit d-1 for day d). One
+// small doc per dojo and month holds the whole roster.
+type DojoMonth struct {
+	Month     string           `firestore:"month"`
+	Members   map[string]int64 `firestore:"members"`
+	UpdatedAt time.Time        `firestore:"updatedAt"`
+}
+
+// HeartbeatResult is the answer to POST /v1/me/heartbeat
+type HeartbeatResult struct {
+	Date       string `json:"date"`       // YYYY-MM-DD (UTC)
+	FirstToday bool   `json:"firstToday"` // the first open of the day, which the user's dojos count
+	OpensToday int64  `json:"opensToday"`
+}
+
+// Adoption is how many of a dojo's active members use the app
+type Adoption struct {
+	Members      int     `json:"members"` // active members
+	ActiveToday  int     `json:"activeToday"`
+	Active7Days  int     `json:"active7Days"`
+	Active28Days int     `json:"active28Days"`
+	Rate         float64 `json:"rate"` // Active28Days ÷ Members, 0-1
+}
@@ -0,0 +1,269 @@
+// Package activity records when members open the app, for the owner
+// dashboard's adoption figures and as an engagement signal besides
+// attendance for retention scoring.
+package activity
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// heartbeatInterval is how often one user's heartbeat is accepted
+	heartbeatInterval = time.Minute
+	// maxTrackedUsers bounds the in-process rate limiter
+	maxTrackedUsers = 20000
+
+	// MaxWindowDays is the longest window ActiveDays counts, so it never
+	// needs more than this month and the one before
+	MaxWindowDays = 28
+
+	monthLayout = "2006-01"
+)
+
+// Service records heartbeats. The rate limit is per instance; it only has
+// to keep a chatty client from writing on every request, the daily counts
+// stay right either way.
+type Service struct {
+	fs *firestore.Client
+
+	mu       sync.Mutex
+	lastBeat map[string]time.Time
+}
+
+func NewService(fs *firestore.Client) *Service {
+	return &Service{fs: fs, lastBeat: map[string]time.Time{}}
+}
+
+func (s *Service) userMonthRef(uid, month string) *firestore.DocumentRef {
+	return s.fs.Collection("users").Doc(uid).Collection("appActivity").Doc(month)
+}
+
+func (s *Service) dojoMonthRef(dojoID, month string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("appActivity").Doc(month)
+}
+
+func dayOfMonth(s string) (int, bool) {
+	d, err := strconv.Atoi(s)
+	return d, err == nil && d >= 1 && d <= 31
+}
+
+// allow applies the per-user rate limit
+func (s *Service) allow(uid string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.lastBeat[uid]; ok && now.Sub(last) < heartbeatInterval {
+		return false
+	}
+	if len(s.lastBeat) >= maxTrackedUsers {
+		for k, t := range s.lastBeat {
+			if now.Sub(t) >= heartbeatInterval {
+				delete(s.lastBeat, k)
+			}
+		}
+		if len(s.lastBeat) >= maxTrackedUsers {
+			s.lastBeat = map[string]time.Time{}
+		}
+	}
+	s.lastBeat[uid] = now
+	return true
+}
+
+// Heartbeat records that the user opened the app. The first open of the day
+// is also marked in the month doc of each dojo the user is an active member
+// of; later ones only count opens.
+func (s *Service) Heartbeat(ctx context.Context, uid string, now time.Time) (*HeartbeatResult, error) {
+	if uid == "" {
+		return nil, fmt.Errorf("%w: uid is required", ErrBadRequest)
+	}
+	now = now.UTC()
+	if !s.allow(uid, now) {
+		return nil, fmt.Errorf("%w: heartbeat sent too often", ErrRateLimited)
+	}
+
+	month := now.Format(monthLayout)
+	day := strconv.Itoa(now.Day())
+	ref := s.userMonthRef(uid, month)
+
+	var um UserMonth
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		um = UserMonth{Month: month, Days: map[string]int64{}}
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return err
+		}
+		if doc.Exists() {
+			if err := doc.DataTo(&um); err != nil {
+				return err
+			}
+			if um.Days == nil {
+				um.Days = map[string]int64{}
+			}
+		}
+		um.Days[day]++
+		um.UpdatedAt = now
+		return tx.Set(ref, um)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+
+	out := &HeartbeatResult{
+		Date:       now.Format("2006-01-02"),
+		FirstToday: um.Days[day] == 1,
+		OpensToday: um.Days[day],
+	}
+	if out.FirstToday {
+		if err := s.markDojos(ctx, uid, month, um.mask(), now); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// markDojos copies the user's days of the month into their dojos' month docs
+func (s *Service) markDojos(ctx context.Context, uid, month string, mask int64, now time.Time) error {
+	iter := s.fs.Collection("users").Doc(uid).Collection("dojoMemberships").
+		Where("status", "in", []string{"active", "approved"}).
+		Select().Documents(ctx)
+	defer iter.Stop()
+
+	batch := s.fs.Batch()
+	n := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list memberships: %w", err)
+		}
+		batch.Set(s.dojoMonthRef(doc.Ref.ID, month), map[string]interface{}{
+			"month":     month,
+			"members":   map[string]interface{}{uid: mask},
+			"updatedAt": now,
+		}, firestore.MergeAll)
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to record dojo activity: %w", err)
+	}
+	return nil
+}
+
+// lastActive returns, per member of the dojo, how many days ago (0 = today)
+// they last opened the app within the window ending today, and on how many
+// days of it
+func (s *Service) lastActive(ctx context.Context, dojoID string, now time.Time, window int) (last, days map[string]int, err error) {
+	if window < 1 || window > MaxWindowDays {
+		return nil, nil, fmt.Errorf("%w: window must be 1-%d days", ErrBadRequest, MaxWindowDays)
+	}
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, -(window - 1))
+
+	refs := []*firestore.DocumentRef{s.dojoMonthRef(dojoID, today.Format(monthLayout))}
+	if start.Month() != today.Month() {
+		refs = append(refs, s.dojoMonthRef(dojoID, start.Format(monthLayout)))
+	}
+	snaps, err := s.fs.GetAll(ctx, refs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load app activity: %w", err)
+	}
+	months := map[string]map[string]int64{}
+	for _, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		var dm DojoMonth
+		if err := snap.DataTo(&dm); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode app activity: %w", err)
+		}
+		months[snap.Ref.ID] = dm.Members
+	}
+
+	last, days = map[string]int{}, map[string]int{}
+	for ago := window - 1; ago >= 0; ago-- {
+		d := today.AddDate(0, 0, -ago)
+		bit := int64(1) << (d.Day() - 1)
+		for uid, mask := range months[d.Format(monthLayout)] {
+			if mask&bit != 0 {
+				last[uid] = ago
+				days[uid]++
+			}
+		}
+	}
+	return last, days, nil
+}
+
+// ActiveDays counts, per member of the dojo, the days of the last window
+// days (up to MaxWindowDays, today included) they opened the app. Members
+// who did not are left out.
+func (s *Service) ActiveDays(ctx context.Context, dojoID string, now time.Time, window int) (map[string]int, error) {
+	_, days, err := s.lastActive(ctx, dojoID, now, window)
+	return days, err
+}
+
+// Adoption reports how many of the dojo's active members opened the app
+// today, in the last 7 days and in the last 4 weeks (no permission check;
+// the dashboard checks staff)
+func (s *Service) Adoption(ctx context.Context, dojoID string, now time.Time) (*Adoption, error) {
+	last, _, err := s.lastActive(ctx, dojoID, now, MaxWindowDays)
+	if err != nil {
+		return nil, err
+	}
+	members := s.fs.Collection("dojos").Doc(dojoID).Collection("members").
+		Where("status", "in", []string{"active", "approved"})
+	res, err := members.NewAggregationQuery().WithCount("members").Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count members: %w", err)
+	}
+
+	out := &Adoption{}
+	if v, ok := res["members"].(*firestorepb.Value); ok {
+		out.Members = int(v.GetIntegerValue())
+	}
+	for _, ago := range last {
+		out.Active28Days++
+		if ago < 7 {
+			out.Active7Days++
+		}
+		if ago == 0 {
+			out.ActiveToday++
+		}
+	}
+	if out.Members > 0 {
+		// members suspended since their last open still count as active
+		out.Rate = math.Min(1, math.Round(float64(out.Active28Days)/float64(out.Members)*1000)/1000)
+	}
+	return out, nil
+}
+
+// ForgetMember drops a departed member from the dojo's recent month docs,
+// so adoption only counts members still in the dojo
+func (s *Service) ForgetMember(ctx context.Context, dojoID, memberUID string, now time.Time) error {
+	now = now.UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, month := range []time.Time{thisMonth, thisMonth.AddDate(0, -1, 0)} {
+		_, err := s.dojoMonthRef(dojoID, month.Format(monthLayout)).Update(ctx, []firestore.Update{
+			{FieldPath: firestore.FieldPath{"members", memberUID}, Value: firestore.Delete},
+		})
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to forget app activity: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package attendance
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/blob"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	// archiveChunk is read per query; a chunk is exported, rolled up and
+	// deleted in one batch, which Firestore caps at 500 writes
+	archiveChunk     = 200
+	maxBatchWrites   = 450
+	maxArchivePerRun = 5000 // records per dojo per run; the next run continues
+	archivePrefix    = "attendance-archive"
+)
+
+// SetArchiveStore enables attendance archival; raw records are exported to
+// store before they are deleted
+func (s *Service) SetArchiveStore(store blob.Store) {
+	s.archive = store
+}
+
+// GetRetentionPolicy returns the dojo's attendance retention policy
+func (s *Service) GetRetentionPolicy(ctx context.Context, dojoID string) (*RetentionPolicy, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	return s.repo.retentionPolicy(ctx, dojoID)
+}
+
+// UpdateRetentionPolicy turns archival on or off and sets how many years of
+// raw records are kept
+func (s *Service) UpdateRetentionPolicy(ctx context.Context, staffUID, dojoID string, in UpdateRetentionPolicyInput) (*RetentionPolicy, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.RetainYears != nil && (*in.RetainYears < 1 || *in.RetainYears > MaxRetainYears) {
+		return nil, fmt.Errorf("%w: retainYears must be 1-%d", ErrBadRequest, MaxRetainYears)
+	}
+	if in.Enabled != nil && *in.Enabled && s.archive == nil {
+		return nil, fmt.Errorf("%w: attendance archival needs Cloud Storage, which is not configured", ErrBadRequest)
+	}
+
+	p, err := s.repo.retentionPolicy(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Enabled != nil {
+		p.Enabled = *in.Enabled
+	}
+	if in.RetainYears != nil {
+		p.RetainYears = *in.RetainYears
+	}
+	p.UpdatedAt = time.Now().UTC()
+	p.UpdatedBy = staffUID
+	if _, err := s.repo.retentionRef(dojoID).Set(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return p, nil
+}
+
+// ListMonthlySummaries returns the rolled-up months of archived attendance, oldest first
+func (s *Service) ListMonthlySummaries(ctx context.Context, dojoID string) ([]MonthlySummary, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	return s.repo.MonthlySummaries(ctx, dojoID)
+}
+
+// ArchiveOld applies every enabled retention policy: attendance created
+// before the first of the month RetainYears ago is exported to Cloud
+// Storage as gzipped JSON lines, added to its month's summary and deleted.
+// Meant to be triggered daily by Cloud Scheduler; large backlogs are worked
+// off over several runs.
+func (s *Service) ArchiveOld(ctx context.Context, now time.Time) (*ArchiveResult, error) {
+	if s.archive == nil {
+		return nil, fmt.Errorf("%w: attendance archival needs Cloud Storage, which is not configured", ErrBadRequest)
+	}
+	res := &ArchiveResult{}
+
+	iter := s.repo.client.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+		dojoID := doc.Ref.ID
+		p, err := s.repo.retentionPolicy(ctx, dojoID)
+		if err != nil || !p.Enabled {
+			continue
+		}
+		res.DojosEnabled++
+
+		cutoff := time.Date(now.Year()-p.RetainYears, now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if err := s.archiveDojo(ctx, dojoID, cutoff, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			res.Failed++
+			log.Printf("attendance archive: dojo %s: %v", dojoID, err)
+			continue
+		}
+		if _, err := s.repo.retentionRef(dojoID).Update(ctx, []firestore.Update{{Path: "lastArchivedAt", Value: now.UTC()}}); err != nil {
+			log.Printf("attendance archive: dojo %s: failed to stamp policy: %v", dojoID, err)
+		}
+	}
+
+	log.Printf("attendance archive: %d dojos checked, %d enabled, %d records archived in %d exports, %d failed (partial=%v)",
+		res.DojosChecked, res.DojosEnabled, res.Archived, res.Exports, res.Failed, res.Partial)
+	return res, nil
+}
+
+// archivedRecord is one exported line: the record and its revision history
+type archivedRecord struct {
+	Attendance
+	Revisions []Revision `json:"revisions,omitempty"`
+	refs      []*firestore.DocumentRef
+}
+
+func (s *Service) archiveDojo(ctx context.Context, dojoID string, cutoff time.Time, res *ArchiveResult) error {
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	col := db.Collection("dojos").Doc(dojoID).Collection("attendance")
+
+	for done := 0; done < maxArchivePerRun; {
+		// archived records are deleted, so each query starts from the oldest left
+		docs, err := col.Where("createdAt", "<", cutoff).OrderBy("createdAt", firestore.Asc).Limit(archiveChunk).Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to read old attendance: %w", err)
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		var chunk []archivedRecord
+		writes, months := 0, map[string]bool{}
+		for _, doc := range docs {
+			rec, err := loadArchivedRecord(ctx, doc)
+			if err != nil {
+				return err
+			}
+			// the deletes plus one summary write per month
+			cost := len(rec.refs)
+			if month := rec.CreatedAt.UTC().Format("2006-01"); !months[month] {
+				cost++
+				months[month] = true
+			}
+			if writes+cost > maxBatchWrites && len(chunk) > 0 {
+				break
+			}
+			chunk = append(chunk, rec)
+			writes += cost
+		}
+
+		if err := s.archiveChunk(ctx, db, dojoID, chunk); err != nil {
+			return err
+		}
+		res.Archived += len(chunk)
+		res.Exports++
+		done += len(chunk)
+	}
+	return nil
+}
+
+func loadArchivedRecord(ctx context.Context, doc *firestore.DocumentSnapshot) (archivedRecord, error) {
+	rec := archivedRecord{refs: []*firestore.DocumentRef{doc.Ref}}
+	if err := doc.DataTo(&rec.Attendance); err != nil {
+		log.Printf("attendance archive: %s is malformed, exporting the fields that decode: %v", doc.Ref.Path, err)
+	}
+	rec.ID = doc.Ref.ID
+	revs, err := doc.Ref.Collection("revisions").Documents(ctx).GetAll()
+	if err != nil {
+		return rec, fmt.Errorf("failed to read revisions of %s: %w", doc.Ref.ID, err)
+	}
+	for _, r := range revs {
+		var rev Revision
+		if err := r.DataTo(&rev); err == nil {
+			rev.ID = r.Ref.ID
+			rec.Revisions = append(rec.Revisions, rev)
+		}
+		rec.refs = append(rec.refs, r.Ref)
+	}
+	return rec, nil
+}
+
+// archiveChunk exports the records, then deletes them and adds them to their
+// month summaries in one batch. If the batch fails the records stay and the
+// next run exports them again, so the archive may repeat lines but never
+// misses one.
+func (s *Service) archiveChunk(ctx context.Context, db *firestore.Client, dojoID string, chunk []archivedRecord) error {
+	first := chunk[0].CreatedAt.UTC()
+	object := fmt.Sprintf("%s/%s/%s/%d.jsonl.gz", archivePrefix, dojoID, first.Format("2006-01"), time.Now().UnixNano())
+	if err := s.export(ctx, dojoID, object, chunk); err != nil {
+		return fmt.Errorf("failed to export to %s: %w", object, err)
+	}
+
+	months := map[string]*monthRollup{}
+	batch := db.Batch()
+	for _, rec := range chunk {
+		month := rec.CreatedAt.UTC().Format("2006-01")
+		if months[month] == nil {
+			months[month] = &monthRollup{members: map[string]map[string]int{}, sessions: map[string]int{}}
+		}
+		months[month].add(rec)
+		for _, ref := range rec.refs {
+			batch.Delete(ref)
+		}
+	}
+
+	summaries := db.Collection("dojos").Doc(dojoID).Collection("attendanceMonthly")
+	for month, m := range months {
+		update := increments(m.counts)
+		update["month"] = month
+		update["total"] = firestore.Increment(m.total)
+		update["exports"] = firestore.ArrayUnion(object)
+		update["updatedAt"] = time.Now().UTC()
+		// an empty map would replace the merged one, so only set what changed
+		if len(m.members) > 0 {
+			members := map[string]interface{}{}
+			for uid, counts := range m.members {
+				members[uid] = increments(counts)
+			}
+			update["members"] = members
+		}
+		if len(m.sessions) > 0 {
+			sessions := map[string]interface{}{}
+			for sid, n := range m.sessions {
+				sessions[sid] = firestore.Increment(n)
+			}
+			update["sessions"] = sessions
+		}
+		batch.Set(summaries.Doc(month), update, firestore.MergeAll)
+	}
+
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to roll up archived attendance: %w", err)
+	}
+	return nil
+}
+
+// monthRollup is what a chunk adds to one month's summary
+type monthRollup struct {
+	total    int
+	counts   map[string]int
+	members  map[string]map[string]int // memberUid -> status -> n
+	sessions map[string]int            // sessionId -> check-ins
+}
+
+func (m *monthRollup) add(rec archivedRecord) {
+	status := string(rec.Status)
+	m.total++
+	if !IsValidStatus(status) {
+		return
+	}
+	if m.counts == nil {
+		m.counts = map[string]int{}
+	}
+	m.counts[status]++
+	// map keys become field paths in the merge
+	if rec.MemberUID != "" && !strings.ContainsAny(rec.MemberUID, ".`") {
+		if m.members[rec.MemberUID] == nil {
+			m.members[rec.MemberUID] = map[string]int{}
+		}
+		m.members[rec.MemberUID][status]++
+	}
+	if sid := instanceid.SessionID(rec.SessionInstanceID); isCheckin(status) && sid != "" && !strings.ContainsAny(sid, ".`") {
+		m.sessions[sid]++
+	}
+}
+
+// increments turns status counts into Firestore increments
+func increments(counts map[string]int) map[string]interface{} {
+	out := make(map[string]interface{}, len(counts))
+	for status, n := range counts {
+		out[status] = firestore.Increment(n)
+	}
+	return out
+}
+
+// export writes the records as gzipped JSON lines, within the dojo's part
+// of the archive
+func (s *Service) export(ctx context.Context, dojoID, object string, chunk []archivedRecord) error {
+	objects := blob.Within(s.archive, archivePrefix+"/"+dojoID+"/")
+	w, err := objects.NewWriter(ctx, object, blob.WriteOptions{
+		ContentType:     "application/x-ndjson",
+		ContentEncoding: "gzip",
+	})
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	for _, rec := range chunk {
+		if err := enc.Encode(rec); err != nil {
+			w.Abort(err)
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		w.Abort(err)
+		return err
+	}
+	return w.Close()
+}
+
+func (r *Repo) retentionRef(dojoID string) *firestore.DocumentRef {
+	return r.client.Collection("dojos").Doc(dojoID).Collection("settings").Doc("attendanceRetention")
+}
+
+func (r *Repo) retentionPolicy(ctx context.Context, dojoID string) (*RetentionPolicy, error) {
+	doc, err := r.retentionRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load retention policy: %w", err)
+	}
+	p := &RetentionPolicy{}
+	if doc.Exists() {
+		if err := doc.DataTo(p); err != nil {
+			return nil, fmt.Errorf("failed to decode retention policy: %w", err)
+		}
+	}
+	if p.RetainYears <= 0 {
+		p.RetainYears = DefaultRetainYears
+	}
+	return p, nil
+}
+
+// MonthlySummaries lists the dojo's archived-attendance summaries, oldest first
+func (r *Repo) MonthlySummaries(ctx context.Context, dojoID string) ([]MonthlySummary, error) {
+	db, err := r.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := db.Collection("dojos").Doc(dojoID).Collection("attendanceMonthly").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attendance summaries: %w", err)
+	}
+	out := make([]MonthlySummary, 0, len(docs))
+	for _, doc := range docs {
+		var m MonthlySummary
+		if err := doc.DataTo(&m); err != nil {
+			continue
+		}
+		if m.Month == "" {
+			m.Month = doc.Ref.ID
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Month < out[j].Month })
+	return out, nil
+}
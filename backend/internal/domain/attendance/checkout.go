@@ -0,0 +1,83 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/events"
+)
+
+// CheckOut stamps the time a checked-in member left, e.g. a child picked up
+// after a kids class. A record is checked out once.
+func (s *Service) CheckOut(ctx context.Context, staffUID, dojoID, attendanceID string) (*Attendance, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	attendanceID = strings.TrimSpace(attendanceID)
+	if dojoID == "" || attendanceID == "" {
+		return nil, fmt.Errorf("%w: dojoId and id are required", ErrBadRequest)
+	}
+
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+
+	now := time.Now().UTC()
+	out, err := s.repo.CheckOut(ctx, dojoID, attendanceID, now)
+	if err != nil {
+		return nil, err
+	}
+	s.bus.Publish(ctx, events.AttendanceCheckedOut{
+		DojoID:            dojoID,
+		SessionInstanceID: out.SessionInstanceID,
+		MemberUID:         out.MemberUID,
+		RecordedBy:        staffUID,
+		At:                now,
+	})
+	return out, nil
+}
+
+// CheckOut sets checkOutTime on a present or late record that has none
+func (r *Repo) CheckOut(ctx context.Context, dojoID, attendanceID string, at time.Time) (*Attendance, error) {
+	db, err := r.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	ref := db.Collection("dojos").Doc(dojoID).Collection("attendance").Doc(attendanceID)
+	err = db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to load attendance: %w", err)
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: attendance not found", ErrNotFound)
+		}
+		var att Attendance
+		if err := doc.DataTo(&att); err != nil {
+			return fmt.Errorf("failed to decode attendance: %w", err)
+		}
+		if !isCheckin(string(att.Status)) {
+			return fmt.Errorf("%w: only members marked present or late can be checked out", ErrBadRequest)
+		}
+		if att.CheckOutTime != nil {
+			return fmt.Errorf("%w: already checked out at %s", ErrConflict, att.CheckOutTime.Format(time.RFC3339))
+		}
+		return tx.Set(ref, map[string]interface{}{
+			"checkOutTime": at,
+			"updatedAt":    at,
+		}, firestore.MergeAll)
+	})
+	if err != nil {
+		if IsErrNotFound(err) || IsErrBadRequest(err) || IsErrConflict(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to check out: %w", err)
+	}
+	return r.Get(ctx, dojoID, attendanceID)
+}
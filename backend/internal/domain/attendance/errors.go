@@ -6,6 +6,9 @@ var (
 	ErrUnauthorized = errors.New("unauthorized")
 	ErrNotFound     = errors.New("not found")
 	ErrBadRequest   = errors.New("bad request")
+	ErrTooLarge     = errors.New("payload too large")
+	ErrConflict     = errors.New("conflict")
+	ErrSuspended    = errors.New("member suspended")
 )
 
 func IsErrUnauthorized(err error) bool {
@@ -19,3 +22,15 @@ func IsErrNotFound(err error) bool {
 func IsErrBadRequest(err error) bool {
 	return errors.Is(err, ErrBadRequest)
 }
+
+func IsErrTooLarge(err error) bool {
+	return errors.Is(err, ErrTooLarge)
+}
+
+func IsErrConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+func IsErrSuspended(err error) bool {
+	return errors.Is(err, ErrSuspended)
+}
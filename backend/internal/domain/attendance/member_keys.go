@@ -0,0 +1,111 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Front-desk staff often know a member's email or member number (printed on
+// the badge, see dojo.EnsureMemberNumber) rather than their UID. Records may
+// name the member by any of the three; memberUid wins, then memberNumber,
+// then memberEmail. Keys are resolved after the staff check, so they cannot
+// be used to probe who belongs to a dojo.
+
+// resolveMember returns the UID of the member a record names, or "" when
+// the keys match no member of the dojo
+func (s *Service) resolveMember(ctx context.Context, dojoID, memberUID, email string, number int) (string, error) {
+	if memberUID != "" {
+		return memberUID, nil
+	}
+	if number < 0 {
+		return "", fmt.Errorf("%w: memberNumber must be positive", ErrBadRequest)
+	}
+	if number > 0 {
+		return s.dojoRepo.MemberUIDByNumber(ctx, dojoID, number)
+	}
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		return s.dojoRepo.MemberUIDByEmail(ctx, dojoID, email)
+	}
+	return "", nil
+}
+
+// resolveBulkMembers fills in the MemberUID of records that name their member
+// by number or email, looking them all up in a few batched queries rather
+// than one per record. Records whose keys match no member keep an empty
+// MemberUID.
+func (s *Service) resolveBulkMembers(ctx context.Context, dojoID string, records []BulkAttendanceRecord) error {
+	var numbers []int
+	var emails []string
+	seenNumbers := map[int]bool{}
+	seenEmails := map[string]bool{}
+	for _, rec := range records {
+		if rec.MemberUID != "" {
+			continue
+		}
+		if rec.MemberNumber < 0 {
+			return fmt.Errorf("%w: memberNumber must be positive", ErrBadRequest)
+		}
+		if n := rec.MemberNumber; n > 0 {
+			if !seenNumbers[n] {
+				seenNumbers[n] = true
+				numbers = append(numbers, n)
+			}
+			continue
+		}
+		if email := strings.ToLower(strings.TrimSpace(rec.MemberEmail)); email != "" && !seenEmails[email] {
+			seenEmails[email] = true
+			emails = append(emails, email)
+		}
+	}
+
+	var byNumber map[int]string
+	var byEmail map[string]string
+	var err error
+	if len(numbers) > 0 {
+		if byNumber, err = s.dojoRepo.MemberUIDsByNumber(ctx, dojoID, numbers); err != nil {
+			return err
+		}
+	}
+	if len(emails) > 0 {
+		if byEmail, err = s.dojoRepo.MemberUIDsByEmail(ctx, dojoID, emails); err != nil {
+			return err
+		}
+	}
+	for i := range records {
+		rec := &records[i]
+		switch {
+		case rec.MemberUID != "":
+		case rec.MemberNumber > 0:
+			rec.MemberUID = byNumber[rec.MemberNumber]
+		default:
+			rec.MemberUID = byEmail[strings.ToLower(strings.TrimSpace(rec.MemberEmail))]
+		}
+	}
+	return nil
+}
+
+// hasMemberKey reports whether a record names its member in any way
+func hasMemberKey(memberUID, email string, number int) bool {
+	return memberUID != "" || strings.TrimSpace(email) != "" || number != 0
+}
+
+// resolveRecordMember fills in.MemberUID from the natural keys
+func (s *Service) resolveRecordMember(ctx context.Context, in *RecordAttendanceInput) error {
+	uid, err := s.resolveMember(ctx, in.DojoID, in.MemberUID, in.MemberEmail, in.MemberNumber)
+	if err != nil {
+		return err
+	}
+	if uid == "" {
+		return fmt.Errorf("%w: no member of this dojo matches %s", ErrNotFound, describeMemberKey(in.MemberEmail, in.MemberNumber))
+	}
+	in.MemberUID = uid
+	return nil
+}
+
+func describeMemberKey(email string, number int) string {
+	if number > 0 {
+		return fmt.Sprintf("member number %d", number)
+	}
+	return "email " + email
+}
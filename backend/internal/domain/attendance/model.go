@@ -1,8 +1,11 @@
 package attendance
 
 import (
+	"fmt"
 	"strings"
 	"time"
+
+	"dojo-manager/backend/internal/instanceid"
 )
 
 // AttendanceStatus represents the status of an attendance record
@@ -46,18 +49,27 @@ type RecordAttendanceInput struct {
 	DojoID            string `json:"dojoId"`
 	SessionInstanceID string `json:"sessionInstanceId"`
 	MemberUID         string `json:"memberUid"`
+	MemberEmail       string `json:"memberEmail,omitempty"`  // instead of memberUid, see member_keys.go
+	MemberNumber      int    `json:"memberNumber,omitempty"` // instead of memberUid
 	Status            string `json:"status"`
 	Notes             string `json:"notes,omitempty"`
+	OverrideCredits   bool   `json:"overrideCredits,omitempty"` // check in a package member with no credits left
+	Force             bool   `json:"force,omitempty"`           // skip the schedule check, for corrections
+	Reason            string `json:"reason,omitempty"`          // kept in the revision history when this changes a record
+
+	checkEligibility bool // apply the class's eligibility rules (self check-in)
 }
 
 func (in *RecordAttendanceInput) Trim() {
 	in.DojoID = strings.TrimSpace(in.DojoID)
 	in.SessionInstanceID = strings.TrimSpace(in.SessionInstanceID)
 	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	in.MemberEmail = strings.ToLower(strings.TrimSpace(in.MemberEmail))
 	in.Status = strings.TrimSpace(in.Status)
 	if len(in.Notes) > 500 {
 		in.Notes = in.Notes[:500]
 	}
+	in.Reason = trimReason(in.Reason)
 }
 
 // UpdateAttendanceInput represents input for updating attendance
@@ -66,6 +78,11 @@ type UpdateAttendanceInput struct {
 	ID     string  `json:"id"`
 	Status *string `json:"status,omitempty"`
 	Notes  *string `json:"notes,omitempty"`
+
+	OverrideCredits bool `json:"overrideCredits,omitempty"`
+
+	// Reason is kept in the revision history, e.g. why a check-in was disputed
+	Reason string `json:"reason,omitempty"`
 }
 
 func (in *UpdateAttendanceInput) Trim() {
@@ -75,26 +92,195 @@ func (in *UpdateAttendanceInput) Trim() {
 		s := (*in.Notes)[:500]
 		in.Notes = &s
 	}
+	in.Reason = trimReason(in.Reason)
 }
 
 // BulkAttendanceRecord represents a single record in a bulk attendance request
 type BulkAttendanceRecord struct {
-	MemberUID string `json:"memberUid"`
-	Status    string `json:"status"`
-	Notes     string `json:"notes,omitempty"`
+	MemberUID    string `json:"memberUid"`
+	MemberEmail  string `json:"memberEmail,omitempty"`  // instead of memberUid
+	MemberNumber int    `json:"memberNumber,omitempty"` // instead of memberUid
+	Status       string `json:"status"`
+	Notes        string `json:"notes,omitempty"`
 }
 
+// MaxBulkRecords caps records per bulk attendance request
+const MaxBulkRecords = 500
+
 // BulkAttendanceInput represents input for bulk attendance recording
 type BulkAttendanceInput struct {
 	DojoID            string                 `json:"dojoId"`
 	SessionInstanceID string                 `json:"sessionInstanceId"`
 	Records           []BulkAttendanceRecord `json:"records"`
+	OverrideCredits   bool                   `json:"overrideCredits,omitempty"` // applies to every record
+	Force             bool                   `json:"force,omitempty"`           // skip the schedule check, for corrections
+	Reason            string                 `json:"reason,omitempty"`          // applies to every record changed
 }
 
 // ListAttendanceInput represents input for listing attendance
+//
+// The filters combine freely. Each equality filter (sessionInstanceId,
+// memberUid, status) is served by a composite index on that field and
+// createdAt in the requested direction, which Firestore merges when several
+// are set; see the attendance entries in firestore.indexes.json. From and To
+// filter on createdAt, so they need no index of their own.
 type ListAttendanceInput struct {
-	DojoID            string `json:"dojoId"`
-	SessionInstanceID string `json:"sessionInstanceId,omitempty"`
-	MemberUID         string `json:"memberUid,omitempty"`
-	Limit             int    `json:"limit,omitempty"`
+	DojoID            string   `json:"dojoId"`
+	SessionInstanceID string   `json:"sessionInstanceId,omitempty"`
+	MemberUID         string   `json:"memberUid,omitempty"`
+	Statuses          []string `json:"statuses,omitempty"` // any of them
+	From              string   `json:"from,omitempty"`     // YYYY-MM-DD, inclusive
+	To                string   `json:"to,omitempty"`       // YYYY-MM-DD, inclusive
+	Sort              string   `json:"sort,omitempty"`     // by createdAt: "desc" (default) or "asc"
+	Limit             int      `json:"limit,omitempty"`
+
+	start, end time.Time // From and To as a [start, end) range, set by validate
+}
+
+// Sort directions
+const (
+	SortDesc = "desc"
+	SortAsc  = "asc"
+)
+
+func (in *ListAttendanceInput) Trim() {
+	in.SessionInstanceID = strings.TrimSpace(in.SessionInstanceID)
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	in.From = strings.TrimSpace(in.From)
+	in.To = strings.TrimSpace(in.To)
+	in.Sort = strings.ToLower(strings.TrimSpace(in.Sort))
+	statuses := in.Statuses[:0]
+	for _, st := range in.Statuses {
+		if st = strings.ToLower(strings.TrimSpace(st)); st != "" {
+			statuses = append(statuses, st)
+		}
+	}
+	in.Statuses = statuses
+}
+
+// validate checks the filters and resolves From and To to UTC times
+func (in *ListAttendanceInput) validate() error {
+	for _, st := range in.Statuses {
+		if !IsValidStatus(st) {
+			return fmt.Errorf("%w: status must be one of: present, absent, late, excused", ErrBadRequest)
+		}
+	}
+	switch in.Sort {
+	case "":
+		in.Sort = SortDesc
+	case SortDesc, SortAsc:
+	default:
+		return fmt.Errorf("%w: sort must be asc or desc", ErrBadRequest)
+	}
+	if in.From != "" {
+		start, err := time.Parse(instanceid.DateLayout, in.From)
+		if err != nil {
+			return fmt.Errorf("%w: from must be YYYY-MM-DD", ErrBadRequest)
+		}
+		in.start = start
+	}
+	if in.To != "" {
+		last, err := time.Parse(instanceid.DateLayout, in.To)
+		if err != nil {
+			return fmt.Errorf("%w: to must be YYYY-MM-DD", ErrBadRequest)
+		}
+		if !in.start.IsZero() && last.Before(in.start) {
+			return fmt.Errorf("%w: to must not be before from", ErrBadRequest)
+		}
+		in.end = last.AddDate(0, 0, 1)
+	}
+	return nil
+}
+
+// Revision sources
+const (
+	SourceUpdate = "update" // PUT of a single record
+	SourceRecord = "record" // re-recording a member already on the sheet
+	SourceBulk   = "bulk"   // roll call
+)
+
+// Revision is dojos/{dojoId}/attendance/{id}/revisions/{revisionId}, written
+// by the server whenever a change alters a record's status or notes.
+// Clients cannot write it.
+type Revision struct {
+	ID             string           `firestore:"-" json:"id"`
+	PreviousStatus AttendanceStatus `firestore:"previousStatus" json:"previousStatus"`
+	Status         AttendanceStatus `firestore:"status" json:"status"`
+	PreviousNotes  string           `firestore:"previousNotes,omitempty" json:"previousNotes,omitempty"`
+	Notes          string           `firestore:"notes,omitempty" json:"notes,omitempty"`
+	ChangedBy      string           `firestore:"changedBy" json:"changedBy"`
+	ChangedAt      time.Time        `firestore:"changedAt" json:"changedAt"`
+	Reason         string           `firestore:"reason,omitempty" json:"reason,omitempty"`
+	Source         string           `firestore:"source" json:"source"`
+}
+
+// History is a record with its revisions, newest first
+type History struct {
+	Attendance *Attendance `json:"attendance"`
+	Revisions  []Revision  `json:"revisions"`
+}
+
+// maxReasonLength bounds revision reasons
+const maxReasonLength = 500
+
+func trimReason(reason string) string {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxReasonLength {
+		reason = reason[:maxReasonLength]
+	}
+	return reason
+}
+
+// Retention policy bounds
+const (
+	DefaultRetainYears = 3
+	MaxRetainYears     = 20
+)
+
+// RetentionPolicy is dojos/{dojoId}/settings/attendanceRetention. When
+// enabled, records older than RetainYears are exported to Cloud Storage,
+// rolled up into MonthlySummary docs and deleted.
+type RetentionPolicy struct {
+	Enabled        bool       `firestore:"enabled" json:"enabled"`
+	RetainYears    int        `firestore:"retainYears" json:"retainYears"`
+	LastArchivedAt *time.Time `firestore:"lastArchivedAt,omitempty" json:"lastArchivedAt,omitempty"`
+	UpdatedAt      time.Time  `firestore:"updatedAt" json:"updatedAt,omitempty"`
+	UpdatedBy      string     `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdateRetentionPolicyInput updates the policy (nil fields are left unchanged)
+type UpdateRetentionPolicyInput struct {
+	Enabled     *bool `json:"enabled,omitempty"`
+	RetainYears *int  `json:"retainYears,omitempty"`
+}
+
+// StatusCounts counts archived records by status
+type StatusCounts struct {
+	Present int `firestore:"present" json:"present"`
+	Absent  int `firestore:"absent" json:"absent"`
+	Late    int `firestore:"late" json:"late"`
+	Excused int `firestore:"excused" json:"excused"`
+}
+
+// MonthlySummary is dojos/{dojoId}/attendanceMonthly/{YYYY-MM}: what is left
+// of a month's attendance after archival, by month of createdAt
+type MonthlySummary struct {
+	Month string `firestore:"month" json:"month"`
+	StatusCounts
+	Total    int                     `firestore:"total" json:"total"`
+	Members  map[string]StatusCounts `firestore:"members" json:"members"`   // by memberUid
+	Sessions map[string]int          `firestore:"sessions" json:"sessions"` // check-ins by class (sessionId)
+	// Exports are the Cloud Storage objects holding the raw records
+	Exports   []string  `firestore:"exports" json:"exports"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// ArchiveResult summarizes an archival run
+type ArchiveResult struct {
+	DojosChecked int  `json:"dojosChecked"`
+	DojosEnabled int  `json:"dojosEnabled"`
+	Archived     int  `json:"archived"` // records exported, rolled up and deleted
+	Exports      int  `json:"exports"`  // objects written
+	Failed       int  `json:"failed"`   // dojos whose run stopped on an error
+	Partial      bool `json:"partial,omitempty"`
 }
@@ -0,0 +1,210 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Regular is a member who regularly attends a class
+type Regular struct {
+	MemberUID    string  `json:"memberUid"`
+	DisplayName  string  `json:"displayName,omitempty"`
+	Attended     int     `json:"attended"`
+	Rate         float64 `json:"rate"`                   // attended / instances in the window
+	LastAttended string  `json:"lastAttended,omitempty"` // YYYY-MM-DD
+	// MissedLast is true if the member did not attend the latest recorded instance
+	MissedLast bool `json:"missedLast"`
+}
+
+// RegularsResult is the roster suggestion for a class
+type RegularsResult struct {
+	SessionID      string    `json:"sessionId"`
+	Since          string    `json:"since"`
+	Instances      int       `json:"instances"`
+	LatestInstance string    `json:"latestInstance,omitempty"`
+	Regulars       []Regular `json:"regulars"`
+
+	// StaffNotes are the class's instructor-only notes; the roster is
+	// staff-only too
+	StaffNotes []session.StaffNote `json:"staffNotes,omitempty"`
+}
+
+// RegularsInput tunes the lookback window and cut-off
+type RegularsInput struct {
+	Weeks   int     // lookback, default 12
+	MinRate float64 // minimum attendance rate, default 0.3
+	Limit   int     // default 30
+}
+
+// Regulars returns members who attend a class most often, based on attendance of
+// its past instances (sessionInstanceId "YYYY-MM-DD__{sessionId}").
+func (s *Service) Regulars(ctx context.Context, dojoID, sessionID string, in RegularsInput) (*RegularsResult, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	sessionID = strings.TrimSpace(sessionID)
+	if dojoID == "" || sessionID == "" {
+		return nil, fmt.Errorf("%w: dojoId and sessionId are required", ErrBadRequest)
+	}
+
+	if in.Weeks <= 0 || in.Weeks > 52 {
+		in.Weeks = 12
+	}
+	if in.MinRate <= 0 || in.MinRate > 1 {
+		in.MinRate = 0.3
+	}
+	if in.Limit <= 0 || in.Limit > 100 {
+		in.Limit = 30
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -7*in.Weeks)
+	suffix := instanceid.Delim + sessionID
+
+	col, err := s.repo.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	iter := col.
+		Where("createdAt", ">=", since).
+		Documents(ctx)
+	defer iter.Stop()
+
+	instances := map[string]bool{}
+	attended := map[string]map[string]bool{} // memberUid -> instance dates
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attendance: %w", err)
+		}
+
+		data := doc.Data()
+		instanceID, _ := data["sessionInstanceId"].(string)
+		if !strings.HasSuffix(instanceID, suffix) {
+			continue
+		}
+		date := strings.TrimSuffix(instanceID, suffix)
+		instances[date] = true
+
+		status, _ := data["status"].(string)
+		uid, _ := data["memberUid"].(string)
+		if uid == "" || !isCheckin(status) {
+			continue
+		}
+		if attended[uid] == nil {
+			attended[uid] = map[string]bool{}
+		}
+		attended[uid][date] = true
+	}
+
+	out := &RegularsResult{
+		SessionID: sessionID,
+		Since:     since.Format("2006-01-02"),
+		Instances: len(instances),
+		Regulars:  []Regular{},
+	}
+	if s.sessions != nil {
+		if notes, err := s.sessions.StaffNotesOf(ctx, dojoID, sessionID); err == nil {
+			out.StaffNotes = notes
+		} else {
+			log.Printf("attendance: failed to load staff notes of %s/%s: %v", dojoID, sessionID, err)
+		}
+	}
+	for date := range instances {
+		if date > out.LatestInstance {
+			out.LatestInstance = date
+		}
+	}
+	if out.Instances == 0 {
+		return out, nil
+	}
+
+	for uid, dates := range attended {
+		rate := float64(len(dates)) / float64(out.Instances)
+		if rate < in.MinRate {
+			continue
+		}
+		reg := Regular{
+			MemberUID:  uid,
+			Attended:   len(dates),
+			Rate:       rate,
+			MissedLast: !dates[out.LatestInstance],
+		}
+		for date := range dates {
+			if date > reg.LastAttended {
+				reg.LastAttended = date
+			}
+		}
+		out.Regulars = append(out.Regulars, reg)
+	}
+
+	sort.Slice(out.Regulars, func(i, j int) bool {
+		if out.Regulars[i].Attended != out.Regulars[j].Attended {
+			return out.Regulars[i].Attended > out.Regulars[j].Attended
+		}
+		return out.Regulars[i].LastAttended > out.Regulars[j].LastAttended
+	})
+	if len(out.Regulars) > in.Limit {
+		out.Regulars = out.Regulars[:in.Limit]
+	}
+
+	s.fillDisplayNames(ctx, dojoID, out.Regulars)
+	return out, nil
+}
+
+// fillDisplayNames takes displayName from the member docs, which carry a
+// copy of the user's, falling back to users/{uid} for member docs that
+// predate the copy (best effort)
+func (s *Service) fillDisplayNames(ctx context.Context, dojoID string, list []Regular) {
+	if len(list) == 0 {
+		return
+	}
+	members := s.repo.client.Collection("dojos").Doc(dojoID).Collection("members")
+	refs := make([]*firestore.DocumentRef, 0, len(list))
+	for _, r := range list {
+		refs = append(refs, members.Doc(r.MemberUID))
+	}
+	snaps, err := s.repo.client.GetAll(ctx, refs)
+	if err != nil {
+		return
+	}
+
+	users := s.repo.client.Collection("users")
+	var missing []int
+	refs = refs[:0]
+	for i, snap := range snaps {
+		if snap.Exists() {
+			if name, ok := snap.Data()["displayName"].(string); ok && name != "" {
+				list[i].DisplayName = name
+				continue
+			}
+		}
+		missing = append(missing, i)
+		refs = append(refs, users.Doc(list[i].MemberUID))
+	}
+	if len(refs) == 0 {
+		return
+	}
+	snaps, err = s.repo.client.GetAll(ctx, refs)
+	if err != nil {
+		return
+	}
+	for j, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		if name, ok := snap.Data()["displayName"].(string); ok {
+			list[missing[j]].DisplayName = name
+		}
+	}
+}
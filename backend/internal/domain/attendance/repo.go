@@ -3,27 +3,77 @@ package attendance
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/firebase"
 )
 
 type Repo struct {
-	client *firestore.Client
+	client   *firestore.Client
+	resolver firebase.ClientResolver // per-dojo database (data residency), optional
 }
 
 func NewRepo(client *firestore.Client) *Repo {
 	return &Repo{client: client}
 }
 
-func (r *Repo) attendanceCol(dojoID string) *firestore.CollectionRef {
-	return r.client.Collection("dojos").Doc(dojoID).Collection("attendance")
+// SetClientResolver routes each dojo's attendance to its own database
+func (r *Repo) SetClientResolver(resolver firebase.ClientResolver) {
+	r.resolver = resolver
+}
+
+// db returns the client of the database that holds the dojo's data
+func (r *Repo) db(ctx context.Context, dojoID string) (*firestore.Client, error) {
+	if r.resolver == nil {
+		return r.client, nil
+	}
+	c, err := r.resolver.ClientFor(ctx, dojoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dojo database: %w", err)
+	}
+	return c, nil
+}
+
+// memberDocs reads the member docs of uids in one round trip, missing ones
+// included. Member docs stay in the default database, not the dojo's.
+func (r *Repo) memberDocs(ctx context.Context, dojoID string, uids []string) (map[string]*firestore.DocumentSnapshot, error) {
+	out := make(map[string]*firestore.DocumentSnapshot, len(uids))
+	if len(uids) == 0 {
+		return out, nil
+	}
+	members := r.client.Collection("dojos").Doc(dojoID).Collection("members")
+	refs := make([]*firestore.DocumentRef, len(uids))
+	for i, uid := range uids {
+		refs[i] = members.Doc(uid)
+	}
+	snaps, err := r.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load members: %w", err)
+	}
+	for i, snap := range snaps {
+		out[uids[i]] = snap
+	}
+	return out, nil
+}
+
+func (r *Repo) attendanceCol(ctx context.Context, dojoID string) (*firestore.CollectionRef, error) {
+	db, err := r.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return db.Collection("dojos").Doc(dojoID).Collection("attendance"), nil
 }
 
 // Create creates a new attendance record
 func (r *Repo) Create(ctx context.Context, dojoID string, att Attendance) (*Attendance, error) {
-	col := r.attendanceCol(dojoID)
+	col, err := r.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
 	ref, _, err := col.Add(ctx, map[string]interface{}{
 		"dojoId":            att.DojoID,
 		"sessionInstanceId": att.SessionInstanceID,
@@ -44,7 +94,11 @@ func (r *Repo) Create(ctx context.Context, dojoID string, att Attendance) (*Atte
 
 // Get retrieves an attendance record by ID
 func (r *Repo) Get(ctx context.Context, dojoID, attendanceID string) (*Attendance, error) {
-	doc, err := r.attendanceCol(dojoID).Doc(attendanceID).Get(ctx)
+	col, err := r.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := col.Doc(attendanceID).Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: attendance not found", ErrNotFound)
 	}
@@ -57,20 +111,83 @@ func (r *Repo) Get(ctx context.Context, dojoID, attendanceID string) (*Attendanc
 	return &att, nil
 }
 
-// Update updates an attendance record
-func (r *Repo) Update(ctx context.Context, dojoID, attendanceID string, updates map[string]interface{}) (*Attendance, error) {
-	ref := r.attendanceCol(dojoID).Doc(attendanceID)
-	_, err := ref.Set(ctx, updates, firestore.MergeAll)
+// Update updates an attendance record. When the update changes the status
+// or notes, rev is filled in with the previous values and written to the
+// record's revisions in the same transaction.
+func (r *Repo) Update(ctx context.Context, dojoID, attendanceID string, updates map[string]interface{}, rev Revision) (*Attendance, error) {
+	db, err := r.db(ctx, dojoID)
 	if err != nil {
+		return nil, err
+	}
+	ref := db.Collection("dojos").Doc(dojoID).Collection("attendance").Doc(attendanceID)
+	err = db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to load attendance: %w", err)
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: attendance not found", ErrNotFound)
+		}
+		data := doc.Data()
+		prevStatus, _ := data["status"].(string)
+		prevNotes, _ := data["notes"].(string)
+
+		if err := tx.Set(ref, updates, firestore.MergeAll); err != nil {
+			return err
+		}
+		status, notes := prevStatus, prevNotes
+		if v, ok := updates["status"].(string); ok {
+			status = v
+		}
+		if v, ok := updates["notes"].(string); ok {
+			notes = v
+		}
+		if status == prevStatus && notes == prevNotes {
+			return nil
+		}
+		rev.PreviousStatus, rev.Status = AttendanceStatus(prevStatus), AttendanceStatus(status)
+		rev.PreviousNotes, rev.Notes = prevNotes, notes
+		return tx.Create(ref.Collection("revisions").NewDoc(), rev)
+	})
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to update attendance: %w", err)
 	}
 
 	return r.Get(ctx, dojoID, attendanceID)
 }
 
+// ListRevisions returns the revisions of a record, newest first
+func (r *Repo) ListRevisions(ctx context.Context, dojoID, attendanceID string) ([]Revision, error) {
+	col, err := r.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := col.Doc(attendanceID).Collection("revisions").OrderBy("changedAt", firestore.Desc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	out := make([]Revision, 0, len(docs))
+	for _, doc := range docs {
+		var rev Revision
+		if err := doc.DataTo(&rev); err != nil {
+			continue
+		}
+		rev.ID = doc.Ref.ID
+		out = append(out, rev)
+	}
+	return out, nil
+}
+
 // FindExisting finds an existing attendance record for a member in a session instance
 func (r *Repo) FindExisting(ctx context.Context, dojoID, sessionInstanceID, memberUID string) (*Attendance, error) {
-	iter := r.attendanceCol(dojoID).
+	col, err := r.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	iter := col.
 		Where("sessionInstanceId", "==", sessionInstanceID).
 		Where("memberUid", "==", memberUID).
 		Limit(1).
@@ -92,9 +209,30 @@ func (r *Repo) FindExisting(ctx context.Context, dojoID, sessionInstanceID, memb
 	return &att, nil
 }
 
+// CountCheckins counts the present and late records of a session instance
+func (r *Repo) CountCheckins(ctx context.Context, dojoID, sessionInstanceID string) (int, error) {
+	col, err := r.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return 0, err
+	}
+	docs, err := col.
+		Where("sessionInstanceId", "==", sessionInstanceID).
+		Where("status", "in", []string{string(StatusPresent), string(StatusLate)}).
+		Select().
+		Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count check-ins: %w", err)
+	}
+	return len(docs), nil
+}
+
 // List lists attendance records
 func (r *Repo) List(ctx context.Context, dojoID string, input ListAttendanceInput) ([]Attendance, error) {
-	query := r.attendanceCol(dojoID).Query
+	col, err := r.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	query := col.Query
 
 	if input.SessionInstanceID != "" {
 		query = query.Where("sessionInstanceId", "==", input.SessionInstanceID)
@@ -102,8 +240,25 @@ func (r *Repo) List(ctx context.Context, dojoID string, input ListAttendanceInpu
 	if input.MemberUID != "" {
 		query = query.Where("memberUid", "==", input.MemberUID)
 	}
+	switch len(input.Statuses) {
+	case 0:
+	case 1:
+		query = query.Where("status", "==", input.Statuses[0])
+	default:
+		query = query.Where("status", "in", input.Statuses)
+	}
+	if !input.start.IsZero() {
+		query = query.Where("createdAt", ">=", input.start)
+	}
+	if !input.end.IsZero() {
+		query = query.Where("createdAt", "<", input.end)
+	}
 
-	query = query.OrderBy("createdAt", firestore.Desc)
+	dir := firestore.Desc
+	if input.Sort == SortAsc {
+		dir = firestore.Asc
+	}
+	query = query.OrderBy("createdAt", dir)
 
 	limit := input.Limit
 	if limit <= 0 || limit > 500 {
@@ -134,46 +289,107 @@ func (r *Repo) List(ctx context.Context, dojoID string, input ListAttendanceInpu
 	return records, nil
 }
 
-// BulkUpsert performs bulk upsert for attendance records
-func (r *Repo) BulkUpsert(ctx context.Context, dojoID, sessionInstanceID, recordedBy string, records []BulkAttendanceRecord) ([]map[string]interface{}, error) {
-	batch := r.client.Batch()
+// existingRecord is the part of a record a roll call compares against
+type existingRecord struct {
+	id     string
+	status string
+	notes  string
+}
+
+// existingByMember loads every record of a session instance in one query,
+// keyed by memberUid. If a member somehow has several, the first one wins,
+// matching FindExisting.
+func existingByMember(ctx context.Context, col *firestore.CollectionRef, sessionInstanceID string) (map[string]existingRecord, error) {
+	docs, err := col.Where("sessionInstanceId", "==", sessionInstanceID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load existing attendance: %w", err)
+	}
+	out := make(map[string]existingRecord, len(docs))
+	for _, doc := range docs {
+		data := doc.Data()
+		uid, _ := data["memberUid"].(string)
+		if uid == "" {
+			continue
+		}
+		if _, seen := out[uid]; !seen {
+			rec := existingRecord{id: doc.Ref.ID}
+			rec.status, _ = data["status"].(string)
+			rec.notes, _ = data["notes"].(string)
+			out[uid] = rec
+		}
+	}
+	return out, nil
+}
+
+// BulkUpsert performs bulk upsert for attendance records. Existing records
+// are read with a single query and all writes go through a BulkWriter, so a
+// roll call costs one read round trip regardless of class size. When a member
+// appears more than once in records, the last entry wins. Records whose
+// status or notes change get a revision carrying reason.
+func (r *Repo) BulkUpsert(ctx context.Context, dojoID, sessionInstanceID, recordedBy, reason string, records []BulkAttendanceRecord) ([]map[string]interface{}, error) {
+	db, err := r.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	col := db.Collection("dojos").Doc(dojoID).Collection("attendance")
+
+	existing, err := existingByMember(ctx, col, sessionInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a BulkWriter rejects two writes to the same document
+	last := make(map[string]int, len(records))
+	for i, record := range records {
+		last[record.MemberUID] = i
+	}
+
+	bw := db.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(records))
+	var revJobs []*firestore.BulkWriterJob
 	results := make([]map[string]interface{}, 0, len(records))
 	now := time.Now().UTC()
 
-	for _, record := range records {
-		if record.MemberUID == "" || !IsValidStatus(record.Status) {
+	for i, record := range records {
+		if record.MemberUID == "" || !IsValidStatus(record.Status) || last[record.MemberUID] != i {
 			continue
 		}
 
-		// Check for existing record
-		existing, _ := r.FindExisting(ctx, dojoID, sessionInstanceID, record.MemberUID)
-
 		notes := record.Notes
 		if len(notes) > 500 {
 			notes = notes[:500]
 		}
 
-		if existing != nil {
-			// Update existing
-			ref := r.attendanceCol(dojoID).Doc(existing.ID)
-			batch.Set(ref, map[string]interface{}{
+		var job *firestore.BulkWriterJob
+		action := "created"
+		if prev, ok := existing[record.MemberUID]; ok {
+			job, err = bw.Set(col.Doc(prev.id), map[string]interface{}{
 				"status":     record.Status,
 				"notes":      notes,
 				"updatedAt":  now,
 				"recordedBy": recordedBy,
 			}, firestore.MergeAll)
-			results = append(results, map[string]interface{}{
-				"memberUid": record.MemberUID,
-				"action":    "updated",
-			})
+			action = "updated"
+			if err == nil && (prev.status != record.Status || prev.notes != notes) {
+				var revJob *firestore.BulkWriterJob
+				revJob, err = bw.Create(col.Doc(prev.id).Collection("revisions").NewDoc(), Revision{
+					PreviousStatus: AttendanceStatus(prev.status),
+					Status:         AttendanceStatus(record.Status),
+					PreviousNotes:  prev.notes,
+					Notes:          notes,
+					ChangedBy:      recordedBy,
+					ChangedAt:      now,
+					Reason:         reason,
+					Source:         SourceBulk,
+				})
+				revJobs = append(revJobs, revJob)
+			}
 		} else {
-			// Create new
-			ref := r.attendanceCol(dojoID).NewDoc()
 			var checkInTime *time.Time
 			if record.Status == "present" || record.Status == "late" {
 				checkInTime = &now
 			}
-			batch.Set(ref, map[string]interface{}{
+			job, err = bw.Create(col.NewDoc(), map[string]interface{}{
 				"dojoId":            dojoID,
 				"sessionInstanceId": sessionInstanceID,
 				"memberUid":         record.MemberUID,
@@ -184,15 +400,30 @@ func (r *Repo) BulkUpsert(ctx context.Context, dojoID, sessionInstanceID, record
 				"createdAt":         now,
 				"updatedAt":         now,
 			})
-			results = append(results, map[string]interface{}{
-				"memberUid": record.MemberUID,
-				"action":    "created",
-			})
 		}
+		if err != nil {
+			bw.End()
+			return nil, fmt.Errorf("bulk write failed: %w", err)
+		}
+		jobs = append(jobs, job)
+		results = append(results, map[string]interface{}{
+			"memberUid": record.MemberUID,
+			"action":    action,
+		})
 	}
 
-	if _, err := batch.Commit(ctx); err != nil {
-		return nil, fmt.Errorf("batch commit failed: %w", err)
+	bw.End()
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			results[i]["action"] = "failed"
+			results[i]["error"] = err.Error()
+		}
+	}
+	// the roll call stands even if a revision is lost; the log keeps the gap visible
+	for _, job := range revJobs {
+		if _, err := job.Results(); err != nil {
+			log.Printf("attendance: dojo %s: revision of roll call %s failed: %v", dojoID, sessionInstanceID, err)
+		}
 	}
 
 	return results, nil
@@ -3,27 +3,103 @@ package attendance
 import (
 	"context"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
 	"time"
 
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/blob"
 	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/packages"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/events"
+	"dojo-manager/backend/internal/instanceid"
 )
 
 type Service struct {
 	repo     *Repo
 	dojoRepo *dojo.Repo
+	credits  *packages.Service // punch-card credits (optional)
+	sessions *session.Service  // schedule check of instance ids (optional)
+	bus      *events.Bus       // attendance events (optional)
+	archive  blob.Store        // exported records of archived attendance (optional)
 }
 
 func NewService(repo *Repo, dojoRepo *dojo.Repo) *Service {
 	return &Service{repo: repo, dojoRepo: dojoRepo}
 }
 
+// SetPackagesService enables class credit deduction on check-in
+func (s *Service) SetPackagesService(credits *packages.Service) {
+	s.credits = credits
+}
+
+// SetSessionService enables checking instance ids against the timetable
+func (s *Service) SetSessionService(sessions *session.Service) {
+	s.sessions = sessions
+}
+
+// SetEventBus publishes the attendance events, which metering, chat
+// announcements, the stats cache and guardian pushes react to
+func (s *Service) SetEventBus(bus *events.Bus) {
+	s.bus = bus
+}
+
+// checkInstance keeps malformed instance ids out of attendance, since
+// retention and stats read the class date from them. force skips the
+// timetable lookup for corrections but still needs a dated id.
+func (s *Service) checkInstance(ctx context.Context, dojoID, instanceID string, force bool) error {
+	if force || s.sessions == nil {
+		if instanceid.Date(instanceID) == "" {
+			return fmt.Errorf("%w: sessionInstanceId must start with a YYYY-MM-DD date", ErrBadRequest)
+		}
+		return nil
+	}
+	err := s.sessions.CheckInstance(ctx, dojoID, instanceID)
+	switch {
+	case err == nil:
+		return nil
+	case session.IsErrNotFound(err):
+		return fmt.Errorf("%w: sessionInstanceId does not match a class of this dojo (set force to record anyway)", ErrBadRequest)
+	case session.IsErrBadRequest(err):
+		return fmt.Errorf("%w: %s (set force to record anyway)", ErrBadRequest, strings.TrimPrefix(err.Error(), session.ErrBadRequest.Error()+": "))
+	default:
+		return err
+	}
+}
+
+// settleCredits takes a credit for a check-in or gives it back when the
+// status moves away from one. Members not on a package are unaffected. The
+// Settlement is for revertCredits should the record not be written.
+func (s *Service) settleCredits(ctx context.Context, staffUID, dojoID, instanceID, memberUID, status string, override bool) (*packages.Settlement, error) {
+	if s.credits == nil {
+		return nil, nil
+	}
+	line := packages.CheckinCredit{MemberUID: memberUID, CheckIn: isCheckin(status)}
+	settled, err := s.credits.SettleCheckins(ctx, staffUID, dojoID, instanceID, []packages.CheckinCredit{line}, override)
+	if err != nil {
+		return nil, err
+	}
+	if settled.Blocked[memberUID] {
+		return nil, fmt.Errorf("%w: member has no class credits left", packages.ErrNoCredits)
+	}
+	return settled, nil
+}
+
+func isCheckin(status string) bool {
+	return status == string(StatusPresent) || status == string(StatusLate)
+}
+
 // Record creates or updates an attendance record
 func (s *Service) Record(ctx context.Context, staffUID string, input RecordAttendanceInput) (*Attendance, error) {
 	input.Trim()
 
 	// Validate input
-	if input.DojoID == "" || input.SessionInstanceID == "" || input.MemberUID == "" || input.Status == "" {
-		return nil, fmt.Errorf("%w: dojoId, sessionInstanceId, memberUid, status are required", ErrBadRequest)
+	if input.DojoID == "" || input.SessionInstanceID == "" || input.Status == "" ||
+		!hasMemberKey(input.MemberUID, input.MemberEmail, input.MemberNumber) {
+		return nil, fmt.Errorf("%w: dojoId, sessionInstanceId, memberUid (or memberEmail / memberNumber), status are required", ErrBadRequest)
 	}
 
 	if !IsValidStatus(input.Status) {
@@ -38,9 +114,54 @@ func (s *Service) Record(ctx context.Context, staffUID string, input RecordAtten
 	if !isStaff {
 		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
 	}
+	if err := s.resolveRecordMember(ctx, &input); err != nil {
+		return nil, err
+	}
+	return s.record(ctx, staffUID, input)
+}
+
+// RecordCheckin marks a member present on behalf of a caller the dojo
+// already trusts, such as a registered kiosk scanning a member badge.
+// recordedBy names that caller (e.g. "device:{deviceId}"). With no staff
+// member deciding, the class's eligibility rules apply.
+func (s *Service) RecordCheckin(ctx context.Context, recordedBy, dojoID, instanceID, memberUID string) (*Attendance, error) {
+	input := RecordAttendanceInput{
+		DojoID:            dojoID,
+		SessionInstanceID: instanceID,
+		MemberUID:         memberUID,
+		Status:            string(StatusPresent),
+	}
+	input.Trim()
+	if input.DojoID == "" || input.SessionInstanceID == "" || input.MemberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId, sessionInstanceId, memberUid are required", ErrBadRequest)
+	}
+	input.checkEligibility = true
+	return s.record(ctx, recordedBy, input)
+}
+
+// record writes a validated attendance record
+func (s *Service) record(ctx context.Context, staffUID string, input RecordAttendanceInput) (*Attendance, error) {
+	if err := s.checkInstance(ctx, input.DojoID, input.SessionInstanceID, input.Force); err != nil {
+		return nil, err
+	}
+	if input.checkEligibility && s.sessions != nil {
+		if err := s.sessions.CheckEligibility(ctx, input.DojoID, input.SessionInstanceID, input.MemberUID); err != nil {
+			return nil, err
+		}
+	}
+	if isCheckin(input.Status) {
+		if err := s.checkSuspension(ctx, input.DojoID, input.SessionInstanceID, input.MemberUID); err != nil {
+			return nil, err
+		}
+	}
 
 	now := time.Now().UTC()
 
+	settled, err := s.settleCredits(ctx, staffUID, input.DojoID, input.SessionInstanceID, input.MemberUID, input.Status, input.OverrideCredits)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check for existing record
 	existing, _ := s.repo.FindExisting(ctx, input.DojoID, input.SessionInstanceID, input.MemberUID)
 
@@ -52,7 +173,18 @@ func (s *Service) Record(ctx context.Context, staffUID string, input RecordAtten
 			"updatedAt":  now,
 			"recordedBy": staffUID,
 		}
-		return s.repo.Update(ctx, input.DojoID, existing.ID, updates)
+		out, err := s.repo.Update(ctx, input.DojoID, existing.ID, updates, Revision{
+			ChangedBy: staffUID,
+			ChangedAt: now,
+			Reason:    input.Reason,
+			Source:    SourceRecord,
+		})
+		if err != nil {
+			s.revertCredits(ctx, staffUID, input.DojoID, input.SessionInstanceID, settled, nil)
+			return nil, err
+		}
+		s.publishRecorded(ctx, staffUID, input, false)
+		return out, nil
 	}
 
 	// Create new record
@@ -73,7 +205,32 @@ func (s *Service) Record(ctx context.Context, staffUID string, input RecordAtten
 		UpdatedAt:         now,
 	}
 
-	return s.repo.Create(ctx, input.DojoID, att)
+	out, err := s.repo.Create(ctx, input.DojoID, att)
+	if err != nil {
+		s.revertCredits(ctx, staffUID, input.DojoID, input.SessionInstanceID, settled, nil)
+		return nil, err
+	}
+	s.publishRecorded(ctx, staffUID, input, true)
+	return out, nil
+}
+
+func (s *Service) publishRecorded(ctx context.Context, staffUID string, input RecordAttendanceInput, created bool) {
+	s.bus.Publish(ctx, events.AttendanceRecorded{
+		DojoID:            input.DojoID,
+		SessionInstanceID: input.SessionInstanceID,
+		MemberUID:         input.MemberUID,
+		Status:            input.Status,
+		RecordedBy:        staffUID,
+		Created:           created,
+	})
+}
+
+// CountCheckins counts the members present or late in a class instance
+func (s *Service) CountCheckins(ctx context.Context, dojoID, instanceID string) (int, error) {
+	if dojoID == "" || instanceID == "" {
+		return 0, fmt.Errorf("%w: dojoId and sessionInstanceId are required", ErrBadRequest)
+	}
+	return s.repo.CountCheckins(ctx, dojoID, instanceID)
 }
 
 // Update updates an attendance record
@@ -94,20 +251,26 @@ func (s *Service) Update(ctx context.Context, staffUID string, input UpdateAtten
 	}
 
 	// Check if record exists
-	_, err = s.repo.Get(ctx, input.DojoID, input.ID)
+	existing, err := s.repo.Get(ctx, input.DojoID, input.ID)
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now().UTC()
 	updates := map[string]interface{}{
-		"updatedAt":  time.Now().UTC(),
+		"updatedAt":  now,
 		"recordedBy": staffUID,
 	}
 
+	var settled *packages.Settlement
 	if input.Status != nil {
 		if !IsValidStatus(*input.Status) {
 			return nil, fmt.Errorf("%w: status must be one of: present, absent, late, excused", ErrBadRequest)
 		}
+		settled, err = s.settleCredits(ctx, staffUID, input.DojoID, existing.SessionInstanceID, existing.MemberUID, *input.Status, input.OverrideCredits)
+		if err != nil {
+			return nil, err
+		}
 		updates["status"] = *input.Status
 	}
 
@@ -115,7 +278,43 @@ func (s *Service) Update(ctx context.Context, staffUID string, input UpdateAtten
 		updates["notes"] = *input.Notes
 	}
 
-	return s.repo.Update(ctx, input.DojoID, input.ID, updates)
+	out, err := s.repo.Update(ctx, input.DojoID, input.ID, updates, Revision{
+		ChangedBy: staffUID,
+		ChangedAt: now,
+		Reason:    input.Reason,
+		Source:    SourceUpdate,
+	})
+	if err != nil {
+		s.revertCredits(ctx, staffUID, input.DojoID, existing.SessionInstanceID, settled, nil)
+		return nil, err
+	}
+	s.bus.Publish(ctx, events.AttendanceCorrected{DojoID: input.DojoID, AttendanceID: input.ID, ChangedBy: staffUID})
+	return out, nil
+}
+
+// History returns a record with its revisions, newest first, so disputed
+// check-ins can be reviewed (staff)
+func (s *Service) History(ctx context.Context, staffUID, dojoID, attendanceID string) (*History, error) {
+	if dojoID == "" || attendanceID == "" {
+		return nil, fmt.Errorf("%w: dojoId and id are required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+
+	att, err := s.repo.Get(ctx, dojoID, attendanceID)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := s.repo.ListRevisions(ctx, dojoID, attendanceID)
+	if err != nil {
+		return nil, err
+	}
+	return &History{Attendance: att, Revisions: revisions}, nil
 }
 
 // List lists attendance records
@@ -123,15 +322,79 @@ func (s *Service) List(ctx context.Context, input ListAttendanceInput) ([]Attend
 	if input.DojoID == "" {
 		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
 	}
+	input.Trim()
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
 
 	return s.repo.List(ctx, input.DojoID, input)
 }
 
+// sheetMembers lists the members a roll call names, once each
+func sheetMembers(records []BulkAttendanceRecord) []string {
+	seen := make(map[string]bool, len(records))
+	uids := make([]string, 0, len(records))
+	for _, rec := range records {
+		if rec.MemberUID != "" && !seen[rec.MemberUID] {
+			seen[rec.MemberUID] = true
+			uids = append(uids, rec.MemberUID)
+		}
+	}
+	return uids
+}
+
+// settleSheetCredits settles the credits of a roll call in one go. Members
+// whose doc shows they are not on credits are skipped without a
+// transaction. nil when there was nothing to settle.
+func (s *Service) settleSheetCredits(ctx context.Context, staffUID string, input BulkAttendanceInput, records []BulkAttendanceRecord, memberDocs map[string]*firestore.DocumentSnapshot) (*packages.Settlement, error) {
+	if s.credits == nil {
+		return nil, nil
+	}
+	var lines []packages.CheckinCredit
+	for _, rec := range records {
+		if rec.MemberUID == "" || !IsValidStatus(rec.Status) || !packages.OnCredits(memberDocs[rec.MemberUID]) {
+			continue
+		}
+		lines = append(lines, packages.CheckinCredit{MemberUID: rec.MemberUID, CheckIn: isCheckin(rec.Status)})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	settled, err := s.credits.SettleCheckins(ctx, staffUID, input.DojoID, input.SessionInstanceID, lines, input.OverrideCredits)
+	if err != nil {
+		// chunks committed before the failure are undone
+		s.revertCredits(ctx, staffUID, input.DojoID, input.SessionInstanceID, settled, nil)
+		return nil, err
+	}
+	return settled, nil
+}
+
+// revertCredits undoes settled for the members in uids (everyone settled
+// if nil), whose attendance was not written. Best effort: a failure is
+// logged, and the member's ledger shows the mismatch.
+func (s *Service) revertCredits(ctx context.Context, staffUID, dojoID, instanceID string, settled *packages.Settlement, uids map[string]bool) {
+	if settled == nil {
+		return
+	}
+	if uids == nil {
+		uids = map[string]bool{}
+		for _, uid := range append(slices.Clone(settled.Consumed), settled.Refunded...) {
+			uids[uid] = true
+		}
+	}
+	if err := s.credits.RevertCheckins(ctx, staffUID, dojoID, instanceID, settled, uids); err != nil {
+		log.Printf("attendance: dojo %s: reverting credits of %s failed: %v", dojoID, instanceID, err)
+	}
+}
+
 // BulkRecord performs bulk attendance recording
 func (s *Service) BulkRecord(ctx context.Context, staffUID string, input BulkAttendanceInput) ([]map[string]interface{}, error) {
 	if input.DojoID == "" || input.SessionInstanceID == "" || len(input.Records) == 0 {
 		return nil, fmt.Errorf("%w: dojoId, sessionInstanceId, records[] are required", ErrBadRequest)
 	}
+	if len(input.Records) > MaxBulkRecords {
+		return nil, fmt.Errorf("%w: at most %d records per request", ErrTooLarge, MaxBulkRecords)
+	}
 
 	// Check if user is staff of the dojo
 	isStaff, err := s.dojoRepo.IsStaff(ctx, input.DojoID, staffUID)
@@ -141,6 +404,113 @@ func (s *Service) BulkRecord(ctx context.Context, staffUID string, input BulkAtt
 	if !isStaff {
 		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
 	}
+	if err := s.checkInstance(ctx, input.DojoID, input.SessionInstanceID, input.Force); err != nil {
+		return nil, err
+	}
+
+	// suspended members, members out of credits unless staff override, and
+	// emails or member numbers matching no member are left off the sheet
+	records := make([]BulkAttendanceRecord, 0, len(input.Records))
+	blocked := []map[string]interface{}{}
+	input.Records = slices.Clone(input.Records)
+	if err := s.resolveBulkMembers(ctx, input.DojoID, input.Records); err != nil {
+		return nil, err
+	}
+	memberDocs, err := s.repo.memberDocs(ctx, input.DojoID, sheetMembers(input.Records))
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range input.Records {
+		if rec.MemberUID == "" && hasMemberKey("", rec.MemberEmail, rec.MemberNumber) {
+			miss := map[string]interface{}{"action": "blocked", "reason": "member_not_found"}
+			if rec.MemberNumber != 0 {
+				miss["memberNumber"] = rec.MemberNumber
+			} else {
+				miss["memberEmail"] = rec.MemberEmail
+			}
+			blocked = append(blocked, miss)
+			continue
+		}
+		if rec.MemberUID != "" && isCheckin(rec.Status) {
+			if err := checkSuspended(memberDocs[rec.MemberUID], input.SessionInstanceID); err != nil {
+				if !IsErrSuspended(err) {
+					return nil, err
+				}
+				blocked = append(blocked, map[string]interface{}{
+					"memberUid": rec.MemberUID,
+					"action":    "blocked",
+					"reason":    "suspended",
+				})
+				continue
+			}
+		}
+		records = append(records, rec)
+	}
+
+	// credits are settled for the whole sheet before it is written, and
+	// given back for whatever the write then fails on
+	settled, err := s.settleSheetCredits(ctx, staffUID, input, records, memberDocs)
+	if err != nil {
+		return nil, err
+	}
+	if settled != nil && len(settled.Blocked) > 0 {
+		kept := make([]BulkAttendanceRecord, 0, len(records))
+		for _, rec := range records {
+			if settled.Blocked[rec.MemberUID] {
+				blocked = append(blocked, map[string]interface{}{
+					"memberUid": rec.MemberUID,
+					"action":    "blocked",
+					"reason":    "no_credits",
+				})
+				continue
+			}
+			kept = append(kept, rec)
+		}
+		records = kept
+	}
+
+	results, err := s.repo.BulkUpsert(ctx, input.DojoID, input.SessionInstanceID, staffUID, trimReason(input.Reason), records)
+	if err != nil {
+		s.revertCredits(ctx, staffUID, input.DojoID, input.SessionInstanceID, settled, nil)
+		return nil, err
+	}
+	failed := map[string]bool{}
+	for _, res := range results {
+		if res["action"] == "failed" {
+			uid, _ := res["memberUid"].(string)
+			failed[uid] = true
+		}
+	}
+	if len(failed) > 0 {
+		s.revertCredits(ctx, staffUID, input.DojoID, input.SessionInstanceID, settled, failed)
+	}
+
+	// only count newly created check-ins so re-submitted sheets aren't double-metered
+	created := make(map[string]bool, len(results))
+	for _, res := range results {
+		if res["action"] == "created" {
+			uid, _ := res["memberUid"].(string)
+			created[uid] = true
+		}
+	}
+	sheet := events.AttendanceSheetRecorded{
+		DojoID:            input.DojoID,
+		SessionInstanceID: input.SessionInstanceID,
+		RecordedBy:        staffUID,
+	}
+	// walk backwards: for a member listed twice, the last entry is the one written
+	for i := len(input.Records) - 1; i >= 0; i-- {
+		rec := input.Records[i]
+		if isCheckin(rec.Status) {
+			sheet.HasCheckins = true
+			if created[rec.MemberUID] {
+				sheet.NewCheckins++
+				sheet.CheckedIn = append(sheet.CheckedIn, rec.MemberUID)
+			}
+		}
+		delete(created, rec.MemberUID)
+	}
+	s.bus.Publish(ctx, sheet)
 
-	return s.repo.BulkUpsert(ctx, input.DojoID, input.SessionInstanceID, staffUID, input.Records)
+	return append(results, blocked...), nil
 }
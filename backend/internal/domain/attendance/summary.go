@@ -0,0 +1,157 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// CheckinsByInstance counts check-ins (present / late) per session instance
+// for attendance recorded since the given time.
+func (s *Service) CheckinsByInstance(ctx context.Context, dojoID string, since time.Time) (map[string]int, error) {
+	return s.countCheckins(ctx, dojoID, since, time.Time{}, "sessionInstanceId")
+}
+
+// CheckinsByMember counts check-ins (present / late) per member for
+// attendance recorded since the given time.
+func (s *Service) CheckinsByMember(ctx context.Context, dojoID string, since time.Time) (map[string]int, error) {
+	return s.countCheckins(ctx, dojoID, since, time.Time{}, "memberUid")
+}
+
+// CheckinsByMemberBetween counts check-ins (present / late) per member for
+// attendance recorded in [from, to).
+func (s *Service) CheckinsByMemberBetween(ctx context.Context, dojoID string, from, to time.Time) (map[string]int, error) {
+	return s.countCheckins(ctx, dojoID, from, to, "memberUid")
+}
+
+// countCheckins counts check-ins recorded since the given time, and before
+// until unless it is zero, grouped by a string field
+func (s *Service) countCheckins(ctx context.Context, dojoID string, since, until time.Time, groupBy string) (map[string]int, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+
+	col, err := s.repo.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	q := col.Where("createdAt", ">=", since)
+	if !until.IsZero() {
+		q = q.Where("createdAt", "<", until)
+	}
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	out := map[string]int{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attendance: %w", err)
+		}
+
+		data := doc.Data()
+		status, _ := data["status"].(string)
+		key, _ := data[groupBy].(string)
+		if key == "" || !isCheckin(status) {
+			continue
+		}
+		out[key]++
+	}
+	return out, nil
+}
+
+// MemberCheckins returns a member's check-ins (present / late), oldest first
+func (s *Service) MemberCheckins(ctx context.Context, dojoID, memberUID string) ([]Attendance, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+
+	col, err := s.repo.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	// ordered in memory: memberUid + createdAt would need a composite index
+	iter := col.Where("memberUid", "==", memberUID).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Attendance{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list attendance: %w", err)
+		}
+
+		var att Attendance
+		if err := doc.DataTo(&att); err != nil {
+			continue
+		}
+		if !isCheckin(string(att.Status)) {
+			continue
+		}
+		att.ID = doc.Ref.ID
+		out = append(out, att)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+// AttendeesOfSessions returns the members who checked in to any instance of
+// the given classes since the given time
+func (s *Service) AttendeesOfSessions(ctx context.Context, dojoID string, sessionIDs []string, since time.Time) (map[string]bool, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	out := map[string]bool{}
+	if len(sessionIDs) == 0 {
+		return out, nil
+	}
+	wanted := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		wanted[id] = true
+	}
+
+	col, err := s.repo.attendanceCol(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	iter := col.Where("createdAt", ">=", since).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attendance: %w", err)
+		}
+
+		data := doc.Data()
+		instanceID, _ := data["sessionInstanceId"].(string)
+		status, _ := data["status"].(string)
+		uid, _ := data["memberUid"].(string)
+		_, sessionID, ok := instanceid.Parse(instanceID)
+		if !ok || uid == "" || !wanted[sessionID] || !isCheckin(status) {
+			continue
+		}
+		out[uid] = true
+	}
+	return out, nil
+}
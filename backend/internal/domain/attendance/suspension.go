@@ -0,0 +1,52 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// checkSuspension refuses to check in a member suspended on the instance's
+// date (today for instance ids without one). Staff cannot override it; they
+// lift the suspension instead.
+func (s *Service) checkSuspension(ctx context.Context, dojoID, instanceID, memberUID string) error {
+	doc, err := s.repo.memberDoc(ctx, dojoID, memberUID)
+	if err != nil {
+		return err
+	}
+	return checkSuspended(doc, instanceID)
+}
+
+// checkSuspended is checkSuspension on a member doc already read, e.g. by
+// memberDocs for a roll call. A missing doc is not suspended.
+func checkSuspended(doc *firestore.DocumentSnapshot, instanceID string) error {
+	if doc == nil || !doc.Exists() {
+		return nil
+	}
+	var m fsdoc.Member
+	if err := fsdoc.Decode(doc, &m); err != nil {
+		return fmt.Errorf("failed to parse member: %w", err)
+	}
+	dateKey := instanceid.Date(instanceID)
+	if dateKey == "" {
+		dateKey = time.Now().UTC().Format(instanceid.DateLayout)
+	}
+	if m.SuspendedOn(dateKey) {
+		return fmt.Errorf("%w: the member is suspended on %s", ErrSuspended, dateKey)
+	}
+	return nil
+}
+
+// memberDoc reads a member doc, which stays in the default database
+func (r *Repo) memberDoc(ctx context.Context, dojoID, uid string) (*firestore.DocumentSnapshot, error) {
+	doc, err := r.client.Collection("dojos").Doc(dojoID).Collection("members").Doc(uid).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load member: %w", err)
+	}
+	return doc, nil
+}
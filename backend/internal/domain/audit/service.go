@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// The audit log is the top-level auditLog collection. It is server-only:
+// entries are written by the API and read by admins and, for their own
+// account, by the user concerned.
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// Entry is auditLog/{id}
+type Entry struct {
+	ID        string                 `firestore:"-" json:"id"`
+	Type      string                 `firestore:"type" json:"type"` // e.g. "login.new_device"
+	UID       string                 `firestore:"uid" json:"uid"`   // the account concerned
+	ActorUID  string                 `firestore:"actorUid,omitempty" json:"actorUid,omitempty"`
+	DojoID    string                 `firestore:"dojoId,omitempty" json:"dojoId,omitempty"`
+	IP        string                 `firestore:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string                 `firestore:"userAgent,omitempty" json:"userAgent,omitempty"`
+	Data      map[string]interface{} `firestore:"data,omitempty" json:"data,omitempty"`
+	At        time.Time              `firestore:"at" json:"at"`
+}
+
+// ListInput filters the log. UID and Type may not be combined.
+type ListInput struct {
+	UID    string
+	Type   string
+	Before *time.Time
+	Limit  int
+}
+
+type Service struct {
+	fs *firestore.Client
+}
+
+func NewService(fs *firestore.Client) *Service {
+	return &Service{fs: fs}
+}
+
+func (s *Service) col() *firestore.CollectionRef {
+	return s.fs.Collection("auditLog")
+}
+
+// Record appends an entry; At defaults to now
+func (s *Service) Record(ctx context.Context, e Entry) error {
+	if e.Type == "" || e.UID == "" {
+		return fmt.Errorf("%w: type and uid are required", ErrBadRequest)
+	}
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	if _, _, err := s.col().Add(ctx, e); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns entries newest first
+func (s *Service) List(ctx context.Context, in ListInput) ([]Entry, error) {
+	in.UID = strings.TrimSpace(in.UID)
+	in.Type = strings.TrimSpace(in.Type)
+	if in.UID != "" && in.Type != "" {
+		return nil, fmt.Errorf("%w: filter by uid or by type, not both", ErrBadRequest)
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultListLimit
+	}
+	if in.Limit > maxListLimit {
+		in.Limit = maxListLimit
+	}
+
+	q := s.col().Query
+	switch {
+	case in.UID != "":
+		q = q.Where("uid", "==", in.UID)
+	case in.Type != "":
+		q = q.Where("type", "==", in.Type)
+	}
+	q = q.OrderBy("at", firestore.Desc)
+	if in.Before != nil {
+		q = q.Where("at", "<", *in.Before)
+	}
+
+	iter := q.Limit(in.Limit).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Entry{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit log: %w", err)
+		}
+		var e Entry
+		if err := doc.DataTo(&e); err != nil {
+			continue
+		}
+		e.ID = doc.Ref.ID
+		out = append(out, e)
+	}
+	return out, nil
+}
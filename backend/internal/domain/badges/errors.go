@@ -0,0 +1,26 @@
+package badges
+
+import "errors"
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrBadRequest   = errors.New("bad request")
+	ErrInvalidBadge = errors.New("invalid badge")
+)
+
+func IsErrUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrInvalidBadge(err error) bool {
+	return errors.Is(err, ErrInvalidBadge)
+}
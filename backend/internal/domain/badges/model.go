@@ -0,0 +1,48 @@
+package badges
+
+import (
+	"strings"
+	"time"
+
+	"dojo-manager/backend/internal/domain/attendance"
+)
+
+// Badge is what a printed member badge shows. Token is the QR payload.
+type Badge struct {
+	DojoID       string `json:"dojoId"`
+	DojoName     string `json:"dojoName"`
+	MemberUID    string `json:"memberUid"`
+	MemberNumber int    `json:"memberNumber"`
+	DisplayName  string `json:"displayName"`
+	BeltRank     string `json:"beltRank"`
+	Serial       int    `json:"serial"`
+	Token        string `json:"token"`
+}
+
+// KeySettings is dojos/{dojoId}/settings/badges. Secret signs every badge of
+// the dojo; replacing it invalidates all printed badges at once.
+type KeySettings struct {
+	Secret    string    `firestore:"secret"` // base64
+	RotatedAt time.Time `firestore:"rotatedAt"`
+	RotatedBy string    `firestore:"rotatedBy,omitempty"`
+}
+
+// CheckinInput is a badge scanned at the desk or a kiosk
+type CheckinInput struct {
+	Token             string `json:"token"`
+	SessionInstanceID string `json:"sessionInstanceId"`
+}
+
+func (in *CheckinInput) Trim() {
+	in.Token = strings.TrimSpace(in.Token)
+	in.SessionInstanceID = strings.TrimSpace(in.SessionInstanceID)
+}
+
+// CheckinResult tells the scanner who was checked in
+type CheckinResult struct {
+	MemberUID    string                 `json:"memberUid"`
+	MemberNumber int                    `json:"memberNumber,omitempty"`
+	DisplayName  string                 `json:"displayName"`
+	BeltRank     string                 `json:"beltRank"`
+	Attendance   *attendance.Attendance `json:"attendance"`
+}
@@ -0,0 +1,212 @@
+package badges
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/png"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"dojo-manager/backend/internal/qrcode"
+)
+
+// Badges print at ID-1 card size (85.6 x 54 mm), alone on a card-sized page
+// or ten to an A4 sheet. Sizes are in PDF points.
+const (
+	cardW = 242.6
+	cardH = 153.1
+
+	sheetW      = 595.3
+	sheetH      = 841.9
+	sheetCols   = 2
+	sheetRows   = 5
+	sheetGap    = 5.0
+	sheetMargin = 28.0
+
+	// pngScale is pixels per QR module in PNG badges
+	pngScale = 8
+
+	// text right of the QR code has room for about this many characters
+	maxNameRunes = 16
+	maxDojoRunes = 22
+)
+
+// PNG writes the badge's QR code as a PNG image
+func PNG(w io.Writer, b *Badge) error {
+	code, err := qrcode.Encode([]byte(b.Token))
+	if err != nil {
+		return fmt.Errorf("failed to encode badge: %w", err)
+	}
+	return png.Encode(w, code.Image(pngScale))
+}
+
+// PDF writes printable badges: a single badge gets a card-sized page, more
+// than one are laid out on A4 sheets with cut lines
+func PDF(w io.Writer, list []Badge) error {
+	if len(list) == 0 {
+		return fmt.Errorf("%w: no badges to print", ErrBadRequest)
+	}
+
+	var pages []string
+	pageW, pageH := cardW, cardH
+	if len(list) == 1 {
+		card, err := cardContent(&list[0], 0, 0)
+		if err != nil {
+			return err
+		}
+		pages = append(pages, card)
+	} else {
+		pageW, pageH = sheetW, sheetH
+		perPage := sheetCols * sheetRows
+		left := (sheetW - sheetCols*cardW - (sheetCols-1)*sheetGap) / 2
+		for start := 0; start < len(list); start += perPage {
+			var page strings.Builder
+			for i := start; i < min(start+perPage, len(list)); i++ {
+				col, row := (i-start)%sheetCols, (i-start)/sheetCols
+				x := left + float64(col)*(cardW+sheetGap)
+				y := sheetH - sheetMargin - float64(row+1)*cardH - float64(row)*sheetGap
+				card, err := cardContent(&list[i], x, y)
+				if err != nil {
+					return err
+				}
+				page.WriteString(card)
+			}
+			pages = append(pages, page.String())
+		}
+	}
+	return writePDF(w, pages, pageW, pageH)
+}
+
+// cardContent draws one badge with its lower left corner at x, y
+func cardContent(b *Badge, x, y float64) (string, error) {
+	code, err := qrcode.Encode([]byte(b.Token))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode badge: %w", err)
+	}
+
+	var c strings.Builder
+	// cut line
+	fmt.Fprintf(&c, "0.6 G 0.5 w %.2f %.2f %.2f %.2f re S\n", x, y, cardW, cardH)
+
+	// QR code, one filled rectangle per horizontal run of dark modules
+	const qrSide, qrMargin = 110.0, 12.0
+	module := qrSide / float64(code.Size+8) // four module quiet zone each side
+	qx, qy := x+qrMargin, y+(cardH-qrSide)/2
+	c.WriteString("0 g\n")
+	for row, modules := range code.Modules {
+		for col := 0; col < code.Size; {
+			if !modules[col] {
+				col++
+				continue
+			}
+			run := col
+			for run < code.Size && modules[run] {
+				run++
+			}
+			fmt.Fprintf(&c, "%.3f %.3f %.3f %.3f re\n",
+				qx+float64(col+4)*module,
+				qy+qrSide-float64(row+5)*module,
+				float64(run-col)*module,
+				module)
+			col = run
+		}
+	}
+	c.WriteString("f\n")
+
+	tx := qx + qrSide + 6
+	text := func(font string, size, ty float64, gray float64, s string) {
+		fmt.Fprintf(&c, "%.2f g BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", gray, font, size, tx, y+ty, pdfString(s))
+	}
+	text("F2", 8, cardH-34, 0.35, truncate(b.DojoName, maxDojoRunes))
+	text("F2", 11, cardH-66, 0, truncate(b.DisplayName, maxNameRunes))
+	text("F1", 9, cardH-82, 0.2, beltLabel(b.BeltRank))
+	if b.MemberNumber > 0 {
+		text("F1", 8, cardH-98, 0.35, fmt.Sprintf("No. %d", b.MemberNumber))
+	}
+	text("F1", 7, 26, 0.45, "Scan to check in")
+	return c.String(), nil
+}
+
+// beltLabel turns "grey_white" into "Grey white belt"
+func beltLabel(belt string) string {
+	label := strings.ReplaceAll(belt, "_", " ")
+	if label == "" {
+		return ""
+	}
+	return strings.ToUpper(label[:1]) + label[1:] + " belt"
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-3]) + "..."
+}
+
+// pdfString escapes s for a PDF literal string in WinAnsiEncoding. The
+// standard fonts have no glyphs outside Latin-1, so other characters print
+// as "?".
+func pdfString(s string) string {
+	var out strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			out.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&out, "\\%03o", r)
+		default:
+			out.WriteByte('?')
+		}
+	}
+	return out.String()
+}
+
+// writePDF writes a minimal PDF with the given page content streams and the
+// two Helvetica faces as /F1 and /F2
+func writePDF(w io.Writer, pages []string, pageW, pageH float64) error {
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range pages {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		if _, err := zw.Write([]byte(content)); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		obj(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.String()))
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.1f %.1f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageW, pageH, 5+2*i))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,426 @@
+package badges
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/fsdoc"
+)
+
+// A badge token is "b2.{dojoId}.{memberUid}.{serial}.{memberNumber}.{sig}",
+// where sig is a truncated HMAC-SHA256 of the rest under the dojo's badge
+// secret. The serial is badgeSerial on the member doc; reissuing a badge
+// bumps it, so a lost card stops working without touching anyone else's. The
+// member number lets scanners without the roster show who they scanned.
+// Badges printed before member numbers, "b1.{dojoId}.{memberUid}.{serial}.{sig}",
+// still scan.
+const (
+	tokenVersion   = "b2"
+	tokenVersionV1 = "b1"
+	sigBytes       = 16
+
+	// maxSheetBadges caps one printable sheet
+	maxSheetBadges = 300
+)
+
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	attendanceSvc *attendance.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, attendanceSvc *attendance.Service) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, attendanceSvc: attendanceSvc}
+}
+
+func (s *Service) keyRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("badges")
+}
+
+func (s *Service) memberRef(dojoID, memberUID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("members").Doc(memberUID)
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate badge secret: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// secret returns the dojo's badge secret, creating it on first use
+func (s *Service) secret(ctx context.Context, dojoID string) ([]byte, error) {
+	doc, err := s.keyRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load badge secret: %w", err)
+	}
+	var k KeySettings
+	if doc.Exists() {
+		if err := doc.DataTo(&k); err != nil {
+			return nil, fmt.Errorf("failed to decode badge secret: %w", err)
+		}
+	}
+	if k.Secret == "" {
+		if k.Secret, err = s.createSecret(ctx, dojoID); err != nil {
+			return nil, err
+		}
+	}
+	return base64.StdEncoding.DecodeString(k.Secret)
+}
+
+// createSecret stores a first secret, or returns the one a concurrent
+// request stored first
+func (s *Service) createSecret(ctx context.Context, dojoID string) (string, error) {
+	var encoded string
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(s.keyRef(dojoID))
+		if err != nil && doc == nil {
+			return err
+		}
+		if doc.Exists() {
+			if v, _ := doc.DataAt("secret"); v != nil && v != "" {
+				encoded, _ = v.(string)
+				return nil
+			}
+		}
+		if encoded, err = newSecret(); err != nil {
+			return err
+		}
+		return tx.Set(s.keyRef(dojoID), KeySettings{Secret: encoded, RotatedAt: time.Now().UTC()})
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create badge secret: %w", err)
+	}
+	return encoded, nil
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:sigBytes])
+}
+
+func token(secret []byte, dojoID, memberUID string, serial, memberNumber int) string {
+	payload := strings.Join([]string{tokenVersion, dojoID, memberUID, strconv.Itoa(serial), strconv.Itoa(memberNumber)}, ".")
+	return payload + "." + sign(secret, payload)
+}
+
+// parsedToken is a token split into its fields, signature not yet checked
+type parsedToken struct {
+	dojoID, memberUID string
+	serial            int
+	payload, sig      string
+}
+
+func parseToken(t string) (*parsedToken, bool) {
+	parts := strings.Split(t, ".")
+	switch {
+	case len(parts) == 6 && parts[0] == tokenVersion:
+		if n, err := strconv.Atoi(parts[4]); err != nil || n < 0 {
+			return nil, false
+		}
+	case len(parts) == 5 && parts[0] == tokenVersionV1:
+	default:
+		return nil, false
+	}
+	if parts[1] == "" || parts[2] == "" {
+		return nil, false
+	}
+	serial, err := strconv.Atoi(parts[3])
+	if err != nil || serial < 0 {
+		return nil, false
+	}
+	last := len(parts) - 1
+	return &parsedToken{
+		dojoID:    parts[1],
+		memberUID: parts[2],
+		serial:    serial,
+		payload:   strings.Join(parts[:last], "."),
+		sig:       parts[last],
+	}, true
+}
+
+// badgeMember is the part of a member doc a badge needs
+type badgeMember struct {
+	fsdoc.Member
+	BadgeSerial  int `firestore:"badgeSerial"`
+	MemberNumber int `firestore:"memberNumber"`
+}
+
+func (m badgeMember) canCheckIn() bool {
+	return m.Status != members.StatusPending && m.Status != members.StatusInactive
+}
+
+func (s *Service) getMember(ctx context.Context, dojoID, memberUID string) (*badgeMember, error) {
+	doc, err := s.memberRef(dojoID, memberUID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	var m badgeMember
+	if err := fsdoc.Decode(doc, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *Service) dojoName(ctx context.Context, dojoID string) (string, error) {
+	d, err := s.dojoRepo.GetDojo(ctx, dojoID)
+	if err != nil {
+		return "", fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	return d.Name, nil
+}
+
+// numberMember gives a member printed on a badge its member number if it
+// has none yet
+func (s *Service) numberMember(ctx context.Context, dojoID, memberUID string, m *badgeMember) error {
+	if m.MemberNumber > 0 {
+		return nil
+	}
+	n, err := s.dojoRepo.EnsureMemberNumber(ctx, dojoID, memberUID)
+	if err != nil {
+		return err
+	}
+	m.MemberNumber = n
+	return nil
+}
+
+func newBadge(secret []byte, dojoID, dojoName, memberUID string, m *badgeMember) *Badge {
+	name := m.DisplayName
+	if name == "" {
+		name = "Member"
+	}
+	return &Badge{
+		DojoID:       dojoID,
+		DojoName:     dojoName,
+		MemberUID:    memberUID,
+		MemberNumber: m.MemberNumber,
+		DisplayName:  name,
+		BeltRank:     m.Belt(),
+		Serial:       m.BadgeSerial,
+		Token:        token(secret, dojoID, memberUID, m.BadgeSerial, m.MemberNumber),
+	}
+}
+
+// Get returns a member's badge. Members may fetch their own; staff need
+// members.view.
+func (s *Service) Get(ctx context.Context, uid, dojoID, memberUID string) (*Badge, error) {
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if uid != memberUID {
+		ok, err := s.dojoRepo.HasPermission(ctx, dojoID, uid, dojo.PermMembersView)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check permission: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: only staff can view other members' badges", ErrUnauthorized)
+		}
+	}
+
+	m, err := s.getMember(ctx, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.numberMember(ctx, dojoID, memberUID, m); err != nil {
+		return nil, err
+	}
+	dojoName, err := s.dojoName(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := s.secret(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return newBadge(secret, dojoID, dojoName, memberUID, m), nil
+}
+
+// List returns badges for every member who can check in, by name, for a
+// printable sheet (staff)
+func (s *Service) List(ctx context.Context, dojoID string) ([]Badge, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	dojoName, err := s.dojoName(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := s.secret(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+
+	// not ordered by displayName in the query, which would drop member docs
+	// written before it was copied onto them
+	iter := s.fs.Collection("dojos").Doc(dojoID).Collection("members").Limit(maxSheetBadges).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Badge{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members: %w", err)
+		}
+		var m badgeMember
+		if err := fsdoc.Decode(doc, &m); err != nil || !m.canCheckIn() {
+			continue
+		}
+		if err := s.numberMember(ctx, dojoID, doc.Ref.ID, &m); err != nil {
+			return nil, err
+		}
+		out = append(out, *newBadge(secret, dojoID, dojoName, doc.Ref.ID, &m))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.ToLower(out[i].DisplayName) < strings.ToLower(out[j].DisplayName)
+	})
+	return out, nil
+}
+
+// Reissue invalidates a member's current badge and returns the new one (staff)
+func (s *Service) Reissue(ctx context.Context, dojoID, memberUID string) (*Badge, error) {
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if _, err := s.getMember(ctx, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+	if _, err := s.memberRef(dojoID, memberUID).Update(ctx, []firestore.Update{
+		{Path: "badgeSerial", Value: firestore.Increment(1)},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to reissue badge: %w", err)
+	}
+
+	m, err := s.getMember(ctx, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.numberMember(ctx, dojoID, memberUID, m); err != nil {
+		return nil, err
+	}
+	dojoName, err := s.dojoName(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := s.secret(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return newBadge(secret, dojoID, dojoName, memberUID, m), nil
+}
+
+// RotateKey replaces the dojo's badge secret, invalidating every printed
+// badge (staff)
+func (s *Service) RotateKey(ctx context.Context, staffUID, dojoID string) error {
+	if dojoID == "" {
+		return fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	if _, err := s.keyRef(dojoID).Set(ctx, KeySettings{
+		Secret:    secret,
+		RotatedAt: time.Now().UTC(),
+		RotatedBy: staffUID,
+	}); err != nil {
+		return fmt.Errorf("failed to rotate badge secret: %w", err)
+	}
+	return nil
+}
+
+// verify checks a scanned token against the dojo it was scanned in and
+// returns the member it belongs to
+func (s *Service) verify(ctx context.Context, dojoID, t string) (string, *badgeMember, error) {
+	p, ok := parseToken(t)
+	if !ok || p.dojoID != dojoID {
+		return "", nil, fmt.Errorf("%w: not a badge of this dojo", ErrInvalidBadge)
+	}
+	secret, err := s.secret(ctx, dojoID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !hmac.Equal([]byte(sign(secret, p.payload)), []byte(p.sig)) {
+		return "", nil, fmt.Errorf("%w: badge signature does not match", ErrInvalidBadge)
+	}
+
+	m, err := s.getMember(ctx, dojoID, p.memberUID)
+	if IsErrNotFound(err) {
+		return "", nil, fmt.Errorf("%w: badge holder is no longer a member", ErrInvalidBadge)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if m.BadgeSerial != p.serial {
+		return "", nil, fmt.Errorf("%w: badge was replaced, use the latest one", ErrInvalidBadge)
+	}
+	if !m.canCheckIn() {
+		return "", nil, fmt.Errorf("%w: membership is %s", ErrInvalidBadge, m.Status)
+	}
+	return p.memberUID, m, nil
+}
+
+// CheckIn verifies a badge scanned at the desk and marks its holder present
+// (staff)
+func (s *Service) CheckIn(ctx context.Context, staffUID, dojoID string, in CheckinInput) (*CheckinResult, error) {
+	return s.checkIn(ctx, dojoID, in, func(memberUID string) (*attendance.Attendance, error) {
+		return s.attendanceSvc.Record(ctx, staffUID, attendance.RecordAttendanceInput{
+			DojoID:            dojoID,
+			SessionInstanceID: in.SessionInstanceID,
+			MemberUID:         memberUID,
+			Status:            string(attendance.StatusPresent),
+		})
+	})
+}
+
+// CheckInFromDevice is CheckIn for a registered kiosk, which is trusted by
+// its device token rather than a staff account
+func (s *Service) CheckInFromDevice(ctx context.Context, deviceID, dojoID string, in CheckinInput) (*CheckinResult, error) {
+	return s.checkIn(ctx, dojoID, in, func(memberUID string) (*attendance.Attendance, error) {
+		return s.attendanceSvc.RecordCheckin(ctx, "device:"+deviceID, dojoID, in.SessionInstanceID, memberUID)
+	})
+}
+
+func (s *Service) checkIn(ctx context.Context, dojoID string, in CheckinInput, record func(memberUID string) (*attendance.Attendance, error)) (*CheckinResult, error) {
+	in.Trim()
+	if dojoID == "" || in.Token == "" || in.SessionInstanceID == "" {
+		return nil, fmt.Errorf("%w: token and sessionInstanceId are required", ErrBadRequest)
+	}
+	memberUID, m, err := s.verify(ctx, dojoID, in.Token)
+	if err != nil {
+		return nil, err
+	}
+	att, err := record(memberUID)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckinResult{
+		MemberUID:    memberUID,
+		MemberNumber: m.MemberNumber,
+		DisplayName:  m.DisplayName,
+		BeltRank:     m.Belt(),
+		Attendance:   att,
+	}, nil
+}
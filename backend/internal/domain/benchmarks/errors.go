@@ -0,0 +1,21 @@
+package benchmarks
+
+import "errors"
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrBadRequest   = errors.New("bad request")
+	ErrNotOptedIn   = errors.New("benchmarking not enabled")
+)
+
+func IsErrUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrNotOptedIn(err error) bool {
+	return errors.Is(err, ErrNotOptedIn)
+}
@@ -0,0 +1,88 @@
+package benchmarks
+
+import "time"
+
+// Size bands group dojos by active student count so a 20-member garage gym
+// is not compared to a 300-member academy
+var sizeBands = []struct {
+	Name string
+	Max  int // inclusive; 0 = no upper bound
+}{
+	{"1-25", 25},
+	{"26-75", 75},
+	{"76-150", 150},
+	{"151+", 0},
+}
+
+const (
+	// minCohortSize keeps cohorts large enough that no single dojo can be
+	// picked out of the aggregate
+	minCohortSize = 5
+
+	windowDays       = 30
+	establishedAfter = 60 // days since joining before a member counts toward retention
+)
+
+// Comparison of a dojo metric against its cohort quartiles
+const (
+	CompareTopQuartile    = "top_quartile"
+	CompareAboveMedian    = "above_median"
+	CompareBelowMedian    = "below_median"
+	CompareBottomQuartile = "bottom_quartile"
+)
+
+// Settings is the opt-in state, kept on the dojo doc (benchmarkingOptIn) so
+// the aggregation job can query participating dojos directly
+type Settings struct {
+	OptIn bool `json:"optIn"`
+}
+
+// UpdateSettingsInput is the body of PUT /v1/dojos/{dojoId}/benchmarks/settings
+type UpdateSettingsInput struct {
+	OptIn *bool `json:"optIn"`
+}
+
+// DojoMetrics is one dojo's snapshot at dojos/{dojoId}/benchmarks/latest.
+// Only the dojo itself can read it; cohorts never reference dojo IDs.
+type DojoMetrics struct {
+	SizeBand            string             `firestore:"sizeBand" json:"sizeBand"`
+	ActiveMembers       int                `firestore:"activeMembers" json:"activeMembers"`
+	RetentionRate       float64            `firestore:"retentionRate" json:"retentionRate"`             // share of established members who trained in the last 30 days
+	AvgWeeklyAttendance float64            `firestore:"avgWeeklyAttendance" json:"avgWeeklyAttendance"` // check-ins per member per week, last 30 days
+	BeltDistribution    map[string]float64 `firestore:"beltDistribution" json:"beltDistribution"`       // belt -> share of members
+	ComputedAt          time.Time          `firestore:"computedAt" json:"computedAt"`
+}
+
+// Quartiles summarises a metric across a cohort
+type Quartiles struct {
+	P25    float64 `firestore:"p25" json:"p25"`
+	Median float64 `firestore:"median" json:"median"`
+	P75    float64 `firestore:"p75" json:"p75"`
+}
+
+// Cohort is the anonymized aggregate at benchmarks/{sizeBand}
+type Cohort struct {
+	SizeBand            string             `firestore:"sizeBand" json:"sizeBand"`
+	DojoCount           int                `firestore:"dojoCount" json:"dojoCount"`
+	RetentionRate       Quartiles          `firestore:"retentionRate" json:"retentionRate"`
+	AvgWeeklyAttendance Quartiles          `firestore:"avgWeeklyAttendance" json:"avgWeeklyAttendance"`
+	BeltDistribution    map[string]float64 `firestore:"beltDistribution" json:"beltDistribution"` // mean share per belt
+	ComputedAt          time.Time          `firestore:"computedAt" json:"computedAt"`
+}
+
+// Benchmarks is the response of GET /v1/dojos/{dojoId}/benchmarks
+type Benchmarks struct {
+	Dojo       *DojoMetrics      `json:"dojo"`
+	Cohort     *Cohort           `json:"cohort"`               // nil until enough similar dojos participate
+	Comparison map[string]string `json:"comparison,omitempty"` // metric -> top_quartile / above_median / ...
+	Message    string            `json:"message,omitempty"`
+}
+
+// AggregateResult is returned by the aggregation job
+type AggregateResult struct {
+	DojosScanned  int            `json:"dojosScanned"`
+	DojosIncluded int            `json:"dojosIncluded"`
+	Cohorts       map[string]int `json:"cohorts"` // band -> dojo count (published or not)
+	Failed        int            `json:"failed"`
+	ComputedAt    time.Time      `json:"computedAt"`
+}
@@ -0,0 +1,361 @@
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+const optInField = "benchmarkingOptIn"
+
+// staffRoles are left out of member metrics
+var staffRoles = map[string]bool{
+	"owner": true, "staff": true, "coach": true, "admin": true, "instructor": true,
+}
+
+// inactiveStatuses are members that no longer count as active students
+var inactiveStatuses = map[string]bool{
+	"pending": true, "inactive": true, "rejected": true, "removed": true, "banned": true,
+}
+
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	attendanceSvc *attendance.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, attendanceSvc *attendance.Service) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, attendanceSvc: attendanceSvc}
+}
+
+func (s *Service) snapshotRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("benchmarks").Doc("latest")
+}
+
+func (s *Service) cohortRef(band string) *firestore.DocumentRef {
+	return s.fs.Collection("benchmarks").Doc(band)
+}
+
+func (s *Service) requireStaff(ctx context.Context, dojoID, uid string) error {
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+	return nil
+}
+
+func (s *Service) optedIn(ctx context.Context, dojoID string) (bool, error) {
+	doc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get dojo: %w", err)
+	}
+	optIn, _ := doc.Data()[optInField].(bool)
+	return optIn, nil
+}
+
+// GetSettings returns whether the dojo participates in benchmarking
+func (s *Service) GetSettings(ctx context.Context, staffUID, dojoID string) (*Settings, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	optIn, err := s.optedIn(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return &Settings{OptIn: optIn}, nil
+}
+
+// UpdateSettings opts the dojo in or out. Opting out drops its snapshot; it
+// leaves the cohorts at the next aggregation run.
+func (s *Service) UpdateSettings(ctx context.Context, staffUID, dojoID string, in UpdateSettingsInput) (*Settings, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.OptIn == nil {
+		return nil, fmt.Errorf("%w: optIn is required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	_, err := s.fs.Collection("dojos").Doc(dojoID).Set(ctx, map[string]interface{}{
+		optInField:  *in.OptIn,
+		"updatedAt": time.Now().UTC(),
+	}, firestore.MergeAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save benchmarking settings: %w", err)
+	}
+	if !*in.OptIn {
+		if _, err := s.snapshotRef(dojoID).Delete(ctx); err != nil {
+			log.Printf("benchmarks: failed to drop snapshot of %s: %v", dojoID, err)
+		}
+	}
+	return &Settings{OptIn: *in.OptIn}, nil
+}
+
+// Get compares the dojo's latest snapshot with its size cohort (staff only)
+func (s *Service) Get(ctx context.Context, staffUID, dojoID string) (*Benchmarks, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	optIn, err := s.optedIn(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if !optIn {
+		return nil, fmt.Errorf("%w: opt in to benchmarking to compare with other dojos", ErrNotOptedIn)
+	}
+
+	out := &Benchmarks{}
+	doc, err := s.snapshotRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get benchmark snapshot: %w", err)
+	}
+	if !doc.Exists() {
+		out.Message = "Benchmarks are computed daily; check back after the next run."
+		return out, nil
+	}
+	var m DojoMetrics
+	if err := doc.DataTo(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode benchmark snapshot: %w", err)
+	}
+	out.Dojo = &m
+
+	cdoc, err := s.cohortRef(m.SizeBand).Get(ctx)
+	if err != nil && cdoc == nil {
+		return nil, fmt.Errorf("failed to get benchmark cohort: %w", err)
+	}
+	if !cdoc.Exists() {
+		out.Message = fmt.Sprintf("Not enough similar-sized dojos (%s members) participate yet.", m.SizeBand)
+		return out, nil
+	}
+	var c Cohort
+	if err := cdoc.DataTo(&c); err != nil {
+		return nil, fmt.Errorf("failed to decode benchmark cohort: %w", err)
+	}
+	out.Cohort = &c
+	out.Comparison = map[string]string{
+		"retentionRate":       compare(m.RetentionRate, c.RetentionRate),
+		"avgWeeklyAttendance": compare(m.AvgWeeklyAttendance, c.AvgWeeklyAttendance),
+	}
+	return out, nil
+}
+
+// Aggregate recomputes every participating dojo's snapshot and the cohort
+// aggregates. Meant to run daily from Cloud Scheduler.
+func (s *Service) Aggregate(ctx context.Context, now time.Time) (*AggregateResult, error) {
+	now = now.UTC()
+	res := &AggregateResult{Cohorts: map[string]int{}, ComputedAt: now}
+
+	iter := s.fs.Collection("dojos").Where(optInField, "==", true).Documents(ctx)
+	defer iter.Stop()
+
+	byBand := map[string][]DojoMetrics{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("failed to list participating dojos: %w", err)
+		}
+		res.DojosScanned++
+
+		m, err := s.computeDojo(ctx, doc.Ref.ID, now)
+		if err != nil {
+			log.Printf("benchmarks: dojo %s failed: %v", doc.Ref.ID, err)
+			res.Failed++
+			continue
+		}
+		if m.ActiveMembers == 0 {
+			continue
+		}
+		if _, err := s.snapshotRef(doc.Ref.ID).Set(ctx, m); err != nil {
+			log.Printf("benchmarks: saving snapshot of %s failed: %v", doc.Ref.ID, err)
+			res.Failed++
+			continue
+		}
+		res.DojosIncluded++
+		byBand[m.SizeBand] = append(byBand[m.SizeBand], *m)
+	}
+
+	for _, band := range sizeBands {
+		list := byBand[band.Name]
+		res.Cohorts[band.Name] = len(list)
+		if len(list) < minCohortSize {
+			// too few to stay anonymous: withdraw any older aggregate
+			if _, err := s.cohortRef(band.Name).Delete(ctx); err != nil {
+				log.Printf("benchmarks: clearing cohort %s failed: %v", band.Name, err)
+			}
+			continue
+		}
+		if _, err := s.cohortRef(band.Name).Set(ctx, buildCohort(band.Name, list, now)); err != nil {
+			return res, fmt.Errorf("failed to save cohort %s: %w", band.Name, err)
+		}
+	}
+	return res, nil
+}
+
+// computeDojo derives one dojo's metrics from its members and recent attendance
+func (s *Service) computeDojo(ctx context.Context, dojoID string, now time.Time) (*DojoMetrics, error) {
+	checkins, err := s.attendanceSvc.CheckinsByMember(ctx, dojoID, now.AddDate(0, 0, -windowDays))
+	if err != nil {
+		return nil, err
+	}
+
+	iter := s.fs.Collection("dojos").Doc(dojoID).Collection("members").Documents(ctx)
+	defer iter.Stop()
+
+	active, established, retained, total := 0, 0, 0, 0
+	belts := map[string]int{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members: %w", err)
+		}
+		data := doc.Data()
+		role, _ := data["roleInDojo"].(string)
+		if role == "" {
+			role, _ = data["role"].(string)
+		}
+		status, _ := data["status"].(string)
+		if staffRoles[role] || inactiveStatuses[status] {
+			continue
+		}
+
+		active++
+		n := checkins[doc.Ref.ID]
+		total += n
+
+		belt, _ := data["beltRank"].(string)
+		if belt == "" {
+			belt, _ = data["belt"].(string)
+		}
+		belt = strings.ToLower(strings.TrimSpace(belt))
+		if belt == "" {
+			belt = "white"
+		}
+		belts[belt]++
+
+		if joinedAt, ok := data["joinedAt"].(time.Time); ok && now.Sub(joinedAt) >= establishedAfter*24*time.Hour {
+			established++
+			if n > 0 {
+				retained++
+			}
+		}
+	}
+
+	m := &DojoMetrics{
+		SizeBand:         bandFor(active),
+		ActiveMembers:    active,
+		BeltDistribution: map[string]float64{},
+		ComputedAt:       now,
+	}
+	if active == 0 {
+		return m, nil
+	}
+	if established > 0 {
+		m.RetentionRate = round2(float64(retained) / float64(established))
+	}
+	m.AvgWeeklyAttendance = round2(float64(total) / float64(active) / (windowDays / 7.0))
+	for belt, n := range belts {
+		m.BeltDistribution[belt] = round2(float64(n) / float64(active))
+	}
+	return m, nil
+}
+
+func buildCohort(band string, list []DojoMetrics, now time.Time) Cohort {
+	retention := make([]float64, 0, len(list))
+	attendance := make([]float64, 0, len(list))
+	beltSum := map[string]float64{}
+	for _, m := range list {
+		retention = append(retention, m.RetentionRate)
+		attendance = append(attendance, m.AvgWeeklyAttendance)
+		for belt, share := range m.BeltDistribution {
+			beltSum[belt] += share
+		}
+	}
+	belts := make(map[string]float64, len(beltSum))
+	for belt, sum := range beltSum {
+		belts[belt] = round2(sum / float64(len(list)))
+	}
+	return Cohort{
+		SizeBand:            band,
+		DojoCount:           len(list),
+		RetentionRate:       quartiles(retention),
+		AvgWeeklyAttendance: quartiles(attendance),
+		BeltDistribution:    belts,
+		ComputedAt:          now,
+	}
+}
+
+func bandFor(activeMembers int) string {
+	for _, b := range sizeBands {
+		if b.Max == 0 || activeMembers <= b.Max {
+			return b.Name
+		}
+	}
+	return sizeBands[len(sizeBands)-1].Name
+}
+
+func quartiles(values []float64) Quartiles {
+	sort.Float64s(values)
+	return Quartiles{
+		P25:    round2(percentile(values, 0.25)),
+		Median: round2(percentile(values, 0.5)),
+		P75:    round2(percentile(values, 0.75)),
+	}
+}
+
+// percentile interpolates linearly between closest ranks of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+func compare(v float64, q Quartiles) string {
+	switch {
+	case v >= q.P75:
+		return CompareTopQuartile
+	case v >= q.Median:
+		return CompareAboveMedian
+	case v >= q.P25:
+		return CompareBelowMedian
+	default:
+		return CompareBottomQuartile
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,155 @@
+package birthdays
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/mailqueue"
+)
+
+// SendGreetings greets the members of every opted-in dojo whose birthday is
+// today (UTC) with an in-app notification and, if the dojo enabled it, an
+// email. Meant to be triggered daily by Cloud Scheduler; each member is
+// greeted at most once a year. Members born on February 29 are greeted on
+// the 28th in other years.
+func (s *Service) SendGreetings(ctx context.Context, now time.Time) (*SendResult, error) {
+	now = now.UTC()
+	res := &SendResult{Date: now.Format("2006-01-02")}
+	days := []int{now.Day()}
+	if now.Month() == time.February && now.Day() == 28 && !isLeap(now.Year()) {
+		days = append(days, 29)
+	}
+
+	iter := s.fs.Collection("dojos").Select("name", "status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		data := doc.Data()
+		if status, _ := data["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+		dojoName, _ := data["name"].(string)
+
+		if err := s.greetDojo(ctx, doc.Ref.ID, dojoName, now, days, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			log.Printf("birthdays: dojo %s: %v", doc.Ref.ID, err)
+		}
+	}
+
+	log.Printf("birthdays: %d dojos checked, %d enabled, %d members greeted, %d emails queued (partial=%v)",
+		res.DojosChecked, res.DojosEnabled, res.Greeted, res.EmailQueued, res.Partial)
+	return res, nil
+}
+
+// greetDojo greets one dojo's members born on one of days of this month
+func (s *Service) greetDojo(ctx context.Context, dojoID, dojoName string, now time.Time, days []int, res *SendResult) error {
+	st, err := s.GetSettings(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	if !st.Enabled {
+		return nil
+	}
+	res.DojosEnabled++
+
+	docs, err := s.membersCol(dojoID).
+		Where("birthMonth", "==", int(now.Month())).
+		Where("birthDay", "in", days).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list birthdays: %w", err)
+	}
+	for _, doc := range docs {
+		var m fsdoc.Member
+		if err := fsdoc.Decode(doc, &m); err != nil || !isCurrent(m) {
+			res.Skipped++
+			continue
+		}
+		uid := doc.Ref.ID
+		email := st.Email && m.Email != ""
+
+		claim := s.fs.Collection("dojos").Doc(dojoID).Collection("birthdayGreetings").Doc(fmt.Sprintf("%d_%s", now.Year(), uid))
+		if _, err := claim.Create(ctx, greeting{MemberUID: uid, Year: now.Year(), Email: email, SentAt: now}); err != nil {
+			// already greeted this year (or the claim failed); either way do not send
+			res.Skipped++
+			continue
+		}
+
+		body := greetingText(st.Message, m.DisplayName, dojoName)
+		if err := s.notify(ctx, dojoID, uid, body, now); err != nil {
+			log.Printf("birthdays: dojo %s: greeting %s failed: %v", dojoID, uid, err)
+			// release the claim so the next run retries
+			_, _ = claim.Delete(ctx)
+			res.Failed++
+			continue
+		}
+		res.Greeted++
+
+		if email {
+			if err := mailqueue.Queue(ctx, s.fs, mailqueue.Email{To: m.Email, Subject: greetingTitle(dojoName), Text: body}, now); err != nil {
+				log.Printf("birthdays: dojo %s: email to %s failed: %v", dojoID, uid, err)
+				continue
+			}
+			res.EmailQueued++
+		}
+	}
+	return nil
+}
+
+func (s *Service) notify(ctx context.Context, dojoID, uid, body string, now time.Time) error {
+	_, _, err := s.fs.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title":     "Happy birthday!",
+		"body":      body,
+		"type":      "birthday",
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": now,
+	})
+	return err
+}
+
+func greetingTitle(dojoName string) string {
+	if dojoName == "" {
+		return "Happy birthday!"
+	}
+	return "Happy birthday from " + dojoName + "!"
+}
+
+// greetingText fills {name} and {dojo} into the dojo's message
+func greetingText(message, name, dojoName string) string {
+	if message == "" {
+		message = DefaultMessage
+	}
+	if name == "" {
+		name = "friend"
+	}
+	if dojoName == "" {
+		dojoName = "the dojo"
+	}
+	return strings.NewReplacer("{name}", name, "{dojo}", dojoName).Replace(message)
+}
+
+func isLeap(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
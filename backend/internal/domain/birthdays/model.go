@@ -0,0 +1,74 @@
+package birthdays
+
+import (
+	"strings"
+	"time"
+)
+
+// Birthday is a member with a birthday in the listed month
+type Birthday struct {
+	MemberUID   string `json:"memberUid"`
+	DisplayName string `json:"displayName"`
+	PhotoURL    string `json:"photoURL,omitempty"`
+	BeltRank    string `json:"beltRank,omitempty"`
+	DateOfBirth string `json:"dateOfBirth"` // YYYY-MM-DD
+	Day         int    `json:"day"`
+	Turning     int    `json:"turning"` // age reached this year
+}
+
+// List is the birthdays of one month, in day order
+type List struct {
+	DojoID    string     `json:"dojoId"`
+	Year      int        `json:"year"`
+	Month     int        `json:"month"`
+	Birthdays []Birthday `json:"birthdays"`
+}
+
+// Settings is dojos/{dojoId}/settings/birthdays. Greetings are off until
+// the dojo turns them on.
+type Settings struct {
+	Enabled bool `firestore:"enabled" json:"enabled"`
+	// Email also queues the greeting to the member's email address
+	Email bool `firestore:"email" json:"email"`
+	// Message is the greeting body; {name} and {dojo} are filled in
+	Message   string    `firestore:"message,omitempty" json:"message,omitempty"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// DefaultMessage is the greeting used when the dojo has not written one
+const DefaultMessage = "Happy birthday, {name}! Everyone at {dojo} wishes you a great year on the mats."
+
+// UpdateSettingsInput updates the greeting settings (nil fields are left unchanged)
+type UpdateSettingsInput struct {
+	Enabled *bool   `json:"enabled,omitempty"`
+	Email   *bool   `json:"email,omitempty"`
+	Message *string `json:"message,omitempty"` // "" restores the default
+}
+
+func (in *UpdateSettingsInput) Trim() {
+	if in.Message != nil {
+		*in.Message = strings.TrimSpace(*in.Message)
+	}
+}
+
+// greeting is a birthdayGreetings/{year}_{uid} document under the dojo,
+// created once per member and year so overlapping runs never greet twice
+type greeting struct {
+	MemberUID string    `firestore:"memberUid"`
+	Year      int       `firestore:"year"`
+	Email     bool      `firestore:"email"`
+	SentAt    time.Time `firestore:"sentAt"`
+}
+
+// SendResult summarizes a scheduler run
+type SendResult struct {
+	Date         string `json:"date"` // YYYY-MM-DD
+	DojosChecked int    `json:"dojosChecked"`
+	DojosEnabled int    `json:"dojosEnabled"`
+	Greeted      int    `json:"greeted"`
+	EmailQueued  int    `json:"emailQueued"`
+	Skipped      int    `json:"skipped"` // already greeted or not an active member
+	Failed       int    `json:"failed"`
+	Partial      bool   `json:"partial"` // the deadline hit first; run again to finish
+}
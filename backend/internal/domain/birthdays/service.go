@@ -0,0 +1,145 @@
+package birthdays
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/fsdoc"
+)
+
+// maxMessageLength bounds the dojo's greeting text
+const maxMessageLength = 500
+
+// Birthdays are read from the dateOfBirth, birthMonth and birthDay copies on
+// member docs (see members/usersync.go), kept in step with the profile.
+type Service struct {
+	fs       *firestore.Client
+	dojoRepo *dojo.Repo
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo}
+}
+
+func (s *Service) membersCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("members")
+}
+
+func (s *Service) settingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("birthdays")
+}
+
+// List returns the members with a birthday in month (1-12, default the
+// current one). Staff only; the router checks members.view.
+func (s *Service) List(ctx context.Context, dojoID string, month int, now time.Time) (*List, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if month == 0 {
+		month = int(now.Month())
+	}
+	if month < 1 || month > 12 {
+		return nil, fmt.Errorf("%w: month must be 1-12", ErrBadRequest)
+	}
+
+	docs, err := s.membersCol(dojoID).Where("birthMonth", "==", month).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list birthdays: %w", err)
+	}
+	out := &List{DojoID: dojoID, Year: now.Year(), Month: month, Birthdays: []Birthday{}}
+	for _, doc := range docs {
+		var m fsdoc.Member
+		if err := fsdoc.Decode(doc, &m); err != nil || !isCurrent(m) {
+			continue
+		}
+		born, err := time.Parse("2006-01-02", m.DateOfBirth)
+		if err != nil {
+			continue
+		}
+		out.Birthdays = append(out.Birthdays, Birthday{
+			MemberUID:   doc.Ref.ID,
+			DisplayName: m.DisplayName,
+			PhotoURL:    m.PhotoURL,
+			BeltRank:    m.BeltRank,
+			DateOfBirth: m.DateOfBirth,
+			Day:         born.Day(),
+			Turning:     now.Year() - born.Year(),
+		})
+	}
+	sort.Slice(out.Birthdays, func(i, j int) bool {
+		a, b := out.Birthdays[i], out.Birthdays[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		return strings.ToLower(a.DisplayName) < strings.ToLower(b.DisplayName)
+	})
+	return out, nil
+}
+
+// isCurrent leaves out members who are not (or not yet) training
+func isCurrent(m fsdoc.Member) bool {
+	return m.Status != members.StatusPending && m.Status != members.StatusInactive
+}
+
+// GetSettings returns the dojo's greeting settings (defaults when unset)
+func (s *Service) GetSettings(ctx context.Context, dojoID string) (*Settings, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.settingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load birthday settings: %w", err)
+	}
+	st := &Settings{}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode birthday settings: %w", err)
+		}
+	}
+	if st.Message == "" {
+		st.Message = DefaultMessage
+	}
+	return st, nil
+}
+
+// UpdateSettings turns greetings on or off and sets their text. The router
+// checks settings permission.
+func (s *Service) UpdateSettings(ctx context.Context, staffUID, dojoID string, in UpdateSettingsInput) (*Settings, error) {
+	in.Trim()
+	st, err := s.GetSettings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Enabled != nil {
+		st.Enabled = *in.Enabled
+	}
+	if in.Email != nil {
+		st.Email = *in.Email
+	}
+	if in.Message != nil {
+		if len(*in.Message) > maxMessageLength {
+			return nil, fmt.Errorf("%w: message must be at most %d characters", ErrBadRequest, maxMessageLength)
+		}
+		st.Message = *in.Message
+	}
+	if st.Message == DefaultMessage {
+		st.Message = ""
+	}
+	st.UpdatedAt = time.Now().UTC()
+	st.UpdatedBy = staffUID
+	if _, err := s.settingsRef(dojoID).Set(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save birthday settings: %w", err)
+	}
+	if st.Message == "" {
+		st.Message = DefaultMessage
+	}
+	return st, nil
+}
@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"strings"
+	"time"
+)
+
+// Message is dojos/{dojoId}/chat/{messageId}. Each dojo has one channel.
+type Message struct {
+	ID        string    `firestore:"-" json:"id"`
+	UID       string    `firestore:"uid" json:"uid"`
+	Text      string    `firestore:"text" json:"text"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+}
+
+// SendMessageInput is the body of a new message
+type SendMessageInput struct {
+	Text string `json:"text"`
+}
+
+func (in *SendMessageInput) Trim() {
+	in.Text = strings.TrimSpace(in.Text)
+}
+
+// HistoryInput pages a channel's history
+type HistoryInput struct {
+	Before *time.Time // cursor: messages strictly older than this
+	Limit  int
+}
+
+// History is one page of messages, newest first
+type History struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"nextCursor,omitempty"` // RFC3339Nano, pass back as ?before=
+}
+
+// ReadState is users/{uid}/chatReads/{dojoId}
+type ReadState struct {
+	DojoID     string    `firestore:"dojoId" json:"dojoId"`
+	LastReadAt time.Time `firestore:"lastReadAt" json:"lastReadAt"`
+}
+
+// ChannelSummary is the unread state of one channel
+type ChannelSummary struct {
+	DojoID        string     `json:"dojoId"`
+	DojoName      string     `json:"dojoName,omitempty"`
+	Unread        int        `json:"unread"`
+	UnreadCapped  bool       `json:"unreadCapped,omitempty"` // more than Unread
+	LastReadAt    *time.Time `json:"lastReadAt,omitempty"`
+	LastMessageAt *time.Time `json:"lastMessageAt,omitempty"`
+}
+
+// Summary is GET /v1/me/chat/summary, for app badges
+type Summary struct {
+	Channels    []ChannelSummary `json:"channels"`
+	TotalUnread int              `json:"totalUnread"`
+}
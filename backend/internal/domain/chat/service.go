@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+const (
+	maxMessageLength = 2000
+	maxUnreadCount   = 99 // badges show "99+" beyond this
+	maxChannels      = 100
+)
+
+type Service struct {
+	fs       *firestore.Client
+	dojoRepo *dojo.Repo
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo}
+}
+
+func (s *Service) chatCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("chat")
+}
+
+func (s *Service) readRef(uid, dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("users").Doc(uid).Collection("chatReads").Doc(dojoID)
+}
+
+// requireMember allows the dojo's members and staff
+func (s *Service) requireMember(ctx context.Context, dojoID, uid string) error {
+	if dojoID == "" || uid == "" {
+		return fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err == nil {
+		return nil
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: only members can use the dojo chat", ErrUnauthorized)
+	}
+	return nil
+}
+
+// Send posts a message. Posting marks the channel read for the sender, so
+// their own messages never count as unread.
+func (s *Service) Send(ctx context.Context, uid, dojoID string, in SendMessageInput) (*Message, error) {
+	in.Trim()
+	if in.Text == "" {
+		return nil, fmt.Errorf("%w: text is required", ErrBadRequest)
+	}
+	if utf8.RuneCountInString(in.Text) > maxMessageLength {
+		return nil, fmt.Errorf("%w: text is limited to %d characters", ErrBadRequest, maxMessageLength)
+	}
+	if err := s.requireMember(ctx, dojoID, uid); err != nil {
+		return nil, err
+	}
+
+	m := Message{UID: uid, Text: in.Text, CreatedAt: time.Now().UTC()}
+	ref := s.chatCol(dojoID).NewDoc()
+	batch := s.fs.Batch()
+	batch.Create(ref, m)
+	batch.Set(s.readRef(uid, dojoID), ReadState{DojoID: dojoID, LastReadAt: m.CreatedAt})
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	m.ID = ref.ID
+	return &m, nil
+}
+
+// History returns a page of the channel, newest first
+func (s *Service) History(ctx context.Context, uid, dojoID string, in HistoryInput) (*History, error) {
+	if err := s.requireMember(ctx, dojoID, uid); err != nil {
+		return nil, err
+	}
+	if in.Limit <= 0 || in.Limit > 100 {
+		in.Limit = 50
+	}
+
+	q := s.chatCol(dojoID).OrderBy("createdAt", firestore.Desc)
+	if in.Before != nil {
+		q = q.Where("createdAt", "<", *in.Before)
+	}
+	iter := q.Limit(in.Limit + 1).Documents(ctx)
+	defer iter.Stop()
+
+	out := &History{Messages: []Message{}}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list messages: %w", err)
+		}
+		var m Message
+		if err := doc.DataTo(&m); err != nil {
+			continue
+		}
+		m.ID = doc.Ref.ID
+		if len(out.Messages) == in.Limit {
+			out.NextCursor = out.Messages[len(out.Messages)-1].CreatedAt.Format(time.RFC3339Nano)
+			break
+		}
+		out.Messages = append(out.Messages, m)
+	}
+	return out, nil
+}
+
+// MarkRead moves the caller's read marker forward to at (default now)
+func (s *Service) MarkRead(ctx context.Context, uid, dojoID string, at *time.Time) (*ReadState, error) {
+	if err := s.requireMember(ctx, dojoID, uid); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	readAt := now
+	if at != nil && at.Before(now) {
+		readAt = at.UTC()
+	}
+
+	ref := s.readRef(uid, dojoID)
+	out := ReadState{DojoID: dojoID, LastReadAt: readAt}
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return err
+		}
+		if doc.Exists() {
+			var prev ReadState
+			if err := doc.DataTo(&prev); err == nil && !prev.LastReadAt.Before(readAt) {
+				out = prev // never move the marker back
+				return nil
+			}
+		}
+		return tx.Set(ref, out)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark chat read: %w", err)
+	}
+	return &out, nil
+}
+
+// Summary counts unread messages in every dojo the user belongs to
+func (s *Service) Summary(ctx context.Context, uid string) (*Summary, error) {
+	if strings.TrimSpace(uid) == "" {
+		return nil, ErrUnauthorized
+	}
+
+	memberships, err := s.fs.Collection("users").Doc(uid).Collection("dojoMemberships").
+		Limit(maxChannels).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	reads, err := s.fs.Collection("users").Doc(uid).Collection("chatReads").
+		Limit(maxChannels).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat reads: %w", err)
+	}
+	lastRead := map[string]time.Time{}
+	for _, doc := range reads {
+		var rs ReadState
+		if err := doc.DataTo(&rs); err == nil {
+			lastRead[doc.Ref.ID] = rs.LastReadAt
+		}
+	}
+
+	out := &Summary{Channels: []ChannelSummary{}}
+	for _, doc := range memberships {
+		data := doc.Data()
+		if status, _ := data["status"].(string); status != "" && status != "active" && status != "approved" {
+			continue
+		}
+		cs := ChannelSummary{DojoID: doc.Ref.ID}
+		cs.DojoName, _ = data["dojoName"].(string)
+
+		q := s.chatCol(cs.DojoID).OrderBy("createdAt", firestore.Desc)
+		if t, ok := lastRead[cs.DojoID]; ok {
+			cs.LastReadAt = &t
+			q = q.Where("createdAt", ">", t)
+		}
+		// only createdAt is needed to count and date the channel
+		unread, err := q.Select("createdAt").Limit(maxUnreadCount + 1).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to count unread messages for dojo %s: %w", cs.DojoID, err)
+		}
+		cs.Unread = len(unread)
+		if cs.Unread > maxUnreadCount {
+			cs.Unread = maxUnreadCount
+			cs.UnreadCapped = true
+		}
+		if len(unread) > 0 {
+			if t, ok := unread[0].Data()["createdAt"].(time.Time); ok {
+				cs.LastMessageAt = &t
+			}
+		}
+		out.TotalUnread += cs.Unread
+		out.Channels = append(out.Channels, cs)
+	}
+	return out, nil
+}
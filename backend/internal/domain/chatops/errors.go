@@ -0,0 +1,21 @@
+package chatops
+
+import "errors"
+
+var (
+	ErrBadRequest    = errors.New("bad request")
+	ErrNotConfigured = errors.New("chat webhook not configured")
+	ErrDelivery      = errors.New("chat webhook delivery failed")
+)
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrNotConfigured(err error) bool {
+	return errors.Is(err, ErrNotConfigured)
+}
+
+func IsErrDelivery(err error) bool {
+	return errors.Is(err, ErrDelivery)
+}
@@ -0,0 +1,107 @@
+package chatops
+
+import (
+	"strings"
+	"time"
+)
+
+// Providers, detected from the webhook URL
+const (
+	ProviderSlack   = "slack"
+	ProviderDiscord = "discord"
+)
+
+// Events a dojo can select
+const (
+	EventJoinRequest    = "join_request"     // someone asked to join the dojo
+	EventBigClass       = "big_class"        // a class reached the headcount threshold
+	EventAtRiskCritical = "at_risk_critical" // members crossed the critical retention level
+	EventPaymentFailed  = "payment_failed"   // the dojo's plan payment failed
+)
+
+// Events lists every selectable event
+var Events = []string{EventJoinRequest, EventBigClass, EventAtRiskCritical, EventPaymentFailed}
+
+// DefaultHeadcountThreshold is the big-class headcount when the dojo has not set one
+const DefaultHeadcountThreshold = 20
+
+// Settings is dojos/{dojoId}/settings/chatops (server-only). The webhook URL
+// and signing secret are credentials and never leave the server; see View.
+type Settings struct {
+	Enabled    bool   `firestore:"enabled"`
+	WebhookURL string `firestore:"webhookUrl,omitempty"`
+	Provider   string `firestore:"provider,omitempty"`
+	// SigningSecret signs each post (X-Dojo-Signature) for relays that verify it
+	SigningSecret      string    `firestore:"signingSecret,omitempty"`
+	Events             []string  `firestore:"events"`
+	HeadcountThreshold int       `firestore:"headcountThreshold,omitempty"`
+	UpdatedAt          time.Time `firestore:"updatedAt"`
+	UpdatedBy          string    `firestore:"updatedBy,omitempty"`
+}
+
+// wants reports whether the dojo posts event
+func (st *Settings) wants(event string) bool {
+	if !st.Enabled || st.WebhookURL == "" {
+		return false
+	}
+	for _, e := range st.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// View is the settings as returned to staff, with the credentials masked
+type View struct {
+	Enabled            bool      `json:"enabled"`
+	WebhookURL         string    `json:"webhookUrl,omitempty"` // masked
+	Provider           string    `json:"provider,omitempty"`
+	HasSigningSecret   bool      `json:"hasSigningSecret"`
+	Events             []string  `json:"events"`
+	HeadcountThreshold int       `json:"headcountThreshold"`
+	AvailableEvents    []string  `json:"availableEvents"`
+	UpdatedAt          time.Time `json:"updatedAt,omitempty"`
+	UpdatedBy          string    `json:"updatedBy,omitempty"`
+}
+
+// UpdateSettingsInput updates the chat webhook (nil fields are left unchanged)
+type UpdateSettingsInput struct {
+	Enabled            *bool     `json:"enabled,omitempty"`
+	WebhookURL         *string   `json:"webhookUrl,omitempty"`    // "" removes the webhook
+	SigningSecret      *string   `json:"signingSecret,omitempty"` // "" stops signing
+	Events             *[]string `json:"events,omitempty"`
+	HeadcountThreshold *int      `json:"headcountThreshold,omitempty"`
+}
+
+func (in *UpdateSettingsInput) Trim() {
+	if in.WebhookURL != nil {
+		*in.WebhookURL = strings.TrimSpace(*in.WebhookURL)
+	}
+	if in.SigningSecret != nil {
+		*in.SigningSecret = strings.TrimSpace(*in.SigningSecret)
+	}
+	if in.Events != nil {
+		events := make([]string, 0, len(*in.Events))
+		for _, e := range *in.Events {
+			if e = strings.TrimSpace(e); e != "" {
+				events = append(events, e)
+			}
+		}
+		*in.Events = events
+	}
+}
+
+// Message is a chat post: a bold title and plain lines under it
+type Message struct {
+	Title string
+	Lines []string
+}
+
+// sent is a chatopsSent/{event}_{key} document under the dojo, created
+// before posting so an occurrence is announced once
+type sent struct {
+	Event  string    `firestore:"event"`
+	Key    string    `firestore:"key"`
+	SentAt time.Time `firestore:"sentAt"`
+}
@@ -0,0 +1,376 @@
+package chatops
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	deliveryTimeout       = 10 * time.Second
+	maxHeadcountThreshold = 1000
+	maxSigningSecret      = 256
+	maxPostLength         = 2000 // Discord's content limit; Slack allows more
+)
+
+// Service posts dojo events to a Slack or Discord incoming webhook. It only
+// depends on Firestore; most posts come from the event bus (see package
+// subscribers). The router checks settings permission.
+type Service struct {
+	fs     *firestore.Client
+	client *http.Client
+}
+
+func NewService(fs *firestore.Client) *Service {
+	return &Service{fs: fs, client: &http.Client{Timeout: deliveryTimeout}}
+}
+
+func (s *Service) settingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("chatops")
+}
+
+func (s *Service) settings(ctx context.Context, dojoID string) (*Settings, error) {
+	doc, err := s.settingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load chat webhook settings: %w", err)
+	}
+	st := &Settings{}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode chat webhook settings: %w", err)
+		}
+	}
+	if st.HeadcountThreshold <= 0 {
+		st.HeadcountThreshold = DefaultHeadcountThreshold
+	}
+	return st, nil
+}
+
+// GetSettings returns the dojo's chat webhook settings with credentials masked
+func (s *Service) GetSettings(ctx context.Context, dojoID string) (*View, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return st.view(), nil
+}
+
+// UpdateSettings configures the webhook URL, signing secret and events
+func (s *Service) UpdateSettings(ctx context.Context, staffUID, dojoID string, in UpdateSettingsInput) (*View, error) {
+	in.Trim()
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.WebhookURL != nil {
+		if *in.WebhookURL == "" {
+			st.WebhookURL, st.Provider, st.Enabled = "", "", false
+		} else {
+			provider, err := providerOf(*in.WebhookURL)
+			if err != nil {
+				return nil, err
+			}
+			st.WebhookURL, st.Provider = *in.WebhookURL, provider
+		}
+	}
+	if in.SigningSecret != nil {
+		if len(*in.SigningSecret) > maxSigningSecret {
+			return nil, fmt.Errorf("%w: signingSecret must be at most %d characters", ErrBadRequest, maxSigningSecret)
+		}
+		st.SigningSecret = *in.SigningSecret
+	}
+	if in.Events != nil {
+		for _, e := range *in.Events {
+			if !slices.Contains(Events, e) {
+				return nil, fmt.Errorf("%w: unknown event %q", ErrBadRequest, e)
+			}
+		}
+		st.Events = slices.Compact(slices.Sorted(slices.Values(*in.Events)))
+	}
+	if in.HeadcountThreshold != nil {
+		if *in.HeadcountThreshold < 1 || *in.HeadcountThreshold > maxHeadcountThreshold {
+			return nil, fmt.Errorf("%w: headcountThreshold must be 1-%d", ErrBadRequest, maxHeadcountThreshold)
+		}
+		st.HeadcountThreshold = *in.HeadcountThreshold
+	}
+	if in.Enabled != nil {
+		st.Enabled = *in.Enabled
+	}
+	if st.Enabled && st.WebhookURL == "" {
+		return nil, fmt.Errorf("%w: webhookUrl is required to enable the integration", ErrBadRequest)
+	}
+	if st.Events == nil {
+		st.Events = []string{}
+	}
+
+	st.UpdatedAt = time.Now().UTC()
+	st.UpdatedBy = staffUID
+	if _, err := s.settingsRef(dojoID).Set(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save chat webhook settings: %w", err)
+	}
+	return st.view(), nil
+}
+
+// TestSend posts a test message and waits for the webhook's answer, whether
+// or not the integration is enabled
+func (s *Service) TestSend(ctx context.Context, staffUID, dojoID string) error {
+	if strings.TrimSpace(dojoID) == "" {
+		return fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	if st.WebhookURL == "" {
+		return ErrNotConfigured
+	}
+	events := "none"
+	if len(st.Events) > 0 {
+		events = strings.Join(st.Events, ", ")
+	}
+	return s.post(ctx, dojoID, st, Message{
+		Title: "Test message",
+		Lines: []string{"Chat notifications are connected.", "Selected events: " + events},
+	})
+}
+
+// Wants reports whether the dojo posts event; callers use it to skip work
+// (counting, scanning) that only feeds the webhook
+func (s *Service) Wants(ctx context.Context, dojoID, event string) bool {
+	if s == nil {
+		return false
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		log.Printf("chatops: dojo %s: %v", dojoID, err)
+		return false
+	}
+	return st.wants(event)
+}
+
+// HeadcountThreshold is the big-class headcount, 0 when the dojo does not
+// post EventBigClass
+func (s *Service) HeadcountThreshold(ctx context.Context, dojoID string) int {
+	if s == nil {
+		return 0
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil || !st.wants(EventBigClass) {
+		return 0
+	}
+	return st.HeadcountThreshold
+}
+
+// Notify posts msg if the dojo selected event. Delivery happens in the
+// background and is best-effort: failures are logged, never returned.
+func (s *Service) Notify(ctx context.Context, dojoID, event string, msg Message) {
+	s.notify(ctx, dojoID, event, "", msg)
+}
+
+// NotifyOnce is Notify for an occurrence identified by key (an instance id,
+// an invoice id): the first caller claims it and later ones are dropped
+func (s *Service) NotifyOnce(ctx context.Context, dojoID, event, key string, msg Message) {
+	s.notify(ctx, dojoID, event, key, msg)
+}
+
+func (s *Service) notify(ctx context.Context, dojoID, event, key string, msg Message) {
+	if s == nil || dojoID == "" {
+		return
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		log.Printf("chatops: dojo %s: %v", dojoID, err)
+		return
+	}
+	if !st.wants(event) {
+		return
+	}
+	if key != "" && !s.Claim(ctx, dojoID, event, key) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deliveryTimeout)
+	go func() {
+		defer cancel()
+		if err := s.post(ctx, dojoID, st, msg); err != nil {
+			log.Printf("chatops: dojo %s: %s: %v", dojoID, event, err)
+			if key != "" {
+				s.Release(ctx, dojoID, event, key)
+			}
+		}
+	}()
+}
+
+// Send posts msg and waits for the webhook's answer, for jobs that batch
+// several claimed occurrences into one post. ErrNotConfigured when the dojo
+// does not post event.
+func (s *Service) Send(ctx context.Context, dojoID, event string, msg Message) error {
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	if !st.wants(event) {
+		return ErrNotConfigured
+	}
+	return s.post(ctx, dojoID, st, msg)
+}
+
+func (s *Service) sentRef(dojoID, event, key string) *firestore.DocumentRef {
+	id := event + "_" + strings.ReplaceAll(key, "/", "_")
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("chatopsSent").Doc(id)
+}
+
+// Claim marks the occurrence key of event as announced, false if it already
+// was (or the claim failed; either way do not post)
+func (s *Service) Claim(ctx context.Context, dojoID, event, key string) bool {
+	_, err := s.sentRef(dojoID, event, key).Create(ctx, sent{Event: event, Key: key, SentAt: time.Now().UTC()})
+	return err == nil
+}
+
+// Release drops a claim whose post failed so the next run retries it
+func (s *Service) Release(ctx context.Context, dojoID, event, key string) {
+	if _, err := s.sentRef(dojoID, event, key).Delete(ctx); err != nil {
+		log.Printf("chatops: dojo %s: failed to release %s claim %s: %v", dojoID, event, key, err)
+	}
+}
+
+// post formats msg for the provider, signs it and delivers it
+func (s *Service) post(ctx context.Context, dojoID string, st *Settings, msg Message) error {
+	if name := s.dojoName(ctx, dojoID); name != "" {
+		msg.Title = name + ": " + msg.Title
+	}
+	body, err := json.Marshal(payload(st.Provider, msg))
+	if err != nil {
+		return fmt.Errorf("failed to encode chat message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, st.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDelivery, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if st.SigningSecret != "" {
+		req.Header.Set("X-Dojo-Signature", sign(st.SigningSecret, time.Now().Unix(), body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDelivery, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s answered %d %s", ErrDelivery, st.Provider, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (s *Service) dojoName(ctx context.Context, dojoID string) string {
+	doc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		return ""
+	}
+	name, _ := doc.Data()["name"].(string)
+	return name
+}
+
+// payload renders msg in the provider's markdown flavour
+func payload(provider string, msg Message) map[string]string {
+	bold := "*"
+	if provider == ProviderDiscord {
+		bold = "**"
+	}
+	text := bold + msg.Title + bold
+	if len(msg.Lines) > 0 {
+		text += "\n" + strings.Join(msg.Lines, "\n")
+	}
+	if len(text) > maxPostLength {
+		text = strings.ToValidUTF8(text[:maxPostLength-1], "") + "…"
+	}
+	if provider == ProviderDiscord {
+		return map[string]string{"content": text}
+	}
+	return map[string]string{"text": text}
+}
+
+// sign is "t=<unix>,v1=<hex HMAC-SHA256 of "<unix>.<body>">", so a relay can
+// check both the sender and the freshness of a post
+func sign(secret string, ts int64, body []byte) string {
+	t := strconv.FormatInt(ts, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// providerOf accepts only Slack and Discord incoming webhooks over https,
+// which also keeps the server from posting to arbitrary hosts
+func providerOf(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return "", fmt.Errorf("%w: webhookUrl must be an https Slack or Discord webhook URL", ErrBadRequest)
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "hooks.slack.com" && strings.HasPrefix(u.Path, "/services/"):
+		return ProviderSlack, nil
+	case (host == "discord.com" || host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return ProviderDiscord, nil
+	default:
+		return "", fmt.Errorf("%w: webhookUrl must be an https Slack or Discord webhook URL", ErrBadRequest)
+	}
+}
+
+func (st *Settings) view() *View {
+	v := &View{
+		Enabled:            st.Enabled,
+		Provider:           st.Provider,
+		HasSigningSecret:   st.SigningSecret != "",
+		Events:             st.Events,
+		HeadcountThreshold: st.HeadcountThreshold,
+		AvailableEvents:    Events,
+		UpdatedAt:          st.UpdatedAt,
+		UpdatedBy:          st.UpdatedBy,
+	}
+	if v.Events == nil {
+		v.Events = []string{}
+	}
+	if st.WebhookURL != "" {
+		v.WebhookURL = maskURL(st.WebhookURL)
+	}
+	return v
+}
+
+// maskURL keeps the host and the last characters: the path is the credential
+func maskURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "…"
+	}
+	tail := u.Path
+	if len(tail) > 4 {
+		tail = tail[len(tail)-4:]
+	}
+	return u.Scheme + "://" + u.Host + "/…" + tail
+}
@@ -0,0 +1,29 @@
+package claims
+
+// Custom claim keys written by the sync. Other claims (admin, role, roles,
+// staff from the set-claims CLI) are left as they are.
+const (
+	ClaimDojoRoles          = "dojoRoles"          // dojoId -> staff role
+	ClaimDojoRolesTruncated = "dojoRolesTruncated" // set when not every dojo fit
+	ClaimUpdatedAt          = "claimsUpdatedAt"    // unix seconds
+)
+
+// SyncResult is a user's dojo roles after a sync
+type SyncResult struct {
+	UID       string            `json:"uid"`
+	DojoRoles map[string]string `json:"dojoRoles"`
+	// Changed means the claims were rewritten; the user's app must refresh
+	// its ID token to see them
+	Changed   bool `json:"changed"`
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// BackfillResult summarizes one page of a backfill
+type BackfillResult struct {
+	Checked int `json:"checked"`
+	Changed int `json:"changed"`
+	Failed  int `json:"failed"`
+	// NextCursor is the after= of the next page, empty when done
+	NextCursor string `json:"nextCursor,omitempty"`
+	Partial    bool   `json:"partial,omitempty"`
+}
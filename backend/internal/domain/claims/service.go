@@ -0,0 +1,247 @@
+package claims
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+const (
+	// maxClaimsBytes is Firebase's limit on a user's custom claims JSON
+	maxClaimsBytes = 1000
+	// maxCandidateDojos caps the dojos one sync looks at
+	maxCandidateDojos = 100
+
+	defaultBackfillLimit = 200
+	maxBackfillLimit     = 500
+)
+
+// Service keeps each user's Firebase custom claims in line with their roles
+// in dojos (claims.dojoRoles), so clients and security rules reading the ID
+// token see the same staff roles the API resolves from Firestore. Only staff
+// roles are kept: members without one are students, and the claim has to
+// stay under Firebase's 1000 byte limit.
+type Service struct {
+	fs         *firestore.Client
+	authClient *auth.Client
+	dojoRepo   *dojo.Repo
+}
+
+func NewService(fs *firestore.Client, authClient *auth.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, authClient: authClient, dojoRepo: dojoRepo}
+}
+
+// SyncUser recomputes uid's dojo roles and rewrites the claims if they
+// differ. The dojos looked at are those in the user's membership index, those
+// listing them as staff or owner, and those already in their claims (so a
+// demotion or removal drops the entry).
+func (s *Service) SyncUser(ctx context.Context, uid string) (*SyncResult, error) {
+	uid = strings.TrimSpace(uid)
+	if uid == "" {
+		return nil, fmt.Errorf("%w: uid is required", ErrBadRequest)
+	}
+	u, err := s.authClient.GetUser(ctx, uid)
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return nil, fmt.Errorf("%w: user not found", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	current := map[string]string{}
+	if m, ok := u.CustomClaims[ClaimDojoRoles].(map[string]interface{}); ok {
+		for dojoID, v := range m {
+			if role, ok := v.(string); ok {
+				current[dojoID] = role
+			}
+		}
+	}
+
+	candidates, err := s.candidateDojos(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	for dojoID := range current {
+		candidates[dojoID] = true
+	}
+
+	roles := map[string]string{}
+	for dojoID := range candidates {
+		role, err := s.dojoRepo.RoleOf(ctx, dojoID, uid)
+		if err != nil {
+			if dojo.IsErrNotFound(err) {
+				continue // deleted dojo
+			}
+			return nil, fmt.Errorf("failed to resolve role in dojo %s: %w", dojoID, err)
+		}
+		if _, staff := dojo.DefaultRolePermissions[role]; staff {
+			roles[dojoID] = role
+		}
+	}
+
+	claims := map[string]interface{}{}
+	maps.Copy(claims, u.CustomClaims)
+	truncated := fitRoles(claims, roles)
+	res := &SyncResult{UID: uid, DojoRoles: roles, Truncated: truncated}
+
+	wasTruncated, _ := u.CustomClaims[ClaimDojoRolesTruncated].(bool)
+	if maps.Equal(current, roles) && wasTruncated == truncated {
+		return res, nil
+	}
+	claims[ClaimUpdatedAt] = time.Now().Unix()
+	if err := s.authClient.SetCustomUserClaims(ctx, uid, claims); err != nil {
+		return nil, fmt.Errorf("failed to set claims: %w", err)
+	}
+	res.Changed = true
+
+	// apps listen to their user doc to know when to refresh the ID token
+	if _, err := s.fs.Collection("users").Doc(uid).Set(ctx, map[string]interface{}{
+		ClaimUpdatedAt: time.Now().UTC(),
+	}, firestore.MergeAll); err != nil {
+		log.Printf("claims: failed to flag refresh for %s: %v", uid, err)
+	}
+	return res, nil
+}
+
+// candidateDojos are the dojos uid may hold a role in
+func (s *Service) candidateDojos(ctx context.Context, uid string) (map[string]bool, error) {
+	out := map[string]bool{}
+
+	index, err := s.fs.Collection("users").Doc(uid).Collection("dojoMemberships").
+		Limit(maxCandidateDojos).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	for _, doc := range index {
+		dojoID, _ := doc.Data()["dojoId"].(string)
+		if dojoID == "" {
+			dojoID = doc.Ref.ID
+		}
+		out[dojoID] = true
+	}
+
+	dojos := s.fs.Collection("dojos")
+	for _, q := range []firestore.Query{
+		dojos.Where("staffUids", "array-contains", uid),
+		dojos.Where("ownerIds", "array-contains", uid),
+		dojos.Where("ownerUid", "==", uid),
+	} {
+		docs, err := q.Select().Limit(maxCandidateDojos).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list staffed dojos: %w", err)
+		}
+		for _, doc := range docs {
+			out[doc.Ref.ID] = true
+		}
+	}
+	return out, nil
+}
+
+// fitRoles puts roles into claims, leaving out dojos (non-owner roles first)
+// until the claims fit Firebase's limit. It reports whether any were left out.
+func fitRoles(claims map[string]interface{}, roles map[string]string) bool {
+	ids := make([]string, 0, len(roles))
+	for id := range roles {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if oi, oj := roles[ids[i]] == "owner", roles[ids[j]] == "owner"; oi != oj {
+			return oi
+		}
+		return ids[i] < ids[j]
+	})
+
+	delete(claims, ClaimDojoRolesTruncated)
+	claims[ClaimUpdatedAt] = time.Now().Unix() // counted at its full size
+	for n := len(ids); n >= 0; n-- {
+		kept := make(map[string]string, n)
+		for _, id := range ids[:n] {
+			kept[id] = roles[id]
+		}
+		if len(kept) > 0 {
+			claims[ClaimDojoRoles] = kept
+		} else {
+			delete(claims, ClaimDojoRoles)
+		}
+		if n < len(ids) {
+			claims[ClaimDojoRolesTruncated] = true
+		}
+		if b, err := json.Marshal(claims); err == nil && len(b) <= maxClaimsBytes {
+			if n < len(ids) {
+				for _, id := range ids[n:] {
+					delete(roles, id)
+				}
+				return true
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// Backfill syncs a page of users in uid order after the cursor (admin). Run
+// it again with NextCursor until that comes back empty.
+func (s *Service) Backfill(ctx context.Context, after string, limit int) (*BackfillResult, error) {
+	if limit <= 0 {
+		limit = defaultBackfillLimit
+	}
+	if limit > maxBackfillLimit {
+		limit = maxBackfillLimit
+	}
+
+	users := s.fs.Collection("users")
+	q := users.OrderBy(firestore.DocumentID, firestore.Asc).Select().Limit(limit)
+	if after != "" {
+		q = q.Where(firestore.DocumentID, ">", users.Doc(after))
+	}
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	res := &BackfillResult{}
+	last := ""
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		out, err := s.SyncUser(ctx, doc.Ref.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			if !IsErrNotFound(err) { // profiles without an account are skipped
+				res.Failed++
+				log.Printf("claims: backfill %s: %v", doc.Ref.ID, err)
+			}
+		} else if out.Changed {
+			res.Changed++
+		}
+		res.Checked++
+		last = doc.Ref.ID
+	}
+
+	if res.Partial || res.Checked == limit {
+		res.NextCursor = last
+	}
+	log.Printf("claims: backfill checked %d users, %d changed, %d failed (partial=%v)", res.Checked, res.Changed, res.Failed, res.Partial)
+	return res, nil
+}
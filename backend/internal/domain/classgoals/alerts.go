@@ -0,0 +1,148 @@
+package classgoals
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+var weekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// CheckAll runs the weekly goal check for every dojo and notifies staff of
+// classes that keep missing their goal. Meant to be triggered weekly by
+// Cloud Scheduler; each dojo is alerted at most once per ISO week.
+func (s *Service) CheckAll(ctx context.Context, now time.Time) (*CheckResult, error) {
+	res := &CheckResult{}
+	year, wk := now.ISOWeek()
+	week := fmt.Sprintf("%d-W%02d", year, wk)
+
+	iter := s.fs.Collection("dojos").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		dojoID := doc.Ref.ID
+
+		report, err := s.buildReport(ctx, dojoID, defaultWeeks, now)
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			log.Printf("class goals: dojo %s: %v", dojoID, err)
+			continue
+		}
+		res.DojosChecked++
+
+		var flagged []ClassReport
+		for _, c := range report.Classes {
+			if c.UnderAttended {
+				flagged = append(flagged, c)
+			}
+		}
+		if len(flagged) == 0 {
+			continue
+		}
+		res.ClassesFlagged += len(flagged)
+
+		sent, err := s.alert(ctx, dojoID, week, flagged, now)
+		if err != nil {
+			log.Printf("class goals: dojo %s: alert failed: %v", dojoID, err)
+			continue
+		}
+		if sent {
+			res.DojosAlerted++
+		}
+	}
+
+	log.Printf("class goals: %d dojos checked, %d classes flagged, %d dojos alerted (partial=%v)",
+		res.DojosChecked, res.ClassesFlagged, res.DojosAlerted, res.Partial)
+	return res, nil
+}
+
+// alert notifies the dojo's staff, once per week
+func (s *Service) alert(ctx context.Context, dojoID, week string, flagged []ClassReport, now time.Time) (bool, error) {
+	staff, err := s.dojoRepo.ListStaffUIDs(ctx, dojoID)
+	if err != nil {
+		return false, fmt.Errorf("failed to list staff: %w", err)
+	}
+	if len(staff) == 0 {
+		return false, nil
+	}
+
+	sessionIDs := make([]string, 0, len(flagged))
+	for _, c := range flagged {
+		sessionIDs = append(sessionIDs, c.SessionID)
+	}
+
+	ref := s.fs.Collection("dojos").Doc(dojoID).Collection("classGoalAlerts").Doc(week)
+	if _, err := ref.Create(ctx, alertSend{
+		Week:       week,
+		SessionIDs: sessionIDs,
+		Recipients: len(staff),
+		SentAt:     now.UTC(),
+	}); err != nil {
+		// already alerted this week (or the claim failed); either way do not send
+		return false, nil
+	}
+
+	title, body := alertText(flagged)
+	batch := s.fs.Batch()
+	for _, uid := range staff {
+		batch.Create(s.fs.Collection("users").Doc(uid).Collection("notifications").NewDoc(), map[string]interface{}{
+			"title": title,
+			"body":  body,
+			"type":  "class_goal_alert",
+			"data": map[string]interface{}{
+				"sessionIds": sessionIDs,
+				"week":       week,
+			},
+			"read":      false,
+			"dojoId":    dojoID,
+			"createdAt": now.UTC(),
+		})
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		// release the claim so the next run retries
+		_, _ = ref.Delete(ctx)
+		return false, fmt.Errorf("failed to notify staff: %w", err)
+	}
+	return true, nil
+}
+
+func alertText(flagged []ClassReport) (string, string) {
+	title := "A class is missing its attendance goal"
+	if len(flagged) > 1 {
+		title = fmt.Sprintf("%d classes are missing their attendance goals", len(flagged))
+	}
+
+	lines := make([]string, 0, len(flagged))
+	for _, c := range flagged {
+		line := fmt.Sprintf("%s (%s %s) averaged %.1f of %d over %d weeks.",
+			c.Title, weekdayNames[c.DayOfWeek%7], c.StartTime, c.AvgHeadcount, c.Target, len(c.Occurrences))
+		if c.Suggestion != nil {
+			line += fmt.Sprintf(" Consider merging it into %s (%s %s).",
+				c.Suggestion.Title, weekdayNames[c.Suggestion.DayOfWeek%7], c.Suggestion.StartTime)
+		}
+		lines = append(lines, line)
+	}
+	return title, strings.Join(lines, "\n")
+}
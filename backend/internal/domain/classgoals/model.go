@@ -0,0 +1,76 @@
+package classgoals
+
+import "time"
+
+// Report compares each class with an attendance goal against its actual
+// headcounts over the last Weeks weeks
+type Report struct {
+	DojoID  string        `json:"dojoId"`
+	Weeks   int           `json:"weeks"`
+	Since   string        `json:"since"` // YYYY-MM-DD
+	Classes []ClassReport `json:"classes"`
+	// Heatmap is the average headcount per weekday and start hour across all
+	// active classes; consolidation suggestions favour busier slots
+	Heatmap []HeatCell `json:"heatmap"`
+}
+
+// ClassReport is one class with a goal
+type ClassReport struct {
+	SessionID      string  `json:"sessionId"`
+	Title          string  `json:"title"`
+	DayOfWeek      int     `json:"dayOfWeek"`
+	StartTime      string  `json:"startTime"`
+	ClassType      string  `json:"classType,omitempty"`
+	MaxCapacity    int     `json:"maxCapacity,omitempty"`
+	Target         int     `json:"target"`
+	TargetFillRate float64 `json:"targetFillRate,omitempty"`
+
+	Occurrences  []Occurrence `json:"occurrences"`
+	AvgHeadcount float64      `json:"avgHeadcount"`
+	WeeksBelow   int          `json:"weeksBelow"`
+	// UnderAttended is set when the class missed its goal in most weeks
+	UnderAttended bool           `json:"underAttended"`
+	Suggestion    *Consolidation `json:"suggestion,omitempty"`
+}
+
+// Occurrence is the headcount of one past instance of a class
+type Occurrence struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	Headcount int    `json:"headcount"`
+}
+
+// Consolidation suggests merging an under-attended class into another one
+type Consolidation struct {
+	SessionID     string  `json:"sessionId"`
+	Title         string  `json:"title"`
+	DayOfWeek     int     `json:"dayOfWeek"`
+	StartTime     string  `json:"startTime"`
+	AvgHeadcount  float64 `json:"avgHeadcount"`
+	SpareCapacity int     `json:"spareCapacity,omitempty"` // 0 when the class has no capacity set
+	Reason        string  `json:"reason"`
+}
+
+// HeatCell is the average headcount of classes starting in one weekly slot
+type HeatCell struct {
+	DayOfWeek    int     `json:"dayOfWeek"`
+	Hour         int     `json:"hour"`
+	AvgHeadcount float64 `json:"avgHeadcount"`
+	Classes      int     `json:"classes"`
+}
+
+// CheckResult summarizes a weekly job run
+type CheckResult struct {
+	DojosChecked   int  `json:"dojosChecked"`
+	DojosAlerted   int  `json:"dojosAlerted"`
+	ClassesFlagged int  `json:"classesFlagged"`
+	Partial        bool `json:"partial"` // deadline hit; remaining dojos are checked next week
+}
+
+// alertSend is dojos/{dojoId}/classGoalAlerts/{week}, claimed before alerting
+// so a re-run in the same week does not alert twice
+type alertSend struct {
+	Week       string    `firestore:"week"`
+	SessionIDs []string  `firestore:"sessionIds"`
+	Recipients int       `firestore:"recipients"`
+	SentAt     time.Time `firestore:"sentAt"`
+}
@@ -0,0 +1,287 @@
+package classgoals
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	defaultWeeks = 4
+	maxWeeks     = 12
+
+	// a class is under-attended when it missed its goal in at least this
+	// share of its occurrences, and had at least minOccurrences of them
+	underAttendedShare = 0.75
+	minOccurrences     = 3
+)
+
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	sessionSvc    *session.Service
+	attendanceSvc *attendance.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, sessionSvc *session.Service, attendanceSvc *attendance.Service) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, sessionSvc: sessionSvc, attendanceSvc: attendanceSvc}
+}
+
+// GetReport compares the dojo's class goals with actual headcounts over the
+// last weeks (default 4). Staff only; the router checks sessions.write.
+func (s *Service) GetReport(ctx context.Context, dojoID string, weeks int, now time.Time) (*Report, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if weeks == 0 {
+		weeks = defaultWeeks
+	}
+	if weeks < 1 || weeks > maxWeeks {
+		return nil, fmt.Errorf("%w: weeks must be 1-%d", ErrBadRequest, maxWeeks)
+	}
+	return s.buildReport(ctx, dojoID, weeks, now)
+}
+
+// classStats is the headcount history of one class in the window
+type classStats struct {
+	sess        session.Session
+	occurrences []Occurrence
+	avg         float64
+}
+
+func (s *Service) buildReport(ctx context.Context, dojoID string, weeks int, now time.Time) (*Report, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	since := today.AddDate(0, 0, -7*weeks)
+	out := &Report{
+		DojoID:  dojoID,
+		Weeks:   weeks,
+		Since:   since.Format("2006-01-02"),
+		Classes: []ClassReport{},
+		Heatmap: []HeatCell{},
+	}
+
+	sessions, err := s.sessionSvc.List(ctx, dojoID, session.ListSessionsInput{ActiveOnly: true, Limit: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list classes: %w", err)
+	}
+	hasGoals := slices.ContainsFunc(sessions, func(sess session.Session) bool { return sess.Target() > 0 })
+	if !hasGoals {
+		return out, nil
+	}
+
+	counts, err := s.attendanceSvc.CheckinsByInstance(ctx, dojoID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]classStats, 0, len(sessions))
+	for _, sess := range sessions {
+		cs := classStats{sess: sess, occurrences: []Occurrence{}}
+		total := 0
+		for _, date := range occurrences(sess, since, today) {
+			n := counts[instanceid.New(date, sess.ID)]
+			cs.occurrences = append(cs.occurrences, Occurrence{Date: date, Headcount: n})
+			total += n
+		}
+		if len(cs.occurrences) > 0 {
+			cs.avg = round1(float64(total) / float64(len(cs.occurrences)))
+		}
+		stats = append(stats, cs)
+	}
+
+	heat := heatmap(stats)
+	out.Heatmap = heat.cells()
+
+	for _, cs := range stats {
+		target := cs.sess.Target()
+		if target == 0 {
+			continue
+		}
+		cr := ClassReport{
+			SessionID:      cs.sess.ID,
+			Title:          cs.sess.Title,
+			DayOfWeek:      cs.sess.DayOfWeek,
+			StartTime:      cs.sess.StartTime,
+			ClassType:      cs.sess.ClassType,
+			MaxCapacity:    cs.sess.MaxCapacity,
+			Target:         target,
+			TargetFillRate: cs.sess.TargetFillRate,
+			Occurrences:    cs.occurrences,
+			AvgHeadcount:   cs.avg,
+		}
+		for _, o := range cs.occurrences {
+			if o.Headcount < target {
+				cr.WeeksBelow++
+			}
+		}
+		n := len(cs.occurrences)
+		cr.UnderAttended = n >= minOccurrences && float64(cr.WeeksBelow) >= underAttendedShare*float64(n)
+		if cr.UnderAttended {
+			cr.Suggestion = suggest(cs, stats, heat)
+		}
+		out.Classes = append(out.Classes, cr)
+	}
+	return out, nil
+}
+
+// occurrences lists the dates (YYYY-MM-DD) a class took place in [since, today)
+func occurrences(sess session.Session, since, today time.Time) []string {
+	var out []string
+	for day := since; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if int(day.Weekday()) != sess.DayOfWeek {
+			continue
+		}
+		if !sess.CreatedAt.IsZero() && day.Before(sess.CreatedAt.Truncate(24*time.Hour)) {
+			continue
+		}
+		if !sess.RecurrenceEnd.IsZero() && day.After(sess.RecurrenceEnd) {
+			break
+		}
+		date := day.Format("2006-01-02")
+		if slices.Contains(sess.ExcludedDates, date) {
+			continue
+		}
+		out = append(out, date)
+	}
+	return out
+}
+
+// slotHeat is the average headcount per weekday and start hour
+type slotHeat map[[2]int]*HeatCell
+
+func heatmap(stats []classStats) slotHeat {
+	heat := slotHeat{}
+	for _, cs := range stats {
+		if len(cs.occurrences) == 0 {
+			continue
+		}
+		key := [2]int{cs.sess.DayOfWeek, startMinute(cs.sess) / 60}
+		cell := heat[key]
+		if cell == nil {
+			cell = &HeatCell{DayOfWeek: key[0], Hour: key[1]}
+			heat[key] = cell
+		}
+		// running mean of the class averages in the slot
+		cell.AvgHeadcount = round1((cell.AvgHeadcount*float64(cell.Classes) + cs.avg) / float64(cell.Classes+1))
+		cell.Classes++
+	}
+	return heat
+}
+
+func (h slotHeat) at(sess session.Session) float64 {
+	if cell := h[[2]int{sess.DayOfWeek, startMinute(sess) / 60}]; cell != nil {
+		return cell.AvgHeadcount
+	}
+	return 0
+}
+
+func (h slotHeat) cells() []HeatCell {
+	out := make([]HeatCell, 0, len(h))
+	for _, cell := range h {
+		out = append(out, *cell)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DayOfWeek != out[j].DayOfWeek {
+			return out[i].DayOfWeek < out[j].DayOfWeek
+		}
+		return out[i].Hour < out[j].Hour
+	})
+	return out
+}
+
+// suggest picks a class to merge an under-attended one into: a compatible
+// class type with room for its students, preferring the same day at the
+// closest time, then the busiest slot on the heatmap
+func suggest(weak classStats, stats []classStats, heat slotHeat) *Consolidation {
+	need := int(math.Ceil(weak.avg))
+	var best *classStats
+	bestSameDay, bestGap, bestHeat := false, 0, 0.0
+	for i := range stats {
+		cand := &stats[i]
+		if cand.sess.ID == weak.sess.ID || len(cand.occurrences) == 0 || !compatible(weak.sess.ClassType, cand.sess.ClassType) {
+			continue
+		}
+		if cand.sess.MaxCapacity > 0 && cand.sess.MaxCapacity-int(math.Ceil(cand.avg)) < need {
+			continue
+		}
+		if t := cand.sess.Target(); t > 0 && cand.avg < float64(t) {
+			continue // merging two struggling classes fixes neither
+		}
+
+		sameDay := cand.sess.DayOfWeek == weak.sess.DayOfWeek
+		gap := abs(startMinute(cand.sess) - startMinute(weak.sess))
+		h := heat.at(cand.sess)
+		better := best == nil ||
+			(sameDay && !bestSameDay) ||
+			(sameDay == bestSameDay && sameDay && gap < bestGap) ||
+			(sameDay == bestSameDay && !sameDay && h > bestHeat)
+		if better {
+			best, bestSameDay, bestGap, bestHeat = cand, sameDay, gap, h
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	c := &Consolidation{
+		SessionID:    best.sess.ID,
+		Title:        best.sess.Title,
+		DayOfWeek:    best.sess.DayOfWeek,
+		StartTime:    best.sess.StartTime,
+		AvgHeadcount: best.avg,
+	}
+	if best.sess.MaxCapacity > 0 {
+		c.SpareCapacity = best.sess.MaxCapacity - int(math.Ceil(best.avg))
+	}
+	if bestSameDay {
+		c.Reason = fmt.Sprintf("same day, %d minutes apart, averages %.1f", bestGap, best.avg)
+	} else {
+		c.Reason = fmt.Sprintf("busier slot (%.1f on average) with room for %d more", bestHeat, need)
+	}
+	return c
+}
+
+// compatible reports whether students of one class type can join the other
+func compatible(a, b string) bool {
+	if a == "" {
+		a = "adult"
+	}
+	if b == "" {
+		b = "adult"
+	}
+	return a == b || a == "mixed" || b == "mixed"
+}
+
+func startMinute(sess session.Session) int {
+	if sess.StartMinute > 0 {
+		return sess.StartMinute
+	}
+	t, err := time.Parse("15:04", sess.StartTime)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
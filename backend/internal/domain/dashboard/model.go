@@ -0,0 +1,47 @@
+package dashboard
+
+import (
+	"time"
+
+	"dojo-manager/backend/internal/domain/activity"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/stats"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+)
+
+// Dashboard is everything the owner home screen shows, in one response
+type Dashboard struct {
+	DojoID              string                `json:"dojoId"`
+	Date                string                `json:"date"` // YYYY-MM-DD (UTC)
+	TodayClasses        []TodayClass          `json:"todayClasses"`
+	Attendance          WeekComparison        `json:"attendance"`
+	PendingJoinRequests int                   `json:"pendingJoinRequests"`
+	AtRiskMembers       int                   `json:"atRiskMembers"`
+	PlanUsage           *stripedom.UsageInfo  `json:"planUsage,omitempty"` // nil when billing is disabled
+	Plan                string                `json:"plan,omitempty"`
+	ClassFillRates      []stats.ClassFillRate `json:"classFillRates,omitempty"` // last 4 weeks, fullest first
+	AppAdoption         *activity.Adoption    `json:"appAdoption,omitempty"`    // members opening the app
+	Calendar            dojo.CalendarHints    `json:"calendar"`
+	GeneratedAt         time.Time             `json:"generatedAt"`
+}
+
+// TodayClass is one of today's classes with its current headcount
+type TodayClass struct {
+	SessionID   string `json:"sessionId"`
+	InstanceID  string `json:"instanceId"`
+	Title       string `json:"title"`
+	StartTime   string `json:"startTime"`
+	EndTime     string `json:"endTime"`
+	Instructor  string `json:"instructor,omitempty"`
+	MaxCapacity int    `json:"maxCapacity,omitempty"`
+	Headcount   int    `json:"headcount"`
+}
+
+// WeekComparison compares check-ins of this week (from the dojo's first day
+// of the week to today) with last week
+type WeekComparison struct {
+	ThisWeek       int     `json:"thisWeek"`
+	LastWeek       int     `json:"lastWeek"`       // full previous week
+	LastWeekToDate int     `json:"lastWeekToDate"` // previous week up to the same weekday
+	ChangePercent  float64 `json:"changePercent"`  // thisWeek vs lastWeekToDate
+}
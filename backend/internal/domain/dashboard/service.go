@@ -0,0 +1,186 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"dojo-manager/backend/internal/domain/activity"
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/retention"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/domain/stats"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Service assembles the owner dashboard from the other domain services
+type Service struct {
+	dojoRepo      *dojo.Repo
+	sessionSvc    *session.Service
+	attendanceSvc *attendance.Service
+	retentionSvc  *retention.Service
+	stripeSvc     *stripedom.Service // plan usage (optional)
+	statsSvc      *stats.Service     // class fill rates (optional)
+	activitySvc   *activity.Service  // app adoption (optional)
+}
+
+func NewService(dojoRepo *dojo.Repo, sessionSvc *session.Service, attendanceSvc *attendance.Service, retentionSvc *retention.Service) *Service {
+	return &Service{
+		dojoRepo:      dojoRepo,
+		sessionSvc:    sessionSvc,
+		attendanceSvc: attendanceSvc,
+		retentionSvc:  retentionSvc,
+	}
+}
+
+// SetStripeService sets the stripe service for plan usage
+func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
+	s.stripeSvc = stripeSvc
+}
+
+// SetStatsService adds class fill rates to the dashboard
+func (s *Service) SetStatsService(statsSvc *stats.Service) {
+	s.statsSvc = statsSvc
+}
+
+// SetActivityService adds app adoption to the dashboard
+func (s *Service) SetActivityService(activitySvc *activity.Service) {
+	s.activitySvc = activitySvc
+}
+
+// Get builds the dashboard of a dojo (staff only)
+func (s *Service) Get(ctx context.Context, staffUID, dojoID string) (*Dashboard, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// weeks start on the dojo's first day of the week
+	calendar := s.dojoRepo.Calendar(ctx, dojoID)
+	thisWeek := calendar.WeekOf(today)
+	lastWeek := thisWeek.AddDate(0, 0, -7)
+
+	out := &Dashboard{
+		DojoID:       dojoID,
+		Date:         today.Format("2006-01-02"),
+		TodayClasses: []TodayClass{},
+		Calendar:     calendar,
+		GeneratedAt:  now,
+	}
+
+	// one attendance scan covers both weeks and today's headcounts
+	checkins, err := s.attendanceSvc.CheckinsByInstance(ctx, dojoID, lastWeek)
+	if err != nil {
+		return nil, err
+	}
+
+	classes, err := s.sessionSvc.ListByDay(ctx, dojoID, int(today.Weekday()))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range classes {
+		instanceID := instanceid.New(out.Date, c.ID)
+		out.TodayClasses = append(out.TodayClasses, TodayClass{
+			SessionID:   c.ID,
+			InstanceID:  instanceID,
+			Title:       c.Title,
+			StartTime:   c.StartTime,
+			EndTime:     c.EndTime,
+			Instructor:  c.Instructor,
+			MaxCapacity: c.MaxCapacity,
+			Headcount:   checkins[instanceID],
+		})
+	}
+	sort.Slice(out.TodayClasses, func(i, j int) bool {
+		return out.TodayClasses[i].StartTime < out.TodayClasses[j].StartTime
+	})
+
+	out.Attendance = compareWeeks(checkins, today, thisWeek, lastWeek)
+
+	pending, err := s.dojoRepo.CountPendingJoinRequests(ctx, dojoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count join requests: %w", err)
+	}
+	out.PendingJoinRequests = pending
+
+	if s.retentionSvc != nil {
+		alerts, err := s.retentionSvc.GetAlerts(ctx, staffUID, dojoID)
+		if err != nil {
+			return nil, err
+		}
+		out.AtRiskMembers = alerts.Stats.TotalAtRisk
+	}
+
+	if s.stripeSvc != nil {
+		info, err := s.stripeSvc.GetSubscriptionInfo(ctx, dojoID)
+		if err != nil {
+			return nil, err
+		}
+		out.Plan = info.Plan
+		out.PlanUsage = &info.Usage
+	}
+
+	if s.statsSvc != nil {
+		fill, err := s.statsSvc.GetFillRates(ctx, dojoID, 0, now)
+		if err != nil {
+			return nil, err
+		}
+		out.ClassFillRates = fill.Classes
+	}
+
+	if s.activitySvc != nil {
+		adoption, err := s.activitySvc.Adoption(ctx, dojoID, now)
+		if err != nil {
+			return nil, err
+		}
+		out.AppAdoption = adoption
+	}
+
+	return out, nil
+}
+
+// compareWeeks buckets check-ins by the date of their session instance
+func compareWeeks(checkins map[string]int, today, thisWeek, lastWeek time.Time) WeekComparison {
+	var wc WeekComparison
+	lastWeekToDate := today.AddDate(0, 0, -7)
+
+	for instanceID, n := range checkins {
+		dateKey, _, ok := instanceid.Parse(instanceID)
+		if !ok {
+			continue
+		}
+		date, _ := time.Parse("2006-01-02", dateKey)
+		switch {
+		case date.Before(lastWeek) || date.After(today):
+			continue
+		case !date.Before(thisWeek):
+			wc.ThisWeek += n
+		default:
+			wc.LastWeek += n
+			if !date.After(lastWeekToDate) {
+				wc.LastWeekToDate += n
+			}
+		}
+	}
+
+	if wc.LastWeekToDate > 0 {
+		change := float64(wc.ThisWeek-wc.LastWeekToDate) / float64(wc.LastWeekToDate) * 100
+		wc.ChangePercent = math.Round(change*10) / 10
+	}
+	return wc
+}
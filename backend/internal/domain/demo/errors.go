@@ -0,0 +1,26 @@
+package demo
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrBadRequest = errors.New("bad request")
+	ErrForbidden  = errors.New("forbidden")
+	ErrConflict   = errors.New("conflict")
+)
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrForbidden(err error) bool {
+	return errors.Is(err, ErrForbidden)
+}
+
+func IsErrConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
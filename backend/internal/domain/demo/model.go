@@ -0,0 +1,57 @@
+package demo
+
+import (
+	"time"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/domain/session"
+)
+
+// Status is dojos/{dojoId}/settings/demo, present while the dojo holds demo
+// data. It lists what was seeded so Wipe removes exactly that.
+type Status struct {
+	Seeded     bool      `firestore:"seeded" json:"seeded"`
+	SeededAt   time.Time `firestore:"seededAt,omitempty" json:"seededAt,omitempty"`
+	SeededBy   string    `firestore:"seededBy,omitempty" json:"seededBy,omitempty"`
+	MemberUIDs []string  `firestore:"memberUids,omitempty" json:"memberUids,omitempty"`
+	ClassIDs   []string  `firestore:"classIds,omitempty" json:"classIds,omitempty"`
+	Attendance int       `firestore:"attendance,omitempty" json:"attendance"`
+	Promotions int       `firestore:"promotions,omitempty" json:"promotions"`
+}
+
+// WipeResult counts the documents a wipe removed
+type WipeResult struct {
+	Members    int `json:"members"`
+	Classes    int `json:"classes"`
+	Attendance int `json:"attendance"`
+	Promotions int `json:"promotions"`
+}
+
+// Seeded docs are the domain docs with a demo flag, so clients can badge
+// them and nothing else is mistaken for demo data
+
+type demoMember struct {
+	members.Member
+	DisplayName  string    `firestore:"displayName"`
+	Email        string    `firestore:"email"`
+	IsKids       bool      `firestore:"isKids,omitempty"`
+	UserSyncedAt time.Time `firestore:"userSyncedAt"` // no users/{uid} to copy from
+	Demo         bool      `firestore:"demo"`
+}
+
+type demoClass struct {
+	session.Session
+	Demo bool `firestore:"demo"`
+}
+
+type demoAttendance struct {
+	attendance.Attendance
+	Demo bool `firestore:"demo"`
+}
+
+type demoPromotion struct {
+	ranks.RankHistory
+	Demo bool `firestore:"demo"`
+}
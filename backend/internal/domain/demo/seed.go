@@ -0,0 +1,242 @@
+package demo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// attendanceWeeks is how far back the demo attendance goes
+const attendanceWeeks = 12
+
+// demoPerson is one demo student. Regularity is the chance they turn up to
+// a class they can attend.
+type demoPerson struct {
+	name        string
+	kids        bool
+	belt        string
+	stripes     int
+	monthsAgo   int // joined
+	promotedAgo int // months since the last belt, for belts past white
+	regularity  float64
+}
+
+var demoPeople = []demoPerson{
+	{"Lucas Almeida", false, "purple", 1, 40, 8, 0.8},
+	{"Sofia Martins", false, "blue", 3, 26, 14, 0.7},
+	{"Daniel Kim", false, "blue", 1, 18, 5, 0.6},
+	{"Emma Schneider", false, "white", 4, 11, 0, 0.75},
+	{"Noah Johnson", false, "white", 2, 7, 0, 0.5},
+	{"Aiko Tanaka", false, "brown", 0, 60, 3, 0.65},
+	{"Mateo Rossi", false, "white", 1, 4, 0, 0.55},
+	{"Chloe Dubois", false, "blue", 0, 15, 1, 0.45},
+	{"Ethan Williams", false, "white", 3, 9, 0, 0.35},
+	{"Priya Patel", false, "white", 0, 2, 0, 0.6},
+	{"Gabriel Costa", false, "purple", 3, 52, 20, 0.5},
+	{"Hannah Müller", false, "white", 2, 6, 0, 0.25},
+	{"Oliver Brown", false, "blue", 2, 22, 9, 0.3},
+	{"Yuki Sato", false, "white", 0, 1, 0, 0.7},
+	{"Isabella Garcia", false, "white", 1, 5, 0, 0.4},
+	{"Liam O'Connor", false, "black", 0, 96, 30, 0.55},
+	{"Ava Thompson", false, "white", 0, 3, 0, 0.2},
+	{"Rafael Souza", false, "blue", 4, 30, 16, 0.65},
+	{"Mia Fischer", true, "grey_white", 2, 14, 6, 0.7},
+	{"Leo Nakamura", true, "white", 3, 8, 0, 0.6},
+	{"Zoe Lambert", true, "grey", 1, 26, 4, 0.55},
+	{"Sam Wilson", true, "white", 1, 3, 0, 0.45},
+	{"Nina Kowalski", true, "yellow_white", 0, 38, 2, 0.8},
+	{"Arthur Silva", true, "white", 0, 1, 0, 0.5},
+}
+
+// demoClassSpec is one class of the demo timetable
+type demoClassSpec struct {
+	title     string
+	day       time.Weekday
+	start     string
+	end       string
+	classType string
+	tags      []string // from session.DefaultTags
+	capacity  int
+	minBelt   string
+	kidsOnly  bool
+}
+
+var demoClasses = []demoClassSpec{
+	{"Fundamentals", time.Monday, "19:00", "20:00", "adult", []string{"gi", "fundamentals"}, 30, "", false},
+	{"Advanced Gi", time.Tuesday, "19:00", "20:30", "adult", []string{"gi", "advanced"}, 25, "blue", false},
+	{"Kids BJJ", time.Tuesday, "17:00", "17:45", "kids", []string{"kids"}, 20, "", true},
+	{"Fundamentals", time.Wednesday, "19:00", "20:00", "adult", []string{"gi", "fundamentals"}, 30, "", false},
+	{"No-Gi", time.Thursday, "19:00", "20:00", "adult", []string{"no-gi"}, 25, "", false},
+	{"Kids BJJ", time.Thursday, "17:00", "17:45", "kids", []string{"kids"}, 20, "", true},
+	{"Open Mat", time.Saturday, "10:00", "12:00", "mixed", []string{"open-mat"}, 40, "", false},
+}
+
+// demoInstructor is shown on the demo classes, which have no instructor uid
+const demoInstructor = "Demo Coach"
+
+// seedData is everything Seed writes
+type seedData struct {
+	members    []demoMember
+	classes    []demoClass
+	attendance []demoAttendance
+	promotions map[string]demoPromotion // member uid -> their last promotion
+}
+
+// buildSeed lays out the demo dojo. The random choices are seeded by the
+// dojo id, so a dojo reseeded after a wipe looks the same.
+func buildSeed(dojoID, ownerUID string, newID func() string, now time.Time) *seedData {
+	h := fnv.New64a()
+	h.Write([]byte(dojoID))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	out := &seedData{promotions: map[string]demoPromotion{}}
+	for i, p := range demoPeople {
+		uid := fmt.Sprintf("demo_%02d", i+1)
+		joined := today.AddDate(0, -p.monthsAgo, -rng.IntN(28))
+		m := demoMember{
+			Member: members.Member{
+				UID:        uid,
+				Status:     members.StatusActive,
+				RoleInDojo: members.RoleStudent,
+				BeltRank:   p.belt,
+				Stripes:    p.stripes,
+				JoinedAt:   joined,
+				ApprovedBy: ownerUID,
+				ApprovedAt: joined,
+				CreatedAt:  joined,
+				UpdatedAt:  now,
+			},
+			DisplayName:  p.name,
+			Email:        fmt.Sprintf("demo%02d@example.com", i+1),
+			IsKids:       p.kids,
+			UserSyncedAt: now,
+			Demo:         true,
+		}
+
+		order := ranks.BeltOrder
+		if p.kids {
+			order = ranks.KidsBeltOrder
+		}
+		if idx := slices.Index(order, p.belt); idx > 0 {
+			promoted := today.AddDate(0, -p.promotedAgo, -rng.IntN(28))
+			if promoted.Before(joined) {
+				promoted = joined
+			}
+			m.LastPromotionAt = promoted
+			m.LastPromotedBy = ownerUID
+			out.promotions[uid] = demoPromotion{
+				RankHistory: ranks.RankHistory{
+					ID:              newID(),
+					PreviousBelt:    order[idx-1],
+					PreviousStripes: 4,
+					NewBelt:         p.belt,
+					PromotedBy:      ownerUID,
+					Notes:           "Demo promotion",
+					CreatedAt:       promoted,
+				},
+				Demo: true,
+			}
+		}
+		out.members = append(out.members, m)
+	}
+
+	for _, c := range demoClasses {
+		startMinute, endMinute := clockMinutes(c.start), clockMinutes(c.end)
+		out.classes = append(out.classes, demoClass{
+			Session: session.Session{
+				ID:             newID(),
+				DojoID:         dojoID,
+				Title:          c.title,
+				DayOfWeek:      int(c.day),
+				StartTime:      c.start,
+				EndTime:        c.end,
+				Instructor:     demoInstructor,
+				ClassType:      c.classType,
+				MaxCapacity:    c.capacity,
+				IsActive:       true,
+				CreatedBy:      ownerUID,
+				CreatedAt:      now,
+				UpdatedAt:      now,
+				Weekday:        int(c.day),
+				StartMinute:    startMinute,
+				DurationMinute: endMinute - startMinute,
+				IsRecurring:    true,
+				RecurrenceRule: "weekly",
+				Tags:           c.tags,
+				MinBelt:        c.minBelt,
+				KidsOnly:       c.kidsOnly,
+			},
+			Demo: true,
+		})
+	}
+
+	// every class held in the past weeks, attended by the members who had
+	// joined and fit the class, each at their own regularity
+	for day := today.AddDate(0, 0, -7*attendanceWeeks); day.Before(today); day = day.AddDate(0, 0, 1) {
+		for _, c := range out.classes {
+			if time.Weekday(c.DayOfWeek) != day.Weekday() {
+				continue
+			}
+			start := day.Add(time.Duration(c.StartMinute) * time.Minute)
+			for i, m := range out.members {
+				p := demoPeople[i]
+				if m.JoinedAt.After(day) {
+					continue
+				}
+				if c.ClassType != "mixed" && (c.ClassType == "kids") != p.kids {
+					continue
+				}
+				chance := p.regularity
+				if c.ClassType == "mixed" && p.kids {
+					chance /= 3 // the odd kid at open mat
+				}
+				if c.MinBelt != "" && m.BeltRank == "white" {
+					continue
+				}
+				if rng.Float64() >= chance {
+					continue
+				}
+
+				status := attendance.StatusPresent
+				checkIn := start.Add(-time.Duration(rng.IntN(15)) * time.Minute)
+				if rng.IntN(10) == 0 {
+					status = attendance.StatusLate
+					checkIn = start.Add(time.Duration(5+rng.IntN(15)) * time.Minute)
+				}
+				out.attendance = append(out.attendance, demoAttendance{
+					Attendance: attendance.Attendance{
+						ID:                newID(),
+						DojoID:            dojoID,
+						SessionInstanceID: instanceid.ForDate(day, c.ID),
+						MemberUID:         m.UID,
+						Status:            status,
+						CheckInTime:       &checkIn,
+						RecordedBy:        ownerUID,
+						CreatedAt:         checkIn,
+						UpdatedAt:         checkIn,
+					},
+					Demo: true,
+				})
+			}
+		}
+	}
+	return out
+}
+
+// clockMinutes turns "HH:MM" into minutes from midnight
+func clockMinutes(hhmm string) int {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,303 @@
+package demo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/firebase"
+	"dojo-manager/backend/internal/fsdoc"
+)
+
+// staffRoles may already be in a dojo that counts as empty
+var staffRoles = map[string]bool{
+	"owner": true, "staff": true, "staff_member": true, "coach": true, "admin": true, "instructor": true,
+}
+
+// inQueryLimit is the most values a Firestore "in" filter takes
+const inQueryLimit = 30
+
+// Service seeds a new dojo with demo members, classes, attendance and
+// promotions so its owner can try the product before going live, and wipes
+// them again in one call. Demo docs carry demo: true. Only the owner may do
+// either, and only an empty dojo is seeded. Demo members count towards the
+// plan's member limit until they are wiped.
+type Service struct {
+	fs       *firestore.Client
+	dbs      firebase.ClientResolver // per-dojo database of classes and attendance (data residency)
+	dojoRepo *dojo.Repo
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, dbs: firebase.DefaultResolver{Client: fs}, dojoRepo: dojoRepo}
+}
+
+// SetClientResolver keeps each dojo's demo classes and attendance in its own
+// database
+func (s *Service) SetClientResolver(resolver firebase.ClientResolver) {
+	s.dbs = resolver
+}
+
+func (s *Service) statusRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("demo")
+}
+
+func (s *Service) dojoCol(dojoID, name string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection(name)
+}
+
+// routedDB returns the database that holds the dojo's classes and attendance
+func (s *Service) routedDB(ctx context.Context, dojoID string) (*firestore.Client, error) {
+	db, err := s.dbs.ClientFor(ctx, dojoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dojo database: %w", err)
+	}
+	return db, nil
+}
+
+// bulkWriters returns a writer for the default database and one for the
+// routed database, the same writer when they are one database
+func (s *Service) bulkWriters(ctx context.Context, db *firestore.Client) (*firestore.BulkWriter, *firestore.BulkWriter) {
+	bw := s.fs.BulkWriter(ctx)
+	if db == s.fs {
+		return bw, bw
+	}
+	return bw, db.BulkWriter(ctx)
+}
+
+func endWriters(bw, routed *firestore.BulkWriter) {
+	bw.End()
+	if routed != bw {
+		routed.End()
+	}
+}
+
+// requireOwner checks the caller owns the dojo
+func (s *Service) requireOwner(ctx context.Context, uid, dojoID string) error {
+	if strings.TrimSpace(dojoID) == "" {
+		return fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	d, err := s.dojoRepo.GetDojo(ctx, dojoID)
+	if err != nil {
+		return fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	if !d.IsOwner(uid) {
+		return fmt.Errorf("%w: only the dojo owner can manage demo data", ErrForbidden)
+	}
+	return nil
+}
+
+// GetStatus reports whether the dojo holds demo data (owner only)
+func (s *Service) GetStatus(ctx context.Context, uid, dojoID string) (*Status, error) {
+	if err := s.requireOwner(ctx, uid, dojoID); err != nil {
+		return nil, err
+	}
+	return s.status(ctx, dojoID)
+}
+
+func (s *Service) status(ctx context.Context, dojoID string) (*Status, error) {
+	doc, err := s.statusRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load demo status: %w", err)
+	}
+	st := &Status{}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode demo status: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// Seed fills an empty dojo with demo data (owner only). The status doc is
+// written first, so a seed that fails halfway can still be wiped.
+func (s *Service) Seed(ctx context.Context, uid, dojoID string) (*Status, error) {
+	if err := s.requireOwner(ctx, uid, dojoID); err != nil {
+		return nil, err
+	}
+	st, err := s.status(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if st.Seeded {
+		return nil, fmt.Errorf("%w: the dojo already has demo data", ErrConflict)
+	}
+	db, err := s.routedDB(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireEmpty(ctx, db, dojoID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	attendanceCol := db.Collection("dojos").Doc(dojoID).Collection("attendance")
+	data := buildSeed(dojoID, uid, func() string { return attendanceCol.NewDoc().ID }, now)
+
+	st = &Status{
+		Seeded:     true,
+		SeededAt:   now,
+		SeededBy:   uid,
+		Attendance: len(data.attendance),
+		Promotions: len(data.promotions),
+	}
+	for _, m := range data.members {
+		st.MemberUIDs = append(st.MemberUIDs, m.UID)
+	}
+	for _, c := range data.classes {
+		st.ClassIDs = append(st.ClassIDs, c.ID)
+	}
+	// Create fails if another request is seeding the dojo
+	if _, err := s.statusRef(dojoID).Create(ctx, st); err != nil {
+		if doc, _ := s.statusRef(dojoID).Get(ctx); doc != nil && doc.Exists() {
+			return nil, fmt.Errorf("%w: the dojo already has demo data", ErrConflict)
+		}
+		return nil, fmt.Errorf("failed to save demo status: %w", err)
+	}
+
+	bw, routed := s.bulkWriters(ctx, db)
+	var jobs []*firestore.BulkWriterJob
+	add := func(job *firestore.BulkWriterJob, err error) {
+		if err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	membersCol := s.dojoCol(dojoID, "members")
+	for _, m := range data.members {
+		add(bw.Create(membersCol.Doc(m.UID), m))
+		if p, ok := data.promotions[m.UID]; ok {
+			add(bw.Create(membersCol.Doc(m.UID).Collection("rankHistory").Doc(p.ID), p))
+		}
+	}
+	classesCol := db.Collection("dojos").Doc(dojoID).Collection("timetableClasses")
+	for _, c := range data.classes {
+		add(routed.Create(classesCol.Doc(c.ID), c))
+	}
+	for _, a := range data.attendance {
+		add(routed.Create(attendanceCol.Doc(a.ID), a))
+	}
+	endWriters(bw, routed)
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return nil, fmt.Errorf("failed to write demo data (wipe it and try again): %w", err)
+		}
+	}
+	return st, nil
+}
+
+// requireEmpty refuses dojos with classes, attendance or members other
+// than staff
+func (s *Service) requireEmpty(ctx context.Context, db *firestore.Client, dojoID string) error {
+	for _, name := range []string{"timetableClasses", "attendance"} {
+		docs, err := db.Collection("dojos").Doc(dojoID).Collection(name).Select().Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", name, err)
+		}
+		if len(docs) > 0 {
+			return fmt.Errorf("%w: demo data can only be added to an empty dojo", ErrConflict)
+		}
+	}
+
+	iter := s.dojoCol(dojoID, "members").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check members: %w", err)
+		}
+		m, err := fsdoc.As[fsdoc.Member](doc)
+		if err != nil || !staffRoles[m.RoleName()] {
+			return fmt.Errorf("%w: demo data can only be added to an empty dojo", ErrConflict)
+		}
+	}
+}
+
+// Wipe deletes the demo data (owner only): the demo members with their
+// promotions and all their attendance, including records added since, and
+// the demo classes. Real members' records stay.
+func (s *Service) Wipe(ctx context.Context, uid, dojoID string) (*WipeResult, error) {
+	if err := s.requireOwner(ctx, uid, dojoID); err != nil {
+		return nil, err
+	}
+	st, err := s.status(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if !st.Seeded {
+		return nil, fmt.Errorf("%w: the dojo has no demo data", ErrNotFound)
+	}
+
+	db, err := s.routedDB(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	var refs, routedRefs []*firestore.DocumentRef
+	res := &WipeResult{}
+
+	attendanceCol := db.Collection("dojos").Doc(dojoID).Collection("attendance")
+	for start := 0; start < len(st.MemberUIDs); start += inQueryLimit {
+		chunk := st.MemberUIDs[start:min(start+inQueryLimit, len(st.MemberUIDs))]
+		docs, err := attendanceCol.Where("memberUid", "in", chunk).Select().Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find demo attendance: %w", err)
+		}
+		for _, doc := range docs {
+			routedRefs = append(routedRefs, doc.Ref)
+		}
+		res.Attendance += len(docs)
+	}
+
+	membersCol := s.dojoCol(dojoID, "members")
+	for _, memberUID := range st.MemberUIDs {
+		docs, err := membersCol.Doc(memberUID).Collection("rankHistory").Select().Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find demo promotions: %w", err)
+		}
+		for _, doc := range docs {
+			refs = append(refs, doc.Ref)
+		}
+		res.Promotions += len(docs)
+		refs = append(refs, membersCol.Doc(memberUID))
+	}
+	res.Members = len(st.MemberUIDs)
+
+	classesCol := db.Collection("dojos").Doc(dojoID).Collection("timetableClasses")
+	for _, id := range st.ClassIDs {
+		routedRefs = append(routedRefs, classesCol.Doc(id))
+	}
+	res.Classes = len(st.ClassIDs)
+
+	bw, routed := s.bulkWriters(ctx, db)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(refs)+len(routedRefs))
+	for _, ref := range refs {
+		if job, err := bw.Delete(ref); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	for _, ref := range routedRefs {
+		if job, err := routed.Delete(ref); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	endWriters(bw, routed)
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return nil, fmt.Errorf("failed to delete demo data (try again): %w", err)
+		}
+	}
+
+	// last, so a wipe cut short can be run again
+	if _, err := s.statusRef(dojoID).Delete(ctx); err != nil {
+		return nil, fmt.Errorf("failed to clear demo status: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,26 @@
+package devices
+
+import "errors"
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrBadRequest   = errors.New("bad request")
+	ErrRevoked      = errors.New("device revoked")
+)
+
+func IsErrUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrRevoked(err error) bool {
+	return errors.Is(err, ErrRevoked)
+}
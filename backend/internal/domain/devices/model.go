@@ -0,0 +1,76 @@
+package devices
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	StatusActive  = "active"
+	StatusRevoked = "revoked"
+)
+
+// Activity actions
+const (
+	ActionRegistered   = "registered"
+	ActionUpdated      = "updated"
+	ActionTokenRotated = "token_rotated"
+	ActionRevoked      = "revoked"
+	ActionOnline       = "online" // first heartbeat after onlineGap of silence
+)
+
+// Device is dojos/{dojoId}/devices/{deviceId}, a kiosk or tablet the dojo
+// has registered. Only a hash of its token is stored; the token itself is
+// shown once, when the device is registered or its token rotated.
+type Device struct {
+	ID          string     `firestore:"-" json:"id"`
+	DojoID      string     `firestore:"dojoId" json:"dojoId"`
+	Name        string     `firestore:"name" json:"name"`
+	Location    string     `firestore:"location,omitempty" json:"location,omitempty"`
+	Status      string     `firestore:"status" json:"status"`
+	TokenHash   string     `firestore:"tokenHash" json:"-"`
+	TokenPrefix string     `firestore:"tokenPrefix" json:"tokenPrefix"` // first characters, to tell tokens apart
+	CreatedBy   string     `firestore:"createdBy" json:"createdBy"`
+	CreatedAt   time.Time  `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time  `firestore:"updatedAt" json:"updatedAt"`
+	LastSeenAt  *time.Time `firestore:"lastSeenAt,omitempty" json:"lastSeenAt,omitempty"`
+	LastSeenIP  string     `firestore:"lastSeenIp,omitempty" json:"lastSeenIp,omitempty"`
+	UserAgent   string     `firestore:"userAgent,omitempty" json:"userAgent,omitempty"`
+	RevokedAt   *time.Time `firestore:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	RevokedBy   string     `firestore:"revokedBy,omitempty" json:"revokedBy,omitempty"`
+}
+
+// Registration is returned when a device is registered or its token
+// rotated. Token is not stored and cannot be retrieved again.
+type Registration struct {
+	Device *Device `json:"device"`
+	Token  string  `json:"token"`
+}
+
+// Activity is dojos/{dojoId}/devices/{deviceId}/activity/{id}
+type Activity struct {
+	ID        string    `firestore:"-" json:"id"`
+	Action    string    `firestore:"action" json:"action"`
+	ActorUID  string    `firestore:"actorUid,omitempty" json:"actorUid,omitempty"` // empty for the device itself
+	IP        string    `firestore:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string    `firestore:"userAgent,omitempty" json:"userAgent,omitempty"`
+	Detail    string    `firestore:"detail,omitempty" json:"detail,omitempty"`
+	At        time.Time `firestore:"at" json:"at"`
+}
+
+// RequestMeta identifies where a request came from, for the activity log
+type RequestMeta struct {
+	IP        string
+	UserAgent string
+}
+
+// DeviceInput registers a device, or renames / relocates one on update
+type DeviceInput struct {
+	Name     string `json:"name"`
+	Location string `json:"location,omitempty"`
+}
+
+func (in *DeviceInput) Trim() {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Location = strings.TrimSpace(in.Location)
+}
@@ -0,0 +1,380 @@
+package devices
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+const (
+	maxDevices        = 50
+	maxNameLength     = 80
+	maxLocationLength = 120
+	maxUserAgent      = 256
+	maxActivity       = 200
+
+	// tokenPrefixLength characters of the token are kept in the clear
+	tokenPrefixLength = 6
+
+	// seenThrottle limits lastSeen writes from a chatty device
+	seenThrottle = time.Minute
+	// onlineGap of silence makes the next heartbeat an "online" activity entry
+	onlineGap = 15 * time.Minute
+)
+
+// Device tokens are looked up through deviceTokens/{sha256 of token}, which
+// holds {dojoId, deviceId}. The collection is server-only.
+
+type Service struct {
+	fs       *firestore.Client
+	dojoRepo *dojo.Repo
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo}
+}
+
+func (s *Service) devicesCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("devices")
+}
+
+func (s *Service) tokenRef(hash string) *firestore.DocumentRef {
+	return s.fs.Collection("deviceTokens").Doc(hash)
+}
+
+func newToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate device token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (in DeviceInput) validate() error {
+	if in.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrBadRequest)
+	}
+	if utf8.RuneCountInString(in.Name) > maxNameLength {
+		return fmt.Errorf("%w: name is limited to %d characters", ErrBadRequest, maxNameLength)
+	}
+	if utf8.RuneCountInString(in.Location) > maxLocationLength {
+		return fmt.Errorf("%w: location is limited to %d characters", ErrBadRequest, maxLocationLength)
+	}
+	return nil
+}
+
+// activity builds a log entry, clipping what the client controls
+func activity(action, actorUID string, meta RequestMeta, at time.Time) Activity {
+	ua := meta.UserAgent
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	return Activity{Action: action, ActorUID: actorUID, IP: meta.IP, UserAgent: ua, At: at}
+}
+
+// Register adds a device and returns its token, which is only shown now (staff)
+func (s *Service) Register(ctx context.Context, staffUID, dojoID string, in DeviceInput, meta RequestMeta) (*Registration, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+
+	active, err := s.devicesCol(dojoID).Where("status", "==", StatusActive).Select().Limit(maxDevices).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count devices: %w", err)
+	}
+	if len(active) >= maxDevices {
+		return nil, fmt.Errorf("%w: at most %d active devices per dojo", ErrBadRequest, maxDevices)
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	ref := s.devicesCol(dojoID).NewDoc()
+	dev := Device{
+		DojoID:      dojoID,
+		Name:        in.Name,
+		Location:    in.Location,
+		Status:      StatusActive,
+		TokenHash:   hash,
+		TokenPrefix: token[:tokenPrefixLength],
+		CreatedBy:   staffUID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	batch := s.fs.Batch()
+	batch.Create(ref, dev)
+	batch.Create(s.tokenRef(hash), map[string]interface{}{"dojoId": dojoID, "deviceId": ref.ID, "createdAt": now})
+	batch.Create(ref.Collection("activity").NewDoc(), activity(ActionRegistered, staffUID, meta, now))
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to register device: %w", err)
+	}
+	dev.ID = ref.ID
+	return &Registration{Device: &dev, Token: token}, nil
+}
+
+// List returns the dojo's devices, newest first (staff)
+func (s *Service) List(ctx context.Context, dojoID string) ([]Device, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	iter := s.devicesCol(dojoID).OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Device{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list devices: %w", err)
+		}
+		var d Device
+		if err := doc.DataTo(&d); err != nil {
+			continue
+		}
+		d.ID = doc.Ref.ID
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// Get returns one device (staff)
+func (s *Service) Get(ctx context.Context, dojoID, deviceID string) (*Device, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	deviceID = strings.TrimSpace(deviceID)
+	if dojoID == "" || deviceID == "" {
+		return nil, fmt.Errorf("%w: dojoId and deviceId are required", ErrBadRequest)
+	}
+	doc, err := s.devicesCol(dojoID).Doc(deviceID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: device not found", ErrNotFound)
+	}
+	var d Device
+	if err := doc.DataTo(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode device: %w", err)
+	}
+	d.ID = doc.Ref.ID
+	return &d, nil
+}
+
+// Update renames or relocates a device (staff)
+func (s *Service) Update(ctx context.Context, staffUID, dojoID, deviceID string, in DeviceInput, meta RequestMeta) (*Device, error) {
+	in.Trim()
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	d, err := s.Get(ctx, dojoID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	ref := s.devicesCol(d.DojoID).Doc(d.ID)
+	batch := s.fs.Batch()
+	batch.Update(ref, []firestore.Update{
+		{Path: "name", Value: in.Name},
+		{Path: "location", Value: in.Location},
+		{Path: "updatedAt", Value: now},
+	})
+	entry := activity(ActionUpdated, staffUID, meta, now)
+	if d.Name != in.Name {
+		entry.Detail = fmt.Sprintf("renamed from %q", d.Name)
+	}
+	batch.Create(ref.Collection("activity").NewDoc(), entry)
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to update device: %w", err)
+	}
+
+	d.Name = in.Name
+	d.Location = in.Location
+	d.UpdatedAt = now
+	return d, nil
+}
+
+// Revoke disables a device remotely. Its token stops working at once and
+// cannot be rotated back; register the device again to reuse it (staff).
+func (s *Service) Revoke(ctx context.Context, staffUID, dojoID, deviceID string, meta RequestMeta) (*Device, error) {
+	d, err := s.Get(ctx, dojoID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == StatusRevoked {
+		return d, nil
+	}
+
+	now := time.Now().UTC()
+	ref := s.devicesCol(d.DojoID).Doc(d.ID)
+	batch := s.fs.Batch()
+	batch.Update(ref, []firestore.Update{
+		{Path: "status", Value: StatusRevoked},
+		{Path: "revokedAt", Value: now},
+		{Path: "revokedBy", Value: staffUID},
+		{Path: "updatedAt", Value: now},
+	})
+	batch.Delete(s.tokenRef(d.TokenHash))
+	batch.Create(ref.Collection("activity").NewDoc(), activity(ActionRevoked, staffUID, meta, now))
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to revoke device: %w", err)
+	}
+
+	d.Status = StatusRevoked
+	d.RevokedAt = &now
+	d.RevokedBy = staffUID
+	d.UpdatedAt = now
+	return d, nil
+}
+
+// RotateToken replaces an active device's token; the old one stops working (staff)
+func (s *Service) RotateToken(ctx context.Context, staffUID, dojoID, deviceID string, meta RequestMeta) (*Registration, error) {
+	d, err := s.Get(ctx, dojoID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != StatusActive {
+		return nil, fmt.Errorf("%w: device is revoked", ErrBadRequest)
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	ref := s.devicesCol(d.DojoID).Doc(d.ID)
+	batch := s.fs.Batch()
+	batch.Update(ref, []firestore.Update{
+		{Path: "tokenHash", Value: hash},
+		{Path: "tokenPrefix", Value: token[:tokenPrefixLength]},
+		{Path: "updatedAt", Value: now},
+	})
+	batch.Delete(s.tokenRef(d.TokenHash))
+	batch.Create(s.tokenRef(hash), map[string]interface{}{"dojoId": d.DojoID, "deviceId": d.ID, "createdAt": now})
+	batch.Create(ref.Collection("activity").NewDoc(), activity(ActionTokenRotated, staffUID, meta, now))
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to rotate device token: %w", err)
+	}
+
+	d.TokenHash = hash
+	d.TokenPrefix = token[:tokenPrefixLength]
+	d.UpdatedAt = now
+	return &Registration{Device: d, Token: token}, nil
+}
+
+// Activity returns a device's log, newest first (staff)
+func (s *Service) Activity(ctx context.Context, dojoID, deviceID string, limit int) ([]Activity, error) {
+	d, err := s.Get(ctx, dojoID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxActivity {
+		limit = maxActivity
+	}
+
+	iter := s.devicesCol(d.DojoID).Doc(d.ID).Collection("activity").
+		OrderBy("at", firestore.Desc).Limit(limit).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Activity{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list device activity: %w", err)
+		}
+		var a Activity
+		if err := doc.DataTo(&a); err != nil {
+			continue
+		}
+		a.ID = doc.Ref.ID
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// Authenticate resolves a device token to its device and records that the
+// device was seen. Revoked and unknown tokens get ErrUnauthorized.
+func (s *Service) Authenticate(ctx context.Context, token string, meta RequestMeta) (*Device, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, fmt.Errorf("%w: device token is required", ErrUnauthorized)
+	}
+	lookup, err := s.tokenRef(hashToken(token)).Get(ctx)
+	if err != nil && lookup == nil {
+		return nil, fmt.Errorf("failed to look up device token: %w", err)
+	}
+	if !lookup.Exists() {
+		return nil, fmt.Errorf("%w: unknown device token", ErrUnauthorized)
+	}
+	dojoID, _ := lookup.Data()["dojoId"].(string)
+	deviceID, _ := lookup.Data()["deviceId"].(string)
+
+	d, err := s.Get(ctx, dojoID, deviceID)
+	if err != nil {
+		if IsErrNotFound(err) || IsErrBadRequest(err) {
+			return nil, fmt.Errorf("%w: unknown device token", ErrUnauthorized)
+		}
+		return nil, err
+	}
+	if d.Status != StatusActive {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, ErrRevoked)
+	}
+
+	now := time.Now().UTC()
+	if d.LastSeenAt != nil && now.Sub(*d.LastSeenAt) < seenThrottle && d.LastSeenIP == meta.IP {
+		return d, nil
+	}
+	entry := activity(ActionOnline, "", meta, now)
+	ref := s.devicesCol(d.DojoID).Doc(d.ID)
+	batch := s.fs.Batch()
+	batch.Update(ref, []firestore.Update{
+		{Path: "lastSeenAt", Value: now},
+		{Path: "lastSeenIp", Value: entry.IP},
+		{Path: "userAgent", Value: entry.UserAgent},
+	})
+	if d.LastSeenAt == nil || now.Sub(*d.LastSeenAt) >= onlineGap {
+		batch.Create(ref.Collection("activity").NewDoc(), entry)
+	} else if d.LastSeenIP != "" && d.LastSeenIP != meta.IP {
+		// an address change mid-session is worth a look in a security review
+		entry.Detail = "ip changed from " + d.LastSeenIP
+		batch.Create(ref.Collection("activity").NewDoc(), entry)
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to record device heartbeat: %w", err)
+	}
+
+	d.LastSeenAt = &now
+	d.LastSeenIP = entry.IP
+	d.UserAgent = entry.UserAgent
+	return d, nil
+}
@@ -0,0 +1,129 @@
+package digest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Digest is dojos/{dojoId}/digests/{week}: what happened in a dojo over one
+// Monday–Sunday week (UTC), for its staff. Run stores the digest of each
+// finished week; weeks it has not stored are built when asked for.
+type Digest struct {
+	DojoID        string          `firestore:"dojoId" json:"dojoId"`
+	Week          string          `firestore:"week" json:"week"`       // Monday, YYYY-MM-DD
+	ISOWeek       string          `firestore:"isoWeek" json:"isoWeek"` // e.g. 2026-W42
+	WeekEnd       string          `firestore:"weekEnd" json:"weekEnd"` // Sunday, YYYY-MM-DD
+	NewMembers    []Person        `firestore:"newMembers" json:"newMembers"`
+	Departures    []Person        `firestore:"departures" json:"departures"`
+	Promotions    []Promotion     `firestore:"promotions" json:"promotions"`
+	Announcements Announcements   `firestore:"announcements" json:"announcements"`
+	Attendance    AttendanceDelta `firestore:"attendance" json:"attendance"`
+	Complete      bool            `firestore:"complete" json:"complete"` // false while the week is still running
+	GeneratedAt   time.Time       `firestore:"generatedAt" json:"generatedAt"`
+	SentAt        *time.Time      `firestore:"sentAt,omitempty" json:"sentAt,omitempty"`
+}
+
+// Person is a member who joined or left in the week
+type Person struct {
+	UID         string    `firestore:"uid" json:"uid"`
+	DisplayName string    `firestore:"displayName,omitempty" json:"displayName,omitempty"`
+	At          time.Time `firestore:"at" json:"at"`
+}
+
+// Promotion is a belt promotion awarded in the week (stripes are left out)
+type Promotion struct {
+	MemberUID    string    `firestore:"memberUid" json:"memberUid"`
+	DisplayName  string    `firestore:"displayName,omitempty" json:"displayName,omitempty"`
+	PreviousBelt string    `firestore:"previousBelt" json:"previousBelt"`
+	Belt         string    `firestore:"belt" json:"belt"`
+	PromotedAt   time.Time `firestore:"promotedAt" json:"promotedAt"`
+	PromotedBy   string    `firestore:"promotedBy,omitempty" json:"promotedBy,omitempty"`
+}
+
+// Announcements sums the delivery and read counts of the notices published
+// in the week, as they stood when the digest was built
+type Announcements struct {
+	Published int             `firestore:"published" json:"published"`
+	Delivered int             `firestore:"delivered" json:"delivered"`
+	Read      int             `firestore:"read" json:"read"`
+	ReadRate  float64         `firestore:"readRate" json:"readRate"` // 0..1
+	Notices   []NoticeSummary `firestore:"notices" json:"notices"`
+}
+
+// NoticeSummary is one notice published in the week
+type NoticeSummary struct {
+	ID        string    `firestore:"id" json:"id"`
+	Title     string    `firestore:"title" json:"title"`
+	PublishAt time.Time `firestore:"publishAt" json:"publishAt"`
+	Delivered int       `firestore:"delivered" json:"delivered"`
+	Read      int       `firestore:"read" json:"read"`
+}
+
+// AttendanceDelta compares the week's check-ins with the week before
+type AttendanceDelta struct {
+	Checkins         int     `firestore:"checkins" json:"checkins"`
+	PreviousCheckins int     `firestore:"previousCheckins" json:"previousCheckins"`
+	Members          int     `firestore:"members" json:"members"` // members who checked in
+	PreviousMembers  int     `firestore:"previousMembers" json:"previousMembers"`
+	ChangePercent    float64 `firestore:"changePercent" json:"changePercent"` // checkins vs previousCheckins
+}
+
+// departure is dojos/{dojoId}/departures/{id}, written when a member is
+// removed from the roster, since the member doc itself is deleted
+type departure struct {
+	MemberUID   string    `firestore:"memberUid"`
+	DisplayName string    `firestore:"displayName,omitempty"`
+	RemovedBy   string    `firestore:"removedBy,omitempty"`
+	At          time.Time `firestore:"at"`
+}
+
+// RunResult summarizes a scheduler run
+type RunResult struct {
+	Week         string `json:"week"` // the week summarized, Monday YYYY-MM-DD
+	DojosChecked int    `json:"dojosChecked"`
+	Sent         int    `json:"sent"`
+	Skipped      int    `json:"skipped"` // already sent
+	Notified     int    `json:"notified"`
+	EmailQueued  int    `json:"emailQueued"`
+	Failed       int    `json:"failed"`
+	Partial      bool   `json:"partial"` // the deadline hit first; run again to finish
+}
+
+// WeekOf is the Monday (00:00 UTC) of the week containing t
+func WeekOf(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// ParseWeek reads a week as an ISO week ("2026-W42") or as any date in it
+// ("2026-10-12"), and returns its Monday
+func ParseWeek(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if year, week, ok := strings.Cut(strings.ToUpper(s), "-W"); ok {
+		y, err1 := strconv.Atoi(year)
+		w, err2 := strconv.Atoi(week)
+		if err1 == nil && err2 == nil && w >= 1 && w <= 53 {
+			// January 4 is always in week 1
+			monday := WeekOf(time.Date(y, time.January, 4, 0, 0, 0, 0, time.UTC)).AddDate(0, 0, 7*(w-1))
+			if iy, iw := monday.ISOWeek(); iy == y && iw == w {
+				return monday, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%w: invalid week %q", ErrBadRequest, s)
+	}
+	day, err := time.Parse(instanceid.DateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: week must be YYYY-Www or YYYY-MM-DD", ErrBadRequest)
+	}
+	return WeekOf(day), nil
+}
+
+func isoWeek(monday time.Time) string {
+	y, w := monday.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", y, w)
+}
@@ -0,0 +1,197 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/instanceid"
+	"dojo-manager/backend/internal/mailqueue"
+)
+
+// Run stores and sends every dojo's digest of the last finished week to its
+// staff, as an in-app notification and, to staff with an email address on
+// their profile, an email. Meant to be triggered weekly (Monday) by Cloud
+// Scheduler; a dojo's digest is sent at most once per week.
+func (s *Service) Run(ctx context.Context, now time.Time) (*RunResult, error) {
+	now = now.UTC()
+	monday := WeekOf(now).AddDate(0, 0, -7)
+	res := &RunResult{Week: monday.Format(instanceid.DateLayout)}
+
+	iter := s.fs.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+
+		if err := s.runDojo(ctx, doc.Ref.ID, monday, now, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			res.Failed++
+			log.Printf("digest: dojo %s: %v", doc.Ref.ID, err)
+		}
+	}
+
+	log.Printf("digest: week %s, %d dojos checked, %d sent, %d skipped, %d notified, %d emails queued, %d failed (partial=%v)",
+		res.Week, res.DojosChecked, res.Sent, res.Skipped, res.Notified, res.EmailQueued, res.Failed, res.Partial)
+	return res, nil
+}
+
+// runDojo builds the dojo's digest and sends it unless a run already did
+func (s *Service) runDojo(ctx context.Context, dojoID string, monday, now time.Time, res *RunResult) error {
+	ref := s.digestRef(dojoID, monday)
+	if doc, err := ref.Get(ctx); err == nil && doc.Exists() {
+		res.Skipped++
+		return nil
+	}
+
+	d, err := s.build(ctx, dojoID, monday, now)
+	if err != nil {
+		return err
+	}
+	d.SentAt = &now
+	// Create is the claim: an overlapping run that stored it first wins
+	if _, err := ref.Create(ctx, d); err != nil {
+		res.Skipped++
+		return nil
+	}
+	res.Sent++
+
+	staff, err := s.dojoRepo.ListStaffUIDs(ctx, dojoID)
+	if err != nil {
+		return fmt.Errorf("failed to list staff: %w", err)
+	}
+	name := s.dojoName(ctx, dojoID)
+	title := digestTitle(name, d)
+	summary := summaryText(d)
+	text := emailText(name, d)
+	emails := s.staffEmails(ctx, staff)
+
+	for _, uid := range staff {
+		if err := s.notify(ctx, dojoID, uid, title, summary, d, now); err != nil {
+			log.Printf("digest: dojo %s: notify %s failed: %v", dojoID, uid, err)
+			continue
+		}
+		res.Notified++
+		if email := emails[uid]; email != "" {
+			if err := mailqueue.Queue(ctx, s.fs, mailqueue.Email{To: email, Subject: title, Text: text}, now); err != nil {
+				log.Printf("digest: dojo %s: email to %s failed: %v", dojoID, uid, err)
+				continue
+			}
+			res.EmailQueued++
+		}
+	}
+	return nil
+}
+
+func (s *Service) notify(ctx context.Context, dojoID, uid, title, body string, d *Digest, now time.Time) error {
+	_, _, err := s.fs.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title": title,
+		"body":  body,
+		"type":  "staff_digest",
+		"data": map[string]interface{}{
+			"week": d.Week,
+		},
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": now,
+	})
+	return err
+}
+
+func digestTitle(dojoName string, d *Digest) string {
+	if dojoName == "" {
+		return "Your week in review (" + d.ISOWeek + ")"
+	}
+	return dojoName + ": your week in review (" + d.ISOWeek + ")"
+}
+
+// summaryText is the one-paragraph notification body
+func summaryText(d *Digest) string {
+	return fmt.Sprintf("%s, %s, %s; %s. %d check-ins (%s).",
+		plural(len(d.NewMembers), "new member", "new members"),
+		plural(len(d.Departures), "departure", "departures"),
+		plural(len(d.Promotions), "promotion", "promotions"),
+		plural(d.Announcements.Published, "announcement", "announcements"),
+		d.Attendance.Checkins, changeText(d.Attendance))
+}
+
+// emailText is the plain-text email, with the names behind the counts
+func emailText(dojoName string, d *Digest) string {
+	if dojoName == "" {
+		dojoName = "your dojo"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "What happened at %s from %s to %s:\n\n", dojoName, d.Week, d.WeekEnd)
+
+	a := d.Attendance
+	fmt.Fprintf(&b, "Attendance: %d check-ins by %d members (%s; %d check-ins by %d members the week before)\n",
+		a.Checkins, a.Members, changeText(a), a.PreviousCheckins, a.PreviousMembers)
+
+	people := func(heading string, list []Person) {
+		fmt.Fprintf(&b, "\n%s: %d\n", heading, len(list))
+		for _, p := range list {
+			fmt.Fprintf(&b, "  - %s\n", nameOr(p.DisplayName))
+		}
+	}
+	people("New members", d.NewMembers)
+	people("Departures", d.Departures)
+
+	fmt.Fprintf(&b, "\nPromotions: %d\n", len(d.Promotions))
+	for _, p := range d.Promotions {
+		fmt.Fprintf(&b, "  - %s: %s to %s\n", nameOr(p.DisplayName), ranks.BeltLabel(p.PreviousBelt), ranks.BeltLabel(p.Belt))
+	}
+
+	an := d.Announcements
+	fmt.Fprintf(&b, "\nAnnouncements: %d published", an.Published)
+	if an.Delivered > 0 {
+		fmt.Fprintf(&b, ", read by %d of %d recipients (%.0f%%)", an.Read, an.Delivered, an.ReadRate*100)
+	}
+	b.WriteString("\n")
+	for _, n := range an.Notices {
+		fmt.Fprintf(&b, "  - %s: %d of %d read\n", n.Title, n.Read, n.Delivered)
+	}
+	return b.String()
+}
+
+func changeText(a AttendanceDelta) string {
+	if a.PreviousCheckins == 0 {
+		return "none the week before"
+	}
+	return fmt.Sprintf("%+.1f%% on the week before", a.ChangePercent)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+func nameOr(name string) string {
+	if name == "" {
+		return "(no name)"
+	}
+	return name
+}
@@ -0,0 +1,279 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/notifications"
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// maxNotices bounds the notices whose read counts a digest loads
+const maxNotices = 20
+
+// Service builds the weekly staff digest from the roster, rank history,
+// notices and attendance of a dojo
+type Service struct {
+	fs               *firestore.Client
+	dojoRepo         *dojo.Repo
+	attendanceSvc    *attendance.Service
+	ranksSvc         *ranks.Service
+	notificationsSvc *notifications.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, attendanceSvc *attendance.Service, ranksSvc *ranks.Service, notificationsSvc *notifications.Service) *Service {
+	return &Service{
+		fs:               fs,
+		dojoRepo:         dojoRepo,
+		attendanceSvc:    attendanceSvc,
+		ranksSvc:         ranksSvc,
+		notificationsSvc: notificationsSvc,
+	}
+}
+
+func (s *Service) dojoRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID)
+}
+
+func (s *Service) digestRef(dojoID string, monday time.Time) *firestore.DocumentRef {
+	return s.dojoRef(dojoID).Collection("digests").Doc(monday.Format(instanceid.DateLayout))
+}
+
+// Get returns the digest of the week (see ParseWeek): the stored one once
+// Run has sent it, else one built now, which is partial for the running
+// week. Staff only; the router checks members.view.
+func (s *Service) Get(ctx context.Context, dojoID, week string, now time.Time) (*Digest, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	monday, err := ParseWeek(week)
+	if err != nil {
+		return nil, err
+	}
+	if monday.After(WeekOf(now)) {
+		return nil, fmt.Errorf("%w: week %s has not started", ErrBadRequest, monday.Format(instanceid.DateLayout))
+	}
+
+	doc, err := s.digestRef(dojoID, monday).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load digest: %w", err)
+	}
+	if doc.Exists() {
+		var d Digest
+		if err := doc.DataTo(&d); err != nil {
+			return nil, fmt.Errorf("failed to decode digest: %w", err)
+		}
+		return &d, nil
+	}
+	return s.build(ctx, dojoID, monday, now)
+}
+
+// build assembles the digest of the week starting on monday
+func (s *Service) build(ctx context.Context, dojoID string, monday, now time.Time) (*Digest, error) {
+	end := monday.AddDate(0, 0, 7)
+	d := &Digest{
+		DojoID:      dojoID,
+		Week:        monday.Format(instanceid.DateLayout),
+		ISOWeek:     isoWeek(monday),
+		WeekEnd:     end.AddDate(0, 0, -1).Format(instanceid.DateLayout),
+		Complete:    !now.Before(end),
+		GeneratedAt: now,
+	}
+
+	var err error
+	if d.NewMembers, err = s.newMembers(ctx, dojoID, monday, end); err != nil {
+		return nil, err
+	}
+	if d.Departures, err = s.departures(ctx, dojoID, monday, end); err != nil {
+		return nil, err
+	}
+	if d.Promotions, err = s.promotions(ctx, dojoID, monday, end); err != nil {
+		return nil, err
+	}
+	if d.Announcements, err = s.announcements(ctx, dojoID, monday, end); err != nil {
+		return nil, err
+	}
+	if d.Attendance, err = s.attendance(ctx, dojoID, monday, end); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// newMembers lists the members who joined in [from, to)
+func (s *Service) newMembers(ctx context.Context, dojoID string, from, to time.Time) ([]Person, error) {
+	docs, err := s.dojoRef(dojoID).Collection("members").
+		Where("joinedAt", ">=", from).
+		Where("joinedAt", "<", to).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list new members: %w", err)
+	}
+	out := []Person{}
+	for _, doc := range docs {
+		var m fsdoc.Member
+		if err := fsdoc.Decode(doc, &m); err != nil {
+			continue
+		}
+		out = append(out, Person{UID: doc.Ref.ID, DisplayName: m.DisplayName, At: m.JoinedAt})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out, nil
+}
+
+// departures lists the members removed in [from, to)
+func (s *Service) departures(ctx context.Context, dojoID string, from, to time.Time) ([]Person, error) {
+	docs, err := s.dojoRef(dojoID).Collection("departures").
+		Where("at", ">=", from).
+		Where("at", "<", to).
+		OrderBy("at", firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list departures: %w", err)
+	}
+	out := []Person{}
+	for _, doc := range docs {
+		var dep departure
+		if err := doc.DataTo(&dep); err != nil {
+			continue
+		}
+		out = append(out, Person{UID: dep.MemberUID, DisplayName: dep.DisplayName, At: dep.At})
+	}
+	return out, nil
+}
+
+func (s *Service) promotions(ctx context.Context, dojoID string, from, to time.Time) ([]Promotion, error) {
+	rows, err := s.ranksSvc.RegistryExport(ctx, dojoID, ranks.RegistryExportInput{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Promotion, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, Promotion{
+			MemberUID:    r.MemberUID,
+			DisplayName:  r.FullName,
+			PreviousBelt: r.PreviousBelt,
+			Belt:         r.Belt,
+			PromotedAt:   r.PromotedAt,
+			PromotedBy:   r.InstructorUID,
+		})
+	}
+	return out, nil
+}
+
+// announcements counts the notices published in [from, to) and how many of
+// their recipients read them; only the first maxNotices are itemized
+func (s *Service) announcements(ctx context.Context, dojoID string, from, to time.Time) (Announcements, error) {
+	out := Announcements{Notices: []NoticeSummary{}}
+	list, err := s.notificationsSvc.NoticesPublishedBetween(ctx, dojoID, from, to)
+	if err != nil {
+		return out, err
+	}
+	out.Published = len(list)
+	for i, n := range list {
+		if i == maxNotices {
+			break
+		}
+		st, err := s.notificationsSvc.GetNoticeStats(ctx, dojoID, n.ID)
+		if err != nil {
+			return out, err
+		}
+		out.Delivered += st.Delivered
+		out.Read += st.Read
+		out.Notices = append(out.Notices, NoticeSummary{
+			ID:        n.ID,
+			Title:     n.Title,
+			PublishAt: n.PublishAt,
+			Delivered: st.Delivered,
+			Read:      st.Read,
+		})
+	}
+	if out.Delivered > 0 {
+		out.ReadRate = float64(out.Read) / float64(out.Delivered)
+	}
+	return out, nil
+}
+
+// attendance compares the check-ins of [from, to) with the week before
+func (s *Service) attendance(ctx context.Context, dojoID string, from, to time.Time) (AttendanceDelta, error) {
+	var out AttendanceDelta
+	this, err := s.attendanceSvc.CheckinsByMemberBetween(ctx, dojoID, from, to)
+	if err != nil {
+		return out, err
+	}
+	prev, err := s.attendanceSvc.CheckinsByMemberBetween(ctx, dojoID, from.AddDate(0, 0, -7), from)
+	if err != nil {
+		return out, err
+	}
+	for _, n := range this {
+		out.Checkins += n
+	}
+	for _, n := range prev {
+		out.PreviousCheckins += n
+	}
+	out.Members, out.PreviousMembers = len(this), len(prev)
+	if out.PreviousCheckins > 0 {
+		change := float64(out.Checkins-out.PreviousCheckins) / float64(out.PreviousCheckins) * 100
+		out.ChangePercent = math.Round(change*10) / 10
+	}
+	return out, nil
+}
+
+// RecordDeparture notes that a member was removed from the roster, for the
+// week's digest. The name comes from the member's profile, which outlives
+// the member doc.
+func (s *Service) RecordDeparture(ctx context.Context, dojoID, memberUID, removedBy string, at time.Time) error {
+	dep := departure{MemberUID: memberUID, RemovedBy: removedBy, At: at.UTC()}
+	if doc, err := s.fs.Collection("users").Doc(memberUID).Get(ctx); err == nil {
+		dep.DisplayName, _ = doc.Data()["displayName"].(string)
+	}
+	if _, _, err := s.dojoRef(dojoID).Collection("departures").Add(ctx, dep); err != nil {
+		return fmt.Errorf("failed to record departure: %w", err)
+	}
+	return nil
+}
+
+// staffEmails reads the email addresses of the dojo's staff from their
+// profiles; staff without one get the in-app notification only
+func (s *Service) staffEmails(ctx context.Context, uids []string) map[string]string {
+	out := map[string]string{}
+	refs := make([]*firestore.DocumentRef, 0, len(uids))
+	for _, uid := range uids {
+		refs = append(refs, s.fs.Collection("users").Doc(uid))
+	}
+	if len(refs) == 0 {
+		return out
+	}
+	snaps, err := s.fs.GetAll(ctx, refs)
+	if err != nil {
+		return out
+	}
+	for _, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		if email, _ := snap.Data()["email"].(string); email != "" {
+			out[snap.Ref.ID] = email
+		}
+	}
+	return out
+}
+
+// dojoName is the dojo's name, "" when it cannot be read
+func (s *Service) dojoName(ctx context.Context, dojoID string) string {
+	d, err := s.dojoRepo.GetDojo(ctx, dojoID)
+	if err != nil {
+		return ""
+	}
+	return d.Name
+}
@@ -0,0 +1,206 @@
+package dojo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// DefaultLocale is the locale of dojos that have not set one
+const DefaultLocale = "en-US"
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// sundayRegions start their calendar weeks on Sunday; elsewhere weeks start
+// on Monday (ISO 8601)
+var sundayRegions = map[string]bool{
+	"US": true, "CA": true, "MX": true, "BR": true, "IL": true, "PH": true,
+	"TW": true, "HK": true, "KR": true, "IN": true, "ZA": true, "SA": true,
+}
+
+// twelveHourRegions read English times on a 12-hour clock
+var twelveHourRegions = map[string]bool{
+	"US": true, "CA": true, "AU": true, "NZ": true, "PH": true, "IN": true,
+}
+
+// CalendarSettings is dojos/{dojoId}/settings/calendar. Class days stay
+// 0=Sunday (session.Session.DayOfWeek) and dates stay YYYY-MM-DD in every
+// response; these settings only tell clients how to lay them out.
+type CalendarSettings struct {
+	// WeekStart is the first day of the week, 0=Sunday .. 6=Saturday; nil
+	// follows the locale
+	WeekStart *int      `firestore:"weekStart,omitempty" json:"weekStart,omitempty"`
+	Locale    string    `firestore:"locale,omitempty" json:"locale,omitempty"` // BCP 47, e.g. "ja-JP"
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdateCalendarInput changes the calendar settings (nil fields are left
+// unchanged; a negative weekStart goes back to following the locale)
+type UpdateCalendarInput struct {
+	WeekStart *int    `json:"weekStart,omitempty"`
+	Locale    *string `json:"locale,omitempty"` // "" for the default
+}
+
+// CalendarHints tell clients how to show the dojo's dates and times. The
+// formats are Unicode (CLDR) patterns, for clients without Intl support.
+type CalendarHints struct {
+	Locale       string `json:"locale"`
+	WeekStart    int    `json:"weekStart"`    // 0=Sunday .. 6=Saturday
+	WeekStartDay string `json:"weekStartDay"` // e.g. "monday"
+	Weekdays     []int  `json:"weekdays"`     // dayOfWeek values in calendar order
+	DateFormat   string `json:"dateFormat"`   // e.g. "yyyy/MM/dd"
+	TimeFormat   string `json:"timeFormat"`   // e.g. "HH:mm"
+	HourCycle    string `json:"hourCycle"`    // h12 or h23
+}
+
+// Hints resolves the settings for clients
+func (c *CalendarSettings) Hints() CalendarHints {
+	locale := DefaultLocale
+	if c != nil && c.Locale != "" {
+		locale = c.Locale
+	}
+	lang, region, _ := strings.Cut(locale, "-")
+
+	weekStart := int(time.Monday)
+	if sundayRegions[region] || (region == "" && lang == "en") {
+		weekStart = int(time.Sunday)
+	}
+	if c != nil && c.WeekStart != nil {
+		weekStart = *c.WeekStart
+	}
+
+	h := CalendarHints{
+		Locale:       locale,
+		WeekStart:    weekStart,
+		WeekStartDay: strings.ToLower(time.Weekday(weekStart).String()),
+		Weekdays:     make([]int, 7),
+		DateFormat:   "yyyy-MM-dd",
+		TimeFormat:   "HH:mm",
+		HourCycle:    "h23",
+	}
+	for i := range h.Weekdays {
+		h.Weekdays[i] = (weekStart + i) % 7
+	}
+
+	switch {
+	case lang == "ja" || lang == "zh" || region == "JP" || region == "TW":
+		h.DateFormat = "yyyy/MM/dd"
+	case lang == "ko":
+		h.DateFormat = "yyyy. M. d."
+	case locale == "en-US" || locale == "en" || region == "PH":
+		h.DateFormat = "M/d/yyyy"
+	case locale == "en-CA" || lang == "sv" || lang == "lt":
+		h.DateFormat = "yyyy-MM-dd"
+	case lang == "de" || lang == "ru" || lang == "pl" || lang == "fi" || lang == "nb" || lang == "da" || lang == "tr":
+		h.DateFormat = "dd.MM.yyyy"
+	case lang == "nl":
+		h.DateFormat = "dd-MM-yyyy"
+	default:
+		h.DateFormat = "dd/MM/yyyy"
+	}
+	if lang == "en" && (region == "" || twelveHourRegions[region]) {
+		h.TimeFormat, h.HourCycle = "h:mm a", "h12"
+	}
+	return h
+}
+
+// WeekOf is the first day (00:00 UTC) of the calendar week containing t
+func (h CalendarHints) WeekOf(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) - h.WeekStart + 7) % 7))
+}
+
+// DayIndex is the position of a dayOfWeek (0=Sunday) in the calendar week
+func (h CalendarHints) DayIndex(dayOfWeek int) int {
+	return (dayOfWeek - h.WeekStart + 7) % 7
+}
+
+func (r *Repo) calendarRef(dojoId string) *firestore.DocumentRef {
+	return r.fs.Collection("dojos").Doc(dojoId).Collection("settings").Doc("calendar")
+}
+
+// GetCalendarSettings loads the dojo's calendar settings (empty if not set)
+func (r *Repo) GetCalendarSettings(ctx context.Context, dojoId string) (*CalendarSettings, error) {
+	doc, err := r.calendarRef(dojoId).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load calendar settings: %w", err)
+	}
+	cs := &CalendarSettings{}
+	if doc.Exists() {
+		if err := doc.DataTo(cs); err != nil {
+			return nil, fmt.Errorf("failed to decode calendar settings: %w", err)
+		}
+	}
+	return cs, nil
+}
+
+// Calendar returns the calendar hints of the dojo, the defaults if its settings
+// cannot be read
+func (r *Repo) Calendar(ctx context.Context, dojoId string) CalendarHints {
+	cs, err := r.GetCalendarSettings(ctx, dojoId)
+	if err != nil {
+		cs = nil
+	}
+	return cs.Hints()
+}
+
+// UpdateCalendarSettings sets the dojo's week start and locale (the router
+// checks the settings permission)
+func (s *Service) UpdateCalendarSettings(ctx context.Context, uid, dojoId string, in UpdateCalendarInput) (*CalendarSettings, error) {
+	dojoId = strings.TrimSpace(dojoId)
+	if dojoId == "" {
+		return nil, fmt.Errorf("%w: dojoId required", ErrBadRequest)
+	}
+	cs, err := s.repo.GetCalendarSettings(ctx, dojoId)
+	if err != nil {
+		return nil, err
+	}
+	if in.WeekStart != nil {
+		switch ws := *in.WeekStart; {
+		case ws < 0:
+			cs.WeekStart = nil
+		case ws > 6:
+			return nil, fmt.Errorf("%w: weekStart must be 0 (Sunday) to 6 (Saturday)", ErrBadRequest)
+		default:
+			cs.WeekStart = &ws
+		}
+	}
+	if in.Locale != nil {
+		locale, err := normalizeLocale(*in.Locale)
+		if err != nil {
+			return nil, err
+		}
+		cs.Locale = locale
+	}
+	cs.UpdatedAt = time.Now().UTC()
+	cs.UpdatedBy = uid
+
+	if _, err := s.repo.calendarRef(dojoId).Set(ctx, cs); err != nil {
+		return nil, fmt.Errorf("failed to save calendar settings: %w", err)
+	}
+	return cs, nil
+}
+
+// normalizeLocale accepts language or language-region tags in any case
+// ("ja", "en_us", "pt-BR")
+func normalizeLocale(s string) (string, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "_", "-")
+	if s == "" {
+		return "", nil
+	}
+	lang, region, found := strings.Cut(s, "-")
+	s = strings.ToLower(lang)
+	if found {
+		s += "-" + strings.ToUpper(region)
+	}
+	if !localePattern.MatchString(s) {
+		return "", fmt.Errorf("%w: locale must be a language or language-region tag, e.g. ja-JP", ErrBadRequest)
+	}
+	return s, nil
+}
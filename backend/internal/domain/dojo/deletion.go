@@ -0,0 +1,179 @@
+package dojo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+)
+
+// DeletionStatus is returned by the deletion endpoints
+type DeletionStatus struct {
+	DojoID      string     `json:"dojoId"`
+	Status      string     `json:"status"`
+	RequestedAt *time.Time `json:"requestedAt,omitempty"`
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
+}
+
+// RequestDeletion marks a dojo pending-delete (owner only).
+// The dojo is hidden from search and read-only until it is purged after
+// DeletionGracePeriod; the Stripe subscription is set to cancel at period end.
+func (s *Service) RequestDeletion(ctx context.Context, ownerUid, dojoId string) (*DeletionStatus, error) {
+	d, err := s.ownedDojo(ctx, ownerUid, dojoId)
+	if err != nil {
+		return nil, err
+	}
+	if d.IsPendingDelete() {
+		return deletionStatusOf(d), nil
+	}
+
+	now := time.Now().UTC()
+	scheduled := now.Add(DeletionGracePeriod)
+	err = s.repo.SetDeletionState(ctx, d.ID, map[string]interface{}{
+		"status":              StatusPendingDelete,
+		"deletionRequestedBy": ownerUid,
+		"deletionRequestedAt": now,
+		"deletionScheduledAt": scheduled,
+		"updatedAt":           now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.stripeSvc != nil {
+		if err := s.stripeSvc.CancelSubscription(ctx, ownerUid, d.ID); err != nil && !stripedom.IsErrBadRequest(err) {
+			// no subscription is a bad request; anything else is worth a log line
+			log.Printf("dojo %s: cancel subscription on deletion failed: %v", d.ID, err)
+		}
+	}
+
+	return &DeletionStatus{DojoID: d.ID, Status: StatusPendingDelete, RequestedAt: &now, ScheduledAt: &scheduled}, nil
+}
+
+// CancelDeletion restores a pending-delete dojo during the grace period (owner only)
+func (s *Service) CancelDeletion(ctx context.Context, ownerUid, dojoId string) (*DeletionStatus, error) {
+	d, err := s.ownedDojo(ctx, ownerUid, dojoId)
+	if err != nil {
+		return nil, err
+	}
+	if !d.IsPendingDelete() {
+		return nil, fmt.Errorf("%w: dojo is not pending deletion", ErrBadRequest)
+	}
+
+	err = s.repo.SetDeletionState(ctx, d.ID, map[string]interface{}{
+		"status":              "",
+		"deletionRequestedBy": "",
+		"deletionRequestedAt": nil,
+		"deletionScheduledAt": nil,
+		"updatedAt":           time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.stripeSvc != nil {
+		if err := s.stripeSvc.ResumeSubscription(ctx, ownerUid, d.ID); err != nil && !stripedom.IsErrBadRequest(err) {
+			log.Printf("dojo %s: resume subscription after cancelled deletion failed: %v", d.ID, err)
+		}
+	}
+
+	return &DeletionStatus{DojoID: d.ID, Status: "active"}, nil
+}
+
+// GetDeletionStatus returns the deletion state of a dojo (owner only)
+func (s *Service) GetDeletionStatus(ctx context.Context, ownerUid, dojoId string) (*DeletionStatus, error) {
+	d, err := s.ownedDojo(ctx, ownerUid, dojoId)
+	if err != nil {
+		return nil, err
+	}
+	return deletionStatusOf(d), nil
+}
+
+// EnsureWritable returns ErrPendingDelete if the dojo is in its grace period
+// and ErrMaintenance while its maintenance switch is on
+func (s *Service) EnsureWritable(ctx context.Context, dojoId string) error {
+	d, err := s.repo.GetDojo(ctx, dojoId)
+	if err != nil {
+		// missing dojos are reported by the handler itself
+		return nil
+	}
+	if d.IsPendingDelete() {
+		return fmt.Errorf("%w: restore it before making changes", ErrPendingDelete)
+	}
+	if d.Maintenance.Active() {
+		if d.Maintenance.Message != "" {
+			return fmt.Errorf("%w: %s", ErrMaintenance, d.Maintenance.Message)
+		}
+		return fmt.Errorf("%w: you can still view its data, changes will be possible again shortly", ErrMaintenance)
+	}
+	return nil
+}
+
+// PurgeResult summarizes a purge run
+type PurgeResult struct {
+	Purged []string          `json:"purged"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// PurgeExpired permanently deletes dojos whose grace period ended before now.
+// Intended to be triggered by a scheduler (see /v1/admin/dojos/purge).
+func (s *Service) PurgeExpired(ctx context.Context, now time.Time) (*PurgeResult, error) {
+	list, err := s.repo.ListPendingDelete(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &PurgeResult{Purged: []string{}}
+	for i := range list {
+		d := &list[i]
+		if d.DeletionScheduledAt == nil || d.DeletionScheduledAt.After(now) {
+			continue
+		}
+
+		if s.stripeSvc != nil {
+			if err := s.stripeSvc.CancelSubscriptionNow(ctx, d.ID); err != nil {
+				log.Printf("dojo %s: cancel subscription before purge failed: %v", d.ID, err)
+			}
+		}
+
+		if err := s.repo.PurgeDojo(ctx, d); err != nil {
+			if res.Failed == nil {
+				res.Failed = map[string]string{}
+			}
+			res.Failed[d.ID] = err.Error()
+			continue
+		}
+		res.Purged = append(res.Purged, d.ID)
+	}
+	return res, nil
+}
+
+func (s *Service) ownedDojo(ctx context.Context, uid, dojoId string) (*Dojo, error) {
+	dojoId = strings.TrimSpace(dojoId)
+	if dojoId == "" {
+		return nil, fmt.Errorf("%w: dojoId required", ErrBadRequest)
+	}
+	d, err := s.repo.GetDojo(ctx, dojoId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	if !d.IsOwner(uid) {
+		return nil, fmt.Errorf("%w: only the dojo owner can delete a dojo", ErrUnauthorized)
+	}
+	return d, nil
+}
+
+func deletionStatusOf(d *Dojo) *DeletionStatus {
+	if !d.IsPendingDelete() {
+		return &DeletionStatus{DojoID: d.ID, Status: "active"}
+	}
+	return &DeletionStatus{
+		DojoID:      d.ID,
+		Status:      d.Status,
+		RequestedAt: d.DeletionRequestedAt,
+		ScheduledAt: d.DeletionScheduledAt,
+	}
+}
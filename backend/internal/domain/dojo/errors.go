@@ -3,11 +3,20 @@ package dojo
 import "errors"
 
 var (
-	ErrUnauthorized = errors.New("unauthorized")
-	ErrNotFound     = errors.New("not found")
-	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrNotFound      = errors.New("not found")
+	ErrBadRequest    = errors.New("bad request")
+	ErrPendingDelete = errors.New("dojo is pending deletion")
+	ErrMaintenance   = errors.New("dojo is under maintenance")
+
+	// ErrEmailNotVerified is answered with code "email_not_verified", which
+	// the app turns into a verify-your-email prompt
+	ErrEmailNotVerified = errors.New("email not verified")
 )
 
-func IsErrUnauthorized(err error) bool { return errors.Is(err, ErrUnauthorized) }
-func IsErrNotFound(err error) bool     { return errors.Is(err, ErrNotFound) }
-func IsErrBadRequest(err error) bool   { return errors.Is(err, ErrBadRequest) }
+func IsErrUnauthorized(err error) bool     { return errors.Is(err, ErrUnauthorized) }
+func IsErrNotFound(err error) bool         { return errors.Is(err, ErrNotFound) }
+func IsErrBadRequest(err error) bool       { return errors.Is(err, ErrBadRequest) }
+func IsErrPendingDelete(err error) bool    { return errors.Is(err, ErrPendingDelete) }
+func IsErrMaintenance(err error) bool      { return errors.Is(err, ErrMaintenance) }
+func IsErrEmailNotVerified(err error) bool { return errors.Is(err, ErrEmailNotVerified) }
@@ -0,0 +1,198 @@
+package dojo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Member numbers are short ids front-desk staff can type instead of a UID:
+// 1, 2, 3, ... in the order members are numbered, unique within a dojo and
+// never reused. The last one handed out is kept in
+// dojos/{dojoId}/settings/memberNumbers; the number itself is the member
+// doc's memberNumber field. Members are numbered when they are added, and
+// older members the first time their number is needed (badge, export).
+
+// MemberNumberField is the member doc field holding the number
+const MemberNumberField = "memberNumber"
+
+func (r *Repo) memberNumbersRef(dojoId string) *firestore.DocumentRef {
+	return r.fs.Collection("dojos").Doc(dojoId).Collection("settings").Doc("memberNumbers")
+}
+
+// MemberNumberOf reads a member doc's number (0 if not numbered yet)
+func MemberNumberOf(data map[string]interface{}) int {
+	return intValue(data[MemberNumberField])
+}
+
+func intValue(v interface{}) int {
+	switch n := v.(type) {
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// EnsureMemberNumber returns the member's number, assigning the next one
+// first if the member has none. The counter and the member doc change in one
+// transaction, so concurrent calls never hand out the same number.
+func (r *Repo) EnsureMemberNumber(ctx context.Context, dojoId, uid string) (int, error) {
+	memberRef := r.fs.Collection("dojos").Doc(dojoId).Collection("members").Doc(uid)
+	var number int
+	err := r.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		memberDoc, err := tx.Get(memberRef)
+		if err != nil {
+			if memberDoc != nil && !memberDoc.Exists() {
+				return fmt.Errorf("%w: member not found", ErrNotFound)
+			}
+			return err
+		}
+		if number = MemberNumberOf(memberDoc.Data()); number > 0 {
+			return nil
+		}
+
+		counterDoc, err := tx.Get(r.memberNumbersRef(dojoId))
+		if err != nil && counterDoc == nil {
+			return err
+		}
+		last := 0
+		if counterDoc.Exists() {
+			last = intValue(counterDoc.Data()["last"])
+		}
+		number = last + 1
+
+		if err := tx.Set(r.memberNumbersRef(dojoId), map[string]interface{}{"last": number}, firestore.MergeAll); err != nil {
+			return err
+		}
+		return tx.Update(memberRef, []firestore.Update{{Path: MemberNumberField, Value: number}})
+	})
+	if err != nil {
+		if IsErrNotFound(err) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to assign member number: %w", err)
+	}
+	return number, nil
+}
+
+// MemberUIDByNumber finds the member holding a number ("" if none does)
+func (r *Repo) MemberUIDByNumber(ctx context.Context, dojoId string, number int) (string, error) {
+	docs, err := r.fs.Collection("dojos").Doc(dojoId).Collection("members").
+		Where(MemberNumberField, "==", number).Select().Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up member number: %w", err)
+	}
+	if len(docs) == 0 {
+		return "", nil
+	}
+	return docs[0].Ref.ID, nil
+}
+
+// MemberUIDByEmail finds the member of the dojo with an email ("" if none).
+// Member docs carry a copy of the account email; members added before it was
+// copied are found through their users/{uid} profile.
+func (r *Repo) MemberUIDByEmail(ctx context.Context, dojoId, email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", nil
+	}
+	members := r.fs.Collection("dojos").Doc(dojoId).Collection("members")
+	docs, err := members.Where("email", "==", email).Select().Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up member email: %w", err)
+	}
+	if len(docs) > 0 {
+		return docs[0].Ref.ID, nil
+	}
+
+	users, err := r.fs.Collection("users").Where("email", "==", email).Select().Limit(5).Documents(ctx).GetAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up member email: %w", err)
+	}
+	for _, u := range users {
+		doc, err := members.Doc(u.Ref.ID).Get(ctx)
+		if err == nil && doc.Exists() {
+			return u.Ref.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// inQueryLimit is the most values a Firestore "in" filter takes
+const inQueryLimit = 30
+
+// MemberUIDsByNumber maps member numbers to the members holding them, in
+// batched "in" queries. Numbers no member holds are left out.
+func (r *Repo) MemberUIDsByNumber(ctx context.Context, dojoId string, numbers []int) (map[int]string, error) {
+	out := make(map[int]string, len(numbers))
+	members := r.fs.Collection("dojos").Doc(dojoId).Collection("members")
+	for start := 0; start < len(numbers); start += inQueryLimit {
+		chunk := numbers[start:min(start+inQueryLimit, len(numbers))]
+		docs, err := members.Where(MemberNumberField, "in", chunk).Select(MemberNumberField).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up member numbers: %w", err)
+		}
+		for _, doc := range docs {
+			if n := MemberNumberOf(doc.Data()); n > 0 {
+				out[n] = doc.Ref.ID
+			}
+		}
+	}
+	return out, nil
+}
+
+// MemberUIDsByEmail maps lower-cased emails to the members of the dojo with
+// them, in batched "in" queries, falling back to the users/{uid} profiles as
+// MemberUIDByEmail does. Emails matching no member are left out.
+func (r *Repo) MemberUIDsByEmail(ctx context.Context, dojoId string, emails []string) (map[string]string, error) {
+	out := make(map[string]string, len(emails))
+	members := r.fs.Collection("dojos").Doc(dojoId).Collection("members")
+	for start := 0; start < len(emails); start += inQueryLimit {
+		chunk := emails[start:min(start+inQueryLimit, len(emails))]
+		docs, err := members.Where("email", "in", chunk).Select("email").Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up member emails: %w", err)
+		}
+		for _, doc := range docs {
+			if email, _ := doc.Data()["email"].(string); email != "" {
+				out[email] = doc.Ref.ID
+			}
+		}
+	}
+
+	var missing []string
+	for _, email := range emails {
+		if _, ok := out[email]; !ok {
+			missing = append(missing, email)
+		}
+	}
+	for start := 0; start < len(missing); start += inQueryLimit {
+		chunk := missing[start:min(start+inQueryLimit, len(missing))]
+		users, err := r.fs.Collection("users").Where("email", "in", chunk).Select("email").Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up member emails: %w", err)
+		}
+		if len(users) == 0 {
+			continue
+		}
+		refs := make([]*firestore.DocumentRef, len(users))
+		for i, u := range users {
+			refs[i] = members.Doc(u.Ref.ID)
+		}
+		snaps, err := r.fs.GetAll(ctx, refs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up member emails: %w", err)
+		}
+		for i, snap := range snaps {
+			email, _ := users[i].Data()["email"].(string)
+			if _, found := out[email]; !found && email != "" && snap.Exists() {
+				out[email] = users[i].Ref.ID
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,49 @@
+package dojo
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// MembershipIndex is users/{uid}/dojoMemberships/{dojoId}, the per-user list
+// of dojos read by the app's dojo switcher. It mirrors the member doc and
+// has the same fields the store package writes.
+type MembershipIndex struct {
+	DojoID    string    `firestore:"dojoId" json:"dojoId"`
+	Role      string    `firestore:"role" json:"role"`
+	Status    string    `firestore:"status" json:"status"`
+	JoinedAt  time.Time `firestore:"joinedAt" json:"joinedAt"`
+	DojoName  string    `firestore:"dojoName" json:"dojoName"`
+	DojoSlug  string    `firestore:"dojoSlug" json:"dojoSlug"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// MembershipIndexRef returns users/{uid}/dojoMemberships/{dojoId}
+func (r *Repo) MembershipIndexRef(uid, dojoId string) *firestore.DocumentRef {
+	return r.fs.Collection("users").Doc(uid).Collection("dojoMemberships").Doc(dojoId)
+}
+
+// membershipIndexFields is the merge payload for an index doc; a zero
+// JoinedAt keeps the stored one
+func membershipIndexFields(idx MembershipIndex) map[string]interface{} {
+	fields := map[string]interface{}{
+		"dojoId":    idx.DojoID,
+		"role":      idx.Role,
+		"status":    idx.Status,
+		"dojoName":  idx.DojoName,
+		"dojoSlug":  idx.DojoSlug,
+		"updatedAt": time.Now().UTC(),
+	}
+	if !idx.JoinedAt.IsZero() {
+		fields["joinedAt"] = idx.JoinedAt
+	}
+	return fields
+}
+
+// PutMembershipIndex creates or updates a member's index entry
+func (r *Repo) PutMembershipIndex(ctx context.Context, uid string, idx MembershipIndex) error {
+	_, err := r.MembershipIndexRef(uid, idx.DojoID).Set(ctx, membershipIndexFields(idx), firestore.MergeAll)
+	return err
+}
@@ -3,6 +3,8 @@ package dojo
 import (
 	"strings"
 	"time"
+
+	"dojo-manager/backend/internal/domain/maintenance"
 )
 
 type Dojo struct {
@@ -18,10 +20,47 @@ type Dojo struct {
 	OwnerIds  []string `firestore:"ownerIds,omitempty" json:"ownerIds,omitempty"`
 	StaffUids []string `firestore:"staffUids,omitempty" json:"staffUids,omitempty"`
 
+	// Lifecycle: "" (active) or "pending_delete" during the deletion grace period
+	Status              string     `firestore:"status,omitempty" json:"status,omitempty"`
+	DeletionRequestedBy string     `firestore:"deletionRequestedBy,omitempty" json:"deletionRequestedBy,omitempty"`
+	DeletionRequestedAt *time.Time `firestore:"deletionRequestedAt,omitempty" json:"deletionRequestedAt,omitempty"`
+	DeletionScheduledAt *time.Time `firestore:"deletionScheduledAt,omitempty" json:"deletionScheduledAt,omitempty"`
+
+	// Maintenance makes the dojo read-only while operators migrate or restore it
+	Maintenance *maintenance.State `firestore:"maintenance,omitempty" json:"maintenance,omitempty"`
+
 	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
 }
 
+const (
+	StatusPendingDelete = "pending_delete"
+
+	// DeletionGracePeriod is how long a pending-delete dojo can still be restored
+	DeletionGracePeriod = 30 * 24 * time.Hour
+)
+
+// IsPendingDelete reports whether the dojo is in its deletion grace period
+func (d *Dojo) IsPendingDelete() bool {
+	return d != nil && d.Status == StatusPendingDelete
+}
+
+// IsOwner reports whether uid owns the dojo (ownerUid / ownerIds / createdBy)
+func (d *Dojo) IsOwner(uid string) bool {
+	if d == nil || uid == "" {
+		return false
+	}
+	if d.OwnerUID == uid || d.CreatedBy == uid {
+		return true
+	}
+	for _, o := range d.OwnerIds {
+		if o == uid {
+			return true
+		}
+	}
+	return false
+}
+
 type Membership struct {
 	UID       string    `firestore:"uid" json:"uid"`
 	Role      string    `firestore:"role" json:"role"` // student / staff
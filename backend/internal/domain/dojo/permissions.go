@@ -0,0 +1,241 @@
+package dojo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Permission is a single capability inside a dojo
+type Permission string
+
+const (
+	PermAttendanceWrite Permission = "attendance.write"
+	PermMembersView     Permission = "members.view"
+	PermMembersWrite    Permission = "members.write"
+	PermMembersDelete   Permission = "members.delete"
+	PermSessionsWrite   Permission = "sessions.write"
+	PermRanksWrite      Permission = "ranks.write"
+	PermNoticesWrite    Permission = "notices.write"
+	PermMediaWrite      Permission = "media.write"
+	PermBilling         Permission = "billing"
+	PermSettings        Permission = "settings"
+)
+
+// AllPermissions lists every known permission
+var AllPermissions = []Permission{
+	PermAttendanceWrite, PermMembersView, PermMembersWrite, PermMembersDelete,
+	PermSessionsWrite, PermRanksWrite, PermNoticesWrite, PermMediaWrite, PermBilling, PermSettings,
+}
+
+func IsValidPermission(p Permission) bool {
+	for _, v := range AllPermissions {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRolePermissions is the built-in permission matrix.
+// Owners and staff keep full powers; coaches run classes but cannot touch
+// billing, delete members or edit settings. Dojos can override per role.
+var DefaultRolePermissions = map[string][]Permission{
+	"owner":        AllPermissions,
+	"admin":        AllPermissions,
+	"staff":        AllPermissions,
+	"staff_member": AllPermissions,
+	"coach": {
+		PermAttendanceWrite, PermMembersView, PermSessionsWrite, PermRanksWrite, PermNoticesWrite, PermMediaWrite,
+	},
+	"instructor": {
+		PermAttendanceWrite, PermMembersView, PermSessionsWrite, PermRanksWrite, PermNoticesWrite, PermMediaWrite,
+	},
+}
+
+// PermissionSettings is dojos/{dojoId}/settings/permissions.
+// Roles maps role -> permission -> granted; listed entries override the defaults.
+type PermissionSettings struct {
+	Roles     map[string]map[string]bool `firestore:"roles" json:"roles"`
+	UpdatedAt time.Time                  `firestore:"updatedAt" json:"updatedAt"`
+	UpdatedBy string                     `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdatePermissionsInput replaces the per-role overrides of a dojo
+type UpdatePermissionsInput struct {
+	Roles map[string]map[string]bool `json:"roles"`
+}
+
+// PermissionMatrix is the effective role -> permissions view returned to clients
+type PermissionMatrix struct {
+	Roles     map[string][]Permission    `json:"roles"`
+	Overrides map[string]map[string]bool `json:"overrides"`
+}
+
+func (r *Repo) permissionsRef(dojoId string) *firestore.DocumentRef {
+	return r.fs.Collection("dojos").Doc(dojoId).Collection("settings").Doc("permissions")
+}
+
+// GetPermissionSettings loads per-dojo overrides (empty if not set)
+func (r *Repo) GetPermissionSettings(ctx context.Context, dojoId string) (*PermissionSettings, error) {
+	doc, err := r.permissionsRef(dojoId).Get(ctx)
+	if err != nil {
+		// Document doesn't exist → built-in matrix only
+		return &PermissionSettings{Roles: map[string]map[string]bool{}}, nil
+	}
+	var ps PermissionSettings
+	if err := doc.DataTo(&ps); err != nil {
+		return nil, err
+	}
+	if ps.Roles == nil {
+		ps.Roles = map[string]map[string]bool{}
+	}
+	return &ps, nil
+}
+
+func (r *Repo) PutPermissionSettings(ctx context.Context, dojoId string, ps PermissionSettings) error {
+	_, err := r.permissionsRef(dojoId).Set(ctx, ps)
+	return err
+}
+
+// RoleOf returns the caller's role inside the dojo ("owner", "staff", "coach", ...).
+// Empty means the user has no role in the dojo.
+func (r *Repo) RoleOf(ctx context.Context, dojoId, uid string) (string, error) {
+	d, err := r.GetDojo(ctx, dojoId)
+	if err != nil {
+		return "", err
+	}
+	if d.IsOwner(uid) {
+		return "owner", nil
+	}
+
+	role := ""
+	memberDoc, err := r.fs.Collection("dojos").Doc(dojoId).Collection("members").Doc(uid).Get(ctx)
+	if err == nil && memberDoc.Exists() {
+		data := memberDoc.Data()
+		if v, ok := data["roleInDojo"].(string); ok && v != "" {
+			role = v
+		} else if v, ok := data["role"].(string); ok {
+			role = v
+		}
+	}
+	role = strings.ToLower(strings.TrimSpace(role))
+
+	// staffUids grants staff unless the member doc narrows it to coach
+	if _, known := DefaultRolePermissions[role]; !known {
+		for _, s := range d.StaffUids {
+			if s == uid {
+				return "staff", nil
+			}
+		}
+	}
+	return role, nil
+}
+
+// HasPermission checks the caller's dojo role against the matrix plus per-dojo overrides
+func (r *Repo) HasPermission(ctx context.Context, dojoId, uid string, perm Permission) (bool, error) {
+	role, err := r.RoleOf(ctx, dojoId, uid)
+	if err != nil {
+		return false, err
+	}
+	if role == "" {
+		return false, nil
+	}
+	// owners can never lock themselves out
+	if role == "owner" {
+		return true, nil
+	}
+
+	ps, err := r.GetPermissionSettings(ctx, dojoId)
+	if err != nil {
+		return false, err
+	}
+	return roleHasPermission(role, perm, ps.Roles), nil
+}
+
+func roleHasPermission(role string, perm Permission, overrides map[string]map[string]bool) bool {
+	if granted, ok := overrides[role][string(perm)]; ok {
+		return granted
+	}
+	for _, p := range DefaultRolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPermissions returns the effective permission matrix of a dojo (staff only)
+func (s *Service) GetPermissions(ctx context.Context, uid, dojoId string) (*PermissionMatrix, error) {
+	isStaff, err := s.repo.IsStaff(ctx, dojoId, uid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: only dojo staff can view permissions", ErrUnauthorized)
+	}
+
+	ps, err := s.repo.GetPermissionSettings(ctx, dojoId)
+	if err != nil {
+		return nil, err
+	}
+	return effectiveMatrix(ps.Roles), nil
+}
+
+// UpdatePermissions replaces the per-role overrides (requires the settings permission)
+func (s *Service) UpdatePermissions(ctx context.Context, uid, dojoId string, in UpdatePermissionsInput) (*PermissionMatrix, error) {
+	ok, err := s.repo.HasPermission(ctx, dojoId, uid, PermSettings)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: settings permission required", ErrUnauthorized)
+	}
+
+	roles := map[string]map[string]bool{}
+	for role, perms := range in.Roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role == "" || role == "owner" {
+			return nil, fmt.Errorf("%w: owner permissions cannot be overridden", ErrBadRequest)
+		}
+		clean := map[string]bool{}
+		for p, granted := range perms {
+			if !IsValidPermission(Permission(p)) {
+				return nil, fmt.Errorf("%w: unknown permission %q", ErrBadRequest, p)
+			}
+			clean[p] = granted
+		}
+		roles[role] = clean
+	}
+
+	ps := PermissionSettings{Roles: roles, UpdatedAt: time.Now().UTC(), UpdatedBy: uid}
+	if err := s.repo.PutPermissionSettings(ctx, dojoId, ps); err != nil {
+		return nil, err
+	}
+	return effectiveMatrix(roles), nil
+}
+
+func effectiveMatrix(overrides map[string]map[string]bool) *PermissionMatrix {
+	roles := map[string]bool{}
+	for role := range DefaultRolePermissions {
+		roles[role] = true
+	}
+	for role := range overrides {
+		roles[role] = true
+	}
+
+	out := &PermissionMatrix{Roles: map[string][]Permission{}, Overrides: overrides}
+	for role := range roles {
+		perms := []Permission{}
+		for _, p := range AllPermissions {
+			if role == "owner" || roleHasPermission(role, p, overrides) {
+				perms = append(perms, p)
+			}
+		}
+		out.Roles[role] = perms
+	}
+	return out
+}
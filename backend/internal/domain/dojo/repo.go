@@ -7,16 +7,24 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/firebase"
 )
 
 type Repo struct {
-	fs *firestore.Client
+	fs       *firestore.Client
+	registry *firebase.DojoRegistry // per-dojo databases (data residency), optional
 }
 
 func NewRepo(fs *firestore.Client) *Repo {
 	return &Repo{fs: fs}
 }
 
+// SetDojoRegistry makes PurgeDojo also purge a dojo's regional database
+func (r *Repo) SetDojoRegistry(registry *firebase.DojoRegistry) {
+	r.registry = registry
+}
+
 func (r *Repo) CreateDojo(ctx context.Context, d Dojo) (*Dojo, error) {
 	ref := r.fs.Collection("dojos").NewDoc()
 	d.ID = ref.ID
@@ -102,12 +110,43 @@ func (r *Repo) GetJoinRequest(ctx context.Context, dojoId, uid string) (*JoinReq
 	return &jr, nil
 }
 
+// AddMember writes the member doc together with the member's
+// users/{uid}/dojoMemberships index entry
 func (r *Repo) AddMember(ctx context.Context, dojoId string, m Membership) (*Membership, error) {
+	d, err := r.GetDojo(ctx, dojoId)
+	if err != nil {
+		return nil, err
+	}
+
 	ref := r.fs.Collection("dojos").Doc(dojoId).Collection("members").Doc(m.UID)
-	_, err := ref.Set(ctx, m, firestore.MergeAll)
+	batch := r.fs.Batch()
+	batch.Set(ref, m, firestore.MergeAll)
+	batch.Set(r.MembershipIndexRef(m.UID, dojoId), membershipIndexFields(MembershipIndex{
+		DojoID:   dojoId,
+		Role:     m.Role,
+		Status:   "active",
+		JoinedAt: m.JoinedAt,
+		DojoName: d.Name,
+		DojoSlug: d.Slug,
+	}), firestore.MergeAll)
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *Repo) GetMember(ctx context.Context, dojoId, uid string) (*Membership, error) {
+	doc, err := r.fs.Collection("dojos").Doc(dojoId).Collection("members").Doc(uid).Get(ctx)
 	if err != nil {
 		return nil, err
 	}
+	var m Membership
+	if err := doc.DataTo(&m); err != nil {
+		return nil, err
+	}
+	if m.UID == "" {
+		m.UID = uid
+	}
 	return &m, nil
 }
 
@@ -162,4 +201,201 @@ func (r *Repo) IsStaff(ctx context.Context, dojoId, uid string) (bool, error) {
 	return false, nil
 }
 
+// staffRoles are member roles that count as dojo staff
+var staffRoles = []string{"owner", "admin", "staff", "staff_member", "coach", "instructor"}
+
+// ListStaffUIDs returns the owners and staff of a dojo, from the dojo doc and
+// the members subcollection (role or roleInDojo)
+func (r *Repo) ListStaffUIDs(ctx context.Context, dojoId string) ([]string, error) {
+	d, err := r.GetDojo(ctx, dojoId)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	out := []string{}
+	add := func(uid string) {
+		if uid != "" && !seen[uid] {
+			seen[uid] = true
+			out = append(out, uid)
+		}
+	}
+	add(d.OwnerUID)
+	add(d.CreatedBy)
+	for _, uid := range d.OwnerIds {
+		add(uid)
+	}
+	for _, uid := range d.StaffUids {
+		add(uid)
+	}
+
+	members := r.fs.Collection("dojos").Doc(dojoId).Collection("members")
+	for _, field := range []string{"role", "roleInDojo"} {
+		docs, err := members.Where(field, "in", staffRoles).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			add(doc.Ref.ID)
+		}
+	}
+	return out, nil
+}
+
 func now() time.Time { return time.Now().UTC() }
+
+// SetDeletionState merges deletion lifecycle fields into dojos/{dojoId}
+func (r *Repo) SetDeletionState(ctx context.Context, dojoId string, fields map[string]interface{}) error {
+	_, err := r.fs.Collection("dojos").Doc(dojoId).Set(ctx, fields, firestore.MergeAll)
+	return err
+}
+
+// ListPendingDelete returns dojos currently in their deletion grace period
+func (r *Repo) ListPendingDelete(ctx context.Context) ([]Dojo, error) {
+	it := r.fs.Collection("dojos").Where("status", "==", StatusPendingDelete).Documents(ctx)
+	defer it.Stop()
+
+	out := []Dojo{}
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var d Dojo
+		if err := doc.DataTo(&d); err != nil {
+			return nil, err
+		}
+		if d.ID == "" {
+			d.ID = doc.Ref.ID
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// PurgeDojo removes the dojo document, every subcollection under it and the
+// users/{uid}/dojoMemberships/{dojoId} index entries of its members. A dojo
+// in a regional database is purged there first, and its registry entry is
+// removed last, so a purge that fails halfway is retried against the same
+// database.
+func (r *Repo) PurgeDojo(ctx context.Context, d *Dojo) error {
+	dojoRef := r.fs.Collection("dojos").Doc(d.ID)
+
+	if r.registry != nil {
+		db, err := r.registry.ClientFor(ctx, d.ID)
+		if err != nil {
+			return err
+		}
+		if db != r.fs {
+			regional := db.Collection("dojos").Doc(d.ID)
+			if err := r.deleteSubcollections(ctx, db, regional); err != nil {
+				return err
+			}
+			if _, err := regional.Delete(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	// collect member uids before the members subcollection is gone
+	uids := map[string]struct{}{}
+	for _, uid := range append(append([]string{d.OwnerUID, d.CreatedBy}, d.OwnerIds...), d.StaffUids...) {
+		if uid != "" {
+			uids[uid] = struct{}{}
+		}
+	}
+	refs, err := dojoRef.Collection("members").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		uids[ref.ID] = struct{}{}
+	}
+
+	indexRefs := make([]*firestore.DocumentRef, 0, len(uids))
+	for uid := range uids {
+		indexRefs = append(indexRefs, r.fs.Collection("users").Doc(uid).Collection("dojoMemberships").Doc(d.ID))
+	}
+	if err := r.deleteRefs(ctx, r.fs, indexRefs); err != nil {
+		return err
+	}
+
+	if err := r.deleteSubcollections(ctx, r.fs, dojoRef); err != nil {
+		return err
+	}
+	if _, err := dojoRef.Delete(ctx); err != nil {
+		return err
+	}
+	if r.registry != nil {
+		return r.registry.DeleteLocation(ctx, d.ID)
+	}
+	return nil
+}
+
+// purgeBatchSize stays under Firestore's 500 writes per batch
+const purgeBatchSize = 400
+
+// deleteSubcollections deletes everything under ref, which is in db
+func (r *Repo) deleteSubcollections(ctx context.Context, db *firestore.Client, ref *firestore.DocumentRef) error {
+	cols, err := ref.Collections(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, col := range cols {
+		// DocumentRefs also returns "missing" docs that only hold subcollections
+		refs, err := col.DocumentRefs(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, child := range refs {
+			if err := r.deleteSubcollections(ctx, db, child); err != nil {
+				return err
+			}
+		}
+		if err := r.deleteRefs(ctx, db, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repo) deleteRefs(ctx context.Context, db *firestore.Client, refs []*firestore.DocumentRef) error {
+	for start := 0; start < len(refs); start += purgeBatchSize {
+		end := start + purgeBatchSize
+		if end > len(refs) {
+			end = len(refs)
+		}
+		batch := db.Batch()
+		for _, ref := range refs[start:end] {
+			batch.Delete(ref)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountPendingJoinRequests counts join requests awaiting approval
+func (r *Repo) CountPendingJoinRequests(ctx context.Context, dojoId string) (int, error) {
+	iter := r.fs.Collection("dojos").Doc(dojoId).Collection("joinRequests").
+		Where("status", "==", "pending").
+		Documents(ctx)
+	defer iter.Stop()
+
+	count := 0
+	for {
+		_, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -7,18 +7,35 @@ import (
 	"strings"
 	"time"
 
+	"firebase.google.com/go/v4/auth"
+
+	stripedom "dojo-manager/backend/internal/domain/stripe"
 	"dojo-manager/backend/internal/domain/user"
+	"dojo-manager/backend/internal/events"
 )
 
 type Service struct {
-	repo     *Repo
-	userRepo *user.Repo
+	repo       *Repo
+	userRepo   *user.Repo
+	stripeSvc  *stripedom.Service
+	bus        *events.Bus
+	authClient *auth.Client
 }
 
 func NewService(repo *Repo, userRepo *user.Repo) *Service {
 	return &Service{repo: repo, userRepo: userRepo}
 }
 
+// SetStripeService sets the stripe service used to cancel subscriptions on deletion
+func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
+	s.stripeSvc = stripeSvc
+}
+
+// SetEventBus publishes JoinRequested and MemberChanged for approved requests
+func (s *Service) SetEventBus(bus *events.Bus) {
+	s.bus = bus
+}
+
 func (s *Service) CreateDojo(ctx context.Context, staffUid string, in CreateDojoInput) (*Dojo, error) {
 	if in.Name == "" {
 		return nil, fmt.Errorf("%w: name is required", ErrBadRequest)
@@ -62,7 +79,19 @@ func (s *Service) SearchDojos(ctx context.Context, q string, limit int64) ([]Doj
 	if limit <= 0 || limit > 50 {
 		limit = 20
 	}
-	return s.repo.SearchDojosByNamePrefix(ctx, q, limit)
+	list, err := s.repo.SearchDojosByNamePrefix(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// pending-delete dojos are hidden from search
+	out := list[:0]
+	for _, d := range list {
+		if !d.IsPendingDelete() {
+			out = append(out, d)
+		}
+	}
+	return out, nil
 }
 
 func (s *Service) CreateJoinRequest(ctx context.Context, studentUid, dojoId string, in CreateJoinRequestInput) (*JoinRequest, error) {
@@ -79,6 +108,9 @@ func (s *Service) CreateJoinRequest(ctx context.Context, studentUid, dojoId stri
 	if err != nil {
 		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
 	}
+	if err := s.checkVerifiedEmail(ctx, dojoId, studentUid); err != nil {
+		return nil, err
+	}
 
 	now := time.Now().UTC()
 	jr := JoinRequest{
@@ -91,7 +123,13 @@ func (s *Service) CreateJoinRequest(ctx context.Context, studentUid, dojoId stri
 		UpdatedAt: now,
 	}
 
-	return s.repo.PutJoinRequest(ctx, dojoId, studentUid, jr)
+	out, err := s.repo.PutJoinRequest(ctx, dojoId, studentUid, jr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.bus.Publish(ctx, events.JoinRequested{DojoID: dojoId, UID: studentUid, FullName: out.FullName, Belt: out.Belt})
+	return out, nil
 }
 
 func (s *Service) ApproveJoinRequest(ctx context.Context, staffUid, dojoId, studentUid string) (map[string]any, error) {
@@ -114,6 +152,10 @@ func (s *Service) ApproveJoinRequest(ctx context.Context, staffUid, dojoId, stud
 	if jr.Status == "approved" {
 		return map[string]any{"ok": true, "status": "already_approved"}, nil
 	}
+	// the student may have made the request before the dojo required it
+	if err := s.checkVerifiedEmail(ctx, dojoId, studentUid); err != nil {
+		return nil, err
+	}
 
 	now := time.Now().UTC()
 	jr.Status = "approved"
@@ -135,6 +177,7 @@ func (s *Service) ApproveJoinRequest(ctx context.Context, staffUid, dojoId, stud
 	if err != nil {
 		return nil, err
 	}
+	s.bus.Publish(ctx, events.MemberChanged{DojoID: dojoId, MemberUID: studentUid, ChangedBy: staffUid, Change: events.MemberAdded})
 
 	return map[string]any{
 		"ok":        true,
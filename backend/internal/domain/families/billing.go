@@ -0,0 +1,161 @@
+package families
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+)
+
+// GetBillingSettings returns the per-member family price; nil if not set up
+func (s *Service) GetBillingSettings(ctx context.Context, dojoID string) (*BillingSettings, error) {
+	doc, err := s.billingRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get family billing settings: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, nil
+	}
+	var b BillingSettings
+	if err := doc.DataTo(&b); err != nil {
+		return nil, fmt.Errorf("failed to decode family billing settings: %w", err)
+	}
+	return &b, nil
+}
+
+// UpdateBillingSettings sets the per-member family price (staff only).
+// Applies to new family subscriptions; running ones keep their price.
+func (s *Service) UpdateBillingSettings(ctx context.Context, staffUID, dojoID string, in BillingSettingsInput) (*BillingSettings, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.AmountCents <= 0 {
+		return nil, fmt.Errorf("%w: amountCents must be positive", ErrBadRequest)
+	}
+	if in.Interval != "month" && in.Interval != "year" {
+		return nil, fmt.Errorf("%w: interval must be 'month' or 'year'", ErrBadRequest)
+	}
+	if in.Currency == "" {
+		in.Currency = stripedom.DefaultCurrency
+		if s.stripeSvc != nil {
+			in.Currency = s.stripeSvc.Currency(ctx, dojoID)
+		}
+	}
+	if len(in.Currency) != 3 {
+		return nil, fmt.Errorf("%w: currency must be a 3-letter ISO code", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	b := BillingSettings{
+		AmountCents: in.AmountCents,
+		Currency:    in.Currency,
+		Interval:    in.Interval,
+		UpdatedBy:   staffUID,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if _, err := s.billingRef(dojoID).Set(ctx, b); err != nil {
+		return nil, fmt.Errorf("failed to save family billing settings: %w", err)
+	}
+	return &b, nil
+}
+
+// CreateCheckout starts the family subscription: one unit per linked member,
+// paid by the family's payer
+func (s *Service) CreateCheckout(ctx context.Context, uid, dojoID, familyID string, in CheckoutInput) (string, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	familyID = strings.TrimSpace(familyID)
+	if dojoID == "" || familyID == "" {
+		return "", fmt.Errorf("%w: dojoId and familyId are required", ErrBadRequest)
+	}
+	if s.stripeSvc == nil {
+		return "", fmt.Errorf("%w: payments are not configured", ErrBadRequest)
+	}
+
+	f, err := s.getFamily(ctx, dojoID, familyID)
+	if err != nil {
+		return "", err
+	}
+	if f.PayerUID != uid {
+		return "", fmt.Errorf("%w: only the family payer can start the subscription", ErrUnauthorized)
+	}
+	if f.HasActiveSubscription() {
+		return "", fmt.Errorf("%w: family already has a subscription", ErrConflict)
+	}
+
+	b, err := s.GetBillingSettings(ctx, dojoID)
+	if err != nil {
+		return "", err
+	}
+	if b == nil {
+		return "", fmt.Errorf("%w: the dojo has not set up family billing", ErrBadRequest)
+	}
+
+	var email string
+	if userDoc, err := s.fs.Collection("users").Doc(uid).Get(ctx); err == nil {
+		email, _ = userDoc.Data()["email"].(string)
+	}
+	dojoName := ""
+	if d, err := s.dojoRepo.GetDojo(ctx, dojoID); err == nil && d != nil {
+		dojoName = d.Name
+	}
+
+	return s.stripeSvc.CreateSubscriptionCheckout(ctx, stripedom.SubscriptionCheckoutInput{
+		Kind:          SubscriptionKind,
+		Name:          strings.TrimSpace(dojoName + " family membership"),
+		AmountCents:   b.AmountCents,
+		Currency:      b.Currency,
+		Interval:      b.Interval,
+		Quantity:      int64(len(f.MemberUIDs)),
+		CustomerEmail: email,
+		SuccessURL:    in.SuccessURL,
+		CancelURL:     in.CancelURL,
+		Metadata: map[string]string{
+			"dojoId":   dojoID,
+			"familyId": familyID,
+			"payerUid": uid,
+		},
+	})
+}
+
+// HandleSubscription mirrors Stripe subscription state onto the family.
+// Called from the Stripe webhook.
+func (s *Service) HandleSubscription(ctx context.Context, u stripedom.SubscriptionUpdate) error {
+	dojoID := u.Metadata["dojoId"]
+	familyID := u.Metadata["familyId"]
+	if dojoID == "" || familyID == "" {
+		return fmt.Errorf("missing dojoId/familyId in subscription metadata")
+	}
+
+	ref := s.familiesCol(dojoID).Doc(familyID)
+	if _, err := ref.Get(ctx); err != nil {
+		return fmt.Errorf("family %s/%s not found for subscription %s", dojoID, familyID, u.SubscriptionID)
+	}
+
+	updates := map[string]interface{}{
+		"subscriptionId":     u.SubscriptionID,
+		"subscriptionStatus": u.Status,
+		"billedQuantity":     u.Quantity,
+		"periodEnd":          u.CurrentPeriodEnd,
+		"cancelAtPeriodEnd":  u.CancelAtPeriodEnd,
+		"updatedAt":          time.Now().UTC(),
+	}
+	if u.Deleted {
+		updates["subscriptionId"] = firestore.Delete
+		updates["subscriptionStatus"] = "canceled"
+		updates["periodEnd"] = firestore.Delete
+		updates["cancelAtPeriodEnd"] = false
+	}
+	if _, err := ref.Set(ctx, updates, firestore.MergeAll); err != nil {
+		return fmt.Errorf("failed to update family subscription: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package families
+
+import (
+	"context"
+	"fmt"
+)
+
+// GuardianOf returns the uid of the member's guardian in the dojo: the payer
+// of the family the member belongs to. It is "" when the member is in no
+// family or pays for themselves.
+func (s *Service) GuardianOf(ctx context.Context, dojoID, memberUID string) (string, error) {
+	doc, err := s.memberRef(dojoID, memberUID).Get(ctx)
+	if err != nil && doc == nil {
+		return "", fmt.Errorf("failed to load member: %w", err)
+	}
+	if !doc.Exists() {
+		return "", nil
+	}
+	familyID, _ := doc.Data()["familyId"].(string)
+	if familyID == "" {
+		return "", nil
+	}
+	f, err := s.getFamily(ctx, dojoID, familyID)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if f.PayerUID == memberUID {
+		return "", nil
+	}
+	return f.PayerUID, nil
+}
@@ -0,0 +1,115 @@
+package families
+
+import (
+	"strings"
+	"time"
+)
+
+const maxFamilyMembers = 10
+
+// Family is a dojos/{dojoId}/families document: member accounts billed
+// together to one payer. Each member doc carries familyId so a member can
+// only belong to one family per dojo. The payer need not train.
+type Family struct {
+	ID                 string     `firestore:"-" json:"id"`
+	Name               string     `firestore:"name" json:"name"`
+	PayerUID           string     `firestore:"payerUid" json:"payerUid"`
+	MemberUIDs         []string   `firestore:"memberUids" json:"memberUids"`
+	SubscriptionID     string     `firestore:"subscriptionId,omitempty" json:"subscriptionId,omitempty"`
+	SubscriptionStatus string     `firestore:"subscriptionStatus,omitempty" json:"subscriptionStatus,omitempty"`
+	BilledQuantity     int64      `firestore:"billedQuantity,omitempty" json:"billedQuantity,omitempty"`
+	PeriodEnd          *time.Time `firestore:"periodEnd,omitempty" json:"periodEnd,omitempty"`
+	CancelAtPeriodEnd  bool       `firestore:"cancelAtPeriodEnd" json:"cancelAtPeriodEnd"`
+	CreatedBy          string     `firestore:"createdBy" json:"createdBy"`
+	CreatedAt          time.Time  `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt          time.Time  `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// HasActiveSubscription reports whether the family is currently billed
+func (f Family) HasActiveSubscription() bool {
+	return f.SubscriptionID != "" && f.SubscriptionStatus != "canceled" && f.SubscriptionStatus != "incomplete_expired"
+}
+
+// BillingSettings is dojos/{dojoId}/settings/familyBilling: the per-member
+// price of a family membership
+type BillingSettings struct {
+	AmountCents int64     `firestore:"amountCents" json:"amountCents"`
+	Currency    string    `firestore:"currency" json:"currency"`
+	Interval    string    `firestore:"interval" json:"interval"` // month / year
+	UpdatedBy   string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+	UpdatedAt   time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// CreateFamilyInput is the body of POST /v1/dojos/{dojoId}/families
+type CreateFamilyInput struct {
+	Name       string   `json:"name"`
+	PayerUID   string   `json:"payerUid"`
+	MemberUIDs []string `json:"memberUids"`
+}
+
+func (in *CreateFamilyInput) Trim() {
+	in.Name = strings.TrimSpace(in.Name)
+	in.PayerUID = strings.TrimSpace(in.PayerUID)
+	in.MemberUIDs = dedupe(in.MemberUIDs)
+}
+
+// UpdateFamilyInput is the body of PUT /v1/dojos/{dojoId}/families/{familyId}
+type UpdateFamilyInput struct {
+	Name     *string `json:"name,omitempty"`
+	PayerUID *string `json:"payerUid,omitempty"`
+}
+
+// BillingSettingsInput is the body of PUT /v1/dojos/{dojoId}/families/billing
+type BillingSettingsInput struct {
+	AmountCents int64  `json:"amountCents"`
+	Currency    string `json:"currency,omitempty"`
+	Interval    string `json:"interval"`
+}
+
+func (in *BillingSettingsInput) Trim() {
+	in.Currency = strings.ToLower(strings.TrimSpace(in.Currency))
+	in.Interval = strings.ToLower(strings.TrimSpace(in.Interval))
+}
+
+// CheckoutInput is the body of POST .../families/{familyId}/checkout
+type CheckoutInput struct {
+	SuccessURL string `json:"successUrl"`
+	CancelURL  string `json:"cancelUrl"`
+}
+
+func (in *CheckoutInput) Trim() {
+	in.SuccessURL = strings.TrimSpace(in.SuccessURL)
+	in.CancelURL = strings.TrimSpace(in.CancelURL)
+}
+
+// FamilyView is what the paying parent sees: everyone's rank and attendance
+type FamilyView struct {
+	Family  Family             `json:"family"`
+	Members []FamilyMemberView `json:"members"`
+}
+
+type FamilyMemberView struct {
+	UID           string     `json:"uid"`
+	DisplayName   string     `json:"displayName"`
+	PhotoURL      string     `json:"photoURL,omitempty"`
+	BeltRank      string     `json:"beltRank,omitempty"`
+	Stripes       int        `json:"stripes"`
+	Status        string     `json:"status,omitempty"`
+	TotalCheckins int        `json:"totalCheckins"`
+	Last30Days    int        `json:"last30Days"`
+	LastCheckinAt *time.Time `json:"lastCheckinAt,omitempty"`
+}
+
+func dedupe(uids []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(uids))
+	for _, u := range uids {
+		u = strings.TrimSpace(u)
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		out = append(out, u)
+	}
+	return out
+}
@@ -0,0 +1,421 @@
+package families
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+)
+
+// SubscriptionKind is the Stripe metadata kind of family subscriptions
+const SubscriptionKind = "family_membership"
+
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	stripeSvc     *stripedom.Service  // shared billing (optional)
+	attendanceSvc *attendance.Service // family view attendance (optional)
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo}
+}
+
+// SetStripeService enables family billing and registers the subscription handler
+func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
+	s.stripeSvc = stripeSvc
+	stripeSvc.SetSubscriptionHandler(SubscriptionKind, s.HandleSubscription)
+}
+
+// SetAttendanceService sets the attendance service used by the family view
+func (s *Service) SetAttendanceService(attendanceSvc *attendance.Service) {
+	s.attendanceSvc = attendanceSvc
+}
+
+func (s *Service) familiesCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("families")
+}
+
+func (s *Service) memberRef(dojoID, uid string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("members").Doc(uid)
+}
+
+func (s *Service) billingRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("familyBilling")
+}
+
+func (s *Service) isStaff(ctx context.Context, dojoID, uid string) (bool, error) {
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return false, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	return isStaff, nil
+}
+
+func (s *Service) requireStaff(ctx context.Context, dojoID, uid string) error {
+	isStaff, err := s.isStaff(ctx, dojoID, uid)
+	if err != nil {
+		return err
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+	return nil
+}
+
+func (s *Service) getFamily(ctx context.Context, dojoID, familyID string) (*Family, error) {
+	doc, err := s.familiesCol(dojoID).Doc(familyID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: family not found", ErrNotFound)
+	}
+	var f Family
+	if err := doc.DataTo(&f); err != nil {
+		return nil, fmt.Errorf("failed to decode family: %w", err)
+	}
+	f.ID = doc.Ref.ID
+	return &f, nil
+}
+
+// getForViewer loads a family visible to staff or its payer
+func (s *Service) getForViewer(ctx context.Context, uid, dojoID, familyID string) (*Family, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	familyID = strings.TrimSpace(familyID)
+	if dojoID == "" || familyID == "" {
+		return nil, fmt.Errorf("%w: dojoId and familyId are required", ErrBadRequest)
+	}
+	f, err := s.getFamily(ctx, dojoID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if f.PayerUID == uid {
+		return f, nil
+	}
+	if err := s.requireStaff(ctx, dojoID, uid); err != nil {
+		return nil, fmt.Errorf("%w: only staff or the payer can view this family", ErrUnauthorized)
+	}
+	return f, nil
+}
+
+// ListFamilies lists all families for staff, or the ones the caller pays for
+func (s *Service) ListFamilies(ctx context.Context, uid, dojoID string) ([]Family, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	isStaff, err := s.isStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	q := s.familiesCol(dojoID).Query
+	if !isStaff {
+		q = q.Where("payerUid", "==", uid)
+	}
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	out := []Family{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list families: %w", err)
+		}
+		var f Family
+		if err := doc.DataTo(&f); err != nil {
+			continue
+		}
+		f.ID = doc.Ref.ID
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// GetFamily returns a family (staff or payer)
+func (s *Service) GetFamily(ctx context.Context, uid, dojoID, familyID string) (*Family, error) {
+	return s.getForViewer(ctx, uid, dojoID, familyID)
+}
+
+// CreateFamily links member accounts into a family with one payer (staff only)
+func (s *Service) CreateFamily(ctx context.Context, staffUID, dojoID string, in CreateFamilyInput) (*Family, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.Name == "" || in.PayerUID == "" {
+		return nil, fmt.Errorf("%w: name and payerUid are required", ErrBadRequest)
+	}
+	if len(in.MemberUIDs) == 0 || len(in.MemberUIDs) > maxFamilyMembers {
+		return nil, fmt.Errorf("%w: a family has 1-%d members", ErrBadRequest, maxFamilyMembers)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	if err := s.requireUser(ctx, in.PayerUID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	ref := s.familiesCol(dojoID).NewDoc()
+	f := Family{
+		Name:       in.Name,
+		PayerUID:   in.PayerUID,
+		MemberUIDs: in.MemberUIDs,
+		CreatedBy:  staffUID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		for _, uid := range in.MemberUIDs {
+			if err := s.checkJoinable(tx, dojoID, uid); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(ref, f); err != nil {
+			return err
+		}
+		for _, uid := range in.MemberUIDs {
+			if err := tx.Set(s.memberRef(dojoID, uid), map[string]interface{}{
+				"familyId":  ref.ID,
+				"updatedAt": now,
+			}, firestore.MergeAll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapTxErr(err, "failed to create family")
+	}
+	f.ID = ref.ID
+	return &f, nil
+}
+
+// UpdateFamily renames a family or changes its payer (staff only). The payer
+// cannot change while a subscription is billed to the current one.
+func (s *Service) UpdateFamily(ctx context.Context, staffUID, dojoID, familyID string, in UpdateFamilyInput) (*Family, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	familyID = strings.TrimSpace(familyID)
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	f, err := s.getFamily(ctx, dojoID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"updatedAt": time.Now().UTC()}
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrBadRequest)
+		}
+		updates["name"] = name
+	}
+	if in.PayerUID != nil {
+		payer := strings.TrimSpace(*in.PayerUID)
+		if payer != f.PayerUID {
+			if f.HasActiveSubscription() {
+				return nil, fmt.Errorf("%w: cancel the family subscription before changing the payer", ErrConflict)
+			}
+			if err := s.requireUser(ctx, payer); err != nil {
+				return nil, err
+			}
+			updates["payerUid"] = payer
+		}
+	}
+
+	if _, err := s.familiesCol(dojoID).Doc(familyID).Set(ctx, updates, firestore.MergeAll); err != nil {
+		return nil, fmt.Errorf("failed to update family: %w", err)
+	}
+	return s.getFamily(ctx, dojoID, familyID)
+}
+
+// AddMember links another member account to the family (staff only)
+func (s *Service) AddMember(ctx context.Context, staffUID, dojoID, familyID, memberUID string) (*Family, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	familyID = strings.TrimSpace(familyID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || familyID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId, familyId and memberUid are required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	ref := s.familiesCol(dojoID).Doc(familyID)
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("%w: family not found", ErrNotFound)
+		}
+		var f Family
+		if err := doc.DataTo(&f); err != nil {
+			return err
+		}
+		if len(f.MemberUIDs) >= maxFamilyMembers {
+			return fmt.Errorf("%w: a family has at most %d members", ErrBadRequest, maxFamilyMembers)
+		}
+		if err := s.checkJoinable(tx, dojoID, memberUID); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "memberUids", Value: firestore.ArrayUnion(memberUID)},
+			{Path: "updatedAt", Value: now},
+		}); err != nil {
+			return err
+		}
+		return tx.Set(s.memberRef(dojoID, memberUID), map[string]interface{}{
+			"familyId":  familyID,
+			"updatedAt": now,
+		}, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, wrapTxErr(err, "failed to add family member")
+	}
+	return s.afterMembershipChange(ctx, dojoID, familyID)
+}
+
+// RemoveMember unlinks a member account from the family (staff only)
+func (s *Service) RemoveMember(ctx context.Context, staffUID, dojoID, familyID, memberUID string) (*Family, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	familyID = strings.TrimSpace(familyID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || familyID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId, familyId and memberUid are required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	ref := s.familiesCol(dojoID).Doc(familyID)
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("%w: family not found", ErrNotFound)
+		}
+		var f Family
+		if err := doc.DataTo(&f); err != nil {
+			return err
+		}
+		if !contains(f.MemberUIDs, memberUID) {
+			return fmt.Errorf("%w: member is not in this family", ErrNotFound)
+		}
+		if len(f.MemberUIDs) == 1 {
+			return fmt.Errorf("%w: cannot remove the last member, delete the family instead", ErrBadRequest)
+		}
+		now := time.Now().UTC()
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "memberUids", Value: firestore.ArrayRemove(memberUID)},
+			{Path: "updatedAt", Value: now},
+		}); err != nil {
+			return err
+		}
+		return tx.Set(s.memberRef(dojoID, memberUID), map[string]interface{}{
+			"familyId":  firestore.Delete,
+			"updatedAt": now,
+		}, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, wrapTxErr(err, "failed to remove family member")
+	}
+	return s.afterMembershipChange(ctx, dojoID, familyID)
+}
+
+// DeleteFamily unlinks everyone and cancels the family subscription (staff only)
+func (s *Service) DeleteFamily(ctx context.Context, staffUID, dojoID, familyID string) error {
+	dojoID = strings.TrimSpace(dojoID)
+	familyID = strings.TrimSpace(familyID)
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return err
+	}
+	f, err := s.getFamily(ctx, dojoID, familyID)
+	if err != nil {
+		return err
+	}
+	if f.HasActiveSubscription() {
+		if s.stripeSvc == nil {
+			return fmt.Errorf("%w: family has an active subscription but billing is not configured", ErrConflict)
+		}
+		if err := s.stripeSvc.CancelSubscriptionByID(ctx, f.SubscriptionID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	batch := s.fs.Batch()
+	for _, uid := range f.MemberUIDs {
+		batch.Set(s.memberRef(dojoID, uid), map[string]interface{}{
+			"familyId":  firestore.Delete,
+			"updatedAt": now,
+		}, firestore.MergeAll)
+	}
+	batch.Delete(s.familiesCol(dojoID).Doc(familyID))
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to delete family: %w", err)
+	}
+	return nil
+}
+
+// afterMembershipChange keeps the subscription quantity at one unit per member
+func (s *Service) afterMembershipChange(ctx context.Context, dojoID, familyID string) (*Family, error) {
+	f, err := s.getFamily(ctx, dojoID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if s.stripeSvc != nil && f.HasActiveSubscription() {
+		if err := s.stripeSvc.UpdateSubscriptionQuantity(ctx, f.SubscriptionID, int64(len(f.MemberUIDs))); err != nil {
+			// membership is saved; billedQuantity on the family shows the mismatch
+			log.Printf("family %s/%s: quantity sync failed: %v", dojoID, familyID, err)
+		}
+	}
+	return f, nil
+}
+
+// checkJoinable verifies the member exists and is not in another family
+func (s *Service) checkJoinable(tx *firestore.Transaction, dojoID, memberUID string) error {
+	doc, err := tx.Get(s.memberRef(dojoID, memberUID))
+	if err != nil || !doc.Exists() {
+		return fmt.Errorf("%w: member %s not found", ErrNotFound, memberUID)
+	}
+	if familyID, _ := doc.Data()["familyId"].(string); familyID != "" {
+		return fmt.Errorf("%w: member %s already belongs to a family", ErrConflict, memberUID)
+	}
+	return nil
+}
+
+func (s *Service) requireUser(ctx context.Context, uid string) error {
+	doc, err := s.fs.Collection("users").Doc(uid).Get(ctx)
+	if err != nil || !doc.Exists() {
+		return fmt.Errorf("%w: payer account not found", ErrNotFound)
+	}
+	return nil
+}
+
+func wrapTxErr(err error, msg string) error {
+	if IsErrBadRequest(err) || IsErrNotFound(err) || IsErrConflict(err) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package families
+
+import (
+	"context"
+	"time"
+)
+
+// GetView returns the family with each member's rank and attendance, for the
+// paying parent (or staff)
+func (s *Service) GetView(ctx context.Context, uid, dojoID, familyID string) (*FamilyView, error) {
+	f, err := s.getForViewer(ctx, uid, dojoID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -30)
+	out := &FamilyView{Family: *f, Members: make([]FamilyMemberView, 0, len(f.MemberUIDs))}
+	for _, memberUID := range f.MemberUIDs {
+		mv := FamilyMemberView{UID: memberUID}
+
+		if doc, err := s.memberRef(dojoID, memberUID).Get(ctx); err == nil {
+			data := doc.Data()
+			mv.BeltRank, _ = data["beltRank"].(string)
+			stripes, _ := data["stripes"].(int64)
+			mv.Stripes = int(stripes)
+			mv.Status, _ = data["status"].(string)
+		}
+		if doc, err := s.fs.Collection("users").Doc(memberUID).Get(ctx); err == nil {
+			data := doc.Data()
+			mv.DisplayName, _ = data["displayName"].(string)
+			mv.PhotoURL, _ = data["photoURL"].(string)
+		}
+
+		if s.attendanceSvc != nil {
+			checkins, err := s.attendanceSvc.MemberCheckins(ctx, dojoID, memberUID)
+			if err != nil {
+				return nil, err
+			}
+			mv.TotalCheckins = len(checkins)
+			for _, a := range checkins {
+				if !a.CreatedAt.Before(since) {
+					mv.Last30Days++
+				}
+			}
+			if n := len(checkins); n > 0 {
+				last := checkins[n-1].CreatedAt
+				mv.LastCheckinAt = &last
+			}
+		}
+
+		out.Members = append(out.Members, mv)
+	}
+	return out, nil
+}
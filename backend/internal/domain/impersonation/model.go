@@ -0,0 +1,89 @@
+package impersonation
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	defaultMinutes = 15
+	maxMinutes     = 60
+	maxReason      = 500
+
+	// TokenPrefix marks impersonation tokens, so they are not mistaken for
+	// ID tokens in logs
+	TokenPrefix = "imp_"
+)
+
+// Audit log types (see audit.Entry); UID is the impersonated user
+const (
+	AuditStart   = "impersonation.start"
+	AuditEnd     = "impersonation.end"
+	AuditRequest = "impersonation.request"
+	AuditConsent = "impersonation.consent"
+)
+
+// Session is impersonations/{id}, where the id is a hash of the token: the
+// token itself is only returned once, to the admin who started the session.
+// It stands for the target user within one dojo, read-only, until it
+// expires or is ended; it never holds the user's credentials.
+type Session struct {
+	ID          string         `firestore:"-" json:"id"`
+	AdminUID    string         `firestore:"adminUid" json:"adminUid"`
+	TargetUID   string         `firestore:"targetUid" json:"targetUid"`
+	TargetEmail string         `firestore:"targetEmail,omitempty" json:"targetEmail,omitempty"`
+	DojoID      string         `firestore:"dojoId" json:"dojoId"`
+	Reason      string         `firestore:"reason" json:"reason"`
+	Claims      map[string]any `firestore:"claims,omitempty" json:"-"` // the target's custom claims when started
+	CreatedAt   time.Time      `firestore:"createdAt" json:"createdAt"`
+	ExpiresAt   time.Time      `firestore:"expiresAt" json:"expiresAt"`
+	EndedAt     *time.Time     `firestore:"endedAt,omitempty" json:"endedAt,omitempty"`
+	EndedBy     string         `firestore:"endedBy,omitempty" json:"endedBy,omitempty"`
+}
+
+// Active reports whether the session can still be used at now
+func (s *Session) Active(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// StartInput starts a session as TargetUID in DojoID
+type StartInput struct {
+	TargetUID string `json:"targetUid"`
+	DojoID    string `json:"dojoId"`
+	Reason    string `json:"reason"`            // e.g. the support ticket
+	Minutes   int    `json:"minutes,omitempty"` // default 15, at most 60
+}
+
+func (in *StartInput) Trim() {
+	in.TargetUID = strings.TrimSpace(in.TargetUID)
+	in.DojoID = strings.TrimSpace(in.DojoID)
+	in.Reason = strings.TrimSpace(in.Reason)
+}
+
+// Started is a new session with its token, sent as X-Impersonation-Token
+// alongside the admin's own ID token
+type Started struct {
+	Session
+	Token string `json:"token"`
+}
+
+// Consent is dojos/{dojoId}/settings/impersonation. Admins cannot
+// impersonate the dojo's members until the dojo allows it.
+type Consent struct {
+	Allowed   bool      `firestore:"allowed" json:"allowed"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdateConsentInput allows or withdraws consent; withdrawing also stops
+// the sessions in progress
+type UpdateConsentInput struct {
+	Allowed *bool `json:"allowed"`
+}
+
+// ListInput filters sessions; Active leaves out ended and expired ones
+type ListInput struct {
+	AdminUID string
+	Active   bool
+	Limit    int
+}
@@ -0,0 +1,342 @@
+package impersonation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/audit"
+	"dojo-manager/backend/internal/middleware"
+)
+
+// Service lets platform admins see the app as one of a dojo's members, for
+// support. A session is a short-lived token standing for the member within
+// one dojo; the router only lets it read, and every request made with it is
+// in the audit log. The router checks the caller is an admin.
+type Service struct {
+	fs         *firestore.Client
+	authClient *auth.Client
+	auditSvc   *audit.Service
+}
+
+func NewService(fs *firestore.Client, authClient *auth.Client, auditSvc *audit.Service) *Service {
+	return &Service{fs: fs, authClient: authClient, auditSvc: auditSvc}
+}
+
+func (s *Service) col() *firestore.CollectionRef {
+	return s.fs.Collection("impersonations")
+}
+
+func (s *Service) consentRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("impersonation")
+}
+
+// sessionID is the doc id of a token: a hash, so a leaked collection does
+// not hand out usable tokens
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetConsent returns the dojo's consent (not allowed when unset)
+func (s *Service) GetConsent(ctx context.Context, dojoID string) (*Consent, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.consentRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load impersonation consent: %w", err)
+	}
+	c := &Consent{}
+	if doc.Exists() {
+		if err := doc.DataTo(c); err != nil {
+			return nil, fmt.Errorf("failed to decode impersonation consent: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// UpdateConsent allows or withdraws impersonation in the dojo. Sessions in
+// progress stop at their next request once it is withdrawn.
+func (s *Service) UpdateConsent(ctx context.Context, staffUID, dojoID string, in UpdateConsentInput, ip, userAgent string) (*Consent, error) {
+	if in.Allowed == nil {
+		return nil, fmt.Errorf("%w: allowed is required", ErrBadRequest)
+	}
+	c, err := s.GetConsent(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	changed := c.Allowed != *in.Allowed
+	c.Allowed = *in.Allowed
+	c.UpdatedAt = time.Now().UTC()
+	c.UpdatedBy = staffUID
+
+	if _, err := s.consentRef(dojoID).Set(ctx, c); err != nil {
+		return nil, fmt.Errorf("failed to save impersonation consent: %w", err)
+	}
+	if changed {
+		err := s.auditSvc.Record(ctx, audit.Entry{
+			Type:      AuditConsent,
+			UID:       staffUID,
+			ActorUID:  staffUID,
+			DojoID:    dojoID,
+			IP:        ip,
+			UserAgent: userAgent,
+			Data:      map[string]interface{}{"allowed": c.Allowed},
+			At:        c.UpdatedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Start opens a session as a member of a dojo that allows it. Admins cannot
+// be impersonated, and a reason is required for the audit log.
+func (s *Service) Start(ctx context.Context, adminUID string, in StartInput, ip, userAgent string) (*Started, error) {
+	in.Trim()
+	if in.TargetUID == "" || in.DojoID == "" {
+		return nil, fmt.Errorf("%w: targetUid and dojoId are required", ErrBadRequest)
+	}
+	if in.Reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", ErrBadRequest)
+	}
+	if len(in.Reason) > maxReason {
+		return nil, fmt.Errorf("%w: reason must be at most %d characters", ErrBadRequest, maxReason)
+	}
+	if in.Minutes == 0 {
+		in.Minutes = defaultMinutes
+	}
+	if in.Minutes < 1 || in.Minutes > maxMinutes {
+		return nil, fmt.Errorf("%w: minutes must be between 1 and %d", ErrBadRequest, maxMinutes)
+	}
+	if in.TargetUID == adminUID {
+		return nil, fmt.Errorf("%w: cannot impersonate yourself", ErrBadRequest)
+	}
+
+	consent, err := s.GetConsent(ctx, in.DojoID)
+	if err != nil {
+		return nil, err
+	}
+	if !consent.Allowed {
+		return nil, fmt.Errorf("%w: the dojo has not allowed impersonation", ErrForbidden)
+	}
+
+	member, err := s.fs.Collection("dojos").Doc(in.DojoID).Collection("members").Doc(in.TargetUID).Get(ctx)
+	if err != nil && member == nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	if !member.Exists() {
+		return nil, fmt.Errorf("%w: user is not a member of the dojo", ErrNotFound)
+	}
+
+	u, err := s.authClient.GetUser(ctx, in.TargetUID)
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return nil, fmt.Errorf("%w: user not found", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if u.Disabled {
+		return nil, fmt.Errorf("%w: user is disabled", ErrForbidden)
+	}
+	if middleware.IsAdmin(u.CustomClaims) {
+		return nil, fmt.Errorf("%w: admins cannot be impersonated", ErrForbidden)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := TokenPrefix + hex.EncodeToString(b)
+
+	now := time.Now().UTC()
+	sess := Session{
+		ID:          sessionID(token),
+		AdminUID:    adminUID,
+		TargetUID:   in.TargetUID,
+		TargetEmail: u.Email,
+		DojoID:      in.DojoID,
+		Reason:      in.Reason,
+		Claims:      u.CustomClaims,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Duration(in.Minutes) * time.Minute),
+	}
+	if _, err := s.col().Doc(sess.ID).Create(ctx, sess); err != nil {
+		return nil, fmt.Errorf("failed to save impersonation: %w", err)
+	}
+
+	err = s.auditSvc.Record(ctx, audit.Entry{
+		Type:      AuditStart,
+		UID:       sess.TargetUID,
+		ActorUID:  adminUID,
+		DojoID:    sess.DojoID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Data: map[string]interface{}{
+			"sessionId": sess.ID,
+			"reason":    sess.Reason,
+			"expiresAt": sess.ExpiresAt,
+		},
+		At: now,
+	})
+	if err != nil {
+		// a session missing from the log must not be usable
+		_, _ = s.col().Doc(sess.ID).Delete(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	return &Started{Session: sess, Token: token}, nil
+}
+
+// Resolve returns the session of a token while it is active and the dojo
+// still allows impersonation
+func (s *Service) Resolve(ctx context.Context, token string, now time.Time) (*Session, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, fmt.Errorf("%w: invalid impersonation token", ErrUnauthorized)
+	}
+	sess, err := s.get(ctx, sessionID(token))
+	if IsErrNotFound(err) {
+		return nil, fmt.Errorf("%w: invalid impersonation token", ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sess.Active(now) {
+		return nil, fmt.Errorf("%w: impersonation session has ended", ErrUnauthorized)
+	}
+	consent, err := s.GetConsent(ctx, sess.DojoID)
+	if err != nil {
+		return nil, err
+	}
+	if !consent.Allowed {
+		return nil, fmt.Errorf("%w: the dojo has withdrawn impersonation consent", ErrForbidden)
+	}
+	return sess, nil
+}
+
+// RecordRequest logs a request made with the session. The router refuses
+// the request when it cannot be logged.
+func (s *Service) RecordRequest(ctx context.Context, sess *Session, method, path, ip, userAgent string) error {
+	return s.auditSvc.Record(ctx, audit.Entry{
+		Type:      AuditRequest,
+		UID:       sess.TargetUID,
+		ActorUID:  sess.AdminUID,
+		DojoID:    sess.DojoID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Data: map[string]interface{}{
+			"sessionId": sess.ID,
+			"method":    method,
+			"path":      path,
+		},
+	})
+}
+
+// End stops a session before it expires; ending an ended session is a no-op
+func (s *Service) End(ctx context.Context, adminUID, id, ip, userAgent string) (*Session, error) {
+	sess, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.EndedAt != nil {
+		return sess, nil
+	}
+	now := time.Now().UTC()
+	_, err = s.col().Doc(id).Update(ctx, []firestore.Update{
+		{Path: "endedAt", Value: now},
+		{Path: "endedBy", Value: adminUID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to end impersonation: %w", err)
+	}
+	sess.EndedAt = &now
+	sess.EndedBy = adminUID
+
+	err = s.auditSvc.Record(ctx, audit.Entry{
+		Type:      AuditEnd,
+		UID:       sess.TargetUID,
+		ActorUID:  adminUID,
+		DojoID:    sess.DojoID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Data:      map[string]interface{}{"sessionId": sess.ID},
+		At:        now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// List returns sessions newest first
+func (s *Service) List(ctx context.Context, in ListInput) ([]Session, error) {
+	if in.Limit <= 0 {
+		in.Limit = 50
+	}
+	if in.Limit > 200 {
+		in.Limit = 200
+	}
+
+	q := s.col().Query
+	if in.AdminUID != "" {
+		q = q.Where("adminUid", "==", in.AdminUID)
+	}
+	if in.Active {
+		// ended sessions are dropped below
+		q = q.Where("expiresAt", ">", time.Now().UTC()).OrderBy("expiresAt", firestore.Desc)
+	} else {
+		q = q.OrderBy("createdAt", firestore.Desc)
+	}
+
+	iter := q.Limit(in.Limit).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Session{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list impersonations: %w", err)
+		}
+		var sess Session
+		if err := doc.DataTo(&sess); err != nil {
+			continue
+		}
+		if in.Active && sess.EndedAt != nil {
+			continue
+		}
+		sess.ID = doc.Ref.ID
+		out = append(out, sess)
+	}
+	return out, nil
+}
+
+func (s *Service) get(ctx context.Context, id string) (*Session, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrBadRequest)
+	}
+	doc, err := s.col().Doc(id).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: impersonation not found", ErrNotFound)
+	}
+	var sess Session
+	if err := doc.DataTo(&sess); err != nil {
+		return nil, fmt.Errorf("failed to decode impersonation: %w", err)
+	}
+	sess.ID = doc.Ref.ID
+	return &sess, nil
+}
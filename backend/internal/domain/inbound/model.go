@@ -0,0 +1,83 @@
+package inbound
+
+import (
+	"strings"
+	"time"
+)
+
+// Config is the gateway's mail domain and webhook secrets (see config.InboundEmailConfig)
+type Config struct {
+	Domain            string
+	Secret            string
+	MailgunSigningKey string
+}
+
+// Settings is dojos/{dojoId}/settings/inboundEmail (server-only). Token is
+// the local part of the dojo's address; inboundEmailAddresses/{token} maps
+// it back to the dojo.
+type Settings struct {
+	Enabled   bool      `firestore:"enabled"`
+	Token     string    `firestore:"token,omitempty"`
+	Audience  string    `firestore:"audience"` // who is notified: all, students, staff
+	UpdatedAt time.Time `firestore:"updatedAt"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty"`
+}
+
+// View is the settings as shown to staff
+type View struct {
+	Enabled   bool      `json:"enabled"`
+	Address   string    `json:"address,omitempty"`
+	Audience  string    `json:"audience"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+}
+
+// UpdateSettingsInput updates the gateway (nil fields are left unchanged)
+type UpdateSettingsInput struct {
+	Enabled  *bool   `json:"enabled,omitempty"`
+	Audience *string `json:"audience,omitempty"`
+	// RotateAddress replaces the address, e.g. after it leaked
+	RotateAddress bool `json:"rotateAddress,omitempty"`
+}
+
+func (in *UpdateSettingsInput) Trim() {
+	if in.Audience != nil {
+		*in.Audience = strings.TrimSpace(*in.Audience)
+	}
+}
+
+// address is an inboundEmailAddresses/{token} document
+type address struct {
+	DojoID    string    `firestore:"dojoId"`
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+// Email statuses
+const (
+	StatusPosted   = "posted"
+	StatusRejected = "rejected"
+)
+
+// Email is dojos/{dojoId}/inboundEmails/{id}, one per message received for
+// the dojo. The id is derived from the Message-ID so provider retries are
+// recognised.
+type Email struct {
+	ID         string    `firestore:"-" json:"id"`
+	From       string    `firestore:"from" json:"from"`
+	SenderUID  string    `firestore:"senderUid,omitempty" json:"senderUid,omitempty"`
+	Subject    string    `firestore:"subject" json:"subject"`
+	MessageID  string    `firestore:"messageId,omitempty" json:"messageId,omitempty"`
+	Status     string    `firestore:"status" json:"status"`
+	Reason     string    `firestore:"reason,omitempty" json:"reason,omitempty"`
+	NoticeID   string    `firestore:"noticeId,omitempty" json:"noticeId,omitempty"`
+	ReceivedAt time.Time `firestore:"receivedAt" json:"receivedAt"`
+}
+
+// ReceiveResult is the webhook answer. Rejected mail is still answered 200
+// so the provider does not retry it.
+type ReceiveResult struct {
+	Accepted  bool   `json:"accepted"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	NoticeID  string `json:"noticeId,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
@@ -0,0 +1,365 @@
+package inbound
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"firebase.google.com/go/v4/auth"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/notifications"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/mailqueue"
+)
+
+const (
+	maxInboundSize   = 10 << 20 // the whole multipart post, attachments included
+	maxSignatureSkew = 15 * time.Minute
+)
+
+// message is the part of a parsed inbound email the gateway uses
+type message struct {
+	From       string
+	Recipients []string
+	Subject    string
+	Text       string
+	MessageID  string
+	// Authenticated is set when DKIM passed for a signature of the From
+	// domain, or SPF passed for an envelope sender of the From domain
+	Authenticated bool
+}
+
+// Receive handles a provider's inbound-parse post: SendGrid Inbound Parse
+// (authenticated by ?secret=) or a Mailgun route (signed). Mail from dojo
+// staff with notices permission, whose domain passed aligned SPF or DKIM, becomes a
+// notice with a notification to the dojo's chosen audience. Anything else is
+// rejected with a 200 answer so the provider does not retry; senders who
+// proved to be staff get the reason by email.
+func (s *Service) Receive(r *http.Request) (*ReceiveResult, error) {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(nil, r.Body, maxInboundSize)
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		return nil, fmt.Errorf("%w: invalid inbound email post: %v", ErrBadRequest, err)
+	}
+	if !s.authenticate(r) {
+		return nil, fmt.Errorf("%w: inbound email post not authenticated", ErrUnauthorized)
+	}
+
+	var msg message
+	if r.PostFormValue("body-plain") != "" || r.PostFormValue("signature") != "" {
+		msg = mailgunMessage(r)
+	} else {
+		msg = sendGridMessage(r)
+	}
+
+	dojoID := s.dojoFor(ctx, msg.Recipients)
+	if dojoID == "" {
+		log.Printf("inbound: no dojo address among %v", msg.Recipients)
+		return &ReceiveResult{Reason: "unknown address"}, nil
+	}
+	return s.process(ctx, dojoID, msg)
+}
+
+// authenticate accepts the shared secret or a valid Mailgun signature
+func (s *Service) authenticate(r *http.Request) bool {
+	if s.config.Secret != "" {
+		if got := r.URL.Query().Get("secret"); got != "" &&
+			subtle.ConstantTimeCompare([]byte(got), []byte(s.config.Secret)) == 1 {
+			return true
+		}
+	}
+	if s.config.MailgunSigningKey != "" {
+		ts, token, sig := r.PostFormValue("timestamp"), r.PostFormValue("token"), r.PostFormValue("signature")
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || token == "" || sig == "" {
+			return false
+		}
+		if skew := time.Since(time.Unix(unix, 0)); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(s.config.MailgunSigningKey))
+		mac.Write([]byte(ts + token))
+		return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(sig)))
+	}
+	return false
+}
+
+// dojoFor finds the dojo of the first recipient at the gateway domain.
+// Plus-addressing (token+anything@) is ignored.
+func (s *Service) dojoFor(ctx context.Context, recipients []string) string {
+	for _, rcpt := range recipients {
+		local, domain, ok := strings.Cut(strings.ToLower(rcpt), "@")
+		if !ok || domain != s.config.Domain {
+			continue
+		}
+		local, _, _ = strings.Cut(local, "+")
+		if local == "" || strings.Contains(local, "/") {
+			continue
+		}
+		doc, err := s.addressRef(local).Get(ctx)
+		if err != nil || !doc.Exists() {
+			continue
+		}
+		var a address
+		if err := doc.DataTo(&a); err == nil && a.DojoID != "" {
+			return a.DojoID
+		}
+	}
+	return ""
+}
+
+func (s *Service) process(ctx context.Context, dojoID string, msg message) (*ReceiveResult, error) {
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if !st.Enabled {
+		return &ReceiveResult{Reason: "inbound email is turned off for this dojo"}, nil
+	}
+
+	// the log doc doubles as the dedupe claim for provider retries
+	now := time.Now().UTC()
+	rec := Email{From: msg.From, Subject: msg.Subject, MessageID: msg.MessageID, ReceivedAt: now}
+	ref := s.emailsCol(dojoID).NewDoc()
+	if msg.MessageID != "" {
+		sum := sha256.Sum256([]byte(msg.MessageID))
+		ref = s.emailsCol(dojoID).Doc(hex.EncodeToString(sum[:16]))
+	}
+	reject := func(reason string, reply bool) (*ReceiveResult, error) {
+		rec.Status, rec.Reason = StatusRejected, reason
+		if _, err := ref.Set(ctx, rec); err != nil {
+			log.Printf("inbound: dojo %s: failed to log email: %v", dojoID, err)
+		}
+		if reply {
+			s.replyRejected(ctx, msg, reason)
+		}
+		return &ReceiveResult{Reason: reason}, nil
+	}
+	if _, err := ref.Create(ctx, Email{From: msg.From, Subject: msg.Subject, MessageID: msg.MessageID, Status: "processing", ReceivedAt: now}); err != nil {
+		return &ReceiveResult{Accepted: true, Duplicate: true}, nil
+	}
+
+	// a forged From is the main risk, so SPF or DKIM must pass for its domain
+	if !msg.Authenticated {
+		return reject("sender could not be verified (no SPF or DKIM pass for the From domain)", false)
+	}
+	uid, err := s.senderUID(ctx, msg.From)
+	if err != nil {
+		_, _ = ref.Delete(ctx)
+		return nil, err
+	}
+	if uid == "" {
+		return reject("sender has no account", false)
+	}
+	rec.SenderUID = uid
+	ok, err := s.dojoRepo.HasPermission(ctx, dojoID, uid, dojo.PermNoticesWrite)
+	if err != nil {
+		_, _ = ref.Delete(ctx)
+		return nil, fmt.Errorf("failed to check permission: %w", err)
+	}
+	if !ok {
+		return reject("only staff who can post notices may announce by email", true)
+	}
+
+	title := strings.TrimSpace(msg.Subject)
+	if title == "" {
+		return reject("the subject is used as the announcement title and cannot be empty", true)
+	}
+	noticeID, err := s.notifications.CreateNotice(ctx, uid, notifications.CreateNoticeInput{
+		DojoID:   dojoID,
+		Title:    truncate(title, notifications.MaxBulkTitleLength),
+		Body:     truncate(msg.Text, notifications.MaxBulkBodyLength),
+		Type:     "announcement",
+		Notify:   true,
+		Audience: st.Audience,
+	})
+	if err != nil {
+		if stripedom.IsErrLimitReached(err) || notifications.IsErrBadRequest(err) || notifications.IsErrTooLarge(err) {
+			return reject(err.Error(), true)
+		}
+		if noticeID == "" {
+			// nothing was posted; let the provider retry
+			_, _ = ref.Delete(ctx)
+			return nil, err
+		}
+		log.Printf("inbound: dojo %s: notice %s posted but notifying failed: %v", dojoID, noticeID, err)
+	}
+
+	rec.Status, rec.NoticeID = StatusPosted, noticeID
+	if _, err := ref.Set(ctx, rec); err != nil {
+		log.Printf("inbound: dojo %s: failed to log email: %v", dojoID, err)
+	}
+	return &ReceiveResult{Accepted: true, NoticeID: noticeID}, nil
+}
+
+// senderUID resolves the sender's account, "" if there is none
+func (s *Service) senderUID(ctx context.Context, from string) (string, error) {
+	if s.authClient == nil {
+		return "", fmt.Errorf("sender lookup is not configured")
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return "", nil
+	}
+	u, err := s.authClient.GetUserByEmail(ctx, strings.ToLower(addr.Address))
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to look up sender: %w", err)
+	}
+	if u.Disabled || !u.EmailVerified {
+		return "", nil
+	}
+	return u.UID, nil
+}
+
+// replyRejected tells a verified sender by email why nothing was posted
+func (s *Service) replyRejected(ctx context.Context, msg message, reason string) {
+	addr, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return
+	}
+	err = mailqueue.Queue(ctx, s.fs, mailqueue.Email{
+		To:      addr.Address,
+		Subject: "Not posted: " + msg.Subject,
+		Text:    "Your email was not posted as an announcement: " + reason + ".",
+	}, time.Now().UTC())
+	if err != nil {
+		log.Printf("inbound: failed to queue reply to %s: %v", addr.Address, err)
+	}
+}
+
+// sendGridMessage reads the SendGrid Inbound Parse fields
+func sendGridMessage(r *http.Request) message {
+	msg := message{
+		From:    r.PostFormValue("from"),
+		Subject: r.PostFormValue("subject"),
+		Text:    cleanBody(r.PostFormValue("text")),
+	}
+	var envelope struct {
+		To   []string `json:"to"`
+		From string   `json:"from"`
+	}
+	if err := json.Unmarshal([]byte(r.PostFormValue("envelope")), &envelope); err == nil && len(envelope.To) > 0 {
+		msg.Recipients = envelope.To
+	} else if list, err := mail.ParseAddressList(r.PostFormValue("to")); err == nil {
+		for _, a := range list {
+			msg.Recipients = append(msg.Recipients, a.Address)
+		}
+	}
+	if hdr, err := mail.ReadMessage(strings.NewReader(r.PostFormValue("headers") + "\r\n\r\n")); err == nil {
+		msg.MessageID = hdr.Header.Get("Message-Id")
+	}
+	// dkim lists a verdict per signing domain: "{@example.com : pass, @other.org : fail}"
+	domain := addrDomain(msg.From)
+	dkimAligned := false
+	for _, result := range strings.Split(strings.Trim(r.PostFormValue("dkim"), "{} "), ",") {
+		d, verdict, ok := strings.Cut(result, ":")
+		if ok && domain != "" && strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(d), "@"), domain) &&
+			strings.EqualFold(strings.TrimSpace(verdict), "pass") {
+			dkimAligned = true
+		}
+	}
+	spfAligned := strings.EqualFold(strings.TrimSpace(r.PostFormValue("SPF")), "pass") &&
+		domain != "" && addrDomain(envelope.From) == domain
+	msg.Authenticated = dkimAligned || spfAligned
+	return msg
+}
+
+// mailgunMessage reads the fields of a Mailgun route forward
+func mailgunMessage(r *http.Request) message {
+	text := r.PostFormValue("stripped-text")
+	if text == "" {
+		text = r.PostFormValue("body-plain")
+	}
+	msg := message{
+		From:      r.PostFormValue("from"),
+		Subject:   r.PostFormValue("subject"),
+		Text:      cleanBody(text),
+		MessageID: r.PostFormValue("Message-Id"),
+	}
+	for _, rcpt := range strings.Split(r.PostFormValue("recipient"), ",") {
+		if rcpt = strings.TrimSpace(rcpt); rcpt != "" {
+			msg.Recipients = append(msg.Recipients, rcpt)
+		}
+	}
+	// Mailgun's DKIM verdict does not name the signing domain, so it only
+	// counts when every signature is by the From domain
+	domain := addrDomain(msg.From)
+	spfPass, dkimPass := false, false
+	signers := 0
+	dkimAligned := true
+	var headers [][2]string
+	if err := json.Unmarshal([]byte(r.PostFormValue("message-headers")), &headers); err == nil {
+		for _, h := range headers {
+			switch strings.ToLower(h[0]) {
+			case "x-mailgun-spf":
+				spfPass = strings.EqualFold(h[1], "pass")
+			case "x-mailgun-dkim-check-result":
+				dkimPass = strings.EqualFold(h[1], "pass")
+			case "dkim-signature":
+				signers++
+				if !strings.EqualFold(dkimDomain(h[1]), domain) {
+					dkimAligned = false
+				}
+			}
+		}
+	}
+	msg.Authenticated = domain != "" &&
+		(dkimPass && signers > 0 && dkimAligned ||
+			spfPass && addrDomain(r.PostFormValue("sender")) == domain)
+	return msg
+}
+
+// addrDomain is the lower-cased domain of an address ("Name <a@b.c>" or
+// "a@b.c"), "" when it has none
+func addrDomain(addr string) string {
+	if a, err := mail.ParseAddress(addr); err == nil {
+		addr = a.Address
+	}
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(strings.TrimSuffix(addr[i+1:], ">")))
+}
+
+// dkimDomain is the d= tag of a DKIM-Signature header
+func dkimDomain(sig string) string {
+	for _, tag := range strings.Split(sig, ";") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(tag), "="); ok && strings.TrimSpace(name) == "d" {
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
+
+// cleanBody normalises line endings and drops the signature ("-- " line)
+func cleanBody(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if i := strings.Index(text, "\n-- \n"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max-1]) + "…"
+}
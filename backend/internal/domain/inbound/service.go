@@ -0,0 +1,176 @@
+package inbound
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/notifications"
+)
+
+// maxListedEmails caps the received-mail log returned to staff
+const maxListedEmails = 50
+
+// Service turns email sent to a dojo's private address into a notice plus a
+// notification to the dojo's members, so owners can announce from any mail
+// client. The router checks settings permission for the staff endpoints.
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	notifications *notifications.Service
+	authClient    *auth.Client
+	config        Config
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, notificationsSvc *notifications.Service, cfg Config) *Service {
+	cfg.Domain = strings.ToLower(cfg.Domain)
+	return &Service{fs: fs, dojoRepo: dojoRepo, notifications: notificationsSvc, config: cfg}
+}
+
+// SetAuthClient enables resolving senders to accounts by email
+func (s *Service) SetAuthClient(authClient *auth.Client) {
+	s.authClient = authClient
+}
+
+func (s *Service) settingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("inboundEmail")
+}
+
+func (s *Service) addressRef(token string) *firestore.DocumentRef {
+	return s.fs.Collection("inboundEmailAddresses").Doc(token)
+}
+
+func (s *Service) emailsCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("inboundEmails")
+}
+
+func (s *Service) settings(ctx context.Context, dojoID string) (*Settings, error) {
+	doc, err := s.settingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load inbound email settings: %w", err)
+	}
+	st := &Settings{}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode inbound email settings: %w", err)
+		}
+	}
+	if st.Audience == "" {
+		st.Audience = "all"
+	}
+	return st, nil
+}
+
+// GetSettings returns whether the gateway is on and the dojo's address
+func (s *Service) GetSettings(ctx context.Context, dojoID string) (*View, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return s.view(st), nil
+}
+
+// UpdateSettings turns the gateway on or off, sets who is notified and
+// rotates the address. The address is created the first time it is enabled.
+func (s *Service) UpdateSettings(ctx context.Context, staffUID, dojoID string, in UpdateSettingsInput) (*View, error) {
+	in.Trim()
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.Audience != nil && !notifications.IsValidAudience(*in.Audience) {
+		return nil, fmt.Errorf("%w: audience must be one of: all, students, staff", ErrBadRequest)
+	}
+
+	var out *Settings
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(s.settingsRef(dojoID))
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to load inbound email settings: %w", err)
+		}
+		st := &Settings{Audience: "all"}
+		if doc.Exists() {
+			if err := doc.DataTo(st); err != nil {
+				return fmt.Errorf("failed to decode inbound email settings: %w", err)
+			}
+		}
+
+		if in.Enabled != nil {
+			st.Enabled = *in.Enabled
+		}
+		if in.Audience != nil {
+			st.Audience = *in.Audience
+		}
+		if in.RotateAddress || (st.Enabled && st.Token == "") {
+			token, err := newToken()
+			if err != nil {
+				return err
+			}
+			if st.Token != "" {
+				if err := tx.Delete(s.addressRef(st.Token)); err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(s.addressRef(token), address{DojoID: dojoID, CreatedAt: time.Now().UTC()}); err != nil {
+				return err
+			}
+			st.Token = token
+		}
+
+		st.UpdatedAt = time.Now().UTC()
+		st.UpdatedBy = staffUID
+		out = st
+		return tx.Set(s.settingsRef(dojoID), st)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save inbound email settings: %w", err)
+	}
+	return s.view(out), nil
+}
+
+// ListEmails returns the most recent mail received for the dojo, posted or not
+func (s *Service) ListEmails(ctx context.Context, dojoID string) ([]Email, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	docs, err := s.emailsCol(dojoID).OrderBy("receivedAt", firestore.Desc).Limit(maxListedEmails).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inbound emails: %w", err)
+	}
+	out := make([]Email, 0, len(docs))
+	for _, doc := range docs {
+		var e Email
+		if err := doc.DataTo(&e); err != nil {
+			continue
+		}
+		e.ID = doc.Ref.ID
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (s *Service) view(st *Settings) *View {
+	v := &View{Enabled: st.Enabled, Audience: st.Audience, UpdatedAt: st.UpdatedAt, UpdatedBy: st.UpdatedBy}
+	if st.Token != "" {
+		v.Address = st.Token + "@" + s.config.Domain
+	}
+	return v
+}
+
+// newToken is 80 random bits, lowercase base32 so it survives case folding
+func newToken() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate address: %w", err)
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
@@ -0,0 +1,264 @@
+package leads
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/mailqueue"
+)
+
+// Contact form rate limits, in fixed windows. Counters live in
+// contactRateLimits, with expireAt for a Firestore TTL policy.
+const (
+	perAddressHourly = 5  // submissions from one client address, across dojos
+	perDojoDaily     = 50 // submissions to one dojo
+)
+
+// Contact files a lead from a dojo's public contact form and tells the
+// dojo's staff. The dojo is found by slug; dojos that have not turned the
+// form on answer not found, like unknown slugs.
+func (s *Service) Contact(ctx context.Context, slug string, in ContactInput, meta RequestMeta) error {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	in.Trim()
+	if err := in.validate(); err != nil {
+		return err
+	}
+
+	dojoID, dojoName, err := s.dojoBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+	st, err := s.GetSettings(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	if !st.Enabled {
+		return fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+
+	now := time.Now().UTC()
+	if err := s.takeRateLimit(ctx, dojoID, meta.IP, now); err != nil {
+		return err
+	}
+	if err := s.verifyCaptcha(ctx, in.Token, meta.IP); err != nil {
+		return err
+	}
+
+	lead := Lead{
+		Name:      in.Name,
+		Email:     in.Email,
+		Phone:     in.Phone,
+		Message:   in.Message,
+		Status:    StatusNew,
+		Source:    SourceContactForm,
+		Origin:    meta.Origin,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ref, _, err := s.leadsCol(dojoID).Add(ctx, lead)
+	if err != nil {
+		return fmt.Errorf("failed to save lead: %w", err)
+	}
+	lead.ID = ref.ID
+
+	s.notifyStaff(ctx, dojoID, dojoName, st, &lead)
+	return nil
+}
+
+func (in *ContactInput) validate() error {
+	switch {
+	case in.Name == "":
+		return fmt.Errorf("%w: name is required", ErrBadRequest)
+	case utf8.RuneCountInString(in.Name) > maxNameLength:
+		return fmt.Errorf("%w: name must be at most %d characters", ErrBadRequest, maxNameLength)
+	case in.Email == "" || len(in.Email) > maxEmailLength || !validEmail(in.Email):
+		return fmt.Errorf("%w: a valid email is required", ErrBadRequest)
+	case utf8.RuneCountInString(in.Phone) > maxPhoneLength:
+		return fmt.Errorf("%w: phone must be at most %d characters", ErrBadRequest, maxPhoneLength)
+	case in.Message == "":
+		return fmt.Errorf("%w: message is required", ErrBadRequest)
+	case utf8.RuneCountInString(in.Message) > maxMessageLength:
+		return fmt.Errorf("%w: message must be at most %d characters", ErrBadRequest, maxMessageLength)
+	case in.Token == "" || len(in.Token) > maxTokenLength:
+		return fmt.Errorf("%w: captcha token is required", ErrBadRequest)
+	}
+	return nil
+}
+
+// dojoBySlug finds a live dojo by its public slug
+func (s *Service) dojoBySlug(ctx context.Context, slug string) (string, string, error) {
+	if slug == "" {
+		return "", "", fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	iter := s.fs.Collection("dojos").Where("slug", "==", slug).Limit(1).Documents(ctx)
+	defer iter.Stop()
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return "", "", fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up dojo: %w", err)
+	}
+	data := doc.Data()
+	if status, _ := data["status"].(string); status == dojo.StatusPendingDelete {
+		return "", "", fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	name, _ := data["name"].(string)
+	return doc.Ref.ID, name, nil
+}
+
+// takeRateLimit counts the submission against the client address and the
+// dojo, refusing it once either window is used up. Refused attempts count
+// too, so a flood does not reach the captcha provider.
+func (s *Service) takeRateLimit(ctx context.Context, dojoID, ip string, now time.Time) error {
+	if ip == "" {
+		ip = "unknown"
+	}
+	sum := sha256.Sum256([]byte(ip))
+	hour := now.Truncate(time.Hour)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	col := s.fs.Collection("contactRateLimits")
+	windows := []struct {
+		ref    *firestore.DocumentRef
+		limit  int
+		expire time.Time
+	}{
+		{col.Doc("ip_" + hex.EncodeToString(sum[:10]) + "_" + hour.Format("2006010215")), perAddressHourly, hour.Add(time.Hour)},
+		{col.Doc("dojo_" + dojoID + "_" + day.Format("20060102")), perDojoDaily, day.AddDate(0, 0, 1)},
+	}
+
+	limited := false
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		limited = false
+		counts := make([]int64, len(windows))
+		for i, w := range windows {
+			doc, err := tx.Get(w.ref)
+			if err != nil && doc == nil {
+				return err
+			}
+			if doc.Exists() {
+				counts[i], _ = doc.Data()["count"].(int64)
+			}
+			if counts[i] >= int64(w.limit) {
+				limited = true
+			}
+		}
+		for i, w := range windows {
+			if err := tx.Set(w.ref, map[string]interface{}{
+				"count":    counts[i] + 1,
+				"expireAt": w.expire,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if limited {
+		return fmt.Errorf("%w: too many messages, please try again later", ErrRateLimited)
+	}
+	return nil
+}
+
+// verifyCaptcha checks the widget's token with the provider (siteverify)
+func (s *Service) verifyCaptcha(ctx context.Context, token, ip string) error {
+	form := url.Values{"secret": {s.config.CaptchaSecret}, "response": {token}}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.CaptchaVerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to verify captcha: provider answered %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	if !out.Success {
+		return fmt.Errorf("%w: captcha verification failed (%s)", ErrForbidden, strings.Join(out.ErrorCodes, ", "))
+	}
+	return nil
+}
+
+// notifyStaff tells the dojo's staff in the app and emails the lead to the
+// dojo's address (best effort; the lead is saved either way)
+func (s *Service) notifyStaff(ctx context.Context, dojoID, dojoName string, st *Settings, lead *Lead) {
+	title := "New enquiry from " + lead.Name
+	body := lead.Message
+	if utf8.RuneCountInString(body) > 140 {
+		body = string([]rune(body)[:140]) + "…"
+	}
+
+	staff, err := s.dojoRepo.ListStaffUIDs(ctx, dojoID)
+	if err != nil {
+		log.Printf("leads: failed to list staff of %s: %v", dojoID, err)
+	}
+	for _, uid := range staff {
+		_, _, err := s.fs.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+			"title": title,
+			"body":  body,
+			"type":  "contact_lead",
+			"data": map[string]interface{}{
+				"leadId": lead.ID,
+			},
+			"read":      false,
+			"dojoId":    dojoID,
+			"createdAt": lead.CreatedAt,
+		})
+		if err != nil {
+			log.Printf("leads: failed to notify %s: %v", uid, err)
+		}
+	}
+
+	if st.NotifyEmail == "" {
+		return
+	}
+	if dojoName == "" {
+		dojoName = "your dojo"
+	}
+	text := fmt.Sprintf("%s sent a message through the contact form of %s.\n\nName: %s\nEmail: %s\n", lead.Name, dojoName, lead.Name, lead.Email)
+	if lead.Phone != "" {
+		text += "Phone: " + lead.Phone + "\n"
+	}
+	text += "\n" + lead.Message + "\n\nReply to this email to answer them.\n"
+
+	err = mailqueue.Queue(ctx, s.fs, mailqueue.Email{
+		To:      st.NotifyEmail,
+		ReplyTo: lead.Email,
+		Subject: title,
+		Text:    text,
+	}, lead.CreatedAt)
+	if err != nil {
+		log.Printf("leads: dojo %s: email to %s failed: %v", dojoID, st.NotifyEmail, err)
+	}
+}
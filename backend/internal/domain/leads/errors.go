@@ -0,0 +1,26 @@
+package leads
+
+import "errors"
+
+var (
+	ErrBadRequest  = errors.New("bad request")
+	ErrNotFound    = errors.New("not found")
+	ErrForbidden   = errors.New("forbidden")
+	ErrRateLimited = errors.New("rate limited")
+)
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrForbidden(err error) bool {
+	return errors.Is(err, ErrForbidden)
+}
+
+func IsErrRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
@@ -0,0 +1,116 @@
+package leads
+
+import (
+	"strings"
+	"time"
+)
+
+// Config is the captcha check of the contact form (see config.ContactFormConfig)
+type Config struct {
+	CaptchaSecret    string
+	CaptchaVerifyURL string
+}
+
+// Settings is dojos/{dojoId}/settings/contactForm. The form is off until
+// the dojo turns it on.
+type Settings struct {
+	Enabled bool `firestore:"enabled" json:"enabled"`
+	// NotifyEmail also receives each lead by email, replying to the sender
+	NotifyEmail string    `firestore:"notifyEmail,omitempty" json:"notifyEmail,omitempty"`
+	UpdatedAt   time.Time `firestore:"updatedAt" json:"updatedAt"`
+	UpdatedBy   string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdateSettingsInput updates the form settings (nil fields are left unchanged)
+type UpdateSettingsInput struct {
+	Enabled     *bool   `json:"enabled,omitempty"`
+	NotifyEmail *string `json:"notifyEmail,omitempty"` // "" stops the emails
+}
+
+func (in *UpdateSettingsInput) Trim() {
+	if in.NotifyEmail != nil {
+		*in.NotifyEmail = strings.TrimSpace(*in.NotifyEmail)
+	}
+}
+
+// Lead statuses
+const (
+	StatusNew       = "new"
+	StatusContacted = "contacted"
+	StatusConverted = "converted" // became a member
+	StatusClosed    = "closed"
+)
+
+var validStatuses = []string{StatusNew, StatusContacted, StatusConverted, StatusClosed}
+
+func isValidStatus(s string) bool {
+	for _, v := range validStatuses {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceContactForm marks leads sent through the public contact form
+const SourceContactForm = "contact_form"
+
+// Lead is dojos/{dojoId}/leads/{leadId}, an enquiry from someone who is not
+// a member yet
+type Lead struct {
+	ID        string    `firestore:"-" json:"id"`
+	Name      string    `firestore:"name" json:"name"`
+	Email     string    `firestore:"email" json:"email"`
+	Phone     string    `firestore:"phone,omitempty" json:"phone,omitempty"`
+	Message   string    `firestore:"message" json:"message"`
+	Status    string    `firestore:"status" json:"status"`
+	Source    string    `firestore:"source" json:"source"`
+	Origin    string    `firestore:"origin,omitempty" json:"origin,omitempty"` // site the form was sent from
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// Field limits of the contact form
+const (
+	maxNameLength    = 100
+	maxEmailLength   = 254
+	maxPhoneLength   = 40
+	maxMessageLength = 2000
+	maxTokenLength   = 2048
+)
+
+// ContactInput is the body of POST /public/dojos/{slug}/contact. Token is
+// the captcha widget's response.
+type ContactInput struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone,omitempty"`
+	Message string `json:"message"`
+	Token   string `json:"token"`
+}
+
+func (in *ContactInput) Trim() {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Email = strings.TrimSpace(in.Email)
+	in.Phone = strings.TrimSpace(in.Phone)
+	in.Message = strings.TrimSpace(in.Message)
+	in.Token = strings.TrimSpace(in.Token)
+}
+
+// RequestMeta is where a contact form submission came from
+type RequestMeta struct {
+	IP     string
+	Origin string
+}
+
+// ListInput filters a dojo's leads, newest first
+type ListInput struct {
+	Status string
+	Limit  int
+}
+
+// UpdateLeadInput moves a lead along
+type UpdateLeadInput struct {
+	Status string `json:"status"`
+}
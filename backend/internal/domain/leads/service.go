@@ -0,0 +1,164 @@
+package leads
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+// captchaTimeout bounds the call to the captcha provider
+const captchaTimeout = 5 * time.Second
+
+// Service keeps the leads of a dojo: enquiries sent through its public
+// contact form, which staff follow up. The router checks permissions for the
+// staff endpoints; the form itself is public, behind a captcha and rate
+// limits.
+type Service struct {
+	fs       *firestore.Client
+	dojoRepo *dojo.Repo
+	client   *http.Client
+	config   Config
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, cfg Config) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, client: &http.Client{Timeout: captchaTimeout}, config: cfg}
+}
+
+func (s *Service) settingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("contactForm")
+}
+
+func (s *Service) leadsCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("leads")
+}
+
+// GetSettings returns the contact form settings (defaults when unset)
+func (s *Service) GetSettings(ctx context.Context, dojoID string) (*Settings, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.settingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load contact form settings: %w", err)
+	}
+	st := &Settings{}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode contact form settings: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// UpdateSettings turns the form on or off and sets the address leads are
+// emailed to
+func (s *Service) UpdateSettings(ctx context.Context, staffUID, dojoID string, in UpdateSettingsInput) (*Settings, error) {
+	in.Trim()
+	if in.NotifyEmail != nil && *in.NotifyEmail != "" {
+		if !validEmail(*in.NotifyEmail) {
+			return nil, fmt.Errorf("%w: notifyEmail is not a valid address", ErrBadRequest)
+		}
+	}
+	st, err := s.GetSettings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Enabled != nil {
+		st.Enabled = *in.Enabled
+	}
+	if in.NotifyEmail != nil {
+		st.NotifyEmail = *in.NotifyEmail
+	}
+	st.UpdatedAt = time.Now().UTC()
+	st.UpdatedBy = staffUID
+
+	if _, err := s.settingsRef(dojoID).Set(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save contact form settings: %w", err)
+	}
+	return st, nil
+}
+
+// List returns a dojo's leads, newest first
+func (s *Service) List(ctx context.Context, dojoID string, in ListInput) ([]Lead, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	in.Status = strings.TrimSpace(in.Status)
+	if in.Status != "" && !isValidStatus(in.Status) {
+		return nil, fmt.Errorf("%w: status must be one of: %s", ErrBadRequest, strings.Join(validStatuses, ", "))
+	}
+	if in.Limit <= 0 {
+		in.Limit = 50
+	}
+	if in.Limit > 100 {
+		in.Limit = 100
+	}
+
+	q := s.leadsCol(dojoID).Query
+	if in.Status != "" {
+		q = q.Where("status", "==", in.Status)
+	}
+	docs, err := q.OrderBy("createdAt", firestore.Desc).Limit(in.Limit).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list leads: %w", err)
+	}
+	out := make([]Lead, 0, len(docs))
+	for _, doc := range docs {
+		var l Lead
+		if err := doc.DataTo(&l); err != nil {
+			continue
+		}
+		l.ID = doc.Ref.ID
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// UpdateLead sets the status of a lead
+func (s *Service) UpdateLead(ctx context.Context, staffUID, dojoID, leadID string, in UpdateLeadInput) (*Lead, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	leadID = strings.TrimSpace(leadID)
+	in.Status = strings.TrimSpace(in.Status)
+	if dojoID == "" || leadID == "" {
+		return nil, fmt.Errorf("%w: dojoId and leadId are required", ErrBadRequest)
+	}
+	if !isValidStatus(in.Status) {
+		return nil, fmt.Errorf("%w: status must be one of: %s", ErrBadRequest, strings.Join(validStatuses, ", "))
+	}
+
+	ref := s.leadsCol(dojoID).Doc(leadID)
+	_, err := ref.Update(ctx, []firestore.Update{
+		{Path: "status", Value: in.Status},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+		{Path: "updatedBy", Value: staffUID},
+	})
+	if err != nil {
+		if _, gerr := ref.Get(ctx); gerr != nil {
+			return nil, fmt.Errorf("%w: lead not found", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to update lead: %w", err)
+	}
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lead: %w", err)
+	}
+	var l Lead
+	if err := doc.DataTo(&l); err != nil {
+		return nil, fmt.Errorf("failed to decode lead: %w", err)
+	}
+	l.ID = doc.Ref.ID
+	return &l, nil
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
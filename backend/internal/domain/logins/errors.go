@@ -0,0 +1,21 @@
+package logins
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrBadRequest = errors.New("bad request")
+	ErrRevoked    = errors.New("device revoked")
+)
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrRevoked(err error) bool {
+	return errors.Is(err, ErrRevoked)
+}
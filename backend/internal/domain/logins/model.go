@@ -0,0 +1,82 @@
+package logins
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	StatusTrusted = "trusted"
+	StatusRevoked = "revoked"
+)
+
+// Audit log entry types
+const (
+	AuditNewDevice       = "login.new_device"
+	AuditUnusualLocation = "login.unusual_location"
+	AuditDeviceRevoked   = "login.device_revoked"
+)
+
+// Device is users/{uid}/loginDevices/{fingerprint}, a browser or app the
+// user has signed in from. Server-only.
+type Device struct {
+	ID          string     `firestore:"-" json:"id"`
+	Label       string     `firestore:"label" json:"label"` // e.g. "Chrome on Windows"
+	UserAgent   string     `firestore:"userAgent" json:"userAgent"`
+	Status      string     `firestore:"status" json:"status"`
+	LastIP      string     `firestore:"lastIp" json:"lastIp"`
+	IPs         []string   `firestore:"ips" json:"ips"` // most recent last
+	Countries   []string   `firestore:"countries" json:"countries"`
+	FirstSeenAt time.Time  `firestore:"firstSeenAt" json:"firstSeenAt"`
+	LastSeenAt  time.Time  `firestore:"lastSeenAt" json:"lastSeenAt"`
+	RevokedAt   *time.Time `firestore:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// Sighting is one authenticated request, as seen by the auth middleware
+type Sighting struct {
+	UID      string
+	IsStaff  bool
+	AuthTime time.Time // when the user signed in to get this ID token
+
+	// DeviceID is the app's X-Device-Id, a random id it keeps per install.
+	// Without one the user agent stands in.
+	DeviceID  string
+	IP        string
+	UserAgent string
+	Country   string // ISO code from the edge, when the proxy provides one
+}
+
+// label names a user agent the way account security pages do
+func label(ua string) string {
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "Dart/"), strings.Contains(ua, "okhttp"), strings.Contains(ua, "CFNetwork"):
+		browser = "App"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		os = "iOS"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		os = "macOS"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
@@ -0,0 +1,344 @@
+package logins
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/audit"
+)
+
+const (
+	// recheckEvery bounds how often one device of one user costs Firestore
+	// reads; it is also how long a revocation takes to reach other instances
+	recheckEvery = 5 * time.Minute
+	// maxCacheEntries triggers a sweep of expired cache entries
+	maxCacheEntries = 10000
+
+	maxDevices    = 50 // the least recently seen device is dropped beyond this
+	maxIPs        = 10 // per device
+	maxUserAgent  = 256
+	maxDeviceID   = 128
+	noticeTypeSec = "security"
+)
+
+type Service struct {
+	fs       *firestore.Client
+	auditSvc *audit.Service
+
+	mu      sync.Mutex
+	checked map[string]time.Time // uid|fingerprint -> last full check
+}
+
+func NewService(fs *firestore.Client) *Service {
+	return &Service{fs: fs, checked: map[string]time.Time{}}
+}
+
+// SetAuditService records new-device and location alerts in the audit log
+func (s *Service) SetAuditService(a *audit.Service) {
+	s.auditSvc = a
+}
+
+func (s *Service) devicesCol(uid string) *firestore.CollectionRef {
+	return s.fs.Collection("users").Doc(uid).Collection("loginDevices")
+}
+
+// fingerprint is the device doc id: a hash, so raw ids never show up in paths
+func fingerprint(sg Sighting) string {
+	key := "ua:" + sg.UserAgent
+	if sg.DeviceID != "" {
+		key = "id:" + sg.DeviceID
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (s *Service) recentlyChecked(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.checked[key]
+	return ok && now.Sub(at) < recheckEvery
+}
+
+func (s *Service) markChecked(key string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.checked) >= maxCacheEntries {
+		for k, at := range s.checked {
+			if now.Sub(at) >= recheckEvery {
+				delete(s.checked, k)
+			}
+		}
+	}
+	s.checked[key] = now
+}
+
+func (s *Service) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.checked, key)
+}
+
+// Observe records that uid made a request from a device. A device the user
+// has not used before, or a country none of their devices has been seen in,
+// raises a security notification and an audit entry for staff accounts.
+// Requests from a revoked device get ErrRevoked until the user signs in
+// again. Tracking failures are logged and never fail the request.
+func (s *Service) Observe(ctx context.Context, sg Sighting) error {
+	if sg.UID == "" {
+		return nil
+	}
+	if len(sg.UserAgent) > maxUserAgent {
+		sg.UserAgent = sg.UserAgent[:maxUserAgent]
+	}
+	if len(sg.DeviceID) > maxDeviceID {
+		sg.DeviceID = sg.DeviceID[:maxDeviceID]
+	}
+	sg.Country = normalizeCountry(sg.Country)
+
+	fp := fingerprint(sg)
+	key := sg.UID + "|" + fp
+	now := time.Now().UTC()
+	if s.recentlyChecked(key, now) {
+		return nil
+	}
+
+	known, err := s.list(ctx, sg.UID)
+	if err != nil {
+		log.Printf("logins: %v", err)
+		return nil
+	}
+	var current *Device
+	countries := []string{}
+	for i := range known {
+		if known[i].ID == fp {
+			current = &known[i]
+		}
+		if known[i].Status == StatusTrusted {
+			for _, c := range known[i].Countries {
+				if !slices.Contains(countries, c) {
+					countries = append(countries, c)
+				}
+			}
+		}
+	}
+
+	if current != nil && current.Status == StatusRevoked && current.RevokedAt != nil &&
+		!sg.AuthTime.After(*current.RevokedAt) {
+		return fmt.Errorf("%w: sign in again on this device", ErrRevoked)
+	}
+
+	newDevice := current == nil || current.Status == StatusRevoked
+	newCountry := sg.Country != "" && len(countries) > 0 && !slices.Contains(countries, sg.Country)
+
+	d := Device{
+		Label:       label(sg.UserAgent),
+		UserAgent:   sg.UserAgent,
+		Status:      StatusTrusted,
+		LastIP:      sg.IP,
+		IPs:         []string{},
+		Countries:   []string{},
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	if !newDevice {
+		d.IPs = current.IPs
+		d.Countries = current.Countries
+		d.FirstSeenAt = current.FirstSeenAt
+	}
+	if sg.IP != "" {
+		d.IPs = slices.DeleteFunc(slices.Clone(d.IPs), func(ip string) bool { return ip == sg.IP })
+		d.IPs = append(d.IPs, sg.IP)
+		if len(d.IPs) > maxIPs {
+			d.IPs = d.IPs[len(d.IPs)-maxIPs:]
+		}
+	}
+	if sg.Country != "" && !slices.Contains(d.Countries, sg.Country) {
+		d.Countries = append(d.Countries, sg.Country)
+	}
+
+	// RevokedAt is left out, so a device signed in again is trusted again
+	if _, err := s.devicesCol(sg.UID).Doc(fp).Set(ctx, d); err != nil {
+		log.Printf("logins: failed to record device of %s: %v", sg.UID, err)
+		return nil
+	}
+	s.markChecked(key, now)
+
+	if newDevice && current == nil && len(known) >= maxDevices {
+		s.dropOldest(ctx, sg.UID, known)
+	}
+
+	// the first device an account is seen on is its baseline, not an alert
+	firstDevice := len(known) == 0
+	if !sg.IsStaff || firstDevice || !(newDevice || newCountry) {
+		return nil
+	}
+	d.ID = fp
+	s.alert(ctx, sg, &d, newDevice, newCountry)
+	return nil
+}
+
+// alert notifies the user and writes the audit entry
+func (s *Service) alert(ctx context.Context, sg Sighting, d *Device, newDevice, newCountry bool) {
+	where := sg.IP
+	if sg.Country != "" {
+		where += ", " + sg.Country
+	}
+
+	kind := AuditNewDevice
+	title := "New sign-in to your account"
+	body := fmt.Sprintf("Your account was used from %s (%s). If this wasn't you, revoke the device and change your password.", d.Label, where)
+	if !newDevice {
+		kind = AuditUnusualLocation
+		title = "Sign-in from a new location"
+		body = fmt.Sprintf("Your account was used from %s on %s. If this wasn't you, revoke the device and change your password.", sg.Country, d.Label)
+	}
+
+	_, _, err := s.fs.Collection("users").Doc(sg.UID).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title":     title,
+		"body":      body,
+		"type":      noticeTypeSec,
+		"data":      map[string]interface{}{"deviceId": d.ID, "alert": kind},
+		"read":      false,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("logins: failed to notify %s: %v", sg.UID, err)
+	}
+
+	if s.auditSvc == nil {
+		return
+	}
+	err = s.auditSvc.Record(ctx, audit.Entry{
+		Type:      kind,
+		UID:       sg.UID,
+		ActorUID:  sg.UID,
+		IP:        sg.IP,
+		UserAgent: sg.UserAgent,
+		Data: map[string]interface{}{
+			"deviceId":   d.ID,
+			"label":      d.Label,
+			"country":    sg.Country,
+			"newDevice":  newDevice,
+			"newCountry": newCountry,
+		},
+	})
+	if err != nil {
+		log.Printf("logins: %v", err)
+	}
+}
+
+// dropOldest keeps the device list bounded
+func (s *Service) dropOldest(ctx context.Context, uid string, known []Device) {
+	oldest := slices.MinFunc(known, func(a, b Device) int { return a.LastSeenAt.Compare(b.LastSeenAt) })
+	if _, err := s.devicesCol(uid).Doc(oldest.ID).Delete(ctx); err != nil {
+		log.Printf("logins: failed to drop device %s of %s: %v", oldest.ID, uid, err)
+	}
+}
+
+func (s *Service) list(ctx context.Context, uid string) ([]Device, error) {
+	iter := s.devicesCol(uid).Limit(maxDevices + 1).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Device{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list login devices of %s: %w", uid, err)
+		}
+		var d Device
+		if err := doc.DataTo(&d); err != nil {
+			continue
+		}
+		d.ID = doc.Ref.ID
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// List returns the user's devices, most recently seen first
+func (s *Service) List(ctx context.Context, uid string) ([]Device, error) {
+	if uid == "" {
+		return nil, fmt.Errorf("%w: uid is required", ErrBadRequest)
+	}
+	out, err := s.list(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(out, func(a, b Device) int { return b.LastSeenAt.Compare(a.LastSeenAt) })
+	return out, nil
+}
+
+// Revoke stops trusting one of the user's devices. Requests made with ID
+// tokens from before the revocation are refused; signing in again on the
+// device makes it new (and alerting) again.
+func (s *Service) Revoke(ctx context.Context, uid, deviceID, ip, userAgent string) (*Device, error) {
+	deviceID = strings.TrimSpace(deviceID)
+	if uid == "" || deviceID == "" || strings.Contains(deviceID, "/") {
+		return nil, fmt.Errorf("%w: deviceId is required", ErrBadRequest)
+	}
+	ref := s.devicesCol(uid).Doc(deviceID)
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get login device: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: device not found", ErrNotFound)
+	}
+	var d Device
+	if err := doc.DataTo(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode login device: %w", err)
+	}
+	d.ID = doc.Ref.ID
+	if d.Status == StatusRevoked {
+		return &d, nil
+	}
+
+	now := time.Now().UTC()
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "status", Value: StatusRevoked},
+		{Path: "revokedAt", Value: now},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to revoke login device: %w", err)
+	}
+	s.forget(uid + "|" + d.ID)
+	d.Status = StatusRevoked
+	d.RevokedAt = &now
+
+	if s.auditSvc != nil {
+		err := s.auditSvc.Record(ctx, audit.Entry{
+			Type:      AuditDeviceRevoked,
+			UID:       uid,
+			ActorUID:  uid,
+			IP:        ip,
+			UserAgent: userAgent,
+			Data:      map[string]interface{}{"deviceId": d.ID, "label": d.Label},
+		})
+		if err != nil {
+			log.Printf("logins: %v", err)
+		}
+	}
+	return &d, nil
+}
+
+// normalizeCountry keeps two-letter codes, dropping the unknown markers
+// proxies send (XX, ZZ, and Cloudflare's T1 for Tor)
+func normalizeCountry(c string) string {
+	c = strings.ToUpper(strings.TrimSpace(c))
+	if len(c) != 2 || c == "XX" || c == "ZZ" || c == "T1" {
+		return ""
+	}
+	return c
+}
@@ -0,0 +1,38 @@
+package maintenance
+
+import "time"
+
+// DefaultMessage is shown to clients when no message was set
+const DefaultMessage = "Dojo Manager is under maintenance. You can still view your data; changes will be possible again shortly."
+
+// State is a maintenance switch. The global one lives at system/maintenance,
+// a dojo's one on the dojo doc (dojos/{dojoId}.maintenance). While enabled,
+// mutating requests get 503 and reads keep working.
+type State struct {
+	Enabled   bool       `firestore:"enabled" json:"enabled"`
+	Message   string     `firestore:"message,omitempty" json:"message,omitempty"`
+	UpdatedAt *time.Time `firestore:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	UpdatedBy string     `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+	// Forced is set when MAINTENANCE_MODE is on; the Firestore switch cannot
+	// turn it off
+	Forced bool `firestore:"-" json:"forced,omitempty"`
+}
+
+// Active reports whether writes are blocked
+func (s *State) Active() bool {
+	return s != nil && s.Enabled
+}
+
+// Notice is the message returned with the 503
+func (s *State) Notice() string {
+	if s == nil || s.Message == "" {
+		return DefaultMessage
+	}
+	return s.Message
+}
+
+// UpdateInput turns a maintenance switch on or off
+type UpdateInput struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,133 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// cacheTTL bounds how long an instance keeps serving a stale global switch;
+// Global runs on every mutating request
+const cacheTTL = 10 * time.Second
+
+const maxMessageLength = 500
+
+type Service struct {
+	fs *firestore.Client
+
+	forced        bool // MAINTENANCE_MODE
+	forcedMessage string
+
+	mu        sync.Mutex
+	cached    State
+	fetchedAt time.Time
+}
+
+func NewService(fs *firestore.Client) *Service {
+	return &Service{fs: fs}
+}
+
+// SetForced turns maintenance on from config, regardless of Firestore (for
+// restores where Firestore itself is unavailable)
+func (s *Service) SetForced(forced bool, message string) {
+	s.forced = forced
+	s.forcedMessage = message
+}
+
+func (s *Service) globalRef() *firestore.DocumentRef {
+	return s.fs.Collection("system").Doc("maintenance")
+}
+
+// Global returns the global switch, cached for cacheTTL. A failed read keeps
+// the last known state so a Firestore hiccup does not block writes.
+func (s *Service) Global(ctx context.Context) State {
+	if s.forced {
+		return State{Enabled: true, Message: s.forcedMessage, Forced: true}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.fetchedAt) < cacheTTL {
+		return s.cached
+	}
+
+	doc, err := s.globalRef().Get(ctx)
+	switch {
+	case err != nil && doc == nil:
+		log.Printf("maintenance: failed to read global switch: %v", err)
+	case !doc.Exists():
+		s.cached = State{}
+	default:
+		var st State
+		if err := doc.DataTo(&st); err != nil {
+			log.Printf("maintenance: failed to decode global switch: %v", err)
+			break
+		}
+		s.cached = st
+	}
+	s.fetchedAt = time.Now()
+	return s.cached
+}
+
+// SetGlobal turns global maintenance on or off (admin). Other instances pick
+// it up within cacheTTL.
+func (s *Service) SetGlobal(ctx context.Context, uid string, in UpdateInput) (State, error) {
+	st, err := newState(uid, in)
+	if err != nil {
+		return State{}, err
+	}
+	if _, err := s.globalRef().Set(ctx, st); err != nil {
+		return State{}, fmt.Errorf("failed to save maintenance switch: %w", err)
+	}
+
+	s.mu.Lock()
+	s.cached = st
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+
+	log.Printf("maintenance: global switch set to %v by %s", st.Enabled, uid)
+	if s.forced {
+		st.Forced = true
+	}
+	return st, nil
+}
+
+// SetDojo turns maintenance on or off for one dojo (admin)
+func (s *Service) SetDojo(ctx context.Context, uid, dojoID string, in UpdateInput) (State, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return State{}, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := newState(uid, in)
+	if err != nil {
+		return State{}, err
+	}
+
+	ref := s.fs.Collection("dojos").Doc(dojoID)
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return State{}, fmt.Errorf("failed to get dojo: %w", err)
+	}
+	if !doc.Exists() {
+		return State{}, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	if _, err := ref.Update(ctx, []firestore.Update{{Path: "maintenance", Value: st}}); err != nil {
+		return State{}, fmt.Errorf("failed to save dojo maintenance switch: %w", err)
+	}
+	log.Printf("maintenance: dojo %s switch set to %v by %s", dojoID, st.Enabled, uid)
+	return st, nil
+}
+
+func newState(uid string, in UpdateInput) (State, error) {
+	msg := strings.TrimSpace(in.Message)
+	if len([]rune(msg)) > maxMessageLength {
+		return State{}, fmt.Errorf("%w: message must be at most %d characters", ErrBadRequest, maxMessageLength)
+	}
+	now := time.Now().UTC()
+	return State{Enabled: in.Enabled, Message: msg, UpdatedAt: &now, UpdatedBy: uid}, nil
+}
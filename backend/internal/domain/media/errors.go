@@ -0,0 +1,31 @@
+package media
+
+import "errors"
+
+var (
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrNotFound      = errors.New("not found")
+	ErrBadRequest    = errors.New("bad request")
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	ErrUnavailable   = errors.New("media storage is not configured")
+)
+
+func IsErrUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrQuotaExceeded(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded)
+}
+
+func IsErrUnavailable(err error) bool {
+	return errors.Is(err, ErrUnavailable)
+}
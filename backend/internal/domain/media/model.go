@@ -0,0 +1,111 @@
+package media
+
+import (
+	"strings"
+	"time"
+)
+
+// Album visibility
+const (
+	VisibilityMembers = "members" // every dojo member
+	VisibilityStaff   = "staff"   // staff only, e.g. while an album is being put together
+)
+
+var ValidVisibilities = []string{VisibilityMembers, VisibilityStaff}
+
+// Photo statuses. A photo is pending from the moment its upload URL is
+// issued until the client confirms the upload.
+const (
+	PhotoPending = "pending"
+	PhotoReady   = "ready"
+)
+
+// Album is dojos/{dojoId}/albums/{albumId}. PhotoCount and Bytes count
+// ready photos only.
+type Album struct {
+	ID                string    `firestore:"-" json:"id"`
+	Title             string    `firestore:"title" json:"title"`
+	Description       string    `firestore:"description,omitempty" json:"description,omitempty"`
+	EventDate         string    `firestore:"eventDate,omitempty" json:"eventDate,omitempty"` // YYYY-MM-DD
+	SessionInstanceID string    `firestore:"sessionInstanceId,omitempty" json:"sessionInstanceId,omitempty"`
+	Visibility        string    `firestore:"visibility" json:"visibility"`
+	CoverPhotoID      string    `firestore:"coverPhotoId,omitempty" json:"coverPhotoId,omitempty"`
+	CoverPath         string    `firestore:"coverPath,omitempty" json:"-"`
+	PhotoCount        int       `firestore:"photoCount" json:"photoCount"`
+	Bytes             int64     `firestore:"bytes" json:"bytes"`
+	CreatedBy         string    `firestore:"createdBy" json:"createdBy"`
+	CreatedAt         time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt         time.Time `firestore:"updatedAt" json:"updatedAt"`
+
+	// CoverURL is a short-lived read URL for the cover photo
+	CoverURL string `firestore:"-" json:"coverUrl,omitempty"`
+}
+
+// AlbumInput creates an album, or replaces its details on update
+type AlbumInput struct {
+	Title             string `json:"title"`
+	Description       string `json:"description,omitempty"`
+	EventDate         string `json:"eventDate,omitempty"`
+	SessionInstanceID string `json:"sessionInstanceId,omitempty"`
+	Visibility        string `json:"visibility,omitempty"`
+	CoverPhotoID      string `json:"coverPhotoId,omitempty"`
+}
+
+func (in *AlbumInput) Trim() {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Description = strings.TrimSpace(in.Description)
+	in.EventDate = strings.TrimSpace(in.EventDate)
+	in.SessionInstanceID = strings.TrimSpace(in.SessionInstanceID)
+	in.Visibility = strings.TrimSpace(in.Visibility)
+	in.CoverPhotoID = strings.TrimSpace(in.CoverPhotoID)
+}
+
+// Photo is dojos/{dojoId}/albums/{albumId}/photos/{photoId}. The image
+// itself is the Storage object at Path.
+type Photo struct {
+	ID          string     `firestore:"-" json:"id"`
+	AlbumID     string     `firestore:"albumId" json:"albumId"`
+	Path        string     `firestore:"path" json:"-"`
+	ContentType string     `firestore:"contentType" json:"contentType"`
+	Bytes       int64      `firestore:"bytes" json:"bytes"`
+	Caption     string     `firestore:"caption,omitempty" json:"caption,omitempty"`
+	Status      string     `firestore:"status" json:"status"`
+	UploadedBy  string     `firestore:"uploadedBy" json:"uploadedBy"`
+	CreatedAt   time.Time  `firestore:"createdAt" json:"createdAt"`
+	ReadyAt     *time.Time `firestore:"readyAt,omitempty" json:"readyAt,omitempty"`
+
+	// URL is a short-lived read URL, set when photos are listed
+	URL string `firestore:"-" json:"url,omitempty"`
+}
+
+// UploadInput asks for a signed upload URL for one photo
+type UploadInput struct {
+	ContentType string `json:"contentType"`
+	Bytes       int64  `json:"bytes"`
+	Caption     string `json:"caption,omitempty"`
+}
+
+func (in *UploadInput) Trim() {
+	in.ContentType = strings.ToLower(strings.TrimSpace(in.ContentType))
+	in.Caption = strings.TrimSpace(in.Caption)
+}
+
+// Upload is a pending photo and where to PUT it. The client must send
+// Headers with the request, they are part of the signature.
+type Upload struct {
+	Photo     Photo             `json:"photo"`
+	URL       string            `json:"uploadUrl"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// Usage is dojos/{dojoId}/settings/mediaUsage, the dojo's storage counter
+type Usage struct {
+	Bytes     int64     `firestore:"bytes" json:"bytes"`
+	Photos    int       `firestore:"photos" json:"photos"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+
+	// Limit is the plan's quota in bytes, -1 if unlimited
+	Limit int64 `firestore:"-" json:"limit"`
+}
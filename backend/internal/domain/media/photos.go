@@ -0,0 +1,370 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/blob"
+)
+
+const (
+	// maxPhotoBytes caps a single upload
+	maxPhotoBytes = 25 << 20
+	// uploadURLTTL is how long a signed upload URL stays valid
+	uploadURLTTL = 15 * time.Minute
+)
+
+// photoExtensions maps the accepted image types to object name extensions
+var photoExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/heic": ".heic",
+}
+
+// getPhoto loads a photo without access checks
+func (s *Service) getPhoto(ctx context.Context, dojoID, albumID, photoID string) (*Photo, error) {
+	if photoID == "" {
+		return nil, fmt.Errorf("%w: photoId is required", ErrBadRequest)
+	}
+	doc, err := s.photosCol(dojoID, albumID).Doc(photoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get photo: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: photo not found", ErrNotFound)
+	}
+	var p Photo
+	if err := doc.DataTo(&p); err != nil {
+		return nil, fmt.Errorf("failed to decode photo: %w", err)
+	}
+	p.ID = doc.Ref.ID
+	return &p, nil
+}
+
+// CreateUpload reserves a photo in an album and returns a signed URL to PUT
+// the image to (staff). The declared size is enforced by Storage and checked
+// against the dojo's remaining quota; the photo stays pending until
+// CompleteUpload.
+func (s *Service) CreateUpload(ctx context.Context, staffUID, dojoID, albumID string, in UploadInput) (*Upload, error) {
+	in.Trim()
+	objects, err := s.objects(dojoID)
+	if err != nil {
+		return nil, err
+	}
+	ext, ok := photoExtensions[in.ContentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: contentType must be image/jpeg, image/png, image/webp or image/heic", ErrBadRequest)
+	}
+	if in.Bytes <= 0 || in.Bytes > maxPhotoBytes {
+		return nil, fmt.Errorf("%w: bytes must be between 1 and %d", ErrBadRequest, maxPhotoBytes)
+	}
+	if utf8.RuneCountInString(in.Caption) > maxCaptionLength {
+		return nil, fmt.Errorf("%w: caption is limited to %d characters", ErrBadRequest, maxCaptionLength)
+	}
+
+	a, err := s.getAlbum(ctx, dojoID, albumID)
+	if err != nil {
+		return nil, err
+	}
+	if a.PhotoCount >= maxAlbumPhotos {
+		return nil, fmt.Errorf("%w: at most %d photos per album", ErrBadRequest, maxAlbumPhotos)
+	}
+	usage, err := s.GetUsage(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if usage.Limit >= 0 && usage.Bytes+in.Bytes > usage.Limit {
+		return nil, fmt.Errorf("%w: %d of %d MB used. Upgrade your plan for more storage.",
+			ErrQuotaExceeded, usage.Bytes>>20, usage.Limit>>20)
+	}
+
+	ref := s.photosCol(dojoID, albumID).NewDoc()
+	p := Photo{
+		AlbumID:     albumID,
+		Path:        albumPrefix(dojoID, albumID) + ref.ID + ext,
+		ContentType: in.ContentType,
+		Bytes:       in.Bytes,
+		Caption:     in.Caption,
+		Status:      PhotoPending,
+		UploadedBy:  staffUID,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	// Storage rejects bodies larger than the declared size
+	u, err := objects.SignedURL(p.Path, blob.URLOptions{
+		Method:      http.MethodPut,
+		Expires:     time.Now().Add(uploadURLTTL),
+		ContentType: in.ContentType,
+		MaxBytes:    in.Bytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign upload url: %w", err)
+	}
+
+	if _, err := ref.Set(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to save photo: %w", err)
+	}
+	p.ID = ref.ID
+	return &Upload{
+		Photo:     p,
+		URL:       u.URL,
+		Method:    u.Method,
+		Headers:   u.Headers,
+		ExpiresAt: u.ExpiresAt,
+	}, nil
+}
+
+// CompleteUpload marks a photo ready once its object is in Storage (staff).
+// The stored size is what counts against the quota; an upload that no
+// longer fits is deleted. Completing a ready photo is a no-op.
+func (s *Service) CompleteUpload(ctx context.Context, dojoID, albumID, photoID string) (*Photo, error) {
+	objects, err := s.objects(dojoID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.getPhoto(ctx, dojoID, albumID, photoID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status == PhotoReady {
+		return p, nil
+	}
+
+	attrs, err := objects.Attrs(ctx, p.Path)
+	if blob.IsErrNotExist(err) {
+		return nil, fmt.Errorf("%w: photo has not been uploaded", ErrBadRequest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check upload: %w", err)
+	}
+	if attrs.ContentType != p.ContentType || attrs.Size <= 0 || attrs.Size > maxPhotoBytes {
+		s.discard(ctx, objects, dojoID, albumID, p)
+		return nil, fmt.Errorf("%w: uploaded file does not match the requested image", ErrBadRequest)
+	}
+
+	limit := s.quota(ctx, dojoID)
+	albumRef := s.albumsCol(dojoID).Doc(albumID)
+	photoRef := s.photosCol(dojoID, albumID).Doc(photoID)
+	now := time.Now().UTC()
+	err = s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		photoDoc, err := tx.Get(photoRef)
+		if err != nil {
+			return fmt.Errorf("failed to get photo: %w", err)
+		}
+		if status, _ := photoDoc.DataAt("status"); status == PhotoReady {
+			return nil
+		}
+		if _, err := tx.Get(albumRef); err != nil {
+			return fmt.Errorf("%w: album not found", ErrNotFound)
+		}
+		var used int64
+		usageDoc, err := tx.Get(s.usageRef(dojoID))
+		if err == nil {
+			if v, err := usageDoc.DataAt("bytes"); err == nil {
+				used, _ = v.(int64)
+			}
+		}
+		if limit >= 0 && used+attrs.Size > limit {
+			return fmt.Errorf("%w: %d of %d MB used. Upgrade your plan for more storage.",
+				ErrQuotaExceeded, used>>20, limit>>20)
+		}
+
+		if err := tx.Update(photoRef, []firestore.Update{
+			{Path: "status", Value: PhotoReady},
+			{Path: "bytes", Value: attrs.Size},
+			{Path: "readyAt", Value: now},
+		}); err != nil {
+			return err
+		}
+		if err := tx.Update(albumRef, []firestore.Update{
+			{Path: "photoCount", Value: firestore.Increment(1)},
+			{Path: "bytes", Value: firestore.Increment(attrs.Size)},
+			{Path: "updatedAt", Value: now},
+		}); err != nil {
+			return err
+		}
+		return tx.Set(s.usageRef(dojoID), map[string]interface{}{
+			"bytes":     firestore.Increment(attrs.Size),
+			"photos":    firestore.Increment(1),
+			"updatedAt": now,
+		}, firestore.MergeAll)
+	})
+	if IsErrQuotaExceeded(err) {
+		s.discard(ctx, objects, dojoID, albumID, p)
+		return nil, err
+	}
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to complete upload: %w", err)
+	}
+
+	p.Status = PhotoReady
+	p.Bytes = attrs.Size
+	p.ReadyAt = &now
+	return p, nil
+}
+
+// discard removes a pending photo and whatever was uploaded for it
+func (s *Service) discard(ctx context.Context, objects blob.Store, dojoID, albumID string, p *Photo) {
+	if err := objects.Delete(ctx, p.Path); err != nil {
+		log.Printf("media: failed to delete rejected upload %s: %v", p.Path, err)
+	}
+	if _, err := s.photosCol(dojoID, albumID).Doc(p.ID).Delete(ctx); err != nil {
+		log.Printf("media: failed to delete rejected photo %s: %v", p.ID, err)
+	}
+}
+
+// DeletePhoto removes a photo and its Storage object (staff). The object
+// goes first, so a failed delete can be retried.
+func (s *Service) DeletePhoto(ctx context.Context, dojoID, albumID, photoID string) error {
+	objects, err := s.objects(dojoID)
+	if err != nil {
+		return err
+	}
+	p, err := s.getPhoto(ctx, dojoID, albumID, photoID)
+	if err != nil {
+		return err
+	}
+	if err := objects.Delete(ctx, p.Path); err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+
+	albumRef := s.albumsCol(dojoID).Doc(albumID)
+	photoRef := s.photosCol(dojoID, albumID).Doc(photoID)
+	now := time.Now().UTC()
+	err = s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		photoDoc, err := tx.Get(photoRef)
+		if err != nil && photoDoc == nil {
+			return err
+		}
+		if !photoDoc.Exists() {
+			return nil
+		}
+		albumDoc, err := tx.Get(albumRef)
+		if err != nil && albumDoc == nil {
+			return err
+		}
+		status, _ := photoDoc.DataAt("status")
+		if status == PhotoReady && albumDoc.Exists() {
+			updates := []firestore.Update{
+				{Path: "photoCount", Value: firestore.Increment(-1)},
+				{Path: "bytes", Value: firestore.Increment(-p.Bytes)},
+				{Path: "updatedAt", Value: now},
+			}
+			if cover, _ := albumDoc.DataAt("coverPhotoId"); cover == photoID {
+				updates = append(updates,
+					firestore.Update{Path: "coverPhotoId", Value: firestore.Delete},
+					firestore.Update{Path: "coverPath", Value: firestore.Delete})
+			}
+			if err := tx.Update(albumRef, updates); err != nil {
+				return err
+			}
+		}
+		if status == PhotoReady {
+			if err := tx.Set(s.usageRef(dojoID), map[string]interface{}{
+				"bytes":     firestore.Increment(-p.Bytes),
+				"photos":    firestore.Increment(-1),
+				"updatedAt": now,
+			}, firestore.MergeAll); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(photoRef)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete photo: %w", err)
+	}
+	return nil
+}
+
+// DeleteAlbum removes an album, its photos and every object under its
+// Storage prefix, including abandoned uploads (staff). If some objects
+// cannot be deleted the album is kept and the call can be retried.
+func (s *Service) DeleteAlbum(ctx context.Context, dojoID, albumID string) error {
+	if _, err := s.getAlbum(ctx, dojoID, albumID); err != nil {
+		return err
+	}
+
+	if s.store != nil {
+		objects, err := s.objects(dojoID)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		err = objects.List(ctx, albumPrefix(dojoID, albumID), func(obj *blob.Attrs) error {
+			if err := objects.Delete(ctx, obj.Name); err != nil {
+				log.Printf("media: failed to delete %s: %v", obj.Name, err)
+				failed++
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list album images: %w", err)
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to delete %d images, try again", failed)
+		}
+	}
+
+	photos, err := s.photosCol(dojoID, albumID).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list photos: %w", err)
+	}
+	type photoDelete struct {
+		job   *firestore.BulkWriterJob
+		bytes int64
+		ready bool
+	}
+	deletes := make([]photoDelete, 0, len(photos))
+	bw := s.fs.BulkWriter(ctx)
+	for _, doc := range photos {
+		var p Photo
+		ready := doc.DataTo(&p) == nil && p.Status == PhotoReady
+		job, err := bw.Delete(doc.Ref)
+		if err != nil {
+			log.Printf("media: failed to queue delete of photo %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		deletes = append(deletes, photoDelete{job: job, bytes: p.Bytes, ready: ready})
+	}
+	bw.End()
+
+	var freedBytes int64
+	freedPhotos, failed := 0, len(photos)-len(deletes)
+	for _, d := range deletes {
+		if _, err := d.job.Results(); err != nil {
+			failed++
+			continue
+		}
+		if d.ready {
+			freedBytes += d.bytes
+			freedPhotos++
+		}
+	}
+	if freedPhotos > 0 {
+		if _, err := s.usageRef(dojoID).Set(ctx, map[string]interface{}{
+			"bytes":     firestore.Increment(-freedBytes),
+			"photos":    firestore.Increment(-freedPhotos),
+			"updatedAt": time.Now().UTC(),
+		}, firestore.MergeAll); err != nil {
+			log.Printf("media: failed to update usage for %s: %v", dojoID, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d photos, try again", failed)
+	}
+
+	if _, err := s.albumsCol(dojoID).Doc(albumID).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete album: %w", err)
+	}
+	return nil
+}
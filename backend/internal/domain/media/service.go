@@ -0,0 +1,355 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/blob"
+	"dojo-manager/backend/internal/domain/dojo"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	maxAlbums            = 100
+	maxTitleLength       = 120
+	maxDescriptionLength = 2000
+	maxCaptionLength     = 500
+	maxAlbumPhotos       = 500
+
+	// readURLTTL is how long gallery image URLs stay valid
+	readURLTTL = time.Hour
+)
+
+// Gallery images live in Cloud Storage under dojos/{dojoId}/albums/{albumId}/.
+// Staff upload straight to Storage through signed URLs; the API only issues
+// the URLs, confirms uploads and keeps the counters. Storage used per dojo is
+// tracked in dojos/{dojoId}/settings/mediaUsage and capped by the plan.
+
+type Service struct {
+	fs       *firestore.Client
+	dojoRepo *dojo.Repo
+
+	store     blob.Store
+	stripeSvc *stripedom.Service // storage quota per plan
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo}
+}
+
+// SetStorage sets the store that holds gallery images. Without it albums
+// can be browsed and edited but photos cannot be uploaded.
+func (s *Service) SetStorage(store blob.Store) {
+	s.store = store
+}
+
+// SetStripeService enables the per-plan storage quota
+func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
+	s.stripeSvc = stripeSvc
+}
+
+func (s *Service) albumsCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("albums")
+}
+
+func (s *Service) photosCol(dojoID, albumID string) *firestore.CollectionRef {
+	return s.albumsCol(dojoID).Doc(albumID).Collection("photos")
+}
+
+func (s *Service) usageRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("mediaUsage")
+}
+
+// objects is the dojo's part of the store
+func (s *Service) objects(dojoID string) (blob.Store, error) {
+	if s.store == nil {
+		return nil, ErrUnavailable
+	}
+	return blob.ForDojo(s.store, dojoID)
+}
+
+// albumPrefix is the Storage prefix of every image in an album
+func albumPrefix(dojoID, albumID string) string {
+	return fmt.Sprintf("dojos/%s/albums/%s/", dojoID, albumID)
+}
+
+// viewerIsStaff allows the dojo's members and staff, and reports which one
+func (s *Service) viewerIsStaff(ctx context.Context, dojoID, uid string) (bool, error) {
+	if dojoID == "" || uid == "" {
+		return false, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return false, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if isStaff {
+		return true, nil
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+		return false, fmt.Errorf("%w: only dojo members can view the gallery", ErrUnauthorized)
+	}
+	return false, nil
+}
+
+func (in AlbumInput) validate() error {
+	if in.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrBadRequest)
+	}
+	if utf8.RuneCountInString(in.Title) > maxTitleLength {
+		return fmt.Errorf("%w: title is limited to %d characters", ErrBadRequest, maxTitleLength)
+	}
+	if utf8.RuneCountInString(in.Description) > maxDescriptionLength {
+		return fmt.Errorf("%w: description is limited to %d characters", ErrBadRequest, maxDescriptionLength)
+	}
+	if in.EventDate != "" {
+		if _, err := time.Parse(instanceid.DateLayout, in.EventDate); err != nil {
+			return fmt.Errorf("%w: eventDate must be YYYY-MM-DD", ErrBadRequest)
+		}
+	}
+	if in.Visibility != "" && !slices.Contains(ValidVisibilities, in.Visibility) {
+		return fmt.Errorf("%w: visibility must be 'members' or 'staff'", ErrBadRequest)
+	}
+	return nil
+}
+
+// getAlbum loads an album without access checks
+func (s *Service) getAlbum(ctx context.Context, dojoID, albumID string) (*Album, error) {
+	if dojoID == "" || albumID == "" {
+		return nil, fmt.Errorf("%w: dojoId and albumId are required", ErrBadRequest)
+	}
+	doc, err := s.albumsCol(dojoID).Doc(albumID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get album: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: album not found", ErrNotFound)
+	}
+	var a Album
+	if err := doc.DataTo(&a); err != nil {
+		return nil, fmt.Errorf("failed to decode album: %w", err)
+	}
+	a.ID = doc.Ref.ID
+	return &a, nil
+}
+
+// ListAlbums returns the albums the caller may see, newest first. Members
+// see albums shared with members; staff see all of them.
+func (s *Service) ListAlbums(ctx context.Context, uid, dojoID string) ([]Album, error) {
+	isStaff, err := s.viewerIsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	q := s.albumsCol(dojoID).Query
+	if !isStaff {
+		q = q.Where("visibility", "==", VisibilityMembers)
+	}
+	iter := q.OrderBy("createdAt", firestore.Desc).Limit(maxAlbums).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Album{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list albums: %w", err)
+		}
+		var a Album
+		if err := doc.DataTo(&a); err != nil {
+			continue
+		}
+		a.ID = doc.Ref.ID
+		a.CoverURL = s.coverURL(dojoID, &a)
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// GetAlbum returns an album and its photos with read URLs
+func (s *Service) GetAlbum(ctx context.Context, uid, dojoID, albumID string) (*Album, []Photo, error) {
+	isStaff, err := s.viewerIsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := s.getAlbum(ctx, dojoID, albumID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isStaff && a.Visibility != VisibilityMembers {
+		// hidden albums look the same as missing ones to members
+		return nil, nil, fmt.Errorf("%w: album not found", ErrNotFound)
+	}
+
+	iter := s.photosCol(dojoID, albumID).
+		Where("status", "==", PhotoReady).
+		OrderBy("createdAt", firestore.Asc).
+		Limit(maxAlbumPhotos).
+		Documents(ctx)
+	defer iter.Stop()
+
+	photos := []Photo{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list photos: %w", err)
+		}
+		var p Photo
+		if err := doc.DataTo(&p); err != nil {
+			continue
+		}
+		p.ID = doc.Ref.ID
+		if s.store != nil {
+			if url, err := s.readURL(dojoID, p.Path); err == nil {
+				p.URL = url
+			} else {
+				log.Printf("media: failed to sign %s: %v", p.Path, err)
+			}
+		}
+		if p.ID == a.CoverPhotoID {
+			a.CoverURL = p.URL
+		}
+		photos = append(photos, p)
+	}
+	return a, photos, nil
+}
+
+// CreateAlbum adds an album (staff). New albums are shared with members
+// unless created with visibility "staff".
+func (s *Service) CreateAlbum(ctx context.Context, staffUID, dojoID string, in AlbumInput) (*Album, error) {
+	in.Trim()
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	if in.CoverPhotoID != "" {
+		return nil, fmt.Errorf("%w: a new album has no photos to use as cover", ErrBadRequest)
+	}
+	if in.Visibility == "" {
+		in.Visibility = VisibilityMembers
+	}
+
+	now := time.Now().UTC()
+	a := Album{
+		Title:             in.Title,
+		Description:       in.Description,
+		EventDate:         in.EventDate,
+		SessionInstanceID: in.SessionInstanceID,
+		Visibility:        in.Visibility,
+		CreatedBy:         staffUID,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	ref := s.albumsCol(dojoID).NewDoc()
+	if _, err := ref.Set(ctx, a); err != nil {
+		return nil, fmt.Errorf("failed to save album: %w", err)
+	}
+	a.ID = ref.ID
+	return &a, nil
+}
+
+// UpdateAlbum replaces an album's details (staff). The counters are kept.
+func (s *Service) UpdateAlbum(ctx context.Context, dojoID, albumID string, in AlbumInput) (*Album, error) {
+	in.Trim()
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	a, err := s.getAlbum(ctx, dojoID, albumID)
+	if err != nil {
+		return nil, err
+	}
+	if in.CoverPhotoID == "" {
+		a.CoverPath = ""
+	} else if in.CoverPhotoID != a.CoverPhotoID {
+		p, err := s.getPhoto(ctx, dojoID, albumID, in.CoverPhotoID)
+		if err != nil {
+			return nil, err
+		}
+		if p.Status != PhotoReady {
+			return nil, fmt.Errorf("%w: cover photo has not finished uploading", ErrBadRequest)
+		}
+		a.CoverPath = p.Path
+	}
+	if in.Visibility == "" {
+		in.Visibility = a.Visibility
+	}
+
+	a.Title = in.Title
+	a.Description = in.Description
+	a.EventDate = in.EventDate
+	a.SessionInstanceID = in.SessionInstanceID
+	a.Visibility = in.Visibility
+	a.CoverPhotoID = in.CoverPhotoID
+	a.UpdatedAt = time.Now().UTC()
+	if _, err := s.albumsCol(dojoID).Doc(a.ID).Set(ctx, a); err != nil {
+		return nil, fmt.Errorf("failed to save album: %w", err)
+	}
+	return a, nil
+}
+
+// GetUsage returns the dojo's storage use and quota (staff)
+func (s *Service) GetUsage(ctx context.Context, dojoID string) (*Usage, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.usageRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get media usage: %w", err)
+	}
+	u := Usage{}
+	if doc.Exists() {
+		if err := doc.DataTo(&u); err != nil {
+			return nil, fmt.Errorf("failed to decode media usage: %w", err)
+		}
+	}
+	u.Limit = s.quota(ctx, dojoID)
+	return &u, nil
+}
+
+// quota is the dojo's storage limit in bytes, -1 if unlimited
+func (s *Service) quota(ctx context.Context, dojoID string) int64 {
+	if s.stripeSvc == nil {
+		return -1
+	}
+	return s.stripeSvc.MediaStorageLimit(ctx, dojoID)
+}
+
+// readURL signs a short-lived GET for a gallery image
+func (s *Service) readURL(dojoID, path string) (string, error) {
+	objects, err := s.objects(dojoID)
+	if err != nil {
+		return "", err
+	}
+	u, err := objects.SignedURL(path, blob.URLOptions{Expires: time.Now().Add(readURLTTL)})
+	if err != nil {
+		return "", err
+	}
+	return u.URL, nil
+}
+
+// coverURL signs the album's cover, empty if there is none or signing fails
+func (s *Service) coverURL(dojoID string, a *Album) string {
+	if s.store == nil || a.CoverPath == "" {
+		return ""
+	}
+	url, err := s.readURL(dojoID, a.CoverPath)
+	if err != nil {
+		log.Printf("media: failed to sign cover %s: %v", a.CoverPath, err)
+		return ""
+	}
+	return url
+}
@@ -0,0 +1,114 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// CompetitionResult is a dojos/{dojoId}/members/{uid}/competitions document
+type CompetitionResult struct {
+	ID         string    `firestore:"-" json:"id"`
+	Event      string    `firestore:"event" json:"event"`
+	Date       time.Time `firestore:"date" json:"date"`
+	Division   string    `firestore:"division,omitempty" json:"division,omitempty"`
+	Result     string    `firestore:"result" json:"result"` // gold / silver / bronze / participated / free text
+	Notes      string    `firestore:"notes,omitempty" json:"notes,omitempty"`
+	RecordedBy string    `firestore:"recordedBy" json:"recordedBy"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+}
+
+// AddCompetitionResultInput is the body of POST .../members/{memberUid}/competitions
+type AddCompetitionResultInput struct {
+	Event    string `json:"event"`
+	Date     string `json:"date"` // YYYY-MM-DD
+	Division string `json:"division,omitempty"`
+	Result   string `json:"result"`
+	Notes    string `json:"notes,omitempty"`
+}
+
+func (in *AddCompetitionResultInput) Trim() {
+	in.Event = strings.TrimSpace(in.Event)
+	in.Date = strings.TrimSpace(in.Date)
+	in.Division = strings.TrimSpace(in.Division)
+	in.Result = strings.TrimSpace(in.Result)
+	in.Notes = strings.TrimSpace(in.Notes)
+}
+
+func (s *Service) competitionsCol(dojoID, memberUID string) *firestore.CollectionRef {
+	return s.membersCol(dojoID).Doc(memberUID).Collection("competitions")
+}
+
+// AddCompetitionResult records a competition result for a member (staff only)
+func (s *Service) AddCompetitionResult(ctx context.Context, staffUID, dojoID, memberUID string, in AddCompetitionResultInput) (*CompetitionResult, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if in.Event == "" || in.Result == "" {
+		return nil, fmt.Errorf("%w: event and result are required", ErrBadRequest)
+	}
+	date, err := time.Parse("2006-01-02", in.Date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrBadRequest)
+	}
+
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: only staff can record competition results", ErrUnauthorized)
+	}
+	if _, err := s.membersCol(dojoID).Doc(memberUID).Get(ctx); err != nil {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+
+	res := CompetitionResult{
+		Event:      in.Event,
+		Date:       date,
+		Division:   in.Division,
+		Result:     in.Result,
+		Notes:      in.Notes,
+		RecordedBy: staffUID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	ref, _, err := s.competitionsCol(dojoID, memberUID).Add(ctx, res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save competition result: %w", err)
+	}
+	res.ID = ref.ID
+	return &res, nil
+}
+
+// ListCompetitionResults lists a member's competition results, newest first
+func (s *Service) ListCompetitionResults(ctx context.Context, dojoID, memberUID string) ([]CompetitionResult, error) {
+	iter := s.competitionsCol(dojoID, memberUID).
+		OrderBy("date", firestore.Desc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	out := []CompetitionResult{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list competition results: %w", err)
+		}
+		var c CompetitionResult
+		if err := doc.DataTo(&c); err != nil {
+			continue
+		}
+		c.ID = doc.Ref.ID
+		out = append(out, c)
+	}
+	return out, nil
+}
@@ -0,0 +1,520 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Goal is a member's training goal in dojos/{dojoId}/members/{uid}/goals,
+// e.g. "compete in June" or "earn blue belt". The member sets it; coaches
+// comment and mark progress.
+type Goal struct {
+	ID          string        `firestore:"-" json:"id"`
+	Title       string        `firestore:"title" json:"title"`
+	Description string        `firestore:"description,omitempty" json:"description,omitempty"`
+	TargetDate  *time.Time    `firestore:"targetDate,omitempty" json:"targetDate,omitempty"`
+	Status      string        `firestore:"status" json:"status"`
+	Progress    int           `firestore:"progress" json:"progress"` // 0-100, set by coaches
+	Comments    []GoalComment `firestore:"comments" json:"comments"`
+
+	// ReminderDays sends the member a nudge every that many days while the
+	// goal is active; 0 turns reminders off
+	ReminderDays   int        `firestore:"reminderDays" json:"reminderDays"`
+	NextReminderAt *time.Time `firestore:"nextReminderAt" json:"nextReminderAt,omitempty"`
+
+	MemberUID  string     `firestore:"memberUid" json:"memberUid"`
+	DojoID     string     `firestore:"dojoId" json:"dojoId"`
+	CreatedBy  string     `firestore:"createdBy" json:"createdBy"`
+	CreatedAt  time.Time  `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time  `firestore:"updatedAt" json:"updatedAt"`
+	AchievedAt *time.Time `firestore:"achievedAt,omitempty" json:"achievedAt,omitempty"`
+}
+
+// GoalComment is a coach comment on a goal
+type GoalComment struct {
+	AuthorUID string    `firestore:"authorUid" json:"authorUid"`
+	Text      string    `firestore:"text" json:"text"`
+	Progress  *int      `firestore:"progress,omitempty" json:"progress,omitempty"` // progress set with the comment
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+}
+
+const (
+	GoalStatusActive    = "active"
+	GoalStatusAchieved  = "achieved"
+	GoalStatusAbandoned = "abandoned"
+
+	maxGoalTitle       = 200
+	maxGoalDescription = 2000
+	maxGoalComments    = 100
+	maxActiveGoals     = 20
+)
+
+var ValidGoalStatuses = []string{GoalStatusActive, GoalStatusAchieved, GoalStatusAbandoned}
+
+// ValidReminderDays are the reminder intervals a goal can use (0 = off)
+var ValidReminderDays = []int{0, 7, 14, 30}
+
+// GoalInput is the body of POST .../members/{memberUid}/goals
+type GoalInput struct {
+	Title        string `json:"title"`
+	Description  string `json:"description,omitempty"`
+	TargetDate   string `json:"targetDate,omitempty"` // YYYY-MM-DD
+	ReminderDays int    `json:"reminderDays,omitempty"`
+}
+
+func (in *GoalInput) Trim() {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Description = strings.TrimSpace(in.Description)
+	in.TargetDate = strings.TrimSpace(in.TargetDate)
+}
+
+// UpdateGoalInput is the body of PUT .../goals/{goalId} (nil = unchanged).
+// Progress and the achieved status are for coaches; members may edit the
+// text, target date and reminders, or abandon the goal.
+type UpdateGoalInput struct {
+	Title        *string `json:"title,omitempty"`
+	Description  *string `json:"description,omitempty"`
+	TargetDate   *string `json:"targetDate,omitempty"` // "" clears it
+	ReminderDays *int    `json:"reminderDays,omitempty"`
+	Status       *string `json:"status,omitempty"`
+	Progress     *int    `json:"progress,omitempty"`
+}
+
+// GoalCommentInput is the body of POST .../goals/{goalId}/comments (staff)
+type GoalCommentInput struct {
+	Text     string `json:"text"`
+	Progress *int   `json:"progress,omitempty"`
+}
+
+// GoalReminderResult is returned by the reminder job
+type GoalReminderResult struct {
+	Checked int `json:"checked"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+}
+
+func (s *Service) goalsCol(dojoID, memberUID string) *firestore.CollectionRef {
+	return s.membersCol(dojoID).Doc(memberUID).Collection("goals")
+}
+
+// goalViewer checks the caller is staff or the member and the member exists
+func (s *Service) goalViewer(ctx context.Context, uid, dojoID, memberUID string) (Viewer, error) {
+	if dojoID == "" || memberUID == "" {
+		return Viewer{}, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	viewer := s.ViewerFor(ctx, dojoID, uid)
+	if !viewer.CanSeePrivate(memberUID) {
+		return viewer, fmt.Errorf("%w: only staff or the member can manage goals", ErrUnauthorized)
+	}
+	if _, err := s.membersCol(dojoID).Doc(memberUID).Get(ctx); err != nil {
+		return viewer, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	return viewer, nil
+}
+
+func parseTargetDate(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: targetDate must be YYYY-MM-DD", ErrBadRequest)
+	}
+	return &t, nil
+}
+
+func validateGoalText(title, description string) error {
+	if title == "" {
+		return fmt.Errorf("%w: title is required", ErrBadRequest)
+	}
+	if len(title) > maxGoalTitle || len(description) > maxGoalDescription {
+		return fmt.Errorf("%w: title is limited to %d and description to %d characters", ErrBadRequest, maxGoalTitle, maxGoalDescription)
+	}
+	return nil
+}
+
+func validateProgress(p int) error {
+	if p < 0 || p > 100 {
+		return fmt.Errorf("%w: progress must be between 0 and 100", ErrBadRequest)
+	}
+	return nil
+}
+
+// nextReminder returns when an active goal is next reminded, nil if never
+func nextReminder(from time.Time, status string, days int) *time.Time {
+	if status != GoalStatusActive || days <= 0 {
+		return nil
+	}
+	t := from.AddDate(0, 0, days)
+	return &t
+}
+
+// ListGoals returns a member's goals, newest first (staff or the member)
+func (s *Service) ListGoals(ctx context.Context, uid, dojoID, memberUID string) ([]Goal, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if _, err := s.goalViewer(ctx, uid, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+	return s.listGoals(ctx, dojoID, memberUID)
+}
+
+func (s *Service) listGoals(ctx context.Context, dojoID, memberUID string) ([]Goal, error) {
+	iter := s.goalsCol(dojoID, memberUID).
+		OrderBy("createdAt", firestore.Desc).
+		Limit(timelineSourceLimit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	out := []Goal{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list goals: %w", err)
+		}
+		var g Goal
+		if err := doc.DataTo(&g); err != nil {
+			continue
+		}
+		g.ID = doc.Ref.ID
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+func (s *Service) getGoal(ctx context.Context, dojoID, memberUID, goalID string) (*Goal, error) {
+	doc, err := s.goalsCol(dojoID, memberUID).Doc(goalID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get goal: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: goal not found", ErrNotFound)
+	}
+	var g Goal
+	if err := doc.DataTo(&g); err != nil {
+		return nil, fmt.Errorf("failed to decode goal: %w", err)
+	}
+	g.ID = doc.Ref.ID
+	return &g, nil
+}
+
+// CreateGoal sets a new goal (the member, or staff on their behalf)
+func (s *Service) CreateGoal(ctx context.Context, uid, dojoID, memberUID string, in GoalInput) (*Goal, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if _, err := s.goalViewer(ctx, uid, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+	if err := validateGoalText(in.Title, in.Description); err != nil {
+		return nil, err
+	}
+	target, err := parseTargetDate(in.TargetDate)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(ValidReminderDays, in.ReminderDays) {
+		return nil, fmt.Errorf("%w: reminderDays must be one of 0, 7, 14, 30", ErrBadRequest)
+	}
+
+	active, err := s.goalsCol(dojoID, memberUID).Where("status", "==", GoalStatusActive).Select().Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count goals: %w", err)
+	}
+	if len(active) >= maxActiveGoals {
+		return nil, fmt.Errorf("%w: at most %d active goals", ErrBadRequest, maxActiveGoals)
+	}
+
+	now := time.Now().UTC()
+	g := Goal{
+		Title:          in.Title,
+		Description:    in.Description,
+		TargetDate:     target,
+		Status:         GoalStatusActive,
+		Comments:       []GoalComment{},
+		ReminderDays:   in.ReminderDays,
+		NextReminderAt: nextReminder(now, GoalStatusActive, in.ReminderDays),
+		MemberUID:      memberUID,
+		DojoID:         dojoID,
+		CreatedBy:      uid,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	ref := s.goalsCol(dojoID, memberUID).NewDoc()
+	if _, err := ref.Set(ctx, g); err != nil {
+		return nil, fmt.Errorf("failed to save goal: %w", err)
+	}
+	g.ID = ref.ID
+	return &g, nil
+}
+
+// UpdateGoal edits a goal. Members edit their own goals; progress and the
+// achieved status are set by staff.
+func (s *Service) UpdateGoal(ctx context.Context, uid, dojoID, memberUID, goalID string, in UpdateGoalInput) (*Goal, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	viewer, err := s.goalViewer(ctx, uid, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+	g, err := s.getGoal(ctx, dojoID, memberUID, goalID)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Title != nil {
+		g.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.Description != nil {
+		g.Description = strings.TrimSpace(*in.Description)
+	}
+	if err := validateGoalText(g.Title, g.Description); err != nil {
+		return nil, err
+	}
+	if in.TargetDate != nil {
+		if g.TargetDate, err = parseTargetDate(strings.TrimSpace(*in.TargetDate)); err != nil {
+			return nil, err
+		}
+	}
+	if in.ReminderDays != nil {
+		if !slices.Contains(ValidReminderDays, *in.ReminderDays) {
+			return nil, fmt.Errorf("%w: reminderDays must be one of 0, 7, 14, 30", ErrBadRequest)
+		}
+		g.ReminderDays = *in.ReminderDays
+	}
+	if in.Progress != nil {
+		if !viewer.IsStaff {
+			return nil, fmt.Errorf("%w: progress is set by coaches", ErrUnauthorized)
+		}
+		if err := validateProgress(*in.Progress); err != nil {
+			return nil, err
+		}
+		g.Progress = *in.Progress
+	}
+
+	now := time.Now().UTC()
+	if in.Status != nil && *in.Status != g.Status {
+		status := strings.TrimSpace(*in.Status)
+		if !slices.Contains(ValidGoalStatuses, status) {
+			return nil, fmt.Errorf("%w: status must be one of: %s", ErrBadRequest, strings.Join(ValidGoalStatuses, ", "))
+		}
+		if status == GoalStatusAchieved && !viewer.IsStaff {
+			return nil, fmt.Errorf("%w: coaches mark goals as achieved", ErrUnauthorized)
+		}
+		g.Status = status
+		g.AchievedAt = nil
+		if status == GoalStatusAchieved {
+			g.AchievedAt = &now
+			g.Progress = 100
+		}
+	}
+
+	g.NextReminderAt = nextReminder(now, g.Status, g.ReminderDays)
+	g.UpdatedAt = now
+	if _, err := s.goalsCol(dojoID, memberUID).Doc(g.ID).Set(ctx, g); err != nil {
+		return nil, fmt.Errorf("failed to save goal: %w", err)
+	}
+
+	if viewer.IsStaff && uid != memberUID && g.Status == GoalStatusAchieved && in.Status != nil {
+		s.notifyGoal(ctx, dojoID, memberUID, g, "goal_achieved", "Goal achieved", fmt.Sprintf("Your coach marked \"%s\" as achieved", g.Title))
+	}
+	return g, nil
+}
+
+// DeleteGoal removes a goal (staff or the member)
+func (s *Service) DeleteGoal(ctx context.Context, uid, dojoID, memberUID, goalID string) error {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if _, err := s.goalViewer(ctx, uid, dojoID, memberUID); err != nil {
+		return err
+	}
+	g, err := s.getGoal(ctx, dojoID, memberUID, goalID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.goalsCol(dojoID, memberUID).Doc(g.ID).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete goal: %w", err)
+	}
+	return nil
+}
+
+// CommentOnGoal adds a coach comment, optionally updating progress, and
+// notifies the member (staff only)
+func (s *Service) CommentOnGoal(ctx context.Context, staffUID, dojoID, memberUID, goalID string, in GoalCommentInput) (*Goal, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	in.Text = strings.TrimSpace(in.Text)
+	viewer, err := s.goalViewer(ctx, staffUID, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+	if !viewer.IsStaff {
+		return nil, fmt.Errorf("%w: only coaches can comment on goals", ErrUnauthorized)
+	}
+	if in.Text == "" && in.Progress == nil {
+		return nil, fmt.Errorf("%w: text or progress is required", ErrBadRequest)
+	}
+	if len(in.Text) > maxNoteText {
+		return nil, fmt.Errorf("%w: text must be at most %d characters", ErrBadRequest, maxNoteText)
+	}
+	if in.Progress != nil {
+		if err := validateProgress(*in.Progress); err != nil {
+			return nil, err
+		}
+	}
+
+	ref := s.goalsCol(dojoID, memberUID).Doc(strings.TrimSpace(goalID))
+	var out Goal
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to get goal: %w", err)
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: goal not found", ErrNotFound)
+		}
+		var g Goal
+		if err := doc.DataTo(&g); err != nil {
+			return fmt.Errorf("failed to decode goal: %w", err)
+		}
+		if len(g.Comments) >= maxGoalComments {
+			return fmt.Errorf("%w: at most %d comments per goal", ErrBadRequest, maxGoalComments)
+		}
+
+		now := time.Now().UTC()
+		g.Comments = append(g.Comments, GoalComment{
+			AuthorUID: staffUID,
+			Text:      in.Text,
+			Progress:  in.Progress,
+			CreatedAt: now,
+		})
+		if in.Progress != nil {
+			g.Progress = *in.Progress
+		}
+		g.UpdatedAt = now
+		g.ID = doc.Ref.ID
+		out = g
+		return tx.Set(ref, g)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body := in.Text
+	if body == "" {
+		body = fmt.Sprintf("Progress on \"%s\" is now %d%%", out.Title, out.Progress)
+	}
+	s.notifyGoal(ctx, dojoID, memberUID, &out, "goal_comment", "Coach feedback on your goal", body)
+	return &out, nil
+}
+
+// SendGoalReminders nudges members about active goals whose reminder is due
+// and schedules the next one. Meant to be triggered daily by Cloud Scheduler.
+func (s *Service) SendGoalReminders(ctx context.Context, now time.Time) (*GoalReminderResult, error) {
+	iter := s.client.CollectionGroup("goals").
+		Where("status", "==", GoalStatusActive).
+		Where("nextReminderAt", "<=", now).
+		Documents(ctx)
+	defer iter.Stop()
+
+	res := &GoalReminderResult{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("failed to list due goals: %w", err)
+		}
+		res.Checked++
+
+		var g Goal
+		if err := doc.DataTo(&g); err != nil || g.DojoID == "" || g.MemberUID == "" {
+			res.Failed++
+			continue
+		}
+		g.ID = doc.Ref.ID
+
+		_, err = doc.Ref.Update(ctx, []firestore.Update{
+			{Path: "nextReminderAt", Value: nextReminder(now, g.Status, g.ReminderDays)},
+		})
+		if err != nil {
+			log.Printf("goals: failed to reschedule reminder %s: %v", doc.Ref.Path, err)
+			res.Failed++
+			continue
+		}
+
+		body := fmt.Sprintf("How is \"%s\" going?", g.Title)
+		if g.TargetDate != nil {
+			body = fmt.Sprintf("\"%s\" is due %s. Keep going!", g.Title, g.TargetDate.Format("2006-01-02"))
+		}
+		if s.notifyGoal(ctx, g.DojoID, g.MemberUID, &g, "goal_reminder", "Training goal reminder", body) {
+			res.Sent++
+		} else {
+			res.Failed++
+		}
+	}
+	return res, nil
+}
+
+// notifyGoal writes an in-app notification about a goal to the member
+func (s *Service) notifyGoal(ctx context.Context, dojoID, memberUID string, g *Goal, kind, title, body string) bool {
+	_, _, err := s.client.Collection("users").Doc(memberUID).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title":     title,
+		"body":      body,
+		"type":      kind,
+		"data":      map[string]interface{}{"goalId": g.ID, "memberUid": memberUID},
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("goals: failed to notify %s: %v", memberUID, err)
+		return false
+	}
+	return true
+}
+
+func (s *Service) goalItems(ctx context.Context, dojoID, memberUID string) ([]TimelineItem, error) {
+	goals, err := s.listGoals(ctx, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []TimelineItem{}
+	for _, g := range goals {
+		data := map[string]interface{}{
+			"goalId":   g.ID,
+			"status":   g.Status,
+			"progress": g.Progress,
+		}
+		out = append(out, TimelineItem{
+			ID:     "goal_" + g.ID,
+			Type:   TimelineGoal,
+			At:     g.CreatedAt,
+			Title:  "Goal set: " + g.Title,
+			Detail: g.Description,
+			Data:   data,
+		})
+		if g.AchievedAt != nil {
+			out = append(out, TimelineItem{
+				ID:    "goal_achieved_" + g.ID,
+				Type:  TimelineGoal,
+				At:    *g.AchievedAt,
+				Title: "Goal achieved: " + g.Title,
+				Data:  data,
+			})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+// LookupResult is the account behind an email and, when the account belongs
+// to the dojo, its membership
+type LookupResult struct {
+	UID         string          `json:"uid"`
+	Email       string          `json:"email"`
+	DisplayName string          `json:"displayName"`
+	PhotoURL    string          `json:"photoURL,omitempty"`
+	Disabled    bool            `json:"disabled,omitempty"`
+	IsMember    bool            `json:"isMember"`
+	Member      *MemberWithUser `json:"member,omitempty"`
+}
+
+// SetAuthClient enables email lookup through Firebase Auth
+func (s *Service) SetAuthClient(authClient *auth.Client) {
+	s.authClient = authClient
+}
+
+// LookupByEmail resolves an email to a Firebase account so staff can add a
+// member or record a rank without knowing the UID. Callers are checked for
+// members.view by the router.
+func (s *Service) LookupByEmail(ctx context.Context, dojoID, email string) (*LookupResult, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if dojoID == "" || email == "" {
+		return nil, fmt.Errorf("%w: dojoId and email are required", ErrBadRequest)
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, fmt.Errorf("%w: invalid email", ErrBadRequest)
+	}
+	if s.authClient == nil {
+		return nil, fmt.Errorf("email lookup is not configured")
+	}
+
+	u, err := s.authClient.GetUserByEmail(ctx, email)
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			return nil, fmt.Errorf("%w: no account with this email", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to look up email: %w", err)
+	}
+
+	out := &LookupResult{
+		UID:         u.UID,
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+		PhotoURL:    u.PhotoURL,
+		Disabled:    u.Disabled,
+	}
+
+	doc, err := s.membersCol(dojoID).Doc(u.UID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	if doc.Exists() {
+		m, err := s.GetMember(ctx, dojoID, u.UID)
+		if err != nil {
+			return nil, err
+		}
+		out.IsMember = true
+		out.Member = m
+		if out.DisplayName == "" {
+			out.DisplayName = m.User.DisplayName
+		}
+	}
+	return out, nil
+}
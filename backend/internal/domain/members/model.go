@@ -8,6 +8,7 @@ import (
 // Member represents a member of a dojo
 type Member struct {
 	UID             string    `firestore:"uid" json:"uid"`
+	MemberNumber    int       `firestore:"memberNumber,omitempty" json:"memberNumber,omitempty"` // front-desk id, see dojo.EnsureMemberNumber
 	Status          string    `firestore:"status" json:"status"`
 	RoleInDojo      string    `firestore:"roleInDojo" json:"roleInDojo"`
 	BeltRank        string    `firestore:"beltRank,omitempty" json:"beltRank,omitempty"`
@@ -19,13 +20,26 @@ type Member struct {
 	UpdatedAt       time.Time `firestore:"updatedAt" json:"updatedAt"`
 	LastPromotionAt time.Time `firestore:"lastPromotionAt,omitempty" json:"lastPromotionAt,omitempty"`
 	LastPromotedBy  string    `firestore:"lastPromotedBy,omitempty" json:"lastPromotedBy,omitempty"`
+	Notes           string    `firestore:"notes,omitempty" json:"notes,omitempty"` // staff only
+
+	// Suspended is set while Suspension is in effect, for security rules and
+	// clients; see suspension.go
+	Suspended  bool        `firestore:"suspended,omitempty" json:"suspended,omitempty"`
+	Suspension *Suspension `firestore:"suspension,omitempty" json:"suspension,omitempty"`
+
+	// TransferredTo is the dojo an inactive member moved to; see transfer.go
+	TransferredTo     string     `firestore:"transferredTo,omitempty" json:"transferredTo,omitempty"`
+	TransferredToName string     `firestore:"transferredToName,omitempty" json:"transferredToName,omitempty"`
+	TransferredAt     *time.Time `firestore:"transferredAt,omitempty" json:"transferredAt,omitempty"`
 }
 
 // MemberUser represents user info associated with a member
 type MemberUser struct {
-	DisplayName string `json:"displayName"`
-	Email       string `json:"email"`
-	PhotoURL    string `json:"photoURL"`
+	DisplayName      string                 `json:"displayName"`
+	Email            string                 `json:"email,omitempty"` // staff only
+	PhotoURL         string                 `json:"photoURL"`
+	EmergencyContact map[string]interface{} `json:"emergencyContact,omitempty"` // staff only
+	DateOfBirth      string                 `json:"dateOfBirth,omitempty"`      // staff only, YYYY-MM-DD
 }
 
 // MemberWithUser represents a member with associated user info
@@ -0,0 +1,218 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// MemberNote is a private coach note in dojos/{dojoId}/members/{uid}/notes.
+// Notes are staff-only: never shown to the member, not even on their own timeline.
+type MemberNote struct {
+	ID         string    `firestore:"-" json:"id"`
+	AuthorUID  string    `firestore:"authorUid" json:"authorUid"`
+	Text       string    `firestore:"text" json:"text"`
+	Category   string    `firestore:"category,omitempty" json:"category,omitempty"`
+	Visibility string    `firestore:"visibility" json:"visibility"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+const (
+	NoteVisibilityStaff = "staff"
+
+	NoteCategoryGeneral   = "general"
+	NoteCategoryInjury    = "injury"
+	NoteCategoryGoal      = "goal"
+	NoteCategoryPromotion = "promotion"
+
+	maxNoteText = 2000
+)
+
+var ValidNoteCategories = []string{NoteCategoryGeneral, NoteCategoryInjury, NoteCategoryGoal, NoteCategoryPromotion}
+
+// NoteInput is the body of POST / PUT .../members/{memberUid}/notes
+type NoteInput struct {
+	Text     string `json:"text"`
+	Category string `json:"category,omitempty"`
+}
+
+func (in *NoteInput) Trim() {
+	in.Text = strings.TrimSpace(in.Text)
+	in.Category = strings.ToLower(strings.TrimSpace(in.Category))
+}
+
+func (in NoteInput) validate() error {
+	if in.Text == "" {
+		return fmt.Errorf("%w: text is required", ErrBadRequest)
+	}
+	if len(in.Text) > maxNoteText {
+		return fmt.Errorf("%w: text must be at most %d characters", ErrBadRequest, maxNoteText)
+	}
+	if in.Category != "" && !isValidNoteCategory(in.Category) {
+		return fmt.Errorf("%w: category must be one of: %s", ErrBadRequest, strings.Join(ValidNoteCategories, ", "))
+	}
+	return nil
+}
+
+func (s *Service) notesCol(dojoID, memberUID string) *firestore.CollectionRef {
+	return s.membersCol(dojoID).Doc(memberUID).Collection("notes")
+}
+
+// requireStaffForMember checks the caller is staff of the dojo and the member exists
+func (s *Service) requireStaffForMember(ctx context.Context, staffUID, dojoID, memberUID string) error {
+	if dojoID == "" || memberUID == "" {
+		return fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: member notes are staff only", ErrUnauthorized)
+	}
+	if _, err := s.membersCol(dojoID).Doc(memberUID).Get(ctx); err != nil {
+		return fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	return nil
+}
+
+// ListNotes lists coach notes on a member, newest first (staff only)
+func (s *Service) ListNotes(ctx context.Context, staffUID, dojoID, memberUID string) ([]MemberNote, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if err := s.requireStaffForMember(ctx, staffUID, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+	return s.listNotes(ctx, dojoID, memberUID, timelineSourceLimit)
+}
+
+func (s *Service) listNotes(ctx context.Context, dojoID, memberUID string, limit int) ([]MemberNote, error) {
+	iter := s.notesCol(dojoID, memberUID).
+		OrderBy("createdAt", firestore.Desc).
+		Limit(limit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	out := []MemberNote{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list notes: %w", err)
+		}
+		var n MemberNote
+		if err := doc.DataTo(&n); err != nil {
+			continue
+		}
+		n.ID = doc.Ref.ID
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// AddNote adds a coach note on a member (staff only)
+func (s *Service) AddNote(ctx context.Context, staffUID, dojoID, memberUID string, in NoteInput) (*MemberNote, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.requireStaffForMember(ctx, staffUID, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+
+	category := in.Category
+	if category == "" {
+		category = NoteCategoryGeneral
+	}
+	now := time.Now().UTC()
+	n := MemberNote{
+		AuthorUID:  staffUID,
+		Text:       in.Text,
+		Category:   category,
+		Visibility: NoteVisibilityStaff,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	ref, _, err := s.notesCol(dojoID, memberUID).Add(ctx, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save note: %w", err)
+	}
+	n.ID = ref.ID
+	return &n, nil
+}
+
+// UpdateNote edits the text / category of a coach note (staff only)
+func (s *Service) UpdateNote(ctx context.Context, staffUID, dojoID, memberUID, noteID string, in NoteInput) (*MemberNote, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.requireStaffForMember(ctx, staffUID, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+
+	ref := s.notesCol(dojoID, memberUID).Doc(strings.TrimSpace(noteID))
+	if _, err := ref.Get(ctx); err != nil {
+		return nil, fmt.Errorf("%w: note not found", ErrNotFound)
+	}
+
+	updates := map[string]interface{}{
+		"text":      in.Text,
+		"updatedAt": time.Now().UTC(),
+	}
+	if in.Category != "" {
+		updates["category"] = in.Category
+	}
+	if _, err := ref.Set(ctx, updates, firestore.MergeAll); err != nil {
+		return nil, fmt.Errorf("failed to update note: %w", err)
+	}
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload note: %w", err)
+	}
+	var n MemberNote
+	if err := doc.DataTo(&n); err != nil {
+		return nil, fmt.Errorf("failed to decode note: %w", err)
+	}
+	n.ID = doc.Ref.ID
+	return &n, nil
+}
+
+// DeleteNote removes a coach note (staff only)
+func (s *Service) DeleteNote(ctx context.Context, staffUID, dojoID, memberUID, noteID string) error {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if err := s.requireStaffForMember(ctx, staffUID, dojoID, memberUID); err != nil {
+		return err
+	}
+
+	ref := s.notesCol(dojoID, memberUID).Doc(strings.TrimSpace(noteID))
+	if _, err := ref.Get(ctx); err != nil {
+		return fmt.Errorf("%w: note not found", ErrNotFound)
+	}
+	if _, err := ref.Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+	return nil
+}
+
+func isValidNoteCategory(c string) bool {
+	for _, v := range ValidNoteCategories {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// maxCancelledBookings bounds the open booking requests cancelled with a
+// member, as the legacy bookings API does
+const maxCancelledBookings = 200
+
+// removeMemberBatch deletes the member doc together with what only made
+// sense while they belonged to the dojo, in one batch so a failed removal
+// leaves nothing half done:
+//   - the users/{uid}/dojoMemberships/{dojoId} index entry, so the dojo drops
+//     out of the member's dojo switcher
+//   - their join request, so an old request cannot be approved again
+//   - their open booking requests for upcoming classes, cancelled
+//
+// Class reservations and recurring bookings (with their waitlist places)
+// may live in the dojo's own database and are released by subscribers of
+// MemberRemoved. Badges stop working once the member doc is gone; members
+// have no other kiosk credentials.
+func (s *Service) removeMemberBatch(ctx context.Context, dojoID, memberUID string) error {
+	batch := s.client.Batch()
+	batch.Delete(s.membersCol(dojoID).Doc(memberUID))
+	batch.Delete(s.dojoRepo.MembershipIndexRef(memberUID, dojoID))
+	batch.Delete(s.client.Collection("dojos").Doc(dojoID).Collection("joinRequests").Doc(memberUID))
+
+	now := time.Now().UTC()
+	iter := s.client.Collection("bookings").
+		Where("userId", "==", memberUID).
+		Where("status", "in", []interface{}{"pending", "accepted"}).
+		Limit(maxCancelledBookings).
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list bookings: %w", err)
+		}
+		data := doc.Data()
+		if d, _ := data["dojoId"].(string); d != dojoID {
+			continue
+		}
+		if start, ok := data["startAt"].(time.Time); ok && start.Before(now) {
+			continue
+		}
+		batch.Set(doc.Ref, map[string]interface{}{"status": "cancelled", "updatedAt": now}, firestore.MergeAll)
+	}
+
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to delete member: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package members
+
+import (
+	"context"
+	"strings"
+)
+
+// Viewer describes who a member response is being rendered for.
+// Personal fields are only kept for dojo staff or the member themselves,
+// staff notes for staff alone.
+type Viewer struct {
+	UID     string
+	IsStaff bool
+}
+
+// CanSeePrivate reports whether the viewer may see PII of the given member
+func (v Viewer) CanSeePrivate(memberUID string) bool {
+	if v.IsStaff {
+		return true
+	}
+	return v.UID != "" && v.UID == memberUID
+}
+
+// ViewerFor resolves the viewer for a dojo (staff check via dojo repo)
+func (s *Service) ViewerFor(ctx context.Context, dojoID, uid string) Viewer {
+	uid = strings.TrimSpace(uid)
+	v := Viewer{UID: uid}
+	if uid == "" || s.dojoRepo == nil {
+		return v
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, strings.TrimSpace(dojoID), uid)
+	if err == nil && isStaff {
+		v.IsStaff = true
+	}
+	return v
+}
+
+// SerializeMember shapes a member response for the viewer.
+// email, emergency contact, date of birth and the member number are stripped unless the viewer is staff (or self).
+// Coaches' notes and the reason for a suspension are staff only, even for the member themselves.
+func SerializeMember(m MemberWithUser, v Viewer) MemberWithUser {
+	if !v.IsStaff {
+		m.Member.Notes = ""
+		if m.Member.Suspension != nil {
+			sp := *m.Member.Suspension
+			sp.Reason, sp.SuspendedBy = "", ""
+			m.Member.Suspension = &sp
+		}
+	}
+	if v.CanSeePrivate(m.UID) {
+		return m
+	}
+	m.User.Email = ""
+	m.User.EmergencyContact = nil
+	m.User.DateOfBirth = ""
+	m.Member.MemberNumber = 0
+	return m
+}
+
+// SerializeMembers shapes a list of member responses for the viewer
+func SerializeMembers(list []MemberWithUser, v Viewer) []MemberWithUser {
+	out := make([]MemberWithUser, 0, len(list))
+	for _, m := range list {
+		out = append(out, SerializeMember(m, v))
+	}
+	return out
+}
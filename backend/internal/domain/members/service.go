@@ -3,28 +3,45 @@ package members
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
 	"google.golang.org/api/iterator"
 
+	"dojo-manager/backend/internal/domain/attendance"
 	"dojo-manager/backend/internal/domain/dojo"
-	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/domain/metering"
+	"dojo-manager/backend/internal/events"
+	"dojo-manager/backend/internal/planlimit"
 )
 
 type Service struct {
-	client    *firestore.Client
-	dojoRepo  *dojo.Repo
-	stripeSvc *stripedom.Service // plan limit checks
+	client   *firestore.Client
+	dojoRepo *dojo.Repo
+	limits   planlimit.PlanLimiter // plan caps (Unlimited without billing)
+	meter    *metering.Recorder    // usage events (optional)
+	bus      *events.Bus           // roster events (optional)
+
+	attendanceSvc *attendance.Service // timeline milestones (optional)
+	authClient    *auth.Client        // email lookup (optional)
 }
 
-func NewService(client *firestore.Client, dojoRepo *dojo.Repo) *Service {
-	return &Service{client: client, dojoRepo: dojoRepo}
+// NewService takes the plan limiter capping members and staff (nil = unlimited)
+func NewService(client *firestore.Client, dojoRepo *dojo.Repo, limits planlimit.PlanLimiter) *Service {
+	return &Service{client: client, dojoRepo: dojoRepo, limits: planlimit.OrUnlimited(limits)}
 }
 
-func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
-	s.stripeSvc = stripeSvc
+// SetMeteringRecorder sets the recorder for usage events
+func (s *Service) SetMeteringRecorder(meter *metering.Recorder) {
+	s.meter = meter
+}
+
+// SetEventBus publishes MemberChanged after roster writes
+func (s *Service) SetEventBus(bus *events.Bus) {
+	s.bus = bus
 }
 
 func (s *Service) membersCol(dojoID string) *firestore.CollectionRef {
@@ -65,14 +82,12 @@ func (s *Service) GetMember(ctx context.Context, dojoID, memberUID string) (*Mem
 	}
 	member.UID = memberDoc.Ref.ID
 
-	// Get user info
-	userDoc, err := s.client.Collection("users").Doc(memberUID).Get(ctx)
-	var user MemberUser
-	if err == nil && userDoc.Exists() {
-		userData := userDoc.Data()
-		user.DisplayName, _ = userData["displayName"].(string)
-		user.Email, _ = userData["email"].(string)
-		user.PhotoURL, _ = userData["photoURL"].(string)
+	// Get user info, from the member doc once it carries a copy
+	user, synced := syncedUser(memberDoc)
+	if !synced {
+		if userDoc, err := s.client.Collection("users").Doc(memberUID).Get(ctx); err == nil {
+			user = memberUserFrom(userDoc)
+		}
 	}
 
 	return &MemberWithUser{
@@ -104,6 +119,8 @@ func (s *Service) ListMembers(ctx context.Context, input ListMembersInput) ([]Me
 
 	iter := query.Documents(ctx)
 	var results []MemberWithUser
+	var userRefs []*firestore.DocumentRef
+	var unsynced []int // results still needing users/{uid}
 
 	for {
 		doc, err := iter.Next()
@@ -120,26 +137,49 @@ func (s *Service) ListMembers(ctx context.Context, input ListMembersInput) ([]Me
 		}
 		member.UID = doc.Ref.ID
 
-		// Get user info
-		userDoc, _ := s.client.Collection("users").Doc(doc.Ref.ID).Get(ctx)
-		var user MemberUser
-		if userDoc != nil && userDoc.Exists() {
-			userData := userDoc.Data()
-			user.DisplayName, _ = userData["displayName"].(string)
-			user.Email, _ = userData["email"].(string)
-			user.PhotoURL, _ = userData["photoURL"].(string)
+		user, synced := syncedUser(doc)
+		if !synced {
+			unsynced = append(unsynced, len(results))
+			userRefs = append(userRefs, s.client.Collection("users").Doc(doc.Ref.ID))
 		}
-
 		results = append(results, MemberWithUser{
 			UID:    doc.Ref.ID,
 			Member: member,
 			User:   user,
 		})
 	}
+	if len(userRefs) == 0 {
+		return results, nil
+	}
+
+	// Member docs from before the user field sync: get their user info in
+	// one batched read; a member without a user doc keeps an empty MemberUser
+	userDocs, err := s.client.GetAll(ctx, userRefs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load member users: %w", err)
+	}
+	for i, userDoc := range userDocs {
+		results[unsynced[i]].User = memberUserFrom(userDoc)
+	}
 
 	return results, nil
 }
 
+// memberUserFrom reads the profile fields shown with a member from users/{uid}
+func memberUserFrom(userDoc *firestore.DocumentSnapshot) MemberUser {
+	var user MemberUser
+	if userDoc == nil || !userDoc.Exists() {
+		return user
+	}
+	userData := userDoc.Data()
+	user.DisplayName, _ = userData["displayName"].(string)
+	user.Email, _ = userData["email"].(string)
+	user.PhotoURL, _ = userData["photoURL"].(string)
+	user.EmergencyContact, _ = userData["emergencyContact"].(map[string]interface{})
+	user.DateOfBirth, _ = userData["dateOfBirth"].(string)
+	return user
+}
+
 // AddMember adds a new member to a dojo (with plan limit check)
 func (s *Service) AddMember(ctx context.Context, staffUID string, input AddMemberInput) (*MemberWithUser, error) {
 	input.Trim()
@@ -159,10 +199,8 @@ func (s *Service) AddMember(ctx context.Context, staffUID string, input AddMembe
 	}
 
 	// plan limit before adding member
-	if s.stripeSvc != nil {
-		if err := s.stripeSvc.CheckPlanLimit(ctx, input.DojoID, "member"); err != nil {
-			return nil, err
-		}
+	if err := s.limits.CheckPlanLimit(ctx, input.DojoID, "member"); err != nil {
+		return nil, err
 	}
 
 	// Check if member already exists
@@ -182,8 +220,8 @@ func (s *Service) AddMember(ctx context.Context, staffUID string, input AddMembe
 	}
 
 	// staff limit if staff-role
-	if isStaffRole(roleInDojo) && s.stripeSvc != nil {
-		if err := s.stripeSvc.CheckPlanLimit(ctx, input.DojoID, "staff"); err != nil {
+	if isStaffRole(roleInDojo) {
+		if err := s.limits.CheckPlanLimit(ctx, input.DojoID, "staff"); err != nil {
 			return nil, err
 		}
 	}
@@ -197,6 +235,7 @@ func (s *Service) AddMember(ctx context.Context, staffUID string, input AddMembe
 	}
 
 	memberData := map[string]interface{}{
+		"uid":        input.MemberUID,
 		"roleInDojo": roleInDojo,
 		"status":     status,
 		"joinedAt":   now,
@@ -227,11 +266,41 @@ func (s *Service) AddMember(ctx context.Context, staffUID string, input AddMembe
 		}
 	}
 
+	// copy the user's display fields (see usersync.go)
+	if userDoc, err := s.client.Collection("users").Doc(input.MemberUID).Get(ctx); err == nil {
+		for _, u := range userFieldUpdates(userDoc, now) {
+			if u.Value != firestore.Delete {
+				memberData[u.Path] = u.Value
+			}
+		}
+	}
+
 	_, err = s.membersCol(input.DojoID).Doc(input.MemberUID).Set(ctx, memberData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add member: %w", err)
 	}
 
+	// keep the member's dojo list in step; the membership index check repairs misses
+	if d, err := s.dojoRepo.GetDojo(ctx, input.DojoID); err == nil {
+		err = s.dojoRepo.PutMembershipIndex(ctx, input.MemberUID, dojo.MembershipIndex{
+			DojoID:   input.DojoID,
+			Role:     roleInDojo,
+			Status:   status,
+			JoinedAt: now,
+			DojoName: d.Name,
+			DojoSlug: d.Slug,
+		})
+		if err != nil {
+			log.Printf("members: failed to write membership index for %s/%s: %v", input.DojoID, input.MemberUID, err)
+		}
+	}
+
+	s.meter.Record(ctx, metering.EventMemberAdded, input.DojoID, staffUID, map[string]interface{}{
+		"memberUid":  input.MemberUID,
+		"roleInDojo": roleInDojo,
+	})
+	s.bus.Publish(ctx, events.MemberChanged{DojoID: input.DojoID, MemberUID: input.MemberUID, ChangedBy: staffUID, Change: events.MemberAdded})
+
 	return s.GetMember(ctx, input.DojoID, input.MemberUID)
 }
 
@@ -279,8 +348,8 @@ func (s *Service) UpdateMember(ctx context.Context, staffUID string, input Updat
 		}
 
 		// promoting to staff-role from non-staff-role => check staff plan limit
-		if isStaffRole(role) && !isStaffRole(existing.RoleInDojo) && s.stripeSvc != nil {
-			if err := s.stripeSvc.CheckPlanLimit(ctx, input.DojoID, "staff"); err != nil {
+		if isStaffRole(role) && !isStaffRole(existing.RoleInDojo) {
+			if err := s.limits.CheckPlanLimit(ctx, input.DojoID, "staff"); err != nil {
 				return nil, err
 			}
 		}
@@ -324,11 +393,13 @@ func (s *Service) UpdateMember(ctx context.Context, staffUID string, input Updat
 	if err != nil {
 		return nil, fmt.Errorf("failed to update member: %w", err)
 	}
+	s.bus.Publish(ctx, events.MemberChanged{DojoID: input.DojoID, MemberUID: input.MemberUID, ChangedBy: staffUID, Change: events.MemberUpdated})
 
 	return s.GetMember(ctx, input.DojoID, input.MemberUID)
 }
 
-// DeleteMember deletes a member from a dojo
+// DeleteMember deletes a member from a dojo along with their membership
+// index entry, join request and open bookings (see removal.go)
 func (s *Service) DeleteMember(ctx context.Context, staffUID string, dojoID string, memberUID string) error {
 	staffUID = strings.TrimSpace(staffUID)
 	dojoID = strings.TrimSpace(dojoID)
@@ -347,9 +418,9 @@ func (s *Service) DeleteMember(ctx context.Context, staffUID string, dojoID stri
 		return fmt.Errorf("%w: staff permission required", ErrUnauthorized)
 	}
 
-	_, err = s.membersCol(dojoID).Doc(memberUID).Delete(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to delete member: %w", err)
+	if err := s.removeMemberBatch(ctx, dojoID, memberUID); err != nil {
+		return err
 	}
+	s.bus.Publish(ctx, events.MemberChanged{DojoID: dojoID, MemberUID: memberUID, ChangedBy: staffUID, Change: events.MemberRemoved})
 	return nil
 }
@@ -0,0 +1,264 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/events"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const maxSuspensionReason = 1000
+
+// Suspension is a disciplinary suspension on a member doc. While it is in
+// effect the member cannot check in or book, and is left out of
+// leaderboards; they stay on the roster with their membership status,
+// unlike removal, and nothing is frozen or refunded. Dates are YYYY-MM-DD
+// and inclusive; no end date means until lifted.
+type Suspension struct {
+	StartDate   string    `firestore:"startDate" json:"startDate"`
+	EndDate     string    `firestore:"endDate,omitempty" json:"endDate,omitempty"`
+	Reason      string    `firestore:"reason" json:"reason,omitempty"` // staff only
+	SuspendedBy string    `firestore:"suspendedBy" json:"suspendedBy,omitempty"`
+	SuspendedAt time.Time `firestore:"suspendedAt" json:"suspendedAt"`
+}
+
+// ActiveOn reports whether the suspension is in effect on dateKey
+func (sp *Suspension) ActiveOn(dateKey string) bool {
+	return sp != nil && sp.StartDate <= dateKey && (sp.EndDate == "" || dateKey <= sp.EndDate)
+}
+
+// SuspendInput is the body of POST .../members/{memberUid}/suspension
+type SuspendInput struct {
+	StartDate string `json:"startDate,omitempty"` // defaults to today
+	EndDate   string `json:"endDate,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+func (in *SuspendInput) Trim() {
+	in.StartDate = strings.TrimSpace(in.StartDate)
+	in.EndDate = strings.TrimSpace(in.EndDate)
+	in.Reason = strings.TrimSpace(in.Reason)
+}
+
+// SuspensionRunResult summarizes a scheduler run
+type SuspensionRunResult struct {
+	Date         string `json:"date"` // YYYY-MM-DD
+	DojosChecked int    `json:"dojosChecked"`
+	Started      int    `json:"started"`
+	Lapsed       int    `json:"lapsed"`
+	Failed       int    `json:"failed"`
+	Partial      bool   `json:"partial"` // the deadline hit first; run again to finish
+}
+
+// Suspend suspends a member, replacing any current suspension. A suspension
+// starting today takes effect right away; later ones when RunSuspensions
+// reaches their start date.
+func (s *Service) Suspend(ctx context.Context, staffUID, dojoID, memberUID string, in SuspendInput) (*MemberWithUser, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	in.Trim()
+	if err := s.requireStaffForMember(ctx, staffUID, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+	if memberUID == staffUID {
+		return nil, fmt.Errorf("%w: you cannot suspend yourself", ErrBadRequest)
+	}
+	if isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, memberUID); err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	} else if isStaff {
+		return nil, fmt.Errorf("%w: staff cannot be suspended; change their role first", ErrBadRequest)
+	}
+
+	now := time.Now().UTC()
+	today := now.Format(instanceid.DateLayout)
+	if in.StartDate == "" {
+		in.StartDate = today
+	}
+	if _, err := time.Parse(instanceid.DateLayout, in.StartDate); err != nil {
+		return nil, fmt.Errorf("%w: startDate must be YYYY-MM-DD", ErrBadRequest)
+	}
+	if in.EndDate != "" {
+		if _, err := time.Parse(instanceid.DateLayout, in.EndDate); err != nil {
+			return nil, fmt.Errorf("%w: endDate must be YYYY-MM-DD", ErrBadRequest)
+		}
+		if in.EndDate < in.StartDate {
+			return nil, fmt.Errorf("%w: endDate must not be before startDate", ErrBadRequest)
+		}
+		if in.EndDate < today {
+			return nil, fmt.Errorf("%w: endDate is in the past", ErrBadRequest)
+		}
+	}
+	if in.Reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", ErrBadRequest)
+	}
+	if len(in.Reason) > maxSuspensionReason {
+		return nil, fmt.Errorf("%w: reason must be at most %d characters", ErrBadRequest, maxSuspensionReason)
+	}
+
+	sp := &Suspension{
+		StartDate:   in.StartDate,
+		EndDate:     in.EndDate,
+		Reason:      in.Reason,
+		SuspendedBy: staffUID,
+		SuspendedAt: now,
+	}
+	// Update replaces the whole suspension map, where a merge would keep the
+	// end date of an earlier one
+	_, err := s.membersCol(dojoID).Doc(memberUID).Update(ctx, []firestore.Update{
+		{Path: "suspension", Value: sp},
+		{Path: "suspended", Value: sp.ActiveOn(today)},
+		{Path: "updatedAt", Value: now},
+		{Path: "updatedBy", Value: staffUID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to suspend member: %w", err)
+	}
+	s.bus.Publish(ctx, events.MemberChanged{DojoID: dojoID, MemberUID: memberUID, ChangedBy: staffUID, Change: events.MemberUpdated})
+
+	return s.GetMember(ctx, dojoID, memberUID)
+}
+
+// LiftSuspension ends a member's suspension early, or withdraws one that
+// has not started
+func (s *Service) LiftSuspension(ctx context.Context, staffUID, dojoID, memberUID string) (*MemberWithUser, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if err := s.requireStaffForMember(ctx, staffUID, dojoID, memberUID); err != nil {
+		return nil, err
+	}
+	if err := s.clearSuspension(ctx, dojoID, memberUID, staffUID); err != nil {
+		return nil, err
+	}
+	return s.GetMember(ctx, dojoID, memberUID)
+}
+
+func (s *Service) clearSuspension(ctx context.Context, dojoID, memberUID, changedBy string) error {
+	_, err := s.membersCol(dojoID).Doc(memberUID).Update(ctx, []firestore.Update{
+		{Path: "suspension", Value: firestore.Delete},
+		{Path: "suspended", Value: firestore.Delete},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+		{Path: "updatedBy", Value: changedBy},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to lift suspension: %w", err)
+	}
+	s.bus.Publish(ctx, events.MemberChanged{DojoID: dojoID, MemberUID: memberUID, ChangedBy: changedBy, Change: events.MemberUpdated})
+	return nil
+}
+
+// RunSuspensions starts the suspensions whose start date has come and ends
+// the ones whose end date has passed, telling the dojo's staff about each
+// lapsed one. Meant to be triggered daily by Cloud Scheduler.
+func (s *Service) RunSuspensions(ctx context.Context, now time.Time) (*SuspensionRunResult, error) {
+	now = now.UTC()
+	res := &SuspensionRunResult{Date: now.Format(instanceid.DateLayout)}
+
+	iter := s.client.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+
+		if err := s.runDojoSuspensions(ctx, doc.Ref.ID, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			res.Failed++
+			log.Printf("suspensions: dojo %s: %v", doc.Ref.ID, err)
+		}
+	}
+
+	log.Printf("suspensions: %d dojos checked, %d started, %d lapsed, %d failed (partial=%v)",
+		res.DojosChecked, res.Started, res.Lapsed, res.Failed, res.Partial)
+	return res, nil
+}
+
+func (s *Service) runDojoSuspensions(ctx context.Context, dojoID string, res *SuspensionRunResult) error {
+	docs, err := s.membersCol(dojoID).Where("suspension.startDate", "<=", res.Date).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list suspensions: %w", err)
+	}
+	for _, doc := range docs {
+		var m Member
+		if err := doc.DataTo(&m); err != nil || m.Suspension == nil {
+			continue
+		}
+		uid := doc.Ref.ID
+		switch {
+		case m.Suspension.EndDate != "" && m.Suspension.EndDate < res.Date:
+			if err := s.clearSuspension(ctx, dojoID, uid, "system"); err != nil {
+				return err
+			}
+			res.Lapsed++
+			s.notifyStaffOfLapse(ctx, dojoID, uid, syncedName(doc), m.Suspension)
+		case !m.Suspended:
+			if _, err := doc.Ref.Update(ctx, []firestore.Update{
+				{Path: "suspended", Value: true},
+				{Path: "updatedAt", Value: time.Now().UTC()},
+			}); err != nil {
+				return fmt.Errorf("failed to start suspension: %w", err)
+			}
+			res.Started++
+			s.bus.Publish(ctx, events.MemberChanged{DojoID: dojoID, MemberUID: uid, ChangedBy: "system", Change: events.MemberUpdated})
+		}
+	}
+	return nil
+}
+
+// syncedName is the display name copied onto the member doc, "A member"
+// when there is none
+func syncedName(doc *firestore.DocumentSnapshot) string {
+	if user, ok := syncedUser(doc); ok && user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return "A member"
+}
+
+// notifyStaffOfLapse tells the dojo's staff a suspension ended (best effort)
+func (s *Service) notifyStaffOfLapse(ctx context.Context, dojoID, memberUID, name string, sp *Suspension) {
+	staff, err := s.dojoRepo.ListStaffUIDs(ctx, dojoID)
+	if err != nil {
+		log.Printf("suspensions: failed to list staff of %s: %v", dojoID, err)
+		return
+	}
+	body := fmt.Sprintf("%s's suspension ended on %s; they can check in and book again.", name, sp.EndDate)
+	for _, uid := range staff {
+		_, _, err := s.client.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+			"title": "Suspension lapsed",
+			"body":  body,
+			"type":  "suspension_lapsed",
+			"data": map[string]interface{}{
+				"memberUid": memberUID,
+				"endDate":   sp.EndDate,
+			},
+			"read":      false,
+			"dojoId":    dojoID,
+			"createdAt": time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("suspensions: failed to notify %s: %v", uid, err)
+		}
+	}
+}
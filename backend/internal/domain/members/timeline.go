@@ -0,0 +1,283 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+)
+
+// Timeline item types
+const (
+	TimelinePromotion   = "promotion"
+	TimelineMilestone   = "attendance_milestone"
+	TimelineCompetition = "competition"
+	TimelineNote        = "note"
+	TimelineGoal        = "goal"
+)
+
+var ValidTimelineTypes = []string{TimelinePromotion, TimelineMilestone, TimelineCompetition, TimelineNote, TimelineGoal}
+
+// attendanceMilestones are the check-in counts that show up on the timeline
+var attendanceMilestones = []int{1, 10, 25, 50, 100, 200, 300, 500, 750, 1000}
+
+// TimelineItem is one entry of a member's progress timeline
+type TimelineItem struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	At     time.Time              `json:"at"`
+	Title  string                 `json:"title"`
+	Detail string                 `json:"detail,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// TimelineInput filters and pages the timeline
+type TimelineInput struct {
+	Types  []string   // empty = all visible types
+	Before *time.Time // cursor: items strictly older than this
+	Limit  int
+}
+
+// Timeline is one page of the feed, newest first
+type Timeline struct {
+	Items      []TimelineItem `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"` // RFC3339Nano, pass back as ?before=
+}
+
+// timelineSourceLimit bounds how much history each source contributes
+const timelineSourceLimit = 500
+
+// SetAttendanceService sets the attendance service used for attendance milestones
+func (s *Service) SetAttendanceService(attendanceSvc *attendance.Service) {
+	s.attendanceSvc = attendanceSvc
+}
+
+// GetTimeline merges rank history, attendance milestones, competition results,
+// goals and (for staff) notes into one chronological feed. Visible to staff and the member.
+func (s *Service) GetTimeline(ctx context.Context, viewerUID, dojoID, memberUID string, in TimelineInput) (*Timeline, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+
+	viewer := s.ViewerFor(ctx, dojoID, viewerUID)
+	if !viewer.CanSeePrivate(memberUID) {
+		return nil, fmt.Errorf("%w: only staff or the member can view the timeline", ErrUnauthorized)
+	}
+	if _, err := s.membersCol(dojoID).Doc(memberUID).Get(ctx); err != nil {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+
+	want := map[string]bool{}
+	for _, t := range in.Types {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !isValidTimelineType(t) {
+			return nil, fmt.Errorf("%w: type must be one of: %s", ErrBadRequest, strings.Join(ValidTimelineTypes, ", "))
+		}
+		want[t] = true
+	}
+	include := func(t string) bool { return len(want) == 0 || want[t] }
+
+	limit := in.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 30
+	}
+
+	items := []TimelineItem{}
+	if include(TimelinePromotion) {
+		promos, err := s.promotionItems(ctx, dojoID, memberUID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, promos...)
+	}
+	if include(TimelineMilestone) && s.attendanceSvc != nil {
+		milestones, err := s.milestoneItems(ctx, dojoID, memberUID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, milestones...)
+	}
+	if include(TimelineCompetition) {
+		results, err := s.ListCompetitionResults(ctx, dojoID, memberUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range results {
+			items = append(items, TimelineItem{
+				ID:     "competition_" + c.ID,
+				Type:   TimelineCompetition,
+				At:     c.Date,
+				Title:  c.Event,
+				Detail: strings.TrimSpace(c.Result + " " + c.Division),
+				Data: map[string]interface{}{
+					"result":   c.Result,
+					"division": c.Division,
+					"notes":    c.Notes,
+				},
+			})
+		}
+	}
+	if include(TimelineGoal) {
+		goals, err := s.goalItems(ctx, dojoID, memberUID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, goals...)
+	}
+	// coach notes are never shown to the member themselves
+	if include(TimelineNote) && viewer.IsStaff {
+		notes, err := s.noteItems(ctx, dojoID, memberUID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, notes...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].At.After(items[j].At) })
+
+	out := &Timeline{Items: []TimelineItem{}}
+	for _, it := range items {
+		if in.Before != nil && !it.At.Before(*in.Before) {
+			continue
+		}
+		if len(out.Items) == limit {
+			out.NextCursor = out.Items[len(out.Items)-1].At.Format(time.RFC3339Nano)
+			break
+		}
+		out.Items = append(out.Items, it)
+	}
+	return out, nil
+}
+
+func (s *Service) promotionItems(ctx context.Context, dojoID, memberUID string) ([]TimelineItem, error) {
+	iter := s.membersCol(dojoID).Doc(memberUID).Collection("rankHistory").
+		OrderBy("createdAt", firestore.Desc).
+		Limit(timelineSourceLimit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	out := []TimelineItem{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rank history: %w", err)
+		}
+
+		data := doc.Data()
+		createdAt, _ := data["createdAt"].(time.Time)
+		newBelt, _ := data["newBelt"].(string)
+		prevBelt, _ := data["previousBelt"].(string)
+		notes, _ := data["notes"].(string)
+		newStripes, _ := data["newStripes"].(int64)
+
+		historyType, _ := data["type"].(string)
+
+		title := fmt.Sprintf("Promoted to %s belt", newBelt)
+		switch {
+		case historyType == "verified_transfer":
+			title = fmt.Sprintf("%s belt verified (transfer)", newBelt)
+		case historyType == "correction":
+			title = fmt.Sprintf("Rank corrected to %s belt, stripe %d", newBelt, newStripes)
+		case historyType == "demotion":
+			title = fmt.Sprintf("Demoted to %s belt, stripe %d", newBelt, newStripes)
+		case newBelt == prevBelt:
+			title = fmt.Sprintf("%s belt, stripe %d", newBelt, newStripes)
+		}
+		out = append(out, TimelineItem{
+			ID:     "promotion_" + doc.Ref.ID,
+			Type:   TimelinePromotion,
+			At:     createdAt,
+			Title:  title,
+			Detail: notes,
+			Data: map[string]interface{}{
+				"previousBelt":    prevBelt,
+				"previousStripes": data["previousStripes"],
+				"newBelt":         newBelt,
+				"newStripes":      newStripes,
+				"promotedBy":      data["promotedBy"],
+				"type":            historyType,
+				"reasonCode":      data["reasonCode"],
+				"correctedBy":     data["correctedBy"],
+				"ceremonyId":      data["ceremonyId"],
+				"photos":          data["photos"],
+			},
+		})
+	}
+	return out, nil
+}
+
+func (s *Service) milestoneItems(ctx context.Context, dojoID, memberUID string) ([]TimelineItem, error) {
+	checkins, err := s.attendanceSvc.MemberCheckins(ctx, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []TimelineItem{}
+	for _, n := range attendanceMilestones {
+		if n > len(checkins) {
+			break
+		}
+		att := checkins[n-1]
+		title := fmt.Sprintf("%d classes attended", n)
+		if n == 1 {
+			title = "First class"
+		}
+		out = append(out, TimelineItem{
+			ID:    fmt.Sprintf("milestone_%d", n),
+			Type:  TimelineMilestone,
+			At:    att.CreatedAt,
+			Title: title,
+			Data: map[string]interface{}{
+				"count":             n,
+				"sessionInstanceId": att.SessionInstanceID,
+			},
+		})
+	}
+	return out, nil
+}
+
+func (s *Service) noteItems(ctx context.Context, dojoID, memberUID string) ([]TimelineItem, error) {
+	notes, err := s.listNotes(ctx, dojoID, memberUID, timelineSourceLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TimelineItem, 0, len(notes))
+	for _, n := range notes {
+		out = append(out, TimelineItem{
+			ID:     "note_" + n.ID,
+			Type:   TimelineNote,
+			At:     n.CreatedAt,
+			Title:  "Coach note",
+			Detail: n.Text,
+			Data: map[string]interface{}{
+				"authorUid": n.AuthorUID,
+				"category":  n.Category,
+			},
+		})
+	}
+	return out, nil
+}
+
+func isValidTimelineType(t string) bool {
+	for _, v := range ValidTimelineTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
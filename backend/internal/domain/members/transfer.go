@@ -0,0 +1,63 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/events"
+)
+
+// MarkTransferred retires a member who has moved to another dojo: the member
+// doc stays, inactive, with where they went, so the dojo's history and
+// attendance still resolve the name. Called by the transfers domain once the
+// destination has accepted.
+func (s *Service) MarkTransferred(ctx context.Context, dojoID, memberUID, toDojoID, toDojoName, changedBy string) error {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || memberUID == "" || toDojoID == "" {
+		return fmt.Errorf("%w: dojoId, memberUid and toDojoId are required", ErrBadRequest)
+	}
+
+	ref := s.membersCol(dojoID).Doc(memberUID)
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return fmt.Errorf("failed to get member: %w", err)
+	}
+	if !doc.Exists() {
+		return fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	role, _ := doc.Data()["roleInDojo"].(string)
+
+	now := time.Now().UTC()
+	_, err = ref.Set(ctx, map[string]interface{}{
+		"status":            StatusInactive,
+		"transferredTo":     toDojoID,
+		"transferredToName": toDojoName,
+		"transferredAt":     now,
+		"updatedAt":         now,
+	}, firestore.MergeAll)
+	if err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
+	}
+
+	if d, err := s.dojoRepo.GetDojo(ctx, dojoID); err == nil {
+		err = s.dojoRepo.PutMembershipIndex(ctx, memberUID, dojo.MembershipIndex{
+			DojoID:   dojoID,
+			Role:     role,
+			Status:   StatusInactive,
+			DojoName: d.Name,
+			DojoSlug: d.Slug,
+		})
+		if err != nil {
+			log.Printf("members: failed to write membership index for %s/%s: %v", dojoID, memberUID, err)
+		}
+	}
+	s.bus.Publish(ctx, events.MemberChanged{DojoID: dojoID, MemberUID: memberUID, ChangedBy: changedBy, Change: events.MemberUpdated})
+	return nil
+}
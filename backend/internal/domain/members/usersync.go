@@ -0,0 +1,267 @@
+package members
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Member docs carry copies of the user's displayName, email, photoURL,
+// emergencyContact and dateOfBirth, so member lists need no users/{uid}
+// reads. The copies are refreshed whenever the profile changes;
+// userSyncedAt marks a member doc that has them and userSyncVersion which
+// fields were copied. birthMonth and birthDay split the date of birth for
+// birthday queries. Member docs are only readable by dojo staff and the
+// member, the same audience SerializeMember shows these fields to.
+
+const (
+	userSyncTimeout = 30 * time.Second
+	backfillBatch   = 300 // user docs read per GetAll during a backfill
+
+	// userSyncVersion is bumped when userFieldUpdates copies a new field,
+	// so a backfill revisits docs synced before it (2: dateOfBirth)
+	userSyncVersion = 2
+)
+
+// userFieldUpdates are the member doc updates copying users/{uid}
+func userFieldUpdates(userDoc *firestore.DocumentSnapshot, now time.Time) []firestore.Update {
+	u := memberUserFrom(userDoc)
+	var contact interface{} = firestore.Delete
+	if u.EmergencyContact != nil {
+		contact = u.EmergencyContact
+	}
+	var dob, month, day interface{} = firestore.Delete, firestore.Delete, firestore.Delete
+	if born, err := time.Parse("2006-01-02", u.DateOfBirth); err == nil {
+		dob, month, day = u.DateOfBirth, int(born.Month()), born.Day()
+	}
+	return []firestore.Update{
+		{Path: "displayName", Value: u.DisplayName},
+		{Path: "email", Value: u.Email},
+		{Path: "photoURL", Value: u.PhotoURL},
+		{Path: "emergencyContact", Value: contact},
+		{Path: "dateOfBirth", Value: dob},
+		{Path: "birthMonth", Value: month},
+		{Path: "birthDay", Value: day},
+		{Path: "userSyncedAt", Value: now},
+		{Path: "userSyncVersion", Value: userSyncVersion},
+	}
+}
+
+// syncedUser returns the copied user fields of a member doc, ok false when
+// the doc predates the sync
+func syncedUser(memberDoc *firestore.DocumentSnapshot) (MemberUser, bool) {
+	data := memberDoc.Data()
+	if _, ok := data["userSyncedAt"].(time.Time); !ok {
+		return MemberUser{}, false
+	}
+	var u MemberUser
+	u.DisplayName, _ = data["displayName"].(string)
+	u.Email, _ = data["email"].(string)
+	u.PhotoURL, _ = data["photoURL"].(string)
+	u.EmergencyContact, _ = data["emergencyContact"].(map[string]interface{})
+	u.DateOfBirth, _ = data["dateOfBirth"].(string)
+	return u, true
+}
+
+// needsUserSync reports whether a backfill should copy the user fields
+// onto the member doc
+func needsUserSync(memberDoc *firestore.DocumentSnapshot) bool {
+	if _, ok := syncedUser(memberDoc); !ok {
+		return true
+	}
+	version, _ := memberDoc.Data()["userSyncVersion"].(int64)
+	return version < userSyncVersion
+}
+
+// memberRefsOf finds the user's member docs through the uid field and,
+// for docs written without one, the users/{uid}/dojoMemberships index
+func (s *Service) memberRefsOf(ctx context.Context, uid string) ([]*firestore.DocumentRef, error) {
+	seen := map[string]bool{}
+	var refs []*firestore.DocumentRef
+	add := func(ref *firestore.DocumentRef) {
+		if !seen[ref.Path] {
+			seen[ref.Path] = true
+			refs = append(refs, ref)
+		}
+	}
+
+	iter := s.client.CollectionGroup("members").Where("uid", "==", uid).Select().Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find member docs of %s: %w", uid, err)
+		}
+		// other collections are called members too (families); keep dojo members
+		if dojoRef := doc.Ref.Parent.Parent; dojoRef != nil && dojoRef.Parent.ID == "dojos" {
+			add(doc.Ref)
+		}
+	}
+
+	indexDocs, err := s.client.Collection("users").Doc(uid).Collection("dojoMemberships").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dojo memberships of %s: %w", uid, err)
+	}
+	var indexed []*firestore.DocumentRef
+	for _, doc := range indexDocs {
+		if ref := s.membersCol(doc.Ref.ID).Doc(uid); !seen[ref.Path] {
+			indexed = append(indexed, ref)
+		}
+	}
+	if len(indexed) > 0 {
+		// stale index entries may point at member docs that are gone
+		docs, err := s.client.GetAll(ctx, indexed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read member docs of %s: %w", uid, err)
+		}
+		for _, doc := range docs {
+			if doc.Exists() {
+				add(doc.Ref)
+			}
+		}
+	}
+	return refs, nil
+}
+
+// SyncUserFields copies the user's display fields onto each of their member
+// docs and returns how many were updated
+func (s *Service) SyncUserFields(ctx context.Context, uid string) (int, error) {
+	if uid == "" {
+		return 0, fmt.Errorf("%w: uid is required", ErrBadRequest)
+	}
+	userDoc, err := s.client.Collection("users").Doc(uid).Get(ctx)
+	if err != nil && userDoc == nil {
+		return 0, fmt.Errorf("failed to read user %s: %w", uid, err)
+	}
+	if !userDoc.Exists() {
+		return 0, nil
+	}
+	refs, err := s.memberRefsOf(ctx, uid)
+	if err != nil {
+		return 0, err
+	}
+	if len(refs) == 0 {
+		return 0, nil
+	}
+
+	updates := userFieldUpdates(userDoc, time.Now().UTC())
+	batch := s.client.Batch()
+	for _, ref := range refs {
+		batch.Update(ref, updates)
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to sync member docs of %s: %w", uid, err)
+	}
+	return len(refs), nil
+}
+
+// SyncUserFieldsInBackground runs SyncUserFields after the request that
+// changed the profile has returned; failures are logged and repaired by
+// the next profile change or a backfill
+func (s *Service) SyncUserFieldsInBackground(uid string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), userSyncTimeout)
+		defer cancel()
+		if _, err := s.SyncUserFields(ctx, uid); err != nil {
+			log.Printf("members: %v", err)
+		}
+	}()
+}
+
+// UserFieldsBackfill reports a backfill run
+type UserFieldsBackfill struct {
+	DojosChecked int  `json:"dojosChecked"`
+	Updated      int  `json:"updated"`
+	Partial      bool `json:"partial"` // the deadline hit first; run again to finish
+}
+
+// BackfillUserFields copies user fields onto member docs that do not have
+// them yet or were synced by an older version, for one dojo or, with dojoID empty, every dojo (admin)
+func (s *Service) BackfillUserFields(ctx context.Context, dojoID string) (*UserFieldsBackfill, error) {
+	res := &UserFieldsBackfill{}
+	if dojoID != "" {
+		if err := s.backfillDojo(ctx, dojoID, res); err != nil {
+			return nil, err
+		}
+		res.DojosChecked++
+		return res, nil
+	}
+
+	iter := s.client.Collection("dojos").Select().Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err == nil {
+			err = s.backfillDojo(ctx, doc.Ref.ID, res)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, err
+		}
+		res.DojosChecked++
+	}
+	log.Printf("members: user field backfill updated %d member docs in %d dojos (partial=%v)", res.Updated, res.DojosChecked, res.Partial)
+	return res, nil
+}
+
+func (s *Service) backfillDojo(ctx context.Context, dojoID string, res *UserFieldsBackfill) error {
+	memberDocs, err := s.membersCol(dojoID).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list members of dojo %s: %w", dojoID, err)
+	}
+	var pending []*firestore.DocumentRef
+	for _, doc := range memberDocs {
+		if needsUserSync(doc) {
+			pending = append(pending, doc.Ref)
+		}
+	}
+
+	now := time.Now().UTC()
+	for start := 0; start < len(pending); start += backfillBatch {
+		chunk := pending[start:min(start+backfillBatch, len(pending))]
+		userRefs := make([]*firestore.DocumentRef, len(chunk))
+		for i, ref := range chunk {
+			userRefs[i] = s.client.Collection("users").Doc(ref.ID)
+		}
+		userDocs, err := s.client.GetAll(ctx, userRefs)
+		if err != nil {
+			return fmt.Errorf("failed to read users of dojo %s: %w", dojoID, err)
+		}
+
+		bw := s.client.BulkWriter(ctx)
+		var jobs []*firestore.BulkWriterJob
+		for i, userDoc := range userDocs {
+			if !userDoc.Exists() {
+				continue
+			}
+			job, err := bw.Update(chunk[i], userFieldUpdates(userDoc, now))
+			if err != nil {
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+		bw.End()
+		for _, job := range jobs {
+			if _, err := job.Results(); err == nil {
+				res.Updated++
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package memberships
+
+import "errors"
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+func IsErrUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
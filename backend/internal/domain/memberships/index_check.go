@@ -0,0 +1,259 @@
+package memberships
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+// The users/{uid}/dojoMemberships index is written next to the member doc,
+// but not by every code path (older domain writes skipped it), and role or
+// status changes never touched it. CheckIndexes treats dojos/{id}/members as
+// the source of truth and brings the index in line with it.
+
+// Index issue kinds
+const (
+	IndexMissing = "missing" // member doc with no index entry
+	IndexStale   = "stale"   // index entry differs from the member or dojo doc
+	IndexOrphan  = "orphan"  // index entry with no member doc
+)
+
+// IndexIssue is one difference found by CheckIndexes
+type IndexIssue struct {
+	Kind   string   `firestore:"kind" json:"kind"`
+	UID    string   `firestore:"uid" json:"uid"`
+	DojoID string   `firestore:"dojoId" json:"dojoId"`
+	Fields []string `firestore:"fields,omitempty" json:"fields,omitempty"` // for stale
+	Fixed  bool     `firestore:"fixed" json:"fixed"`
+}
+
+// IndexCheckResult is the report of one run, also kept at membershipIndexChecks/{id}
+type IndexCheckResult struct {
+	ID             string       `firestore:"-" json:"id,omitempty"`
+	DryRun         bool         `firestore:"dryRun" json:"dryRun"`
+	DojosChecked   int          `firestore:"dojosChecked" json:"dojosChecked"`
+	MembersChecked int          `firestore:"membersChecked" json:"membersChecked"`
+	IndexesChecked int          `firestore:"indexesChecked" json:"indexesChecked"`
+	Fixed          int          `firestore:"fixed" json:"fixed"`
+	Issues         []IndexIssue `firestore:"issues" json:"issues"`
+	// Partial is set when the deadline hit before every dojo was checked;
+	// the next run picks up the rest
+	Partial    bool      `firestore:"partial" json:"partial"`
+	StartedAt  time.Time `firestore:"startedAt" json:"startedAt"`
+	FinishedAt time.Time `firestore:"finishedAt" json:"finishedAt"`
+}
+
+// CheckIndexes cross-checks every dojo's members with the members' index
+// entries, creating missing entries, refreshing stale ones and deleting
+// orphans. With dryRun it only reports (admin).
+func (s *Service) CheckIndexes(ctx context.Context, dryRun bool) (*IndexCheckResult, error) {
+	res := &IndexCheckResult{DryRun: dryRun, Issues: []IndexIssue{}, StartedAt: time.Now().UTC()}
+	members := map[string]bool{} // "uid/dojoId" of every member doc seen
+
+	iter := s.fs.Collection("dojos").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if err := s.checkDojo(ctx, res, doc, members); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, err
+		}
+		res.DojosChecked++
+	}
+
+	// orphans can only be told apart once every dojo has been seen
+	if !res.Partial {
+		if err := s.checkOrphans(ctx, res, members); err != nil {
+			if ctx.Err() == nil {
+				return nil, err
+			}
+			res.Partial = true
+		}
+	}
+
+	// the deadline may have passed; save the report regardless
+	saveCtx := context.WithoutCancel(ctx)
+	res.FinishedAt = time.Now().UTC()
+	ref := s.fs.Collection("membershipIndexChecks").NewDoc()
+	if _, err := ref.Set(saveCtx, res); err != nil {
+		log.Printf("membership index check: failed to save report: %v", err)
+	} else {
+		res.ID = ref.ID
+	}
+	log.Printf("membership index check: %d dojos, %d members, %d index entries; %d issues, %d fixed (dryRun=%v, partial=%v)",
+		res.DojosChecked, res.MembersChecked, res.IndexesChecked, len(res.Issues), res.Fixed, dryRun, res.Partial)
+	return res, nil
+}
+
+func (s *Service) checkDojo(ctx context.Context, res *IndexCheckResult, dojoDoc *firestore.DocumentSnapshot, members map[string]bool) error {
+	dojoID := dojoDoc.Ref.ID
+	dojoData := dojoDoc.Data()
+	dojoName, _ := dojoData["name"].(string)
+	dojoSlug, _ := dojoData["slug"].(string)
+
+	memberDocs, err := dojoDoc.Ref.Collection("members").Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list members of dojo %s: %w", dojoID, err)
+	}
+	if len(memberDocs) == 0 {
+		return nil
+	}
+
+	refs := make([]*firestore.DocumentRef, len(memberDocs))
+	for i, m := range memberDocs {
+		refs[i] = s.dojoRepo.MembershipIndexRef(m.Ref.ID, dojoID)
+	}
+	indexDocs, err := s.fs.GetAll(ctx, refs)
+	if err != nil {
+		return fmt.Errorf("failed to read membership indexes of dojo %s: %w", dojoID, err)
+	}
+
+	for i, m := range memberDocs {
+		uid := m.Ref.ID
+		members[uid+"/"+dojoID] = true
+		res.MembersChecked++
+
+		data := m.Data()
+		want := dojo.MembershipIndex{
+			DojoID:   dojoID,
+			Role:     memberRole(data, nil),
+			Status:   memberStatus(data, nil),
+			DojoName: dojoName,
+			DojoSlug: dojoSlug,
+		}
+		want.JoinedAt, _ = data["joinedAt"].(time.Time)
+
+		var issue IndexIssue
+		if !indexDocs[i].Exists() {
+			issue = IndexIssue{Kind: IndexMissing, UID: uid, DojoID: dojoID}
+		} else {
+			have := indexDocs[i].Data()
+			var fields []string
+			for _, f := range [][2]string{
+				{"dojoId", want.DojoID},
+				{"role", want.Role},
+				{"status", want.Status},
+				{"dojoName", want.DojoName},
+				{"dojoSlug", want.DojoSlug},
+			} {
+				if stringField(have, f[0]) != f[1] {
+					fields = append(fields, f[0])
+				}
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			// keep the original join date even if the member doc lacks one
+			if _, ok := have["joinedAt"].(time.Time); ok {
+				want.JoinedAt = time.Time{}
+			}
+			issue = IndexIssue{Kind: IndexStale, UID: uid, DojoID: dojoID, Fields: fields}
+		}
+
+		if !res.DryRun {
+			if err := s.dojoRepo.PutMembershipIndex(ctx, uid, want); err != nil {
+				log.Printf("membership index check: failed to repair %s/%s: %v", uid, dojoID, err)
+			} else {
+				issue.Fixed = true
+				res.Fixed++
+			}
+		}
+		res.Issues = append(res.Issues, issue)
+	}
+	return nil
+}
+
+// checkOrphans deletes index entries whose member doc no longer exists. The
+// member doc is read again first, in case the member joined during the run.
+func (s *Service) checkOrphans(ctx context.Context, res *IndexCheckResult, members map[string]bool) error {
+	iter := s.fs.CollectionGroup("dojoMemberships").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list membership indexes: %w", err)
+		}
+		res.IndexesChecked++
+
+		userRef := doc.Ref.Parent.Parent
+		if userRef == nil || userRef.Parent.ID != "users" {
+			continue
+		}
+		uid, dojoID := userRef.ID, doc.Ref.ID
+		if members[uid+"/"+dojoID] {
+			continue
+		}
+		memberDoc, err := s.fs.Collection("dojos").Doc(dojoID).Collection("members").Doc(uid).Get(ctx)
+		if err != nil && memberDoc == nil {
+			return fmt.Errorf("failed to get member %s/%s: %w", dojoID, uid, err)
+		}
+		if memberDoc.Exists() {
+			continue
+		}
+
+		issue := IndexIssue{Kind: IndexOrphan, UID: uid, DojoID: dojoID}
+		if !res.DryRun {
+			if _, err := doc.Ref.Delete(ctx); err != nil {
+				log.Printf("membership index check: failed to delete orphan %s/%s: %v", uid, dojoID, err)
+			} else {
+				issue.Fixed = true
+				res.Fixed++
+			}
+		}
+		res.Issues = append(res.Issues, issue)
+	}
+}
+
+// memberRole reads the member's role; the members domain writes roleInDojo,
+// older code role. fallback (the index entry) is used when neither is set.
+func memberRole(member, fallback map[string]interface{}) string {
+	if r := stringField(member, "role"); r != "" {
+		return r
+	}
+	if r := stringField(member, "roleInDojo"); r != "" {
+		return r
+	}
+	if r := stringField(fallback, "role"); r != "" {
+		return r
+	}
+	return "student"
+}
+
+// memberStatus reads the member's status; docs written before statuses
+// existed count as active
+func memberStatus(member, fallback map[string]interface{}) string {
+	if st := stringField(member, "status"); st != "" {
+		return st
+	}
+	if st := stringField(fallback, "status"); st != "" {
+		return st
+	}
+	return "active"
+}
+
+func stringField(data map[string]interface{}, key string) string {
+	v, _ := data[key].(string)
+	return v
+}
@@ -0,0 +1,35 @@
+package memberships
+
+import "time"
+
+// MyDojo is one of the caller's dojos, from the users/{uid}/dojoMemberships
+// index enriched with the live member doc, timetable and attendance
+type MyDojo struct {
+	DojoID     string             `json:"dojoId"`
+	DojoName   string             `json:"dojoName"`
+	DojoSlug   string             `json:"dojoSlug,omitempty"`
+	Role       string             `json:"role"`
+	Status     string             `json:"status"`
+	JoinedAt   *time.Time         `json:"joinedAt,omitempty"`
+	NextClass  *NextClass         `json:"nextClass,omitempty"`  // active members only
+	Attendance *AttendanceSummary `json:"attendance,omitempty"` // active members only
+}
+
+// NextClass is the next scheduled occurrence of a class in the timetable
+type NextClass struct {
+	SessionID  string    `json:"sessionId"`
+	InstanceID string    `json:"instanceId"` // "YYYY-MM-DD__sessionId"
+	Title      string    `json:"title"`
+	Date       string    `json:"date"`
+	StartTime  string    `json:"startTime"`
+	EndTime    string    `json:"endTime"`
+	Instructor string    `json:"instructor,omitempty"`
+	StartsAt   time.Time `json:"startsAt"`
+}
+
+// AttendanceSummary is the caller's own check-in history at a dojo
+type AttendanceSummary struct {
+	Total         int        `json:"total"`
+	Last30Days    int        `json:"last30Days"`
+	LastCheckinAt *time.Time `json:"lastCheckinAt,omitempty"`
+}
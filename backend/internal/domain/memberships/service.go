@@ -0,0 +1,163 @@
+package memberships
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// maxMemberships caps the index read; nobody trains at 100 dojos
+const maxMemberships = 100
+
+// nextClassHorizonDays is how far ahead ListMine looks for the next class
+const nextClassHorizonDays = 7
+
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	sessionSvc    *session.Service
+	attendanceSvc *attendance.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, sessionSvc *session.Service, attendanceSvc *attendance.Service) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, sessionSvc: sessionSvc, attendanceSvc: attendanceSvc}
+}
+
+// ListMine returns the caller's dojos, most recently updated first. Role and
+// status come from the dojo's member doc (the index can lag behind it);
+// entries whose member doc is gone are left out.
+func (s *Service) ListMine(ctx context.Context, uid string) ([]MyDojo, error) {
+	if strings.TrimSpace(uid) == "" {
+		return nil, ErrUnauthorized
+	}
+
+	docs, err := s.fs.Collection("users").Doc(uid).Collection("dojoMemberships").
+		OrderBy("updatedAt", firestore.Desc).
+		Limit(maxMemberships).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	now := time.Now().UTC()
+	out := make([]MyDojo, 0, len(docs))
+	for _, doc := range docs {
+		data := doc.Data()
+		dojoID, _ := data["dojoId"].(string)
+		if dojoID == "" {
+			dojoID = doc.Ref.ID
+		}
+		md := MyDojo{DojoID: dojoID}
+		md.DojoName, _ = data["dojoName"].(string)
+		md.DojoSlug, _ = data["dojoSlug"].(string)
+		if t, ok := data["joinedAt"].(time.Time); ok {
+			md.JoinedAt = &t
+		}
+
+		memberDoc, err := s.fs.Collection("dojos").Doc(dojoID).Collection("members").Doc(uid).Get(ctx)
+		if err != nil && memberDoc == nil {
+			return nil, fmt.Errorf("failed to get membership for dojo %s: %w", dojoID, err)
+		}
+		if !memberDoc.Exists() {
+			continue
+		}
+		member := memberDoc.Data()
+		md.Role = memberRole(member, data)
+		md.Status = memberStatus(member, data)
+
+		if md.Status == "active" || md.Status == "approved" {
+			if md.NextClass, err = s.nextClass(ctx, dojoID, now); err != nil {
+				return nil, err
+			}
+			if md.Attendance, err = s.attendanceSummary(ctx, dojoID, uid, now); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, md)
+	}
+	return out, nil
+}
+
+// nextClass finds the earliest active class starting after now within the
+// next week. Times are compared in UTC, like the timetable itself.
+func (s *Service) nextClass(ctx context.Context, dojoID string, now time.Time) (*NextClass, error) {
+	if s.sessionSvc == nil {
+		return nil, nil
+	}
+	sessions, err := s.sessionSvc.List(ctx, dojoID, session.ListSessionsInput{ActiveOnly: true, Limit: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions for dojo %s: %w", dojoID, err)
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var best *NextClass
+	for _, sess := range sessions {
+		start, err := time.Parse("15:04", sess.StartTime)
+		if err != nil {
+			continue
+		}
+		for offset := 0; offset <= nextClassHorizonDays; offset++ {
+			day := today.AddDate(0, 0, offset)
+			if int(day.Weekday()) != sess.DayOfWeek {
+				continue
+			}
+			if !sess.RecurrenceEnd.IsZero() && day.After(sess.RecurrenceEnd) {
+				break
+			}
+			dateKey := day.Format("2006-01-02")
+			if slices.Contains(sess.ExcludedDates, dateKey) {
+				continue
+			}
+			startsAt := day.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+			if !startsAt.After(now) {
+				continue
+			}
+			if best == nil || startsAt.Before(best.StartsAt) {
+				best = &NextClass{
+					SessionID:  sess.ID,
+					InstanceID: instanceid.New(dateKey, sess.ID),
+					Title:      sess.Title,
+					Date:       dateKey,
+					StartTime:  sess.StartTime,
+					EndTime:    sess.EndTime,
+					Instructor: sess.Instructor,
+					StartsAt:   startsAt,
+				}
+			}
+			break
+		}
+	}
+	return best, nil
+}
+
+func (s *Service) attendanceSummary(ctx context.Context, dojoID, uid string, now time.Time) (*AttendanceSummary, error) {
+	if s.attendanceSvc == nil {
+		return nil, nil
+	}
+	checkins, err := s.attendanceSvc.MemberCheckins(ctx, dojoID, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	since := now.AddDate(0, 0, -30)
+	out := &AttendanceSummary{Total: len(checkins)}
+	for _, a := range checkins {
+		if !a.CreatedAt.Before(since) {
+			out.Last30Days++
+		}
+	}
+	if n := len(checkins); n > 0 {
+		last := checkins[n-1].CreatedAt
+		out.LastCheckinAt = &last
+	}
+	return out, nil
+}
@@ -0,0 +1,23 @@
+package metering
+
+import "time"
+
+// Event types
+const (
+	EventMemberAdded      = "member_added"
+	EventClassCreated     = "class_created"
+	EventAnnouncementSent = "announcement_sent"
+	EventCheckinRecorded  = "checkin_recorded"
+)
+
+// Event is a single usage event (product analytics / usage-based billing)
+type Event struct {
+	ID         string                 `firestore:"-" json:"id"`
+	Type       string                 `firestore:"type" json:"type"`
+	DojoID     string                 `firestore:"dojoId" json:"dojoId"`
+	Plan       string                 `firestore:"plan" json:"plan"`
+	ActorUID   string                 `firestore:"actorUid,omitempty" json:"actorUid,omitempty"`
+	Quantity   int                    `firestore:"quantity" json:"quantity"`
+	Properties map[string]interface{} `firestore:"properties,omitempty" json:"properties,omitempty"`
+	OccurredAt time.Time              `firestore:"occurredAt" json:"occurredAt"`
+}
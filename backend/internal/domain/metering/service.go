@@ -0,0 +1,77 @@
+package metering
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// emitTimeout bounds the plan lookup and sink write of one event, which run
+// after the request that recorded it has returned
+const emitTimeout = 10 * time.Second
+
+// Recorder tags events with the dojo's current plan and forwards them to a sink.
+// Recording is best-effort: failures are logged and never block the caller.
+type Recorder struct {
+	client *firestore.Client
+	sink   Sink
+}
+
+func NewRecorder(client *firestore.Client, sink Sink) *Recorder {
+	if sink == nil {
+		sink = NopSink{}
+	}
+	return &Recorder{client: client, sink: sink}
+}
+
+// Record emits a single event with quantity 1
+func (r *Recorder) Record(ctx context.Context, eventType, dojoID, actorUID string, props map[string]interface{}) {
+	r.RecordN(ctx, eventType, dojoID, actorUID, 1, props)
+}
+
+// RecordN emits a single event covering n units (e.g. bulk check-ins). The
+// plan lookup and the sink write run in the background.
+func (r *Recorder) RecordN(ctx context.Context, eventType, dojoID, actorUID string, n int, props map[string]interface{}) {
+	if r == nil || n <= 0 {
+		return
+	}
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return
+	}
+
+	e := Event{
+		Type:       eventType,
+		DojoID:     dojoID,
+		ActorUID:   actorUID,
+		Quantity:   n,
+		Properties: props,
+		OccurredAt: time.Now().UTC(),
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), emitTimeout)
+	go func() {
+		defer cancel()
+		e.Plan = r.planOf(ctx, dojoID)
+		if err := r.sink.Emit(ctx, e); err != nil {
+			log.Printf("metering: %s dojo=%s: %v", eventType, dojoID, err)
+		}
+	}()
+}
+
+func (r *Recorder) planOf(ctx context.Context, dojoID string) string {
+	if r.client == nil {
+		return "free"
+	}
+	doc, err := r.client.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		return "free"
+	}
+	plan, _ := doc.Data()["plan"].(string)
+	if plan == "" {
+		plan = "free"
+	}
+	return plan
+}
@@ -0,0 +1,36 @@
+package metering
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Sink receives usage events. Firestore is the default; a Pub/Sub sink can
+// implement the same interface without touching callers.
+type Sink interface {
+	Emit(ctx context.Context, e Event) error
+}
+
+// FirestoreSink appends events to the top-level usageEvents collection
+type FirestoreSink struct {
+	client *firestore.Client
+}
+
+func NewFirestoreSink(client *firestore.Client) *FirestoreSink {
+	return &FirestoreSink{client: client}
+}
+
+func (s *FirestoreSink) Emit(ctx context.Context, e Event) error {
+	ref := s.client.Collection("usageEvents").NewDoc()
+	if _, err := ref.Set(ctx, e); err != nil {
+		return fmt.Errorf("failed to write usage event: %w", err)
+	}
+	return nil
+}
+
+// NopSink drops all events (tests / local runs)
+type NopSink struct{}
+
+func (NopSink) Emit(context.Context, Event) error { return nil }
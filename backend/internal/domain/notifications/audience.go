@@ -0,0 +1,157 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/fsdoc"
+)
+
+// classAudienceWindow is how far back "attends no-gi classes" and "attends
+// the Tuesday fundamentals class" look
+const classAudienceWindow = 90 * 24 * time.Hour
+
+// MaxInactiveDays caps the inactiveDays audience filter
+const MaxInactiveDays = 365
+
+// memberFilter is one audience condition. A bulk send reaches the members of
+// its audience (all, students, staff) that pass every filter.
+type memberFilter func(uid string, m fsdoc.Member) bool
+
+// inSet keeps the members whose uid is in set
+func inSet(set map[string]bool) memberFilter {
+	return func(uid string, _ fsdoc.Member) bool { return set[uid] }
+}
+
+// passes decodes the member doc only when there is something to check
+func passes(doc *firestore.DocumentSnapshot, uid string, filters []memberFilter) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	var m fsdoc.Member
+	if err := fsdoc.Decode(doc, &m); err != nil {
+		return false
+	}
+	for _, f := range filters {
+		if !f(uid, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// audienceFilters turns the targeting fields of a bulk send into filters.
+// Filters that need attendance are resolved here, before the send quota is
+// used, so a bad class id does not cost a send.
+func (s *Service) audienceFilters(ctx context.Context, input SendBulkNotificationInput) ([]memberFilter, error) {
+	var filters []memberFilter
+
+	if input.BeltMin != "" || input.BeltMax != "" {
+		f, err := beltRange(input.BeltMin, input.BeltMax)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	switch input.AgeGroup {
+	case "":
+	case "kids":
+		filters = append(filters, func(_ string, m fsdoc.Member) bool { return m.IsKids })
+	case "adults":
+		filters = append(filters, func(_ string, m fsdoc.Member) bool { return !m.IsKids })
+	default:
+		return nil, fmt.Errorf("%w: ageGroup must be 'kids' or 'adults'", ErrBadRequest)
+	}
+
+	needsAttendance := len(input.Tags) > 0 || input.SessionID != "" || input.InactiveDays != 0
+	if needsAttendance && (s.sessionSvc == nil || s.attendanceSvc == nil) {
+		return nil, fmt.Errorf("%w: class targeting is not available", ErrBadRequest)
+	}
+
+	if len(input.Tags) > 0 {
+		attendees, err := s.tagAudience(ctx, input.DojoID, input.Tags)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, inSet(attendees))
+	}
+
+	if input.SessionID != "" {
+		if _, err := s.sessionSvc.Get(ctx, input.DojoID, input.SessionID); err != nil {
+			if session.IsErrNotFound(err) {
+				return nil, fmt.Errorf("%w: class not found", ErrNotFound)
+			}
+			return nil, err
+		}
+		since := time.Now().UTC().Add(-classAudienceWindow)
+		attendees, err := s.attendanceSvc.AttendeesOfSessions(ctx, input.DojoID, []string{input.SessionID}, since)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, inSet(attendees))
+	}
+
+	if input.InactiveDays != 0 {
+		if input.InactiveDays < 1 || input.InactiveDays > MaxInactiveDays {
+			return nil, fmt.Errorf("%w: inactiveDays must be between 1 and %d", ErrBadRequest, MaxInactiveDays)
+		}
+		cutoff := time.Now().UTC().AddDate(0, 0, -input.InactiveDays)
+		active, err := s.attendanceSvc.CheckinsByMember(ctx, input.DojoID, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		// members who joined after the cutoff have not had the chance to lapse
+		filters = append(filters, func(uid string, m fsdoc.Member) bool {
+			return active[uid] == 0 && m.Since().Before(cutoff)
+		})
+	}
+
+	return filters, nil
+}
+
+// tagAudience returns the members who attended a class carrying one of the
+// tags within classAudienceWindow
+func (s *Service) tagAudience(ctx context.Context, dojoID string, tags []string) (map[string]bool, error) {
+	sessionIDs, err := s.sessionSvc.SessionIDsWithTags(ctx, dojoID, tags)
+	if err != nil {
+		return nil, err
+	}
+	return s.attendanceSvc.AttendeesOfSessions(ctx, dojoID, sessionIDs, time.Now().UTC().Add(-classAudienceWindow))
+}
+
+// beltRange keeps members from belt from to belt to, inclusive. Both ends
+// must be on the same belt system (adult or kids); an empty end is open.
+func beltRange(from, to string) (memberFilter, error) {
+	order := ranks.BeltOrder
+	kidsOnly := ranks.KidsBeltOrder[1:] // white is on both systems
+	if slices.Contains(kidsOnly, from) || slices.Contains(kidsOnly, to) {
+		order = ranks.KidsBeltOrder
+	}
+
+	lo, hi := 0, len(order)-1
+	if from != "" {
+		if lo = slices.Index(order, from); lo < 0 {
+			return nil, fmt.Errorf("%w: beltMin and beltMax must be belts of the same system", ErrBadRequest)
+		}
+	}
+	if to != "" {
+		if hi = slices.Index(order, to); hi < 0 {
+			return nil, fmt.Errorf("%w: beltMin and beltMax must be belts of the same system", ErrBadRequest)
+		}
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("%w: beltMin is above beltMax", ErrBadRequest)
+	}
+
+	return func(_ string, m fsdoc.Member) bool {
+		i := slices.Index(order, m.Belt())
+		return i >= lo && i <= hi
+	}, nil
+}
@@ -6,6 +6,7 @@ var (
 	ErrUnauthorized = errors.New("unauthorized")
 	ErrNotFound     = errors.New("not found")
 	ErrBadRequest   = errors.New("bad request")
+	ErrTooLarge     = errors.New("payload too large")
 )
 
 func IsErrUnauthorized(err error) bool {
@@ -19,3 +20,7 @@ func IsErrNotFound(err error) bool {
 func IsErrBadRequest(err error) bool {
 	return errors.Is(err, ErrBadRequest)
 }
+
+func IsErrTooLarge(err error) bool {
+	return errors.Is(err, ErrTooLarge)
+}
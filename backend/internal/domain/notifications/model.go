@@ -3,6 +3,8 @@ package notifications
 import (
 	"strings"
 	"time"
+
+	"dojo-manager/backend/internal/domain/session"
 )
 
 // Notification represents a notification
@@ -49,6 +51,10 @@ type CreateNoticeInput struct {
 	// Optional: nil のときは保存しない/指定なし
 	PublishAt *time.Time `json:"publishAt,omitempty"`
 	ExpireAt  *time.Time `json:"expireAt,omitempty"`
+
+	// Notify also sends a notification to each member of Audience (read receipts)
+	Notify   bool   `json:"notify,omitempty"`
+	Audience string `json:"audience,omitempty"` // "all", "students", "staff"
 }
 
 func (in *CreateNoticeInput) Trim() {
@@ -56,9 +62,16 @@ func (in *CreateNoticeInput) Trim() {
 	in.Title = strings.TrimSpace(in.Title)
 	in.Body = strings.TrimSpace(in.Body)
 	in.Type = strings.TrimSpace(in.Type)
+	in.Audience = strings.TrimSpace(in.Audience)
 	// PublishAt/ExpireAt は time なので Trim 不要
 }
 
+// Bulk sends fan out to every recipient, so their text is capped
+const (
+	MaxBulkTitleLength = 200
+	MaxBulkBodyLength  = 4000
+)
+
 // SendBulkNotificationInput represents input for sending bulk notifications
 type SendBulkNotificationInput struct {
 	DojoID   string `json:"dojoId"`
@@ -66,6 +79,28 @@ type SendBulkNotificationInput struct {
 	Body     string `json:"body,omitempty"`
 	Type     string `json:"type,omitempty"`
 	Audience string `json:"audience,omitempty"` // "all", "students", "staff"
+
+	// NoticeID links the notifications to a dojo notice for read receipts
+	NoticeID string `json:"noticeId,omitempty"`
+
+	// Tags narrows the audience to members who recently attended classes
+	// with any of these tags, e.g. ["no-gi"]
+	Tags []string `json:"tags,omitempty"`
+
+	// Further targeting; a member must match every filter given.
+	// BeltMin/BeltMax bound the belt (adult or kids order, either end open),
+	// SessionID keeps recent attendees of one class and InactiveDays keeps
+	// members with no check-in in that many days.
+	BeltMin      string `json:"beltMin,omitempty"`
+	BeltMax      string `json:"beltMax,omitempty"`
+	AgeGroup     string `json:"ageGroup,omitempty"` // "kids" or "adults"
+	SessionID    string `json:"sessionId,omitempty"`
+	InactiveDays int    `json:"inactiveDays,omitempty"`
+
+	// TemplateID sends a saved template instead of Title/Body, with its
+	// {{variables}} filled in from Variables
+	TemplateID string            `json:"templateId,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
 }
 
 func (in *SendBulkNotificationInput) Trim() {
@@ -74,6 +109,13 @@ func (in *SendBulkNotificationInput) Trim() {
 	in.Body = strings.TrimSpace(in.Body)
 	in.Type = strings.TrimSpace(in.Type)
 	in.Audience = strings.TrimSpace(in.Audience)
+	in.NoticeID = strings.TrimSpace(in.NoticeID)
+	in.Tags = session.NormalizeTags(in.Tags)
+	in.BeltMin = strings.TrimSpace(in.BeltMin)
+	in.BeltMax = strings.TrimSpace(in.BeltMax)
+	in.AgeGroup = strings.TrimSpace(in.AgeGroup)
+	in.SessionID = strings.TrimSpace(in.SessionID)
+	in.TemplateID = strings.TrimSpace(in.TemplateID)
 }
 
 // MarkReadInput represents input for marking notifications as read
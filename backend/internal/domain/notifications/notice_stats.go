@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// NoticeDelivery is notices/{noticeId}/deliveries/{uid}: which notification
+// a member received for a notice. Read state lives on the notification itself.
+type NoticeDelivery struct {
+	UID            string    `firestore:"uid" json:"uid"`
+	NotificationID string    `firestore:"notificationId" json:"notificationId"`
+	DeliveredAt    time.Time `firestore:"deliveredAt" json:"deliveredAt"`
+}
+
+// UnopenedMember is a recipient who has not read the notice yet
+type UnopenedMember struct {
+	UID         string    `json:"uid"`
+	DisplayName string    `json:"displayName,omitempty"`
+	DeliveredAt time.Time `json:"deliveredAt"`
+}
+
+// NoticeStats is the delivery / read summary of a notice
+type NoticeStats struct {
+	NoticeID  string           `json:"noticeId"`
+	Delivered int              `json:"delivered"`
+	Read      int              `json:"read"`
+	Unread    int              `json:"unread"`
+	ReadRate  float64          `json:"readRate"` // 0..1
+	Unopened  []UnopenedMember `json:"unopened"`
+}
+
+func (s *Service) deliveriesCol(dojoID, noticeID string) *firestore.CollectionRef {
+	return s.noticesCol(dojoID).Doc(noticeID).Collection("deliveries")
+}
+
+// GetNoticeStats counts deliveries and reads for a notice, using the read flag
+// of each recipient's users/{uid}/notifications doc. Deleted notifications count as read.
+func (s *Service) GetNoticeStats(ctx context.Context, dojoID, noticeID string) (*NoticeStats, error) {
+	dojoID = stringsTrim(dojoID)
+	noticeID = stringsTrim(noticeID)
+	if dojoID == "" || noticeID == "" {
+		return nil, fmt.Errorf("%w: dojoId and noticeId are required", ErrBadRequest)
+	}
+
+	if _, err := s.noticesCol(dojoID).Doc(noticeID).Get(ctx); err != nil {
+		return nil, fmt.Errorf("%w: notice not found", ErrNotFound)
+	}
+
+	docs, err := s.deliveriesCol(dojoID, noticeID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+
+	deliveries := make([]NoticeDelivery, 0, len(docs))
+	refs := make([]*firestore.DocumentRef, 0, len(docs))
+	for _, doc := range docs {
+		var d NoticeDelivery
+		if err := doc.DataTo(&d); err != nil || d.NotificationID == "" {
+			continue
+		}
+		if d.UID == "" {
+			d.UID = doc.Ref.ID
+		}
+		deliveries = append(deliveries, d)
+		refs = append(refs, s.notificationsCol(d.UID).Doc(d.NotificationID))
+	}
+
+	out := &NoticeStats{NoticeID: noticeID, Delivered: len(deliveries), Unopened: []UnopenedMember{}}
+	if len(refs) == 0 {
+		return out, nil
+	}
+
+	snaps, err := s.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notifications: %w", err)
+	}
+
+	var unopened []NoticeDelivery
+	for i, snap := range snaps {
+		read := true
+		if snap.Exists() {
+			read, _ = snap.Data()["read"].(bool)
+		}
+		if read {
+			out.Read++
+		} else {
+			unopened = append(unopened, deliveries[i])
+		}
+	}
+	out.Unread = out.Delivered - out.Read
+	out.ReadRate = float64(out.Read) / float64(out.Delivered)
+
+	names := s.memberNames(ctx, unopened)
+	for _, d := range unopened {
+		out.Unopened = append(out.Unopened, UnopenedMember{
+			UID:         d.UID,
+			DisplayName: names[d.UID],
+			DeliveredAt: d.DeliveredAt,
+		})
+	}
+	return out, nil
+}
+
+// memberNames resolves display names for follow-up lists (best effort)
+func (s *Service) memberNames(ctx context.Context, list []NoticeDelivery) map[string]string {
+	names := map[string]string{}
+	if len(list) == 0 {
+		return names
+	}
+	refs := make([]*firestore.DocumentRef, 0, len(list))
+	for _, d := range list {
+		refs = append(refs, s.client.Collection("users").Doc(d.UID))
+	}
+	snaps, err := s.client.GetAll(ctx, refs)
+	if err != nil {
+		return names
+	}
+	for _, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		if v, ok := snap.Data()["displayName"].(string); ok && v != "" {
+			names[snap.Ref.ID] = v
+		}
+	}
+	return names
+}
@@ -0,0 +1,280 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Notice is a dojo announcement stored in dojos/{dojoId}/notices
+type Notice struct {
+	ID             string     `firestore:"-" json:"id"`
+	Title          string     `firestore:"title" json:"title"`
+	Body           string     `firestore:"body" json:"body"`
+	Type           string     `firestore:"type" json:"type"`
+	Status         string     `firestore:"status" json:"status"` // active / archived
+	PublishAt      time.Time  `firestore:"publishAt" json:"publishAt"`
+	ExpireAt       *time.Time `firestore:"expireAt,omitempty" json:"expireAt,omitempty"`
+	DeliveredCount int        `firestore:"deliveredCount,omitempty" json:"deliveredCount,omitempty"`
+	CreatedBy      string     `firestore:"createdBy" json:"createdBy"`
+	CreatedAt      time.Time  `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time  `firestore:"updatedAt" json:"updatedAt"`
+	ArchivedAt     *time.Time `firestore:"archivedAt,omitempty" json:"archivedAt,omitempty"`
+}
+
+const (
+	NoticeStatusActive   = "active"
+	NoticeStatusArchived = "archived"
+
+	// list filters (derived from status / publishAt / expireAt)
+	NoticeFilterActive    = "active"
+	NoticeFilterScheduled = "scheduled"
+	NoticeFilterExpired   = "expired"
+	NoticeFilterArchived  = "archived"
+)
+
+var ValidNoticeFilters = []string{NoticeFilterActive, NoticeFilterScheduled, NoticeFilterExpired, NoticeFilterArchived}
+
+// State derives the list filter bucket of a notice at a point in time
+func (n Notice) State(now time.Time) string {
+	switch {
+	case n.Status == NoticeStatusArchived:
+		return NoticeFilterArchived
+	case n.PublishAt.After(now):
+		return NoticeFilterScheduled
+	case n.ExpireAt != nil && !n.ExpireAt.After(now):
+		return NoticeFilterExpired
+	default:
+		return NoticeFilterActive
+	}
+}
+
+// ListNoticesInput filters notices; empty Filter returns everything but archived
+type ListNoticesInput struct {
+	Filter string
+	Limit  int
+}
+
+// UpdateNoticeInput updates a notice (nil fields are left unchanged)
+type UpdateNoticeInput struct {
+	Title     *string    `json:"title,omitempty"`
+	Body      *string    `json:"body,omitempty"`
+	Type      *string    `json:"type,omitempty"`
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	ExpireAt  *time.Time `json:"expireAt,omitempty"`
+
+	// ClearExpireAt removes the expiry (notice stays active indefinitely)
+	ClearExpireAt bool `json:"clearExpireAt,omitempty"`
+}
+
+func (in *UpdateNoticeInput) Trim() {
+	if in.Title != nil {
+		*in.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.Body != nil {
+		*in.Body = strings.TrimSpace(*in.Body)
+	}
+	if in.Type != nil {
+		*in.Type = strings.TrimSpace(*in.Type)
+	}
+}
+
+// GetNotice gets a single notice
+func (s *Service) GetNotice(ctx context.Context, dojoID, noticeID string) (*Notice, error) {
+	dojoID = stringsTrim(dojoID)
+	noticeID = stringsTrim(noticeID)
+	if dojoID == "" || noticeID == "" {
+		return nil, fmt.Errorf("%w: dojoId and noticeId are required", ErrBadRequest)
+	}
+
+	doc, err := s.noticesCol(dojoID).Doc(noticeID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: notice not found", ErrNotFound)
+	}
+	var n Notice
+	if err := doc.DataTo(&n); err != nil {
+		return nil, fmt.Errorf("failed to decode notice: %w", err)
+	}
+	n.ID = doc.Ref.ID
+	return &n, nil
+}
+
+// ListNotices lists notices of a dojo, newest publishAt first
+func (s *Service) ListNotices(ctx context.Context, dojoID string, in ListNoticesInput) ([]Notice, error) {
+	dojoID = stringsTrim(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	filter := strings.ToLower(stringsTrim(in.Filter))
+	if filter != "" && !isValidNoticeFilter(filter) {
+		return nil, fmt.Errorf("%w: filter must be one of: active, scheduled, expired, archived", ErrBadRequest)
+	}
+
+	limit := in.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	now := time.Now().UTC()
+	q := s.noticesCol(dojoID).Query
+	switch filter {
+	case NoticeFilterArchived:
+		q = q.Where("status", "==", NoticeStatusArchived)
+	case NoticeFilterScheduled:
+		q = q.Where("status", "==", NoticeStatusActive).Where("publishAt", ">", now)
+	default:
+		// active / expired are split on expireAt in code (missing expireAt can't be queried)
+		q = q.Where("status", "==", NoticeStatusActive)
+	}
+	q = q.OrderBy("publishAt", firestore.Desc)
+
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	out := []Notice{}
+	for len(out) < limit {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list notices: %w", err)
+		}
+
+		var n Notice
+		if err := doc.DataTo(&n); err != nil {
+			continue
+		}
+		n.ID = doc.Ref.ID
+
+		if filter != "" && n.State(now) != filter {
+			continue
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// NoticesPublishedBetween lists the notices, archived ones included, whose
+// publishAt is in [from, to), oldest first
+func (s *Service) NoticesPublishedBetween(ctx context.Context, dojoID string, from, to time.Time) ([]Notice, error) {
+	dojoID = stringsTrim(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	docs, err := s.noticesCol(dojoID).
+		Where("publishAt", ">=", from).
+		Where("publishAt", "<", to).
+		OrderBy("publishAt", firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notices: %w", err)
+	}
+	out := make([]Notice, 0, len(docs))
+	for _, doc := range docs {
+		var n Notice
+		if err := doc.DataTo(&n); err != nil {
+			continue
+		}
+		n.ID = doc.Ref.ID
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// UpdateNotice updates a notice. Re-activating an expired/scheduled notice
+// is checked against the announcement plan limit.
+func (s *Service) UpdateNotice(ctx context.Context, dojoID, noticeID string, in UpdateNoticeInput) (*Notice, error) {
+	in.Trim()
+	dojoID = stringsTrim(dojoID)
+
+	existing, err := s.GetNotice(ctx, dojoID, noticeID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status == NoticeStatusArchived {
+		return nil, fmt.Errorf("%w: archived notices cannot be edited", ErrBadRequest)
+	}
+
+	now := time.Now().UTC()
+	updated := *existing
+	updates := map[string]interface{}{
+		"updatedAt": now,
+	}
+
+	if in.Title != nil {
+		if *in.Title == "" {
+			return nil, fmt.Errorf("%w: title cannot be empty", ErrBadRequest)
+		}
+		updates["title"] = *in.Title
+	}
+	if in.Body != nil {
+		updates["body"] = *in.Body
+	}
+	if in.Type != nil && *in.Type != "" {
+		updates["type"] = *in.Type
+	}
+	if in.PublishAt != nil && !in.PublishAt.IsZero() {
+		updated.PublishAt = in.PublishAt.UTC()
+		updates["publishAt"] = updated.PublishAt
+	}
+	if in.ClearExpireAt {
+		updated.ExpireAt = nil
+		updates["expireAt"] = firestore.Delete
+	} else if in.ExpireAt != nil && !in.ExpireAt.IsZero() {
+		exp := in.ExpireAt.UTC()
+		updated.ExpireAt = &exp
+		updates["expireAt"] = exp
+	}
+	if updated.ExpireAt != nil && !updated.ExpireAt.After(updated.PublishAt) {
+		return nil, fmt.Errorf("%w: expireAt must be after publishAt", ErrBadRequest)
+	}
+
+	// plan limit counts currently active notices
+	if existing.State(now) != NoticeFilterActive && updated.State(now) == NoticeFilterActive {
+		if err := s.limits.CheckPlanLimit(ctx, dojoID, "announcement"); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.noticesCol(dojoID).Doc(existing.ID).Set(ctx, updates, firestore.MergeAll); err != nil {
+		return nil, fmt.Errorf("failed to update notice: %w", err)
+	}
+	return s.GetNotice(ctx, dojoID, existing.ID)
+}
+
+// ArchiveNotice hides a notice from members; it no longer counts toward plan limits
+func (s *Service) ArchiveNotice(ctx context.Context, dojoID, noticeID string) (*Notice, error) {
+	dojoID = stringsTrim(dojoID)
+	existing, err := s.GetNotice(ctx, dojoID, noticeID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Status == NoticeStatusArchived {
+		return existing, nil
+	}
+
+	now := time.Now().UTC()
+	_, err = s.noticesCol(dojoID).Doc(existing.ID).Set(ctx, map[string]interface{}{
+		"status":     NoticeStatusArchived,
+		"archivedAt": now,
+		"updatedAt":  now,
+	}, firestore.MergeAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive notice: %w", err)
+	}
+	return s.GetNotice(ctx, dojoID, existing.ID)
+}
+
+func isValidNoticeFilter(f string) bool {
+	for _, v := range ValidNoticeFilters {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
@@ -4,25 +4,41 @@ import (
 	"context"
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
 
-	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/metering"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/planlimit"
 )
 
 type Service struct {
-	client    *firestore.Client
-	stripeSvc *stripedom.Service // plan limit checks
+	client        *firestore.Client
+	limits        planlimit.PlanLimiter // plan caps (Unlimited without billing)
+	meter         *metering.Recorder    // usage events (optional)
+	sessionSvc    *session.Service      // tag targeting (optional)
+	attendanceSvc *attendance.Service   // tag targeting (optional)
 }
 
-func NewService(client *firestore.Client) *Service {
-	return &Service{client: client}
+// NewService takes the plan limiter capping announcements and bulk sends
+// (nil = unlimited)
+func NewService(client *firestore.Client, limits planlimit.PlanLimiter) *Service {
+	return &Service{client: client, limits: planlimit.OrUnlimited(limits)}
 }
 
-// SetStripeService sets the stripe service for plan limit checks
-func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
-	s.stripeSvc = stripeSvc
+// SetMeteringRecorder sets the recorder for usage events
+func (s *Service) SetMeteringRecorder(meter *metering.Recorder) {
+	s.meter = meter
+}
+
+// SetClassServices enables targeting bulk sends by class, class tags and
+// inactivity
+func (s *Service) SetClassServices(sessionSvc *session.Service, attendanceSvc *attendance.Service) {
+	s.sessionSvc = sessionSvc
+	s.attendanceSvc = attendanceSvc
 }
 
 func (s *Service) notificationsCol(uid string) *firestore.CollectionRef {
@@ -186,8 +202,8 @@ func (s *Service) CreateNotification(ctx context.Context, senderUID string, inpu
 	}
 
 	// plan limit (if dojoId provided)
-	if input.DojoID != "" && s.stripeSvc != nil {
-		if err := s.stripeSvc.CheckPlanLimit(ctx, input.DojoID, "announcement"); err != nil {
+	if input.DojoID != "" {
+		if err := s.limits.CheckPlanLimit(ctx, input.DojoID, "announcement"); err != nil {
 			return "", err
 		}
 	}
@@ -221,9 +237,23 @@ func (s *Service) SendBulkNotification(ctx context.Context, senderUID string, in
 	input.Trim()
 	senderUID = stringsTrim(senderUID)
 
+	if input.TemplateID != "" {
+		rendered, err := s.RenderTemplate(ctx, input.DojoID, input.TemplateID, input.Variables)
+		if err != nil {
+			return 0, err
+		}
+		input.Title, input.Body = rendered.Title, rendered.Body
+		if input.Type == "" {
+			input.Type = rendered.Type
+		}
+	}
+
 	if input.DojoID == "" || input.Title == "" {
 		return 0, fmt.Errorf("%w: dojoId and title are required", ErrBadRequest)
 	}
+	if utf8.RuneCountInString(input.Title) > MaxBulkTitleLength || utf8.RuneCountInString(input.Body) > MaxBulkBodyLength {
+		return 0, fmt.Errorf("%w: title is limited to %d and body to %d characters", ErrTooLarge, MaxBulkTitleLength, MaxBulkBodyLength)
+	}
 
 	// Validate audience (helper is in model.go)
 	if !IsValidAudience(input.Audience) {
@@ -231,21 +261,64 @@ func (s *Service) SendBulkNotification(ctx context.Context, senderUID string, in
 	}
 
 	// plan limit: announcement（まとめて1回）
-	if s.stripeSvc != nil {
-		if err := s.stripeSvc.CheckPlanLimit(ctx, input.DojoID, "announcement"); err != nil {
-			return 0, err
+	if err := s.limits.CheckPlanLimit(ctx, input.DojoID, "announcement"); err != nil {
+		return 0, err
+	}
+
+	if input.NoticeID != "" {
+		if _, err := s.noticesCol(input.DojoID).Doc(input.NoticeID).Get(ctx); err != nil {
+			return 0, fmt.Errorf("%w: notice not found", ErrNotFound)
 		}
 	}
 
+	filters, err := s.audienceFilters(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+
+	// rolling weekly send quota (counted once per bulk send)
+	if err := s.limits.ConsumeBulkSend(ctx, input.DojoID); err != nil {
+		return 0, err
+	}
+
 	noticeType := input.Type
 	if noticeType == "" {
 		noticeType = "announcement"
 	}
 
+	sent, err := s.fanOut(ctx, senderUID, input.DojoID, input.Audience, input.NoticeID, filters, map[string]interface{}{
+		"title": input.Title,
+		"body":  input.Body,
+		"type":  noticeType,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.meter.Record(ctx, metering.EventAnnouncementSent, input.DojoID, senderUID, map[string]interface{}{
+		"audience":     input.Audience,
+		"tags":         input.Tags,
+		"beltMin":      input.BeltMin,
+		"beltMax":      input.BeltMax,
+		"ageGroup":     input.AgeGroup,
+		"sessionId":    input.SessionID,
+		"inactiveDays": input.InactiveDays,
+		"templateId":   input.TemplateID,
+		"recipients":   sent,
+	})
+
+	return sent, nil
+}
+
+// fanOut writes one notification per dojo member in the audience.
+// When noticeID is set each notification carries it and a delivery record is
+// kept under notices/{noticeId}/deliveries for read receipts. Members must
+// also pass every filter.
+func (s *Service) fanOut(ctx context.Context, senderUID, dojoID, audience, noticeID string, filters []memberFilter, payload map[string]interface{}) (int, error) {
 	// build members query by audience
-	mq := s.dojoMembersCol(input.DojoID).Query
+	mq := s.dojoMembersCol(dojoID).Query
 
-	switch input.Audience {
+	switch audience {
 	case "", "all":
 		// no filter
 	case "students":
@@ -262,6 +335,7 @@ func (s *Service) SendBulkNotification(ctx context.Context, senderUID string, in
 	now := time.Now().UTC()
 	batch := s.client.Batch()
 	sent := 0
+	writes := 0
 
 	for {
 		doc, err := iter.Next()
@@ -273,33 +347,45 @@ func (s *Service) SendBulkNotification(ctx context.Context, senderUID string, in
 		}
 
 		targetUID := doc.Ref.ID
-		if targetUID == "" {
+		if targetUID == "" || !passes(doc, targetUID, filters) {
 			continue
 		}
 
-		ref := s.notificationsCol(targetUID).NewDoc() // auto-id
-		batch.Set(ref, map[string]interface{}{
-			"title":     input.Title,
-			"body":      input.Body,
-			"type":      noticeType,
+		data := map[string]interface{}{
 			"read":      false,
 			"senderUid": senderUID,
-			"dojoId":    input.DojoID,
+			"dojoId":    dojoID,
 			"createdAt": now,
-		}, firestore.MergeAll)
+		}
+		for k, v := range payload {
+			data[k] = v
+		}
 
+		ref := s.notificationsCol(targetUID).NewDoc() // auto-id
+		if noticeID != "" {
+			data["noticeId"] = noticeID
+			batch.Set(s.deliveriesCol(dojoID, noticeID).Doc(targetUID), NoticeDelivery{
+				UID:            targetUID,
+				NotificationID: ref.ID,
+				DeliveredAt:    now,
+			})
+			writes++
+		}
+		batch.Set(ref, data, firestore.MergeAll)
+		writes++
 		sent++
 
 		// Firestore batch limit (500)
-		if sent%450 == 0 {
+		if writes >= 450 {
 			if _, err := batch.Commit(ctx); err != nil {
 				return 0, fmt.Errorf("failed to send bulk notifications: %w", err)
 			}
 			batch = s.client.Batch()
+			writes = 0
 		}
 	}
 
-	if sent > 0 {
+	if writes > 0 {
 		if _, err := batch.Commit(ctx); err != nil {
 			return 0, fmt.Errorf("failed to send bulk notifications: %w", err)
 		}
@@ -317,9 +403,17 @@ func (s *Service) CreateNotice(ctx context.Context, senderUID string, input Crea
 		return "", fmt.Errorf("%w: dojoId and title are required", ErrBadRequest)
 	}
 
+	if input.Notify && !IsValidAudience(input.Audience) {
+		return "", fmt.Errorf("%w: audience must be one of: all, students, staff", ErrBadRequest)
+	}
+
 	// plan limit
-	if s.stripeSvc != nil {
-		if err := s.stripeSvc.CheckPlanLimit(ctx, input.DojoID, "announcement"); err != nil {
+	if err := s.limits.CheckPlanLimit(ctx, input.DojoID, "announcement"); err != nil {
+		return "", err
+	}
+	// notifying members is a bulk send
+	if input.Notify {
+		if err := s.limits.ConsumeBulkSend(ctx, input.DojoID); err != nil {
 			return "", err
 		}
 	}
@@ -356,6 +450,23 @@ func (s *Service) CreateNotice(ctx context.Context, senderUID string, input Crea
 		return "", fmt.Errorf("failed to create notice: %w", err)
 	}
 
+	// push to members' inboxes so delivery / read stats can be tracked
+	if input.Notify {
+		sent, err := s.fanOut(ctx, senderUID, input.DojoID, input.Audience, ref.ID, nil, map[string]interface{}{
+			"title": input.Title,
+			"body":  input.Body,
+			"type":  noticeType,
+		})
+		if err != nil {
+			return ref.ID, err
+		}
+		_, _ = ref.Set(ctx, map[string]interface{}{"deliveredCount": sent}, firestore.MergeAll)
+	}
+
+	s.meter.Record(ctx, metering.EventAnnouncementSent, input.DojoID, senderUID, map[string]interface{}{
+		"noticeId": ref.ID,
+	})
+
 	return ref.ID, nil
 }
 
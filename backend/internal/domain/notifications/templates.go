@@ -0,0 +1,257 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Template is a reusable announcement stored in
+// dojos/{dojoId}/notificationTemplates. Title and body may contain
+// {{variable}} placeholders that are filled in at send time, e.g.
+// "Class cancelled: {{class}} on {{date}}".
+type Template struct {
+	ID        string    `firestore:"-" json:"id"`
+	Name      string    `firestore:"name" json:"name"`
+	Title     string    `firestore:"title" json:"title"`
+	Body      string    `firestore:"body" json:"body"`
+	Type      string    `firestore:"type,omitempty" json:"type,omitempty"`
+	Variables []string  `firestore:"variables" json:"variables"` // placeholders, in order of first use
+	CreatedBy string    `firestore:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// TemplateInput creates a template, or replaces one on update
+type TemplateInput struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Body  string `json:"body,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+func (in *TemplateInput) Trim() {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Title = strings.TrimSpace(in.Title)
+	in.Body = strings.TrimSpace(in.Body)
+	in.Type = strings.TrimSpace(in.Type)
+}
+
+// RenderedTemplate is a template with its variables filled in
+type RenderedTemplate struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Type  string `json:"type,omitempty"`
+}
+
+const (
+	maxTemplates           = 50
+	maxTemplateNameLength  = 80
+	maxTemplateVariables   = 20
+	maxVariableValueLength = 200
+)
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([a-zA-Z][a-zA-Z0-9_]*)\s*\}\}`)
+
+func (s *Service) templatesCol(dojoID string) *firestore.CollectionRef {
+	return s.client.Collection("dojos").Doc(dojoID).Collection("notificationTemplates")
+}
+
+// placeholders lists the variables used in title and body, in order
+func placeholders(texts ...string) []string {
+	out := []string{}
+	for _, t := range texts {
+		for _, m := range placeholderRe.FindAllStringSubmatch(t, -1) {
+			if !slices.Contains(out, m[1]) {
+				out = append(out, m[1])
+			}
+		}
+	}
+	return out
+}
+
+func (in TemplateInput) validate() error {
+	if in.Name == "" || in.Title == "" {
+		return fmt.Errorf("%w: name and title are required", ErrBadRequest)
+	}
+	if utf8.RuneCountInString(in.Name) > maxTemplateNameLength {
+		return fmt.Errorf("%w: name is limited to %d characters", ErrBadRequest, maxTemplateNameLength)
+	}
+	if utf8.RuneCountInString(in.Title) > MaxBulkTitleLength || utf8.RuneCountInString(in.Body) > MaxBulkBodyLength {
+		return fmt.Errorf("%w: title is limited to %d and body to %d characters", ErrTooLarge, MaxBulkTitleLength, MaxBulkBodyLength)
+	}
+	if n := len(placeholders(in.Title, in.Body)); n > maxTemplateVariables {
+		return fmt.Errorf("%w: at most %d variables per template", ErrBadRequest, maxTemplateVariables)
+	}
+	return nil
+}
+
+// ListTemplates returns the dojo's templates by name
+func (s *Service) ListTemplates(ctx context.Context, dojoID string) ([]Template, error) {
+	dojoID = stringsTrim(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	iter := s.templatesCol(dojoID).OrderBy("name", firestore.Asc).Limit(maxTemplates).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Template{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list templates: %w", err)
+		}
+		var t Template
+		if err := doc.DataTo(&t); err != nil {
+			continue
+		}
+		t.ID = doc.Ref.ID
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// GetTemplate returns one template
+func (s *Service) GetTemplate(ctx context.Context, dojoID, templateID string) (*Template, error) {
+	dojoID = stringsTrim(dojoID)
+	templateID = stringsTrim(templateID)
+	if dojoID == "" || templateID == "" {
+		return nil, fmt.Errorf("%w: dojoId and templateId are required", ErrBadRequest)
+	}
+	doc, err := s.templatesCol(dojoID).Doc(templateID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: template not found", ErrNotFound)
+	}
+	var t Template
+	if err := doc.DataTo(&t); err != nil {
+		return nil, fmt.Errorf("failed to decode template: %w", err)
+	}
+	t.ID = doc.Ref.ID
+	return &t, nil
+}
+
+// CreateTemplate saves a new template (staff)
+func (s *Service) CreateTemplate(ctx context.Context, staffUID, dojoID string, in TemplateInput) (*Template, error) {
+	in.Trim()
+	dojoID = stringsTrim(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.templatesCol(dojoID).Select().Limit(maxTemplates).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count templates: %w", err)
+	}
+	if len(existing) >= maxTemplates {
+		return nil, fmt.Errorf("%w: at most %d templates per dojo", ErrBadRequest, maxTemplates)
+	}
+
+	now := time.Now().UTC()
+	t := Template{
+		Name:      in.Name,
+		Title:     in.Title,
+		Body:      in.Body,
+		Type:      in.Type,
+		Variables: placeholders(in.Title, in.Body),
+		CreatedBy: staffUID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ref := s.templatesCol(dojoID).NewDoc()
+	if _, err := ref.Set(ctx, t); err != nil {
+		return nil, fmt.Errorf("failed to save template: %w", err)
+	}
+	t.ID = ref.ID
+	return &t, nil
+}
+
+// UpdateTemplate replaces a template's name and text (staff)
+func (s *Service) UpdateTemplate(ctx context.Context, dojoID, templateID string, in TemplateInput) (*Template, error) {
+	in.Trim()
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	t, err := s.GetTemplate(ctx, dojoID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Name = in.Name
+	t.Title = in.Title
+	t.Body = in.Body
+	t.Type = in.Type
+	t.Variables = placeholders(in.Title, in.Body)
+	t.UpdatedAt = time.Now().UTC()
+	if _, err := s.templatesCol(stringsTrim(dojoID)).Doc(t.ID).Set(ctx, t); err != nil {
+		return nil, fmt.Errorf("failed to save template: %w", err)
+	}
+	return t, nil
+}
+
+// DeleteTemplate removes a template (staff)
+func (s *Service) DeleteTemplate(ctx context.Context, dojoID, templateID string) error {
+	t, err := s.GetTemplate(ctx, dojoID, templateID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.templatesCol(stringsTrim(dojoID)).Doc(t.ID).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	return nil
+}
+
+// Render fills in the template's variables. Every variable must be given;
+// extra values are ignored.
+func (t *Template) Render(vars map[string]string) (*RenderedTemplate, error) {
+	missing := []string{}
+	for _, name := range t.Variables {
+		v := strings.TrimSpace(vars[name])
+		if v == "" {
+			missing = append(missing, name)
+			continue
+		}
+		if utf8.RuneCountInString(v) > maxVariableValueLength {
+			return nil, fmt.Errorf("%w: %s is limited to %d characters", ErrBadRequest, name, maxVariableValueLength)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing template variables: %s", ErrBadRequest, strings.Join(missing, ", "))
+	}
+
+	fill := func(text string) string {
+		return placeholderRe.ReplaceAllStringFunc(text, func(m string) string {
+			name := placeholderRe.FindStringSubmatch(m)[1]
+			return strings.TrimSpace(vars[name])
+		})
+	}
+	out := &RenderedTemplate{Title: fill(t.Title), Body: fill(t.Body), Type: t.Type}
+	if utf8.RuneCountInString(out.Title) > MaxBulkTitleLength || utf8.RuneCountInString(out.Body) > MaxBulkBodyLength {
+		return nil, fmt.Errorf("%w: title is limited to %d and body to %d characters", ErrTooLarge, MaxBulkTitleLength, MaxBulkBodyLength)
+	}
+	return out, nil
+}
+
+// RenderTemplate previews a template with the given variables
+func (s *Service) RenderTemplate(ctx context.Context, dojoID, templateID string, vars map[string]string) (*RenderedTemplate, error) {
+	t, err := s.GetTemplate(ctx, dojoID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	return t.Render(vars)
+}
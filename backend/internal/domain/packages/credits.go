@@ -0,0 +1,340 @@
+package packages
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Member doc fields. A member is on credits once anything has been granted;
+// members without creditsTracked (e.g. monthly subscribers) check in freely.
+const (
+	fieldCredits = "classCredits"
+	fieldTracked = "creditsTracked"
+
+	ledgerLimit = 50
+)
+
+func (s *Service) memberRef(dojoID, memberUID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("members").Doc(memberUID)
+}
+
+func (s *Service) ledgerCol(dojoID, memberUID string) *firestore.CollectionRef {
+	return s.memberRef(dojoID, memberUID).Collection("creditLedger")
+}
+
+func checkinEntryID(sessionInstanceID string) string {
+	return "checkin_" + sessionInstanceID
+}
+
+// balanceOf reads the credit fields of a member snapshot
+func balanceOf(doc *firestore.DocumentSnapshot) (int, bool) {
+	if doc == nil || !doc.Exists() {
+		return 0, false
+	}
+	data := doc.Data()
+	tracked, _ := data[fieldTracked].(bool)
+	credits, _ := data[fieldCredits].(int64)
+	return int(credits), tracked
+}
+
+// GetCredits returns a member's balance and recent ledger (staff or the member)
+func (s *Service) GetCredits(ctx context.Context, viewerUID, dojoID, memberUID string) (*Credits, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if viewerUID != memberUID {
+		if err := s.requireStaff(ctx, dojoID, viewerUID); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := s.memberRef(dojoID, memberUID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	balance, tracked := balanceOf(doc)
+
+	iter := s.ledgerCol(dojoID, memberUID).
+		OrderBy("createdAt", firestore.Desc).
+		Limit(ledgerLimit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	out := &Credits{MemberUID: memberUID, Tracked: tracked, Balance: balance, Ledger: []CreditEntry{}}
+	for {
+		d, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list credit ledger: %w", err)
+		}
+		var e CreditEntry
+		if err := d.DataTo(&e); err != nil {
+			continue
+		}
+		e.ID = d.Ref.ID
+		out.Ledger = append(out.Ledger, e)
+	}
+	return out, nil
+}
+
+// AdjustCredits manually adds or removes credits (staff only), e.g. for cash
+// sales or corrections. The balance cannot go below zero.
+func (s *Service) AdjustCredits(ctx context.Context, staffUID, dojoID, memberUID string, in AdjustCreditsInput) (*Credits, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	memberUID = strings.TrimSpace(memberUID)
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if in.Delta == 0 || in.Delta > maxCredits || in.Delta < -maxCredits {
+		return nil, fmt.Errorf("%w: delta must be non-zero and within ±%d", ErrBadRequest, maxCredits)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, dojoID, memberUID); err != nil {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+
+	if _, err := s.applyCredits(ctx, dojoID, memberUID, "", CreditEntry{
+		Delta:  in.Delta,
+		Reason: ReasonAdjustment,
+		Note:   in.Note,
+		By:     staffUID,
+	}); err != nil {
+		return nil, err
+	}
+	return s.GetCredits(ctx, staffUID, dojoID, memberUID)
+}
+
+// applyCredits adds entry.Delta to the balance and writes the ledger entry.
+// A non-empty entryID makes the grant idempotent (webhook retries).
+func (s *Service) applyCredits(ctx context.Context, dojoID, memberUID, entryID string, entry CreditEntry) (int, error) {
+	memberRef := s.memberRef(dojoID, memberUID)
+	entryRef := s.ledgerCol(dojoID, memberUID).NewDoc()
+	if entryID != "" {
+		entryRef = s.ledgerCol(dojoID, memberUID).Doc(entryID)
+	}
+
+	var balance int
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		memberDoc, err := tx.Get(memberRef)
+		if err != nil && memberDoc == nil {
+			return err
+		}
+		if entryID != "" {
+			existing, err := tx.Get(entryRef)
+			if err != nil && existing == nil {
+				return err
+			}
+			if existing.Exists() {
+				balance, _ = balanceOf(memberDoc)
+				return nil
+			}
+		}
+
+		current, _ := balanceOf(memberDoc)
+		balance = current + entry.Delta
+		if balance < 0 {
+			return fmt.Errorf("%w: member only has %d credits", ErrBadRequest, current)
+		}
+
+		now := time.Now().UTC()
+		entry.Balance = balance
+		entry.CreatedAt = now
+		if err := tx.Set(memberRef, map[string]interface{}{
+			fieldCredits: balance,
+			fieldTracked: true,
+			"updatedAt":  now,
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+		return tx.Set(entryRef, entry)
+	})
+	if err != nil {
+		if IsErrBadRequest(err) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to update credits: %w", err)
+	}
+	return balance, nil
+}
+
+// ConsumeCheckin takes one credit for a check-in. It is a no-op for members
+// not on credits and for a session instance that was already paid for. At
+// zero it fails with ErrNoCredits unless staff override, which lets the
+// member in without a deduction and records that on the ledger.
+func (s *Service) ConsumeCheckin(ctx context.Context, staffUID, dojoID, memberUID, sessionInstanceID string, override bool) error {
+	memberRef := s.memberRef(dojoID, memberUID)
+	entryRef := s.ledgerCol(dojoID, memberUID).Doc(checkinEntryID(sessionInstanceID))
+
+	consumed := false
+	balance := 0
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		memberDoc, err := tx.Get(memberRef)
+		if err != nil && memberDoc == nil {
+			return err
+		}
+		existing, err := tx.Get(entryRef)
+		if err != nil && existing == nil {
+			return err
+		}
+		consumed, balance, err = consumeIn(tx, memberDoc, existing, staffUID, sessionInstanceID, override)
+		return err
+	})
+	if err != nil {
+		if IsErrNoCredits(err) {
+			return err
+		}
+		return fmt.Errorf("failed to consume credit: %w", err)
+	}
+
+	if consumed && balance <= LowCreditsThreshold {
+		s.notifyLowCredits(ctx, dojoID, memberUID, balance)
+	}
+	return nil
+}
+
+// consumeIn takes a credit in tx, given the member doc and the class's
+// check-in ledger entry read in it. consumed reports whether the balance
+// went down, to balance.
+func consumeIn(tx *firestore.Transaction, memberDoc, existing *firestore.DocumentSnapshot, staffUID, sessionInstanceID string, override bool) (consumed bool, balance int, err error) {
+	current, tracked := balanceOf(memberDoc)
+	if !tracked {
+		return false, 0, nil
+	}
+	if existing.Exists() {
+		if refunded, _ := existing.Data()["refunded"].(bool); !refunded {
+			return false, current, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	entry := CreditEntry{
+		Delta:             -1,
+		Reason:            ReasonCheckin,
+		SessionInstanceID: sessionInstanceID,
+		By:                staffUID,
+		CreatedAt:         now,
+	}
+	if current <= 0 {
+		if !override {
+			return false, current, fmt.Errorf("%w: member has no class credits left", ErrNoCredits)
+		}
+		entry.Delta = 0
+		entry.Reason = ReasonOverride
+		entry.Balance = current
+		return false, current, tx.Set(existing.Ref, entry)
+	}
+
+	balance = current - 1
+	entry.Balance = balance
+	if err := tx.Set(memberDoc.Ref, map[string]interface{}{
+		fieldCredits: balance,
+		"updatedAt":  now,
+	}, firestore.MergeAll); err != nil {
+		return false, 0, err
+	}
+	return true, balance, tx.Set(existing.Ref, entry)
+}
+
+// RefundCheckin gives back the credit of a check-in that was changed to
+// absent / excused. No-op if nothing was taken for that session instance.
+func (s *Service) RefundCheckin(ctx context.Context, staffUID, dojoID, memberUID, sessionInstanceID string) error {
+	memberRef := s.memberRef(dojoID, memberUID)
+	entryRef := s.ledgerCol(dojoID, memberUID).Doc(checkinEntryID(sessionInstanceID))
+	refundRef := s.ledgerCol(dojoID, memberUID).NewDoc()
+
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		memberDoc, err := tx.Get(memberRef)
+		if err != nil && memberDoc == nil {
+			return err
+		}
+		existing, err := tx.Get(entryRef)
+		if err != nil && existing == nil {
+			return err
+		}
+		_, err = refundIn(tx, memberDoc, existing, refundRef, staffUID, sessionInstanceID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refund credit: %w", err)
+	}
+	return nil
+}
+
+// refundIn gives back in tx the credit the check-in ledger entry existing
+// took, writing the refund to refundRef. refunded reports whether the
+// balance went up.
+func refundIn(tx *firestore.Transaction, memberDoc, existing *firestore.DocumentSnapshot, refundRef *firestore.DocumentRef, staffUID, sessionInstanceID string) (refunded bool, err error) {
+	if !existing.Exists() {
+		return false, nil
+	}
+	data := existing.Data()
+	if done, _ := data["refunded"].(bool); done {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	if err := tx.Set(existing.Ref, map[string]interface{}{"refunded": true}, firestore.MergeAll); err != nil {
+		return false, err
+	}
+	// overrides took nothing, so there is nothing to give back
+	if delta, _ := data["delta"].(int64); delta == 0 {
+		return false, nil
+	}
+
+	current, _ := balanceOf(memberDoc)
+	if err := tx.Set(memberDoc.Ref, map[string]interface{}{
+		fieldCredits: current + 1,
+		"updatedAt":  now,
+	}, firestore.MergeAll); err != nil {
+		return false, err
+	}
+	return true, tx.Set(refundRef, CreditEntry{
+		Delta:             1,
+		Balance:           current + 1,
+		Reason:            ReasonRefund,
+		SessionInstanceID: sessionInstanceID,
+		By:                staffUID,
+		CreatedAt:         now,
+	})
+}
+
+// notifyLowCredits tells the member to top up (best effort)
+func (s *Service) notifyLowCredits(ctx context.Context, dojoID, memberUID string, balance int) {
+	title := "Running low on classes"
+	body := fmt.Sprintf("You have %d class credits left.", balance)
+	if balance == 1 {
+		body = "You have 1 class credit left."
+	}
+	if balance == 0 {
+		title = "Out of class credits"
+		body = "You have used all your class credits. Buy a new package to keep training."
+	}
+
+	_, _, err := s.fs.Collection("users").Doc(memberUID).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title": title,
+		"body":  body,
+		"type":  "credits_low",
+		"data": map[string]interface{}{
+			"balance": balance,
+		},
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("credits: low-credit notification for %s failed: %v", memberUID, err)
+	}
+}
@@ -0,0 +1,112 @@
+package packages
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	KindDropIn     = "drop_in"
+	KindPunchCard  = "punch_card"
+	maxCredits     = 100
+	maxPackageName = 100
+
+	// LowCreditsThreshold is the balance at which the member is told to top up
+	LowCreditsThreshold = 2
+
+	// Ledger reasons
+	ReasonPurchase   = "purchase"
+	ReasonCheckin    = "checkin"
+	ReasonRefund     = "refund"
+	ReasonAdjustment = "adjustment"
+	ReasonOverride   = "override"
+)
+
+// ClassPackage is a dojos/{dojoId}/packages document: a drop-in or punch card
+// members can buy. Archived packages stay readable for purchase history.
+type ClassPackage struct {
+	ID          string    `firestore:"-" json:"id"`
+	Name        string    `firestore:"name" json:"name"`
+	Kind        string    `firestore:"kind" json:"kind"` // drop_in / punch_card
+	Credits     int       `firestore:"credits" json:"credits"`
+	PriceCents  int64     `firestore:"priceCents" json:"priceCents"`
+	Currency    string    `firestore:"currency" json:"currency"`
+	Description string    `firestore:"description,omitempty" json:"description,omitempty"`
+	Active      bool      `firestore:"active" json:"active"`
+	CreatedBy   string    `firestore:"createdBy" json:"createdBy"`
+	CreatedAt   time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// PackageInput is the body of POST /v1/dojos/{dojoId}/packages
+type PackageInput struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Credits     int    `json:"credits"`
+	PriceCents  int64  `json:"priceCents"`
+	Currency    string `json:"currency,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (in *PackageInput) Trim() {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Kind = strings.ToLower(strings.TrimSpace(in.Kind))
+	in.Currency = strings.ToLower(strings.TrimSpace(in.Currency))
+	in.Description = strings.TrimSpace(in.Description)
+}
+
+// UpdatePackageInput is the body of PUT /v1/dojos/{dojoId}/packages/{packageId}
+type UpdatePackageInput struct {
+	Name        *string `json:"name,omitempty"`
+	PriceCents  *int64  `json:"priceCents,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Active      *bool   `json:"active,omitempty"`
+}
+
+// PurchaseInput is the body of POST .../packages/{packageId}/checkout
+type PurchaseInput struct {
+	SuccessURL string `json:"successUrl"`
+	CancelURL  string `json:"cancelUrl"`
+}
+
+func (in *PurchaseInput) Trim() {
+	in.SuccessURL = strings.TrimSpace(in.SuccessURL)
+	in.CancelURL = strings.TrimSpace(in.CancelURL)
+}
+
+// CreditEntry is a dojos/{dojoId}/members/{uid}/creditLedger document.
+// Check-in entries are keyed by session instance so re-recording is idempotent.
+type CreditEntry struct {
+	ID                string    `firestore:"-" json:"id"`
+	Delta             int       `firestore:"delta" json:"delta"`
+	Balance           int       `firestore:"balance" json:"balance"`
+	Reason            string    `firestore:"reason" json:"reason"`
+	PackageID         string    `firestore:"packageId,omitempty" json:"packageId,omitempty"`
+	SessionInstanceID string    `firestore:"sessionInstanceId,omitempty" json:"sessionInstanceId,omitempty"`
+	CheckoutSessionID string    `firestore:"checkoutSessionId,omitempty" json:"checkoutSessionId,omitempty"`
+	Refunded          bool      `firestore:"refunded,omitempty" json:"refunded,omitempty"`
+	Note              string    `firestore:"note,omitempty" json:"note,omitempty"`
+	By                string    `firestore:"by,omitempty" json:"by,omitempty"`
+	CreatedAt         time.Time `firestore:"createdAt" json:"createdAt"`
+}
+
+// Credits is a member's balance and recent ledger
+type Credits struct {
+	MemberUID string        `json:"memberUid"`
+	Tracked   bool          `json:"tracked"` // false = member is not on a package, check-ins are not metered
+	Balance   int           `json:"balance"`
+	Ledger    []CreditEntry `json:"ledger"`
+}
+
+// AdjustCreditsInput is the body of POST .../members/{memberUid}/credits
+type AdjustCreditsInput struct {
+	Delta int    `json:"delta"`
+	Note  string `json:"note,omitempty"`
+}
+
+func (in *AdjustCreditsInput) Trim() {
+	in.Note = strings.TrimSpace(in.Note)
+	if len(in.Note) > 500 {
+		in.Note = in.Note[:500]
+	}
+}
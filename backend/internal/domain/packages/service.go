@@ -0,0 +1,287 @@
+package packages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+)
+
+// CheckoutKind is the Stripe checkout metadata kind for package purchases
+const CheckoutKind = "class_package"
+
+type Service struct {
+	fs        *firestore.Client
+	dojoRepo  *dojo.Repo
+	stripeSvc *stripedom.Service // checkout (optional)
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo}
+}
+
+// SetStripeService enables package checkout and registers purchase fulfilment
+func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
+	s.stripeSvc = stripeSvc
+	stripeSvc.SetPaymentHandler(CheckoutKind, s.FulfilCheckout)
+}
+
+func (s *Service) packagesCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("packages")
+}
+
+func (s *Service) requireStaff(ctx context.Context, dojoID, uid string) error {
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+	return nil
+}
+
+// ListPackages lists a dojo's packages. Staff see archived ones too; members
+// only see what is on sale.
+func (s *Service) ListPackages(ctx context.Context, uid, dojoID string) ([]ClassPackage, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+			return nil, fmt.Errorf("%w: only dojo members can view packages", ErrUnauthorized)
+		}
+	}
+
+	q := s.packagesCol(dojoID).Query
+	if !isStaff {
+		q = q.Where("active", "==", true)
+	}
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	out := []ClassPackage{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list packages: %w", err)
+		}
+		var p ClassPackage
+		if err := doc.DataTo(&p); err != nil {
+			continue
+		}
+		p.ID = doc.Ref.ID
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// CreatePackage defines a new drop-in or punch card (staff only)
+func (s *Service) CreatePackage(ctx context.Context, staffUID, dojoID string, in PackageInput) (*ClassPackage, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.Kind == KindDropIn && in.Credits == 0 {
+		in.Credits = 1
+	}
+	if in.Currency == "" {
+		in.Currency = stripedom.DefaultCurrency
+		if s.stripeSvc != nil {
+			in.Currency = s.stripeSvc.Currency(ctx, dojoID)
+		}
+	}
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	p := ClassPackage{
+		Name:        in.Name,
+		Kind:        in.Kind,
+		Credits:     in.Credits,
+		PriceCents:  in.PriceCents,
+		Currency:    in.Currency,
+		Description: in.Description,
+		Active:      true,
+		CreatedBy:   staffUID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	ref, _, err := s.packagesCol(dojoID).Add(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create package: %w", err)
+	}
+	p.ID = ref.ID
+	return &p, nil
+}
+
+func (in PackageInput) validate() error {
+	if in.Name == "" || len(in.Name) > maxPackageName {
+		return fmt.Errorf("%w: name is required (max %d characters)", ErrBadRequest, maxPackageName)
+	}
+	switch in.Kind {
+	case KindDropIn:
+		if in.Credits != 1 {
+			return fmt.Errorf("%w: a drop-in is exactly 1 credit", ErrBadRequest)
+		}
+	case KindPunchCard:
+		if in.Credits < 2 || in.Credits > maxCredits {
+			return fmt.Errorf("%w: credits must be 2-%d", ErrBadRequest, maxCredits)
+		}
+	default:
+		return fmt.Errorf("%w: kind must be %s or %s", ErrBadRequest, KindDropIn, KindPunchCard)
+	}
+	if in.PriceCents <= 0 {
+		return fmt.Errorf("%w: priceCents must be positive", ErrBadRequest)
+	}
+	if len(in.Currency) != 3 {
+		return fmt.Errorf("%w: currency must be a 3-letter ISO code", ErrBadRequest)
+	}
+	return nil
+}
+
+// UpdatePackage edits or archives a package (staff only). Credits and kind are
+// fixed once created so past purchases stay meaningful.
+func (s *Service) UpdatePackage(ctx context.Context, staffUID, dojoID, packageID string, in UpdatePackageInput) (*ClassPackage, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	packageID = strings.TrimSpace(packageID)
+	if dojoID == "" || packageID == "" {
+		return nil, fmt.Errorf("%w: dojoId and packageId are required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	if _, err := s.getPackage(ctx, dojoID, packageID); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"updatedAt": time.Now().UTC()}
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" || len(name) > maxPackageName {
+			return nil, fmt.Errorf("%w: name is required (max %d characters)", ErrBadRequest, maxPackageName)
+		}
+		updates["name"] = name
+	}
+	if in.PriceCents != nil {
+		if *in.PriceCents <= 0 {
+			return nil, fmt.Errorf("%w: priceCents must be positive", ErrBadRequest)
+		}
+		updates["priceCents"] = *in.PriceCents
+	}
+	if in.Description != nil {
+		updates["description"] = strings.TrimSpace(*in.Description)
+	}
+	if in.Active != nil {
+		updates["active"] = *in.Active
+	}
+
+	if _, err := s.packagesCol(dojoID).Doc(packageID).Set(ctx, updates, firestore.MergeAll); err != nil {
+		return nil, fmt.Errorf("failed to update package: %w", err)
+	}
+	return s.getPackage(ctx, dojoID, packageID)
+}
+
+func (s *Service) getPackage(ctx context.Context, dojoID, packageID string) (*ClassPackage, error) {
+	doc, err := s.packagesCol(dojoID).Doc(packageID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: package not found", ErrNotFound)
+	}
+	var p ClassPackage
+	if err := doc.DataTo(&p); err != nil {
+		return nil, fmt.Errorf("failed to decode package: %w", err)
+	}
+	p.ID = doc.Ref.ID
+	return &p, nil
+}
+
+// CreateCheckout starts a Stripe checkout for the caller to buy a package
+func (s *Service) CreateCheckout(ctx context.Context, uid, dojoID, packageID string, in PurchaseInput) (string, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	packageID = strings.TrimSpace(packageID)
+	if dojoID == "" || packageID == "" {
+		return "", fmt.Errorf("%w: dojoId and packageId are required", ErrBadRequest)
+	}
+	if in.SuccessURL == "" || in.CancelURL == "" {
+		return "", fmt.Errorf("%w: successUrl and cancelUrl are required", ErrBadRequest)
+	}
+	if s.stripeSvc == nil {
+		return "", fmt.Errorf("%w: payments are not configured", ErrBadRequest)
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+		return "", fmt.Errorf("%w: only dojo members can buy packages", ErrUnauthorized)
+	}
+
+	p, err := s.getPackage(ctx, dojoID, packageID)
+	if err != nil {
+		return "", err
+	}
+	if !p.Active {
+		return "", fmt.Errorf("%w: package is no longer on sale", ErrBadRequest)
+	}
+
+	var email string
+	if userDoc, err := s.fs.Collection("users").Doc(uid).Get(ctx); err == nil {
+		email, _ = userDoc.Data()["email"].(string)
+	}
+
+	return s.stripeSvc.CreatePaymentCheckout(ctx, stripedom.PaymentCheckoutInput{
+		Kind:          CheckoutKind,
+		Name:          p.Name,
+		AmountCents:   p.PriceCents,
+		Currency:      p.Currency,
+		CustomerEmail: email,
+		SuccessURL:    in.SuccessURL,
+		CancelURL:     in.CancelURL,
+		Metadata: map[string]string{
+			"dojoId":    dojoID,
+			"memberUid": uid,
+			"packageId": packageID,
+		},
+	})
+}
+
+// FulfilCheckout credits the member for a paid package checkout.
+// Called from the Stripe webhook; idempotent per checkout session.
+func (s *Service) FulfilCheckout(ctx context.Context, checkoutSessionID string, metadata map[string]string) error {
+	dojoID := metadata["dojoId"]
+	memberUID := metadata["memberUid"]
+	packageID := metadata["packageId"]
+	if dojoID == "" || memberUID == "" || packageID == "" {
+		return fmt.Errorf("missing dojoId/memberUid/packageId in metadata")
+	}
+
+	p, err := s.getPackage(ctx, dojoID, packageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applyCredits(ctx, dojoID, memberUID, "purchase_"+checkoutSessionID, CreditEntry{
+		Delta:             p.Credits,
+		Reason:            ReasonPurchase,
+		PackageID:         packageID,
+		CheckoutSessionID: checkoutSessionID,
+		By:                memberUID,
+	})
+	return err
+}
@@ -0,0 +1,147 @@
+package packages
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+)
+
+// settleChunk bounds the members one settlement transaction covers: each
+// needs at most three writes, under Firestore's 500 per commit
+const settleChunk = 150
+
+// CheckinCredit is one member's line on a roll call: a check-in takes a
+// credit, any other status gives back the one taken for the class
+type CheckinCredit struct {
+	MemberUID string
+	CheckIn   bool
+}
+
+// Settlement is what SettleCheckins did
+type Settlement struct {
+	Blocked  map[string]bool // out of credits; nothing was written for them
+	Consumed []string        // a credit was taken
+	Refunded []string        // a credit was given back
+}
+
+// OnCredits reports whether a member doc is on class credits; members who
+// are not check in without SettleCheckins
+func OnCredits(memberDoc *firestore.DocumentSnapshot) bool {
+	_, tracked := balanceOf(memberDoc)
+	return tracked
+}
+
+// SettleCheckins takes and gives back the credits of a roll call in a
+// transaction per settleChunk members, reading their member docs and
+// check-in ledger entries in one GetAll each. Members out of credits are
+// Blocked unless override. A member listed twice is settled by the last
+// line. On error the returned Settlement holds what was committed, for
+// RevertCheckins.
+func (s *Service) SettleCheckins(ctx context.Context, staffUID, dojoID, sessionInstanceID string, lines []CheckinCredit, override bool) (*Settlement, error) {
+	out, balances, err := s.settle(ctx, staffUID, dojoID, sessionInstanceID, lines, override)
+	for _, uid := range out.Consumed {
+		if balance := balances[uid]; balance <= LowCreditsThreshold {
+			s.notifyLowCredits(ctx, dojoID, uid, balance)
+		}
+	}
+	return out, err
+}
+
+// RevertCheckins undoes st for the members in uids, whose attendance was not
+// written after all: credits taken are given back and credits given back
+// are taken again.
+func (s *Service) RevertCheckins(ctx context.Context, staffUID, dojoID, sessionInstanceID string, st *Settlement, uids map[string]bool) error {
+	var lines []CheckinCredit
+	for _, uid := range st.Consumed {
+		if uids[uid] {
+			lines = append(lines, CheckinCredit{MemberUID: uid})
+		}
+	}
+	for _, uid := range st.Refunded {
+		if uids[uid] {
+			lines = append(lines, CheckinCredit{MemberUID: uid, CheckIn: true})
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	_, _, err := s.settle(ctx, staffUID, dojoID, sessionInstanceID, lines, true)
+	return err
+}
+
+func (s *Service) settle(ctx context.Context, staffUID, dojoID, sessionInstanceID string, lines []CheckinCredit, override bool) (*Settlement, map[string]int, error) {
+	out := &Settlement{Blocked: map[string]bool{}}
+	balances := map[string]int{}
+
+	// last line wins; a transaction may not write a document twice
+	last := make(map[string]int, len(lines))
+	for i, line := range lines {
+		last[line.MemberUID] = i
+	}
+	unique := make([]CheckinCredit, 0, len(last))
+	for i, line := range lines {
+		if line.MemberUID != "" && last[line.MemberUID] == i {
+			unique = append(unique, line)
+		}
+	}
+
+	for start := 0; start < len(unique); start += settleChunk {
+		chunk := unique[start:min(start+settleChunk, len(unique))]
+		refs := make([]*firestore.DocumentRef, 0, 2*len(chunk))
+		for _, line := range chunk {
+			refs = append(refs,
+				s.memberRef(dojoID, line.MemberUID),
+				s.ledgerCol(dojoID, line.MemberUID).Doc(checkinEntryID(sessionInstanceID)))
+		}
+
+		var part Settlement
+		partBalances := map[string]int{}
+		err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			part = Settlement{Blocked: map[string]bool{}}
+			clear(partBalances)
+			snaps, err := tx.GetAll(refs)
+			if err != nil {
+				return err
+			}
+			for i, line := range chunk {
+				memberDoc, existing := snaps[2*i], snaps[2*i+1]
+				if line.CheckIn {
+					consumed, balance, err := consumeIn(tx, memberDoc, existing, staffUID, sessionInstanceID, override)
+					if IsErrNoCredits(err) {
+						part.Blocked[line.MemberUID] = true
+						continue
+					}
+					if err != nil {
+						return err
+					}
+					if consumed {
+						part.Consumed = append(part.Consumed, line.MemberUID)
+						partBalances[line.MemberUID] = balance
+					}
+					continue
+				}
+				refunded, err := refundIn(tx, memberDoc, existing, s.ledgerCol(dojoID, line.MemberUID).NewDoc(), staffUID, sessionInstanceID)
+				if err != nil {
+					return err
+				}
+				if refunded {
+					part.Refunded = append(part.Refunded, line.MemberUID)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return out, balances, fmt.Errorf("failed to settle credits: %w", err)
+		}
+		for uid := range part.Blocked {
+			out.Blocked[uid] = true
+		}
+		out.Consumed = append(out.Consumed, part.Consumed...)
+		out.Refunded = append(out.Refunded, part.Refunded...)
+		for uid, b := range partBalances {
+			balances[uid] = b
+		}
+	}
+	return out, balances, nil
+}
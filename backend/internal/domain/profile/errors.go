@@ -8,6 +8,8 @@ var (
 	ErrBadRequest          = errors.New("bad request")
 	ErrTooManyUpdates      = errors.New("too many updates")
 	ErrCannotDeactivateSelf = errors.New("cannot deactivate yourself")
+	ErrInvalidPhoto        = errors.New("invalid photo")
+	ErrUnavailable         = errors.New("unavailable")
 )
 
 func IsErrUnauthorized(err error) bool {
@@ -25,3 +27,11 @@ func IsErrBadRequest(err error) bool {
 func IsErrTooManyUpdates(err error) bool {
 	return errors.Is(err, ErrTooManyUpdates)
 }
+
+func IsErrInvalidPhoto(err error) bool {
+	return errors.Is(err, ErrInvalidPhoto)
+}
+
+func IsErrUnavailable(err error) bool {
+	return errors.Is(err, ErrUnavailable)
+}
@@ -11,11 +11,13 @@ type UserProfile struct {
 	Email            string                 `firestore:"email" json:"email"`
 	DisplayName      string                 `firestore:"displayName" json:"displayName"`
 	PhotoURL         string                 `firestore:"photoURL,omitempty" json:"photoURL,omitempty"`
+	ProfilePhoto     *ProfilePhoto          `firestore:"profilePhoto,omitempty" json:"profilePhoto,omitempty"` // processed upload, with read URLs
 	Role             string                 `firestore:"role,omitempty" json:"role,omitempty"`
 	Roles            []string               `firestore:"roles,omitempty" json:"roles,omitempty"`
 	Language         string                 `firestore:"language,omitempty" json:"language,omitempty"`
 	IsActive         bool                   `firestore:"isActive" json:"isActive"`
 	EmergencyContact map[string]interface{} `firestore:"emergencyContact,omitempty" json:"emergencyContact,omitempty"`
+	DateOfBirth      string                 `firestore:"dateOfBirth,omitempty" json:"dateOfBirth,omitempty"` // YYYY-MM-DD
 	CreatedAt        time.Time              `firestore:"createdAt" json:"createdAt"`
 	UpdatedAt        time.Time              `firestore:"updatedAt" json:"updatedAt"`
 }
@@ -26,6 +28,7 @@ type UpdateProfileInput struct {
 	PhotoURL         *string                `json:"photoURL,omitempty"`
 	Language         *string                `json:"language,omitempty"`
 	EmergencyContact map[string]interface{} `json:"emergencyContact,omitempty"`
+	DateOfBirth      *string                `json:"dateOfBirth,omitempty"` // YYYY-MM-DD, "" clears
 }
 
 func (in *UpdateProfileInput) Trim() {
@@ -38,6 +41,9 @@ func (in *UpdateProfileInput) Trim() {
 	if in.Language != nil {
 		*in.Language = strings.TrimSpace(*in.Language)
 	}
+	if in.DateOfBirth != nil {
+		*in.DateOfBirth = strings.TrimSpace(*in.DateOfBirth)
+	}
 }
 
 // ProtectedFields are fields that cannot be updated by the user
@@ -0,0 +1,381 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/blob"
+	"dojo-manager/backend/internal/imaging"
+)
+
+// Profile photos live in Storage under users/{uid}/profile/{photoId}/. The
+// member uploads the original straight to Storage through a signed URL,
+// then asks the API to process it: the file must really be a JPEG or PNG of
+// sensible dimensions, or it is deleted, and square JPEG thumbnails are
+// written next to it. The users doc's profilePhoto field points at the
+// result; read URLs are short-lived, so clients take them from the profile
+// each time.
+
+const (
+	// maxProfilePhotoBytes caps an upload
+	maxProfilePhotoBytes = 10 << 20
+	// profileUploadURLTTL is how long a signed upload URL stays valid
+	profileUploadURLTTL = 15 * time.Minute
+	// profilePhotoURLTTL is how long the read URLs on a profile stay valid
+	profilePhotoURLTTL = time.Hour
+
+	minPhotoSide   = 64
+	maxPhotoSide   = 8000
+	maxPhotoPixels = 40_000_000 // decoded size stays under ~160 MB
+	maxAspectRatio = 4          // longer side at most 4x the shorter one
+
+	thumbnailQuality = 85
+)
+
+// ProfilePhotoSizes are the square thumbnail sides, in pixels
+var ProfilePhotoSizes = []int{512, 256, 64}
+
+// profilePhotoExtensions maps the accepted image types to object name extensions
+var profilePhotoExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// ProfilePhoto is the users doc's profilePhoto field. Sizes maps a
+// thumbnail side ("256") to its object.
+type ProfilePhoto struct {
+	ID           string            `firestore:"id" json:"id"`
+	OriginalPath string            `firestore:"originalPath" json:"-"`
+	ContentType  string            `firestore:"contentType" json:"contentType"`
+	Width        int               `firestore:"width" json:"width"`
+	Height       int               `firestore:"height" json:"height"`
+	Sizes        map[string]string `firestore:"sizes" json:"-"`
+	ProcessedAt  time.Time         `firestore:"processedAt" json:"processedAt"`
+
+	// URLs are short-lived read URLs by size, plus "original"
+	URLs map[string]string `firestore:"-" json:"urls,omitempty"`
+}
+
+// pendingProfilePhoto is the users doc's profilePhotoUpload field, set while
+// an upload URL is out
+type pendingProfilePhoto struct {
+	ID          string    `firestore:"id"`
+	Path        string    `firestore:"path"`
+	ContentType string    `firestore:"contentType"`
+	Bytes       int64     `firestore:"bytes"`
+	CreatedAt   time.Time `firestore:"createdAt"`
+}
+
+// ProfilePhotoUploadInput is the body of POST /v1/profile/photo/upload
+type ProfilePhotoUploadInput struct {
+	ContentType string `json:"contentType"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// ProfilePhotoUpload tells the client where to PUT the image
+type ProfilePhotoUpload struct {
+	PhotoID   string            `json:"photoId"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// SetStorage sets the store that holds profile photos. Without it photos
+// cannot be uploaded, and photoURL stays whatever the client sets.
+func (s *Service) SetStorage(store blob.Store) {
+	s.store = store
+}
+
+// photoObjects is the user's part of the store
+func (s *Service) photoObjects(uid string) (blob.Store, error) {
+	if s.store == nil {
+		return nil, ErrUnavailable
+	}
+	if uid == "" || uid == "." || uid == ".." || strings.ContainsAny(uid, "/\\") {
+		return nil, fmt.Errorf("%w: invalid uid", ErrBadRequest)
+	}
+	return blob.Within(s.store, photoPrefix(uid)), nil
+}
+
+func photoPrefix(uid string) string {
+	return "users/" + uid + "/profile/"
+}
+
+func newPhotoID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate photo id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreatePhotoUpload issues a signed URL to upload a new profile photo to.
+// It only becomes the profile photo once ProcessPhoto accepts it.
+func (s *Service) CreatePhotoUpload(ctx context.Context, uid string, in ProfilePhotoUploadInput) (*ProfilePhotoUpload, error) {
+	objects, err := s.photoObjects(uid)
+	if err != nil {
+		return nil, err
+	}
+	in.ContentType = strings.ToLower(strings.TrimSpace(in.ContentType))
+	ext, ok := profilePhotoExtensions[in.ContentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: contentType must be image/jpeg or image/png", ErrBadRequest)
+	}
+	if in.Bytes <= 0 || in.Bytes > maxProfilePhotoBytes {
+		return nil, fmt.Errorf("%w: bytes must be between 1 and %d", ErrBadRequest, maxProfilePhotoBytes)
+	}
+
+	id, err := newPhotoID()
+	if err != nil {
+		return nil, err
+	}
+	pending := pendingProfilePhoto{
+		ID:          id,
+		Path:        photoPrefix(uid) + id + "/original" + ext,
+		ContentType: in.ContentType,
+		Bytes:       in.Bytes,
+		CreatedAt:   time.Now().UTC(),
+	}
+	// Storage rejects bodies larger than the declared size
+	u, err := objects.SignedURL(pending.Path, blob.URLOptions{
+		Method:      http.MethodPut,
+		Expires:     time.Now().Add(profileUploadURLTTL),
+		ContentType: in.ContentType,
+		MaxBytes:    in.Bytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign upload url: %w", err)
+	}
+	// a newer upload replaces one that was never processed
+	if _, err := s.client.Collection("users").Doc(uid).Set(ctx, map[string]interface{}{
+		"profilePhotoUpload": pending,
+	}, firestore.MergeAll); err != nil {
+		return nil, fmt.Errorf("failed to save upload: %w", err)
+	}
+	return &ProfilePhotoUpload{
+		PhotoID:   id,
+		URL:       u.URL,
+		Method:    u.Method,
+		Headers:   u.Headers,
+		ExpiresAt: u.ExpiresAt,
+	}, nil
+}
+
+// ProcessPhoto checks an uploaded photo and makes its thumbnails. A file
+// that is not a usable image is deleted and ErrInvalidPhoto returned. On
+// success the photo replaces the previous one, whose objects are deleted.
+func (s *Service) ProcessPhoto(ctx context.Context, uid, photoID string) (*ProfilePhoto, error) {
+	objects, err := s.photoObjects(uid)
+	if err != nil {
+		return nil, err
+	}
+	photoID = strings.TrimSpace(photoID)
+	userRef := s.client.Collection("users").Doc(uid)
+	doc, err := userRef.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user not found", ErrNotFound)
+	}
+	var user struct {
+		Upload *pendingProfilePhoto `firestore:"profilePhotoUpload"`
+		Photo  *ProfilePhoto        `firestore:"profilePhoto"`
+	}
+	if err := doc.DataTo(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %w", err)
+	}
+	if user.Photo != nil && user.Photo.ID == photoID {
+		return s.withPhotoURLs(objects, user.Photo), nil // already processed
+	}
+	pending := user.Upload
+	if pending == nil || pending.ID != photoID {
+		return nil, fmt.Errorf("%w: no upload with this id", ErrNotFound)
+	}
+
+	photo, err := s.processUpload(ctx, objects, uid, pending)
+	if err != nil {
+		if IsErrInvalidPhoto(err) {
+			s.deletePhotoObjects(ctx, objects, photoPrefix(uid)+pending.ID+"/")
+			if _, uerr := userRef.Update(ctx, []firestore.Update{{Path: "profilePhotoUpload", Value: firestore.Delete}}); uerr != nil {
+				log.Printf("profile: failed to clear rejected upload of %s: %v", uid, uerr)
+			}
+		}
+		return nil, err
+	}
+
+	if _, err := userRef.Update(ctx, []firestore.Update{
+		{Path: "profilePhoto", Value: photo},
+		{Path: "profilePhotoUpload", Value: firestore.Delete},
+		{Path: "updatedAt", Value: photo.ProcessedAt},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save profile photo: %w", err)
+	}
+	if user.Photo != nil {
+		s.deletePhotoObjects(ctx, objects, photoPrefix(uid)+user.Photo.ID+"/")
+	}
+	return s.withPhotoURLs(objects, photo), nil
+}
+
+// processUpload validates the uploaded original and writes its thumbnails
+func (s *Service) processUpload(ctx context.Context, objects blob.Store, uid string, pending *pendingProfilePhoto) (*ProfilePhoto, error) {
+	attrs, err := objects.Attrs(ctx, pending.Path)
+	if blob.IsErrNotExist(err) {
+		return nil, fmt.Errorf("%w: photo has not been uploaded", ErrBadRequest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check upload: %w", err)
+	}
+	if attrs.ContentType != pending.ContentType || attrs.Size <= 0 || attrs.Size > maxProfilePhotoBytes {
+		return nil, fmt.Errorf("%w: uploaded file does not match the requested image", ErrInvalidPhoto)
+	}
+
+	r, err := objects.NewReader(ctx, pending.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxProfilePhotoBytes+1))
+	r.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	img, err := decodePhoto(data, pending.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	photo := &ProfilePhoto{
+		ID:           pending.ID,
+		OriginalPath: pending.Path,
+		ContentType:  pending.ContentType,
+		Width:        img.Bounds().Dx(),
+		Height:       img.Bounds().Dy(),
+		Sizes:        map[string]string{},
+		ProcessedAt:  time.Now().UTC(),
+	}
+	for _, side := range ProfilePhotoSizes {
+		if side > min(photo.Width, photo.Height) && side != ProfilePhotoSizes[len(ProfilePhotoSizes)-1] {
+			continue // not scaled up, except to the smallest size
+		}
+		var buf bytes.Buffer
+		thumb := imaging.Flatten(imaging.Thumbnail(img, side))
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+		name := photoPrefix(uid) + pending.ID + "/" + strconv.Itoa(side) + ".jpg"
+		if err := writeObject(ctx, objects, name, buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+		photo.Sizes[strconv.Itoa(side)] = name
+	}
+	return photo, nil
+}
+
+// decodePhoto sniffs and decodes an upload, rejecting anything that is not
+// an image of the declared type with sensible dimensions. Dimensions are
+// checked before the pixels are decoded.
+func decodePhoto(data []byte, contentType string) (image.Image, error) {
+	if sniffed := http.DetectContentType(data); sniffed != contentType {
+		return nil, fmt.Errorf("%w: file is not a %s image", ErrInvalidPhoto, strings.TrimPrefix(contentType, "image/"))
+	}
+	decodeConfig, decode := jpeg.DecodeConfig, jpeg.Decode
+	if contentType == "image/png" {
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: image cannot be read", ErrInvalidPhoto)
+	}
+	short, long := min(cfg.Width, cfg.Height), max(cfg.Width, cfg.Height)
+	switch {
+	case short < minPhotoSide:
+		return nil, fmt.Errorf("%w: image must be at least %dx%d pixels", ErrInvalidPhoto, minPhotoSide, minPhotoSide)
+	case long > maxPhotoSide || cfg.Width*cfg.Height > maxPhotoPixels:
+		return nil, fmt.Errorf("%w: image must be at most %d pixels on a side", ErrInvalidPhoto, maxPhotoSide)
+	case long > short*maxAspectRatio:
+		return nil, fmt.Errorf("%w: image is too narrow for a profile photo", ErrInvalidPhoto)
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: image is damaged", ErrInvalidPhoto)
+	}
+	return img, nil
+}
+
+func writeObject(ctx context.Context, objects blob.Store, name string, data []byte) error {
+	w, err := objects.NewWriter(ctx, name, blob.WriteOptions{ContentType: "image/jpeg"})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort(err)
+		return err
+	}
+	return w.Close()
+}
+
+// deletePhotoObjects removes a photo's original and thumbnails (best effort)
+func (s *Service) deletePhotoObjects(ctx context.Context, objects blob.Store, prefix string) {
+	err := objects.List(ctx, prefix, func(obj *blob.Attrs) error {
+		if err := objects.Delete(ctx, obj.Name); err != nil {
+			log.Printf("profile: failed to delete %s: %v", obj.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("profile: failed to list %s: %v", prefix, err)
+	}
+}
+
+// withPhotoURLs signs read URLs for the photo's sizes and original
+func (s *Service) withPhotoURLs(objects blob.Store, p *ProfilePhoto) *ProfilePhoto {
+	out := *p
+	out.URLs = map[string]string{}
+	expires := time.Now().Add(profilePhotoURLTTL)
+	sign := func(key, name string) {
+		u, err := objects.SignedURL(name, blob.URLOptions{Method: http.MethodGet, Expires: expires})
+		if err != nil {
+			log.Printf("profile: failed to sign %s: %v", name, err)
+			return
+		}
+		out.URLs[key] = u.URL
+	}
+	for size, name := range p.Sizes {
+		sign(size, name)
+	}
+	sign("original", p.OriginalPath)
+	return &out
+}
+
+// DeletePhoto removes the profile photo and its objects
+func (s *Service) DeletePhoto(ctx context.Context, uid string) error {
+	objects, err := s.photoObjects(uid)
+	if err != nil {
+		return err
+	}
+	userRef := s.client.Collection("users").Doc(uid)
+	if _, err := userRef.Update(ctx, []firestore.Update{
+		{Path: "profilePhoto", Value: firestore.Delete},
+		{Path: "profilePhotoUpload", Value: firestore.Delete},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+	}); err != nil {
+		return fmt.Errorf("failed to delete profile photo: %w", err)
+	}
+	s.deletePhotoObjects(ctx, objects, photoPrefix(uid))
+	return nil
+}
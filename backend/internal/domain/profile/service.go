@@ -7,17 +7,27 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/v4/auth"
+
+	"dojo-manager/backend/internal/blob"
+	"dojo-manager/backend/internal/domain/members"
 )
 
 type Service struct {
 	client     *firestore.Client
 	authClient *auth.Client
+	membersSvc *members.Service // copies display fields onto member docs (optional)
+	store      blob.Store       // profile photos (optional)
 }
 
 func NewService(client *firestore.Client, authClient *auth.Client) *Service {
 	return &Service{client: client, authClient: authClient}
 }
 
+// SetMembersService keeps the user fields copied onto member docs current
+func (s *Service) SetMembersService(m *members.Service) {
+	s.membersSvc = m
+}
+
 // GetProfile gets a user's profile
 func (s *Service) GetProfile(ctx context.Context, uid string) (*UserProfile, error) {
 	if uid == "" {
@@ -34,6 +44,11 @@ func (s *Service) GetProfile(ctx context.Context, uid string) (*UserProfile, err
 		return nil, fmt.Errorf("failed to decode profile: %w", err)
 	}
 	profile.UID = uid
+	if profile.ProfilePhoto != nil {
+		if objects, err := s.photoObjects(uid); err == nil {
+			profile.ProfilePhoto = s.withPhotoURLs(objects, profile.ProfilePhoto)
+		}
+	}
 
 	return &profile, nil
 }
@@ -76,6 +91,15 @@ func (s *Service) UpdateProfile(ctx context.Context, uid string, input UpdatePro
 	if input.Language != nil {
 		updates["language"] = *input.Language
 	}
+	if input.DateOfBirth != nil {
+		if dob := *input.DateOfBirth; dob != "" {
+			t, err := time.Parse("2006-01-02", dob)
+			if err != nil || t.After(now) || t.Year() < 1900 {
+				return fmt.Errorf("%w: dateOfBirth must be a past date (YYYY-MM-DD)", ErrBadRequest)
+			}
+		}
+		updates["dateOfBirth"] = *input.DateOfBirth
+	}
 
 	// Update Firestore
 	_, err := s.client.Collection("users").Doc(uid).Set(ctx, updates, firestore.MergeAll)
@@ -83,6 +107,11 @@ func (s *Service) UpdateProfile(ctx context.Context, uid string, input UpdatePro
 		return fmt.Errorf("failed to update profile: %w", err)
 	}
 
+	// Refresh the copies on the user's member docs
+	if s.membersSvc != nil && (input.DisplayName != nil || input.PhotoURL != nil || input.EmergencyContact != nil || input.DateOfBirth != nil) {
+		s.membersSvc.SyncUserFieldsInBackground(uid)
+	}
+
 	// Update Firebase Auth if needed
 	if input.DisplayName != nil || input.PhotoURL != nil {
 		authUpdate := &auth.UserToUpdate{}
@@ -0,0 +1,101 @@
+package pushtokens
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// PruneResult summarizes a PruneStale run
+type PruneResult struct {
+	UsersScanned  int  `json:"usersScanned"`
+	UsersUpdated  int  `json:"usersUpdated"`
+	TokensRemoved int  `json:"tokensRemoved"`
+	TokensStamped int  `json:"tokensStamped"` // tokens seen for the first time
+	Partial       bool `json:"partial"`       // deadline hit; the next run continues
+}
+
+// PruneStale removes tokens not registered or delivered to for StaleAfter.
+// Tokens without a seen time (added before it was tracked, or written by the
+// app directly) are stamped with now, which starts their clock. Meant to run
+// daily from Cloud Scheduler.
+func (s *Service) PruneStale(ctx context.Context, now time.Time) (*PruneResult, error) {
+	cutoff := now.Add(-StaleAfter)
+	res := &PruneResult{}
+
+	iter := s.fs.Collection("users").Select("fcmTokens", "fcmTokenSeenAt").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		res.UsersScanned++
+
+		data := doc.Data()
+		tokens, _ := data["fcmTokens"].([]interface{})
+		seenAt, _ := data["fcmTokenSeenAt"].(map[string]interface{})
+		if len(tokens) == 0 && len(seenAt) == 0 {
+			continue
+		}
+
+		var stale []interface{}
+		seen := map[string]interface{}{}
+		current := map[string]bool{}
+		for _, t := range tokens {
+			tok, ok := t.(string)
+			if !ok || tok == "" {
+				continue
+			}
+			current[tok] = true
+			at, ok := seenAt[tok].(time.Time)
+			switch {
+			case !ok:
+				seen[tok] = now
+				res.TokensStamped++
+			case at.Before(cutoff):
+				stale = append(stale, tok)
+				seen[tok] = firestore.Delete
+			}
+		}
+		// entries for tokens the app already removed
+		for tok := range seenAt {
+			if !current[tok] {
+				seen[tok] = firestore.Delete
+			}
+		}
+		if len(seen) == 0 {
+			continue
+		}
+
+		fields := map[string]interface{}{"fcmTokenSeenAt": seen}
+		if len(stale) > 0 {
+			fields["fcmTokens"] = firestore.ArrayRemove(stale...)
+		}
+		if _, err := doc.Ref.Set(ctx, fields, firestore.MergeAll); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			log.Printf("fcm token prune: failed to update %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		res.UsersUpdated++
+		res.TokensRemoved += len(stale)
+	}
+
+	log.Printf("fcm token prune: %d users scanned, %d updated, %d tokens removed, %d stamped (partial=%v)",
+		res.UsersScanned, res.UsersUpdated, res.TokensRemoved, res.TokensStamped, res.Partial)
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package pushtokens
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/messaging"
+)
+
+// FCM tokens live on users/{uid}.fcmTokens (an array the app appends to).
+// users/{uid}.fcmTokenSeenAt maps each token to the last time it was
+// registered or delivered to, so tokens of uninstalled apps can be pruned.
+
+// StaleAfter is how long a token may go unused before PruneStale drops it.
+// FCM itself expires tokens that have not connected for 270 days.
+const StaleAfter = 270 * 24 * time.Hour
+
+type Service struct {
+	fs *firestore.Client
+}
+
+func NewService(fs *firestore.Client) *Service {
+	return &Service{fs: fs}
+}
+
+// RecordResults handles a multicast response for one user's tokens: tokens
+// FCM rejects as unregistered or invalid are removed, delivered ones are
+// marked as seen. tokens must be in the order they were sent. Invalid
+// argument only counts against a token when another token in the batch got
+// through; otherwise the message itself may be at fault.
+func (s *Service) RecordResults(ctx context.Context, uid string, tokens []string, resp *messaging.BatchResponse) (removed int, err error) {
+	if resp == nil || uid == "" {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+	payloadOK := resp.SuccessCount > 0
+	var dead []interface{}
+	seen := map[string]interface{}{}
+	for i, r := range resp.Responses {
+		if i >= len(tokens) {
+			break
+		}
+		switch {
+		case r.Success:
+			seen[tokens[i]] = now
+		case isDeadToken(r.Error, payloadOK):
+			dead = append(dead, tokens[i])
+			seen[tokens[i]] = firestore.Delete
+		}
+	}
+	if len(seen) == 0 {
+		return 0, nil
+	}
+
+	fields := map[string]interface{}{"fcmTokenSeenAt": seen}
+	if len(dead) > 0 {
+		fields["fcmTokens"] = firestore.ArrayRemove(dead...)
+	}
+	if _, err := s.fs.Collection("users").Doc(uid).Set(ctx, fields, firestore.MergeAll); err != nil {
+		return 0, fmt.Errorf("failed to update fcm tokens of %s: %w", uid, err)
+	}
+	return len(dead), nil
+}
+
+// isDeadToken reports whether FCM will never accept the token again. A
+// sender mismatch means the token belongs to another Firebase project.
+func isDeadToken(err error, payloadOK bool) bool {
+	switch {
+	case err == nil:
+		return false
+	case messaging.IsUnregistered(err), messaging.IsSenderIDMismatch(err):
+		return true
+	default:
+		return payloadOK && messaging.IsInvalidArgument(err)
+	}
+}
@@ -0,0 +1,439 @@
+package ranks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Dual-control dojos switch on requireApproval in
+// dojos/{dojoId}/settings/promotions. Coaches and staff then propose
+// promotions at dojos/{dojoId}/promotionProposals, and only an owner's
+// approval changes the member's rank. Owners keep promoting directly.
+
+// Proposal statuses
+const (
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	ProposalRejected = "rejected"
+)
+
+var ValidProposalStatuses = []string{ProposalPending, ProposalApproved, ProposalRejected}
+
+const (
+	maxProposalNotes = 1000
+	maxProposals     = 200
+)
+
+// PromotionSettings is dojos/{dojoId}/settings/promotions
+type PromotionSettings struct {
+	RequireApproval bool      `firestore:"requireApproval" json:"requireApproval"`
+	UpdatedAt       time.Time `firestore:"updatedAt" json:"updatedAt"`
+	UpdatedBy       string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// PromotionProposal is a promotion waiting for (or decided by) an owner
+type PromotionProposal struct {
+	ID             string     `firestore:"-" json:"id"`
+	MemberUID      string     `firestore:"memberUid" json:"memberUid"`
+	CurrentBelt    string     `firestore:"currentBelt" json:"currentBelt"` // when proposed
+	CurrentStripes int        `firestore:"currentStripes" json:"currentStripes"`
+	BeltRank       string     `firestore:"beltRank" json:"beltRank"`
+	Stripes        int        `firestore:"stripes" json:"stripes"`
+	Notes          string     `firestore:"notes,omitempty" json:"notes,omitempty"`
+	Status         string     `firestore:"status" json:"status"`
+	ProposedBy     string     `firestore:"proposedBy" json:"proposedBy"`
+	DecidedBy      string     `firestore:"decidedBy,omitempty" json:"decidedBy,omitempty"`
+	DecisionNote   string     `firestore:"decisionNote,omitempty" json:"decisionNote,omitempty"`
+	RankHistoryID  string     `firestore:"rankHistoryId,omitempty" json:"rankHistoryId,omitempty"` // once approved
+	CreatedAt      time.Time  `firestore:"createdAt" json:"createdAt"`
+	DecidedAt      *time.Time `firestore:"decidedAt,omitempty" json:"decidedAt,omitempty"`
+}
+
+// ProposePromotionInput proposes a new belt and stripe count for a member
+type ProposePromotionInput struct {
+	MemberUID string `json:"memberUid"`
+	BeltRank  string `json:"beltRank"`
+	Stripes   int    `json:"stripes,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+func (in *ProposePromotionInput) Trim() {
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	in.BeltRank = strings.TrimSpace(in.BeltRank)
+	in.Notes = strings.TrimSpace(in.Notes)
+}
+
+// DecideProposalInput is the owner's optional note on approval or rejection
+type DecideProposalInput struct {
+	Note string `json:"note,omitempty"`
+}
+
+func (r *Repo) promotionSettingsRef(dojoID string) *firestore.DocumentRef {
+	return r.client.Collection("dojos").Doc(dojoID).Collection("settings").Doc("promotions")
+}
+
+func (r *Repo) proposalsCol(dojoID string) *firestore.CollectionRef {
+	return r.client.Collection("dojos").Doc(dojoID).Collection("promotionProposals")
+}
+
+// promotionSettings loads the dojo's settings (defaults when unset)
+func (s *Service) promotionSettings(ctx context.Context, dojoID string) (*PromotionSettings, error) {
+	doc, err := s.repo.promotionSettingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load promotion settings: %w", err)
+	}
+	ps := &PromotionSettings{}
+	if doc.Exists() {
+		if err := doc.DataTo(ps); err != nil {
+			return nil, fmt.Errorf("failed to decode promotion settings: %w", err)
+		}
+	}
+	return ps, nil
+}
+
+func (s *Service) isOwner(ctx context.Context, dojoID, uid string) (bool, error) {
+	d, err := s.dojoRepo.GetDojo(ctx, dojoID)
+	if err != nil {
+		return false, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	return d.IsOwner(uid), nil
+}
+
+// requireDirectPromotion stops non-owners from changing ranks directly in
+// a dojo that requires approval
+func (s *Service) requireDirectPromotion(ctx context.Context, dojoID, uid string) error {
+	ps, err := s.promotionSettings(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	if !ps.RequireApproval {
+		return nil
+	}
+	owner, err := s.isOwner(ctx, dojoID, uid)
+	if err != nil {
+		return err
+	}
+	if !owner {
+		return fmt.Errorf("%w: promotions in this dojo need the owner's approval; propose the promotion instead", ErrApprovalRequired)
+	}
+	return nil
+}
+
+// GetPromotionSettings returns whether promotions need approval (staff)
+func (s *Service) GetPromotionSettings(ctx context.Context, uid, dojoID string) (*PromotionSettings, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, uid); err != nil {
+		return nil, err
+	}
+	return s.promotionSettings(ctx, dojoID)
+}
+
+// UpdatePromotionSettings turns the approval workflow on or off (owner)
+func (s *Service) UpdatePromotionSettings(ctx context.Context, uid, dojoID string, requireApproval bool) (*PromotionSettings, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	owner, err := s.isOwner(ctx, dojoID, uid)
+	if err != nil {
+		return nil, err
+	}
+	if !owner {
+		return nil, fmt.Errorf("%w: only the dojo owner can change promotion approval", ErrUnauthorized)
+	}
+	ps := &PromotionSettings{RequireApproval: requireApproval, UpdatedAt: time.Now().UTC(), UpdatedBy: uid}
+	if _, err := s.repo.promotionSettingsRef(dojoID).Set(ctx, ps); err != nil {
+		return nil, fmt.Errorf("failed to save promotion settings: %w", err)
+	}
+	return ps, nil
+}
+
+// ProposePromotion records a promotion for an owner to approve (staff).
+// A member has at most one pending proposal.
+func (s *Service) ProposePromotion(ctx context.Context, staffUID, dojoID string, in ProposePromotionInput) (*PromotionProposal, error) {
+	in.Trim()
+	if dojoID == "" || in.MemberUID == "" || !IsValidBelt(in.BeltRank) {
+		return nil, fmt.Errorf("%w: dojoId, memberUid and a valid beltRank are required", ErrBadRequest)
+	}
+	if in.Stripes < 0 || in.Stripes > 4 {
+		return nil, fmt.Errorf("%w: stripes must be between 0 and 4", ErrBadRequest)
+	}
+	if len(in.Notes) > maxProposalNotes {
+		return nil, fmt.Errorf("%w: notes are limited to %d characters", ErrBadRequest, maxProposalNotes)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	memberDoc, err := s.repo.memberRef(dojoID, in.MemberUID).Get(ctx)
+	if err != nil && memberDoc == nil {
+		return nil, fmt.Errorf("failed to load member: %w", err)
+	}
+	if !memberDoc.Exists() {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	currentBelt, currentStripes, err := s.repo.GetMemberRank(ctx, dojoID, in.MemberUID)
+	if err != nil {
+		return nil, err
+	}
+	if currentBelt == "" {
+		currentBelt = "white"
+	}
+	if currentBelt == in.BeltRank && currentStripes == in.Stripes {
+		return nil, fmt.Errorf("%w: the member already holds this rank", ErrBadRequest)
+	}
+
+	pending, err := s.repo.proposalsCol(dojoID).
+		Where("memberUid", "==", in.MemberUID).
+		Where("status", "==", ProposalPending).
+		Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pending proposals: %w", err)
+	}
+	if len(pending) > 0 {
+		return nil, fmt.Errorf("%w: this member already has a pending proposal", ErrConflict)
+	}
+
+	p := PromotionProposal{
+		MemberUID:      in.MemberUID,
+		CurrentBelt:    currentBelt,
+		CurrentStripes: currentStripes,
+		BeltRank:       in.BeltRank,
+		Stripes:        in.Stripes,
+		Notes:          in.Notes,
+		Status:         ProposalPending,
+		ProposedBy:     staffUID,
+		CreatedAt:      time.Now().UTC(),
+	}
+	ref := s.repo.proposalsCol(dojoID).NewDoc()
+	if _, err := ref.Set(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to save proposal: %w", err)
+	}
+	p.ID = ref.ID
+
+	if d, err := s.dojoRepo.GetDojo(ctx, dojoID); err == nil {
+		owners := map[string]bool{d.OwnerUID: true, d.CreatedBy: true}
+		for _, uid := range d.OwnerIds {
+			owners[uid] = true
+		}
+		for uid := range owners {
+			if uid != "" && uid != staffUID {
+				s.notifyProposal(ctx, uid, dojoID, &p, "promotion_proposal",
+					"Promotion awaiting approval",
+					fmt.Sprintf("A promotion to %s (%d stripes) was proposed and needs your approval.", p.BeltRank, p.Stripes))
+			}
+		}
+	}
+	return &p, nil
+}
+
+// ListProposals returns proposals newest first, optionally by status (staff)
+func (s *Service) ListProposals(ctx context.Context, uid, dojoID, status string) ([]PromotionProposal, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, uid); err != nil {
+		return nil, err
+	}
+
+	q := s.repo.proposalsCol(dojoID).Query
+	if status != "" {
+		if !slices.Contains(ValidProposalStatuses, status) {
+			return nil, fmt.Errorf("%w: status must be pending, approved or rejected", ErrBadRequest)
+		}
+		q = q.Where("status", "==", status)
+	}
+	iter := q.OrderBy("createdAt", firestore.Desc).Limit(maxProposals).Documents(ctx)
+	defer iter.Stop()
+
+	out := []PromotionProposal{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list proposals: %w", err)
+		}
+		var p PromotionProposal
+		if err := doc.DataTo(&p); err != nil {
+			continue
+		}
+		p.ID = doc.Ref.ID
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// ApproveProposal applies a pending promotion and notifies the member and
+// the proposer (owner). The proposal, the member's rank and the history
+// entry change in one transaction.
+func (s *Service) ApproveProposal(ctx context.Context, ownerUID, dojoID, proposalID string, in DecideProposalInput) (*PromotionProposal, error) {
+	if err := s.requireOwnerDecision(ctx, ownerUID, dojoID, proposalID, in); err != nil {
+		return nil, err
+	}
+
+	ref := s.repo.proposalsCol(dojoID).Doc(proposalID)
+	var p PromotionProposal
+	err := s.repo.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to load proposal: %w", err)
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: proposal not found", ErrNotFound)
+		}
+		if err := doc.DataTo(&p); err != nil {
+			return fmt.Errorf("failed to decode proposal: %w", err)
+		}
+		if p.Status != ProposalPending {
+			return fmt.Errorf("%w: proposal is already %s", ErrConflict, p.Status)
+		}
+
+		memberRef := s.repo.memberRef(dojoID, p.MemberUID)
+		memberDoc, err := tx.Get(memberRef)
+		if err != nil && memberDoc == nil {
+			return fmt.Errorf("failed to load member: %w", err)
+		}
+		if !memberDoc.Exists() {
+			return fmt.Errorf("%w: member is no longer in the dojo", ErrNotFound)
+		}
+		// the rank may have changed since the proposal; history records the actual one
+		prevBelt, _ := memberDoc.Data()["beltRank"].(string)
+		if prevBelt == "" {
+			prevBelt = "white"
+		}
+		prevStripes, _ := memberDoc.Data()["stripes"].(int64)
+
+		now := time.Now().UTC()
+		historyRef := s.repo.rankHistoryCol(dojoID, p.MemberUID).NewDoc()
+		if err := tx.Set(memberRef, map[string]interface{}{
+			"beltRank":        p.BeltRank,
+			"stripes":         p.Stripes,
+			"lastPromotionAt": now,
+			"lastPromotedBy":  p.ProposedBy,
+			"updatedAt":       now,
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+		if err := tx.Set(historyRef, map[string]interface{}{
+			"previousBelt":    prevBelt,
+			"previousStripes": prevStripes,
+			"newBelt":         p.BeltRank,
+			"newStripes":      p.Stripes,
+			"promotedBy":      p.ProposedBy,
+			"approvedBy":      ownerUID,
+			"proposalId":      proposalID,
+			"notes":           p.Notes,
+			"type":            HistoryPromotion,
+			"createdAt":       now,
+		}); err != nil {
+			return err
+		}
+
+		p.Status = ProposalApproved
+		p.DecidedBy = ownerUID
+		p.DecisionNote = in.Note
+		p.DecidedAt = &now
+		p.RankHistoryID = historyRef.ID
+		return tx.Set(ref, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.ID = proposalID
+
+	s.notifyProposal(ctx, p.MemberUID, dojoID, &p, "promotion",
+		"Congratulations on your promotion!",
+		fmt.Sprintf("You have been promoted to %s (%d stripes).", p.BeltRank, p.Stripes))
+	if p.ProposedBy != ownerUID {
+		s.notifyProposal(ctx, p.ProposedBy, dojoID, &p, "promotion_proposal_approved",
+			"Promotion approved",
+			fmt.Sprintf("Your proposed promotion to %s was approved.", p.BeltRank))
+	}
+	return &p, nil
+}
+
+// RejectProposal declines a pending promotion and tells the proposer (owner)
+func (s *Service) RejectProposal(ctx context.Context, ownerUID, dojoID, proposalID string, in DecideProposalInput) (*PromotionProposal, error) {
+	if err := s.requireOwnerDecision(ctx, ownerUID, dojoID, proposalID, in); err != nil {
+		return nil, err
+	}
+
+	ref := s.repo.proposalsCol(dojoID).Doc(proposalID)
+	var p PromotionProposal
+	err := s.repo.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to load proposal: %w", err)
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: proposal not found", ErrNotFound)
+		}
+		if err := doc.DataTo(&p); err != nil {
+			return fmt.Errorf("failed to decode proposal: %w", err)
+		}
+		if p.Status != ProposalPending {
+			return fmt.Errorf("%w: proposal is already %s", ErrConflict, p.Status)
+		}
+		now := time.Now().UTC()
+		p.Status = ProposalRejected
+		p.DecidedBy = ownerUID
+		p.DecisionNote = in.Note
+		p.DecidedAt = &now
+		return tx.Set(ref, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.ID = proposalID
+
+	if p.ProposedBy != ownerUID {
+		body := fmt.Sprintf("Your proposed promotion to %s was not approved.", p.BeltRank)
+		if in.Note != "" {
+			body += " " + in.Note
+		}
+		s.notifyProposal(ctx, p.ProposedBy, dojoID, &p, "promotion_proposal_rejected", "Promotion not approved", body)
+	}
+	return &p, nil
+}
+
+func (s *Service) requireOwnerDecision(ctx context.Context, uid, dojoID, proposalID string, in DecideProposalInput) error {
+	if dojoID == "" || proposalID == "" {
+		return fmt.Errorf("%w: dojoId and proposalId are required", ErrBadRequest)
+	}
+	if len(in.Note) > maxProposalNotes {
+		return fmt.Errorf("%w: note is limited to %d characters", ErrBadRequest, maxProposalNotes)
+	}
+	owner, err := s.isOwner(ctx, dojoID, uid)
+	if err != nil {
+		return err
+	}
+	if !owner {
+		return fmt.Errorf("%w: only the dojo owner can decide on promotions", ErrUnauthorized)
+	}
+	return nil
+}
+
+func (s *Service) notifyProposal(ctx context.Context, uid, dojoID string, p *PromotionProposal, kind, title, body string) {
+	_, _, err := s.repo.client.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title":     title,
+		"body":      body,
+		"type":      kind,
+		"data":      map[string]interface{}{"proposalId": p.ID, "memberUid": p.MemberUID},
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("promotion proposal: failed to notify %s: %v", uid, err)
+	}
+}
@@ -0,0 +1,551 @@
+package ranks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Confirming a grading creates a ceremony at dojos/{dojoId}/ceremonies: the
+// promotions are applied right away, each rank history entry points back to
+// the ceremony, and the promoted members plus their family (payer and
+// siblings) are invited to RSVP. Photos attached afterwards are linked to
+// the history entries of the members they show.
+
+// Ceremony statuses
+const (
+	CeremonyScheduled = "scheduled"
+	CeremonyCancelled = "cancelled"
+)
+
+// RSVP responses
+const (
+	RSVPYes   = "yes"
+	RSVPNo    = "no"
+	RSVPMaybe = "maybe"
+)
+
+var ValidRSVPResponses = []string{RSVPYes, RSVPNo, RSVPMaybe}
+
+const (
+	maxCeremonyPromotions = 100
+	maxCeremonyPhotos     = 100
+	maxCeremonyGuests     = 10
+	maxCeremonyText       = 1000
+)
+
+// Ceremony is a belt promotion ceremony
+type Ceremony struct {
+	ID         string              `firestore:"-" json:"id"`
+	Title      string              `firestore:"title" json:"title"`
+	StartsAt   time.Time           `firestore:"startsAt" json:"startsAt"`
+	Location   string              `firestore:"location,omitempty" json:"location,omitempty"`
+	Notes      string              `firestore:"notes,omitempty" json:"notes,omitempty"`
+	Status     string              `firestore:"status" json:"status"`
+	Promotions []CeremonyPromotion `firestore:"promotions" json:"promotions"`
+
+	// InviteeUIDs is everyone who may RSVP: promoted members and their family
+	InviteeUIDs []string                `firestore:"inviteeUids" json:"inviteeUids"`
+	RSVPs       map[string]CeremonyRSVP `firestore:"rsvps" json:"rsvps,omitempty"`
+	Photos      []CeremonyPhoto         `firestore:"photos" json:"photos"`
+
+	CreatedBy string    `firestore:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// CeremonyPromotion is one promotion confirmed with the ceremony
+type CeremonyPromotion struct {
+	MemberUID       string `firestore:"memberUid" json:"memberUid"`
+	PreviousBelt    string `firestore:"previousBelt" json:"previousBelt"`
+	PreviousStripes int    `firestore:"previousStripes" json:"previousStripes"`
+	NewBelt         string `firestore:"newBelt" json:"newBelt"`
+	NewStripes      int    `firestore:"newStripes" json:"newStripes"`
+	HistoryID       string `firestore:"historyId" json:"historyId"`
+}
+
+// CeremonyRSVP is an invitee's answer
+type CeremonyRSVP struct {
+	Response    string    `firestore:"response" json:"response"`
+	Guests      int       `firestore:"guests" json:"guests"` // besides the invitee
+	RespondedAt time.Time `firestore:"respondedAt" json:"respondedAt"`
+}
+
+// CeremonyPhoto is an uploaded photo of the ceremony
+type CeremonyPhoto struct {
+	URL        string    `firestore:"url" json:"url"`
+	Caption    string    `firestore:"caption,omitempty" json:"caption,omitempty"`
+	MemberUIDs []string  `firestore:"memberUids" json:"memberUids"` // who is on it; empty = everyone
+	UploadedBy string    `firestore:"uploadedBy" json:"uploadedBy"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+}
+
+// RSVPSummary counts the answers so far
+type RSVPSummary struct {
+	Yes     int `json:"yes"`
+	No      int `json:"no"`
+	Maybe   int `json:"maybe"`
+	Pending int `json:"pending"`
+	Guests  int `json:"guests"` // extra guests of yes answers
+}
+
+// CeremonyView is a ceremony as returned to a viewer. Invitees only see
+// their own RSVP; staff see all of them.
+type CeremonyView struct {
+	Ceremony
+	Summary RSVPSummary `json:"summary"`
+}
+
+// CeremonyPromotionInput is one promotion of a confirmed grading
+type CeremonyPromotionInput struct {
+	MemberUID string `json:"memberUid"`
+	BeltRank  string `json:"beltRank"`
+	Stripes   int    `json:"stripes,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+// CreateCeremonyInput confirms a grading and schedules its ceremony
+type CreateCeremonyInput struct {
+	Title      string                   `json:"title"`
+	StartsAt   time.Time                `json:"startsAt"`
+	Location   string                   `json:"location,omitempty"`
+	Notes      string                   `json:"notes,omitempty"`
+	Promotions []CeremonyPromotionInput `json:"promotions"`
+}
+
+func (in *CreateCeremonyInput) Trim() {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Location = strings.TrimSpace(in.Location)
+	in.Notes = strings.TrimSpace(in.Notes)
+	for i := range in.Promotions {
+		in.Promotions[i].MemberUID = strings.TrimSpace(in.Promotions[i].MemberUID)
+		in.Promotions[i].BeltRank = strings.TrimSpace(in.Promotions[i].BeltRank)
+		in.Promotions[i].Notes = strings.TrimSpace(in.Promotions[i].Notes)
+	}
+}
+
+// RSVPInput is an invitee's answer
+type RSVPInput struct {
+	Response string `json:"response"`
+	Guests   int    `json:"guests,omitempty"`
+}
+
+// AddCeremonyPhotoInput attaches an uploaded photo
+type AddCeremonyPhotoInput struct {
+	URL        string   `json:"url"`
+	Caption    string   `json:"caption,omitempty"`
+	MemberUIDs []string `json:"memberUids,omitempty"`
+}
+
+func (r *Repo) ceremoniesCol(dojoID string) *firestore.CollectionRef {
+	return r.client.Collection("dojos").Doc(dojoID).Collection("ceremonies")
+}
+
+func (s *Service) requireStaff(ctx context.Context, dojoID, uid string) error {
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+	return nil
+}
+
+// CreateCeremony applies the promotions of a confirmed grading, schedules
+// the ceremony and invites the promoted members and their families (staff)
+func (s *Service) CreateCeremony(ctx context.Context, staffUID, dojoID string, in CreateCeremonyInput) (*Ceremony, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" || in.Title == "" || in.StartsAt.IsZero() {
+		return nil, fmt.Errorf("%w: dojoId, title and startsAt are required", ErrBadRequest)
+	}
+	if len(in.Notes) > maxCeremonyText || len(in.Location) > maxCeremonyText {
+		return nil, fmt.Errorf("%w: location and notes are limited to %d characters", ErrBadRequest, maxCeremonyText)
+	}
+	if len(in.Promotions) == 0 || len(in.Promotions) > maxCeremonyPromotions {
+		return nil, fmt.Errorf("%w: a ceremony needs 1 to %d promotions", ErrBadRequest, maxCeremonyPromotions)
+	}
+	seen := map[string]bool{}
+	for _, p := range in.Promotions {
+		if p.MemberUID == "" || !IsValidBelt(p.BeltRank) {
+			return nil, fmt.Errorf("%w: each promotion needs a memberUid and a valid beltRank", ErrBadRequest)
+		}
+		if p.Stripes < 0 || p.Stripes > 4 {
+			return nil, fmt.Errorf("%w: stripes must be between 0 and 4", ErrBadRequest)
+		}
+		if seen[p.MemberUID] {
+			return nil, fmt.Errorf("%w: %s is promoted twice", ErrBadRequest, p.MemberUID)
+		}
+		seen[p.MemberUID] = true
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	if err := s.requireDirectPromotion(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	refs := make([]*firestore.DocumentRef, len(in.Promotions))
+	for i, p := range in.Promotions {
+		refs[i] = s.repo.memberRef(dojoID, p.MemberUID)
+	}
+	memberDocs, err := s.repo.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load members: %w", err)
+	}
+
+	now := time.Now().UTC()
+	ref := s.repo.ceremoniesCol(dojoID).NewDoc()
+	c := Ceremony{
+		Title:      in.Title,
+		StartsAt:   in.StartsAt.UTC(),
+		Location:   in.Location,
+		Notes:      in.Notes,
+		Status:     CeremonyScheduled,
+		Promotions: make([]CeremonyPromotion, 0, len(in.Promotions)),
+		RSVPs:      map[string]CeremonyRSVP{},
+		Photos:     []CeremonyPhoto{},
+		CreatedBy:  staffUID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	batch := s.repo.client.Batch()
+	familyIDs := map[string]bool{}
+	for i, p := range in.Promotions {
+		doc := memberDocs[i]
+		if !doc.Exists() {
+			return nil, fmt.Errorf("%w: member %s not found", ErrNotFound, p.MemberUID)
+		}
+		data := doc.Data()
+		prevBelt, _ := data["beltRank"].(string)
+		if prevBelt == "" {
+			prevBelt = "white"
+		}
+		prevStripes, _ := data["stripes"].(int64)
+		if familyID, _ := data["familyId"].(string); familyID != "" {
+			familyIDs[familyID] = true
+		}
+
+		historyRef := s.repo.rankHistoryCol(dojoID, p.MemberUID).NewDoc()
+		batch.Set(doc.Ref, map[string]interface{}{
+			"beltRank":        p.BeltRank,
+			"stripes":         p.Stripes,
+			"lastPromotionAt": now,
+			"lastPromotedBy":  staffUID,
+			"updatedAt":       now,
+		}, firestore.MergeAll)
+		batch.Set(historyRef, map[string]interface{}{
+			"previousBelt":    prevBelt,
+			"previousStripes": prevStripes,
+			"newBelt":         p.BeltRank,
+			"newStripes":      p.Stripes,
+			"promotedBy":      staffUID,
+			"notes":           p.Notes,
+			"type":            HistoryPromotion,
+			"ceremonyId":      ref.ID,
+			"createdAt":       now,
+		})
+
+		c.Promotions = append(c.Promotions, CeremonyPromotion{
+			MemberUID:       p.MemberUID,
+			PreviousBelt:    prevBelt,
+			PreviousStripes: int(prevStripes),
+			NewBelt:         p.BeltRank,
+			NewStripes:      p.Stripes,
+			HistoryID:       historyRef.ID,
+		})
+	}
+
+	c.InviteeUIDs = s.ceremonyInvitees(ctx, dojoID, c.Promotions, familyIDs)
+	batch.Set(ref, c)
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to confirm promotions: %w", err)
+	}
+	c.ID = ref.ID
+
+	for _, uid := range c.InviteeUIDs {
+		s.notifyCeremony(ctx, uid, dojoID, &c, "promotion_ceremony",
+			"Promotion ceremony: "+c.Title,
+			fmt.Sprintf("You're invited on %s. Let us know if you can come.", c.StartsAt.Format("2006-01-02 15:04")))
+	}
+	return &c, nil
+}
+
+// ceremonyInvitees returns the promoted members plus the payer and members
+// of their families, without duplicates
+func (s *Service) ceremonyInvitees(ctx context.Context, dojoID string, promotions []CeremonyPromotion, familyIDs map[string]bool) []string {
+	out := []string{}
+	add := func(uid string) {
+		if uid != "" && !slices.Contains(out, uid) {
+			out = append(out, uid)
+		}
+	}
+	for _, p := range promotions {
+		add(p.MemberUID)
+	}
+	for familyID := range familyIDs {
+		doc, err := s.repo.client.Collection("dojos").Doc(dojoID).Collection("families").Doc(familyID).Get(ctx)
+		if err != nil {
+			log.Printf("ceremony: failed to load family %s: %v", familyID, err)
+			continue
+		}
+		var fam struct {
+			PayerUID   string   `firestore:"payerUid"`
+			MemberUIDs []string `firestore:"memberUids"`
+		}
+		if err := doc.DataTo(&fam); err != nil {
+			continue
+		}
+		add(fam.PayerUID)
+		for _, uid := range fam.MemberUIDs {
+			add(uid)
+		}
+	}
+	return out
+}
+
+func (s *Service) getCeremony(ctx context.Context, dojoID, ceremonyID string) (*Ceremony, error) {
+	doc, err := s.repo.ceremoniesCol(dojoID).Doc(ceremonyID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get ceremony: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: ceremony not found", ErrNotFound)
+	}
+	var c Ceremony
+	if err := doc.DataTo(&c); err != nil {
+		return nil, fmt.Errorf("failed to decode ceremony: %w", err)
+	}
+	c.ID = doc.Ref.ID
+	return &c, nil
+}
+
+// view summarizes RSVPs and hides other invitees' answers from non-staff
+func (c Ceremony) view(uid string, isStaff bool) CeremonyView {
+	v := CeremonyView{Ceremony: c}
+	for _, invitee := range c.InviteeUIDs {
+		r, ok := c.RSVPs[invitee]
+		switch {
+		case !ok:
+			v.Summary.Pending++
+		case r.Response == RSVPYes:
+			v.Summary.Yes++
+			v.Summary.Guests += r.Guests
+		case r.Response == RSVPNo:
+			v.Summary.No++
+		default:
+			v.Summary.Maybe++
+		}
+	}
+	if !isStaff {
+		own := map[string]CeremonyRSVP{}
+		if r, ok := c.RSVPs[uid]; ok {
+			own[uid] = r
+		}
+		v.RSVPs = own
+	}
+	return v
+}
+
+// ListCeremonies lists ceremonies, newest first: all of them for staff,
+// the ones the caller is invited to otherwise
+func (s *Service) ListCeremonies(ctx context.Context, uid, dojoID string) ([]CeremonyView, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+
+	q := s.repo.ceremoniesCol(dojoID).Query
+	if !isStaff {
+		q = q.Where("inviteeUids", "array-contains", uid)
+	}
+	iter := q.OrderBy("startsAt", firestore.Desc).Limit(100).Documents(ctx)
+	defer iter.Stop()
+
+	out := []CeremonyView{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ceremonies: %w", err)
+		}
+		var c Ceremony
+		if err := doc.DataTo(&c); err != nil {
+			continue
+		}
+		c.ID = doc.Ref.ID
+		out = append(out, c.view(uid, isStaff))
+	}
+	return out, nil
+}
+
+// GetCeremony returns a ceremony (staff or invitees)
+func (s *Service) GetCeremony(ctx context.Context, uid, dojoID, ceremonyID string) (*CeremonyView, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	c, err := s.getCeremony(ctx, dojoID, strings.TrimSpace(ceremonyID))
+	if err != nil {
+		return nil, err
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff && !slices.Contains(c.InviteeUIDs, uid) {
+		return nil, fmt.Errorf("%w: ceremony not found", ErrNotFound)
+	}
+	v := c.view(uid, isStaff)
+	return &v, nil
+}
+
+// RSVP records an invitee's answer; it can be changed until the ceremony starts
+func (s *Service) RSVP(ctx context.Context, uid, dojoID, ceremonyID string, in RSVPInput) (*CeremonyView, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	in.Response = strings.ToLower(strings.TrimSpace(in.Response))
+	if !slices.Contains(ValidRSVPResponses, in.Response) {
+		return nil, fmt.Errorf("%w: response must be one of: %s", ErrBadRequest, strings.Join(ValidRSVPResponses, ", "))
+	}
+	if in.Guests < 0 || in.Guests > maxCeremonyGuests {
+		return nil, fmt.Errorf("%w: guests must be between 0 and %d", ErrBadRequest, maxCeremonyGuests)
+	}
+	if in.Response == RSVPNo {
+		in.Guests = 0
+	}
+
+	ref := s.repo.ceremoniesCol(dojoID).Doc(strings.TrimSpace(ceremonyID))
+	var out Ceremony
+	err := s.repo.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to get ceremony: %w", err)
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: ceremony not found", ErrNotFound)
+		}
+		var c Ceremony
+		if err := doc.DataTo(&c); err != nil {
+			return fmt.Errorf("failed to decode ceremony: %w", err)
+		}
+		if !slices.Contains(c.InviteeUIDs, uid) {
+			return fmt.Errorf("%w: ceremony not found", ErrNotFound)
+		}
+		now := time.Now().UTC()
+		if c.Status == CeremonyCancelled || !now.Before(c.StartsAt) {
+			return fmt.Errorf("%w: RSVPs are closed", ErrBadRequest)
+		}
+
+		rsvp := CeremonyRSVP{Response: in.Response, Guests: in.Guests, RespondedAt: now}
+		if c.RSVPs == nil {
+			c.RSVPs = map[string]CeremonyRSVP{}
+		}
+		c.RSVPs[uid] = rsvp
+		c.ID = doc.Ref.ID
+		out = c
+		return tx.Update(ref, []firestore.Update{
+			{FieldPath: firestore.FieldPath{"rsvps", uid}, Value: rsvp},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	v := out.view(uid, false)
+	return &v, nil
+}
+
+// AddCeremonyPhoto attaches an uploaded photo and links it to the rank
+// history entries of the members on it (staff)
+func (s *Service) AddCeremonyPhoto(ctx context.Context, staffUID, dojoID, ceremonyID string, in AddCeremonyPhotoInput) (*Ceremony, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	in.URL = strings.TrimSpace(in.URL)
+	in.Caption = strings.TrimSpace(in.Caption)
+	if in.URL == "" || !strings.HasPrefix(in.URL, "https://") {
+		return nil, fmt.Errorf("%w: url must be an https upload url", ErrBadRequest)
+	}
+	if len(in.Caption) > maxCeremonyText {
+		return nil, fmt.Errorf("%w: caption is limited to %d characters", ErrBadRequest, maxCeremonyText)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	c, err := s.getCeremony(ctx, dojoID, strings.TrimSpace(ceremonyID))
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Photos) >= maxCeremonyPhotos {
+		return nil, fmt.Errorf("%w: at most %d photos per ceremony", ErrBadRequest, maxCeremonyPhotos)
+	}
+
+	// photos link to the promotions of the members on them, or all of them
+	linked := []CeremonyPromotion{}
+	members := []string{}
+	for _, uid := range in.MemberUIDs {
+		uid = strings.TrimSpace(uid)
+		if uid != "" && !slices.Contains(members, uid) {
+			members = append(members, uid)
+		}
+	}
+	for _, p := range c.Promotions {
+		if len(members) == 0 || slices.Contains(members, p.MemberUID) {
+			linked = append(linked, p)
+		}
+	}
+	if len(members) > 0 && len(linked) != len(members) {
+		return nil, fmt.Errorf("%w: memberUids must be members promoted at this ceremony", ErrBadRequest)
+	}
+
+	now := time.Now().UTC()
+	photo := CeremonyPhoto{
+		URL:        in.URL,
+		Caption:    in.Caption,
+		MemberUIDs: members,
+		UploadedBy: staffUID,
+		CreatedAt:  now,
+	}
+
+	batch := s.repo.client.Batch()
+	ref := s.repo.ceremoniesCol(dojoID).Doc(c.ID)
+	batch.Update(ref, []firestore.Update{
+		{Path: "photos", Value: firestore.ArrayUnion(photo)},
+		{Path: "updatedAt", Value: now},
+	})
+	for _, p := range linked {
+		batch.Update(s.repo.rankHistoryCol(dojoID, p.MemberUID).Doc(p.HistoryID), []firestore.Update{
+			{Path: "photos", Value: firestore.ArrayUnion(in.URL)},
+		})
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to attach photo: %w", err)
+	}
+
+	c.Photos = append(c.Photos, photo)
+	c.UpdatedAt = now
+	return c, nil
+}
+
+func (s *Service) notifyCeremony(ctx context.Context, uid, dojoID string, c *Ceremony, kind, title, body string) {
+	_, _, err := s.repo.client.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title":     title,
+		"body":      body,
+		"type":      kind,
+		"data":      map[string]interface{}{"ceremonyId": c.ID},
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("ceremony: failed to notify %s: %v", uid, err)
+	}
+}
@@ -0,0 +1,209 @@
+package ranks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Promotions only ever move a member up. A rank entered by mistake is put
+// right with a correction, and a rank taken away with a demotion; both are
+// owner-only, need a reason code and leave their own history entry, so the
+// history never shows a made-up promotion.
+
+// Reason codes of corrections and demotions
+const (
+	ReasonDataEntry    = "data_entry_error" // wrong belt or stripes entered
+	ReasonWrongMember  = "wrong_member"     // the promotion was meant for someone else
+	ReasonDuplicate    = "duplicate"        // the promotion was recorded twice
+	ReasonPremature    = "premature"        // recorded before it was awarded
+	ReasonDisciplinary = "disciplinary"
+	ReasonRevoked      = "rank_revoked" // e.g. a rank claim found to be false
+	ReasonOther        = "other"        // notes required
+)
+
+var (
+	correctionReasons = []string{ReasonDataEntry, ReasonWrongMember, ReasonDuplicate, ReasonPremature, ReasonOther}
+	demotionReasons   = []string{ReasonDisciplinary, ReasonRevoked, ReasonOther}
+)
+
+const maxCorrectionNotes = 1000
+
+// CorrectRankInput is the body of POST .../members/{memberUid}/rank/corrections
+type CorrectRankInput struct {
+	Type       string `json:"type"` // HistoryCorrection or HistoryDemotion
+	BeltRank   string `json:"beltRank"`
+	Stripes    int    `json:"stripes"`
+	ReasonCode string `json:"reasonCode"`
+	Notes      string `json:"notes,omitempty"`
+
+	// HistoryID is the rank history entry a correction undoes, marked as
+	// corrected so registries and timelines leave it out (optional)
+	HistoryID string `json:"historyId,omitempty"`
+}
+
+func (in *CorrectRankInput) Trim() {
+	in.Type = strings.TrimSpace(in.Type)
+	in.BeltRank = strings.TrimSpace(in.BeltRank)
+	in.ReasonCode = strings.TrimSpace(in.ReasonCode)
+	in.Notes = strings.TrimSpace(in.Notes)
+	in.HistoryID = strings.TrimSpace(in.HistoryID)
+}
+
+func (in *CorrectRankInput) validate() error {
+	var reasons []string
+	switch in.Type {
+	case HistoryCorrection:
+		reasons = correctionReasons
+	case HistoryDemotion:
+		reasons = demotionReasons
+		if in.HistoryID != "" {
+			return fmt.Errorf("%w: historyId is only for corrections", ErrBadRequest)
+		}
+	default:
+		return fmt.Errorf("%w: type must be %q or %q", ErrBadRequest, HistoryCorrection, HistoryDemotion)
+	}
+	if !slices.Contains(reasons, in.ReasonCode) {
+		return fmt.Errorf("%w: reasonCode of a %s must be one of %s", ErrBadRequest, in.Type, strings.Join(reasons, ", "))
+	}
+	if in.ReasonCode == ReasonOther && in.Notes == "" {
+		return fmt.Errorf("%w: notes are required for reason %q", ErrBadRequest, ReasonOther)
+	}
+	if len(in.Notes) > maxCorrectionNotes {
+		return fmt.Errorf("%w: notes must be at most %d characters", ErrBadRequest, maxCorrectionNotes)
+	}
+	if !IsValidBelt(in.BeltRank) {
+		return fmt.Errorf("%w: unknown belt %q", ErrBadRequest, in.BeltRank)
+	}
+	if in.Stripes < 0 || in.Stripes > 4 {
+		return fmt.Errorf("%w: stripes must be 0-4", ErrBadRequest)
+	}
+	if strings.Contains(in.HistoryID, "/") {
+		return fmt.Errorf("%w: invalid historyId", ErrBadRequest)
+	}
+	return nil
+}
+
+// rankBelow reports whether belt with stripes ranks below cur with
+// curStripes
+func rankBelow(belt string, stripes int, cur string, curStripes int) bool {
+	if belt == cur {
+		return stripes < curStripes
+	}
+	return BeltAtLeast(cur, belt) && !BeltAtLeast(belt, cur)
+}
+
+// CorrectRank sets a member's rank outside promotion (owner only): a
+// correction puts right a rank recorded by mistake, in either direction, and
+// a demotion lowers it. The member's last promotion date is left alone.
+func (s *Service) CorrectRank(ctx context.Context, ownerUID, dojoID, memberUID string, in CorrectRankInput) (*RankHistory, error) {
+	in.Trim()
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	owner, err := s.isOwner(ctx, dojoID, ownerUID)
+	if err != nil {
+		return nil, err
+	}
+	if !owner {
+		return nil, fmt.Errorf("%w: only the dojo owner can correct or demote a rank", ErrUnauthorized)
+	}
+	return s.repo.CorrectRank(ctx, dojoID, memberUID, ownerUID, in)
+}
+
+// CorrectRank writes a correction or demotion and its history entry
+func (r *Repo) CorrectRank(ctx context.Context, dojoID, memberUID, ownerUID string, in CorrectRankInput) (*RankHistory, error) {
+	memberRef := r.memberRef(dojoID, memberUID)
+	historyRef := r.rankHistoryCol(dojoID, memberUID).NewDoc()
+	var correctedRef *firestore.DocumentRef
+	if in.HistoryID != "" {
+		correctedRef = r.rankHistoryCol(dojoID, memberUID).Doc(in.HistoryID)
+	}
+
+	var entry RankHistory
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(memberRef)
+		if err != nil && doc == nil {
+			return err
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: member not found", ErrNotFound)
+		}
+		data := doc.Data()
+		curBelt, _ := data["beltRank"].(string)
+		if curBelt == "" {
+			curBelt = "white"
+		}
+		curStripes, _ := data["stripes"].(int64)
+
+		if in.BeltRank == curBelt && in.Stripes == int(curStripes) {
+			return fmt.Errorf("%w: the member already holds this rank", ErrConflict)
+		}
+		if in.Type == HistoryDemotion && !rankBelow(in.BeltRank, in.Stripes, curBelt, int(curStripes)) {
+			return fmt.Errorf("%w: a demotion must lower the rank", ErrBadRequest)
+		}
+		if correctedRef != nil {
+			prev, err := tx.Get(correctedRef)
+			if err != nil && prev == nil {
+				return err
+			}
+			if !prev.Exists() {
+				return fmt.Errorf("%w: rank history entry not found", ErrNotFound)
+			}
+			var h RankHistory
+			if err := prev.DataTo(&h); err != nil {
+				return err
+			}
+			if h.CorrectedBy != "" {
+				return fmt.Errorf("%w: that entry was already corrected", ErrConflict)
+			}
+			if h.Type == HistoryCorrection || h.Type == HistoryDemotion {
+				return fmt.Errorf("%w: only promotions can be corrected; record another correction instead", ErrBadRequest)
+			}
+		}
+
+		now := time.Now().UTC()
+		entry = RankHistory{
+			ID:              historyRef.ID,
+			PreviousBelt:    curBelt,
+			PreviousStripes: int(curStripes),
+			NewBelt:         in.BeltRank,
+			NewStripes:      in.Stripes,
+			PromotedBy:      ownerUID,
+			Notes:           in.Notes,
+			CreatedAt:       now,
+			Type:            in.Type,
+			ReasonCode:      in.ReasonCode,
+			CorrectsID:      in.HistoryID,
+		}
+		if err := tx.Update(memberRef, []firestore.Update{
+			{Path: "beltRank", Value: in.BeltRank},
+			{Path: "stripes", Value: in.Stripes},
+			{Path: "updatedAt", Value: now},
+		}); err != nil {
+			return err
+		}
+		if correctedRef != nil {
+			if err := tx.Update(correctedRef, []firestore.Update{
+				{Path: "correctedBy", Value: historyRef.ID},
+			}); err != nil {
+				return err
+			}
+		}
+		return tx.Create(historyRef, entry)
+	})
+	if err != nil {
+		if IsErrNotFound(err) || IsErrConflict(err) || IsErrBadRequest(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to correct rank: %w", err)
+	}
+	return &entry, nil
+}
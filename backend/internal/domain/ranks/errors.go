@@ -6,6 +6,11 @@ var (
 	ErrUnauthorized = errors.New("unauthorized")
 	ErrNotFound     = errors.New("not found")
 	ErrBadRequest   = errors.New("bad request")
+	ErrConflict     = errors.New("conflict")
+
+	// ErrApprovalRequired is returned to staff promoting directly in a dojo
+	// where promotions need the owner's approval
+	ErrApprovalRequired = errors.New("approval required")
 )
 
 func IsErrUnauthorized(err error) bool {
@@ -19,3 +24,11 @@ func IsErrNotFound(err error) bool {
 func IsErrBadRequest(err error) bool {
 	return errors.Is(err, ErrBadRequest)
 }
+
+func IsErrConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+func IsErrApprovalRequired(err error) bool {
+	return errors.Is(err, ErrApprovalRequired)
+}
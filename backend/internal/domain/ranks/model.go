@@ -43,6 +43,33 @@ type RankHistory struct {
 	PromotedBy      string    `firestore:"promotedBy" json:"promotedBy"`
 	Notes           string    `firestore:"notes,omitempty" json:"notes,omitempty"`
 	CreatedAt       time.Time `firestore:"createdAt" json:"createdAt"`
+
+	// Type is HistoryVerifiedTransfer for a rank brought from another dojo,
+	// HistoryMemberTransfer where a member transfer brought the history over,
+	// HistoryCorrection or HistoryDemotion for owner changes outside
+	// promotion; empty for promotions. Copied records keep their type and gain
+	// FromDojoID.
+	Type         string `firestore:"type,omitempty" json:"type,omitempty"`
+	FromDojoID   string `firestore:"fromDojoId,omitempty" json:"fromDojoId,omitempty"`
+	FromDojoName string `firestore:"fromDojoName,omitempty" json:"fromDojoName,omitempty"`
+	Lineage      string `firestore:"lineage,omitempty" json:"lineage,omitempty"`
+
+	// CeremonyID is set for promotions confirmed with a ceremony; Photos are
+	// ceremony photos the member is on
+	CeremonyID string   `firestore:"ceremonyId,omitempty" json:"ceremonyId,omitempty"`
+	Photos     []string `firestore:"photos,omitempty" json:"photos,omitempty"`
+
+	// ProposalID and ApprovedBy are set for promotions approved by an owner
+	// in a dual-control dojo; PromotedBy is then the proposer
+	ProposalID string `firestore:"proposalId,omitempty" json:"proposalId,omitempty"`
+	ApprovedBy string `firestore:"approvedBy,omitempty" json:"approvedBy,omitempty"`
+
+	// ReasonCode is set for corrections and demotions (see corrections.go);
+	// CorrectsID is the entry a correction undoes, and CorrectedBy, on that
+	// entry, the correction
+	ReasonCode  string `firestore:"reasonCode,omitempty" json:"reasonCode,omitempty"`
+	CorrectsID  string `firestore:"correctsId,omitempty" json:"correctsId,omitempty"`
+	CorrectedBy string `firestore:"correctedBy,omitempty" json:"correctedBy,omitempty"`
 }
 
 // UpdateMemberRankInput represents input for updating a member's rank
@@ -0,0 +1,246 @@
+package ranks
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+// RegistryRow is one belt promotion in a federation registry export
+// (IBJJF-style: athlete, birth date, rank, promotion date, instructor)
+type RegistryRow struct {
+	MemberUID      string    `json:"memberUid"`
+	MemberNumber   int       `json:"memberNumber,omitempty"`
+	FullName       string    `json:"fullName"`
+	Email          string    `json:"email,omitempty"`
+	DateOfBirth    string    `json:"dateOfBirth,omitempty"`
+	Belt           string    `json:"belt"`
+	Degree         int       `json:"degree"`
+	PreviousBelt   string    `json:"previousBelt"`
+	PromotedAt     time.Time `json:"promotedAt"`
+	InstructorUID  string    `json:"instructorUid,omitempty"`
+	InstructorName string    `json:"instructorName,omitempty"`
+	InstructorBelt string    `json:"instructorBelt,omitempty"`
+	Academy        string    `json:"academy"`
+}
+
+// RegistryExportInput selects the promotions to export
+type RegistryExportInput struct {
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+	Belts []string  // empty = every belt
+}
+
+// maxRegistryRange keeps an export to about one registration season
+const maxRegistryRange = 366 * 24 * time.Hour
+
+// RegistryExport lists belt promotions (not stripes or verified transfers)
+// awarded in the dojo between From and To, oldest first
+func (s *Service) RegistryExport(ctx context.Context, dojoID string, in RegistryExportInput) ([]RegistryRow, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if !in.To.After(in.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrBadRequest)
+	}
+	if in.To.Sub(in.From) > maxRegistryRange {
+		return nil, fmt.Errorf("%w: range is limited to one year", ErrBadRequest)
+	}
+	for _, b := range in.Belts {
+		if !IsValidBelt(b) {
+			return nil, fmt.Errorf("%w: unknown belt %q", ErrBadRequest, b)
+		}
+	}
+
+	academy := dojoID
+	if d, err := s.dojoRepo.GetDojo(ctx, dojoID); err == nil && d.Name != "" {
+		academy = d.Name
+	}
+
+	// every promotion sets lastPromotionAt, so members promoted in the range
+	// have lastPromotionAt >= From
+	members := s.repo.client.Collection("dojos").Doc(dojoID).Collection("members")
+	iter := members.Where("lastPromotionAt", ">=", in.From).Documents(ctx)
+	defer iter.Stop()
+
+	rows := []RegistryRow{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members: %w", err)
+		}
+		found, err := s.repo.promotionsBetween(ctx, doc.Ref, in)
+		if err != nil {
+			return nil, err
+		}
+		number := dojo.MemberNumberOf(doc.Data())
+		if number == 0 && len(found) > 0 {
+			if number, err = s.dojoRepo.EnsureMemberNumber(ctx, dojoID, doc.Ref.ID); err != nil {
+				log.Printf("registry export: failed to number member %s/%s: %v", dojoID, doc.Ref.ID, err)
+			}
+		}
+		for i := range found {
+			found[i].MemberUID = doc.Ref.ID
+			found[i].MemberNumber = number
+			found[i].Academy = academy
+			if name, _ := doc.Data()["displayName"].(string); name != "" {
+				found[i].FullName = name
+			}
+		}
+		rows = append(rows, found...)
+	}
+
+	s.fillRegistryPeople(ctx, dojoID, rows)
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].PromotedAt.Before(rows[j].PromotedAt) })
+	return rows, nil
+}
+
+// promotionsBetween reads a member's belt changes in the range
+func (r *Repo) promotionsBetween(ctx context.Context, member *firestore.DocumentRef, in RegistryExportInput) ([]RegistryRow, error) {
+	iter := member.Collection("rankHistory").
+		Where("createdAt", ">=", in.From).
+		Where("createdAt", "<", in.To).
+		Documents(ctx)
+	defer iter.Stop()
+
+	out := []RegistryRow{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rank history: %w", err)
+		}
+		var h RankHistory
+		if err := doc.DataTo(&h); err != nil {
+			continue
+		}
+		if h.Type == HistoryVerifiedTransfer || h.Type == HistoryCorrection || h.Type == HistoryDemotion ||
+			h.CorrectedBy != "" || h.NewBelt == h.PreviousBelt {
+			continue
+		}
+		if len(in.Belts) > 0 && !slices.Contains(in.Belts, h.NewBelt) {
+			continue
+		}
+		out = append(out, RegistryRow{
+			Belt:          h.NewBelt,
+			Degree:        h.NewStripes,
+			PreviousBelt:  h.PreviousBelt,
+			PromotedAt:    h.CreatedAt,
+			InstructorUID: h.PromotedBy,
+		})
+	}
+	return out, nil
+}
+
+// fillRegistryPeople resolves names, emails and birth dates from users/{uid}
+// and instructor belts from the dojo's members (best effort)
+func (s *Service) fillRegistryPeople(ctx context.Context, dojoID string, rows []RegistryRow) {
+	type person struct {
+		name, email, dob, belt string
+	}
+	cache := map[string]*person{}
+	lookup := func(uid string) *person {
+		if p, ok := cache[uid]; ok {
+			return p
+		}
+		p := &person{}
+		if doc, err := s.repo.client.Collection("users").Doc(uid).Get(ctx); err == nil {
+			data := doc.Data()
+			p.name, _ = data["displayName"].(string)
+			p.email, _ = data["email"].(string)
+			p.dob, _ = data["dateOfBirth"].(string)
+		}
+		cache[uid] = p
+		return p
+	}
+
+	for i := range rows {
+		m := lookup(rows[i].MemberUID)
+		if m.name != "" {
+			rows[i].FullName = m.name
+		}
+		rows[i].Email = m.email
+		rows[i].DateOfBirth = m.dob
+
+		if rows[i].InstructorUID == "" {
+			continue
+		}
+		ins := lookup(rows[i].InstructorUID)
+		if ins.belt == "" {
+			ins.belt, _, _ = s.repo.GetMemberRank(ctx, dojoID, rows[i].InstructorUID)
+		}
+		rows[i].InstructorName = ins.name
+		rows[i].InstructorBelt = ins.belt
+	}
+}
+
+// RegistryCSVHeader is the column order of WriteRegistryCSV
+var RegistryCSVHeader = []string{
+	"Full Name", "Date of Birth", "Email", "Belt", "Degree", "Previous Belt",
+	"Promotion Date", "Instructor", "Instructor Belt", "Academy", "Member Number",
+}
+
+// WriteRegistryCSV writes rows in the federation upload format
+func WriteRegistryCSV(w io.Writer, rows []RegistryRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(RegistryCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write([]string{
+			r.FullName,
+			r.DateOfBirth,
+			r.Email,
+			BeltLabel(r.Belt),
+			strconv.Itoa(r.Degree),
+			BeltLabel(r.PreviousBelt),
+			r.PromotedAt.Format("2006-01-02"),
+			r.InstructorName,
+			BeltLabel(r.InstructorBelt),
+			r.Academy,
+			memberNumberCell(r.MemberNumber),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func memberNumberCell(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// BeltLabel turns a belt key into its registry name ("red_black" -> "Red/Black")
+func BeltLabel(belt string) string {
+	if belt == "" {
+		return ""
+	}
+	parts := strings.Split(belt, "_")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "/")
+}
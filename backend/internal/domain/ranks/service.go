@@ -32,6 +32,9 @@ func (s *Service) UpdateMemberRank(ctx context.Context, staffUID string, input U
 	if !isStaff {
 		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
 	}
+	if err := s.requireDirectPromotion(ctx, input.DojoID, staffUID); err != nil {
+		return nil, err
+	}
 
 	// Get current rank
 	previousBelt, previousStripes, err := s.repo.GetMemberRank(ctx, input.DojoID, input.MemberUID)
@@ -50,6 +53,10 @@ func (s *Service) UpdateMemberRank(ctx context.Context, staffUID string, input U
 		}
 	}
 
+	if rankBelow(input.BeltRank, newStripes, previousBelt, previousStripes) {
+		return nil, fmt.Errorf("%w: %s belt with %d stripes is below the member's current rank; record a correction or demotion instead", ErrBadRequest, input.BeltRank, newStripes)
+	}
+
 	err = s.repo.UpdateMemberRank(ctx, input.DojoID, input.MemberUID, staffUID, input.BeltRank, newStripes, input.Notes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update rank: %w", err)
@@ -80,6 +87,9 @@ func (s *Service) AddStripe(ctx context.Context, staffUID string, input AddStrip
 	if !isStaff {
 		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
 	}
+	if err := s.requireDirectPromotion(ctx, input.DojoID, staffUID); err != nil {
+		return nil, err
+	}
 
 	previousStripes, newStripes, err := s.repo.AddStripe(ctx, input.DojoID, input.MemberUID, staffUID, input.Notes)
 	if err != nil {
@@ -0,0 +1,494 @@
+package ranks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// A member who already holds a rank elsewhere claims it on joining; staff of
+// the new dojo verify the claim and the rank history records a verified
+// transfer instead of a promotion from white. Claims live at
+// dojos/{dojoId}/rankClaims/{memberUid}, one per member.
+
+// History record types
+const (
+	HistoryPromotion        = "promotion"
+	HistoryVerifiedTransfer = "verified_transfer"
+	HistoryMemberTransfer   = "member_transfer"
+	HistoryCorrection       = "correction"
+	HistoryDemotion         = "demotion"
+)
+
+// Claim statuses
+const (
+	ClaimPending  = "pending"
+	ClaimVerified = "verified"
+	ClaimRejected = "rejected"
+)
+
+// RankClaim is a member's stated rank from another dojo
+type RankClaim struct {
+	MemberUID string `firestore:"memberUid" json:"memberUid"`
+	Belt      string `firestore:"belt" json:"belt"`
+	Stripes   int    `firestore:"stripes" json:"stripes"`
+
+	// where and from whom the rank was awarded
+	FromDojoID   string     `firestore:"fromDojoId,omitempty" json:"fromDojoId,omitempty"`
+	FromDojoName string     `firestore:"fromDojoName,omitempty" json:"fromDojoName,omitempty"`
+	AwardedBy    string     `firestore:"awardedBy,omitempty" json:"awardedBy,omitempty"`
+	Lineage      string     `firestore:"lineage,omitempty" json:"lineage,omitempty"`
+	AwardedAt    *time.Time `firestore:"awardedAt,omitempty" json:"awardedAt,omitempty"`
+
+	// SourceBelt/SourceStripes are what FromDojoID has on record for the
+	// member, when that dojo is on the platform
+	SourceBelt    string `firestore:"sourceBelt,omitempty" json:"sourceBelt,omitempty"`
+	SourceStripes int    `firestore:"sourceStripes,omitempty" json:"sourceStripes,omitempty"`
+	SourceMatches bool   `firestore:"sourceMatches" json:"sourceMatches"`
+
+	Status     string     `firestore:"status" json:"status"`
+	ReviewedBy string     `firestore:"reviewedBy,omitempty" json:"reviewedBy,omitempty"`
+	ReviewedAt *time.Time `firestore:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	ReviewNote string     `firestore:"reviewNote,omitempty" json:"reviewNote,omitempty"`
+	CreatedAt  time.Time  `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time  `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// SubmitClaimInput is a member's rank claim
+type SubmitClaimInput struct {
+	Belt         string     `json:"belt"`
+	Stripes      int        `json:"stripes"`
+	FromDojoID   string     `json:"fromDojoId,omitempty"`
+	FromDojoName string     `json:"fromDojoName,omitempty"`
+	AwardedBy    string     `json:"awardedBy,omitempty"`
+	Lineage      string     `json:"lineage,omitempty"`
+	AwardedAt    *time.Time `json:"awardedAt,omitempty"`
+}
+
+func (in *SubmitClaimInput) Trim() {
+	in.Belt = strings.TrimSpace(in.Belt)
+	in.FromDojoID = strings.TrimSpace(in.FromDojoID)
+	in.FromDojoName = strings.TrimSpace(in.FromDojoName)
+	in.AwardedBy = strings.TrimSpace(in.AwardedBy)
+	in.Lineage = strings.TrimSpace(in.Lineage)
+}
+
+// ReviewClaimInput confirms or rejects a claim. Staff may correct the belt
+// and stripes when confirming.
+type ReviewClaimInput struct {
+	Approve bool   `json:"approve"`
+	Belt    string `json:"belt,omitempty"`
+	Stripes *int   `json:"stripes,omitempty"`
+	Note    string `json:"note,omitempty"`
+}
+
+func (in *ReviewClaimInput) Trim() {
+	in.Belt = strings.TrimSpace(in.Belt)
+	in.Note = strings.TrimSpace(in.Note)
+}
+
+const maxClaimTextLength = 300
+
+// IsValidBelt reports whether belt is an adult or kids belt
+func IsValidBelt(belt string) bool {
+	return slices.Contains(BeltOrder, belt) || slices.Contains(KidsBeltOrder, belt)
+}
+
+// BeltAtLeast reports whether belt is min or above. Adult belts past white
+// outrank every kids belt; kids belts never reach an adult minimum.
+func BeltAtLeast(belt, min string) bool {
+	if belt == "" {
+		belt = "white"
+	}
+	if min == "" || min == "white" {
+		return true
+	}
+	if i := slices.Index(BeltOrder, min); i >= 0 {
+		return slices.Index(BeltOrder, belt) >= i
+	}
+	if j := slices.Index(KidsBeltOrder, belt); j >= 0 {
+		return j >= slices.Index(KidsBeltOrder, min)
+	}
+	return slices.Contains(BeltOrder, belt)
+}
+
+func (r *Repo) rankClaimsCol(dojoID string) *firestore.CollectionRef {
+	return r.client.Collection("dojos").Doc(dojoID).Collection("rankClaims")
+}
+
+// GetClaim returns a member's claim
+func (r *Repo) GetClaim(ctx context.Context, dojoID, memberUID string) (*RankClaim, error) {
+	doc, err := r.rankClaimsCol(dojoID).Doc(memberUID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get rank claim: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: rank claim not found", ErrNotFound)
+	}
+	var c RankClaim
+	if err := doc.DataTo(&c); err != nil {
+		return nil, fmt.Errorf("failed to parse rank claim: %w", err)
+	}
+	return &c, nil
+}
+
+// PutClaim writes a claim
+func (r *Repo) PutClaim(ctx context.Context, dojoID string, c RankClaim) error {
+	_, err := r.rankClaimsCol(dojoID).Doc(c.MemberUID).Set(ctx, c)
+	return err
+}
+
+// ListClaims lists claims with the given status, oldest first
+func (r *Repo) ListClaims(ctx context.Context, dojoID, status string) ([]RankClaim, error) {
+	iter := r.rankClaimsCol(dojoID).Where("status", "==", status).Documents(ctx)
+	defer iter.Stop()
+
+	out := []RankClaim{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list rank claims: %w", err)
+		}
+		var c RankClaim
+		if err := doc.DataTo(&c); err != nil {
+			continue
+		}
+		out = append(out, c)
+	}
+	slices.SortFunc(out, func(a, b RankClaim) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out, nil
+}
+
+// ApplyVerifiedTransfer sets the member's rank from a verified claim and
+// records it in the rank history, in one batch
+func (r *Repo) ApplyVerifiedTransfer(ctx context.Context, dojoID string, c RankClaim) error {
+	currentBelt, currentStripes, _ := r.GetMemberRank(ctx, dojoID, c.MemberUID)
+	now := time.Now().UTC()
+	awardedAt := now
+	if c.AwardedAt != nil && !c.AwardedAt.IsZero() {
+		awardedAt = c.AwardedAt.UTC()
+	}
+
+	notes := "Verified transfer"
+	if c.FromDojoName != "" {
+		notes += " from " + c.FromDojoName
+	}
+	if c.AwardedBy != "" {
+		notes += ", awarded by " + c.AwardedBy
+	}
+
+	batch := r.client.Batch()
+	batch.Set(r.memberRef(dojoID, c.MemberUID), map[string]interface{}{
+		"beltRank":        c.Belt,
+		"stripes":         c.Stripes,
+		"lastPromotionAt": awardedAt,
+		"lastPromotedBy":  c.ReviewedBy,
+		"rankVerifiedAt":  now,
+		"updatedAt":       now,
+	}, firestore.MergeAll)
+	batch.Set(r.rankHistoryCol(dojoID, c.MemberUID).NewDoc(), map[string]interface{}{
+		"type":            HistoryVerifiedTransfer,
+		"previousBelt":    currentBelt,
+		"previousStripes": currentStripes,
+		"newBelt":         c.Belt,
+		"newStripes":      c.Stripes,
+		"promotedBy":      c.ReviewedBy,
+		"notes":           notes,
+		"fromDojoId":      c.FromDojoID,
+		"fromDojoName":    c.FromDojoName,
+		"lineage":         c.Lineage,
+		"createdAt":       now,
+	})
+	batch.Set(r.rankClaimsCol(dojoID).Doc(c.MemberUID), c)
+	_, err := batch.Commit(ctx)
+	return err
+}
+
+// ApplyMemberTransfer moves a member's rank from one dojo to another on an
+// accepted member transfer: the history records are copied under their own
+// ids (so a retried transfer does not duplicate them), tagged with the dojo
+// they were earned in, and a member_transfer record closes the history. The
+// member doc in toDojoID must exist. Returns the number of records copied.
+func (r *Repo) ApplyMemberTransfer(ctx context.Context, fromDojoID, fromDojoName, toDojoID, memberUID, staffUID string) (int, error) {
+	belt, stripes, err := r.GetMemberRank(ctx, fromDojoID, memberUID)
+	if err != nil {
+		return 0, err
+	}
+	docs, err := r.rankHistoryCol(fromDojoID, memberUID).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rank history: %w", err)
+	}
+
+	var lastPromotionAt time.Time
+	bw := r.client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(docs)+2)
+	add := func(job *firestore.BulkWriterJob, err error) {
+		if err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	for _, doc := range docs {
+		data := doc.Data()
+		if v, _ := data["fromDojoId"].(string); v == "" {
+			data["fromDojoId"] = fromDojoID
+			data["fromDojoName"] = fromDojoName
+		}
+		if at, ok := data["createdAt"].(time.Time); ok && at.After(lastPromotionAt) {
+			lastPromotionAt = at
+		}
+		add(bw.Set(r.rankHistoryCol(toDojoID, memberUID).Doc(doc.Ref.ID), data))
+	}
+
+	now := time.Now().UTC()
+	notes := "Transferred"
+	if fromDojoName != "" {
+		notes += " from " + fromDojoName
+	}
+	add(bw.Set(r.rankHistoryCol(toDojoID, memberUID).Doc("transfer_"+fromDojoID), map[string]interface{}{
+		"type":            HistoryMemberTransfer,
+		"previousBelt":    belt,
+		"previousStripes": stripes,
+		"newBelt":         belt,
+		"newStripes":      stripes,
+		"promotedBy":      staffUID,
+		"notes":           notes,
+		"fromDojoId":      fromDojoID,
+		"fromDojoName":    fromDojoName,
+		"createdAt":       now,
+	}))
+	member := map[string]interface{}{
+		"beltRank":  belt,
+		"stripes":   stripes,
+		"updatedAt": now,
+	}
+	if !lastPromotionAt.IsZero() {
+		member["lastPromotionAt"] = lastPromotionAt
+	}
+	add(bw.Set(r.memberRef(toDojoID, memberUID), member, firestore.MergeAll))
+	bw.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return 0, fmt.Errorf("failed to copy rank history: %w", err)
+		}
+	}
+	return len(docs), nil
+}
+
+// SubmitClaim records the rank a member says they hold. A pending or
+// rejected claim can be resubmitted; a verified one cannot.
+func (s *Service) SubmitClaim(ctx context.Context, uid, dojoID string, in SubmitClaimInput) (*RankClaim, error) {
+	in.Trim()
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if !IsValidBelt(in.Belt) {
+		return nil, fmt.Errorf("%w: unknown belt %q", ErrBadRequest, in.Belt)
+	}
+	if in.Stripes < 0 || in.Stripes > 4 {
+		return nil, fmt.Errorf("%w: stripes must be between 0 and 4", ErrBadRequest)
+	}
+	if in.FromDojoID == dojoID {
+		return nil, fmt.Errorf("%w: fromDojoId must be another dojo", ErrBadRequest)
+	}
+	for _, v := range []string{in.FromDojoName, in.AwardedBy, in.Lineage} {
+		if len(v) > maxClaimTextLength {
+			return nil, fmt.Errorf("%w: text fields are limited to %d characters", ErrBadRequest, maxClaimTextLength)
+		}
+	}
+	if in.AwardedAt != nil && in.AwardedAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: awardedAt is in the future", ErrBadRequest)
+	}
+
+	if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+		return nil, fmt.Errorf("%w: only members can claim a rank", ErrUnauthorized)
+	}
+	if prev, err := s.repo.GetClaim(ctx, dojoID, uid); err == nil && prev.Status == ClaimVerified {
+		return nil, fmt.Errorf("%w: rank already verified", ErrBadRequest)
+	} else if err != nil && !IsErrNotFound(err) {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	c := RankClaim{
+		MemberUID:    uid,
+		Belt:         in.Belt,
+		Stripes:      in.Stripes,
+		FromDojoID:   in.FromDojoID,
+		FromDojoName: in.FromDojoName,
+		AwardedBy:    in.AwardedBy,
+		Lineage:      in.Lineage,
+		AwardedAt:    in.AwardedAt,
+		Status:       ClaimPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	// cross-check with the other dojo's records when it is on the platform
+	if c.FromDojoID != "" {
+		if d, err := s.dojoRepo.GetDojo(ctx, c.FromDojoID); err == nil {
+			c.FromDojoName = d.Name
+			if belt, stripes, err := s.repo.GetMemberRank(ctx, c.FromDojoID, uid); err == nil {
+				c.SourceBelt = belt
+				c.SourceStripes = stripes
+				c.SourceMatches = belt == c.Belt && stripes == c.Stripes
+			}
+		}
+	}
+
+	if err := s.repo.PutClaim(ctx, dojoID, c); err != nil {
+		return nil, fmt.Errorf("failed to save rank claim: %w", err)
+	}
+	s.notifyStaffOfClaim(ctx, dojoID, c)
+	return &c, nil
+}
+
+// GetClaim returns a member's claim (the member or staff)
+func (s *Service) GetClaim(ctx context.Context, uid, dojoID, memberUID string) (*RankClaim, error) {
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if uid != memberUID {
+		isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check staff status: %w", err)
+		}
+		if !isStaff {
+			return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+		}
+	}
+	return s.repo.GetClaim(ctx, dojoID, memberUID)
+}
+
+// ListClaims lists a dojo's claims, pending by default
+func (s *Service) ListClaims(ctx context.Context, dojoID, status string) ([]RankClaim, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	switch status {
+	case "":
+		status = ClaimPending
+	case ClaimPending, ClaimVerified, ClaimRejected:
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, verified or rejected", ErrBadRequest)
+	}
+	return s.repo.ListClaims(ctx, dojoID, status)
+}
+
+// ReviewClaim confirms or rejects a pending claim. Confirming sets the
+// member's rank and records a verified transfer in the rank history.
+func (s *Service) ReviewClaim(ctx context.Context, staffUID, dojoID, memberUID string, in ReviewClaimInput) (*RankClaim, error) {
+	in.Trim()
+	if dojoID == "" || memberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+	if staffUID == memberUID {
+		return nil, fmt.Errorf("%w: staff cannot verify their own rank", ErrUnauthorized)
+	}
+
+	c, err := s.repo.GetClaim(ctx, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != ClaimPending {
+		return nil, fmt.Errorf("%w: claim is already %s", ErrBadRequest, c.Status)
+	}
+
+	now := time.Now().UTC()
+	c.ReviewedBy = staffUID
+	c.ReviewedAt = &now
+	c.ReviewNote = in.Note
+	c.UpdatedAt = now
+
+	if !in.Approve {
+		c.Status = ClaimRejected
+		if err := s.repo.PutClaim(ctx, dojoID, *c); err != nil {
+			return nil, fmt.Errorf("failed to save rank claim: %w", err)
+		}
+		s.notifyClaimReviewed(ctx, dojoID, *c)
+		return c, nil
+	}
+
+	if in.Belt != "" {
+		if !IsValidBelt(in.Belt) {
+			return nil, fmt.Errorf("%w: unknown belt %q", ErrBadRequest, in.Belt)
+		}
+		c.Belt = in.Belt
+	}
+	if in.Stripes != nil {
+		if *in.Stripes < 0 || *in.Stripes > 4 {
+			return nil, fmt.Errorf("%w: stripes must be between 0 and 4", ErrBadRequest)
+		}
+		c.Stripes = *in.Stripes
+	}
+	c.Status = ClaimVerified
+	if err := s.repo.ApplyVerifiedTransfer(ctx, dojoID, *c); err != nil {
+		return nil, fmt.Errorf("failed to apply rank transfer: %w", err)
+	}
+	s.notifyClaimReviewed(ctx, dojoID, *c)
+	return c, nil
+}
+
+// notifyStaffOfClaim tells the dojo's staff a claim is waiting (best effort)
+func (s *Service) notifyStaffOfClaim(ctx context.Context, dojoID string, c RankClaim) {
+	staff, err := s.dojoRepo.ListStaffUIDs(ctx, dojoID)
+	if err != nil {
+		log.Printf("rank claim: failed to list staff of %s: %v", dojoID, err)
+		return
+	}
+	body := fmt.Sprintf("A member claims %s belt, %d stripes", c.Belt, c.Stripes)
+	if c.FromDojoName != "" {
+		body += " from " + c.FromDojoName
+	}
+	for _, uid := range staff {
+		s.notify(ctx, uid, dojoID, "Rank verification requested", body, c)
+	}
+}
+
+// notifyClaimReviewed tells the member the outcome (best effort)
+func (s *Service) notifyClaimReviewed(ctx context.Context, dojoID string, c RankClaim) {
+	title := "Rank verified"
+	body := fmt.Sprintf("Your %s belt, %d stripes has been verified", c.Belt, c.Stripes)
+	if c.Status == ClaimRejected {
+		title = "Rank not verified"
+		body = "Your rank claim was not verified"
+		if c.ReviewNote != "" {
+			body += ": " + c.ReviewNote
+		}
+	}
+	s.notify(ctx, c.MemberUID, dojoID, title, body, c)
+}
+
+func (s *Service) notify(ctx context.Context, uid, dojoID, title, body string, c RankClaim) {
+	_, _, err := s.repo.client.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title": title,
+		"body":  body,
+		"type":  "rank_claim",
+		"data": map[string]interface{}{
+			"memberUid": c.MemberUID,
+			"status":    c.Status,
+		},
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("rank claim: failed to notify %s: %v", uid, err)
+	}
+}
@@ -0,0 +1,71 @@
+package recurring
+
+import "time"
+
+const (
+	// DaysAhead is how far ahead reservations are generated for active holds
+	DaysAhead = 14
+
+	maxPauseDays = 180
+)
+
+// Hold statuses
+const (
+	StatusActive     = "active"     // holds a place; reservations are generated
+	StatusWaitlisted = "waitlisted" // queued for the next free place
+	StatusPaused     = "paused"     // frozen until PausedUntil; keeps its place in the queue
+	StatusCancelled  = "cancelled"
+)
+
+// Booking is a dojos/{dojoId}/recurringBookings/{sessionId}__{memberUid}
+// document: a member's standing place in a capacity-limited timetable class,
+// e.g. every Tuesday 6pm. Active holds get a reservation generated for each
+// instance up to DaysAhead days out.
+//
+// Priority: at most MaxCapacity holds of a class are active. Active holds
+// keep their place; free places go to the other holds in QueuedAt order. A
+// paused hold keeps its QueuedAt, so a member back from a freeze goes ahead
+// of everyone who joined the waitlist after them, but does not displace the
+// member who took their place meanwhile.
+type Booking struct {
+	ID            string    `firestore:"-" json:"id"`
+	SessionID     string    `firestore:"sessionId" json:"sessionId"`
+	SessionTitle  string    `firestore:"sessionTitle" json:"sessionTitle"`
+	MemberUID     string    `firestore:"memberUid" json:"memberUid"`
+	MemberName    string    `firestore:"memberName,omitempty" json:"memberName,omitempty"`
+	Status        string    `firestore:"status" json:"status"`
+	QueuedAt      time.Time `firestore:"queuedAt" json:"queuedAt"`
+	PausedUntil   string    `firestore:"pausedUntil,omitempty" json:"pausedUntil,omitempty"`     // YYYY-MM-DD, exclusive
+	BookedThrough string    `firestore:"bookedThrough,omitempty" json:"bookedThrough,omitempty"` // last date reservations were generated for
+	CreatedBy     string    `firestore:"createdBy" json:"createdBy"`
+	CreatedAt     time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+type ListInput struct {
+	SessionID string `json:"sessionId,omitempty"` // staff only; members see their own
+}
+
+type CreateInput struct {
+	SessionID string `json:"sessionId"`
+	MemberUID string `json:"memberUid,omitempty"` // staff only; defaults to the caller
+}
+
+type PauseInput struct {
+	Until string `json:"until"` // YYYY-MM-DD, the first date the hold applies again
+}
+
+// RunResult summarizes a scheduler run
+type RunResult struct {
+	Date         string `json:"date"` // YYYY-MM-DD
+	DojosChecked int    `json:"dojosChecked"`
+	Classes      int    `json:"classes"`
+	Resumed      int    `json:"resumed"` // pauses that ran out
+	Promoted     int    `json:"promoted"`
+	Cancelled    int    `json:"cancelled"` // holds of deleted or inactive classes
+	Booked       int    `json:"booked"`
+	Full         int    `json:"full"`      // instances already full of drop-in reservations
+	Suspended    int    `json:"suspended"` // dates the member is suspended on
+	Failed       int    `json:"failed"`
+	Partial      bool   `json:"partial"` // the deadline hit first; run again to finish
+}
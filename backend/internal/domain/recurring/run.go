@@ -0,0 +1,245 @@
+package recurring
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// maxTimetableClasses is the most classes session.List returns
+const maxTimetableClasses = 100
+
+// Run settles every dojo's recurring bookings: pauses that ran out rejoin the
+// queue, free places go to the waitlist, holds of classes that were deleted
+// or taken off the timetable are cancelled, and active holds get their
+// reservations for the next DaysAhead days. Meant to be triggered daily by
+// Cloud Scheduler; every step is idempotent.
+func (s *Service) Run(ctx context.Context, now time.Time) (*RunResult, error) {
+	now = now.UTC()
+	res := &RunResult{Date: now.Format(instanceid.DateLayout)}
+
+	iter := s.fs.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+
+		if err := s.runDojo(ctx, doc.Ref.ID, now, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			res.Failed++
+			log.Printf("recurring bookings: dojo %s: %v", doc.Ref.ID, err)
+		}
+	}
+
+	log.Printf("recurring bookings: %d dojos checked, %d classes, %d promoted, %d resumed, %d cancelled, %d booked, %d full, %d failed (partial=%v)",
+		res.DojosChecked, res.Classes, res.Promoted, res.Resumed, res.Cancelled, res.Booked, res.Full, res.Failed, res.Partial)
+	return res, nil
+}
+
+// runDojo settles each class of a dojo that has holds
+func (s *Service) runDojo(ctx context.Context, dojoID string, now time.Time, res *RunResult) error {
+	docs, err := s.col(dojoID).Where("status", "in", []string{StatusActive, StatusWaitlisted, StatusPaused}).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list recurring bookings: %w", err)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	held := map[string][]*Booking{}
+	for _, doc := range docs {
+		b, err := decode(doc)
+		if err != nil {
+			continue
+		}
+		held[b.SessionID] = append(held[b.SessionID], b)
+	}
+
+	classes, err := s.sessions.List(ctx, dojoID, session.ListSessionsInput{Limit: maxTimetableClasses})
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*session.Session, len(classes))
+	for i := range classes {
+		byID[classes[i].ID] = &classes[i]
+	}
+	// a full page may have left classes out; only a short one proves a
+	// class is gone
+	complete := len(classes) < maxTimetableClasses
+
+	for sessionID, holds := range held {
+		res.Classes++
+		sess := byID[sessionID]
+		if sess == nil && !complete {
+			if sess, err = s.sessions.Get(ctx, dojoID, sessionID); err != nil {
+				continue
+			}
+		}
+		if sess == nil || !sess.IsActive || sess.MaxCapacity <= 0 {
+			for _, b := range holds {
+				if err := s.release(ctx, dojoID, b, now, map[string]interface{}{"status": StatusCancelled}); err != nil {
+					return err
+				}
+				res.Cancelled++
+			}
+			continue
+		}
+		if err := s.settle(ctx, dojoID, sess, now, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settle orders the holds of a class (see Booking), releases the places of
+// holds pushed back to the waitlist by a lowered capacity and generates the
+// reservations of the active holds
+func (s *Service) settle(ctx context.Context, dojoID string, sess *session.Session, now time.Time, res *RunResult) error {
+	today := now.Format(instanceid.DateLayout)
+	q := s.col(dojoID).Where("sessionId", "==", sess.ID)
+
+	var active, demoted []*Booking
+	var promoted, resumed int
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		active, demoted, promoted, resumed = nil, nil, 0, 0
+		docs, err := tx.Documents(q).GetAll()
+		if err != nil {
+			return err
+		}
+
+		var queue []*Booking
+		changed := map[*Booking]bool{}
+		for _, doc := range docs {
+			b, err := decode(doc)
+			if err != nil {
+				continue
+			}
+			switch b.Status {
+			case StatusActive:
+				active = append(active, b)
+			case StatusPaused:
+				if b.PausedUntil == "" || b.PausedUntil > today {
+					continue
+				}
+				b.Status, b.PausedUntil = StatusWaitlisted, ""
+				changed[b] = true
+				resumed++
+				queue = append(queue, b)
+			case StatusWaitlisted:
+				queue = append(queue, b)
+			}
+		}
+		byQueue := func(bs []*Booking) {
+			sort.SliceStable(bs, func(i, j int) bool { return bs[i].QueuedAt.Before(bs[j].QueuedAt) })
+		}
+		byQueue(active)
+		byQueue(queue)
+
+		for len(active) > sess.MaxCapacity {
+			last := active[len(active)-1]
+			active = active[:len(active)-1]
+			last.Status = StatusWaitlisted
+			changed[last] = true
+			demoted = append(demoted, last)
+		}
+		for len(active) < sess.MaxCapacity && len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			next.Status = StatusActive
+			changed[next] = true
+			active = append(active, next)
+			promoted++
+		}
+
+		for b := range changed {
+			if err := tx.Set(s.col(dojoID).Doc(b.ID), map[string]interface{}{
+				"status":      b.Status,
+				"pausedUntil": firestore.Delete,
+				"updatedAt":   now,
+			}, firestore.MergeAll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to settle recurring bookings of %s: %w", sess.ID, err)
+	}
+	res.Promoted += promoted
+	res.Resumed += resumed
+
+	for _, b := range demoted {
+		if err := s.release(ctx, dojoID, b, now, map[string]interface{}{}); err != nil {
+			return err
+		}
+	}
+	for _, b := range active {
+		if err := s.book(ctx, dojoID, sess, b, now, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// book generates an active hold's reservations for the dates after
+// BookedThrough, up to DaysAhead days out. A date the member cancelled
+// stays cancelled.
+func (s *Service) book(ctx context.Context, dojoID string, sess *session.Session, b *Booking, now time.Time, res *RunResult) error {
+	last := now.AddDate(0, 0, DaysAhead).Format(instanceid.DateLayout)
+	if b.BookedThrough >= last {
+		return nil
+	}
+	for _, dateKey := range upcomingDates(now, last) {
+		if dateKey <= b.BookedThrough || !sess.HeldOn(dateKey) {
+			continue
+		}
+		outcome, err := s.sessions.BookInstance(ctx, dojoID, sess, dateKey, session.Reservation{
+			MemberID:     b.MemberUID,
+			MemberName:   b.MemberName,
+			AddedByStaff: b.CreatedBy != b.MemberUID,
+			RecurringID:  b.ID,
+		})
+		if err != nil {
+			return err
+		}
+		switch outcome {
+		case session.Booked:
+			res.Booked++
+		case session.BookedFull:
+			res.Full++
+		case session.BookedBlocked:
+			res.Suspended++
+		}
+	}
+	if _, err := s.col(dojoID).Doc(b.ID).Update(ctx, []firestore.Update{
+		{Path: "bookedThrough", Value: last},
+		{Path: "updatedAt", Value: now},
+	}); err != nil {
+		return fmt.Errorf("failed to update recurring booking: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package recurring
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+type Service struct {
+	fs       *firestore.Client
+	dojoRepo *dojo.Repo
+	sessions *session.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, sessions *session.Service) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, sessions: sessions}
+}
+
+func (s *Service) col(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("recurringBookings")
+}
+
+// bookingID keys holds by class and member, so a member holds a class once
+func bookingID(sessionID, memberUID string) string {
+	return sessionID + instanceid.Delim + memberUID
+}
+
+func decode(doc *firestore.DocumentSnapshot) (*Booking, error) {
+	var b Booking
+	if err := doc.DataTo(&b); err != nil {
+		return nil, fmt.Errorf("failed to decode recurring booking: %w", err)
+	}
+	b.ID = doc.Ref.ID
+	return &b, nil
+}
+
+func (s *Service) get(ctx context.Context, dojoID, id string) (*Booking, error) {
+	doc, err := s.col(dojoID).Doc(id).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load recurring booking: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: recurring booking not found", ErrNotFound)
+	}
+	return decode(doc)
+}
+
+// authorize loads a hold the caller may change: their own, or any as staff
+func (s *Service) authorize(ctx context.Context, uid, dojoID, id string) (*Booking, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	id = strings.TrimSpace(id)
+	if dojoID == "" || id == "" {
+		return nil, fmt.Errorf("%w: dojoId and id are required", ErrBadRequest)
+	}
+	b, err := s.get(ctx, dojoID, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.MemberUID == uid {
+		return b, nil
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: members can only change their own recurring bookings", ErrUnauthorized)
+	}
+	return b, nil
+}
+
+// List lists a dojo's recurring bookings that are not cancelled, by class
+// and queue position. Staff see everyone's; members only their own.
+func (s *Service) List(ctx context.Context, uid, dojoID string, in ListInput) ([]Booking, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	in.SessionID = strings.TrimSpace(in.SessionID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+
+	q := s.col(dojoID).Query
+	if !isStaff {
+		q = q.Where("memberUid", "==", uid)
+	} else if in.SessionID != "" {
+		q = q.Where("sessionId", "==", in.SessionID)
+	}
+
+	out := []Booking{}
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recurring bookings: %w", err)
+		}
+		b, err := decode(doc)
+		if err != nil || b.Status == StatusCancelled {
+			continue
+		}
+		if in.SessionID != "" && b.SessionID != in.SessionID {
+			continue
+		}
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SessionID != out[j].SessionID {
+			return out[i].SessionID < out[j].SessionID
+		}
+		return out[i].QueuedAt.Before(out[j].QueuedAt)
+	})
+	return out, nil
+}
+
+// Create gives a member a recurring place in a capacity-limited class, or a
+// place on its waitlist when the class is fully held. Members book for
+// themselves; staff can book for any member.
+func (s *Service) Create(ctx context.Context, uid, dojoID string, in CreateInput) (*Booking, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	in.SessionID = strings.TrimSpace(in.SessionID)
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	if dojoID == "" || in.SessionID == "" {
+		return nil, fmt.Errorf("%w: dojoId and sessionId are required", ErrBadRequest)
+	}
+	if in.MemberUID == "" {
+		in.MemberUID = uid
+	}
+	if in.MemberUID != uid {
+		isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check staff status: %w", err)
+		}
+		if !isStaff {
+			return nil, fmt.Errorf("%w: members can only book for themselves", ErrUnauthorized)
+		}
+	}
+	m, err := s.dojoRepo.GetMember(ctx, dojoID, in.MemberUID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: only dojo members can hold a class", ErrBadRequest)
+	}
+
+	sess, err := s.sessions.Get(ctx, dojoID, in.SessionID)
+	if err != nil {
+		if session.IsErrNotFound(err) {
+			return nil, fmt.Errorf("%w: class not found", ErrNotFound)
+		}
+		return nil, err
+	}
+	if !sess.IsActive {
+		return nil, fmt.Errorf("%w: %s is not on the timetable", ErrBadRequest, sess.Title)
+	}
+	if sess.MaxCapacity <= 0 {
+		return nil, fmt.Errorf("%w: %s has no capacity limit; members can just turn up", ErrBadRequest, sess.Title)
+	}
+
+	id := bookingID(sess.ID, in.MemberUID)
+	ref := s.col(dojoID).Doc(id)
+	now := time.Now().UTC()
+	err = s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to load recurring booking: %w", err)
+		}
+		if doc.Exists() {
+			if status, _ := doc.Data()["status"].(string); status != StatusCancelled {
+				return fmt.Errorf("%w: already holds %s (%s)", ErrConflict, sess.Title, status)
+			}
+		}
+		return tx.Set(ref, Booking{
+			SessionID:    sess.ID,
+			SessionTitle: sess.Title,
+			MemberUID:    in.MemberUID,
+			MemberName:   m.FullName,
+			Status:       StatusWaitlisted,
+			QueuedAt:     now,
+			CreatedBy:    uid,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		})
+	})
+	if err != nil {
+		if IsErrConflict(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create recurring booking: %w", err)
+	}
+
+	// the new hold takes a free place, if there is one, right away
+	if err := s.settle(ctx, dojoID, sess, now, &RunResult{}); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, dojoID, id)
+}
+
+// Pause freezes a hold until the given date, e.g. for an injury or a trip.
+// Its generated reservations are released and its place goes to the
+// waitlist; from until on it is first in line for the next free place.
+func (s *Service) Pause(ctx context.Context, uid, dojoID, id string, in PauseInput) (*Booking, error) {
+	b, err := s.authorize(ctx, uid, dojoID, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status == StatusCancelled {
+		return nil, fmt.Errorf("%w: the recurring booking was cancelled", ErrBadRequest)
+	}
+	now := time.Now().UTC()
+	until, err := time.Parse(instanceid.DateLayout, strings.TrimSpace(in.Until))
+	if err != nil {
+		return nil, fmt.Errorf("%w: until must be YYYY-MM-DD", ErrBadRequest)
+	}
+	if !until.After(now) {
+		return nil, fmt.Errorf("%w: until must be in the future", ErrBadRequest)
+	}
+	if until.Sub(now) > maxPauseDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: a recurring booking can be paused for at most %d days", ErrBadRequest, maxPauseDays)
+	}
+
+	if err := s.release(ctx, dojoID, b, now, map[string]interface{}{
+		"status":      StatusPaused,
+		"pausedUntil": until.Format(instanceid.DateLayout),
+	}); err != nil {
+		return nil, err
+	}
+	if err := s.settleClass(ctx, dojoID, b.SessionID, now); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, dojoID, b.ID)
+}
+
+// Resume ends a pause early. The hold rejoins the queue in its old position.
+func (s *Service) Resume(ctx context.Context, uid, dojoID, id string) (*Booking, error) {
+	b, err := s.authorize(ctx, uid, dojoID, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status != StatusPaused {
+		return nil, fmt.Errorf("%w: the recurring booking is not paused", ErrBadRequest)
+	}
+	now := time.Now().UTC()
+	if _, err := s.col(dojoID).Doc(b.ID).Update(ctx, []firestore.Update{
+		{Path: "status", Value: StatusWaitlisted},
+		{Path: "pausedUntil", Value: firestore.Delete},
+		{Path: "updatedAt", Value: now},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to resume recurring booking: %w", err)
+	}
+	if err := s.settleClass(ctx, dojoID, b.SessionID, now); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, dojoID, b.ID)
+}
+
+// Cancel gives up a hold: its generated reservations are released and its
+// place goes to the waitlist
+func (s *Service) Cancel(ctx context.Context, uid, dojoID, id string) error {
+	b, err := s.authorize(ctx, uid, dojoID, id)
+	if err != nil {
+		return err
+	}
+	if b.Status == StatusCancelled {
+		return nil
+	}
+	now := time.Now().UTC()
+	if err := s.release(ctx, dojoID, b, now, map[string]interface{}{"status": StatusCancelled}); err != nil {
+		return err
+	}
+	return s.settleClass(ctx, dojoID, b.SessionID, now)
+}
+
+// CancelMember cancels every hold of a member who left the dojo
+func (s *Service) CancelMember(ctx context.Context, dojoID, memberUID string) error {
+	docs, err := s.col(dojoID).Where("memberUid", "==", memberUID).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list recurring bookings: %w", err)
+	}
+	now := time.Now().UTC()
+	for _, doc := range docs {
+		b, err := decode(doc)
+		if err != nil || b.Status == StatusCancelled {
+			continue
+		}
+		if err := s.release(ctx, dojoID, b, now, map[string]interface{}{"status": StatusCancelled}); err != nil {
+			return err
+		}
+		if err := s.settleClass(ctx, dojoID, b.SessionID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release deletes the hold's generated reservations from tomorrow on and
+// applies the status change. Today's class is left alone.
+func (s *Service) release(ctx context.Context, dojoID string, b *Booking, now time.Time, updates map[string]interface{}) error {
+	if b.BookedThrough != "" {
+		for _, dateKey := range upcomingDates(now, b.BookedThrough) {
+			if _, err := s.sessions.ReleaseRecurringReservation(ctx, dojoID, b.SessionID, dateKey, b.MemberUID, b.ID); err != nil {
+				return err
+			}
+		}
+	}
+	updates["bookedThrough"] = firestore.Delete
+	updates["updatedAt"] = now
+	if _, err := s.col(dojoID).Doc(b.ID).Set(ctx, updates, firestore.MergeAll); err != nil {
+		return fmt.Errorf("failed to update recurring booking: %w", err)
+	}
+	return nil
+}
+
+// settleClass settles one class after a hold changed. Holds of a class that
+// is gone are left to Run, which cancels them.
+func (s *Service) settleClass(ctx context.Context, dojoID, sessionID string, now time.Time) error {
+	sess, err := s.sessions.Get(ctx, dojoID, sessionID)
+	if err != nil {
+		if session.IsErrNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return s.settle(ctx, dojoID, sess, now, &RunResult{})
+}
+
+// upcomingDates lists the dates from tomorrow through last
+func upcomingDates(now time.Time, last string) []string {
+	var out []string
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= DaysAhead+7; i++ {
+		dateKey := day.AddDate(0, 0, i).Format(instanceid.DateLayout)
+		if dateKey > last {
+			break
+		}
+		out = append(out, dateKey)
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"dojo-manager/backend/internal/domain/families"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Guardian push kinds
+const (
+	GuardianCheckin  = "checkin"
+	GuardianCheckout = "checkout"
+)
+
+// SetFamilyService enables guardian pushes, sent to the payer of a child's
+// family when the child is checked in to or out of a kids class. Needs
+// SetClassServices for the class.
+func (s *Service) SetFamilyService(families *families.Service) {
+	s.families = families
+}
+
+// NotifyGuardians pushes the guardian of each child checked in to or out of
+// the class instance, if it is a kids class (classType "kids" or kidsOnly).
+// Guardians who opted out, and children with no guardian, are skipped.
+// Failures are logged; attendance is recorded either way.
+func (s *Service) NotifyGuardians(ctx context.Context, kind, dojoID, instanceID string, childUIDs []string) {
+	if s.messaging == nil || s.sessions == nil || s.families == nil || len(childUIDs) == 0 {
+		return
+	}
+	sessionID := instanceid.SessionID(instanceID)
+	if sessionID == "" {
+		return
+	}
+	sess, err := s.sessions.Get(ctx, dojoID, sessionID)
+	if err != nil || !isKidsClass(sess) {
+		return
+	}
+
+	dojoName := s.dojoName(ctx, dojoID)
+	for _, child := range childUIDs {
+		guardian, err := s.families.GuardianOf(ctx, dojoID, child)
+		if err != nil {
+			log.Printf("guardian push %s/%s: %v", dojoID, child, err)
+			continue
+		}
+		if guardian == "" {
+			continue
+		}
+		prefs, tokens, _ := s.recipient(ctx, guardian)
+		if prefs.GuardianOptOut || len(tokens) == 0 {
+			continue
+		}
+
+		title, body := guardianText(kind, s.userName(ctx, child), sess.Title, dojoName)
+		data := map[string]string{
+			"type":              "guardian_" + kind,
+			"dojoId":            dojoID,
+			"sessionInstanceId": instanceID,
+			"memberUid":         child,
+		}
+		if err := s.push(ctx, guardian, tokens, title, body, data); err != nil {
+			log.Printf("guardian push %s/%s: %v", dojoID, child, err)
+		}
+	}
+}
+
+func isKidsClass(sess *session.Session) bool {
+	return sess.ClassType == "kids" || sess.KidsOnly
+}
+
+// userName is the display name of a user, "Your child" if there is none
+func (s *Service) userName(ctx context.Context, uid string) string {
+	doc, err := s.fs.Collection("users").Doc(uid).Get(ctx)
+	if err == nil && doc.Exists() {
+		if name, _ := doc.Data()["displayName"].(string); name != "" {
+			return name
+		}
+	}
+	return "Your child"
+}
+
+func guardianText(kind, child, class, dojoName string) (string, string) {
+	verb, prep := "checked in", "to"
+	if kind == GuardianCheckout {
+		verb, prep = "checked out", "of"
+	}
+	title := fmt.Sprintf("%s was %s", child, verb)
+	body := fmt.Sprintf("%s was %s %s %s.", child, verb, prep, class)
+	if dojoName != "" {
+		body = fmt.Sprintf("%s was %s %s %s at %s.", child, verb, prep, class, dojoName)
+	}
+	return title, body
+}
@@ -0,0 +1,88 @@
+package reminders
+
+import "time"
+
+// Preferences is users/{uid}.reminderPrefs. Reminders are opt-in per channel;
+// guardians get check-in and check-out pushes for their children unless they
+// opt out.
+type Preferences struct {
+	Push           bool `firestore:"push" json:"push"`
+	Email          bool `firestore:"email" json:"email"`
+	GuardianOptOut bool `firestore:"guardianOptOut" json:"guardianOptOut"`
+}
+
+// UpdatePreferencesInput updates reminder opt-ins (nil fields are left unchanged)
+type UpdatePreferencesInput struct {
+	Push           *bool `json:"push,omitempty"`
+	Email          *bool `json:"email,omitempty"`
+	GuardianOptOut *bool `json:"guardianOptOut,omitempty"`
+}
+
+// Send is a reminderSends/{bookingId} document, written once per booking
+// so overlapping scheduler runs never remind twice.
+type Send struct {
+	BookingID string    `firestore:"bookingId" json:"bookingId"`
+	DojoID    string    `firestore:"dojoId" json:"dojoId"`
+	UserID    string    `firestore:"userId" json:"userId"`
+	StartAt   time.Time `firestore:"startAt" json:"startAt"`
+	Channels  []string  `firestore:"channels" json:"channels"` // "push", "email"
+	SentAt    time.Time `firestore:"sentAt" json:"sentAt"`
+}
+
+// RunInput configures one scheduler run
+type RunInput struct {
+	// WindowMinutes: bookings starting within now..now+window are reminded (default 120)
+	WindowMinutes int `json:"windowMinutes,omitempty"`
+}
+
+// RunResult summarizes a scheduler run
+type RunResult struct {
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	Scanned     int       `json:"scanned"`
+	Reminded    int       `json:"reminded"`
+	PushSent    int       `json:"pushSent"`
+	EmailQueued int       `json:"emailQueued"`
+	Skipped     int       `json:"skipped"` // already reminded, cancelled or not opted in
+	Failed      int       `json:"failed"`
+}
+
+// DefaultRollCallDelay is how long after the start a class with no
+// attendance gets its coach reminded, when the dojo has not set one
+const DefaultRollCallDelay = 10
+
+// RollCallSettings is dojos/{dojoId}/settings/rollCall (server-only). Class
+// start times are wall-clock times, so the reminder needs the dojo's timezone.
+type RollCallSettings struct {
+	Enabled      bool      `firestore:"enabled" json:"enabled"`
+	DelayMinutes int       `firestore:"delayMinutes" json:"delayMinutes"`
+	Timezone     string    `firestore:"timezone" json:"timezone"` // IANA name, "" = UTC
+	UpdatedAt    time.Time `firestore:"updatedAt" json:"updatedAt,omitempty"`
+	UpdatedBy    string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdateRollCallInput updates roll-call reminders (nil fields are left unchanged)
+type UpdateRollCallInput struct {
+	Enabled      *bool   `json:"enabled,omitempty"`
+	DelayMinutes *int    `json:"delayMinutes,omitempty"`
+	Timezone     *string `json:"timezone,omitempty"`
+}
+
+// RollCallSend is dojos/{dojoId}/rollCallReminders/{instanceId}, written once
+// per class instance so overlapping scheduler runs never remind twice
+type RollCallSend struct {
+	SessionID     string    `firestore:"sessionId" json:"sessionId"`
+	InstructorUID string    `firestore:"instructorUid" json:"instructorUid"`
+	SentAt        time.Time `firestore:"sentAt" json:"sentAt"`
+}
+
+// RollCallResult summarizes a roll-call scheduler run
+type RollCallResult struct {
+	DojosChecked int  `json:"dojosChecked"`
+	DojosEnabled int  `json:"dojosEnabled"`
+	Classes      int  `json:"classes"`  // classes due for a reminder in this run
+	Reminded     int  `json:"reminded"` // coaches pushed
+	Skipped      int  `json:"skipped"`  // attendance taken, already reminded, no coach or no device
+	Failed       int  `json:"failed"`
+	Partial      bool `json:"partial,omitempty"` // the run hit the request deadline
+}
@@ -0,0 +1,215 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	maxRollCallDelay = 120
+
+	// rollCallWindow is how long after it is due a reminder is still sent,
+	// so a scheduler that was down does not nag about classes long over
+	rollCallWindow = 60
+)
+
+func (s *Service) rollCallRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("rollCall")
+}
+
+func (s *Service) rollCallSettings(ctx context.Context, dojoID string) (*RollCallSettings, error) {
+	doc, err := s.rollCallRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load roll-call settings: %w", err)
+	}
+	st := &RollCallSettings{}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode roll-call settings: %w", err)
+		}
+	}
+	if st.DelayMinutes <= 0 {
+		st.DelayMinutes = DefaultRollCallDelay
+	}
+	return st, nil
+}
+
+// GetRollCallSettings returns the dojo's roll-call reminder settings
+func (s *Service) GetRollCallSettings(ctx context.Context, dojoID string) (*RollCallSettings, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	return s.rollCallSettings(ctx, dojoID)
+}
+
+// UpdateRollCallSettings turns roll-call reminders on or off and sets the
+// delay and the timezone class start times are in
+func (s *Service) UpdateRollCallSettings(ctx context.Context, staffUID, dojoID string, in UpdateRollCallInput) (*RollCallSettings, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.DelayMinutes != nil && (*in.DelayMinutes < 1 || *in.DelayMinutes > maxRollCallDelay) {
+		return nil, fmt.Errorf("%w: delayMinutes must be 1-%d", ErrBadRequest, maxRollCallDelay)
+	}
+	if in.Timezone != nil {
+		*in.Timezone = strings.TrimSpace(*in.Timezone)
+		if _, err := time.LoadLocation(*in.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrBadRequest, *in.Timezone)
+		}
+	}
+
+	st, err := s.rollCallSettings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Enabled != nil {
+		st.Enabled = *in.Enabled
+	}
+	if in.DelayMinutes != nil {
+		st.DelayMinutes = *in.DelayMinutes
+	}
+	if in.Timezone != nil {
+		st.Timezone = *in.Timezone
+	}
+	st.UpdatedAt = time.Now().UTC()
+	st.UpdatedBy = staffUID
+	if _, err := s.rollCallRef(dojoID).Set(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save roll-call settings: %w", err)
+	}
+	return st, nil
+}
+
+// SendRollCallReminders pushes the scheduled coach of every class that
+// started DelayMinutes ago with no attendance recorded yet, in dojos that
+// turned the reminders on. Meant to be triggered by Cloud Scheduler every few
+// minutes; each class instance is claimed in the dojo's rollCallReminders so
+// its coach is reminded once. Cancelled dates are skipped.
+func (s *Service) SendRollCallReminders(ctx context.Context, now time.Time) (*RollCallResult, error) {
+	if s.sessions == nil || s.attendance == nil || s.messaging == nil {
+		return nil, fmt.Errorf("%w: roll-call reminders need push messaging", ErrBadRequest)
+	}
+	res := &RollCallResult{}
+
+	iter := s.fs.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+		dojoID := doc.Ref.ID
+		st, err := s.rollCallSettings(ctx, dojoID)
+		if err != nil || !st.Enabled {
+			continue
+		}
+		res.DojosEnabled++
+
+		if err := s.rollCallDojo(ctx, dojoID, st, now, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			log.Printf("roll call: dojo %s: %v", dojoID, err)
+		}
+	}
+
+	log.Printf("roll call: %d dojos checked, %d enabled, %d classes due, %d reminded, %d skipped, %d failed (partial=%v)",
+		res.DojosChecked, res.DojosEnabled, res.Classes, res.Reminded, res.Skipped, res.Failed, res.Partial)
+	return res, nil
+}
+
+func (s *Service) rollCallDojo(ctx context.Context, dojoID string, st *RollCallSettings, now time.Time, res *RollCallResult) error {
+	loc, err := time.LoadLocation(st.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	dateKey := local.Format(instanceid.DateLayout)
+	minute := local.Hour()*60 + local.Minute()
+
+	classes, err := s.sessions.ListByDay(ctx, dojoID, int(local.Weekday()))
+	if err != nil {
+		return err
+	}
+	var dojoName string
+	for i := range classes {
+		sess := &classes[i]
+		due := sess.StartMinute + st.DelayMinutes
+		if minute < due || minute >= due+rollCallWindow || !sess.HeldOn(dateKey) {
+			continue
+		}
+		res.Classes++
+		if sess.InstructorUID == "" {
+			res.Skipped++
+			continue
+		}
+
+		instanceID := instanceid.New(dateKey, sess.ID)
+		taken, err := s.attendance.List(ctx, attendance.ListAttendanceInput{DojoID: dojoID, SessionInstanceID: instanceID, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			res.Skipped++
+			continue
+		}
+		_, tokens, _ := s.recipient(ctx, sess.InstructorUID)
+		if len(tokens) == 0 {
+			res.Skipped++
+			continue
+		}
+
+		ref := s.fs.Collection("dojos").Doc(dojoID).Collection("rollCallReminders").Doc(instanceID)
+		if _, err := ref.Create(ctx, RollCallSend{SessionID: sess.ID, InstructorUID: sess.InstructorUID, SentAt: now.UTC()}); err != nil {
+			// already reminded by an earlier or overlapping run
+			res.Skipped++
+			continue
+		}
+
+		if dojoName == "" {
+			dojoName = s.dojoName(ctx, dojoID)
+		}
+		title, body := rollCallText(dojoName, sess)
+		data := map[string]string{"type": "rollcall_reminder", "dojoId": dojoID, "sessionInstanceId": instanceID}
+		if err := s.push(ctx, sess.InstructorUID, tokens, title, body, data); err != nil {
+			log.Printf("roll call %s/%s: push failed: %v", dojoID, instanceID, err)
+			// let the next run try again while the class is still in the window
+			_, _ = ref.Delete(ctx)
+			res.Failed++
+			continue
+		}
+		res.Reminded++
+	}
+	return nil
+}
+
+func rollCallText(dojoName string, sess *session.Session) (string, string) {
+	title := "Take attendance"
+	if dojoName != "" {
+		title = "Take attendance: " + dojoName
+	}
+	body := fmt.Sprintf("%s started at %s and has no attendance recorded yet.", sess.Title, sess.StartTime)
+	return title, body
+}
@@ -0,0 +1,295 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/families"
+	"dojo-manager/backend/internal/domain/pushtokens"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/mailqueue"
+)
+
+const (
+	defaultWindowMinutes = 120
+	maxWindowMinutes     = 24 * 60
+
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+)
+
+// skipStatuses are booking statuses that never get a reminder
+var skipStatuses = map[string]bool{"cancelled": true, "declined": true}
+
+type Service struct {
+	fs        *firestore.Client
+	messaging *messaging.Client   // FCM (optional)
+	tokens    *pushtokens.Service // drops dead FCM tokens (optional)
+
+	// roll-call reminders (optional)
+	sessions   *session.Service
+	attendance *attendance.Service
+
+	families *families.Service // guardian check-in pushes (optional)
+}
+
+func NewService(fs *firestore.Client) *Service {
+	return &Service{fs: fs}
+}
+
+// SetMessagingClient enables push reminders
+func (s *Service) SetMessagingClient(msg *messaging.Client) {
+	s.messaging = msg
+}
+
+// SetTokenService lets push sends remove tokens FCM rejects
+func (s *Service) SetTokenService(tokens *pushtokens.Service) {
+	s.tokens = tokens
+}
+
+// SetClassServices enables roll-call reminders, which read the timetable
+// and the attendance taken
+func (s *Service) SetClassServices(sessions *session.Service, attendance *attendance.Service) {
+	s.sessions = sessions
+	s.attendance = attendance
+}
+
+// GetPreferences returns the caller's reminder opt-ins
+func (s *Service) GetPreferences(ctx context.Context, uid string) (Preferences, error) {
+	prefs, _, _ := s.recipient(ctx, uid)
+	return prefs, nil
+}
+
+// UpdatePreferences sets the caller's reminder opt-ins
+func (s *Service) UpdatePreferences(ctx context.Context, uid string, in UpdatePreferencesInput) (Preferences, error) {
+	prefs, err := s.GetPreferences(ctx, uid)
+	if err != nil {
+		return prefs, err
+	}
+	if in.Push != nil {
+		prefs.Push = *in.Push
+	}
+	if in.Email != nil {
+		prefs.Email = *in.Email
+	}
+	if in.GuardianOptOut != nil {
+		prefs.GuardianOptOut = *in.GuardianOptOut
+	}
+	_, err = s.fs.Collection("users").Doc(uid).Set(ctx, map[string]interface{}{
+		"reminderPrefs": prefs,
+		"updatedAt":     time.Now().UTC(),
+	}, firestore.MergeAll)
+	if err != nil {
+		return prefs, fmt.Errorf("failed to save reminder preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// SendBookingReminders reminds opted-in users of bookings starting within the
+// window. Meant to be triggered by Cloud Scheduler every few minutes; each
+// booking is claimed in reminderSends before sending so it is reminded once.
+func (s *Service) SendBookingReminders(ctx context.Context, now time.Time, in RunInput) (*RunResult, error) {
+	window := in.WindowMinutes
+	if window == 0 {
+		window = defaultWindowMinutes
+	}
+	if window < 0 || window > maxWindowMinutes {
+		return nil, fmt.Errorf("%w: windowMinutes must be 1-%d", ErrBadRequest, maxWindowMinutes)
+	}
+
+	res := &RunResult{
+		WindowStart: now.UTC(),
+		WindowEnd:   now.UTC().Add(time.Duration(window) * time.Minute),
+	}
+
+	iter := s.fs.Collection("bookings").
+		Where("startAt", ">=", res.WindowStart).
+		Where("startAt", "<=", res.WindowEnd).
+		Documents(ctx)
+	defer iter.Stop()
+
+	dojoNames := map[string]string{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("failed to scan bookings: %w", err)
+		}
+		res.Scanned++
+
+		data := doc.Data()
+		status, _ := data["status"].(string)
+		userID, _ := data["userId"].(string)
+		dojoID, _ := data["dojoId"].(string)
+		startAt, _ := data["startAt"].(time.Time)
+		if userID == "" || skipStatuses[status] {
+			res.Skipped++
+			continue
+		}
+
+		prefs, tokens, email := s.recipient(ctx, userID)
+		channels := []string{}
+		if prefs.Push && len(tokens) > 0 && s.messaging != nil {
+			channels = append(channels, ChannelPush)
+		}
+		if prefs.Email && email != "" {
+			channels = append(channels, ChannelEmail)
+		}
+		if len(channels) == 0 {
+			res.Skipped++
+			continue
+		}
+
+		claimed, err := s.claim(ctx, Send{
+			BookingID: doc.Ref.ID,
+			DojoID:    dojoID,
+			UserID:    userID,
+			StartAt:   startAt,
+			Channels:  channels,
+			SentAt:    now.UTC(),
+		})
+		if err != nil {
+			log.Printf("booking reminder %s: claim failed: %v", doc.Ref.ID, err)
+			res.Failed++
+			continue
+		}
+		if !claimed {
+			res.Skipped++
+			continue
+		}
+
+		if _, ok := dojoNames[dojoID]; !ok {
+			dojoNames[dojoID] = s.dojoName(ctx, dojoID)
+		}
+		title, body := reminderText(dojoNames[dojoID], startAt)
+
+		sent := false
+		for _, ch := range channels {
+			switch ch {
+			case ChannelPush:
+				data := map[string]string{"type": "booking_reminder", "bookingId": doc.Ref.ID, "dojoId": dojoID}
+				if err := s.push(ctx, userID, tokens, title, body, data); err != nil {
+					log.Printf("booking reminder %s: push failed: %v", doc.Ref.ID, err)
+					continue
+				}
+				res.PushSent++
+				sent = true
+			case ChannelEmail:
+				if err := mailqueue.Queue(ctx, s.fs, mailqueue.Email{To: email, Subject: title, Text: body}, time.Now().UTC()); err != nil {
+					log.Printf("booking reminder %s: email failed: %v", doc.Ref.ID, err)
+					continue
+				}
+				res.EmailQueued++
+				sent = true
+			}
+		}
+		if sent {
+			res.Reminded++
+		} else {
+			res.Failed++
+		}
+	}
+
+	return res, nil
+}
+
+// claim records the send; false means another run already reminded this booking
+func (s *Service) claim(ctx context.Context, send Send) (bool, error) {
+	ref := s.fs.Collection("reminderSends").Doc(send.BookingID)
+	claimed := false
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		doc, err := tx.Get(ref)
+		if err == nil && doc.Exists() {
+			return nil
+		}
+		if err != nil && doc == nil {
+			return err
+		}
+		claimed = true
+		return tx.Create(ref, send)
+	})
+	return claimed, err
+}
+
+// recipient loads reminder prefs, FCM tokens and email of a user
+func (s *Service) recipient(ctx context.Context, uid string) (Preferences, []string, string) {
+	var prefs Preferences
+	doc, err := s.fs.Collection("users").Doc(uid).Get(ctx)
+	if err != nil || !doc.Exists() {
+		return prefs, nil, ""
+	}
+	data := doc.Data()
+	if m, ok := data["reminderPrefs"].(map[string]interface{}); ok {
+		prefs.Push, _ = m["push"].(bool)
+		prefs.Email, _ = m["email"].(bool)
+		prefs.GuardianOptOut, _ = m["guardianOptOut"].(bool)
+	}
+	var tokens []string
+	if raw, ok := data["fcmTokens"].([]interface{}); ok {
+		for _, t := range raw {
+			if tok, ok := t.(string); ok && tok != "" {
+				tokens = append(tokens, tok)
+			}
+		}
+	}
+	email, _ := data["email"].(string)
+	return prefs, tokens, email
+}
+
+func (s *Service) dojoName(ctx context.Context, dojoID string) string {
+	if dojoID == "" {
+		return ""
+	}
+	doc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil || !doc.Exists() {
+		return ""
+	}
+	name, _ := doc.Data()["name"].(string)
+	return name
+}
+
+// push sends title/body to every device of uid; data["type"] tells the app
+// which screen to open
+func (s *Service) push(ctx context.Context, uid string, tokens []string, title, body string, data map[string]string) error {
+	resp, err := s.messaging.SendEachForMulticast(ctx, &messaging.MulticastMessage{
+		Tokens: tokens,
+		Notification: &messaging.Notification{
+			Title: title,
+			Body:  body,
+		},
+		Data: data,
+	})
+	if err != nil {
+		return err
+	}
+	if s.tokens != nil {
+		if removed, err := s.tokens.RecordResults(ctx, uid, tokens, resp); err != nil {
+			log.Printf("%s: %v", data["type"], err)
+		} else if removed > 0 {
+			log.Printf("%s: removed %d dead fcm tokens of %s", data["type"], removed, uid)
+		}
+	}
+	if resp.SuccessCount == 0 {
+		return fmt.Errorf("all %d tokens failed", resp.FailureCount)
+	}
+	return nil
+}
+
+func reminderText(dojoName string, startAt time.Time) (string, string) {
+	title := "Class reminder"
+	if dojoName != "" {
+		title = "Class reminder: " + dojoName
+	}
+	body := fmt.Sprintf("Your class starts at %s UTC.", startAt.UTC().Format("Mon Jan 2 15:04"))
+	return title, body
+}
@@ -0,0 +1,127 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/chatops"
+	"dojo-manager/backend/internal/domain/dojo"
+)
+
+// maxAnnouncedNames caps the members listed in one chat post
+const maxAnnouncedNames = 10
+
+// AnnounceResult summarizes an AnnounceCritical run
+type AnnounceResult struct {
+	DojosChecked int  `json:"dojosChecked"`
+	DojosEnabled int  `json:"dojosEnabled"`
+	Announced    int  `json:"announced"` // members newly past the critical threshold
+	Posts        int  `json:"posts"`
+	Failed       int  `json:"failed"`  // posts that failed; their members are retried next run
+	Partial      bool `json:"partial"` // the deadline hit first; run again to finish
+}
+
+// AnnounceCritical posts, for every dojo that selected the at-risk event,
+// the members who crossed the critical threshold since the last run. Meant
+// to be triggered daily by Cloud Scheduler. A member is announced once per
+// absence (keyed by their last class), and members who never attended are
+// left out since they never crossed anything.
+func (s *Service) AnnounceCritical(ctx context.Context, now time.Time) (*AnnounceResult, error) {
+	if s.chatops == nil {
+		return nil, fmt.Errorf("%w: chat webhooks are not configured", ErrBadRequest)
+	}
+	res := &AnnounceResult{}
+
+	iter := s.fs.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+		dojoID := doc.Ref.ID
+		if !s.chatops.Wants(ctx, dojoID, chatops.EventAtRiskCritical) {
+			continue
+		}
+		res.DojosEnabled++
+
+		if err := s.announceDojo(ctx, dojoID, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			log.Printf("retention: announce dojo %s: %v", dojoID, err)
+		}
+	}
+
+	log.Printf("retention: %d dojos checked, %d enabled, %d members announced in %d posts, %d failed (partial=%v)",
+		res.DojosChecked, res.DojosEnabled, res.Announced, res.Posts, res.Failed, res.Partial)
+	return res, nil
+}
+
+func (s *Service) announceDojo(ctx context.Context, dojoID string, res *AnnounceResult) error {
+	summary, err := s.alerts(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	if summary.Partial {
+		// an incomplete scan overstates absences; wait for a full one
+		return nil
+	}
+
+	var keys, lines []string
+	for _, a := range summary.Alerts {
+		if a.RiskLevel != RiskCritical || a.DaysSinceLastAttendance < 0 {
+			continue
+		}
+		key := a.MemberUID + "_" + a.LastAttendedDate
+		if !s.chatops.Claim(ctx, dojoID, chatops.EventAtRiskCritical, key) {
+			continue
+		}
+		keys = append(keys, key)
+		if len(lines) < maxAnnouncedNames {
+			name := a.DisplayName
+			if name == "" {
+				name = "Unnamed member"
+			}
+			lines = append(lines, fmt.Sprintf("%s: %d days since their last class (%s)",
+				name, a.DaysSinceLastAttendance, a.LastAttendedDate))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if more := len(keys) - len(lines); more > 0 {
+		lines = append(lines, fmt.Sprintf("and %d more", more))
+	}
+
+	title := "1 member crossed the critical absence threshold"
+	if len(keys) > 1 {
+		title = fmt.Sprintf("%d members crossed the critical absence threshold", len(keys))
+	}
+	if err := s.chatops.Send(ctx, dojoID, chatops.EventAtRiskCritical, chatops.Message{Title: title, Lines: lines}); err != nil {
+		res.Failed++
+		for _, key := range keys {
+			s.chatops.Release(ctx, dojoID, chatops.EventAtRiskCritical, key)
+		}
+		return err
+	}
+	res.Posts++
+	res.Announced += len(keys)
+	return nil
+}
@@ -0,0 +1,176 @@
+package retention
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ─────────────────────────────────────────────
+// Churn scoring
+// ─────────────────────────────────────────────
+//
+// Every student gets a churn probability in [0, 1] (and a 0-100 score) from a
+// logistic model over six signals, so staff can order outreach by who is most
+// likely to quit instead of by a fixed day count:
+//
+//	z = -2.0
+//	    + 1.2 × recency     days since last class ÷ thresholdDays, capped at 4 (never attended = 4)
+//	    - 1.0 × trend       (last 4 weeks − previous 4 weeks) ÷ max(previous, 1), clamped to [-1, 1]
+//	    - 0.6 × frequency   classes per week over the last 4 weeks, capped at 3
+//	    + tenure            +0.8 under 90 days, +0.4 under a year, 0 after
+//	    + belt              white +0.6, kids belts +0.3, blue +0.2, purple 0, brown -0.2, black -0.4
+//	    - 0.5 × app         days the app was opened in the last 4 weeks ÷ 8, capped at 1
+//	p = 1 / (1 + e^-z)
+//
+// The weights are hand-tuned from how BJJ gyms typically lose students (new
+// white belts whose attendance is tapering off), not fitted to this dojo's
+// data, so treat the probability as a ranking rather than a calibrated
+// forecast. App use only ever lowers the score: members of dojos that do not
+// use the app, or who have not opened it, score as before. Members with p ≥ ChurnWatchProbability are alerted even when they
+// are still inside the day-count thresholds.
+
+const (
+	churnWindowDays = 28
+
+	// ChurnWatchProbability surfaces members whose day count looks fine but
+	// whose trend does not
+	ChurnWatchProbability = 0.5
+)
+
+// Churn factor codes returned with each alert (strongest first)
+const (
+	FactorInactive      = "inactive"
+	FactorNeverAttended = "never_attended"
+	FactorDeclining     = "declining_attendance"
+	FactorLowFrequency  = "low_frequency"
+	FactorNewMember     = "new_member"
+	FactorWhiteBelt     = "white_belt"
+)
+
+// churnInput is what the model needs about one member
+type churnInput struct {
+	DaysSince     int // -1 = never
+	ThresholdDays int
+	Recent        int // check-ins in the last 4 weeks
+	Prior         int // check-ins in the 4 weeks before that
+	JoinedAt      time.Time
+	BeltRank      string
+	AppDays       int // days the app was opened in the last 4 weeks
+	Now           time.Time
+}
+
+type churnResult struct {
+	Probability float64
+	Score       int
+	Factors     []string
+}
+
+var beltWeights = map[string]float64{
+	"white":  0.6,
+	"grey":   0.3,
+	"gray":   0.3,
+	"yellow": 0.3,
+	"orange": 0.3,
+	"green":  0.3,
+	"blue":   0.2,
+	"purple": 0,
+	"brown":  -0.2,
+	"black":  -0.4,
+}
+
+// scoreChurn applies the model documented above
+func scoreChurn(in churnInput) churnResult {
+	threshold := in.ThresholdDays
+	if threshold <= 0 {
+		threshold = DefaultSettings().ThresholdDays
+	}
+	recency := 4.0
+	if in.DaysSince >= 0 {
+		recency = math.Min(float64(in.DaysSince)/float64(threshold), 4)
+	}
+
+	trend := 0.0
+	if in.Recent != in.Prior {
+		trend = float64(in.Recent-in.Prior) / math.Max(float64(in.Prior), 1)
+		trend = math.Max(-1, math.Min(1, trend))
+	}
+
+	perWeek := math.Min(float64(in.Recent)/(churnWindowDays/7), 3)
+
+	tenure := 0.0
+	if !in.JoinedAt.IsZero() {
+		days := in.Now.Sub(in.JoinedAt).Hours() / 24
+		switch {
+		case days < 90:
+			tenure = 0.8
+		case days < 365:
+			tenure = 0.4
+		}
+	}
+
+	beltRank := strings.ToLower(strings.TrimSpace(in.BeltRank))
+	belt := beltWeights[beltRank]
+
+	app := math.Min(float64(in.AppDays)/8, 1)
+
+	z := -2.0 + 1.2*recency - 1.0*trend - 0.6*perWeek + tenure + belt - 0.5*app
+	p := 1 / (1 + math.Exp(-z))
+
+	// name the signals pushing the score up, strongest first
+	type contribution struct {
+		factor string
+		value  float64
+	}
+	recencyFactor := FactorInactive
+	if in.DaysSince < 0 {
+		recencyFactor = FactorNeverAttended
+	}
+	contribs := []contribution{
+		{recencyFactor, 1.2 * recency},
+		{FactorDeclining, -1.0 * trend},
+		{FactorLowFrequency, 0.6 * (3 - perWeek)}, // shortfall from the cap
+		{FactorNewMember, tenure},
+	}
+	if beltRank == "white" {
+		contribs = append(contribs, contribution{FactorWhiteBelt, belt})
+	}
+	sort.SliceStable(contribs, func(i, j int) bool { return contribs[i].value > contribs[j].value })
+
+	factors := []string{}
+	for _, c := range contribs {
+		if c.value < 0.3 || len(factors) == 3 {
+			break
+		}
+		factors = append(factors, c.factor)
+	}
+
+	return churnResult{
+		Probability: math.Round(p*100) / 100,
+		Score:       int(math.Round(p * 100)),
+		Factors:     factors,
+	}
+}
+
+// SortByChurn orders alerts by predicted churn probability, highest first
+func SortByChurn(alerts []MemberAlert) {
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].ChurnProbability > alerts[j].ChurnProbability
+	})
+}
+
+// addCheckin counts a check-in on dateKey into the recent / prior windows
+func (a *attendanceSummary) addCheckin(dateKey string, now time.Time) {
+	if dateKey == "" {
+		return
+	}
+	days := daysBetween(dateKey, now)
+	switch {
+	case days < 0:
+	case days < churnWindowDays:
+		a.Recent++
+	case days < 2*churnWindowDays:
+		a.Prior++
+	}
+}
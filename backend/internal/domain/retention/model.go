@@ -68,6 +68,14 @@ type MemberAlert struct {
 	DaysSinceLastAttendance int       `json:"daysSinceLastAttendance"` // -1 = never
 	TotalSessions           int       `json:"totalSessions"`
 	RiskLevel               RiskLevel `json:"riskLevel"`
+
+	// Churn prediction (see churn.go for the scoring model)
+	ChurnProbability float64  `json:"churnProbability"`
+	ChurnScore       int      `json:"churnScore"`             // 0-100
+	ChurnFactors     []string `json:"churnFactors,omitempty"` // strongest first
+	RecentSessions   int      `json:"recentSessions"`         // last 4 weeks
+	PriorSessions    int      `json:"priorSessions"`          // the 4 weeks before
+	AppDays          int      `json:"appDays"`                // days the app was opened in the last 4 weeks
 }
 
 // AlertsSummary is the response for the alerts endpoint
@@ -77,6 +85,7 @@ type AlertsSummary struct {
 	Alerts    []MemberAlert `json:"alerts"`
 	Stats     AlertStats    `json:"stats"`
 	ScannedAt time.Time     `json:"scannedAt"`
+	Partial   bool          `json:"partial,omitempty"` // a scan hit the request deadline or its document budget, or Alerts was cut at its cap
 }
 
 // AlertStats holds aggregate counts
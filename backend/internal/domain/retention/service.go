@@ -3,6 +3,7 @@ package retention
 import (
 	"context"
 	"fmt"
+	"log"
 	"math"
 	"sort"
 	"time"
@@ -10,7 +11,13 @@ import (
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
 
+	"dojo-manager/backend/internal/domain/activity"
+	"dojo-manager/backend/internal/domain/chatops"
 	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/firebase"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+	"dojo-manager/backend/internal/scanbudget"
 )
 
 // ─────────────────────────────────────────────
@@ -19,11 +26,46 @@ import (
 
 type Service struct {
 	fs       *firestore.Client
+	dbs      firebase.ClientResolver // per-dojo database of sessions and attendance (data residency)
 	dojoRepo *dojo.Repo
+	chatops  *chatops.Service // critical member announcements (optional)
+	activity *activity.Service // app opens as a churn signal (optional)
+
+	scanBudget int // documents one alerts scan reads; 0 = defaultScanBudget
 }
 
 func NewService(fs *firestore.Client, dojoRepo *dojo.Repo) *Service {
-	return &Service{fs: fs, dojoRepo: dojoRepo}
+	return &Service{fs: fs, dbs: firebase.DefaultResolver{Client: fs}, dojoRepo: dojoRepo}
+}
+
+// SetClientResolver reads each dojo's attendance from its own database
+func (s *Service) SetClientResolver(resolver firebase.ClientResolver) {
+	s.dbs = resolver
+}
+
+// SetChatOps enables AnnounceCritical
+func (s *Service) SetChatOps(c *chatops.Service) {
+	s.chatops = c
+}
+
+// SetActivityService adds app use to churn scoring
+func (s *Service) SetActivityService(a *activity.Service) {
+	s.activity = a
+}
+
+const (
+	// defaultScanBudget caps the member and attendance docs one alerts
+	// scan reads (see scanbudget)
+	defaultScanBudget = 100000
+	// maxAlerts caps the alerts listed, most at risk first; Stats still
+	// counts them all
+	maxAlerts = 500
+)
+
+// SetScanBudget sets the documents one alerts scan may read. A scan that
+// reaches it stops there and the summary is flagged partial.
+func (s *Service) SetScanBudget(n int) {
+	s.scanBudget = n
 }
 
 // ─────────────────────────────────────────────
@@ -126,6 +168,7 @@ type memberInfo struct {
 	Stripes     int
 	IsKids      bool
 	RoleInDojo  string
+	JoinedAt    time.Time
 }
 
 // attendanceSummary tracks each member's latest attendance
@@ -133,6 +176,8 @@ type attendanceSummary struct {
 	LastDate     string // "YYYY-MM-DD"
 	LastTitle    string
 	TotalCount   int
+	Recent       int // check-ins in the last churnWindowDays
+	Prior        int // check-ins in the window before that
 }
 
 // staffRoles that should be excluded from retention alerts
@@ -155,14 +200,25 @@ func (s *Service) GetAlerts(ctx context.Context, staffUID, dojoID string) (*Aler
 		return nil, fmt.Errorf("%w: staff permission required", ErrUnauthorized)
 	}
 
+	return s.alerts(ctx, dojoID)
+}
+
+// alerts computes the at-risk members of a dojo (no permission check)
+func (s *Service) alerts(ctx context.Context, dojoID string) (*AlertsSummary, error) {
 	// Load settings
 	settings, err := s.GetSettings(ctx, dojoID)
 	if err != nil {
 		return nil, err
 	}
 
+	limit := s.scanBudget
+	if limit <= 0 {
+		limit = defaultScanBudget
+	}
+	budget := scanbudget.New(limit)
+
 	// 1. Load all members (students only)
-	members, err := s.loadStudentMembers(ctx, dojoID)
+	members, err := s.loadStudentMembers(ctx, dojoID, budget)
 	if err != nil {
 		return nil, err
 	}
@@ -173,13 +229,22 @@ func (s *Service) GetAlerts(ctx context.Context, staffUID, dojoID string) (*Aler
 	}
 
 	// 2. Scan attendance across all sessions
-	attMap, err := s.scanAttendance(ctx, dojoID, memberUIDs)
+	now := time.Now().UTC()
+	attMap, partial, err := s.scanAttendance(ctx, dojoID, memberUIDs, now, budget)
 	if err != nil {
 		return nil, err
 	}
 
+	// app opens are a second engagement signal; without them members
+	// score on attendance alone
+	var appDays map[string]int
+	if s.activity != nil {
+		if appDays, err = s.activity.ActiveDays(ctx, dojoID, now, churnWindowDays); err != nil {
+			log.Printf("retention: app activity of %s: %v", dojoID, err)
+		}
+	}
+
 	// 3. Compute alerts
-	now := time.Now().UTC()
 	today := now.Format("2006-01-02")
 	_ = today
 
@@ -199,8 +264,19 @@ func (s *Service) GetAlerts(ctx context.Context, staffUID, dojoID string) (*Aler
 			daysSince = daysBetween(att.LastDate, now)
 		}
 
-		// Skip members who are attending regularly
-		if daysSince >= 0 && daysSince < watchThreshold {
+		churn := scoreChurn(churnInput{
+			DaysSince:     daysSince,
+			ThresholdDays: settings.ThresholdDays,
+			Recent:        att.Recent,
+			Prior:         att.Prior,
+			JoinedAt:      m.JoinedAt,
+			BeltRank:      m.BeltRank,
+			AppDays:       appDays[m.UID],
+			Now:           now,
+		})
+
+		// Skip members who are attending regularly, unless their trend predicts churn
+		if daysSince >= 0 && daysSince < watchThreshold && churn.Probability < ChurnWatchProbability {
 			continue
 		}
 
@@ -228,6 +304,12 @@ func (s *Service) GetAlerts(ctx context.Context, staffUID, dojoID string) (*Aler
 			DaysSinceLastAttendance:  daysSince,
 			TotalSessions:            att.TotalCount,
 			RiskLevel:                risk,
+			ChurnProbability:         churn.Probability,
+			ChurnScore:               churn.Score,
+			ChurnFactors:             churn.Factors,
+			RecentSessions:           att.Recent,
+			PriorSessions:            att.Prior,
+			AppDays:                  appDays[m.UID],
 		}
 
 		alerts = append(alerts, alert)
@@ -262,6 +344,10 @@ func (s *Service) GetAlerts(ctx context.Context, staffUID, dojoID string) (*Aler
 		}
 		return di > dj
 	})
+	if len(alerts) > maxAlerts {
+		alerts = alerts[:maxAlerts]
+		partial = true
+	}
 
 	return &AlertsSummary{
 		DojoID:    dojoID,
@@ -269,6 +355,7 @@ func (s *Service) GetAlerts(ctx context.Context, staffUID, dojoID string) (*Aler
 		Alerts:    alerts,
 		Stats:     stats,
 		ScannedAt: now,
+		Partial:   partial || budget.Exhausted(),
 	}, nil
 }
 
@@ -276,7 +363,7 @@ func (s *Service) GetAlerts(ctx context.Context, staffUID, dojoID string) (*Aler
 // Internal helpers
 // ─────────────────────────────────────────────
 
-func (s *Service) loadStudentMembers(ctx context.Context, dojoID string) ([]memberInfo, error) {
+func (s *Service) loadStudentMembers(ctx context.Context, dojoID string, budget *scanbudget.Budget) ([]memberInfo, error) {
 	iter := s.fs.Collection("dojos").Doc(dojoID).Collection("members").Documents(ctx)
 	defer iter.Stop()
 
@@ -289,27 +376,29 @@ func (s *Service) loadStudentMembers(ctx context.Context, dojoID string) ([]memb
 		if err != nil {
 			return nil, fmt.Errorf("failed to list members: %w", err)
 		}
+		if !budget.Take() {
+			break
+		}
 
-		data := doc.Data()
+		m, err := fsdoc.As[fsdoc.Member](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
 
 		// Skip staff roles
-		role := stringVal(data, "roleInDojo")
-		if role == "" {
-			role = stringVal(data, "role")
-		}
+		role := m.RoleName()
 		if staffRoles[role] {
 			continue
 		}
 
 		// Skip inactive/rejected members
-		status := stringVal(data, "status")
-		if status == "rejected" || status == "removed" || status == "banned" {
+		if m.Status == "rejected" || m.Status == "removed" || m.Status == "banned" {
 			continue
 		}
 
-		displayName := stringVal(data, "displayName")
+		displayName := m.DisplayName
 		if displayName == "" {
-			displayName = stringVal(data, "email")
+			displayName = m.Email
 		}
 		if displayName == "" {
 			displayName = doc.Ref.ID[:8] + "..."
@@ -318,11 +407,12 @@ func (s *Service) loadStudentMembers(ctx context.Context, dojoID string) ([]memb
 		members = append(members, memberInfo{
 			UID:         doc.Ref.ID,
 			DisplayName: displayName,
-			Email:       stringVal(data, "email"),
-			BeltRank:    stringValDefault(data, "beltRank", "white"),
-			Stripes:     intVal(data, "stripes"),
-			IsKids:      boolVal(data, "isKids"),
+			Email:       m.Email,
+			BeltRank:    m.Belt(),
+			Stripes:     m.Stripes,
+			IsKids:      m.IsKids,
 			RoleInDojo:  role,
+			JoinedAt:    m.JoinedAt,
 		})
 	}
 
@@ -330,8 +420,15 @@ func (s *Service) loadStudentMembers(ctx context.Context, dojoID string) ([]memb
 }
 
 // scanAttendance scans all sessions' attendance subcollections
-// and also the dojo-level attendance collection
-func (s *Service) scanAttendance(ctx context.Context, dojoID string, memberUIDs map[string]bool) (map[string]attendanceSummary, error) {
+// and also the dojo-level attendance collection. partial is true when the
+// request deadline cut the scan short, so some history may be missing; the
+// caller checks the budget the same way.
+func (s *Service) scanAttendance(ctx context.Context, dojoID string, memberUIDs map[string]bool, now time.Time, budget *scanbudget.Budget) (map[string]attendanceSummary, bool, error) {
+	db, err := s.dbs.ClientFor(ctx, dojoID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve dojo database: %w", err)
+	}
+	dojoRef := db.Collection("dojos").Doc(dojoID)
 	result := make(map[string]attendanceSummary)
 
 	// Initialize for all members
@@ -341,24 +438,24 @@ func (s *Service) scanAttendance(ctx context.Context, dojoID string, memberUIDs
 
 	// --- Method 1: Scan dojo-level attendance collection ---
 	// (dojos/{dojoId}/attendance where sessionInstanceId contains date)
-	if err := s.scanDojoLevelAttendance(ctx, dojoID, memberUIDs, result); err != nil {
+	if err := s.scanDojoLevelAttendance(ctx, dojoRef, memberUIDs, result, now, budget); err != nil {
 		// Non-fatal, continue to method 2
 		_ = err
 	}
 
 	// --- Method 2: Scan session-level attendance subcollections ---
 	// (dojos/{dojoId}/sessions/{sessionId}/attendance)
-	if err := s.scanSessionLevelAttendance(ctx, dojoID, memberUIDs, result); err != nil {
+	if err := s.scanSessionLevelAttendance(ctx, dojoRef, memberUIDs, result, now, budget); err != nil {
 		// Non-fatal if method 1 had some data
 		_ = err
 	}
 
-	return result, nil
+	return result, ctx.Err() != nil, nil
 }
 
 // scanDojoLevelAttendance scans dojos/{dojoId}/attendance
-func (s *Service) scanDojoLevelAttendance(ctx context.Context, dojoID string, memberUIDs map[string]bool, result map[string]attendanceSummary) error {
-	iter := s.fs.Collection("dojos").Doc(dojoID).Collection("attendance").
+func (s *Service) scanDojoLevelAttendance(ctx context.Context, dojoRef *firestore.DocumentRef, memberUIDs map[string]bool, result map[string]attendanceSummary, now time.Time, budget *scanbudget.Budget) error {
+	iter := dojoRef.Collection("attendance").
 		OrderBy("createdAt", firestore.Desc).
 		Limit(5000).
 		Documents(ctx)
@@ -372,31 +469,25 @@ func (s *Service) scanDojoLevelAttendance(ctx context.Context, dojoID string, me
 		if err != nil {
 			return err
 		}
-
-		data := doc.Data()
-		uid := stringVal(data, "memberUid")
-		if !memberUIDs[uid] {
-			continue
+		if !budget.Take() {
+			break
 		}
 
-		status := stringVal(data, "status")
-		if status != "present" && status != "late" {
+		att, err := fsdoc.As[fsdoc.Attendance](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
+		uid := att.MemberUID
+		if !memberUIDs[uid] || !att.IsCheckin() {
 			continue
 		}
 
-		// Extract date from sessionInstanceId (e.g., "2025-01-15__classId")
-		sessionInstanceID := stringVal(data, "sessionInstanceId")
-		dateKey := extractDateFromSessionInstance(sessionInstanceID)
-
-		// Also try createdAt
-		if dateKey == "" {
-			if t, ok := data["createdAt"].(time.Time); ok {
-				dateKey = t.Format("2006-01-02")
-			}
-		}
+		// sessionInstanceId date (e.g., "2025-01-15__classId"), else createdAt
+		dateKey := att.Date()
 
 		existing := result[uid]
 		existing.TotalCount++
+		existing.addCheckin(dateKey, now)
 		if dateKey != "" && dateKey > existing.LastDate {
 			existing.LastDate = dateKey
 		}
@@ -407,8 +498,8 @@ func (s *Service) scanDojoLevelAttendance(ctx context.Context, dojoID string, me
 }
 
 // scanSessionLevelAttendance scans dojos/{dojoId}/sessions/*/attendance
-func (s *Service) scanSessionLevelAttendance(ctx context.Context, dojoID string, memberUIDs map[string]bool, result map[string]attendanceSummary) error {
-	sessIter := s.fs.Collection("dojos").Doc(dojoID).Collection("sessions").Documents(ctx)
+func (s *Service) scanSessionLevelAttendance(ctx context.Context, dojoRef *firestore.DocumentRef, memberUIDs map[string]bool, result map[string]attendanceSummary, now time.Time, budget *scanbudget.Budget) error {
+	sessIter := dojoRef.Collection("sessions").Documents(ctx)
 	defer sessIter.Stop()
 
 	for {
@@ -419,14 +510,20 @@ func (s *Service) scanSessionLevelAttendance(ctx context.Context, dojoID string,
 		if err != nil {
 			return err
 		}
+		if !budget.Take() {
+			break
+		}
 
-		sessData := sessDoc.Data()
-		dateKey := stringVal(sessData, "dateKey")
-		sessionTitle := stringVal(sessData, "title")
+		sess, err := fsdoc.As[fsdoc.SessionInstance](sessDoc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
+		dateKey := sess.DateKey
+		sessionTitle := sess.Title
 
 		// If no dateKey, try to extract from session ID (e.g., "2025-01-15__classId")
 		if dateKey == "" {
-			dateKey = extractDateFromSessionInstance(sessDoc.Ref.ID)
+			dateKey = instanceid.Date(sessDoc.Ref.ID)
 		}
 
 		// Scan attendance subcollection
@@ -436,31 +533,28 @@ func (s *Service) scanSessionLevelAttendance(ctx context.Context, dojoID string,
 			if err == iterator.Done {
 				break
 			}
-			if err != nil {
+			if err != nil || !budget.Take() {
 				break
 			}
 
+			att, err := fsdoc.As[fsdoc.Attendance](attDoc)
+			if err != nil {
+				continue // logged and counted by fsdoc
+			}
 			uid := attDoc.Ref.ID
 			if !memberUIDs[uid] {
-				// Also check memberUid field
-				attData := attDoc.Data()
-				uid = stringVal(attData, "uid")
-				if uid == "" {
-					uid = stringVal(attData, "memberUid")
-				}
-				if !memberUIDs[uid] {
+				// Also check the uid / memberUid fields
+				if uid = att.Member(); !memberUIDs[uid] {
 					continue
 				}
 			}
-
-			attData := attDoc.Data()
-			status := stringVal(attData, "status")
-			if status != "present" && status != "late" {
+			if !att.IsCheckin() {
 				continue
 			}
 
 			existing := result[uid]
 			existing.TotalCount++
+			existing.addCheckin(dateKey, now)
 			if dateKey != "" && dateKey > existing.LastDate {
 				existing.LastDate = dateKey
 				existing.LastTitle = sessionTitle
@@ -477,19 +571,6 @@ func (s *Service) scanSessionLevelAttendance(ctx context.Context, dojoID string,
 // Utility functions
 // ─────────────────────────────────────────────
 
-func extractDateFromSessionInstance(id string) string {
-	// Expect format "YYYY-MM-DD__classId" or "YYYY-MM-DD"
-	if len(id) < 10 {
-		return ""
-	}
-	candidate := id[:10]
-	// Quick validation: YYYY-MM-DD
-	if len(candidate) == 10 && candidate[4] == '-' && candidate[7] == '-' {
-		return candidate
-	}
-	return ""
-}
-
 func daysBetween(dateStr string, now time.Time) int {
 	t, err := time.Parse("2006-01-02", dateStr)
 	if err != nil {
@@ -511,43 +592,3 @@ func riskOrder(r RiskLevel) int {
 		return 3
 	}
 }
-
-func stringVal(data map[string]interface{}, key string) string {
-	if v, ok := data[key]; ok {
-		if s, ok := v.(string); ok {
-			return s
-		}
-	}
-	return ""
-}
-
-func stringValDefault(data map[string]interface{}, key, def string) string {
-	s := stringVal(data, key)
-	if s == "" {
-		return def
-	}
-	return s
-}
-
-func intVal(data map[string]interface{}, key string) int {
-	if v, ok := data[key]; ok {
-		switch n := v.(type) {
-		case int64:
-			return int(n)
-		case float64:
-			return int(n)
-		case int:
-			return n
-		}
-	}
-	return 0
-}
-
-func boolVal(data map[string]interface{}, key string) bool {
-	if v, ok := data[key]; ok {
-		if b, ok := v.(bool); ok {
-			return b
-		}
-	}
-	return false
-}
\ No newline at end of file
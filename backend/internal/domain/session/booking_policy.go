@@ -0,0 +1,210 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Booking rule bounds
+const (
+	maxOpensHoursBefore    = 30 * 24
+	maxClosesMinutesBefore = 24 * 60
+	maxCancelMinutesBefore = 7 * 24 * 60
+	maxPolicyClasses       = 200
+)
+
+// BookingRules are when members may book and cancel a class, relative to its
+// start. Zero means no limit: bookable any time before it closes, until the
+// class starts, and cancellations are never late.
+type BookingRules struct {
+	OpensHoursBefore    int `firestore:"opensHoursBefore" json:"opensHoursBefore"`
+	ClosesMinutesBefore int `firestore:"closesMinutesBefore" json:"closesMinutesBefore"`
+	CancelMinutesBefore int `firestore:"cancelMinutesBefore" json:"cancelMinutesBefore"` // later cancellations count as late
+}
+
+// BookingPolicy is dojos/{dojoId}/settings/booking. While it exists members
+// book and cancel through the API, which enforces it; the security rules stop
+// them writing their reservations directly.
+type BookingPolicy struct {
+	Rules     BookingRules            `firestore:"rules" json:"rules"`
+	Classes   map[string]BookingRules `firestore:"classes,omitempty" json:"classes,omitempty"` // per class id, replacing Rules
+	Penalties NoShowPenalties         `firestore:"penalties" json:"penalties"`
+	Timezone  string                  `firestore:"timezone" json:"timezone"` // IANA name class start times are in, "" = UTC
+	UpdatedAt time.Time               `firestore:"updatedAt" json:"updatedAt,omitempty"`
+	UpdatedBy string                  `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+
+	// Enabled reports whether the dojo has a policy (not stored)
+	Enabled bool `firestore:"-" json:"enabled"`
+}
+
+// UpdateBookingPolicyInput updates the booking policy (nil fields are left
+// unchanged). A class mapped to null drops its override.
+type UpdateBookingPolicyInput struct {
+	Rules     *BookingRules            `json:"rules,omitempty"`
+	Classes   map[string]*BookingRules `json:"classes,omitempty"`
+	Penalties *NoShowPenalties         `json:"penalties,omitempty"`
+	Timezone  *string                  `json:"timezone,omitempty"`
+}
+
+// For returns the rules of a class
+func (p *BookingPolicy) For(sessionID string) BookingRules {
+	if r, ok := p.Classes[sessionID]; ok {
+		return r
+	}
+	return p.Rules
+}
+
+// classStart is when the class starts on dateKey, in the policy's timezone
+func (p *BookingPolicy) classStart(sess *Session, dateKey string) (time.Time, error) {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	date, err := time.ParseInLocation(instanceid.DateLayout, dateKey, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q", ErrBadRequest, dateKey)
+	}
+	return date.Add(time.Duration(sess.StartMinute) * time.Minute), nil
+}
+
+func (r BookingRules) validate() error {
+	if r.OpensHoursBefore < 0 || r.OpensHoursBefore > maxOpensHoursBefore {
+		return fmt.Errorf("%w: opensHoursBefore must be 0-%d", ErrBadRequest, maxOpensHoursBefore)
+	}
+	if r.ClosesMinutesBefore < 0 || r.ClosesMinutesBefore > maxClosesMinutesBefore {
+		return fmt.Errorf("%w: closesMinutesBefore must be 0-%d", ErrBadRequest, maxClosesMinutesBefore)
+	}
+	if r.CancelMinutesBefore < 0 || r.CancelMinutesBefore > maxCancelMinutesBefore {
+		return fmt.Errorf("%w: cancelMinutesBefore must be 0-%d", ErrBadRequest, maxCancelMinutesBefore)
+	}
+	if r.OpensHoursBefore > 0 && r.ClosesMinutesBefore >= r.OpensHoursBefore*60 {
+		return fmt.Errorf("%w: booking must close after it opens", ErrBadRequest)
+	}
+	return nil
+}
+
+func (s *Service) bookingPolicyRef(ctx context.Context, dojoID string) (*firestore.DocumentRef, error) {
+	doc, err := s.repo.dojoDoc(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Collection("settings").Doc("booking"), nil
+}
+
+// bookingPolicy loads the dojo's policy; without one, Enabled is false and
+// there are no limits
+func (s *Service) bookingPolicy(ctx context.Context, dojoID string) (*BookingPolicy, error) {
+	ref, err := s.bookingPolicyRef(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load booking policy: %w", err)
+	}
+	p := &BookingPolicy{}
+	if doc.Exists() {
+		if err := doc.DataTo(p); err != nil {
+			return nil, fmt.Errorf("failed to decode booking policy: %w", err)
+		}
+		p.Enabled = true
+	}
+	return p, nil
+}
+
+// GetBookingPolicy returns the dojo's booking policy (any dojo member)
+func (s *Service) GetBookingPolicy(ctx context.Context, uid, dojoID string) (*BookingPolicy, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+			return nil, fmt.Errorf("%w: only dojo members can view the booking policy", ErrUnauthorized)
+		}
+	}
+	return s.bookingPolicy(ctx, dojoID)
+}
+
+// UpdateBookingPolicy sets the dojo's booking rules, per-class overrides,
+// no-show penalties and timezone, creating the policy on first use
+func (s *Service) UpdateBookingPolicy(ctx context.Context, staffUID, dojoID string, in UpdateBookingPolicyInput) (*BookingPolicy, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.Rules != nil {
+		if err := in.Rules.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for id, r := range in.Classes {
+		if r == nil {
+			continue
+		}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("class %s: %w", id, err)
+		}
+		if _, err := s.repo.Get(ctx, dojoID, id); err != nil {
+			return nil, err
+		}
+	}
+	if in.Penalties != nil {
+		if err := in.Penalties.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if in.Timezone != nil {
+		*in.Timezone = strings.TrimSpace(*in.Timezone)
+		if _, err := time.LoadLocation(*in.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrBadRequest, *in.Timezone)
+		}
+	}
+
+	p, err := s.bookingPolicy(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Rules != nil {
+		p.Rules = *in.Rules
+	}
+	for id, r := range in.Classes {
+		if r == nil {
+			delete(p.Classes, id)
+			continue
+		}
+		if p.Classes == nil {
+			p.Classes = map[string]BookingRules{}
+		}
+		p.Classes[id] = *r
+	}
+	if len(p.Classes) > maxPolicyClasses {
+		return nil, fmt.Errorf("%w: at most %d class overrides", ErrBadRequest, maxPolicyClasses)
+	}
+	if in.Penalties != nil {
+		p.Penalties = *in.Penalties
+	}
+	if in.Timezone != nil {
+		p.Timezone = *in.Timezone
+	}
+	p.UpdatedAt = time.Now().UTC()
+	p.UpdatedBy = staffUID
+	p.Enabled = true
+
+	ref, err := s.bookingPolicyRef(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ref.Set(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to save booking policy: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,212 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Kinds of booking strikes
+const (
+	StrikeLateCancel = "late_cancel"
+	StrikeNoShow     = "no_show"
+)
+
+// BookingStrike is dojos/{dojoId}/bookingStrikes/{instanceId}__{memberUid}:
+// a late cancellation or a no-show, at most one per member and class. The
+// member doc keeps the running totals (lateCancelCount, noShowCount).
+type BookingStrike struct {
+	MemberUID  string    `firestore:"memberUid" json:"memberUid"`
+	Kind       string    `firestore:"kind" json:"kind"`
+	InstanceID string    `firestore:"instanceId" json:"instanceId"`
+	DateKey    string    `firestore:"dateKey" json:"dateKey"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+}
+
+func strikeRef(db *firestore.Client, dojoID, instanceID, memberUID string) *firestore.DocumentRef {
+	return db.Collection("dojos").Doc(dojoID).Collection("bookingStrikes").Doc(instanceID + "__" + memberUID)
+}
+
+// checkBookable reports why the class on dateKey cannot be booked at now
+func (p *BookingPolicy) checkBookable(sess *Session, dateKey string, now time.Time) error {
+	start, err := p.classStart(sess, dateKey)
+	if err != nil {
+		return err
+	}
+	rules := p.For(sess.ID)
+	if closes := start.Add(-time.Duration(rules.ClosesMinutesBefore) * time.Minute); !now.Before(closes) {
+		return fmt.Errorf("%w: booking for %s closed at %s", ErrBookingClosed, sess.Title, closes.UTC().Format(time.RFC3339))
+	}
+	if rules.OpensHoursBefore > 0 {
+		if opens := start.Add(-time.Duration(rules.OpensHoursBefore) * time.Hour); now.Before(opens) {
+			return fmt.Errorf("%w: booking for %s opens at %s", ErrBookingClosed, sess.Title, opens.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// Book reserves the caller a place in a class instance ("YYYY-MM-DD__sessionId")
+// within the dojo's booking window, unless no-shows got them restricted. A
+// reservation they cancelled is confirmed again; an existing confirmed one is
+// returned as is.
+func (s *Service) Book(ctx context.Context, uid, dojoID, instanceID string) (*Reservation, error) {
+	dateKey, sessionID, ok := instanceid.Parse(instanceID)
+	if dojoID == "" || !ok {
+		return nil, fmt.Errorf("%w: dojoId and an instanceId of the form YYYY-MM-DD__sessionId are required", ErrBadRequest)
+	}
+	sess, err := s.repo.Get(ctx, dojoID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.runsOn(dateKey); err != nil {
+		return nil, err
+	}
+
+	admits, err := s.EligibilityFor(ctx, dojoID, uid)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, fmt.Errorf("%w: only dojo members can book classes", ErrUnauthorized)
+		}
+		return nil, err
+	}
+	if err := admits(sess, dateKey); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.bookingPolicy(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := policy.checkBookable(sess, dateKey, now); err != nil {
+		return nil, err
+	}
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	_, br, err := s.memberBooking(ctx, db, dojoID, uid)
+	if err != nil && !IsErrNotFound(err) {
+		return nil, err
+	}
+	if br != nil && br.Until >= policy.today(now).Format(instanceid.DateLayout) {
+		return nil, fmt.Errorf("%w: after missed classes you can't book classes yourself until %s", ErrRestricted, br.Until)
+	}
+
+	outcome, res, err := s.bookInstance(ctx, dojoID, sess, dateKey, Reservation{MemberID: uid}, true)
+	if err != nil {
+		return nil, err
+	}
+	switch outcome {
+	case BookedFull:
+		return nil, fmt.Errorf("%w: %s has no places left on %s", ErrClassFull, sess.Title, dateKey)
+	case BookedBlocked:
+		return nil, fmt.Errorf("%w: suspended or restricted on %s", ErrIneligible, dateKey)
+	}
+	return res, nil
+}
+
+// CancelReservation cancels the caller's reservation of a class instance
+// until the class starts. Cancelling later than the policy's
+// cancelMinutesBefore is a late cancellation, counted on the member doc and
+// recorded as a strike once per class.
+func (s *Service) CancelReservation(ctx context.Context, uid, dojoID, instanceID string) (*Reservation, error) {
+	dateKey, sessionID, ok := instanceid.Parse(instanceID)
+	if dojoID == "" || !ok {
+		return nil, fmt.Errorf("%w: dojoId and an instanceId of the form YYYY-MM-DD__sessionId are required", ErrBadRequest)
+	}
+	sess, err := s.repo.Get(ctx, dojoID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.bookingPolicy(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	start, err := policy.classStart(sess, dateKey)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !now.Before(start) {
+		return nil, fmt.Errorf("%w: %s has already started", ErrBookingClosed, sess.Title)
+	}
+	cancelBy := policy.For(sessionID).CancelMinutesBefore
+	late := cancelBy > 0 && now.After(start.Add(-time.Duration(cancelBy)*time.Minute))
+
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	dojoRef := db.Collection("dojos").Doc(dojoID)
+	resRef := dojoRef.Collection("sessions").Doc(instanceID).Collection("reservations").Doc(uid)
+	mRef := memberRef(db, dojoID, uid)
+	sRef := strikeRef(db, dojoID, instanceID, uid)
+
+	var res Reservation
+	err = db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		res = Reservation{}
+		doc, err := tx.Get(resRef)
+		if err != nil && doc == nil {
+			return err
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: no reservation for this class", ErrNotFound)
+		}
+		if err := doc.DataTo(&res); err != nil {
+			return err
+		}
+		if res.Status != ReservationConfirmed {
+			return nil
+		}
+		var struck, isMember bool
+		if late {
+			strike, err := tx.Get(sRef)
+			if err != nil && strike == nil {
+				return err
+			}
+			member, err := tx.Get(mRef)
+			if err != nil && member == nil {
+				return err
+			}
+			struck, isMember = strike.Exists(), member.Exists()
+		}
+
+		res.Status = ReservationCancelled
+		res.CancelledAt = &now
+		res.LateCancel = late
+		res.UpdatedAt = now
+		if err := tx.Set(resRef, res); err != nil {
+			return err
+		}
+		if !late || struck {
+			return nil
+		}
+		if err := tx.Set(sRef, BookingStrike{
+			MemberUID:  uid,
+			Kind:       StrikeLateCancel,
+			InstanceID: instanceID,
+			DateKey:    dateKey,
+			CreatedAt:  now,
+		}); err != nil {
+			return err
+		}
+		if !isMember {
+			return nil
+		}
+		return tx.Update(mRef, []firestore.Update{
+			{Path: "lateCancelCount", Value: firestore.Increment(1)},
+		})
+	})
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to cancel reservation: %w", err)
+	}
+	return &res, nil
+}
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// kidsMaxAge is the age from which a member counts as an adult for KidsOnly
+// classes when they are not flagged as kids (IBJJF adult belts start at 16)
+const kidsMaxAge = 16
+
+// CheckEligibility reports why a member may not join a class instance on
+// their own, nil if they may. Staff of the dojo are always admitted, and
+// instance ids that predate "YYYY-MM-DD__sessionId" carry no rules.
+func (s *Service) CheckEligibility(ctx context.Context, dojoID, instanceID, memberUID string) error {
+	dateKey, sessionID, ok := instanceid.Parse(instanceID)
+	if !ok {
+		return nil
+	}
+	sess, err := s.repo.Get(ctx, dojoID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !sess.Restricted() {
+		return nil
+	}
+	date, err := time.Parse(instanceid.DateLayout, dateKey)
+	if err != nil {
+		return fmt.Errorf("%w: invalid date %q", ErrBadRequest, dateKey)
+	}
+
+	member, dob, err := s.repo.eligibilityFacts(ctx, dojoID, memberUID)
+	if err != nil {
+		return err
+	}
+	reason := sess.admits(member, dob, date)
+	if reason == nil {
+		return nil
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, memberUID)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if isStaff {
+		return nil
+	}
+	return reason
+}
+
+// EligibilityFor loads a member's facts once and returns a check of the
+// class rules for any class and date, for listing many classes. Like
+// CheckEligibility it admits staff; unlike it, the check also refuses dates
+// the member is suspended on, since it answers "can I come".
+func (s *Service) EligibilityFor(ctx context.Context, dojoID, memberUID string) (func(sess *Session, dateKey string) error, error) {
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, memberUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	member, dob, err := s.repo.eligibilityFacts(ctx, dojoID, memberUID)
+	if err != nil {
+		if !isStaff || !IsErrNotFound(err) {
+			return nil, err
+		}
+		member = &fsdoc.Member{} // an owner with no member doc
+	}
+	return func(sess *Session, dateKey string) error {
+		if member.SuspendedOn(dateKey) {
+			return fmt.Errorf("%w: suspended on %s", ErrIneligible, dateKey)
+		}
+		if isStaff || !sess.Restricted() {
+			return nil
+		}
+		date, err := time.Parse(instanceid.DateLayout, dateKey)
+		if err != nil {
+			return fmt.Errorf("%w: invalid date %q", ErrBadRequest, dateKey)
+		}
+		return sess.admits(member, dob, date)
+	}, nil
+}
+
+// admits reports why the member does not meet the class's rules on date.
+// dob is YYYY-MM-DD, "" when unknown.
+func (sess *Session) admits(m *fsdoc.Member, dob string, date time.Time) error {
+	age := -1
+	if born, err := time.Parse(instanceid.DateLayout, dob); err == nil {
+		age = ageOn(born, date)
+	}
+
+	if sess.MinAge > 0 || sess.MaxAge > 0 {
+		switch {
+		case age < 0:
+			return fmt.Errorf("%w: %s has an age limit and the member has no date of birth on their profile", ErrIneligible, sess.Title)
+		case sess.MinAge > 0 && age < sess.MinAge:
+			return fmt.Errorf("%w: %s is for ages %d and up", ErrIneligible, sess.Title, sess.MinAge)
+		case sess.MaxAge > 0 && age > sess.MaxAge:
+			return fmt.Errorf("%w: %s is for ages up to %d", ErrIneligible, sess.Title, sess.MaxAge)
+		}
+	}
+	if sess.KidsOnly && !m.IsKids && (age < 0 || age >= kidsMaxAge) {
+		return fmt.Errorf("%w: %s is a kids class", ErrIneligible, sess.Title)
+	}
+	if !ranks.BeltAtLeast(m.Belt(), sess.MinBelt) {
+		return fmt.Errorf("%w: %s needs a %s belt or above", ErrIneligible, sess.Title, ranks.BeltLabel(sess.MinBelt))
+	}
+	return nil
+}
+
+// ageOn is the age in whole years on date of someone born on born
+func ageOn(born, date time.Time) int {
+	age := date.Year() - born.Year()
+	if date.Month() < born.Month() || (date.Month() == born.Month() && date.Day() < born.Day()) {
+		age--
+	}
+	return age
+}
+
+// eligibilityFacts reads the member doc and the date of birth from the
+// member's profile
+func (r *Repo) eligibilityFacts(ctx context.Context, dojoID, uid string) (*fsdoc.Member, string, error) {
+	dojoRef, err := r.dojoDoc(ctx, dojoID)
+	if err != nil {
+		return nil, "", err
+	}
+	doc, err := dojoRef.Collection("members").Doc(uid).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, "", fmt.Errorf("failed to load member: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, "", fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	var m fsdoc.Member
+	if err := fsdoc.Decode(doc, &m); err != nil {
+		return nil, "", fmt.Errorf("failed to parse member: %w", err)
+	}
+
+	userDoc, err := r.fs.Collection("users").Doc(uid).Get(ctx)
+	if err != nil && userDoc == nil {
+		return nil, "", fmt.Errorf("failed to load profile: %w", err)
+	}
+	var dob string
+	if userDoc.Exists() {
+		dob, _ = userDoc.Data()["dateOfBirth"].(string)
+	}
+	return &m, dob, nil
+}
@@ -5,9 +5,13 @@ import (
 )
 
 var (
-	ErrBadRequest   = errors.New("bad request")
-	ErrUnauthorized = errors.New("unauthorized")
-	ErrNotFound     = errors.New("not found")
+	ErrBadRequest    = errors.New("bad request")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrNotFound      = errors.New("not found")
+	ErrIneligible    = errors.New("not eligible for this class")
+	ErrBookingClosed = errors.New("booking closed")
+	ErrClassFull     = errors.New("class is full")
+	ErrRestricted    = errors.New("booking restricted")
 )
 
 func IsErrBadRequest(err error) bool {
@@ -20,4 +24,20 @@ func IsErrUnauthorized(err error) bool {
 
 func IsErrNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound)
-}
\ No newline at end of file
+}
+
+func IsErrIneligible(err error) bool {
+	return errors.Is(err, ErrIneligible)
+}
+
+func IsErrBookingClosed(err error) bool {
+	return errors.Is(err, ErrBookingClosed)
+}
+
+func IsErrClassFull(err error) bool {
+	return errors.Is(err, ErrClassFull)
+}
+
+func IsErrRestricted(err error) bool {
+	return errors.Is(err, ErrRestricted)
+}
@@ -0,0 +1,217 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Attachment is an uploaded file referenced by a lesson plan (uploaded by the client)
+type Attachment struct {
+	Name        string `firestore:"name" json:"name"`
+	URL         string `firestore:"url" json:"url"`
+	ContentType string `firestore:"contentType,omitempty" json:"contentType,omitempty"`
+	Size        int64  `firestore:"size,omitempty" json:"size,omitempty"`
+}
+
+// LessonPlan is written by staff before class
+type LessonPlan struct {
+	Text        string       `firestore:"text" json:"text"`
+	Techniques  []string     `firestore:"techniques,omitempty" json:"techniques,omitempty"`
+	Attachments []Attachment `firestore:"attachments,omitempty" json:"attachments,omitempty"`
+	UpdatedBy   string       `firestore:"updatedBy" json:"updatedBy"`
+	UpdatedAt   time.Time    `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// ClassSummary is written by staff after class ("what was covered")
+type ClassSummary struct {
+	Text       string    `firestore:"text" json:"text"`
+	Techniques []string  `firestore:"techniques,omitempty" json:"techniques,omitempty"`
+	UpdatedBy  string    `firestore:"updatedBy" json:"updatedBy"`
+	UpdatedAt  time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// InstanceNotes is the lesson plan + summary of one session instance
+// stored on dojos/{dojoId}/sessions/{instanceId} ("YYYY-MM-DD__sessionId")
+type InstanceNotes struct {
+	InstanceID string        `firestore:"-" json:"instanceId"`
+	SessionID  string        `firestore:"sessionId" json:"sessionId"`
+	DateKey    string        `firestore:"dateKey" json:"dateKey"`
+	LessonPlan *LessonPlan   `firestore:"lessonPlan,omitempty" json:"lessonPlan,omitempty"`
+	Summary    *ClassSummary `firestore:"summary,omitempty" json:"summary,omitempty"`
+}
+
+// LessonPlanInput is the body of PUT .../instances/{instanceId}/lessonPlan
+type LessonPlanInput struct {
+	Text        string       `json:"text"`
+	Techniques  []string     `json:"techniques,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// ClassSummaryInput is the body of PUT .../instances/{instanceId}/summary
+type ClassSummaryInput struct {
+	Text       string   `json:"text"`
+	Techniques []string `json:"techniques,omitempty"`
+}
+
+const (
+	maxNotesText   = 5000
+	maxTechniques  = 50
+	maxAttachments = 20
+)
+
+func (r *Repo) instanceRef(ctx context.Context, dojoID, instanceID string) (*firestore.DocumentRef, error) {
+	doc, err := r.dojoDoc(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Collection("sessions").Doc(instanceID), nil
+}
+
+// GetInstanceNotes returns the lesson plan / summary of an instance (any dojo member)
+func (s *Service) GetInstanceNotes(ctx context.Context, uid, dojoID, instanceID string) (*InstanceNotes, error) {
+	dateKey, sessionID, err := s.checkInstance(ctx, dojoID, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+			return nil, fmt.Errorf("%w: only dojo members can view class notes", ErrUnauthorized)
+		}
+	}
+
+	notes := InstanceNotes{InstanceID: instanceID, SessionID: sessionID, DateKey: dateKey}
+	ref, err := s.repo.instanceRef(ctx, dojoID, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ref.Get(ctx)
+	if err == nil && doc.Exists() {
+		if err := doc.DataTo(&notes); err != nil {
+			return nil, fmt.Errorf("failed to decode class notes: %w", err)
+		}
+		notes.InstanceID = instanceID
+	}
+	return &notes, nil
+}
+
+// PutLessonPlan sets the lesson plan of an instance (staff only)
+func (s *Service) PutLessonPlan(ctx context.Context, staffUID, dojoID, instanceID string, in LessonPlanInput) (*InstanceNotes, error) {
+	in.Text = strings.TrimSpace(in.Text)
+	if len(in.Text) > maxNotesText {
+		return nil, fmt.Errorf("%w: text must be at most %d characters", ErrBadRequest, maxNotesText)
+	}
+	techniques, err := cleanTechniques(in.Techniques)
+	if err != nil {
+		return nil, err
+	}
+	if len(in.Attachments) > maxAttachments {
+		return nil, fmt.Errorf("%w: at most %d attachments", ErrBadRequest, maxAttachments)
+	}
+	for i, a := range in.Attachments {
+		in.Attachments[i].Name = strings.TrimSpace(a.Name)
+		in.Attachments[i].URL = strings.TrimSpace(a.URL)
+		if in.Attachments[i].URL == "" {
+			return nil, fmt.Errorf("%w: attachment url is required", ErrBadRequest)
+		}
+	}
+
+	plan := LessonPlan{
+		Text:        in.Text,
+		Techniques:  techniques,
+		Attachments: in.Attachments,
+		UpdatedBy:   staffUID,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	return s.putInstanceField(ctx, staffUID, dojoID, instanceID, "lessonPlan", plan)
+}
+
+// PutSummary sets the post-class summary of an instance (staff only)
+func (s *Service) PutSummary(ctx context.Context, staffUID, dojoID, instanceID string, in ClassSummaryInput) (*InstanceNotes, error) {
+	in.Text = strings.TrimSpace(in.Text)
+	if in.Text == "" {
+		return nil, fmt.Errorf("%w: text is required", ErrBadRequest)
+	}
+	if len(in.Text) > maxNotesText {
+		return nil, fmt.Errorf("%w: text must be at most %d characters", ErrBadRequest, maxNotesText)
+	}
+	techniques, err := cleanTechniques(in.Techniques)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := ClassSummary{
+		Text:       in.Text,
+		Techniques: techniques,
+		UpdatedBy:  staffUID,
+		UpdatedAt:  time.Now().UTC(),
+	}
+	return s.putInstanceField(ctx, staffUID, dojoID, instanceID, "summary", summary)
+}
+
+func (s *Service) putInstanceField(ctx context.Context, staffUID, dojoID, instanceID, field string, value interface{}) (*InstanceNotes, error) {
+	dateKey, sessionID, err := s.checkInstance(ctx, dojoID, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: only staff can edit class notes", ErrUnauthorized)
+	}
+
+	ref, err := s.repo.instanceRef(ctx, dojoID, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = ref.Set(ctx, map[string]interface{}{
+		"sessionId": sessionID,
+		"dateKey":   dateKey,
+		field:       value,
+	}, firestore.MergeAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save class notes: %w", err)
+	}
+	return s.GetInstanceNotes(ctx, staffUID, dojoID, instanceID)
+}
+
+// checkInstance validates the instance id and that its session exists
+func (s *Service) checkInstance(ctx context.Context, dojoID, instanceID string) (string, string, error) {
+	if dojoID == "" || instanceID == "" {
+		return "", "", fmt.Errorf("%w: dojoId and instanceId are required", ErrBadRequest)
+	}
+	dateKey, sessionID, ok := instanceid.Parse(instanceID)
+	if !ok {
+		return "", "", fmt.Errorf("%w: instanceId must be YYYY-MM-DD__sessionId", ErrBadRequest)
+	}
+	if _, err := s.repo.Get(ctx, dojoID, sessionID); err != nil {
+		return "", "", err
+	}
+	return dateKey, sessionID, nil
+}
+
+func cleanTechniques(in []string) ([]string, error) {
+	if len(in) > maxTechniques {
+		return nil, fmt.Errorf("%w: at most %d techniques", ErrBadRequest, maxTechniques)
+	}
+	out := make([]string, 0, len(in))
+	for _, t := range in {
+		if t = strings.TrimSpace(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// maxReleasedInstances bounds the upcoming instances checked for a departed
+// member's reservations; instances are only generated a few weeks ahead
+const maxReleasedInstances = 450
+
+// ReleaseMemberReservations deletes a member's reservations of the dojo's
+// classes from today on, so a member removed from the dojo no longer holds
+// places. Past reservations are kept with the class history, and ones
+// generated from a recurring booking are left to the booking's cancellation
+// (recurring.CancelMember), which releases them itself. It reports how many
+// were deleted.
+func (s *Service) ReleaseMemberReservations(ctx context.Context, dojoID, memberUID string, now time.Time) (int, error) {
+	if dojoID == "" || memberUID == "" {
+		return 0, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return 0, err
+	}
+
+	// instance ids start with their date, so today's and later ones sort
+	// from today's date on
+	sessions := db.Collection("dojos").Doc(dojoID).Collection("sessions")
+	instances, err := sessions.Where(firestore.DocumentID, ">=", sessions.Doc(now.UTC().Format(instanceid.DateLayout))).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Select().Limit(maxReleasedInstances).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list upcoming classes: %w", err)
+	}
+	if len(instances) == 0 {
+		return 0, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, 0, len(instances))
+	for _, inst := range instances {
+		refs = append(refs, inst.Ref.Collection("reservations").Doc(memberUID))
+	}
+	snaps, err := db.GetAll(ctx, refs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load reservations: %w", err)
+	}
+
+	batch := db.Batch()
+	released := 0
+	for _, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		if recurringID, _ := snap.Data()["recurringId"].(string); recurringID != "" {
+			continue
+		}
+		batch.Delete(snap.Ref)
+		released++
+	}
+	if released == 0 {
+		return 0, nil
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to release reservations: %w", err)
+	}
+	return released, nil
+}
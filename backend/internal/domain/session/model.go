@@ -1,6 +1,7 @@
 package session
 
 import (
+	"math"
 	"strings"
 	"time"
 )
@@ -20,6 +21,10 @@ type Session struct {
 	MaxCapacity int       `firestore:"maxCapacity,omitempty" json:"maxCapacity,omitempty"`
 	Location    string    `firestore:"location,omitempty" json:"location,omitempty"`
 	IsActive    bool      `firestore:"isActive" json:"isActive"`
+
+	// InstructorUID links the class to a staff member of the dojo.
+	// Instructor stays as the display string for older clients.
+	InstructorUID string `firestore:"instructorUid,omitempty" json:"instructorUid,omitempty"`
 	CreatedBy   string    `firestore:"createdBy" json:"createdBy"`
 	CreatedAt   time.Time `firestore:"createdAt" json:"createdAt"`
 	UpdatedAt   time.Time `firestore:"updatedAt" json:"updatedAt"`
@@ -35,6 +40,39 @@ type Session struct {
 	RecurrenceEnd   time.Time `firestore:"recurrenceEnd,omitempty" json:"recurrenceEnd,omitempty"`
 	ExcludedDates   []string  `firestore:"excludedDates,omitempty" json:"excludedDates,omitempty"` // dates to skip
 	ParentSessionID string    `firestore:"parentSessionId,omitempty" json:"parentSessionId,omitempty"`
+
+	// Tags come from the dojo's tag set (gi, no-gi, fundamentals, ...)
+	Tags []string `firestore:"tags,omitempty" json:"tags,omitempty"`
+
+	// Attendance goals, checked weekly by the class goals job.
+	// TargetFillRate is a share of MaxCapacity (0-1).
+	TargetHeadcount int     `firestore:"targetHeadcount,omitempty" json:"targetHeadcount,omitempty"`
+	TargetFillRate  float64 `firestore:"targetFillRate,omitempty" json:"targetFillRate,omitempty"`
+
+	// Eligibility, enforced when members check themselves in; staff can
+	// always record a member. Ages are whole years on the class date, 0 for
+	// no limit. KidsOnly admits members flagged as kids or under 16.
+	MinAge   int    `firestore:"minAge,omitempty" json:"minAge,omitempty"`
+	MaxAge   int    `firestore:"maxAge,omitempty" json:"maxAge,omitempty"`
+	MinBelt  string `firestore:"minBelt,omitempty" json:"minBelt,omitempty"`
+	KidsOnly bool   `firestore:"kidsOnly,omitempty" json:"kidsOnly,omitempty"`
+}
+
+// Restricted reports whether the class has any eligibility rule
+func (s *Session) Restricted() bool {
+	return s.MinAge > 0 || s.MaxAge > 0 || s.MinBelt != "" || s.KidsOnly
+}
+
+// Target returns the headcount goal of the class, 0 if none is set.
+// TargetHeadcount wins over TargetFillRate.
+func (s *Session) Target() int {
+	if s.TargetHeadcount > 0 {
+		return s.TargetHeadcount
+	}
+	if s.TargetFillRate > 0 && s.MaxCapacity > 0 {
+		return int(math.Ceil(s.TargetFillRate * float64(s.MaxCapacity)))
+	}
+	return 0
 }
 
 // CreateSessionInput represents input for creating a session
@@ -49,10 +87,21 @@ type CreateSessionInput struct {
 	MaxCapacity int    `json:"maxCapacity,omitempty"`
 	Location    string `json:"location,omitempty"`
 
+	// InstructorUID must be a staff member of the dojo; Instructor defaults to their name
+	InstructorUID string `json:"instructorUid,omitempty"`
+
 	// Recurrence
 	IsRecurring    bool   `json:"isRecurring,omitempty"`
 	RecurrenceRule string `json:"recurrenceRule,omitempty"`
 	RecurrenceEnd  string `json:"recurrenceEnd,omitempty"` // ISO date string
+
+	Tags []string `json:"tags,omitempty"`
+
+	// Eligibility
+	MinAge   int    `json:"minAge,omitempty"`
+	MaxAge   int    `json:"maxAge,omitempty"`
+	MinBelt  string `json:"minBelt,omitempty"`
+	KidsOnly bool   `json:"kidsOnly,omitempty"`
 }
 
 // ValidClassTypes are the valid class types
@@ -76,10 +125,12 @@ func (in *CreateSessionInput) Trim() {
 	in.StartTime = strings.TrimSpace(in.StartTime)
 	in.EndTime = strings.TrimSpace(in.EndTime)
 	in.Instructor = strings.TrimSpace(in.Instructor)
+	in.InstructorUID = strings.TrimSpace(in.InstructorUID)
 	in.ClassType = strings.TrimSpace(in.ClassType)
 	in.Location = strings.TrimSpace(in.Location)
 	in.RecurrenceRule = strings.TrimSpace(in.RecurrenceRule)
 	in.RecurrenceEnd = strings.TrimSpace(in.RecurrenceEnd)
+	in.MinBelt = strings.TrimSpace(in.MinBelt)
 }
 
 // UpdateSessionInput represents input for updating a session
@@ -95,10 +146,26 @@ type UpdateSessionInput struct {
 	Location    *string `json:"location,omitempty"`
 	IsActive    *bool   `json:"isActive,omitempty"`
 
+	// InstructorUID: "" unlinks the instructor
+	InstructorUID *string `json:"instructorUid,omitempty"`
+
 	// Recurrence
 	IsRecurring    *bool   `json:"isRecurring,omitempty"`
 	RecurrenceRule *string `json:"recurrenceRule,omitempty"`
 	RecurrenceEnd  *string `json:"recurrenceEnd,omitempty"`
+
+	// Attendance goals: 0 clears
+	TargetHeadcount *int     `json:"targetHeadcount,omitempty"`
+	TargetFillRate  *float64 `json:"targetFillRate,omitempty"`
+
+	// Tags replaces the class's tags; an empty list clears them
+	Tags *[]string `json:"tags,omitempty"`
+
+	// Eligibility: 0, "" and false clear a rule
+	MinAge   *int    `json:"minAge,omitempty"`
+	MaxAge   *int    `json:"maxAge,omitempty"`
+	MinBelt  *string `json:"minBelt,omitempty"`
+	KidsOnly *bool   `json:"kidsOnly,omitempty"`
 }
 
 func (in *UpdateSessionInput) Trim() {
@@ -117,17 +184,27 @@ func (in *UpdateSessionInput) Trim() {
 	if in.Instructor != nil {
 		*in.Instructor = strings.TrimSpace(*in.Instructor)
 	}
+	if in.InstructorUID != nil {
+		*in.InstructorUID = strings.TrimSpace(*in.InstructorUID)
+	}
 	if in.ClassType != nil {
 		*in.ClassType = strings.TrimSpace(*in.ClassType)
 	}
 	if in.Location != nil {
 		*in.Location = strings.TrimSpace(*in.Location)
 	}
+	if in.MinBelt != nil {
+		*in.MinBelt = strings.TrimSpace(*in.MinBelt)
+	}
 }
 
 // ListSessionsInput represents input for listing sessions
 type ListSessionsInput struct {
-	DayOfWeek  *int  `json:"dayOfWeek,omitempty"`
-	ActiveOnly bool  `json:"activeOnly,omitempty"`
-	Limit      int64 `json:"limit,omitempty"`
+	DayOfWeek     *int   `json:"dayOfWeek,omitempty"`
+	ActiveOnly    bool   `json:"activeOnly,omitempty"`
+	InstructorUID string `json:"instructorUid,omitempty"`
+	Limit         int64  `json:"limit,omitempty"`
+
+	// Tags keeps classes carrying any of the tags
+	Tags []string `json:"tags,omitempty"`
 }
\ No newline at end of file
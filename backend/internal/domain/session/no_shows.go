@@ -0,0 +1,233 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	// noShowLookbackDays is how far back classes are checked, so one whose
+	// attendance was taken late is still caught
+	noShowLookbackDays = 3
+	// noShowDelay is how long after a class ends it is checked, leaving
+	// staff time to take attendance
+	noShowDelay = 3 * time.Hour
+
+	maxNoShowInstances = 1000
+	maxNoShowWrites    = 450
+)
+
+// NoShowResult summarizes a no-show run
+type NoShowResult struct {
+	DojosChecked int  `json:"dojosChecked"`
+	DojosEnabled int  `json:"dojosEnabled"` // with a booking policy
+	Classes      int  `json:"classes"`      // ended classes checked
+	NoShows      int  `json:"noShows"`
+	Unrecorded   int  `json:"unrecorded"` // booked classes with no attendance taken yet, left for a later run
+	Warned       int  `json:"warned"`     // members warned about their no-shows
+	Restricted   int  `json:"restricted"` // members barred from booking
+	Partial      bool `json:"partial,omitempty"`
+}
+
+// RunNoShows marks confirmed reservations of recently ended classes with no
+// attendance of the member as no-shows, in dojos with a booking policy. Each
+// no-show is counted on the member doc (noShowCount) and recorded as a
+// strike, and the policy's penalties applied. Classes with no attendance
+// taken at all are left alone until it is. Meant to be triggered by Cloud
+// Scheduler a few times a day; each class instance is checked once
+// (noShowsCheckedAt).
+func (s *Service) RunNoShows(ctx context.Context, now time.Time) (*NoShowResult, error) {
+	res := &NoShowResult{}
+
+	iter := s.repo.fs.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+		dojoID := doc.Ref.ID
+		policy, err := s.bookingPolicy(ctx, dojoID)
+		if err != nil || !policy.Enabled {
+			continue
+		}
+		res.DojosEnabled++
+
+		if err := s.noShowsDojo(ctx, dojoID, policy, now, res); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			log.Printf("no-shows: dojo %s: %v", dojoID, err)
+		}
+	}
+
+	log.Printf("no-shows: %d dojos checked, %d enabled, %d classes, %d no-shows, %d unrecorded, %d warned, %d restricted (partial=%v)",
+		res.DojosChecked, res.DojosEnabled, res.Classes, res.NoShows, res.Unrecorded, res.Warned, res.Restricted, res.Partial)
+	return res, nil
+}
+
+func (s *Service) noShowsDojo(ctx context.Context, dojoID string, policy *BookingPolicy, now time.Time, res *NoShowResult) error {
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+
+	// instance ids start with their date
+	sessions := db.Collection("dojos").Doc(dojoID).Collection("sessions")
+	from := now.UTC().AddDate(0, 0, -noShowLookbackDays).Format(instanceid.DateLayout)
+	to := now.UTC().AddDate(0, 0, 1).Format(instanceid.DateLayout)
+	instances, err := sessions.Where(firestore.DocumentID, ">=", sessions.Doc(from)).
+		Where(firestore.DocumentID, "<", sessions.Doc(to)).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Select("noShowsCheckedAt").Limit(maxNoShowInstances).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list recent classes: %w", err)
+	}
+
+	classes := map[string]*Session{}
+	for _, inst := range instances {
+		if _, checked := inst.Data()["noShowsCheckedAt"]; checked {
+			continue
+		}
+		dateKey, sessionID, ok := instanceid.Parse(inst.Ref.ID)
+		if !ok {
+			continue
+		}
+		sess, seen := classes[sessionID]
+		if !seen {
+			if sess, err = s.repo.Get(ctx, dojoID, sessionID); err != nil && !IsErrNotFound(err) {
+				return err
+			}
+			classes[sessionID] = sess
+		}
+		if sess == nil {
+			continue
+		}
+		start, err := policy.classStart(sess, dateKey)
+		if err != nil {
+			continue
+		}
+		if now.Before(start.Add(time.Duration(sess.DurationMinute)*time.Minute + noShowDelay)) {
+			continue
+		}
+		res.Classes++
+		if err := s.markNoShows(ctx, db, dojoID, policy, inst.Ref, dateKey, now, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markNoShows checks one ended class instance
+func (s *Service) markNoShows(ctx context.Context, db *firestore.Client, dojoID string, policy *BookingPolicy, inst *firestore.DocumentRef, dateKey string, now time.Time, res *NoShowResult) error {
+	booked, err := inst.Collection("reservations").Where("status", "==", ReservationConfirmed).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to load reservations: %w", err)
+	}
+
+	var missing []string
+	if len(booked) > 0 {
+		dojoRef := db.Collection("dojos").Doc(dojoID)
+		records, err := dojoRef.Collection("attendance").Where("sessionInstanceId", "==", inst.ID).
+			Select("memberUid", "uid", "status").Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to load attendance: %w", err)
+		}
+		if len(records) == 0 {
+			res.Unrecorded++
+			return nil
+		}
+		came := map[string]bool{}
+		for _, rec := range records {
+			var a fsdoc.Attendance
+			// excused absences are not no-shows
+			if err := fsdoc.Decode(rec, &a); err == nil && (a.IsCheckin() || a.Status == "excused") {
+				came[a.Member()] = true
+			}
+		}
+		for _, doc := range booked {
+			if !came[doc.Ref.ID] {
+				missing = append(missing, doc.Ref.ID)
+			}
+		}
+	}
+
+	batch := db.Batch()
+	writes := 0
+	var struck []string
+	if len(missing) > 0 {
+		dojoRef := db.Collection("dojos").Doc(dojoID)
+		refs := make([]*firestore.DocumentRef, 0, 2*len(missing))
+		for _, uid := range missing {
+			refs = append(refs, strikeRef(db, dojoID, inst.ID, uid), dojoRef.Collection("members").Doc(uid))
+		}
+		snaps, err := db.GetAll(ctx, refs)
+		if err != nil {
+			return fmt.Errorf("failed to load members: %w", err)
+		}
+		for i, uid := range missing {
+			batch.Update(inst.Collection("reservations").Doc(uid), []firestore.Update{
+				{Path: "noShow", Value: true},
+				{Path: "updatedAt", Value: now},
+			})
+			writes++
+			if strike, member := snaps[2*i], snaps[2*i+1]; !strike.Exists() {
+				batch.Set(strike.Ref, BookingStrike{
+					MemberUID:  uid,
+					Kind:       StrikeNoShow,
+					InstanceID: inst.ID,
+					DateKey:    dateKey,
+					CreatedAt:  now,
+				})
+				writes++
+				if member.Exists() {
+					batch.Update(member.Ref, []firestore.Update{
+						{Path: "noShowCount", Value: firestore.Increment(1)},
+					})
+					writes++
+					struck = append(struck, uid)
+				}
+			}
+			res.NoShows++
+			if writes >= maxNoShowWrites {
+				if _, err := batch.Commit(ctx); err != nil {
+					return fmt.Errorf("failed to record no-shows: %w", err)
+				}
+				batch, writes = db.Batch(), 0
+			}
+		}
+	}
+
+	batch.Set(inst, map[string]interface{}{"noShowsCheckedAt": now}, firestore.MergeAll)
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to record no-shows: %w", err)
+	}
+
+	for _, uid := range struck {
+		if err := s.applyNoShowPenalties(ctx, db, dojoID, uid, policy, now, res); err != nil {
+			log.Printf("no-shows: penalties for %s in dojo %s: %v", uid, dojoID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,403 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// No-show penalty bounds and defaults
+const (
+	maxPenaltyCount      = 50
+	maxPenaltyDays       = 365
+	defaultPenaltyWindow = 30
+	defaultRestrictDays  = 14
+
+	// maxRecordStrikes bounds the strikes a booking record lists
+	maxRecordStrikes = 50
+	// maxRestrictedListed bounds the restricted members listed at once
+	maxRestrictedListed = 500
+)
+
+// NoShowPenalties are the consequences of repeated no-shows within
+// WindowDays: a warning notification after WarnAfter, and after
+// RestrictAfter a restriction keeping the member from booking classes
+// themselves for RestrictDays. Zero turns a step off; staff can still book a
+// restricted member, and lift the restriction.
+type NoShowPenalties struct {
+	WarnAfter     int `firestore:"warnAfter" json:"warnAfter"`
+	RestrictAfter int `firestore:"restrictAfter" json:"restrictAfter"`
+	WindowDays    int `firestore:"windowDays" json:"windowDays"`     // 0 = 30
+	RestrictDays  int `firestore:"restrictDays" json:"restrictDays"` // 0 = 14
+}
+
+func (p NoShowPenalties) validate() error {
+	if p.WarnAfter < 0 || p.WarnAfter > maxPenaltyCount || p.RestrictAfter < 0 || p.RestrictAfter > maxPenaltyCount {
+		return fmt.Errorf("%w: warnAfter and restrictAfter must be 0-%d", ErrBadRequest, maxPenaltyCount)
+	}
+	if p.WindowDays < 0 || p.WindowDays > maxPenaltyDays || p.RestrictDays < 0 || p.RestrictDays > maxPenaltyDays {
+		return fmt.Errorf("%w: windowDays and restrictDays must be 0-%d", ErrBadRequest, maxPenaltyDays)
+	}
+	if p.WarnAfter > 0 && p.RestrictAfter > 0 && p.WarnAfter >= p.RestrictAfter {
+		return fmt.Errorf("%w: warnAfter must be below restrictAfter", ErrBadRequest)
+	}
+	return nil
+}
+
+func (p NoShowPenalties) window() int {
+	if p.WindowDays > 0 {
+		return p.WindowDays
+	}
+	return defaultPenaltyWindow
+}
+
+func (p NoShowPenalties) restrictDays() int {
+	if p.RestrictDays > 0 {
+		return p.RestrictDays
+	}
+	return defaultRestrictDays
+}
+
+// BookingRestriction is bookingRestriction on a member doc: until the end
+// of Until the member cannot book classes, nor are recurring bookings
+// generated for them
+type BookingRestriction struct {
+	Until   string    `firestore:"until" json:"until"`     // YYYY-MM-DD, inclusive
+	NoShows int       `firestore:"noShows" json:"noShows"` // in the window when it was set
+	SetAt   time.Time `firestore:"setAt" json:"setAt"`
+}
+
+// BookingRecord is a member's booking history as staff see it
+type BookingRecord struct {
+	MemberUID       string              `json:"memberUid"`
+	LateCancelCount int                 `json:"lateCancelCount"`
+	NoShowCount     int                 `json:"noShowCount"`
+	RecentNoShows   int                 `json:"recentNoShows"` // within the penalty window
+	WindowDays      int                 `json:"windowDays"`
+	Restriction     *BookingRestriction `json:"restriction,omitempty"` // in effect
+	Strikes         []StrikeView        `json:"strikes"`               // latest first
+}
+
+// StrikeView is a booking strike with its id, for forgiving it
+type StrikeView struct {
+	ID string `json:"id"`
+	BookingStrike
+}
+
+// RestrictedMember is one member currently barred from booking
+type RestrictedMember struct {
+	MemberUID   string             `json:"memberUid"`
+	DisplayName string             `json:"displayName"`
+	Restriction BookingRestriction `json:"restriction"`
+}
+
+// today is the date in the policy's timezone
+func (p *BookingPolicy) today(now time.Time) time.Time {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+}
+
+func memberRef(db *firestore.Client, dojoID, memberUID string) *firestore.DocumentRef {
+	return db.Collection("dojos").Doc(dojoID).Collection("members").Doc(memberUID)
+}
+
+// memberBooking reads the booking fields of a member doc
+func (s *Service) memberBooking(ctx context.Context, db *firestore.Client, dojoID, memberUID string) (*firestore.DocumentSnapshot, *BookingRestriction, error) {
+	doc, err := memberRef(db, dojoID, memberUID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, nil, fmt.Errorf("failed to load member: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	var m struct {
+		BookingRestriction *BookingRestriction `firestore:"bookingRestriction"`
+	}
+	if err := doc.DataTo(&m); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse member: %w", err)
+	}
+	return doc, m.BookingRestriction, nil
+}
+
+// recentNoShows counts the member's no-show strikes dated from fromDate on
+func recentNoShows(ctx context.Context, db *firestore.Client, dojoID, memberUID, fromDate string) (int, error) {
+	docs, err := db.Collection("dojos").Doc(dojoID).Collection("bookingStrikes").
+		Where("memberUid", "==", memberUID).
+		Where("kind", "==", StrikeNoShow).
+		Where("dateKey", ">=", fromDate).
+		Select().Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count no-shows: %w", err)
+	}
+	return len(docs), nil
+}
+
+// applyNoShowPenalties warns or restricts a member who was just marked a
+// no-show, as the dojo's penalties say. A member is warned once per window,
+// and a restriction is only ever extended.
+func (s *Service) applyNoShowPenalties(ctx context.Context, db *firestore.Client, dojoID, memberUID string, policy *BookingPolicy, now time.Time, res *NoShowResult) error {
+	pen := policy.Penalties
+	if pen.WarnAfter == 0 && pen.RestrictAfter == 0 {
+		return nil
+	}
+	today := policy.today(now)
+	from := today.AddDate(0, 0, -(pen.window() - 1))
+	n, err := recentNoShows(ctx, db, dojoID, memberUID, from.Format(instanceid.DateLayout))
+	if err != nil {
+		return err
+	}
+	doc, current, err := s.memberBooking(ctx, db, dojoID, memberUID)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if pen.RestrictAfter > 0 && n >= pen.RestrictAfter {
+		until := today.AddDate(0, 0, pen.restrictDays()-1).Format(instanceid.DateLayout)
+		if current != nil && current.Until >= until {
+			return nil
+		}
+		br := BookingRestriction{Until: until, NoShows: n, SetAt: now}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "bookingRestriction", Value: br}}); err != nil {
+			return fmt.Errorf("failed to restrict booking: %w", err)
+		}
+		res.Restricted++
+		s.notifyNoShows(ctx, dojoID, memberUID, "booking_restricted", "Booking paused",
+			fmt.Sprintf("After %d missed classes in the last %d days you can't book classes yourself until %s. Ask the dojo if you need a place.", n, pen.window(), until),
+			map[string]interface{}{"noShows": n, "until": until})
+		return nil
+	}
+
+	if pen.WarnAfter > 0 && n >= pen.WarnAfter {
+		if warned, ok := doc.Data()["noShowWarnedAt"].(time.Time); ok && !warned.Before(from) {
+			return nil
+		}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "noShowWarnedAt", Value: now}}); err != nil {
+			return fmt.Errorf("failed to record no-show warning: %w", err)
+		}
+		res.Warned++
+		body := fmt.Sprintf("You missed %d booked classes in the last %d days. Please cancel when you can't come, so someone else can have your place.", n, pen.window())
+		if pen.RestrictAfter > 0 {
+			body += fmt.Sprintf(" After %d, booking is paused for %d days.", pen.RestrictAfter, pen.restrictDays())
+		}
+		s.notifyNoShows(ctx, dojoID, memberUID, "no_show_warning", "Missed classes", body, map[string]interface{}{"noShows": n})
+	}
+	return nil
+}
+
+// notifyNoShows tells the member about a penalty (best effort)
+func (s *Service) notifyNoShows(ctx context.Context, dojoID, memberUID, kind, title, body string, data map[string]interface{}) {
+	_, _, err := s.repo.fs.Collection("users").Doc(memberUID).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title":     title,
+		"body":      body,
+		"type":      kind,
+		"data":      data,
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("no-shows: %s notification for %s failed: %v", kind, memberUID, err)
+	}
+}
+
+// GetBookingRecord returns a member's late-cancel and no-show counts, their
+// recent strikes and any booking restriction in effect (staff only)
+func (s *Service) GetBookingRecord(ctx context.Context, dojoID, memberUID string) (*BookingRecord, error) {
+	if strings.TrimSpace(dojoID) == "" || strings.TrimSpace(memberUID) == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.bookingPolicy(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	doc, br, err := s.memberBooking(ctx, db, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+
+	today := policy.today(time.Now())
+	out := &BookingRecord{MemberUID: memberUID, WindowDays: policy.Penalties.window(), Strikes: []StrikeView{}}
+	if n, ok := doc.Data()["lateCancelCount"].(int64); ok {
+		out.LateCancelCount = int(n)
+	}
+	if n, ok := doc.Data()["noShowCount"].(int64); ok {
+		out.NoShowCount = int(n)
+	}
+	if br != nil && br.Until >= today.Format(instanceid.DateLayout) {
+		out.Restriction = br
+	}
+	from := today.AddDate(0, 0, -(out.WindowDays - 1)).Format(instanceid.DateLayout)
+	if out.RecentNoShows, err = recentNoShows(ctx, db, dojoID, memberUID, from); err != nil {
+		return nil, err
+	}
+
+	iter := db.Collection("dojos").Doc(dojoID).Collection("bookingStrikes").
+		Where("memberUid", "==", memberUID).
+		OrderBy("dateKey", firestore.Desc).
+		Limit(maxRecordStrikes).Documents(ctx)
+	defer iter.Stop()
+	for {
+		snap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list strikes: %w", err)
+		}
+		v := StrikeView{ID: snap.Ref.ID}
+		if err := snap.DataTo(&v.BookingStrike); err != nil {
+			continue
+		}
+		out.Strikes = append(out.Strikes, v)
+	}
+	return out, nil
+}
+
+// ListBookingRestrictions lists the members currently barred from booking
+// (staff only)
+func (s *Service) ListBookingRestrictions(ctx context.Context, dojoID string) ([]RestrictedMember, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.bookingPolicy(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	today := policy.today(time.Now()).Format(instanceid.DateLayout)
+
+	iter := db.Collection("dojos").Doc(dojoID).Collection("members").
+		Where("bookingRestriction.until", ">=", today).
+		Limit(maxRestrictedListed).Documents(ctx)
+	defer iter.Stop()
+	out := []RestrictedMember{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list restricted members: %w", err)
+		}
+		var m struct {
+			DisplayName        string             `firestore:"displayName"`
+			BookingRestriction BookingRestriction `firestore:"bookingRestriction"`
+		}
+		if err := doc.DataTo(&m); err != nil {
+			continue
+		}
+		out = append(out, RestrictedMember{MemberUID: doc.Ref.ID, DisplayName: m.DisplayName, Restriction: m.BookingRestriction})
+	}
+	return out, nil
+}
+
+// LiftBookingRestriction lets a restricted member book again (staff
+// override). Their no-shows stay counted, so the next one within the window
+// restricts them again.
+func (s *Service) LiftBookingRestriction(ctx context.Context, staffUID, dojoID, memberUID string) (*BookingRecord, error) {
+	if strings.TrimSpace(dojoID) == "" || strings.TrimSpace(memberUID) == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	doc, br, err := s.memberBooking(ctx, db, dojoID, memberUID)
+	if err != nil {
+		return nil, err
+	}
+	if br != nil {
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{
+			{Path: "bookingRestriction", Value: firestore.Delete},
+			{Path: "updatedAt", Value: time.Now().UTC()},
+			{Path: "updatedBy", Value: staffUID},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to lift booking restriction: %w", err)
+		}
+	}
+	return s.GetBookingRecord(ctx, dojoID, memberUID)
+}
+
+// ForgiveStrike deletes a late cancellation or no-show (staff override),
+// taking it off the member's count and clearing the mark on the reservation
+func (s *Service) ForgiveStrike(ctx context.Context, dojoID, strikeID string) (*BookingRecord, error) {
+	if strings.TrimSpace(dojoID) == "" || strings.TrimSpace(strikeID) == "" || strings.Contains(strikeID, "/") {
+		return nil, fmt.Errorf("%w: dojoId and a valid strikeId are required", ErrBadRequest)
+	}
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	dojoRef := db.Collection("dojos").Doc(dojoID)
+	ref := dojoRef.Collection("bookingStrikes").Doc(strikeID)
+
+	var strike BookingStrike
+	err = db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return err
+		}
+		if !doc.Exists() {
+			return fmt.Errorf("%w: strike not found", ErrNotFound)
+		}
+		if err := doc.DataTo(&strike); err != nil {
+			return err
+		}
+		member, err := tx.Get(memberRef(db, dojoID, strike.MemberUID))
+		if err != nil && member == nil {
+			return err
+		}
+		resRef := dojoRef.Collection("sessions").Doc(strike.InstanceID).Collection("reservations").Doc(strike.MemberUID)
+		reservation, err := tx.Get(resRef)
+		if err != nil && reservation == nil {
+			return err
+		}
+
+		counter, mark := "noShowCount", "noShow"
+		if strike.Kind == StrikeLateCancel {
+			counter, mark = "lateCancelCount", "lateCancel"
+		}
+		if err := tx.Delete(ref); err != nil {
+			return err
+		}
+		if member.Exists() {
+			if n, _ := member.Data()[counter].(int64); n > 0 {
+				if err := tx.Update(member.Ref, []firestore.Update{{Path: counter, Value: firestore.Increment(-1)}}); err != nil {
+					return err
+				}
+			}
+		}
+		if reservation.Exists() {
+			return tx.Update(resRef, []firestore.Update{{Path: mark, Value: firestore.Delete}})
+		}
+		return nil
+	})
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to forgive strike: %w", err)
+	}
+	return s.GetBookingRecord(ctx, dojoID, strike.MemberUID)
+}
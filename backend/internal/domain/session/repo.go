@@ -6,29 +6,66 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/firebase"
 )
 
 type Repo struct {
-	fs *firestore.Client
+	fs       *firestore.Client
+	resolver firebase.ClientResolver // per-dojo database (data residency), optional
 }
 
 func NewRepo(fs *firestore.Client) *Repo {
 	return &Repo{fs: fs}
 }
 
+// SetClientResolver routes each dojo's sessions to its own database
+func (r *Repo) SetClientResolver(resolver firebase.ClientResolver) {
+	r.resolver = resolver
+}
+
+// db returns the database that holds the dojo's data
+func (r *Repo) db(ctx context.Context, dojoID string) (*firestore.Client, error) {
+	if r.resolver == nil {
+		return r.fs, nil
+	}
+	c, err := r.resolver.ClientFor(ctx, dojoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dojo database: %w", err)
+	}
+	return c, nil
+}
+
+// dojoDoc returns dojos/{dojoID} in the database that holds the dojo's data
+func (r *Repo) dojoDoc(ctx context.Context, dojoID string) (*firestore.DocumentRef, error) {
+	client, err := r.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return client.Collection("dojos").Doc(dojoID), nil
+}
+
 // timetableClassesCollection returns the timetableClasses subcollection for a dojo
 // This is the template collection for recurring classes (used by frontend timetable UI)
-func (r *Repo) timetableClassesCollection(dojoID string) *firestore.CollectionRef {
-	return r.fs.Collection("dojos").Doc(dojoID).Collection("timetableClasses")
+func (r *Repo) timetableClassesCollection(ctx context.Context, dojoID string) (*firestore.CollectionRef, error) {
+	doc, err := r.dojoDoc(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Collection("timetableClasses"), nil
 }
 
 // Create creates a new session (timetable class template)
 func (r *Repo) Create(ctx context.Context, dojoID string, s Session) (*Session, error) {
-	ref := r.timetableClassesCollection(dojoID).NewDoc()
+	col, err := r.timetableClassesCollection(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	ref := col.NewDoc()
 	s.ID = ref.ID
 	s.DojoID = dojoID
 
-	_, err := ref.Set(ctx, s)
+	_, err = ref.Set(ctx, s)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
@@ -38,7 +75,11 @@ func (r *Repo) Create(ctx context.Context, dojoID string, s Session) (*Session,
 
 // Get retrieves a session by ID
 func (r *Repo) Get(ctx context.Context, dojoID, sessionID string) (*Session, error) {
-	doc, err := r.timetableClassesCollection(dojoID).Doc(sessionID).Get(ctx)
+	col, err := r.timetableClassesCollection(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := col.Doc(sessionID).Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: session not found", ErrNotFound)
 	}
@@ -55,9 +96,12 @@ func (r *Repo) Get(ctx context.Context, dojoID, sessionID string) (*Session, err
 
 // Update updates a session
 func (r *Repo) Update(ctx context.Context, dojoID, sessionID string, updates map[string]interface{}) (*Session, error) {
-	ref := r.timetableClassesCollection(dojoID).Doc(sessionID)
+	col, err := r.timetableClassesCollection(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := ref.Set(ctx, updates, firestore.MergeAll)
+	_, err = col.Doc(sessionID).Set(ctx, updates, firestore.MergeAll)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update session: %w", err)
 	}
@@ -67,7 +111,11 @@ func (r *Repo) Update(ctx context.Context, dojoID, sessionID string, updates map
 
 // Delete deletes a session
 func (r *Repo) Delete(ctx context.Context, dojoID, sessionID string) error {
-	_, err := r.timetableClassesCollection(dojoID).Doc(sessionID).Delete(ctx)
+	col, err := r.timetableClassesCollection(ctx, dojoID)
+	if err != nil {
+		return err
+	}
+	_, err = col.Doc(sessionID).Delete(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
@@ -76,7 +124,11 @@ func (r *Repo) Delete(ctx context.Context, dojoID, sessionID string) error {
 
 // List lists sessions (timetable classes) for a dojo
 func (r *Repo) List(ctx context.Context, dojoID string, input ListSessionsInput) ([]Session, error) {
-	q := r.timetableClassesCollection(dojoID).Query
+	col, err := r.timetableClassesCollection(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	q := col.Query
 
 	if input.DayOfWeek != nil {
 		q = q.Where("dayOfWeek", "==", *input.DayOfWeek)
@@ -86,11 +138,22 @@ func (r *Repo) List(ctx context.Context, dojoID string, input ListSessionsInput)
 		q = q.Where("isActive", "==", true)
 	}
 
+	if input.InstructorUID != "" {
+		q = q.Where("instructorUid", "==", input.InstructorUID)
+	}
+
 	limit := input.Limit
 	if limit <= 0 || limit > 100 {
 		limit = 50
 	}
-	q = q.Limit(int(limit))
+	// tags are matched in memory (array-contains-any plus the ordering would
+	// need a composite index), so read the whole timetable first
+	tags := NormalizeTags(input.Tags)
+	if len(tags) > 0 {
+		q = q.Limit(100)
+	} else {
+		q = q.Limit(int(limit))
+	}
 
 	// Order by dayOfWeek, then startTime
 	q = q.OrderBy("dayOfWeek", firestore.Asc).OrderBy("startTime", firestore.Asc)
@@ -114,7 +177,13 @@ func (r *Repo) List(ctx context.Context, dojoID string, input ListSessionsInput)
 		}
 		s.ID = doc.Ref.ID
 		s.DojoID = dojoID
+		if len(tags) > 0 && !s.hasAnyTag(tags) {
+			continue
+		}
 		sessions = append(sessions, s)
+		if int64(len(sessions)) == limit {
+			break
+		}
 	}
 
 	if sessions == nil {
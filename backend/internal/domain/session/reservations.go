@@ -0,0 +1,213 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Reservation statuses
+const (
+	ReservationConfirmed = "confirmed"
+	ReservationCancelled = "cancelled" // by the member, who keeps the doc
+)
+
+// Outcomes of BookInstance
+const (
+	Booked        = "booked"
+	BookedAlready = "already" // the member has a reservation, possibly cancelled by them
+	BookedFull    = "full"
+	BookedBlocked = "suspended" // the member is suspended, or barred from booking after no-shows, on the date
+)
+
+// Reservation is dojos/{dojoId}/sessions/{instanceId}/reservations/{memberUid},
+// a member's place in one class instance. Members write their own from the
+// app; the server writes the ones generated from recurring bookings.
+type Reservation struct {
+	DojoID       string    `firestore:"dojoId" json:"dojoId"`
+	SessionID    string    `firestore:"sessionId" json:"sessionId"` // the instance id
+	MemberID     string    `firestore:"memberId" json:"memberId"`
+	MemberName   string    `firestore:"memberName" json:"memberName"`
+	Status       string    `firestore:"status" json:"status"`
+	AddedByStaff bool      `firestore:"addedByStaff" json:"addedByStaff"`
+	RecurringID  string    `firestore:"recurringId,omitempty" json:"recurringId,omitempty"`
+	CreatedAt    time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time `firestore:"updatedAt" json:"updatedAt"`
+
+	// Set by the API under a booking policy (see bookings.go)
+	CancelledAt *time.Time `firestore:"cancelledAt,omitempty" json:"cancelledAt,omitempty"`
+	LateCancel  bool       `firestore:"lateCancel,omitempty" json:"lateCancel,omitempty"`
+	NoShow      bool       `firestore:"noShow,omitempty" json:"noShow,omitempty"`
+}
+
+// BookInstance reserves the member a place in the class on dateKey, unless
+// they already have a reservation for it (kept as is, so a member who
+// cancelled one date is not booked again), they are suspended or barred from
+// booking on the date or
+// the instance has MaxCapacity confirmed reservations. The instance doc the app lists is created when
+// missing.
+func (s *Service) BookInstance(ctx context.Context, dojoID string, sess *Session, dateKey string, r Reservation) (string, error) {
+	outcome, _, err := s.bookInstance(ctx, dojoID, sess, dateKey, r, false)
+	return outcome, err
+}
+
+// bookInstance is BookInstance; with reopen, a reservation the member
+// cancelled is confirmed again instead of kept. It also returns the
+// reservation as it stands, the existing one when BookedAlready.
+func (s *Service) bookInstance(ctx context.Context, dojoID string, sess *Session, dateKey string, r Reservation, reopen bool) (string, *Reservation, error) {
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return "", nil, err
+	}
+	instanceID := instanceid.New(dateKey, sess.ID)
+	instRef := db.Collection("dojos").Doc(dojoID).Collection("sessions").Doc(instanceID)
+	resRef := instRef.Collection("reservations").Doc(r.MemberID)
+	memberRef := db.Collection("dojos").Doc(dojoID).Collection("members").Doc(r.MemberID)
+
+	now := time.Now().UTC()
+	r.DojoID, r.SessionID = dojoID, instanceID
+	r.Status = ReservationConfirmed
+	r.CreatedAt, r.UpdatedAt = now, now
+
+	outcome := Booked
+	var stored Reservation
+	err = db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		outcome, stored = Booked, r
+		existing, err := tx.Get(resRef)
+		if err != nil && existing == nil {
+			return err
+		}
+		var prev Reservation
+		if existing.Exists() {
+			if err := existing.DataTo(&prev); err != nil {
+				return err
+			}
+			if !reopen || prev.Status != ReservationCancelled {
+				outcome, stored = BookedAlready, prev
+				return nil
+			}
+		}
+		memberDoc, err := tx.Get(memberRef)
+		if err != nil && memberDoc == nil {
+			return err
+		}
+		if memberDoc.Exists() {
+			var m fsdoc.Member
+			if err := fsdoc.Decode(memberDoc, &m); err == nil {
+				if m.SuspendedOn(dateKey) || m.BookingRestrictedOn(dateKey) {
+					outcome = BookedBlocked
+					return nil
+				}
+				if stored.MemberName == "" {
+					stored.MemberName = m.DisplayName
+				}
+			}
+		}
+		if sess.MaxCapacity > 0 {
+			confirmed, err := tx.Documents(instRef.Collection("reservations").Where("status", "==", ReservationConfirmed)).GetAll()
+			if err != nil {
+				return err
+			}
+			if len(confirmed) >= sess.MaxCapacity {
+				outcome = BookedFull
+				return nil
+			}
+		}
+		inst, err := tx.Get(instRef)
+		if err != nil && inst == nil {
+			return err
+		}
+		if !inst.Exists() {
+			if err := tx.Create(instRef, map[string]interface{}{
+				"dojoId":           dojoID,
+				"timetableClassId": sess.ID,
+				"title":            sess.Title,
+				"dateKey":          dateKey,
+				"weekday":          sess.DayOfWeek,
+				"startMinute":      sess.StartMinute,
+				"durationMinute":   sess.DurationMinute,
+				"instructor":       sess.Instructor,
+				"classType":        sess.ClassType,
+				"createdAt":        now,
+				"createdBy":        r.MemberID,
+			}); err != nil {
+				return err
+			}
+		}
+		if existing.Exists() {
+			stored.CreatedAt = prev.CreatedAt
+			return tx.Set(resRef, stored)
+		}
+		return tx.Create(resRef, stored)
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to book %s: %w", instanceID, err)
+	}
+	return outcome, &stored, nil
+}
+
+// ReleaseRecurringReservation deletes the member's reservation of the class
+// on dateKey if it was generated from recurringID and is still confirmed, so
+// the place goes back to the class and the booking can be generated again
+// later. A reservation the member cancelled themselves is kept. It reports
+// whether one was released.
+func (s *Service) ReleaseRecurringReservation(ctx context.Context, dojoID, sessionID, dateKey, memberUID, recurringID string) (bool, error) {
+	ref, err := s.repo.instanceRef(ctx, dojoID, instanceid.New(dateKey, sessionID))
+	if err != nil {
+		return false, err
+	}
+	ref = ref.Collection("reservations").Doc(memberUID)
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return false, fmt.Errorf("failed to load reservation: %w", err)
+	}
+	if !doc.Exists() {
+		return false, nil
+	}
+	var r Reservation
+	if err := doc.DataTo(&r); err != nil || r.RecurringID != recurringID || r.Status != ReservationConfirmed {
+		return false, nil
+	}
+	if _, err := ref.Delete(ctx, firestore.LastUpdateTime(doc.UpdateTime)); err != nil {
+		return false, fmt.Errorf("failed to release reservation: %w", err)
+	}
+	return true, nil
+}
+
+// MemberReservations reads the member's reservations of the given instances,
+// keyed by instance id; instances they have none for are left out
+func (s *Service) MemberReservations(ctx context.Context, dojoID, memberUID string, instanceIDs []string) (map[string]Reservation, error) {
+	out := map[string]Reservation{}
+	if len(instanceIDs) == 0 {
+		return out, nil
+	}
+	db, err := s.repo.db(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := db.Collection("dojos").Doc(dojoID).Collection("sessions")
+	refs := make([]*firestore.DocumentRef, 0, len(instanceIDs))
+	for _, id := range instanceIDs {
+		refs = append(refs, sessions.Doc(id).Collection("reservations").Doc(memberUID))
+	}
+	snaps, err := db.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reservations: %w", err)
+	}
+	for i, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		var r Reservation
+		if err := snap.DataTo(&r); err != nil {
+			continue
+		}
+		out[instanceIDs[i]] = r
+	}
+	return out, nil
+}
@@ -0,0 +1,183 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// maxFutureDays is how far past today (UTC) an instance may be dated. One day
+// of slack covers dojos east of UTC recording tonight's class.
+const maxFutureDays = 1
+
+// CheckInstance verifies that instanceID names a class the dojo actually
+// holds: either an instance doc under dojos/{dojoId}/sessions, or
+// "YYYY-MM-DD__sessionId" of a timetable class that runs on that date.
+// Instances dated more than a day ahead are rejected.
+func (s *Service) CheckInstance(ctx context.Context, dojoID, instanceID string) error {
+	if instanceID == "" || strings.Contains(instanceID, "/") {
+		return fmt.Errorf("%w: sessionInstanceId is invalid", ErrBadRequest)
+	}
+
+	dateKey, sessionID, ok := instanceid.Parse(instanceID)
+	if !ok {
+		return s.checkInstanceDoc(ctx, dojoID, instanceID)
+	}
+
+	sess, err := s.repo.Get(ctx, dojoID, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := sess.runsOn(dateKey); err != nil {
+		return err
+	}
+	return checkInstanceDate(dateKey)
+}
+
+// HeldOn reports whether the class runs on dateKey: right weekday, not
+// cancelled for that date and not past its recurrence end
+func (sess *Session) HeldOn(dateKey string) bool {
+	return sess.runsOn(dateKey) == nil
+}
+
+// runsOn reports why the class is not held on dateKey, nil if it is
+func (sess *Session) runsOn(dateKey string) error {
+	date, err := time.Parse(instanceid.DateLayout, dateKey)
+	if err != nil {
+		return fmt.Errorf("%w: invalid date %q", ErrBadRequest, dateKey)
+	}
+	if int(date.Weekday()) != sess.DayOfWeek {
+		return fmt.Errorf("%w: %s does not run on %s", ErrBadRequest, sess.Title, date.Weekday())
+	}
+	if slices.Contains(sess.ExcludedDates, dateKey) {
+		return fmt.Errorf("%w: %s was cancelled on %s", ErrBadRequest, sess.Title, dateKey)
+	}
+	if sess.IsRecurring && !sess.RecurrenceEnd.IsZero() && date.After(sess.RecurrenceEnd) {
+		return fmt.Errorf("%w: %s ended on %s", ErrBadRequest, sess.Title, sess.RecurrenceEnd.Format(instanceid.DateLayout))
+	}
+	return nil
+}
+
+// checkInstanceDoc accepts instance ids created by clients before the
+// "YYYY-MM-DD__sessionId" convention, as long as the instance doc exists
+func (s *Service) checkInstanceDoc(ctx context.Context, dojoID, instanceID string) error {
+	ref, err := s.repo.instanceRef(ctx, dojoID, instanceID)
+	if err != nil {
+		return err
+	}
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return fmt.Errorf("failed to load class instance: %w", err)
+	}
+	if !doc.Exists() {
+		return fmt.Errorf("%w: sessionInstanceId must be YYYY-MM-DD__sessionId or an existing class instance", ErrBadRequest)
+	}
+	var inst fsdoc.SessionInstance
+	if err := fsdoc.Decode(doc, &inst); err != nil {
+		return fmt.Errorf("%w: class instance is malformed", ErrBadRequest)
+	}
+	dateKey := inst.DateKey
+	if dateKey == "" {
+		dateKey = instanceid.Date(instanceID)
+	}
+	return checkInstanceDate(dateKey)
+}
+
+// checkInstanceDate rejects missing, unparseable and far-future dates
+func checkInstanceDate(dateKey string) error {
+	date, err := time.Parse(instanceid.DateLayout, dateKey)
+	if err != nil {
+		return fmt.Errorf("%w: class instance has no valid date", ErrBadRequest)
+	}
+	latest := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, maxFutureDays)
+	if date.After(latest) {
+		return fmt.Errorf("%w: %s is in the future", ErrBadRequest, dateKey)
+	}
+	return nil
+}
+
+// InstanceInfo is what an instance id resolves to
+type InstanceInfo struct {
+	InstanceID string   `json:"instanceId"`
+	Date       string   `json:"date,omitempty"`
+	Weekday    string   `json:"weekday,omitempty"`
+	SessionID  string   `json:"sessionId,omitempty"`
+	Session    *Session `json:"session,omitempty"`
+	Title      string   `json:"title,omitempty"`
+
+	// Canonical is false for instance doc ids that predate YYYY-MM-DD__sessionId
+	Canonical bool `json:"canonical"`
+	// Scheduled reports whether the class runs on that date; Problem says why not
+	Scheduled bool   `json:"scheduled"`
+	Problem   string `json:"problem,omitempty"`
+}
+
+// ResolveInstance returns the class and date behind an instance id (any dojo member)
+func (s *Service) ResolveInstance(ctx context.Context, uid, dojoID, instanceID string) (*InstanceInfo, error) {
+	if dojoID == "" || instanceID == "" || strings.Contains(instanceID, "/") {
+		return nil, fmt.Errorf("%w: dojoId and a valid instanceId are required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+			return nil, fmt.Errorf("%w: only dojo members can view classes", ErrUnauthorized)
+		}
+	}
+
+	out := &InstanceInfo{InstanceID: instanceID}
+	dateKey, sessionID, ok := instanceid.Parse(instanceID)
+	if ok {
+		sess, err := s.repo.Get(ctx, dojoID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		out.Canonical = true
+		out.SessionID = sessionID
+		out.Session = sess
+		out.Title = sess.Title
+		out.Date = dateKey
+		if err := sess.runsOn(dateKey); err != nil {
+			out.Problem = strings.TrimPrefix(err.Error(), ErrBadRequest.Error()+": ")
+		} else {
+			out.Scheduled = true
+		}
+	} else {
+		ref, err := s.repo.instanceRef(ctx, dojoID, instanceID)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := ref.Get(ctx)
+		if err != nil && doc == nil {
+			return nil, fmt.Errorf("failed to load class instance: %w", err)
+		}
+		if !doc.Exists() {
+			return nil, fmt.Errorf("%w: class instance not found", ErrNotFound)
+		}
+		var inst fsdoc.SessionInstance
+		if err := fsdoc.Decode(doc, &inst); err != nil {
+			return nil, err
+		}
+		out.Title = inst.Title
+		out.Date = inst.DateKey
+		if out.Date == "" {
+			out.Date = instanceid.Date(instanceID)
+		}
+		out.Scheduled = out.Date != ""
+		if !out.Scheduled {
+			out.Problem = "class instance has no valid date"
+		}
+	}
+
+	if date, err := time.Parse(instanceid.DateLayout, out.Date); err == nil {
+		out.Weekday = date.Weekday().String()
+	}
+	return out, nil
+}
@@ -7,22 +7,32 @@ import (
 	"time"
 
 	"dojo-manager/backend/internal/domain/dojo"
-	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/domain/metering"
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/planlimit"
 )
 
+// maxTargetHeadcount bounds class attendance goals
+const maxTargetHeadcount = 500
+
+// maxEligibilityAge bounds class age limits
+const maxEligibilityAge = 100
+
 type Service struct {
-	repo      *Repo
-	dojoRepo  *dojo.Repo
-	stripeSvc *stripedom.Service // Add Stripe service for plan limits
+	repo     *Repo
+	dojoRepo *dojo.Repo
+	limits   planlimit.PlanLimiter // plan caps (Unlimited without billing)
+	meter    *metering.Recorder    // usage events (optional)
 }
 
-func NewService(repo *Repo, dojoRepo *dojo.Repo) *Service {
-	return &Service{repo: repo, dojoRepo: dojoRepo}
+// NewService takes the plan limiter capping the number of classes (nil = unlimited)
+func NewService(repo *Repo, dojoRepo *dojo.Repo, limits planlimit.PlanLimiter) *Service {
+	return &Service{repo: repo, dojoRepo: dojoRepo, limits: planlimit.OrUnlimited(limits)}
 }
 
-// SetStripeService sets the stripe service for plan limit checks
-func (s *Service) SetStripeService(stripeSvc *stripedom.Service) {
-	s.stripeSvc = stripeSvc
+// SetMeteringRecorder sets the recorder for usage events
+func (s *Service) SetMeteringRecorder(meter *metering.Recorder) {
+	s.meter = meter
 }
 
 // Create creates a new session
@@ -42,10 +52,18 @@ func (s *Service) Create(ctx context.Context, staffUID, dojoID string, in Create
 	}
 
 	// ★ Check plan limit before creating class
-	if s.stripeSvc != nil {
-		if err := s.stripeSvc.CheckPlanLimit(ctx, dojoID, "class"); err != nil {
-			return nil, err
-		}
+	if err := s.limits.CheckPlanLimit(ctx, dojoID, "class"); err != nil {
+		return nil, err
+	}
+
+	instructor, err := s.resolveInstructor(ctx, dojoID, in.InstructorUID, in.Instructor)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.validateTags(ctx, dojoID, in.Tags)
+	if err != nil {
+		return nil, err
 	}
 
 	now := time.Now().UTC()
@@ -71,7 +89,8 @@ func (s *Service) Create(ctx context.Context, staffUID, dojoID string, in Create
 		DayOfWeek:      in.DayOfWeek,
 		StartTime:      in.StartTime,
 		EndTime:        in.EndTime,
-		Instructor:     in.Instructor,
+		Instructor:     instructor,
+		InstructorUID:  in.InstructorUID,
 		ClassType:      classType,
 		MaxCapacity:    in.MaxCapacity,
 		Location:       in.Location,
@@ -81,6 +100,11 @@ func (s *Service) Create(ctx context.Context, staffUID, dojoID string, in Create
 		UpdatedAt:      now,
 		IsRecurring:    in.IsRecurring,
 		RecurrenceRule: in.RecurrenceRule,
+		Tags:           tags,
+		MinAge:         in.MinAge,
+		MaxAge:         in.MaxAge,
+		MinBelt:        in.MinBelt,
+		KidsOnly:       in.KidsOnly,
 		// Frontend compatibility fields
 		Weekday:        in.DayOfWeek,
 		StartMinute:    startMinute,
@@ -95,7 +119,17 @@ func (s *Service) Create(ctx context.Context, staffUID, dojoID string, in Create
 		}
 	}
 
-	return s.repo.Create(ctx, dojoID, session)
+	created, err := s.repo.Create(ctx, dojoID, session)
+	if err != nil {
+		return nil, err
+	}
+
+	s.meter.Record(ctx, metering.EventClassCreated, dojoID, staffUID, map[string]interface{}{
+		"sessionId": created.ID,
+		"classType": created.ClassType,
+	})
+
+	return created, nil
 }
 
 // Get retrieves a session by ID
@@ -123,7 +157,7 @@ func (s *Service) Update(ctx context.Context, staffUID, dojoID, sessionID string
 	}
 
 	// Check if session exists
-	_, err = s.repo.Get(ctx, dojoID, sessionID)
+	existing, err := s.repo.Get(ctx, dojoID, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -175,6 +209,20 @@ func (s *Service) Update(ctx context.Context, staffUID, dojoID, sessionID string
 	if in.Instructor != nil {
 		updates["instructor"] = *in.Instructor
 	}
+	if in.InstructorUID != nil {
+		display := ""
+		if in.Instructor != nil {
+			display = *in.Instructor
+		}
+		name, err := s.resolveInstructor(ctx, dojoID, *in.InstructorUID, display)
+		if err != nil {
+			return nil, err
+		}
+		updates["instructorUid"] = *in.InstructorUID
+		if *in.InstructorUID != "" {
+			updates["instructor"] = name
+		}
+	}
 	if in.ClassType != nil {
 		ct := *in.ClassType
 		if ct == "" {
@@ -207,6 +255,46 @@ func (s *Service) Update(ctx context.Context, staffUID, dojoID, sessionID string
 			}
 		}
 	}
+	if in.TargetHeadcount != nil {
+		if *in.TargetHeadcount < 0 || *in.TargetHeadcount > maxTargetHeadcount {
+			return nil, fmt.Errorf("%w: targetHeadcount must be 0-%d", ErrBadRequest, maxTargetHeadcount)
+		}
+		updates["targetHeadcount"] = *in.TargetHeadcount
+	}
+	if in.TargetFillRate != nil {
+		if *in.TargetFillRate < 0 || *in.TargetFillRate > 1 {
+			return nil, fmt.Errorf("%w: targetFillRate must be between 0 and 1", ErrBadRequest)
+		}
+		updates["targetFillRate"] = *in.TargetFillRate
+	}
+	if in.Tags != nil {
+		tags, err := s.validateTags(ctx, dojoID, *in.Tags)
+		if err != nil {
+			return nil, err
+		}
+		updates["tags"] = tags
+	}
+	if in.MinAge != nil || in.MaxAge != nil || in.MinBelt != nil {
+		minAge, maxAge, minBelt := existing.MinAge, existing.MaxAge, existing.MinBelt
+		if in.MinAge != nil {
+			minAge = *in.MinAge
+			updates["minAge"] = minAge
+		}
+		if in.MaxAge != nil {
+			maxAge = *in.MaxAge
+			updates["maxAge"] = maxAge
+		}
+		if in.MinBelt != nil {
+			minBelt = *in.MinBelt
+			updates["minBelt"] = minBelt
+		}
+		if err := validateEligibility(minAge, maxAge, minBelt); err != nil {
+			return nil, err
+		}
+	}
+	if in.KidsOnly != nil {
+		updates["kidsOnly"] = *in.KidsOnly
+	}
 
 	return s.repo.Update(ctx, dojoID, sessionID, updates)
 }
@@ -256,6 +344,15 @@ func (s *Service) ListByDay(ctx context.Context, dojoID string, dayOfWeek int) (
 	return s.repo.ListByDay(ctx, dojoID, dayOfWeek)
 }
 
+// ListByInstructor lists the classes taught by a staff member (teaching reports, substitutions)
+func (s *Service) ListByInstructor(ctx context.Context, dojoID, instructorUID string) ([]Session, error) {
+	if dojoID == "" || instructorUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and instructorUid are required", ErrBadRequest)
+	}
+
+	return s.repo.List(ctx, dojoID, ListSessionsInput{InstructorUID: instructorUID, Limit: 100})
+}
+
 // CountClasses counts active classes in a dojo
 func (s *Service) CountClasses(ctx context.Context, dojoID string) (int, error) {
 	sessions, err := s.repo.List(ctx, dojoID, ListSessionsInput{ActiveOnly: true, Limit: 1000})
@@ -265,6 +362,30 @@ func (s *Service) CountClasses(ctx context.Context, dojoID string) (int, error)
 	return len(sessions), nil
 }
 
+// resolveInstructor validates instructorUid as dojo staff and returns the display
+// string to store. An explicit display name wins; otherwise the member's name is used.
+func (s *Service) resolveInstructor(ctx context.Context, dojoID, instructorUID, display string) (string, error) {
+	if instructorUID == "" {
+		return display, nil
+	}
+
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, instructorUID)
+	if err != nil {
+		return "", fmt.Errorf("failed to check instructor: %w", err)
+	}
+	if !isStaff {
+		return "", fmt.Errorf("%w: instructorUid must be a staff member of the dojo", ErrBadRequest)
+	}
+
+	if display != "" {
+		return display, nil
+	}
+	if m, err := s.dojoRepo.GetMember(ctx, dojoID, instructorUID); err == nil && m.FullName != "" {
+		return m.FullName, nil
+	}
+	return display, nil
+}
+
 // validateCreateInput validates the create session input
 func (s *Service) validateCreateInput(in CreateSessionInput) error {
 	if in.Title == "" {
@@ -285,6 +406,20 @@ func (s *Service) validateCreateInput(in CreateSessionInput) error {
 	if in.ClassType != "" && !IsValidClassType(in.ClassType) {
 		return fmt.Errorf("%w: classType must be one of: adult, kids, mixed", ErrBadRequest)
 	}
+	return validateEligibility(in.MinAge, in.MaxAge, in.MinBelt)
+}
+
+// validateEligibility checks a class's age range and minimum belt
+func validateEligibility(minAge, maxAge int, minBelt string) error {
+	if minAge < 0 || minAge > maxEligibilityAge || maxAge < 0 || maxAge > maxEligibilityAge {
+		return fmt.Errorf("%w: minAge and maxAge must be 0-%d", ErrBadRequest, maxEligibilityAge)
+	}
+	if minAge > 0 && maxAge > 0 && maxAge < minAge {
+		return fmt.Errorf("%w: maxAge must not be below minAge", ErrBadRequest)
+	}
+	if minBelt != "" && !ranks.IsValidBelt(minBelt) {
+		return fmt.Errorf("%w: unknown minBelt %q", ErrBadRequest, minBelt)
+	}
 	return nil
 }
 
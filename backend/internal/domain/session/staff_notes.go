@@ -0,0 +1,211 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// StaffNote is an instructor-only note on a class template in
+// dojos/{dojoId}/timetableClasses/{sessionId}/staffNotes ("watch uke safety
+// on throws"). Unlike the description it is never shown to members, and
+// unlike member notes it belongs to the class; MemberUID optionally points
+// at the student it is about.
+type StaffNote struct {
+	ID        string    `firestore:"-" json:"id"`
+	AuthorUID string    `firestore:"authorUid" json:"authorUid"`
+	Text      string    `firestore:"text" json:"text"`
+	MemberUID string    `firestore:"memberUid,omitempty" json:"memberUid,omitempty"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// StaffNoteInput is the body of POST / PUT .../sessions/{sessionId}/staff-notes
+type StaffNoteInput struct {
+	Text      string `json:"text"`
+	MemberUID string `json:"memberUid,omitempty"`
+}
+
+func (in *StaffNoteInput) Trim() {
+	in.Text = strings.TrimSpace(in.Text)
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+}
+
+const (
+	maxStaffNoteText = 2000
+	maxStaffNotes    = 100
+)
+
+func (r *Repo) staffNotesCol(ctx context.Context, dojoID, sessionID string) (*firestore.CollectionRef, error) {
+	col, err := r.timetableClassesCollection(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return col.Doc(sessionID).Collection("staffNotes"), nil
+}
+
+// requireStaffForSession checks the caller is staff of the dojo and the class exists
+func (s *Service) requireStaffForSession(ctx context.Context, staffUID, dojoID, sessionID string) error {
+	if dojoID == "" || sessionID == "" {
+		return fmt.Errorf("%w: dojoId and sessionId are required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: class staff notes are for instructors only", ErrUnauthorized)
+	}
+	if _, err := s.repo.Get(ctx, dojoID, sessionID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Service) validateStaffNote(ctx context.Context, dojoID string, in StaffNoteInput) error {
+	if in.Text == "" {
+		return fmt.Errorf("%w: text is required", ErrBadRequest)
+	}
+	if len(in.Text) > maxStaffNoteText {
+		return fmt.Errorf("%w: text must be at most %d characters", ErrBadRequest, maxStaffNoteText)
+	}
+	if in.MemberUID != "" {
+		if _, err := s.dojoRepo.GetMember(ctx, dojoID, in.MemberUID); err != nil {
+			return fmt.Errorf("%w: member not found", ErrNotFound)
+		}
+	}
+	return nil
+}
+
+// ListStaffNotes lists a class's staff notes, newest first (staff only)
+func (s *Service) ListStaffNotes(ctx context.Context, staffUID, dojoID, sessionID string) ([]StaffNote, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	sessionID = strings.TrimSpace(sessionID)
+	if err := s.requireStaffForSession(ctx, staffUID, dojoID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.StaffNotesOf(ctx, dojoID, sessionID)
+}
+
+// StaffNotesOf lists a class's staff notes, newest first, without checking
+// the caller; for staff-only views such as the class roster
+func (s *Service) StaffNotesOf(ctx context.Context, dojoID, sessionID string) ([]StaffNote, error) {
+	col, err := s.repo.staffNotesCol(ctx, dojoID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	iter := col.OrderBy("createdAt", firestore.Desc).Limit(maxStaffNotes).Documents(ctx)
+	defer iter.Stop()
+
+	out := []StaffNote{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list staff notes: %w", err)
+		}
+		var n StaffNote
+		if err := doc.DataTo(&n); err != nil {
+			continue
+		}
+		n.ID = doc.Ref.ID
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// AddStaffNote adds a staff note to a class (staff only)
+func (s *Service) AddStaffNote(ctx context.Context, staffUID, dojoID, sessionID string, in StaffNoteInput) (*StaffNote, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	sessionID = strings.TrimSpace(sessionID)
+	if err := s.requireStaffForSession(ctx, staffUID, dojoID, sessionID); err != nil {
+		return nil, err
+	}
+	if err := s.validateStaffNote(ctx, dojoID, in); err != nil {
+		return nil, err
+	}
+
+	col, err := s.repo.staffNotesCol(ctx, dojoID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	n := StaffNote{
+		AuthorUID: staffUID,
+		Text:      in.Text,
+		MemberUID: in.MemberUID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	ref, _, err := col.Add(ctx, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save staff note: %w", err)
+	}
+	n.ID = ref.ID
+	return &n, nil
+}
+
+// UpdateStaffNote edits a class's staff note (staff only); an empty
+// memberUid detaches it from the student
+func (s *Service) UpdateStaffNote(ctx context.Context, staffUID, dojoID, sessionID, noteID string, in StaffNoteInput) (*StaffNote, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	sessionID = strings.TrimSpace(sessionID)
+	if err := s.requireStaffForSession(ctx, staffUID, dojoID, sessionID); err != nil {
+		return nil, err
+	}
+	if err := s.validateStaffNote(ctx, dojoID, in); err != nil {
+		return nil, err
+	}
+
+	col, err := s.repo.staffNotesCol(ctx, dojoID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	ref := col.Doc(strings.TrimSpace(noteID))
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: staff note not found", ErrNotFound)
+	}
+	var n StaffNote
+	if err := doc.DataTo(&n); err != nil {
+		return nil, fmt.Errorf("failed to decode staff note: %w", err)
+	}
+	n.ID = doc.Ref.ID
+	n.Text = in.Text
+	n.MemberUID = in.MemberUID
+	n.UpdatedAt = time.Now().UTC()
+	if _, err := ref.Set(ctx, n); err != nil {
+		return nil, fmt.Errorf("failed to update staff note: %w", err)
+	}
+	return &n, nil
+}
+
+// DeleteStaffNote removes a class's staff note (staff only)
+func (s *Service) DeleteStaffNote(ctx context.Context, staffUID, dojoID, sessionID, noteID string) error {
+	dojoID = strings.TrimSpace(dojoID)
+	sessionID = strings.TrimSpace(sessionID)
+	if err := s.requireStaffForSession(ctx, staffUID, dojoID, sessionID); err != nil {
+		return err
+	}
+
+	col, err := s.repo.staffNotesCol(ctx, dojoID, sessionID)
+	if err != nil {
+		return err
+	}
+	ref := col.Doc(strings.TrimSpace(noteID))
+	if _, err := ref.Get(ctx); err != nil {
+		return fmt.Errorf("%w: staff note not found", ErrNotFound)
+	}
+	if _, err := ref.Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete staff note: %w", err)
+	}
+	return nil
+}
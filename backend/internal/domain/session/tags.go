@@ -0,0 +1,160 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// DefaultTags is the tag set of dojos that have not defined their own
+var DefaultTags = []string{"gi", "no-gi", "fundamentals", "advanced", "competition", "open-mat", "kids"}
+
+const (
+	maxDojoTags    = 30
+	maxSessionTags = 10
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,29}$`)
+
+// TagSet is dojos/{dojoId}/settings/sessionTags, the tags classes may carry
+type TagSet struct {
+	Tags      []string  `firestore:"tags" json:"tags"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt,omitempty"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdateTagSetInput replaces a dojo's tag set
+type UpdateTagSetInput struct {
+	Tags []string `json:"tags"`
+}
+
+// NormalizeTags lowercases, trims and de-duplicates tags, keeping their order
+func NormalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (r *Repo) tagSetRef(ctx context.Context, dojoID string) (*firestore.DocumentRef, error) {
+	doc, err := r.dojoDoc(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Collection("settings").Doc("sessionTags"), nil
+}
+
+// GetTagSet returns the dojo's tag set, or DefaultTags if it has none
+func (s *Service) GetTagSet(ctx context.Context, dojoID string) (*TagSet, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	ref, err := s.repo.tagSetRef(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get session tags: %w", err)
+	}
+	if !doc.Exists() {
+		return &TagSet{Tags: slices.Clone(DefaultTags)}, nil
+	}
+	var ts TagSet
+	if err := doc.DataTo(&ts); err != nil {
+		return nil, fmt.Errorf("failed to parse session tags: %w", err)
+	}
+	if ts.Tags == nil {
+		ts.Tags = []string{}
+	}
+	return &ts, nil
+}
+
+// UpdateTagSet replaces the dojo's tag set. Classes keep tags removed from
+// the set until they are next edited.
+func (s *Service) UpdateTagSet(ctx context.Context, staffUID, dojoID string, in UpdateTagSetInput) (*TagSet, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, staffUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return nil, fmt.Errorf("%w: only staff can edit session tags", ErrUnauthorized)
+	}
+
+	tags := NormalizeTags(in.Tags)
+	if len(tags) > maxDojoTags {
+		return nil, fmt.Errorf("%w: at most %d tags", ErrBadRequest, maxDojoTags)
+	}
+	for _, t := range tags {
+		if !tagPattern.MatchString(t) {
+			return nil, fmt.Errorf("%w: tag %q must be 1-30 lowercase letters, digits or dashes", ErrBadRequest, t)
+		}
+	}
+
+	ts := TagSet{Tags: tags, UpdatedAt: time.Now().UTC(), UpdatedBy: staffUID}
+	ref, err := s.repo.tagSetRef(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ref.Set(ctx, ts); err != nil {
+		return nil, fmt.Errorf("failed to save session tags: %w", err)
+	}
+	return &ts, nil
+}
+
+// validateTags normalizes a class's tags and checks them against the dojo's set
+func (s *Service) validateTags(ctx context.Context, dojoID string, tags []string) ([]string, error) {
+	tags = NormalizeTags(tags)
+	if len(tags) == 0 {
+		return tags, nil
+	}
+	if len(tags) > maxSessionTags {
+		return nil, fmt.Errorf("%w: a class can have at most %d tags", ErrBadRequest, maxSessionTags)
+	}
+	set, err := s.GetTagSet(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		if !slices.Contains(set.Tags, t) {
+			return nil, fmt.Errorf("%w: unknown tag %q (allowed: %s)", ErrBadRequest, t, strings.Join(set.Tags, ", "))
+		}
+	}
+	return tags, nil
+}
+
+// SessionIDsWithTags returns the classes carrying any of the tags, for
+// tag-based notification targeting
+func (s *Service) SessionIDsWithTags(ctx context.Context, dojoID string, tags []string) ([]string, error) {
+	sessions, err := s.repo.List(ctx, dojoID, ListSessionsInput{Tags: tags, Limit: 100})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(sessions))
+	for _, sess := range sessions {
+		out = append(out, sess.ID)
+	}
+	return out, nil
+}
+
+// hasAnyTag reports whether the session carries one of the tags
+func (s *Session) hasAnyTag(tags []string) bool {
+	for _, t := range tags {
+		if slices.Contains(s.Tags, t) {
+			return true
+		}
+	}
+	return false
+}
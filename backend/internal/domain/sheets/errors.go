@@ -0,0 +1,26 @@
+package sheets
+
+import "errors"
+
+var (
+	ErrBadRequest    = errors.New("bad request")
+	ErrNotConfigured = errors.New("no spreadsheet linked")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrDelivery      = errors.New("google sheets request failed")
+)
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrNotConfigured(err error) bool {
+	return errors.Is(err, ErrNotConfigured)
+}
+
+func IsErrRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+func IsErrDelivery(err error) bool {
+	return errors.Is(err, ErrDelivery)
+}
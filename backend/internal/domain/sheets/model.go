@@ -0,0 +1,82 @@
+package sheets
+
+import (
+	"strings"
+	"time"
+)
+
+// Config is the service account owners share their spreadsheets with (see
+// config.SheetsConfig)
+type Config struct {
+	ServiceAccountEmail string
+}
+
+// Sync schedules
+const (
+	ScheduleManual = "manual" // only when staff press sync
+	ScheduleDaily  = "daily"  // also by the scheduled job
+)
+
+// Tabs written in the linked spreadsheet; each sync replaces their contents
+const (
+	MembersTab    = "Members"
+	AttendanceTab = "Attendance"
+)
+
+// Settings is dojos/{dojoId}/settings/sheets (server-only)
+type Settings struct {
+	SpreadsheetID  string      `firestore:"spreadsheetId,omitempty"`
+	Schedule       string      `firestore:"schedule"`
+	AttendanceDays int         `firestore:"attendanceDays"` // how far back the attendance tab goes
+	LastSync       *SyncStatus `firestore:"lastSync,omitempty"`
+	UpdatedAt      time.Time   `firestore:"updatedAt"`
+	UpdatedBy      string      `firestore:"updatedBy,omitempty"`
+}
+
+// SyncStatus is the outcome of the last sync
+type SyncStatus struct {
+	At         time.Time `firestore:"at" json:"at"`
+	Members    int       `firestore:"members" json:"members"`       // rows written
+	Attendance int       `firestore:"attendance" json:"attendance"` // rows written
+	Truncated  bool      `firestore:"truncated,omitempty" json:"truncated,omitempty"`
+	Error      string    `firestore:"error,omitempty" json:"error,omitempty"`
+}
+
+// View is the settings as shown to staff
+type View struct {
+	Linked         bool        `json:"linked"`
+	SpreadsheetID  string      `json:"spreadsheetId,omitempty"`
+	SpreadsheetURL string      `json:"spreadsheetUrl,omitempty"`
+	ShareWith      string      `json:"shareWith"` // the service account to give edit access
+	Schedule       string      `json:"schedule"`
+	AttendanceDays int         `json:"attendanceDays"`
+	LastSync       *SyncStatus `json:"lastSync,omitempty"`
+	UpdatedAt      time.Time   `json:"updatedAt,omitempty"`
+	UpdatedBy      string      `json:"updatedBy,omitempty"`
+}
+
+// UpdateSettingsInput updates the integration (nil fields are left unchanged)
+type UpdateSettingsInput struct {
+	// Spreadsheet is the spreadsheet's URL or id; "" unlinks it
+	Spreadsheet    *string `json:"spreadsheet,omitempty"`
+	Schedule       *string `json:"schedule,omitempty"`
+	AttendanceDays *int    `json:"attendanceDays,omitempty"`
+}
+
+func (in *UpdateSettingsInput) Trim() {
+	if in.Spreadsheet != nil {
+		*in.Spreadsheet = strings.TrimSpace(*in.Spreadsheet)
+	}
+	if in.Schedule != nil {
+		*in.Schedule = strings.TrimSpace(*in.Schedule)
+	}
+}
+
+// RunResult summarizes a scheduled sync run
+type RunResult struct {
+	DojosChecked   int  `json:"dojosChecked"`
+	DojosScheduled int  `json:"dojosScheduled"` // linked with a daily schedule
+	Synced         int  `json:"synced"`
+	Failed         int  `json:"failed"`
+	Partial        bool `json:"partial,omitempty"`
+}
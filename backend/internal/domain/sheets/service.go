@@ -0,0 +1,193 @@
+package sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	sheetsapi "google.golang.org/api/sheets/v4"
+
+	"dojo-manager/backend/internal/firebase"
+)
+
+const (
+	defaultAttendanceDays = 90
+	maxAttendanceDays     = 365
+
+	// minSyncInterval keeps staff from hammering the Sheets quota
+	minSyncInterval = time.Minute
+)
+
+var (
+	spreadsheetURLPattern = regexp.MustCompile(`/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+	spreadsheetIDPattern  = regexp.MustCompile(`^[a-zA-Z0-9_-]{20,100}$`)
+)
+
+// Service pushes a dojo's member roster and recent attendance into a Google
+// Sheet the owner linked, on demand or daily. It writes as the API's service
+// account, so the owner shares the sheet with that account and nothing else
+// is authorized. The router checks settings permission.
+type Service struct {
+	fs     *firestore.Client
+	dbs    firebase.ClientResolver // per-dojo database of attendance (data residency)
+	api    *sheetsapi.Service
+	config Config
+}
+
+// NewService creates the Sheets client with the given credentials (the
+// application default ones if none)
+func NewService(ctx context.Context, fs *firestore.Client, cfg Config, opts ...option.ClientOption) (*Service, error) {
+	opts = append(opts, option.WithScopes(sheetsapi.SpreadsheetsScope))
+	api, err := sheetsapi.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sheets client: %w", err)
+	}
+	return &Service{fs: fs, dbs: firebase.DefaultResolver{Client: fs}, api: api, config: cfg}, nil
+}
+
+// SetClientResolver reads each dojo's attendance from its own database
+func (s *Service) SetClientResolver(resolver firebase.ClientResolver) {
+	s.dbs = resolver
+}
+
+func (s *Service) settingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("sheets")
+}
+
+func (s *Service) settings(ctx context.Context, dojoID string) (*Settings, error) {
+	doc, err := s.settingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load sheets settings: %w", err)
+	}
+	st := &Settings{}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode sheets settings: %w", err)
+		}
+	}
+	if st.Schedule == "" {
+		st.Schedule = ScheduleManual
+	}
+	if st.AttendanceDays <= 0 {
+		st.AttendanceDays = defaultAttendanceDays
+	}
+	return st, nil
+}
+
+func (s *Service) view(st *Settings) *View {
+	v := &View{
+		Linked:         st.SpreadsheetID != "",
+		SpreadsheetID:  st.SpreadsheetID,
+		ShareWith:      s.config.ServiceAccountEmail,
+		Schedule:       st.Schedule,
+		AttendanceDays: st.AttendanceDays,
+		LastSync:       st.LastSync,
+		UpdatedAt:      st.UpdatedAt,
+		UpdatedBy:      st.UpdatedBy,
+	}
+	if v.Linked {
+		v.SpreadsheetURL = "https://docs.google.com/spreadsheets/d/" + st.SpreadsheetID + "/edit"
+	}
+	return v
+}
+
+// GetSettings returns the linked spreadsheet, the schedule and the last sync
+func (s *Service) GetSettings(ctx context.Context, dojoID string) (*View, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	return s.view(st), nil
+}
+
+// UpdateSettings links or unlinks a spreadsheet and sets the schedule. A
+// newly linked spreadsheet must already be shared with the service account.
+func (s *Service) UpdateSettings(ctx context.Context, uid, dojoID string, in UpdateSettingsInput) (*View, error) {
+	in.Trim()
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if in.Spreadsheet != nil {
+		id, err := parseSpreadsheetID(*in.Spreadsheet)
+		if err != nil {
+			return nil, err
+		}
+		if id != "" && id != st.SpreadsheetID {
+			if err := s.checkAccess(ctx, id); err != nil {
+				return nil, err
+			}
+			st.LastSync = nil
+		}
+		st.SpreadsheetID = id
+	}
+	if in.Schedule != nil {
+		switch *in.Schedule {
+		case ScheduleManual, ScheduleDaily:
+			st.Schedule = *in.Schedule
+		default:
+			return nil, fmt.Errorf("%w: schedule must be %q or %q", ErrBadRequest, ScheduleManual, ScheduleDaily)
+		}
+	}
+	if in.AttendanceDays != nil {
+		if *in.AttendanceDays < 1 || *in.AttendanceDays > maxAttendanceDays {
+			return nil, fmt.Errorf("%w: attendanceDays must be 1-%d", ErrBadRequest, maxAttendanceDays)
+		}
+		st.AttendanceDays = *in.AttendanceDays
+	}
+	st.UpdatedAt = time.Now().UTC()
+	st.UpdatedBy = uid
+
+	if _, err := s.settingsRef(dojoID).Set(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save sheets settings: %w", err)
+	}
+	return s.view(st), nil
+}
+
+// parseSpreadsheetID accepts a spreadsheet URL or a bare id
+func parseSpreadsheetID(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if m := spreadsheetURLPattern.FindStringSubmatch(s); m != nil {
+		return m[1], nil
+	}
+	if spreadsheetIDPattern.MatchString(s) {
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: spreadsheet must be a Google Sheets URL or id", ErrBadRequest)
+}
+
+// checkAccess makes sure the service account can open the spreadsheet
+func (s *Service) checkAccess(ctx context.Context, spreadsheetID string) error {
+	_, err := s.api.Spreadsheets.Get(spreadsheetID).Fields("spreadsheetId").Context(ctx).Do()
+	return s.apiError(err)
+}
+
+// apiError explains the Sheets errors staff can fix themselves
+func (s *Service) apiError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case http.StatusForbidden, http.StatusNotFound:
+			return fmt.Errorf("%w: the spreadsheet was not found or is not shared with %s as an editor", ErrBadRequest, s.config.ServiceAccountEmail)
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrDelivery, err)
+}
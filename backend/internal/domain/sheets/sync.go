@@ -0,0 +1,291 @@
+package sheets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	sheetsapi "google.golang.org/api/sheets/v4"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/fsdoc"
+)
+
+const (
+	// scheduledInterval is how long after a sync the daily job syncs again,
+	// short of a day so scheduler jitter does not skip one
+	scheduledInterval = 20 * time.Hour
+
+	// caps keep a sync inside the request deadline and the sheet's cell limit
+	maxMemberRows     = 10000
+	maxAttendanceRows = 50000
+	maxTitleLookups   = 300 // class instance docs read per GetAll
+)
+
+var (
+	memberHeader     = []interface{}{"Name", "Email", "Role", "Status", "Belt", "Stripes", "Kids", "Joined", "UID"}
+	attendanceHeader = []interface{}{"Date", "Class", "Member", "Status", "Recorded At", "Member UID", "Instance ID"}
+)
+
+// Sync writes the roster and recent attendance to the linked spreadsheet now
+func (s *Service) Sync(ctx context.Context, dojoID string) (*SyncStatus, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	st, err := s.settings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if st.SpreadsheetID == "" {
+		return nil, fmt.Errorf("%w: link a spreadsheet first", ErrNotConfigured)
+	}
+	now := time.Now().UTC()
+	if st.LastSync != nil && now.Sub(st.LastSync.At) < minSyncInterval {
+		return nil, fmt.Errorf("%w: synced less than a minute ago", ErrRateLimited)
+	}
+	return s.sync(ctx, dojoID, st, now)
+}
+
+// RunScheduled syncs every dojo with a linked spreadsheet and a daily
+// schedule that has not synced in the last day. Meant to be triggered by
+// Cloud Scheduler; failures are recorded on each dojo's settings.
+func (s *Service) RunScheduled(ctx context.Context, now time.Time) (*RunResult, error) {
+	res := &RunResult{}
+
+	iter := s.fs.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+		dojoID := doc.Ref.ID
+		st, err := s.settings(ctx, dojoID)
+		if err != nil || st.SpreadsheetID == "" || st.Schedule != ScheduleDaily {
+			continue
+		}
+		res.DojosScheduled++
+		if st.LastSync != nil && now.Sub(st.LastSync.At) < scheduledInterval {
+			continue
+		}
+
+		if _, err := s.sync(ctx, dojoID, st, now); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			res.Failed++
+			log.Printf("sheets: dojo %s: %v", dojoID, err)
+			continue
+		}
+		res.Synced++
+	}
+
+	log.Printf("sheets: %d dojos checked, %d scheduled, %d synced, %d failed (partial=%v)",
+		res.DojosChecked, res.DojosScheduled, res.Synced, res.Failed, res.Partial)
+	return res, nil
+}
+
+// sync replaces the contents of the Members and Attendance tabs, creating
+// them if needed, and records the outcome on the settings
+func (s *Service) sync(ctx context.Context, dojoID string, st *Settings, now time.Time) (*SyncStatus, error) {
+	status := &SyncStatus{At: now}
+	err := func() error {
+		members, names, truncated, err := s.memberRows(ctx, dojoID)
+		if err != nil {
+			return err
+		}
+		attendance, attTruncated, err := s.attendanceRows(ctx, dojoID, names, now.AddDate(0, 0, -st.AttendanceDays))
+		if err != nil {
+			return err
+		}
+		status.Members, status.Attendance = len(members)-1, len(attendance)-1
+		status.Truncated = truncated || attTruncated
+
+		if err := s.ensureTabs(ctx, st.SpreadsheetID); err != nil {
+			return err
+		}
+		if err := s.writeTab(ctx, st.SpreadsheetID, MembersTab, members); err != nil {
+			return err
+		}
+		return s.writeTab(ctx, st.SpreadsheetID, AttendanceTab, attendance)
+	}()
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	if _, uerr := s.settingsRef(dojoID).Update(ctx, []firestore.Update{
+		{Path: "lastSync", Value: status},
+	}); uerr != nil {
+		log.Printf("sheets: failed to record sync of dojo %s: %v", dojoID, uerr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// memberRows is the roster, header first, plus member names by uid for the
+// attendance tab
+func (s *Service) memberRows(ctx context.Context, dojoID string) ([][]interface{}, map[string]string, bool, error) {
+	docs, err := s.fs.Collection("dojos").Doc(dojoID).Collection("members").
+		Limit(maxMemberRows + 1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to list members: %w", err)
+	}
+	truncated := len(docs) > maxMemberRows
+	if truncated {
+		docs = docs[:maxMemberRows]
+	}
+
+	rows := [][]interface{}{memberHeader}
+	names := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		m, err := fsdoc.As[fsdoc.Member](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
+		names[doc.Ref.ID] = m.DisplayName
+		if m.Status == "removed" || m.Status == "rejected" {
+			continue
+		}
+		kids := ""
+		if m.IsKids {
+			kids = "Yes"
+		}
+		joined := ""
+		if since := m.Since(); !since.IsZero() {
+			joined = since.UTC().Format("2006-01-02")
+		}
+		rows = append(rows, []interface{}{
+			m.DisplayName, m.Email, m.RoleName(), m.Status, m.Belt(), m.Stripes, kids, joined, doc.Ref.ID,
+		})
+	}
+	return rows, names, truncated, nil
+}
+
+// attendanceRows is the attendance recorded since from, newest first,
+// header first
+func (s *Service) attendanceRows(ctx context.Context, dojoID string, names map[string]string, from time.Time) ([][]interface{}, bool, error) {
+	db, err := s.dbs.ClientFor(ctx, dojoID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve dojo database: %w", err)
+	}
+	dojoRef := db.Collection("dojos").Doc(dojoID)
+	docs, err := dojoRef.Collection("attendance").
+		Where("createdAt", ">=", from).
+		OrderBy("createdAt", firestore.Desc).
+		Limit(maxAttendanceRows + 1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to list attendance: %w", err)
+	}
+	truncated := len(docs) > maxAttendanceRows
+	if truncated {
+		docs = docs[:maxAttendanceRows]
+	}
+
+	records := make([]fsdoc.Attendance, 0, len(docs))
+	instances := map[string]string{}
+	for _, doc := range docs {
+		a, err := fsdoc.As[fsdoc.Attendance](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
+		records = append(records, a)
+		if a.SessionInstanceID != "" {
+			instances[a.SessionInstanceID] = ""
+		}
+	}
+	if err := s.classTitles(ctx, db, dojoRef, instances); err != nil {
+		return nil, false, err
+	}
+
+	rows := make([][]interface{}, 0, len(records)+1)
+	rows = append(rows, attendanceHeader)
+	for _, a := range records {
+		uid := a.Member()
+		rows = append(rows, []interface{}{
+			a.Date(), instances[a.SessionInstanceID], names[uid], a.Status,
+			a.CreatedAt.UTC().Format(time.RFC3339), uid, a.SessionInstanceID,
+		})
+	}
+	return rows, truncated, nil
+}
+
+// classTitles fills in the title of each class instance id, from db (the
+// dojo's database)
+func (s *Service) classTitles(ctx context.Context, db *firestore.Client, dojoRef *firestore.DocumentRef, titles map[string]string) error {
+	refs := make([]*firestore.DocumentRef, 0, len(titles))
+	for id := range titles {
+		refs = append(refs, dojoRef.Collection("sessions").Doc(id))
+	}
+	for len(refs) > 0 {
+		n := min(len(refs), maxTitleLookups)
+		snaps, err := db.GetAll(ctx, refs[:n])
+		if err != nil {
+			return fmt.Errorf("failed to load classes: %w", err)
+		}
+		for _, snap := range snaps {
+			if !snap.Exists() {
+				continue
+			}
+			if inst, err := fsdoc.As[fsdoc.SessionInstance](snap); err == nil {
+				titles[snap.Ref.ID] = inst.Title
+			}
+		}
+		refs = refs[n:]
+	}
+	return nil
+}
+
+// ensureTabs adds whichever of the tabs the spreadsheet lacks
+func (s *Service) ensureTabs(ctx context.Context, spreadsheetID string) error {
+	ss, err := s.api.Spreadsheets.Get(spreadsheetID).Fields("sheets.properties.title").Context(ctx).Do()
+	if err != nil {
+		return s.apiError(err)
+	}
+	have := map[string]bool{}
+	for _, sh := range ss.Sheets {
+		if sh.Properties != nil {
+			have[sh.Properties.Title] = true
+		}
+	}
+	var reqs []*sheetsapi.Request
+	for _, tab := range []string{MembersTab, AttendanceTab} {
+		if !have[tab] {
+			reqs = append(reqs, &sheetsapi.Request{
+				AddSheet: &sheetsapi.AddSheetRequest{Properties: &sheetsapi.SheetProperties{Title: tab}},
+			})
+		}
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	_, err = s.api.Spreadsheets.BatchUpdate(spreadsheetID, &sheetsapi.BatchUpdateSpreadsheetRequest{Requests: reqs}).Context(ctx).Do()
+	return s.apiError(err)
+}
+
+// writeTab replaces a tab's contents with rows
+func (s *Service) writeTab(ctx context.Context, spreadsheetID, tab string, rows [][]interface{}) error {
+	rng := "'" + tab + "'"
+	if _, err := s.api.Spreadsheets.Values.Clear(spreadsheetID, rng, &sheetsapi.ClearValuesRequest{}).Context(ctx).Do(); err != nil {
+		return s.apiError(err)
+	}
+	_, err := s.api.Spreadsheets.Values.Update(spreadsheetID, rng+"!A1", &sheetsapi.ValueRange{Values: rows}).
+		ValueInputOption("RAW").Context(ctx).Do()
+	return s.apiError(err)
+}
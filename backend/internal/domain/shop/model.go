@@ -0,0 +1,126 @@
+package shop
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	maxItemLength  = 100
+	maxSizeLength  = 20
+	maxNotesLength = 500
+	maxQuantity    = 50
+
+	defaultListLimit = 100
+	maxListLimit     = 500
+)
+
+// Order categories
+const (
+	CategoryGi      = "gi"
+	CategoryBelt    = "belt"
+	CategoryApparel = "apparel"
+	CategoryGear    = "gear"
+	CategoryOther   = "other"
+)
+
+var validCategories = map[string]bool{
+	CategoryGi: true, CategoryBelt: true, CategoryApparel: true, CategoryGear: true, CategoryOther: true,
+}
+
+// Payment methods
+const (
+	PaidCash   = "cash"
+	PaidCard   = "card"   // at the front desk terminal
+	PaidStripe = "stripe" // through the order's payment link
+	PaidOther  = "other"
+)
+
+var validPaidMethods = map[string]bool{PaidCash: true, PaidCard: true, PaidStripe: true, PaidOther: true}
+
+// Order is a dojos/{dojoId}/shopOrders document: a gi, belt or other item
+// ordered for a member at the pro shop. Orders are outstanding until they are
+// both paid and delivered.
+type Order struct {
+	ID          string `firestore:"-" json:"id"`
+	MemberUID   string `firestore:"memberUid" json:"memberUid"`
+	MemberName  string `firestore:"memberName,omitempty" json:"memberName,omitempty"`
+	Item        string `firestore:"item" json:"item"`
+	Category    string `firestore:"category" json:"category"`
+	Size        string `firestore:"size,omitempty" json:"size,omitempty"` // e.g. A2, M1, 0000
+	Quantity    int    `firestore:"quantity" json:"quantity"`
+	PriceCents  int64  `firestore:"priceCents" json:"priceCents"` // per item
+	Currency    string `firestore:"currency" json:"currency"`
+	Notes       string `firestore:"notes,omitempty" json:"notes,omitempty"`
+	Outstanding bool   `firestore:"outstanding" json:"outstanding"` // !(Paid && Delivered), for queries
+
+	Paid              bool       `firestore:"paid" json:"paid"`
+	PaidMethod        string     `firestore:"paidMethod,omitempty" json:"paidMethod,omitempty"`
+	PaidAt            *time.Time `firestore:"paidAt,omitempty" json:"paidAt,omitempty"`
+	PaymentURL        string     `firestore:"paymentUrl,omitempty" json:"paymentUrl,omitempty"`
+	CheckoutSessionID string     `firestore:"checkoutSessionId,omitempty" json:"checkoutSessionId,omitempty"`
+
+	Delivered   bool       `firestore:"delivered" json:"delivered"`
+	DeliveredAt *time.Time `firestore:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+
+	CreatedBy string    `firestore:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// TotalCents is the price of the whole order
+func (o Order) TotalCents() int64 {
+	return o.PriceCents * int64(o.Quantity)
+}
+
+// CreateOrderInput is the body of POST /v1/dojos/{dojoId}/shop/orders
+type CreateOrderInput struct {
+	MemberUID  string `json:"memberUid"`
+	Item       string `json:"item"`
+	Category   string `json:"category,omitempty"` // default other
+	Size       string `json:"size,omitempty"`
+	Quantity   int    `json:"quantity,omitempty"` // default 1
+	PriceCents int64  `json:"priceCents"`
+	Currency   string `json:"currency,omitempty"` // default usd
+	Notes      string `json:"notes,omitempty"`
+}
+
+func (in *CreateOrderInput) Trim() {
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	in.Item = strings.TrimSpace(in.Item)
+	in.Category = strings.ToLower(strings.TrimSpace(in.Category))
+	in.Size = strings.TrimSpace(in.Size)
+	in.Currency = strings.ToLower(strings.TrimSpace(in.Currency))
+	in.Notes = strings.TrimSpace(in.Notes)
+}
+
+// UpdateOrderInput is the body of PUT /v1/dojos/{dojoId}/shop/orders/{orderId}
+// (nil fields are left unchanged)
+type UpdateOrderInput struct {
+	Item       *string `json:"item,omitempty"`
+	Size       *string `json:"size,omitempty"`
+	Quantity   *int    `json:"quantity,omitempty"`
+	PriceCents *int64  `json:"priceCents,omitempty"`
+	Notes      *string `json:"notes,omitempty"`
+	Paid       *bool   `json:"paid,omitempty"`
+	PaidMethod string  `json:"paidMethod,omitempty"` // with paid=true, default cash
+	Delivered  *bool   `json:"delivered,omitempty"`
+}
+
+// ListOrdersInput filters the order list
+type ListOrdersInput struct {
+	MemberUID   string
+	Outstanding bool // only orders not yet paid or not yet delivered
+	Limit       int
+}
+
+// PaymentLinkInput is the body of POST .../shop/orders/{orderId}/payment-link
+type PaymentLinkInput struct {
+	SuccessURL string `json:"successUrl"`
+	CancelURL  string `json:"cancelUrl"`
+}
+
+func (in *PaymentLinkInput) Trim() {
+	in.SuccessURL = strings.TrimSpace(in.SuccessURL)
+	in.CancelURL = strings.TrimSpace(in.CancelURL)
+}
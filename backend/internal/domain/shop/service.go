@@ -0,0 +1,438 @@
+package shop
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
+)
+
+// CheckoutKind is the Stripe checkout metadata kind for pro-shop orders
+const CheckoutKind = "shop_order"
+
+// Payments prices orders and takes them by card. The Stripe service
+// implements it; nil when billing is disabled.
+type Payments interface {
+	Currency(ctx context.Context, dojoID string) string
+	CreatePaymentCheckout(ctx context.Context, in stripedom.PaymentCheckoutInput) (string, error)
+	SetPaymentHandler(kind string, h stripedom.PaymentHandler)
+}
+
+type Service struct {
+	fs       *firestore.Client
+	dojoRepo *dojo.Repo
+	payments Payments // payment links (optional)
+}
+
+// NewService returns the pro-shop service. With payments set, orders get
+// payment links and are marked paid when their checkout completes.
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, payments Payments) *Service {
+	s := &Service{fs: fs, dojoRepo: dojoRepo, payments: payments}
+	if payments != nil {
+		payments.SetPaymentHandler(CheckoutKind, s.FulfilCheckout)
+	}
+	return s
+}
+
+func (s *Service) ordersCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("shopOrders")
+}
+
+func (s *Service) requireStaff(ctx context.Context, dojoID, uid string) error {
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+	return nil
+}
+
+// ListOrders lists a dojo's orders, newest first. Staff see everyone's;
+// members only their own.
+func (s *Service) ListOrders(ctx context.Context, uid, dojoID string, in ListOrdersInput) ([]Order, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.Limit <= 0 {
+		in.Limit = defaultListLimit
+	}
+	if in.Limit > maxListLimit {
+		in.Limit = maxListLimit
+	}
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		if in.MemberUID != "" && in.MemberUID != uid {
+			return nil, fmt.Errorf("%w: members can only view their own orders", ErrUnauthorized)
+		}
+		if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+			return nil, fmt.Errorf("%w: only dojo members can view orders", ErrUnauthorized)
+		}
+		in.MemberUID = uid
+	}
+
+	q := s.ordersCol(dojoID).Query
+	if in.MemberUID != "" {
+		q = q.Where("memberUid", "==", in.MemberUID)
+	}
+	if in.Outstanding {
+		q = q.Where("outstanding", "==", true)
+	}
+	iter := q.OrderBy("createdAt", firestore.Desc).Limit(in.Limit).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Order{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list orders: %w", err)
+		}
+		var o Order
+		if err := doc.DataTo(&o); err != nil {
+			continue
+		}
+		o.ID = doc.Ref.ID
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// CreateOrder records an order for a member (staff only)
+func (s *Service) CreateOrder(ctx context.Context, staffUID, dojoID string, in CreateOrderInput) (*Order, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if in.Category == "" {
+		in.Category = CategoryOther
+	}
+	if in.Quantity == 0 {
+		in.Quantity = 1
+	}
+	if in.Currency == "" {
+		in.Currency = stripedom.DefaultCurrency
+		if s.payments != nil {
+			in.Currency = s.payments.Currency(ctx, dojoID)
+		}
+	}
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	m, err := s.dojoRepo.GetMember(ctx, dojoID, in.MemberUID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+
+	now := time.Now().UTC()
+	o := Order{
+		MemberUID:   in.MemberUID,
+		MemberName:  m.FullName,
+		Item:        in.Item,
+		Category:    in.Category,
+		Size:        in.Size,
+		Quantity:    in.Quantity,
+		PriceCents:  in.PriceCents,
+		Currency:    in.Currency,
+		Notes:       in.Notes,
+		Outstanding: true,
+		CreatedBy:   staffUID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	ref, _, err := s.ordersCol(dojoID).Add(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	o.ID = ref.ID
+	return &o, nil
+}
+
+func (in CreateOrderInput) validate() error {
+	if in.MemberUID == "" {
+		return fmt.Errorf("%w: memberUid is required", ErrBadRequest)
+	}
+	if in.Item == "" || len(in.Item) > maxItemLength {
+		return fmt.Errorf("%w: item is required (max %d characters)", ErrBadRequest, maxItemLength)
+	}
+	if !validCategories[in.Category] {
+		return fmt.Errorf("%w: category must be gi, belt, apparel, gear or other", ErrBadRequest)
+	}
+	if len(in.Size) > maxSizeLength {
+		return fmt.Errorf("%w: size is at most %d characters", ErrBadRequest, maxSizeLength)
+	}
+	if in.Quantity < 1 || in.Quantity > maxQuantity {
+		return fmt.Errorf("%w: quantity must be 1-%d", ErrBadRequest, maxQuantity)
+	}
+	if in.PriceCents < 0 {
+		return fmt.Errorf("%w: priceCents must not be negative", ErrBadRequest)
+	}
+	if len(in.Currency) != 3 {
+		return fmt.Errorf("%w: currency must be a 3-letter ISO code", ErrBadRequest)
+	}
+	if len(in.Notes) > maxNotesLength {
+		return fmt.Errorf("%w: notes are at most %d characters", ErrBadRequest, maxNotesLength)
+	}
+	return nil
+}
+
+// UpdateOrder edits an order or marks it paid or delivered (staff only).
+// Marking it unpaid drops any payment link.
+func (s *Service) UpdateOrder(ctx context.Context, staffUID, dojoID, orderID string, in UpdateOrderInput) (*Order, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	orderID = strings.TrimSpace(orderID)
+	if dojoID == "" || orderID == "" {
+		return nil, fmt.Errorf("%w: dojoId and orderId are required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	o, err := s.getOrder(ctx, dojoID, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{"updatedAt": now}
+	if in.Item != nil {
+		item := strings.TrimSpace(*in.Item)
+		if item == "" || len(item) > maxItemLength {
+			return nil, fmt.Errorf("%w: item is required (max %d characters)", ErrBadRequest, maxItemLength)
+		}
+		updates["item"] = item
+	}
+	if in.Size != nil {
+		size := strings.TrimSpace(*in.Size)
+		if len(size) > maxSizeLength {
+			return nil, fmt.Errorf("%w: size is at most %d characters", ErrBadRequest, maxSizeLength)
+		}
+		updates["size"] = size
+	}
+	if in.Notes != nil {
+		notes := strings.TrimSpace(*in.Notes)
+		if len(notes) > maxNotesLength {
+			return nil, fmt.Errorf("%w: notes are at most %d characters", ErrBadRequest, maxNotesLength)
+		}
+		updates["notes"] = notes
+	}
+	if in.Quantity != nil || in.PriceCents != nil {
+		if o.Paid {
+			return nil, fmt.Errorf("%w: quantity and price cannot change once paid", ErrBadRequest)
+		}
+		if in.Quantity != nil {
+			if *in.Quantity < 1 || *in.Quantity > maxQuantity {
+				return nil, fmt.Errorf("%w: quantity must be 1-%d", ErrBadRequest, maxQuantity)
+			}
+			updates["quantity"] = *in.Quantity
+		}
+		if in.PriceCents != nil {
+			if *in.PriceCents < 0 {
+				return nil, fmt.Errorf("%w: priceCents must not be negative", ErrBadRequest)
+			}
+			updates["priceCents"] = *in.PriceCents
+		}
+		// the link charges the old total
+		updates["paymentUrl"] = firestore.Delete
+	}
+
+	paid, delivered := o.Paid, o.Delivered
+	if in.Paid != nil && *in.Paid != o.Paid {
+		paid = *in.Paid
+		if paid {
+			method := strings.ToLower(strings.TrimSpace(in.PaidMethod))
+			if method == "" {
+				method = PaidCash
+			}
+			if !validPaidMethods[method] {
+				return nil, fmt.Errorf("%w: paidMethod must be cash, card, stripe or other", ErrBadRequest)
+			}
+			updates["paidMethod"] = method
+			updates["paidAt"] = now
+		} else {
+			updates["paidMethod"] = firestore.Delete
+			updates["paidAt"] = firestore.Delete
+		}
+		updates["paid"] = paid
+		updates["paymentUrl"] = firestore.Delete
+	}
+	if in.Delivered != nil && *in.Delivered != o.Delivered {
+		delivered = *in.Delivered
+		updates["delivered"] = delivered
+		if delivered {
+			updates["deliveredAt"] = now
+		} else {
+			updates["deliveredAt"] = firestore.Delete
+		}
+	}
+	updates["outstanding"] = !(paid && delivered)
+
+	if _, err := s.ordersCol(dojoID).Doc(orderID).Set(ctx, updates, firestore.MergeAll); err != nil {
+		return nil, fmt.Errorf("failed to update order: %w", err)
+	}
+	return s.getOrder(ctx, dojoID, orderID)
+}
+
+// DeleteOrder removes an order entered by mistake (staff only). Paid orders
+// are kept for the books.
+func (s *Service) DeleteOrder(ctx context.Context, staffUID, dojoID, orderID string) error {
+	dojoID = strings.TrimSpace(dojoID)
+	orderID = strings.TrimSpace(orderID)
+	if dojoID == "" || orderID == "" {
+		return fmt.Errorf("%w: dojoId and orderId are required", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return err
+	}
+	o, err := s.getOrder(ctx, dojoID, orderID)
+	if err != nil {
+		return err
+	}
+	if o.Paid {
+		return fmt.Errorf("%w: paid orders cannot be deleted", ErrBadRequest)
+	}
+	if _, err := s.ordersCol(dojoID).Doc(orderID).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) getOrder(ctx context.Context, dojoID, orderID string) (*Order, error) {
+	doc, err := s.ordersCol(dojoID).Doc(orderID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: order not found", ErrNotFound)
+	}
+	var o Order
+	if err := doc.DataTo(&o); err != nil {
+		return nil, fmt.Errorf("failed to decode order: %w", err)
+	}
+	o.ID = doc.Ref.ID
+	return &o, nil
+}
+
+// CreatePaymentLink creates a Stripe checkout for the order's total and keeps
+// its URL on the order, for staff to send to the member (staff only). The
+// order is marked paid when the checkout completes.
+func (s *Service) CreatePaymentLink(ctx context.Context, staffUID, dojoID, orderID string, in PaymentLinkInput) (*Order, error) {
+	in.Trim()
+	dojoID = strings.TrimSpace(dojoID)
+	orderID = strings.TrimSpace(orderID)
+	if dojoID == "" || orderID == "" {
+		return nil, fmt.Errorf("%w: dojoId and orderId are required", ErrBadRequest)
+	}
+	if in.SuccessURL == "" || in.CancelURL == "" {
+		return nil, fmt.Errorf("%w: successUrl and cancelUrl are required", ErrBadRequest)
+	}
+	if s.payments == nil {
+		return nil, fmt.Errorf("%w: payments are not configured", ErrBadRequest)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	o, err := s.getOrder(ctx, dojoID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Paid {
+		return nil, fmt.Errorf("%w: order is already paid", ErrBadRequest)
+	}
+	if o.TotalCents() <= 0 {
+		return nil, fmt.Errorf("%w: order has no price to pay", ErrBadRequest)
+	}
+
+	var email string
+	if userDoc, err := s.fs.Collection("users").Doc(o.MemberUID).Get(ctx); err == nil {
+		email, _ = userDoc.Data()["email"].(string)
+	}
+	name := o.Item
+	if o.Size != "" {
+		name += " (" + o.Size + ")"
+	}
+	if o.Quantity > 1 {
+		name = fmt.Sprintf("%d × %s", o.Quantity, name)
+	}
+
+	url, err := s.payments.CreatePaymentCheckout(ctx, stripedom.PaymentCheckoutInput{
+		Kind:          CheckoutKind,
+		Name:          name,
+		AmountCents:   o.TotalCents(),
+		Currency:      o.Currency,
+		CustomerEmail: email,
+		SuccessURL:    in.SuccessURL,
+		CancelURL:     in.CancelURL,
+		Metadata: map[string]string{
+			"dojoId":    dojoID,
+			"orderId":   orderID,
+			"memberUid": o.MemberUID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.ordersCol(dojoID).Doc(orderID).Set(ctx, map[string]interface{}{
+		"paymentUrl": url,
+		"updatedAt":  time.Now().UTC(),
+	}, firestore.MergeAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save payment link: %w", err)
+	}
+	o.PaymentURL = url
+	return o, nil
+}
+
+// FulfilCheckout marks the order paid for a completed payment link.
+// Called from the Stripe webhook; idempotent per checkout session.
+func (s *Service) FulfilCheckout(ctx context.Context, checkoutSessionID string, metadata map[string]string) error {
+	dojoID := metadata["dojoId"]
+	orderID := metadata["orderId"]
+	if dojoID == "" || orderID == "" {
+		return fmt.Errorf("missing dojoId/orderId in metadata")
+	}
+	ref := s.ordersCol(dojoID).Doc(orderID)
+	return s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return fmt.Errorf("failed to load order: %w", err)
+		}
+		if !doc.Exists() {
+			// deleted after the link went out; the payment is visible in Stripe
+			log.Printf("shop: paid checkout %s for missing order %s/%s", checkoutSessionID, dojoID, orderID)
+			return nil
+		}
+		var o Order
+		if err := doc.DataTo(&o); err != nil {
+			return fmt.Errorf("failed to decode order: %w", err)
+		}
+		if o.Paid {
+			return nil
+		}
+		now := time.Now().UTC()
+		return tx.Set(ref, map[string]interface{}{
+			"paid":              true,
+			"paidMethod":        PaidStripe,
+			"paidAt":            now,
+			"checkoutSessionId": checkoutSessionID,
+			"paymentUrl":        firestore.Delete,
+			"outstanding":       !o.Delivered,
+			"updatedAt":         now,
+		}, firestore.MergeAll)
+	})
+}
@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+)
+
+// archivedCounts are a member's records rolled up into the monthly summaries
+// (dojos/{dojoId}/attendanceMonthly) by attendance archival
+type archivedCounts struct {
+	total, present, late, absent int
+}
+
+func (s *Service) memberArchivedCounts(ctx context.Context, dojoID, memberUID string) archivedCounts {
+	var out archivedCounts
+	summaries, err := s.dojoCol(ctx, dojoID, "attendanceMonthly")
+	if err != nil {
+		return out
+	}
+	docs, err := summaries.
+		SelectPaths(firestore.FieldPath{"members", memberUID}).Documents(ctx).GetAll()
+	if err != nil {
+		return out
+	}
+	for _, doc := range docs {
+		members, _ := doc.Data()["members"].(map[string]interface{})
+		counts, _ := members[memberUID].(map[string]interface{})
+		for status, v := range counts {
+			n, _ := v.(int64)
+			out.total += int(n)
+			switch status {
+			case "present":
+				out.present += int(n)
+			case "late":
+				out.late += int(n)
+			case "absent":
+				out.absent += int(n)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// The benchmarks read from the Firestore emulator and are skipped without
+// one:
+//
+//	gcloud emulators firestore start --host-port=localhost:8085
+//	FIRESTORE_EMULATOR_HOST=localhost:8085 go test ./internal/domain/stats -run '^$' -bench DojoStats
+//
+// BenchmarkComputeDojoStats runs the scans side by side as GetDojoStats
+// does; BenchmarkComputeDojoStatsSequential runs the same scans one after
+// another for comparison.
+
+const (
+	benchMembers    = 300
+	benchSessions   = 40
+	benchAttendance = 1500
+)
+
+func BenchmarkComputeDojoStats(b *testing.B) {
+	s, dojoID := benchService(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.computeDojoStats(ctx, dojoID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkComputeDojoStatsSequential(b *testing.B) {
+	s, dojoID := benchService(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		shares := s.budget(func(b ScanBudgets) int { return b.Dojo }).Split(3)
+		if _, err := s.scanMembers(ctx, dojoID, shares[0]); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := s.countActiveSessions(ctx, dojoID, shares[1]); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := s.scanMonthAttendance(ctx, dojoID, shares[2], time.Now()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchService seeds a dojo in the emulator and returns a Service reading it
+func benchService(b *testing.B) (*Service, string) {
+	b.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		b.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "bench-project")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { client.Close() })
+
+	dojoID := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	dojoRef := client.Collection("dojos").Doc(dojoID)
+	now := time.Now().UTC()
+
+	bw := client.BulkWriter(ctx)
+	if _, err := bw.Set(dojoRef, map[string]interface{}{"name": "Bench Dojo"}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchMembers; i++ {
+		uid := fmt.Sprintf("m%04d", i)
+		if _, err := bw.Set(dojoRef.Collection("members").Doc(uid), map[string]interface{}{
+			"uid": uid, "status": "active", "roleInDojo": "student", "joinedAt": now,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i < benchSessions; i++ {
+		if _, err := bw.Set(dojoRef.Collection("sessions").Doc(fmt.Sprintf("s%02d", i)), map[string]interface{}{
+			"title": "Class", "isActive": true,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	statuses := []string{"present", "late", "absent"}
+	for i := 0; i < benchAttendance; i++ {
+		if _, err := bw.Set(dojoRef.Collection("attendance").NewDoc(), map[string]interface{}{
+			"memberUid":         fmt.Sprintf("m%04d", i%benchMembers),
+			"sessionInstanceId": fmt.Sprintf("%s__s%02d", now.Format("2006-01-02"), i%benchSessions),
+			"status":            statuses[i%len(statuses)],
+			"createdAt":         now,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bw.End()
+
+	return NewService(client), dojoID
+}
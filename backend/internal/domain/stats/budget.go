@@ -0,0 +1,65 @@
+package stats
+
+import (
+	"time"
+
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/scanbudget"
+)
+
+// ScanBudgets caps the documents one computation of each report reads (see
+// scanbudget); zero keeps the default. A report that reaches its cap is
+// flagged partial, and still cached, as recomputing it would stop at the
+// same place.
+type ScanBudgets struct {
+	Dojo       int
+	Member     int
+	Attendance int // shared by the period and the one it is compared with
+	Programs   int
+	Cohorts    int
+}
+
+var defaultScanBudgets = ScanBudgets{
+	Dojo:       50000,
+	Member:     20000,
+	Attendance: 100000,
+	Programs:   100000,
+	Cohorts:    200000,
+}
+
+// maxBreakdownRows caps the per-class and per-tag lists of a report; the
+// quietest rows are dropped and the report flagged partial
+const maxBreakdownRows = 200
+
+// SetScanBudgets sets the per-report document budgets
+func (s *Service) SetScanBudgets(b ScanBudgets) {
+	s.budgets = b
+}
+
+// budget starts a report's budget, pick choosing its limit
+func (s *Service) budget(pick func(ScanBudgets) int) *scanbudget.Budget {
+	if n := pick(s.budgets); n > 0 {
+		return scanbudget.New(n)
+	}
+	return scanbudget.New(pick(defaultScanBudgets))
+}
+
+// rosterMember is what reports keep of a member doc, so a big roster held
+// for a whole scan costs a fraction of the decoded docs
+type rosterMember struct {
+	status string
+	role   string
+	belt   string
+	since  time.Time
+	isKids bool
+}
+
+func newRosterMember(m fsdoc.Member) rosterMember {
+	return rosterMember{
+		status: m.Status,
+		role:   m.RoleName(),
+		belt:   m.Belt(),
+		since:  m.Since(),
+		isKids: m.IsKids,
+	}
+}
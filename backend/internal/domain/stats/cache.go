@@ -0,0 +1,147 @@
+package stats
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statsFreshFor is how long a computed result is served as is
+	statsFreshFor = time.Minute
+	// statsStaleFor is how long past fresh a result is still served while it
+	// is recomputed in the background; older ones are recomputed in the request
+	statsStaleFor = 10 * time.Minute
+
+	statsRefreshTimeout = 30 * time.Second
+	maxCachedStats      = 2000
+)
+
+// statsCache holds computed stats per dojo and query. It is per instance, so
+// Invalidate only reaches this process; other instances catch up within
+// statsFreshFor.
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]*statsEntry
+	// gens counts invalidations per dojo, so a refresh that started before
+	// one does not store what it read
+	gens map[string]uint64
+}
+
+type statsEntry struct {
+	value      any
+	computedAt time.Time
+	refreshing bool
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: map[string]*statsEntry{}, gens: map[string]uint64{}}
+}
+
+func cacheKey(dojoID, query string) string {
+	return dojoID + "\x00" + query
+}
+
+// cachedStats serves the dojo's stats for query from the cache, computing
+// them when missing or too old and refreshing them in the background when
+// stale. compute reports whether its result is complete; partial results
+// (a scan that hit the deadline) and errors are not cached.
+func cachedStats[T any](ctx context.Context, c *statsCache, dojoID, query string, compute func(context.Context) (T, bool, error)) (T, error) {
+	key := cacheKey(dojoID, query)
+	now := time.Now()
+
+	c.mu.Lock()
+	if e := c.entries[key]; e != nil {
+		age := now.Sub(e.computedAt)
+		if age < statsFreshFor {
+			c.mu.Unlock()
+			return e.value.(T), nil
+		}
+		if age < statsFreshFor+statsStaleFor {
+			if !e.refreshing {
+				e.refreshing = true
+				go c.refresh(context.WithoutCancel(ctx), dojoID, key, c.gens[dojoID], func(ctx context.Context) (any, bool, error) {
+					return compute(ctx)
+				})
+			}
+			c.mu.Unlock()
+			return e.value.(T), nil
+		}
+	}
+	gen := c.gens[dojoID]
+	c.mu.Unlock()
+
+	v, complete, err := compute(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if complete {
+		c.put(dojoID, key, gen, v)
+	}
+	return v, nil
+}
+
+func (c *statsCache) refresh(ctx context.Context, dojoID, key string, gen uint64, compute func(context.Context) (any, bool, error)) {
+	ctx, cancel := context.WithTimeout(ctx, statsRefreshTimeout)
+	defer cancel()
+
+	v, complete, err := compute(ctx)
+	if err != nil || !complete {
+		if err != nil {
+			log.Printf("stats: background refresh for dojo %s failed: %v", dojoID, err)
+		}
+		c.mu.Lock()
+		if e := c.entries[key]; e != nil {
+			e.refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.put(dojoID, key, gen, v)
+}
+
+func (c *statsCache) put(dojoID, key string, gen uint64, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[dojoID] != gen {
+		return
+	}
+	if len(c.entries) >= maxCachedStats {
+		c.evict()
+	}
+	c.entries[key] = &statsEntry{value: v, computedAt: time.Now()}
+}
+
+// evict drops expired entries, and everything if that is not enough
+func (c *statsCache) evict() {
+	cutoff := time.Now().Add(-statsFreshFor - statsStaleFor)
+	for k, e := range c.entries {
+		if e.computedAt.Before(cutoff) && !e.refreshing {
+			delete(c.entries, k)
+		}
+	}
+	if len(c.entries) >= maxCachedStats {
+		c.entries = map[string]*statsEntry{}
+	}
+}
+
+func (c *statsCache) invalidate(dojoID string) {
+	prefix := cacheKey(dojoID, "")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gens[dojoID]++
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Invalidate drops the dojo's cached stats so the next request recomputes
+// them. Attendance and roster writes call it through the event bus.
+func (s *Service) Invalidate(dojoID string) {
+	s.cache.invalidate(dojoID)
+}
@@ -0,0 +1,267 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/scanbudget"
+)
+
+const (
+	// cohortMonths is how many join months a report covers, this one included
+	cohortMonths = 24
+	// cohortCurveMonths is how far each retention curve runs
+	cohortCurveMonths = 12
+	// cohortLookbackMonths are scanned before the oldest cohort, so a member
+	// who has left the roster is only placed by first check-in when there is
+	// no earlier one
+	cohortLookbackMonths = 3
+)
+
+// cohortStaffRoles are left out of cohorts, which follow students
+var cohortStaffRoles = map[string]bool{
+	"owner": true, "staff": true, "staff_member": true, "coach": true, "admin": true, "instructor": true,
+}
+
+func (s *Service) cohortsRef(dojoID string) *firestore.DocumentRef {
+	return s.client.Collection("dojos").Doc(dojoID).Collection("analytics").Doc("cohorts")
+}
+
+// GetCohorts returns the dojo's cohort retention curves as last computed by
+// RunCohorts, computing them on first use
+func (s *Service) GetCohorts(ctx context.Context, dojoID string, now time.Time) (*CohortReport, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.cohortsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load cohorts: %w", err)
+	}
+	if doc.Exists() {
+		var out CohortReport
+		if err := doc.DataTo(&out); err != nil {
+			return nil, fmt.Errorf("failed to decode cohorts: %w", err)
+		}
+		return &out, nil
+	}
+	return s.refreshCohorts(ctx, dojoID, now)
+}
+
+// RunCohorts recomputes every dojo's cohort retention curves. Meant to be
+// triggered daily by Cloud Scheduler; the curves only move once a month
+// finishes, so a missed run costs little.
+func (s *Service) RunCohorts(ctx context.Context, now time.Time) (*CohortRunResult, error) {
+	res := &CohortRunResult{}
+	iter := s.client.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+
+		if _, err := s.refreshCohorts(ctx, doc.Ref.ID, now); err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			res.Failed++
+			log.Printf("stats cohorts: dojo %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		res.Computed++
+	}
+
+	log.Printf("stats cohorts: %d dojos checked, %d computed, %d failed (partial=%v)",
+		res.DojosChecked, res.Computed, res.Failed, res.Partial)
+	return res, nil
+}
+
+// refreshCohorts computes and stores the dojo's report. A scan cut short by
+// the deadline is not stored; one that spent its budget is, flagged partial.
+func (s *Service) refreshCohorts(ctx context.Context, dojoID string, now time.Time) (*CohortReport, error) {
+	out, err := s.computeCohorts(ctx, dojoID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("cohorts of %s: %w", dojoID, ctx.Err())
+	}
+	if _, err := s.cohortsRef(dojoID).Set(ctx, out); err != nil {
+		return nil, fmt.Errorf("failed to save cohorts: %w", err)
+	}
+	return out, nil
+}
+
+// monthIndex numbers months consecutively, so month arithmetic is subtraction
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+func monthOfIndex(i int) time.Time {
+	return time.Date(i/12, time.Month(i%12+1), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// computeCohorts groups the students by join month and follows their
+// check-ins month by month. Members since removed from the roster are
+// placed by their first check-in, from the attendance they left behind.
+func (s *Service) computeCohorts(ctx context.Context, dojoID string, now time.Time) (*CohortReport, error) {
+	current := monthIndex(now)
+	first := current - cohortMonths + 1
+	scanFrom := monthOfIndex(first - cohortLookbackMonths)
+
+	budget := s.budget(func(b ScanBudgets) int { return b.Cohorts })
+	roster, err := s.memberIndex(ctx, dojoID, budget)
+	if err != nil {
+		return nil, err
+	}
+	active, err := s.activeMonths(ctx, dojoID, scanFrom, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	// join month of every student in the covered months
+	joined := map[string]int{}
+	for uid, m := range roster {
+		if cohortStaffRoles[m.role] || m.since.IsZero() {
+			continue
+		}
+		if jm := monthIndex(m.since.UTC()); jm >= first && jm <= current {
+			joined[uid] = jm
+		}
+	}
+	for uid, months := range active {
+		if _, ok := roster[uid]; ok {
+			continue
+		}
+		earliest := current + 1
+		for mi := range months {
+			if mi < earliest {
+				earliest = mi
+			}
+		}
+		if earliest >= first && earliest <= current {
+			joined[uid] = earliest
+		}
+	}
+
+	cohorts := make([]Cohort, cohortMonths)
+	for i := range cohorts {
+		cm := first + i
+		curve := max(0, min(current-cm-1, cohortCurveMonths)) // finished months after joining
+		cohorts[i] = Cohort{
+			Month:     monthOfIndex(cm).Format("2006-01"),
+			Active:    make([]int, curve),
+			Retention: make([]float64, curve),
+		}
+	}
+	for uid, jm := range joined {
+		c := &cohorts[jm-first]
+		c.Members++
+		for k := range c.Active {
+			if active[uid][jm+k+1] {
+				c.Active[k]++
+			}
+		}
+	}
+	for i := range cohorts {
+		c := &cohorts[i]
+		for k, n := range c.Active {
+			if c.Members > 0 {
+				c.Retention[k] = math.Round(float64(n)/float64(c.Members)*1000) / 1000
+			}
+		}
+		c.After1, c.After3, c.After6, c.After12 = c.after(1), c.after(3), c.after(6), c.after(12)
+	}
+
+	return &CohortReport{DojoID: dojoID, Cohorts: cohorts, ComputedAt: now, Partial: budget.Exhausted()}, nil
+}
+
+// after is the retention n months after joining, nil until that month ends
+func (c *Cohort) after(n int) *float64 {
+	if n > len(c.Retention) {
+		return nil
+	}
+	v := c.Retention[n-1]
+	return &v
+}
+
+// activeMonths lists, per member, the months (monthIndex) with a check-in
+// since from: raw records, and the monthly summaries of archived ones
+func (s *Service) activeMonths(ctx context.Context, dojoID string, from time.Time, budget *scanbudget.Budget) (map[string]map[int]bool, error) {
+	out := map[string]map[int]bool{}
+	mark := func(uid string, mi int) {
+		if out[uid] == nil {
+			out[uid] = map[int]bool{}
+		}
+		out[uid][mi] = true
+	}
+
+	attendanceCol, err := s.dojoCol(ctx, dojoID, "attendance")
+	if err != nil {
+		return nil, err
+	}
+	iter := attendanceCol.
+		Where("createdAt", ">=", from).
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break // the caller does not store a partial report
+			}
+			return nil, fmt.Errorf("failed to scan attendance: %w", err)
+		}
+		if !budget.Take() {
+			break
+		}
+		att, err := fsdoc.As[fsdoc.Attendance](doc)
+		if err != nil || att.CreatedAt.IsZero() || !att.IsCheckin() || att.Member() == "" {
+			continue // malformed docs are logged and counted by fsdoc
+		}
+		mark(att.Member(), monthIndex(att.CreatedAt.UTC()))
+	}
+
+	if s.attendanceSvc == nil {
+		return out, nil
+	}
+	summaries, err := s.attendanceSvc.ListMonthlySummaries(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sum := range summaries {
+		month, err := time.Parse("2006-01", sum.Month)
+		if err != nil || month.Before(from) {
+			continue
+		}
+		for uid, counts := range sum.Members {
+			if counts.Present+counts.Late > 0 {
+				mark(uid, monthIndex(month))
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,148 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	defaultFillRateWeeks = 4
+	maxFillRateWeeks     = 12
+
+	// trendThreshold is the change in fill rate (share of capacity) between
+	// the two halves of the window that counts as a trend
+	trendThreshold = 0.05
+)
+
+// SetAttendanceService enables fill-rate stats, which count check-ins per
+// class instance, and lets cohorts count archived months
+func (s *Service) SetAttendanceService(attendanceSvc *attendance.Service) {
+	s.attendanceSvc = attendanceSvc
+}
+
+// GetFillRates reports how full each active class with a maxCapacity ran
+// over the last weeks (default 4), and whether it is filling up or emptying,
+// so owners can see which classes to split or merge.
+func (s *Service) GetFillRates(ctx context.Context, dojoID string, weeks int, now time.Time) (*FillRateReport, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if weeks == 0 {
+		weeks = defaultFillRateWeeks
+	}
+	if weeks < 1 || weeks > maxFillRateWeeks {
+		return nil, fmt.Errorf("%w: weeks must be 1-%d", ErrBadRequest, maxFillRateWeeks)
+	}
+	if s.sessionSvc == nil || s.attendanceSvc == nil {
+		return nil, fmt.Errorf("%w: fill rates are not available", ErrBadRequest)
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	since := today.AddDate(0, 0, -7*weeks)
+	// the recent half gets the extra week of an odd window
+	midpoint := since.AddDate(0, 0, 7*(weeks/2))
+	out := &FillRateReport{
+		Weeks:    weeks,
+		Since:    since.Format(instanceid.DateLayout),
+		Classes:  []ClassFillRate{},
+		Calendar: s.calendar(ctx, dojoID),
+	}
+
+	sessions, err := s.sessionSvc.List(ctx, dojoID, session.ListSessionsInput{ActiveOnly: true, Limit: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list classes: %w", err)
+	}
+	capped := sessions[:0]
+	for _, sess := range sessions {
+		if sess.MaxCapacity > 0 {
+			capped = append(capped, sess)
+		}
+	}
+	if len(capped) == 0 {
+		return out, nil
+	}
+
+	counts, err := s.attendanceSvc.CheckinsByInstance(ctx, dojoID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sess := range capped {
+		var all, earlier, recent fillSample
+		for day := since; day.Before(today); day = day.AddDate(0, 0, 1) {
+			dateKey := day.Format(instanceid.DateLayout)
+			if !sess.HeldOn(dateKey) || (!sess.CreatedAt.IsZero() && day.Before(sess.CreatedAt.Truncate(24*time.Hour))) {
+				continue
+			}
+			n := counts[instanceid.New(dateKey, sess.ID)]
+			all.add(n)
+			if day.Before(midpoint) {
+				earlier.add(n)
+			} else {
+				recent.add(n)
+			}
+		}
+		if all.occurrences == 0 {
+			continue
+		}
+
+		cf := ClassFillRate{
+			SessionID:   sess.ID,
+			Title:       sess.Title,
+			DayOfWeek:   sess.DayOfWeek,
+			StartTime:   sess.StartTime,
+			MaxCapacity: sess.MaxCapacity,
+			Occurrences: all.occurrences,
+			AvgCheckins: round(all.avg(), 1),
+			FillRate:    round(all.avg()/float64(sess.MaxCapacity), 2),
+		}
+		if earlier.occurrences > 0 && recent.occurrences > 0 {
+			change := (recent.avg() - earlier.avg()) / float64(sess.MaxCapacity)
+			cf.TrendChange = round(change, 2)
+			switch {
+			case change >= trendThreshold:
+				cf.Trend = TrendUp
+			case change <= -trendThreshold:
+				cf.Trend = TrendDown
+			default:
+				cf.Trend = TrendFlat
+			}
+		}
+		out.Classes = append(out.Classes, cf)
+	}
+
+	sort.Slice(out.Classes, func(i, j int) bool {
+		if out.Classes[i].FillRate != out.Classes[j].FillRate {
+			return out.Classes[i].FillRate > out.Classes[j].FillRate
+		}
+		return out.Classes[i].Title < out.Classes[j].Title
+	})
+	return out, nil
+}
+
+// fillSample accumulates the check-ins of a class's occurrences
+type fillSample struct {
+	occurrences int
+	checkins    int
+}
+
+func (f *fillSample) add(n int) {
+	f.occurrences++
+	f.checkins += n
+}
+
+func (f fillSample) avg() float64 {
+	return float64(f.checkins) / float64(f.occurrences)
+}
+
+func round(f float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(f*p) / p
+}
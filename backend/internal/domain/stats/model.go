@@ -1,12 +1,17 @@
 package stats
 
-import "time"
+import (
+	"time"
+
+	"dojo-manager/backend/internal/domain/dojo"
+)
 
 // DojoStats represents statistics for a dojo
 type DojoStats struct {
 	Members    MemberStats     `json:"members"`
 	Sessions   SessionStats    `json:"sessions"`
 	Attendance AttendanceStats `json:"attendance"`
+	Partial    bool            `json:"partial,omitempty"` // a scan hit the request deadline or its document budget
 }
 
 type MemberStats struct {
@@ -37,6 +42,7 @@ type MemberStatsResult struct {
 	Member           MemberInfo              `json:"member"`
 	Attendance       MemberAttendanceStats   `json:"attendance"`
 	RecentPromotions []map[string]interface{} `json:"recentPromotions"`
+	Partial          bool                     `json:"partial,omitempty"` // a scan hit the request deadline or its document budget
 }
 
 type MemberInfo struct {
@@ -61,13 +67,40 @@ type MemberThisMonthStats struct {
 	Rate    string `json:"rate"`
 }
 
+// AttendanceStatsQuery selects the records attendance stats are computed
+// from: a fixed Period ending now, or the days From..To
+type AttendanceStatsQuery struct {
+	Period    string // day, week or month (default); ignored when From is set
+	From      string // YYYY-MM-DD (UTC), inclusive
+	To        string // YYYY-MM-DD (UTC), inclusive; defaults to today
+	SessionID string
+	Compare   bool // also summarise the equally long period just before
+}
+
 // AttendanceStatsResult represents attendance statistics
 type AttendanceStatsResult struct {
-	Period    string       `json:"period"`
-	StartDate string       `json:"startDate"`
-	EndDate   string       `json:"endDate"`
-	Summary   StatsSummary `json:"summary"`
-	Daily     []DailyStats `json:"daily"`
+	Period     string           `json:"period"` // day, week, month or custom
+	StartDate  string           `json:"startDate"`
+	EndDate    string           `json:"endDate"`
+	Summary    StatsSummary     `json:"summary"`
+	Daily      []DailyStats     `json:"daily"`
+	ByTag      []TagStats       `json:"byTag"`   // records of tagged classes, busiest tag first
+	ByClass    []ClassStats     `json:"byClass"` // busiest class first
+	Comparison *StatsComparison `json:"comparison,omitempty"`
+	Partial    bool             `json:"partial,omitempty"` // the scan hit the request deadline or its document budget, or a list was cut at its cap
+
+	// Calendar tells clients how to lay out the dates
+	Calendar dojo.CalendarHints `json:"calendar"`
+}
+
+// StatsComparison summarises the period of the same length just before the
+// requested one
+type StatsComparison struct {
+	StartDate   string       `json:"startDate"`
+	EndDate     string       `json:"endDate"`
+	Summary     StatsSummary `json:"summary"`
+	TotalChange int          `json:"totalChange"` // records this period minus the previous one
+	RateChange  string       `json:"rateChange"`  // percentage points, e.g. "+3.5"
 }
 
 type StatsSummary struct {
@@ -86,3 +119,129 @@ type DailyStats struct {
 	Total   int    `json:"total"`
 	Rate    string `json:"rate"`
 }
+
+// TagStats is the attendance of classes carrying a tag; a record counts
+// toward every tag of its class
+type TagStats struct {
+	Tag     string `json:"tag"`
+	Total   int    `json:"total"`
+	Present int    `json:"present"`
+	Absent  int    `json:"absent"`
+	Late    int    `json:"late"`
+	Rate    string `json:"rate"`
+}
+
+// ClassStats is the attendance of one timetable class. Title is empty for
+// classes deleted since.
+type ClassStats struct {
+	SessionID string `json:"sessionId"`
+	Title     string `json:"title"`
+	Total     int    `json:"total"`
+	Present   int    `json:"present"`
+	Absent    int    `json:"absent"`
+	Late      int    `json:"late"`
+	Rate      string `json:"rate"`
+}
+
+// Fill-rate trends
+const (
+	TrendUp   = "up"
+	TrendDown = "down"
+	TrendFlat = "flat"
+)
+
+// FillRateReport is how full each capped class ran over a rolling window
+type FillRateReport struct {
+	Weeks   int             `json:"weeks"`
+	Since   string          `json:"since"`   // YYYY-MM-DD, first day of the window
+	Classes []ClassFillRate `json:"classes"` // fullest first
+
+	// Calendar tells clients how to lay out the dates
+	Calendar dojo.CalendarHints `json:"calendar"`
+}
+
+// ClassFillRate is the average check-ins of a class against its capacity.
+// Classes without a maxCapacity have no fill rate and are left out.
+type ClassFillRate struct {
+	SessionID   string  `json:"sessionId"`
+	Title       string  `json:"title"`
+	DayOfWeek   int     `json:"dayOfWeek"`
+	StartTime   string  `json:"startTime"`
+	MaxCapacity int     `json:"maxCapacity"`
+	Occurrences int     `json:"occurrences"`
+	AvgCheckins float64 `json:"avgCheckins"`
+	FillRate    float64 `json:"fillRate"` // AvgCheckins ÷ MaxCapacity, above 1 when overbooked
+	// Trend compares the recent half of the window with the earlier half;
+	// "" when either half has no occurrences
+	Trend       string  `json:"trend,omitempty"`
+	TrendChange float64 `json:"trendChange"` // recent minus earlier fill rate
+}
+
+// ProgramReport breaks members, attendance and retention down by program:
+// the class types (adult, kids, mixed) and the class tags, so a kids program
+// can be read apart from the adult one. A member is in a program for the
+// window if they attended one of its classes.
+type ProgramReport struct {
+	Period      string         `json:"period"` // day, week, month or custom
+	StartDate   string         `json:"startDate"`
+	EndDate     string         `json:"endDate"`
+	ByClassType []ProgramStats `json:"byClassType"`
+	ByTag       []ProgramStats `json:"byTag"` // busiest tag first
+	// Roster counts active members by the kids flag on their membership
+	Roster  map[string]int `json:"roster"`
+	Partial bool           `json:"partial,omitempty"` // a scan hit the request deadline or its document budget, or ByTag was cut at its cap
+
+	// Calendar tells clients how to lay out the dates
+	Calendar dojo.CalendarHints `json:"calendar"`
+}
+
+// ProgramStats is one class type or tag
+type ProgramStats struct {
+	Program           string           `json:"program"`
+	Members           int              `json:"members"`    // distinct members who attended
+	NewMembers        int              `json:"newMembers"` // of those, joined within the window
+	BeltDistribution  map[string]int   `json:"beltDistribution"`
+	Attendance        StatsSummary     `json:"attendance"`
+	CheckinsPerMember float64          `json:"checkinsPerMember"`
+	Retention         ProgramRetention `json:"retention"`
+}
+
+// ProgramRetention follows the members who attended the program in the
+// equally long window before: how many came back to it in this one
+type ProgramRetention struct {
+	PreviousMembers int    `json:"previousMembers"`
+	Retained        int    `json:"retained"`
+	Rate            string `json:"rate"` // Retained ÷ PreviousMembers, in percent
+}
+
+// CohortReport is dojos/{dojoId}/analytics/cohorts: how the members who
+// joined in each month kept attending, computed by RunCohorts
+type CohortReport struct {
+	DojoID     string    `firestore:"dojoId" json:"dojoId"`
+	Cohorts    []Cohort  `firestore:"cohorts" json:"cohorts"` // oldest join month first
+	ComputedAt time.Time `firestore:"computedAt" json:"computedAt"`
+	Partial    bool      `firestore:"partial,omitempty" json:"partial,omitempty"` // the scan stopped at its document budget
+}
+
+// Cohort is the members who joined in one month. Active[i] of them checked
+// in during the (i+1)th month after it; the curve runs to the last finished
+// month, up to a year. The After fields pick out the usual milestones and
+// stay null until that month has finished.
+type Cohort struct {
+	Month     string    `firestore:"month" json:"month"` // YYYY-MM
+	Members   int       `firestore:"members" json:"members"`
+	Active    []int     `firestore:"active" json:"active"`
+	Retention []float64 `firestore:"retention" json:"retention"` // Active ÷ Members, 0-1
+	After1    *float64  `firestore:"after1" json:"after1"`
+	After3    *float64  `firestore:"after3" json:"after3"`
+	After6    *float64  `firestore:"after6" json:"after6"`
+	After12   *float64  `firestore:"after12" json:"after12"`
+}
+
+// CohortRunResult summarizes a RunCohorts pass
+type CohortRunResult struct {
+	DojosChecked int  `json:"dojosChecked"`
+	Computed     int  `json:"computed"`
+	Failed       int  `json:"failed"`
+	Partial      bool `json:"partial,omitempty"`
+}
@@ -0,0 +1,173 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+	"dojo-manager/backend/internal/scanbudget"
+)
+
+// maxStatsRangeDays caps a from/to range, which is scanned in one request
+const maxStatsRangeDays = 366
+
+// window resolves the query to [start, end) in UTC and the period's name
+func (q AttendanceStatsQuery) window(now time.Time) (time.Time, time.Time, string, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if q.From == "" {
+		if q.To != "" {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("%w: to requires from", ErrBadRequest)
+		}
+		switch q.Period {
+		case "day":
+			return today, now, q.Period, nil
+		case "week":
+			return now.AddDate(0, 0, -7), now, q.Period, nil
+		default:
+			return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), now, "month", nil
+		}
+	}
+
+	start, err := time.Parse(instanceid.DateLayout, q.From)
+	if err != nil {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("%w: from must be YYYY-MM-DD", ErrBadRequest)
+	}
+	last := today
+	if q.To != "" {
+		if last, err = time.Parse(instanceid.DateLayout, q.To); err != nil {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("%w: to must be YYYY-MM-DD", ErrBadRequest)
+		}
+	}
+	if last.Before(start) {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("%w: to must not be before from", ErrBadRequest)
+	}
+	end := last.AddDate(0, 0, 1)
+	if end.Sub(start) > maxStatsRangeDays*24*time.Hour {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("%w: the range may span at most %d days", ErrBadRequest, maxStatsRangeDays)
+	}
+	return start, end, "custom", nil
+}
+
+// attendanceTally counts the records created in a time range by day, tag
+// and class
+type attendanceTally struct {
+	daily   map[string]*DailyStats
+	byTag   map[string]*TagStats
+	byClass map[string]*ClassStats
+}
+
+// tallyAttendance scans the records created in [start, end). A scan cut short
+// by the deadline or the budget returns what it counted; callers report
+// ctx.Err() and budget.Exhausted() as partial.
+func (s *Service) tallyAttendance(ctx context.Context, dojoID, sessionID string, start, end time.Time, classes map[string]session.Session, budget *scanbudget.Budget) (*attendanceTally, error) {
+	t := &attendanceTally{
+		daily:   map[string]*DailyStats{},
+		byTag:   map[string]*TagStats{},
+		byClass: map[string]*ClassStats{},
+	}
+
+	attendanceCol, err := s.dojoCol(ctx, dojoID, "attendance")
+	if err != nil {
+		return nil, err
+	}
+	query := attendanceCol.
+		Where("createdAt", ">=", start).
+		Where("createdAt", "<", end)
+	if sessionID != "" {
+		query = query.Where("sessionId", "==", sessionID)
+	}
+
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done || err != nil || !budget.Take() {
+			break
+		}
+
+		att, err := fsdoc.As[fsdoc.Attendance](doc)
+		if err != nil || att.CreatedAt.IsZero() {
+			continue // malformed docs are logged and counted by fsdoc
+		}
+
+		dateKey := att.CreatedAt.UTC().Format(instanceid.DateLayout)
+		ds := t.daily[dateKey]
+		if ds == nil {
+			ds = &DailyStats{Date: dateKey}
+			t.daily[dateKey] = ds
+		}
+		countStatus(att.Status, &ds.Total, &ds.Present, &ds.Absent, &ds.Late)
+
+		sessID := instanceid.SessionID(att.SessionInstanceID)
+		if sessID == "" {
+			continue // instance ids that predate YYYY-MM-DD__sessionId
+		}
+		cs := t.byClass[sessID]
+		if cs == nil {
+			cs = &ClassStats{SessionID: sessID, Title: classes[sessID].Title}
+			t.byClass[sessID] = cs
+		}
+		countStatus(att.Status, &cs.Total, &cs.Present, &cs.Absent, &cs.Late)
+
+		for _, tag := range classes[sessID].Tags {
+			ts := t.byTag[tag]
+			if ts == nil {
+				ts = &TagStats{Tag: tag}
+				t.byTag[tag] = ts
+			}
+			countStatus(att.Status, &ts.Total, &ts.Present, &ts.Absent, &ts.Late)
+		}
+	}
+	return t, nil
+}
+
+// summary totals the days of the tally
+func (t *attendanceTally) summary() StatsSummary {
+	var sum StatsSummary
+	for _, ds := range t.daily {
+		sum.Total += ds.Total
+		sum.Present += ds.Present
+		sum.Absent += ds.Absent
+		sum.Late += ds.Late
+	}
+	sum.Rate = attendanceRate(sum.Present, sum.Late, sum.Total)
+	return sum
+}
+
+func countStatus(status string, total, present, absent, late *int) {
+	*total++
+	switch status {
+	case "present":
+		*present++
+	case "absent":
+		*absent++
+	case "late":
+		*late++
+	}
+}
+
+// attendanceRate is the share of records present or late, in percent
+func attendanceRate(present, late, total int) string {
+	if total == 0 {
+		return "0"
+	}
+	return formatFloat(float64(present+late) / float64(total) * 100)
+}
+
+// rateChange is the attendance rate's change in percentage points
+func rateChange(prev, cur StatsSummary) string {
+	rate := func(sum StatsSummary) float64 {
+		if sum.Total == 0 {
+			return 0
+		}
+		return float64(sum.Present+sum.Late) / float64(sum.Total) * 100
+	}
+	return fmt.Sprintf("%+.1f", rate(cur)-rate(prev))
+}
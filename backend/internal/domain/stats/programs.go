@@ -0,0 +1,258 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+	"dojo-manager/backend/internal/scanbudget"
+)
+
+// defaultClassType is the type of classes saved without one (see session.Create)
+const defaultClassType = "adult"
+
+// GetProgramStats reports each class type and class tag over a fixed period
+// or a from/to range (see AttendanceStatsQuery; SessionID and Compare do not
+// apply), from the cache when recent
+func (s *Service) GetProgramStats(ctx context.Context, dojoID string, q AttendanceStatsQuery) (*ProgramReport, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if s.sessionSvc == nil {
+		return nil, fmt.Errorf("%w: program stats are not available", ErrBadRequest)
+	}
+	q.SessionID, q.Compare = "", false
+	if _, _, _, err := q.window(time.Now()); err != nil {
+		return nil, err
+	}
+	key := strings.Join([]string{"programs", q.Period, q.From, q.To}, "\x00")
+	return cachedStats(ctx, s.cache, dojoID, key, func(ctx context.Context) (*ProgramReport, bool, error) {
+		out, err := s.computeProgramStats(ctx, dojoID, q)
+		return out, err == nil && ctx.Err() == nil, err
+	})
+}
+
+// programTally collects one program's records in the window, and the
+// members who attended it in the window before
+type programTally struct {
+	stats    ProgramStats
+	members  map[string]bool
+	previous map[string]bool
+}
+
+func newProgramTally(program string) *programTally {
+	return &programTally{
+		stats:    ProgramStats{Program: program},
+		members:  map[string]bool{},
+		previous: map[string]bool{},
+	}
+}
+
+func (s *Service) computeProgramStats(ctx context.Context, dojoID string, q AttendanceStatsQuery) (*ProgramReport, error) {
+	start, end, period, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	prevStart := start.Add(-end.Sub(start))
+
+	budget := s.budget(func(b ScanBudgets) int { return b.Programs })
+	roster, err := s.memberIndex(ctx, dojoID, budget)
+	if err != nil {
+		return nil, err
+	}
+	classes := s.classIndex(ctx, dojoID)
+
+	byType := map[string]*programTally{}
+	for _, ct := range session.ValidClassTypes {
+		byType[ct] = newProgramTally(ct)
+	}
+	byTag := map[string]*programTally{}
+
+	// one scan covers the window and the one before, for retention
+	attendanceCol, err := s.dojoCol(ctx, dojoID, "attendance")
+	if err != nil {
+		return nil, err
+	}
+	iter := attendanceCol.
+		Where("createdAt", ">=", prevStart).
+		Where("createdAt", "<", end).
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done || err != nil || !budget.Take() {
+			break
+		}
+		att, err := fsdoc.As[fsdoc.Attendance](doc)
+		if err != nil || att.CreatedAt.IsZero() {
+			continue // malformed docs are logged and counted by fsdoc
+		}
+		sessID := instanceid.SessionID(att.SessionInstanceID)
+		if sessID == "" {
+			sessID = att.SessionID
+		}
+		class, ok := classes[sessID]
+		if !ok {
+			continue // deleted classes no longer belong to a program
+		}
+
+		classType := class.ClassType
+		if classType == "" {
+			classType = defaultClassType
+		}
+		typeTally := byType[classType]
+		if typeTally == nil {
+			typeTally = newProgramTally(classType)
+			byType[classType] = typeTally
+		}
+		tallies := []*programTally{typeTally}
+		for _, tag := range class.Tags {
+			if byTag[tag] == nil {
+				byTag[tag] = newProgramTally(tag)
+			}
+			tallies = append(tallies, byTag[tag])
+		}
+
+		current := !att.CreatedAt.Before(start)
+		uid := att.Member()
+		for _, t := range tallies {
+			if current {
+				a := &t.stats.Attendance
+				countStatus(att.Status, &a.Total, &a.Present, &a.Absent, &a.Late)
+			}
+			if uid == "" || !att.IsCheckin() {
+				continue
+			}
+			if current {
+				t.members[uid] = true
+			} else {
+				t.previous[uid] = true
+			}
+		}
+	}
+
+	out := &ProgramReport{
+		Period:      period,
+		StartDate:   start.Format(time.RFC3339),
+		EndDate:     end.Format(time.RFC3339),
+		ByClassType: make([]ProgramStats, 0, len(byType)),
+		ByTag:       make([]ProgramStats, 0, len(byTag)),
+		Roster:      map[string]int{"adult": 0, "kids": 0},
+		Calendar:    s.calendar(ctx, dojoID),
+	}
+	// the valid types in their usual order, then any older ones by name
+	for _, ct := range session.ValidClassTypes {
+		out.ByClassType = append(out.ByClassType, byType[ct].finish(roster, start, end))
+		delete(byType, ct)
+	}
+	others := make([]string, 0, len(byType))
+	for ct := range byType {
+		others = append(others, ct)
+	}
+	sort.Strings(others)
+	for _, ct := range others {
+		out.ByClassType = append(out.ByClassType, byType[ct].finish(roster, start, end))
+	}
+
+	for _, t := range byTag {
+		out.ByTag = append(out.ByTag, t.finish(roster, start, end))
+	}
+	sort.Slice(out.ByTag, func(i, j int) bool {
+		if out.ByTag[i].Attendance.Total != out.ByTag[j].Attendance.Total {
+			return out.ByTag[i].Attendance.Total > out.ByTag[j].Attendance.Total
+		}
+		return out.ByTag[i].Program < out.ByTag[j].Program
+	})
+	truncated := len(out.ByTag) > maxBreakdownRows
+	if truncated {
+		out.ByTag = out.ByTag[:maxBreakdownRows]
+	}
+
+	for _, m := range roster {
+		if m.status != "active" && m.status != "approved" {
+			continue
+		}
+		if m.isKids {
+			out.Roster["kids"]++
+		} else {
+			out.Roster["adult"]++
+		}
+	}
+
+	out.Partial = ctx.Err() != nil || budget.Exhausted() || truncated
+	return out, nil
+}
+
+// finish fills in the per-member figures from the roster. Members who left
+// the dojo since still count, without a belt.
+func (t *programTally) finish(roster map[string]rosterMember, start, end time.Time) ProgramStats {
+	st := t.stats
+	a := &st.Attendance
+	a.Rate = attendanceRate(a.Present, a.Late, a.Total)
+
+	st.Members = len(t.members)
+	st.BeltDistribution = map[string]int{}
+	for uid := range t.members {
+		m, ok := roster[uid]
+		if !ok {
+			continue
+		}
+		st.BeltDistribution[m.belt]++
+		if since := m.since; !since.Before(start) && since.Before(end) {
+			st.NewMembers++
+		}
+	}
+	if st.Members > 0 {
+		st.CheckinsPerMember = math.Round(float64(a.Present+a.Late)/float64(st.Members)*10) / 10
+	}
+
+	r := &st.Retention
+	r.PreviousMembers = len(t.previous)
+	for uid := range t.previous {
+		if t.members[uid] {
+			r.Retained++
+		}
+	}
+	r.Rate = "0"
+	if r.PreviousMembers > 0 {
+		r.Rate = formatFloat(float64(r.Retained) / float64(r.PreviousMembers) * 100)
+	}
+	return st
+}
+
+// memberIndex maps the dojo's members by uid. A roster larger than the
+// budget is cut short, which the caller reports as partial.
+func (s *Service) memberIndex(ctx context.Context, dojoID string, budget *scanbudget.Budget) (map[string]rosterMember, error) {
+	out := map[string]rosterMember{}
+	iter := s.client.Collection("dojos").Doc(dojoID).Collection("members").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break // reported as partial
+			}
+			return nil, fmt.Errorf("failed to get members: %w", err)
+		}
+		if !budget.Take() {
+			break
+		}
+		m, err := fsdoc.As[fsdoc.Member](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
+		out[doc.Ref.ID] = newRosterMember(m)
+	}
+	return out, nil
+}
@@ -5,135 +5,203 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/firebase"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/scanbudget"
 )
 
+// maxParallelScans bounds the Firestore reads one report runs at once
+const maxParallelScans = 3
+
 type Service struct {
-	client *firestore.Client
+	client     *firestore.Client
+	dbs        firebase.ClientResolver // per-dojo database of sessions and attendance (data residency)
+	sessionSvc *session.Service        // tag breakdowns (optional)
+
+	attendanceSvc *attendance.Service // fill rates (optional)
+	cache         *statsCache
+	budgets       ScanBudgets
 }
 
 func NewService(client *firestore.Client) *Service {
-	return &Service{client: client}
+	return &Service{client: client, dbs: firebase.DefaultResolver{Client: client}, cache: newStatsCache()}
+}
+
+// SetClientResolver reads each dojo's sessions and attendance from its own
+// database
+func (s *Service) SetClientResolver(resolver firebase.ClientResolver) {
+	s.dbs = resolver
+}
+
+// dojoCol returns one of the dojo's routed collections (sessions,
+// attendance, attendanceMonthly) in the database that holds it
+func (s *Service) dojoCol(ctx context.Context, dojoID, name string) (*firestore.CollectionRef, error) {
+	db, err := s.dbs.ClientFor(ctx, dojoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dojo database: %w", err)
+	}
+	return db.Collection("dojos").Doc(dojoID).Collection(name), nil
+}
+
+// SetSessionService enables the per-tag breakdown of attendance stats and
+// the per-program stats
+func (s *Service) SetSessionService(sessionSvc *session.Service) {
+	s.sessionSvc = sessionSvc
 }
 
-// GetDojoStats gets statistics for a dojo
+// GetDojoStats gets statistics for a dojo, from the cache when recent
 func (s *Service) GetDojoStats(ctx context.Context, dojoID string) (*DojoStats, error) {
 	if dojoID == "" {
 		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
 	}
+	return cachedStats(ctx, s.cache, dojoID, "dojo", func(ctx context.Context) (*DojoStats, bool, error) {
+		out, err := s.computeDojoStats(ctx, dojoID)
+		return out, err == nil && ctx.Err() == nil, err
+	})
+}
 
-	// Get members
-	membersIter := s.client.Collection("dojos").Doc(dojoID).Collection("members").Documents(ctx)
-	
-	totalMembers := 0
-	activeMembers := 0
-	pendingMembers := 0
-	roleDistribution := make(map[string]int)
+func (s *Service) computeDojoStats(ctx context.Context, dojoID string) (*DojoStats, error) {
+	// the three scans are independent; run them side by side, each on its
+	// own share of the budget so a partial report cuts the same scans
+	shares := s.budget(func(b ScanBudgets) int { return b.Dojo }).Split(3)
+	out := &DojoStats{}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelScans)
+	g.Go(func() error {
+		m, err := s.scanMembers(gctx, dojoID, shares[0])
+		out.Members = m
+		return err
+	})
+	g.Go(func() error {
+		sessions, err := s.countActiveSessions(gctx, dojoID, shares[1])
+		out.Sessions = sessions
+		return err
+	})
+	g.Go(func() error {
+		month, err := s.scanMonthAttendance(gctx, dojoID, shares[2], time.Now())
+		out.Attendance.ThisMonth = month
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	out.Partial = ctx.Err() != nil || scanbudget.AnyExhausted(shares...)
+	return out, nil
+}
 
+// scanMembers counts the roster by status and role
+func (s *Service) scanMembers(ctx context.Context, dojoID string, budget *scanbudget.Budget) (MemberStats, error) {
+	out := MemberStats{RoleDistribution: map[string]int{}}
+	iter := s.client.Collection("dojos").Doc(dojoID).Collection("members").Documents(ctx)
+	defer iter.Stop()
 	for {
-		doc, err := membersIter.Next()
+		doc, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to get members: %w", err)
+			return out, fmt.Errorf("failed to get members: %w", err)
+		}
+		if !budget.Take() {
+			break
 		}
 
-		totalMembers++
-		data := doc.Data()
-		status, _ := data["status"].(string)
-		if status == "active" || status == "approved" {
-			activeMembers++
-		} else if status == "pending" {
-			pendingMembers++
+		m, err := fsdoc.As[fsdoc.Member](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
+		out.Total++
+		if m.Status == "active" || m.Status == "approved" {
+			out.Active++
+		} else if m.Status == "pending" {
+			out.Pending++
 		}
 
-		role, _ := data["roleInDojo"].(string)
+		role := m.RoleInDojo
 		if role == "" {
 			role = "student"
 		}
-		roleDistribution[role]++
+		out.RoleDistribution[role]++
 	}
+	return out, nil
+}
+
+// countActiveSessions counts the active classes
+func (s *Service) countActiveSessions(ctx context.Context, dojoID string, budget *scanbudget.Budget) (SessionStats, error) {
+	out := SessionStats{}
+	sessions, err := s.dojoCol(ctx, dojoID, "sessions")
+	if err != nil {
+		return out, err
+	}
+	iter := sessions.Where("isActive", "==", true).Select().Documents(ctx)
+	defer iter.Stop()
 
-	// Get active sessions
-	sessionsIter := s.client.Collection("dojos").Doc(dojoID).Collection("sessions").
-		Where("isActive", "==", true).Documents(ctx)
-	
-	activeSessions := 0
 	for {
-		_, err := sessionsIter.Next()
+		_, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
-		if err != nil {
+		if err != nil || !budget.Take() {
 			break
 		}
-		activeSessions++
+		out.Active++
 	}
+	return out, nil
+}
 
-	// Get this month's attendance
-	now := time.Now()
+// scanMonthAttendance counts the attendance recorded since the first of
+// now's month by status
+func (s *Service) scanMonthAttendance(ctx context.Context, dojoID string, budget *scanbudget.Budget, now time.Time) (MonthlyAttendance, error) {
+	out := MonthlyAttendance{}
+	attendanceCol, err := s.dojoCol(ctx, dojoID, "attendance")
+	if err != nil {
+		return out, err
+	}
 	firstDayOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-	
-	attendanceIter := s.client.Collection("dojos").Doc(dojoID).Collection("attendance").
-		Where("createdAt", ">=", firstDayOfMonth).Documents(ctx)
-
-	presentCount := 0
-	absentCount := 0
-	lateCount := 0
+	iter := attendanceCol.Where("createdAt", ">=", firstDayOfMonth).Documents(ctx)
+	defer iter.Stop()
 
 	for {
-		doc, err := attendanceIter.Next()
+		doc, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
-		if err != nil {
+		if err != nil || !budget.Take() {
 			break
 		}
 
-		data := doc.Data()
-		status, _ := data["status"].(string)
-		switch status {
+		att, err := fsdoc.As[fsdoc.Attendance](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
+		switch att.Status {
 		case "present":
-			presentCount++
+			out.Present++
 		case "absent":
-			absentCount++
+			out.Absent++
 		case "late":
-			lateCount++
+			out.Late++
 		}
 	}
 
-	totalAttendance := presentCount + absentCount + lateCount
-	var rate string
-	if totalAttendance > 0 {
-		rate = fmt.Sprintf("%.1f", float64(presentCount+lateCount)/float64(totalAttendance)*100)
+	out.Total = out.Present + out.Absent + out.Late
+	if out.Total > 0 {
+		out.Rate = fmt.Sprintf("%.1f", float64(out.Present+out.Late)/float64(out.Total)*100)
 	} else {
-		rate = "0"
+		out.Rate = "0"
 	}
-
-	return &DojoStats{
-		Members: MemberStats{
-			Total:            totalMembers,
-			Active:           activeMembers,
-			Pending:          pendingMembers,
-			RoleDistribution: roleDistribution,
-		},
-		Sessions: SessionStats{
-			Active: activeSessions,
-		},
-		Attendance: AttendanceStats{
-			ThisMonth: MonthlyAttendance{
-				Total:   totalAttendance,
-				Present: presentCount,
-				Absent:  absentCount,
-				Late:    lateCount,
-				Rate:    rate,
-			},
-		},
-	}, nil
+	return out, nil
 }
 
 // GetMemberStats gets statistics for a member
@@ -148,19 +216,12 @@ func (s *Service) GetMemberStats(ctx context.Context, dojoID, memberUID string)
 		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
 	}
 
-	memberData := memberDoc.Data()
-	beltRank, _ := memberData["beltRank"].(string)
-	if beltRank == "" {
-		beltRank = "white"
+	member, err := fsdoc.As[fsdoc.Member](memberDoc)
+	if err != nil {
+		return nil, err
 	}
-	stripes, _ := memberData["stripes"].(int64)
-
-	var joinedAt time.Time
-	if ja, ok := memberData["joinedAt"].(time.Time); ok {
-		joinedAt = ja
-	} else if ca, ok := memberData["createdAt"].(time.Time); ok {
-		joinedAt = ca
-	} else {
+	joinedAt := member.Since()
+	if joinedAt.IsZero() {
 		joinedAt = time.Now()
 	}
 
@@ -168,8 +229,13 @@ func (s *Service) GetMemberStats(ctx context.Context, dojoID, memberUID string)
 	daysSinceJoined := int(now.Sub(joinedAt).Hours() / 24)
 
 	// Get all attendance
-	attendanceIter := s.client.Collection("dojos").Doc(dojoID).Collection("attendance").
-		Where("memberUid", "==", memberUID).Documents(ctx)
+	attendanceCol, err := s.dojoCol(ctx, dojoID, "attendance")
+	if err != nil {
+		return nil, err
+	}
+	attendanceIter := attendanceCol.Where("memberUid", "==", memberUID).Documents(ctx)
+	defer attendanceIter.Stop()
+	budget := s.budget(func(b ScanBudgets) int { return b.Member })
 
 	totalClasses := 0
 	presentCount := 0
@@ -185,13 +251,16 @@ func (s *Service) GetMemberStats(ctx context.Context, dojoID, memberUID string)
 		if err == iterator.Done {
 			break
 		}
-		if err != nil {
+		if err != nil || !budget.Take() {
 			break
 		}
 
+		att, err := fsdoc.As[fsdoc.Attendance](doc)
+		if err != nil {
+			continue // logged and counted by fsdoc
+		}
 		totalClasses++
-		data := doc.Data()
-		status, _ := data["status"].(string)
+		status := att.Status
 
 		switch status {
 		case "present":
@@ -203,7 +272,7 @@ func (s *Service) GetMemberStats(ctx context.Context, dojoID, memberUID string)
 		}
 
 		// Check if this month
-		if createdAt, ok := data["createdAt"].(time.Time); ok && createdAt.After(firstDayOfMonth) {
+		if att.CreatedAt.After(firstDayOfMonth) {
 			thisMonthTotal++
 			if status == "present" || status == "late" {
 				thisMonthPresent++
@@ -211,6 +280,13 @@ func (s *Service) GetMemberStats(ctx context.Context, dojoID, memberUID string)
 		}
 	}
 
+	// records older than the dojo's retention policy only survive as monthly summaries
+	archived := s.memberArchivedCounts(ctx, dojoID, memberUID)
+	totalClasses += archived.total
+	presentCount += archived.present
+	lateCount += archived.late
+	absentCount += archived.absent
+
 	var rate string
 	if totalClasses > 0 {
 		rate = fmt.Sprintf("%.1f", float64(presentCount+lateCount)/float64(totalClasses)*100)
@@ -243,8 +319,8 @@ func (s *Service) GetMemberStats(ctx context.Context, dojoID, memberUID string)
 
 	return &MemberStatsResult{
 		Member: MemberInfo{
-			BeltRank:        beltRank,
-			Stripes:         int(stripes),
+			BeltRank:        member.Belt(),
+			Stripes:         member.Stripes,
 			JoinedAt:        joinedAt,
 			DaysSinceJoined: daysSinceJoined,
 		},
@@ -261,121 +337,135 @@ func (s *Service) GetMemberStats(ctx context.Context, dojoID, memberUID string)
 			},
 		},
 		RecentPromotions: recentPromotions,
+		Partial:          ctx.Err() != nil || budget.Exhausted(),
 	}, nil
 }
 
-// GetAttendanceStats gets attendance statistics
-func (s *Service) GetAttendanceStats(ctx context.Context, dojoID, period, sessionID string) (*AttendanceStatsResult, error) {
+// GetAttendanceStats gets attendance statistics for a fixed period or a
+// from/to range, from the cache when recent
+func (s *Service) GetAttendanceStats(ctx context.Context, dojoID string, q AttendanceStatsQuery) (*AttendanceStatsResult, error) {
 	if dojoID == "" {
 		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
 	}
-
-	now := time.Now()
-	var startDate time.Time
-
-	switch period {
-	case "day":
-		startDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
-	case "week":
-		startDate = now.AddDate(0, 0, -7)
-	default:
-		period = "month"
-		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if _, _, _, err := q.window(time.Now()); err != nil {
+		return nil, err
 	}
+	key := strings.Join([]string{"attendance", q.Period, q.From, q.To, q.SessionID, strconv.FormatBool(q.Compare)}, "\x00")
+	return cachedStats(ctx, s.cache, dojoID, key, func(ctx context.Context) (*AttendanceStatsResult, bool, error) {
+		out, err := s.computeAttendanceStats(ctx, dojoID, q)
+		return out, err == nil && ctx.Err() == nil, err
+	})
+}
 
-	query := s.client.Collection("dojos").Doc(dojoID).Collection("attendance").
-		Where("createdAt", ">=", startDate)
-
-	if sessionID != "" {
-		query = query.Where("sessionId", "==", sessionID)
+func (s *Service) computeAttendanceStats(ctx context.Context, dojoID string, q AttendanceStatsQuery) (*AttendanceStatsResult, error) {
+	startDate, endDate, period, err := q.window(time.Now())
+	if err != nil {
+		return nil, err
 	}
 
-	iter := query.Documents(ctx)
-
-	dailyStats := make(map[string]*DailyStats)
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			break
-		}
-
-		data := doc.Data()
-		var createdAt time.Time
-		if ca, ok := data["createdAt"].(time.Time); ok {
-			createdAt = ca
-		} else {
-			continue
-		}
+	classes := s.classIndex(ctx, dojoID)
+	budget := s.budget(func(b ScanBudgets) int { return b.Attendance })
+	t, err := s.tallyAttendance(ctx, dojoID, q.SessionID, startDate, endDate, classes, budget)
+	if err != nil {
+		return nil, err
+	}
 
-		dateKey := createdAt.Format("2006-01-02")
-		if dailyStats[dateKey] == nil {
-			dailyStats[dateKey] = &DailyStats{Date: dateKey}
+	byTag := make([]TagStats, 0, len(t.byTag))
+	for _, ts := range t.byTag {
+		ts.Rate = attendanceRate(ts.Present, ts.Late, ts.Total)
+		byTag = append(byTag, *ts)
+	}
+	sort.Slice(byTag, func(i, j int) bool {
+		if byTag[i].Total != byTag[j].Total {
+			return byTag[i].Total > byTag[j].Total
 		}
+		return byTag[i].Tag < byTag[j].Tag
+	})
+	truncated := len(byTag) > maxBreakdownRows
+	if truncated {
+		byTag = byTag[:maxBreakdownRows]
+	}
 
-		dailyStats[dateKey].Total++
-		status, _ := data["status"].(string)
-		switch status {
-		case "present":
-			dailyStats[dateKey].Present++
-		case "absent":
-			dailyStats[dateKey].Absent++
-		case "late":
-			dailyStats[dateKey].Late++
+	byClass := make([]ClassStats, 0, len(t.byClass))
+	for _, cs := range t.byClass {
+		cs.Rate = attendanceRate(cs.Present, cs.Late, cs.Total)
+		byClass = append(byClass, *cs)
+	}
+	sort.Slice(byClass, func(i, j int) bool {
+		if byClass[i].Total != byClass[j].Total {
+			return byClass[i].Total > byClass[j].Total
 		}
+		return byClass[i].SessionID < byClass[j].SessionID
+	})
+	if len(byClass) > maxBreakdownRows {
+		byClass = byClass[:maxBreakdownRows]
+		truncated = true
 	}
 
 	// Sort dates
 	var dates []string
-	for date := range dailyStats {
+	for date := range t.daily {
 		dates = append(dates, date)
 	}
 	sort.Strings(dates)
 
 	var chartData []DailyStats
-	totalPresent := 0
-	totalAbsent := 0
-	totalLate := 0
-	totalRecords := 0
-
 	for _, date := range dates {
-		ds := dailyStats[date]
-		if ds.Total > 0 {
-			ds.Rate = fmt.Sprintf("%.1f", float64(ds.Present+ds.Late)/float64(ds.Total)*100)
-		} else {
-			ds.Rate = "0"
-		}
+		ds := t.daily[date]
+		ds.Rate = attendanceRate(ds.Present, ds.Late, ds.Total)
 		chartData = append(chartData, *ds)
+	}
 
-		totalPresent += ds.Present
-		totalAbsent += ds.Absent
-		totalLate += ds.Late
-		totalRecords += ds.Total
+	out := &AttendanceStatsResult{
+		Period:    period,
+		StartDate: startDate.Format(time.RFC3339),
+		EndDate:   endDate.Format(time.RFC3339),
+		Summary:   t.summary(),
+		Daily:     chartData,
+		ByTag:     byTag,
+		ByClass:   byClass,
+		Calendar:  s.calendar(ctx, dojoID),
 	}
 
-	var summaryRate string
-	if totalRecords > 0 {
-		summaryRate = fmt.Sprintf("%.1f", float64(totalPresent+totalLate)/float64(totalRecords)*100)
-	} else {
-		summaryRate = "0"
+	if q.Compare {
+		prevStart := startDate.Add(-endDate.Sub(startDate))
+		pt, err := s.tallyAttendance(ctx, dojoID, q.SessionID, prevStart, startDate, classes, budget)
+		if err != nil {
+			return nil, err
+		}
+		prev := pt.summary()
+		out.Comparison = &StatsComparison{
+			StartDate:   prevStart.Format(time.RFC3339),
+			EndDate:     startDate.Format(time.RFC3339),
+			Summary:     prev,
+			TotalChange: out.Summary.Total - prev.Total,
+			RateChange:  rateChange(prev, out.Summary),
+		}
 	}
 
-	return &AttendanceStatsResult{
-		Period:    period,
-		StartDate: startDate.Format(time.RFC3339),
-		EndDate:   now.Format(time.RFC3339),
-		Summary: StatsSummary{
-			Total:   totalRecords,
-			Present: totalPresent,
-			Absent:  totalAbsent,
-			Late:    totalLate,
-			Rate:    summaryRate,
-		},
-		Daily: chartData,
-	}, nil
+	out.Partial = ctx.Err() != nil || budget.Exhausted() || truncated
+	return out, nil
+}
+
+// calendar is the dojo's week start and date formats, for laying out reports
+func (s *Service) calendar(ctx context.Context, dojoID string) dojo.CalendarHints {
+	return dojo.NewRepo(s.client).Calendar(ctx, dojoID)
+}
+
+// classIndex maps class IDs to their classes (empty without a session service)
+func (s *Service) classIndex(ctx context.Context, dojoID string) map[string]session.Session {
+	out := map[string]session.Session{}
+	if s.sessionSvc == nil {
+		return out
+	}
+	sessions, err := s.sessionSvc.List(ctx, dojoID, session.ListSessionsInput{Limit: 100})
+	if err != nil {
+		return out
+	}
+	for _, sess := range sessions {
+		out[sess.ID] = sess
+	}
+	return out
 }
 
 func formatFloat(f float64) string {
@@ -0,0 +1,107 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// The benchmarks read from the Firestore emulator and are skipped without
+// one:
+//
+//	gcloud emulators firestore start --host-port=localhost:8085
+//	FIRESTORE_EMULATOR_HOST=localhost:8085 go test ./internal/domain/stripe -run '^$' -bench SubscriptionInfo
+//
+// BenchmarkGetSubscriptionInfo runs the usage counts side by side as the
+// endpoint does; BenchmarkGetSubscriptionInfoSequential runs the same reads
+// one after another for comparison.
+
+const (
+	benchMembers = 300
+	benchNotices = 30
+	benchClasses = 40
+)
+
+func BenchmarkGetSubscriptionInfo(b *testing.B) {
+	s, dojoID := benchService(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetSubscriptionInfo(ctx, dojoID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetSubscriptionInfoSequential(b *testing.B) {
+	s, dojoID := benchService(b)
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, limits := s.dojoPlanLimits(ctx, readPlanState(dojoDoc))
+		s.countMembers(ctx, dojoID)
+		s.countStaff(ctx, dojoID)
+		s.countAnnouncements(ctx, dojoID)
+		s.countClasses(ctx, dojoID)
+		s.bulkSendUsage(ctx, dojoID, limits.BulkSendsPerWeek)
+	}
+}
+
+// benchService seeds a dojo in the emulator and returns a Service reading it
+func benchService(b *testing.B) (*Service, string) {
+	b.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		b.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "bench-project")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { client.Close() })
+
+	dojoID := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	dojoRef := client.Collection("dojos").Doc(dojoID)
+	now := time.Now().UTC()
+
+	bw := client.BulkWriter(ctx)
+	if _, err := bw.Set(dojoRef, map[string]interface{}{"name": "Bench Dojo", "plan": PlanPro}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchMembers; i++ {
+		role := "student"
+		if i%20 == 0 {
+			role = "coach"
+		}
+		if _, err := bw.Set(dojoRef.Collection("members").Doc(fmt.Sprintf("m%04d", i)), map[string]interface{}{
+			"status": "active", "roleInDojo": role,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i < benchNotices; i++ {
+		if _, err := bw.Set(dojoRef.Collection("notices").NewDoc(), map[string]interface{}{
+			"title": "Notice", "status": "active", "publishAt": now.Add(-time.Hour),
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i < benchClasses; i++ {
+		if _, err := bw.Set(dojoRef.Collection("timetableClasses").NewDoc(), map[string]interface{}{
+			"title": "Class", "isActive": true,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bw.End()
+
+	return NewService(client, Config{}), dojoID
+}
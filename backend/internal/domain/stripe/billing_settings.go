@@ -0,0 +1,237 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/taxrate"
+)
+
+// DefaultCurrency is the currency of dojos that have not set one
+const DefaultCurrency = "usd"
+
+const (
+	maxTaxRate     = 30 // percent
+	maxTaxLabelLen = 30
+	maxTaxIDLen    = 40
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[a-z]{3}$`)
+	countryPattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// BillingSettings is dojos/{dojoId}/settings/billing: the currency and tax
+// of member billing (packages, shop orders, family subscriptions). Prices
+// set without a currency take the dojo's; checkouts in that currency carry
+// the tax.
+type BillingSettings struct {
+	Currency     string  `firestore:"currency" json:"currency"` // ISO 4217, lower case
+	TaxRate      float64 `firestore:"taxRate" json:"taxRate"`   // percent, e.g. 10 for 消費税, 5 for GST; 0 = no tax
+	TaxInclusive bool    `firestore:"taxInclusive" json:"taxInclusive"`
+	TaxLabel     string  `firestore:"taxLabel,omitempty" json:"taxLabel,omitempty"`     // shown on receipts, e.g. "GST", "消費税"
+	TaxCountry   string  `firestore:"taxCountry,omitempty" json:"taxCountry,omitempty"` // ISO 3166-1 alpha-2
+	// TaxID is the dojo's tax registration number (a JP invoice T-number,
+	// a CA GST/HST number), printed on exports
+	TaxID     string    `firestore:"taxId,omitempty" json:"taxId,omitempty"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt,omitempty"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+
+	// StripeTaxRateID is the Stripe tax rate matching the terms above.
+	// Stripe tax rates cannot change, so new terms get a new one.
+	StripeTaxRateID string `firestore:"stripeTaxRateId,omitempty" json:"-"`
+}
+
+// UpdateBillingSettingsInput changes the billing settings (nil fields are
+// left unchanged)
+type UpdateBillingSettingsInput struct {
+	Currency     *string  `json:"currency,omitempty"`
+	TaxRate      *float64 `json:"taxRate,omitempty"`
+	TaxInclusive *bool    `json:"taxInclusive,omitempty"`
+	TaxLabel     *string  `json:"taxLabel,omitempty"`
+	TaxCountry   *string  `json:"taxCountry,omitempty"`
+	TaxID        *string  `json:"taxId,omitempty"`
+}
+
+func (in *UpdateBillingSettingsInput) Trim() {
+	if in.Currency != nil {
+		*in.Currency = strings.ToLower(strings.TrimSpace(*in.Currency))
+	}
+	if in.TaxLabel != nil {
+		*in.TaxLabel = strings.TrimSpace(*in.TaxLabel)
+	}
+	if in.TaxCountry != nil {
+		*in.TaxCountry = strings.ToUpper(strings.TrimSpace(*in.TaxCountry))
+	}
+	if in.TaxID != nil {
+		*in.TaxID = strings.TrimSpace(*in.TaxID)
+	}
+}
+
+// taxTerms is what a Stripe tax rate is made of
+func (b *BillingSettings) taxTerms() string {
+	return fmt.Sprintf("%g|%t|%s|%s", b.TaxRate, b.TaxInclusive, b.TaxLabel, b.TaxCountry)
+}
+
+// taxRatesFor is the line item tax rates of a checkout in currency
+func (b *BillingSettings) taxRatesFor(currency string) []*string {
+	if b.StripeTaxRateID == "" || b.TaxRate <= 0 || currency != b.Currency {
+		return nil
+	}
+	return []*string{stripe.String(b.StripeTaxRateID)}
+}
+
+func (s *Service) billingSettingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("billing")
+}
+
+// GetBillingSettings loads the dojo's billing settings (the default currency
+// and no tax if not set)
+func (s *Service) GetBillingSettings(ctx context.Context, dojoID string) (*BillingSettings, error) {
+	if strings.TrimSpace(dojoID) == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.billingSettingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load billing settings: %w", err)
+	}
+	b := &BillingSettings{}
+	if doc.Exists() {
+		if err := doc.DataTo(b); err != nil {
+			return nil, fmt.Errorf("failed to decode billing settings: %w", err)
+		}
+	}
+	if b.Currency == "" {
+		b.Currency = DefaultCurrency
+	}
+	return b, nil
+}
+
+// Currency is the dojo's billing currency, the default if its settings
+// cannot be read
+func (s *Service) Currency(ctx context.Context, dojoID string) string {
+	b, err := s.GetBillingSettings(ctx, dojoID)
+	if err != nil {
+		return DefaultCurrency
+	}
+	return b.Currency
+}
+
+// UpdateBillingSettings sets the dojo's currency and tax (the router checks
+// the billing permission). Prices already set keep their currency, and
+// running subscriptions their tax.
+func (s *Service) UpdateBillingSettings(ctx context.Context, uid, dojoID string, in UpdateBillingSettingsInput) (*BillingSettings, error) {
+	in.Trim()
+	b, err := s.GetBillingSettings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	terms := b.taxTerms()
+
+	if in.Currency != nil {
+		if !currencyPattern.MatchString(*in.Currency) {
+			return nil, fmt.Errorf("%w: currency must be a 3-letter ISO code", ErrBadRequest)
+		}
+		b.Currency = *in.Currency
+	}
+	if in.TaxRate != nil {
+		if *in.TaxRate < 0 || *in.TaxRate > maxTaxRate {
+			return nil, fmt.Errorf("%w: taxRate must be 0-%d percent", ErrBadRequest, maxTaxRate)
+		}
+		b.TaxRate = *in.TaxRate
+	}
+	if in.TaxInclusive != nil {
+		b.TaxInclusive = *in.TaxInclusive
+	}
+	if in.TaxLabel != nil {
+		if len(*in.TaxLabel) > maxTaxLabelLen {
+			return nil, fmt.Errorf("%w: taxLabel must be at most %d characters", ErrBadRequest, maxTaxLabelLen)
+		}
+		b.TaxLabel = *in.TaxLabel
+	}
+	if in.TaxCountry != nil {
+		if *in.TaxCountry != "" && !countryPattern.MatchString(*in.TaxCountry) {
+			return nil, fmt.Errorf("%w: taxCountry must be a 2-letter ISO code", ErrBadRequest)
+		}
+		b.TaxCountry = *in.TaxCountry
+	}
+	if in.TaxID != nil {
+		if len(*in.TaxID) > maxTaxIDLen {
+			return nil, fmt.Errorf("%w: taxId must be at most %d characters", ErrBadRequest, maxTaxIDLen)
+		}
+		b.TaxID = *in.TaxID
+	}
+
+	if b.TaxRate <= 0 {
+		b.StripeTaxRateID = ""
+	} else if b.StripeTaxRateID == "" || b.taxTerms() != terms {
+		id, err := s.createTaxRate(dojoID, b)
+		if err != nil {
+			return nil, err
+		}
+		b.StripeTaxRateID = id
+	}
+	b.UpdatedAt = time.Now().UTC()
+	b.UpdatedBy = uid
+
+	if _, err := s.billingSettingsRef(dojoID).Set(ctx, b); err != nil {
+		return nil, fmt.Errorf("failed to save billing settings: %w", err)
+	}
+	return b, nil
+}
+
+func (s *Service) createTaxRate(dojoID string, b *BillingSettings) (string, error) {
+	label := b.TaxLabel
+	if label == "" {
+		label = "Tax"
+	}
+	params := &stripe.TaxRateParams{
+		DisplayName: stripe.String(label),
+		Percentage:  stripe.Float64(b.TaxRate),
+		Inclusive:   stripe.Bool(b.TaxInclusive),
+	}
+	if b.TaxCountry != "" {
+		params.Country = stripe.String(b.TaxCountry)
+	}
+	params.AddMetadata("dojoId", dojoID)
+	tr, err := taxrate.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create stripe tax rate: %w", err)
+	}
+	return tr.ID, nil
+}
+
+// checkoutBilling is the currency and tax rates of a member checkout for the
+// dojo in its metadata; a checkout without a dojo gets the default currency
+// and no tax
+func (s *Service) checkoutBilling(ctx context.Context, currency string, metadata map[string]string) (string, []*string) {
+	currency = strings.ToLower(currency)
+	dojoID := metadata["dojoId"]
+	if dojoID == "" {
+		if currency == "" {
+			currency = DefaultCurrency
+		}
+		return currency, nil
+	}
+	b, err := s.GetBillingSettings(ctx, dojoID)
+	if err != nil {
+		log.Printf("stripe: checkout for dojo %s without billing settings: %v", dojoID, err)
+		b = &BillingSettings{Currency: DefaultCurrency}
+	}
+	if currency == "" {
+		currency = b.Currency
+	}
+	rates := b.taxRatesFor(currency)
+	if rates != nil {
+		metadata["taxRate"] = strconv.FormatFloat(b.TaxRate, 'f', -1, 64)
+		metadata["taxInclusive"] = strconv.FormatBool(b.TaxInclusive)
+	}
+	return currency, rates
+}
@@ -0,0 +1,257 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/customer"
+	"github.com/stripe/stripe-go/v76/subscription"
+	"google.golang.org/api/iterator"
+)
+
+// Expiring cards are the main cause of involuntary churn: the renewal fails
+// weeks after anyone could have fixed it. CheckCardExpiry runs daily and
+// warns the owners of dojos whose plan is charged to a card that expires
+// within cardExpiryWindow, once per card, with a link that opens the billing
+// portal on the card update page. Member-facing subscriptions (families) are
+// billed to the member's own card and are not checked yet.
+
+// cardExpiryWindow is how far ahead an expiring card is reported
+const cardExpiryWindow = 30 * 24 * time.Hour
+
+// PortalFlowPaymentMethodUpdate opens the billing portal on the card update page
+const PortalFlowPaymentMethodUpdate = "payment_method_update"
+
+// CardExpiry is the dojo doc's cardExpiry field, set while the card paying
+// for the plan is about to expire, so the app can show a banner
+type CardExpiry struct {
+	PaymentMethodID string    `firestore:"paymentMethodId" json:"paymentMethodId"`
+	Brand           string    `firestore:"brand,omitempty" json:"brand,omitempty"`
+	Last4           string    `firestore:"last4,omitempty" json:"last4,omitempty"`
+	ExpMonth        int       `firestore:"expMonth" json:"expMonth"`
+	ExpYear         int       `firestore:"expYear" json:"expYear"`
+	ExpiresAt       time.Time `firestore:"expiresAt" json:"expiresAt"` // end of the expiry month
+	NotifiedAt      time.Time `firestore:"notifiedAt,omitempty" json:"notifiedAt,omitempty"`
+}
+
+// ExpiringCard is one dojo reported by a run
+type ExpiringCard struct {
+	DojoID   string     `json:"dojoId"`
+	Card     CardExpiry `json:"card"`
+	Expired  bool       `json:"expired"`
+	Notified bool       `json:"notified"` // false when an earlier run already did
+}
+
+// CardExpiryResult is the report of one run
+type CardExpiryResult struct {
+	DryRun       bool           `json:"dryRun"`
+	DojosChecked int            `json:"dojosChecked"`
+	Expiring     []ExpiringCard `json:"expiring"`
+	Failed       int            `json:"failed"` // Stripe lookups that failed
+	StartedAt    time.Time      `json:"startedAt"`
+	FinishedAt   time.Time      `json:"finishedAt"`
+}
+
+// PortalLink is the app page that opens the billing portal for the dojo on
+// flow (see CreatePortalInput.Flow). It is absolute when AppURL is
+// configured, otherwise a path in the web app.
+func (s *Service) PortalLink(dojoID, flow string) string {
+	q := url.Values{"flow": {flow}}
+	return fmt.Sprintf("%s/dojos/%s/settings/billing/portal?%s", s.config.AppURL, url.PathEscape(dojoID), q.Encode())
+}
+
+// CheckCardExpiry looks up the default card of every dojo on a live plan and
+// warns the owners of those about to expire. Unless dryRun, it also records
+// the warning on the dojo doc, and clears it once the card is replaced.
+// Meant to run daily from Cloud Scheduler.
+func (s *Service) CheckCardExpiry(ctx context.Context, now time.Time, dryRun bool) (*CardExpiryResult, error) {
+	res := &CardExpiryResult{DryRun: dryRun, Expiring: []ExpiringCard{}, StartedAt: time.Now().UTC()}
+
+	iter := s.fs.Collection("dojos").Where("subscriptionStatus", "in", liveStatuses).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		data := doc.Data()
+		customerID, _ := data["stripeCustomerId"].(string)
+		if customerID == "" {
+			continue
+		}
+		res.DojosChecked++
+
+		subscriptionID, _ := data["subscriptionId"].(string)
+		card, err := defaultCard(subscriptionID, customerID)
+		if err != nil {
+			log.Printf("card expiry: failed to look up card of dojo %s: %v", doc.Ref.ID, err)
+			res.Failed++
+			continue
+		}
+		prev := storedCardExpiry(data)
+
+		if card == nil || card.ExpiresAt.After(now.Add(cardExpiryWindow)) {
+			if prev != nil && !dryRun {
+				if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "cardExpiry", Value: firestore.Delete}}); err != nil {
+					log.Printf("card expiry: failed to clear warning of dojo %s: %v", doc.Ref.ID, err)
+				}
+			}
+			continue
+		}
+
+		exp := ExpiringCard{DojoID: doc.Ref.ID, Card: *card, Expired: !card.ExpiresAt.After(now)}
+		if prev != nil && prev.PaymentMethodID == card.PaymentMethodID && !prev.NotifiedAt.IsZero() {
+			exp.Card.NotifiedAt = prev.NotifiedAt
+			res.Expiring = append(res.Expiring, exp)
+			continue
+		}
+		if !dryRun {
+			exp.Card.NotifiedAt = now
+			if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "cardExpiry", Value: exp.Card}}); err != nil {
+				log.Printf("card expiry: failed to record warning of dojo %s: %v", doc.Ref.ID, err)
+				res.Failed++
+				continue
+			}
+			s.notifyCardExpiry(ctx, doc.Ref.ID, data, exp)
+			exp.Notified = true
+		}
+		res.Expiring = append(res.Expiring, exp)
+	}
+
+	res.FinishedAt = time.Now().UTC()
+	return res, nil
+}
+
+// defaultCard is the card Stripe charges for the plan: the subscription's
+// default payment method, else the customer's invoice default, else their
+// default source. Nil when the plan is not paid by card.
+func defaultCard(subscriptionID, customerID string) (*CardExpiry, error) {
+	if subscriptionID != "" {
+		params := &stripe.SubscriptionParams{}
+		params.AddExpand("default_payment_method")
+		sub, err := subscription.Get(subscriptionID, params)
+		if err != nil {
+			return nil, err
+		}
+		if c := paymentMethodCard(sub.DefaultPaymentMethod); c != nil {
+			return c, nil
+		}
+	}
+
+	params := &stripe.CustomerParams{}
+	params.AddExpand("invoice_settings.default_payment_method")
+	params.AddExpand("default_source")
+	cust, err := customer.Get(customerID, params)
+	if err != nil {
+		return nil, err
+	}
+	if cust.InvoiceSettings != nil {
+		if c := paymentMethodCard(cust.InvoiceSettings.DefaultPaymentMethod); c != nil {
+			return c, nil
+		}
+	}
+	if src := cust.DefaultSource; src != nil && src.Card != nil {
+		return newCardExpiry(src.ID, string(src.Card.Brand), src.Card.Last4, src.Card.ExpMonth, src.Card.ExpYear), nil
+	}
+	return nil, nil
+}
+
+func paymentMethodCard(pm *stripe.PaymentMethod) *CardExpiry {
+	if pm == nil || pm.Card == nil {
+		return nil
+	}
+	return newCardExpiry(pm.ID, string(pm.Card.Brand), pm.Card.Last4, pm.Card.ExpMonth, pm.Card.ExpYear)
+}
+
+// newCardExpiry describes a card, valid through the last day of its expiry month
+func newCardExpiry(id, brand, last4 string, month, year int64) *CardExpiry {
+	return &CardExpiry{
+		PaymentMethodID: id,
+		Brand:           brand,
+		Last4:           last4,
+		ExpMonth:        int(month),
+		ExpYear:         int(year),
+		ExpiresAt:       time.Date(int(year), time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func storedCardExpiry(data map[string]interface{}) *CardExpiry {
+	m, ok := data["cardExpiry"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	c := &CardExpiry{}
+	c.PaymentMethodID, _ = m["paymentMethodId"].(string)
+	c.NotifiedAt, _ = m["notifiedAt"].(time.Time)
+	return c
+}
+
+// notifyCardExpiry tells the dojo's owners (best effort)
+func (s *Service) notifyCardExpiry(ctx context.Context, dojoID string, dojoData map[string]interface{}, exp ExpiringCard) {
+	owners := map[string]bool{}
+	if uid, _ := dojoData["ownerUid"].(string); uid != "" {
+		owners[uid] = true
+	}
+	if ids, ok := dojoData["ownerIds"].([]interface{}); ok {
+		for _, v := range ids {
+			if uid, _ := v.(string); uid != "" {
+				owners[uid] = true
+			}
+		}
+	}
+
+	card := "The card"
+	if exp.Card.Last4 != "" {
+		card = fmt.Sprintf("The %s card ending in %s", cardBrandName(exp.Card.Brand), exp.Card.Last4)
+	}
+	title := "Card expiring soon"
+	body := fmt.Sprintf("%s that pays for your plan expires at the end of %02d/%d. Update it to keep your plan active.", card, exp.Card.ExpMonth, exp.Card.ExpYear)
+	if exp.Expired {
+		title = "Card expired"
+		body = fmt.Sprintf("%s that pays for your plan has expired. Update it before the next renewal to keep your plan active.", card)
+	}
+	link := s.PortalLink(dojoID, PortalFlowPaymentMethodUpdate)
+
+	for uid := range owners {
+		_, _, err := s.fs.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+			"title": title,
+			"body":  body,
+			"type":  "billing_card_expiry",
+			"data": map[string]interface{}{
+				"paymentMethodId": exp.Card.PaymentMethodID,
+				"url":             link,
+			},
+			"read":      false,
+			"dojoId":    dojoID,
+			"createdAt": time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("card expiry: failed to notify %s: %v", uid, err)
+		}
+	}
+}
+
+// cardBrandName is how a Stripe card brand reads in a sentence
+func cardBrandName(brand string) string {
+	switch brand {
+	case "amex":
+		return "American Express"
+	case "diners":
+		return "Diners Club"
+	case "jcb", "unionpay":
+		return strings.ToUpper(brand)
+	case "", "unknown":
+		return "payment"
+	default:
+		return strings.ToUpper(brand[:1]) + brand[1:]
+	}
+}
@@ -7,9 +7,11 @@ var (
 	ErrUnauthorized = errors.New("unauthorized")
 	ErrBadRequest   = errors.New("bad request")
 	ErrLimitReached = errors.New("plan limit reached")
+	ErrTestModeOnly = errors.New("only available with a Stripe test key")
 )
 
 func IsErrNotFound(err error) bool     { return errors.Is(err, ErrNotFound) }
 func IsErrUnauthorized(err error) bool { return errors.Is(err, ErrUnauthorized) }
 func IsErrBadRequest(err error) bool   { return errors.Is(err, ErrBadRequest) }
 func IsErrLimitReached(err error) bool { return errors.Is(err, ErrLimitReached) }
+func IsErrTestModeOnly(err error) bool { return errors.Is(err, ErrTestModeOnly) }
@@ -0,0 +1,352 @@
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Webhook events are persisted to stripeEvents/{eventId} by HandleWebhook and
+// applied by the event worker. Failed events are retried with exponential
+// backoff and parked as dead_letter after maxEventAttempts for an admin to
+// inspect and retry. A crashed worker's claim expires after eventLease.
+// Processed events get an expireAt processedEventRetention out, which the TTL
+// policy on stripeEvents.expireAt deletes.
+//
+// Retries can apply events out of order, so each subscription's last applied
+// event time is kept in stripeSubscriptions/{subscriptionId} and older
+// subscription events are skipped.
+const (
+	EventPending    = "pending"
+	EventProcessing = "processing"
+	EventProcessed  = "processed"
+	EventDeadLetter = "dead_letter"
+
+	maxEventAttempts  = 8
+	eventLease        = 5 * time.Minute
+	eventBaseBackoff  = 30 * time.Second
+	eventMaxBackoff   = time.Hour
+	eventPollInterval = 15 * time.Second
+	eventBatchSize    = 20
+	eventTimeout      = 30 * time.Second
+
+	processedEventRetention = 30 * 24 * time.Hour
+)
+
+// WebhookEvent is a queued Stripe webhook event
+type WebhookEvent struct {
+	ID            string     `firestore:"-" json:"id"`
+	Type          string     `firestore:"type" json:"type"`
+	Created       time.Time  `firestore:"created" json:"created"` // when Stripe created the event
+	Payload       string     `firestore:"payload" json:"payload"` // raw event.data.object JSON
+	Status        string     `firestore:"status" json:"status"`
+	Attempts      int        `firestore:"attempts" json:"attempts"`
+	LastError     string     `firestore:"lastError,omitempty" json:"lastError,omitempty"`
+	ReceivedAt    time.Time  `firestore:"receivedAt" json:"receivedAt"`
+	NextAttemptAt time.Time  `firestore:"nextAttemptAt" json:"nextAttemptAt"`
+	ProcessedAt   *time.Time `firestore:"processedAt,omitempty" json:"processedAt,omitempty"`
+	ExpireAt      *time.Time `firestore:"expireAt,omitempty" json:"expireAt,omitempty"`
+}
+
+// ProcessEventsResult is returned by ProcessPendingEvents
+type ProcessEventsResult struct {
+	Processed  int `json:"processed"`
+	Retrying   int `json:"retrying"`
+	DeadLetter int `json:"deadLetter"`
+}
+
+func (s *Service) eventsCol() *firestore.CollectionRef {
+	return s.fs.Collection("stripeEvents")
+}
+
+// enqueueEvent stores a verified event; redeliveries of the same event are ignored
+func (s *Service) enqueueEvent(ctx context.Context, eventID, eventType string, created time.Time, raw json.RawMessage) error {
+	ref := s.eventsCol().Doc(eventID)
+	now := time.Now().UTC()
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err == nil && doc.Exists() {
+			return nil
+		}
+		if err != nil && doc == nil {
+			return err
+		}
+		return tx.Create(ref, WebhookEvent{
+			Type:          eventType,
+			Created:       created,
+			Payload:       string(raw),
+			Status:        EventPending,
+			ReceivedAt:    now,
+			NextAttemptAt: now,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.wakeEventWorker()
+	return nil
+}
+
+func (s *Service) wakeEventWorker() {
+	select {
+	case s.eventWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartEventWorker processes queued webhook events until ctx is cancelled.
+// It polls as a safety net and is woken right away when an event arrives.
+func (s *Service) StartEventWorker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(eventPollInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.ProcessPendingEvents(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("stripe events: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.eventWake:
+			}
+		}
+	}()
+}
+
+// ProcessPendingEvents applies due events once. Also exposed to admins so a
+// scheduler can drain the queue where background CPU is throttled.
+func (s *Service) ProcessPendingEvents(ctx context.Context) (*ProcessEventsResult, error) {
+	res := &ProcessEventsResult{}
+	now := time.Now().UTC()
+
+	// processing events are due again once their lease (nextAttemptAt) expires
+	iter := s.eventsCol().
+		Where("status", "in", []string{EventPending, EventProcessing}).
+		Where("nextAttemptAt", "<=", now).
+		OrderBy("nextAttemptAt", firestore.Asc).
+		Limit(eventBatchSize).
+		Documents(ctx)
+	docs, err := iter.GetAll()
+	if err != nil {
+		return res, fmt.Errorf("failed to list due events: %w", err)
+	}
+
+	for _, doc := range docs {
+		ev, ok, err := s.claimEvent(ctx, doc.Ref)
+		if err != nil {
+			log.Printf("stripe events: claim %s failed: %v", doc.Ref.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		pctx, cancel := context.WithTimeout(ctx, eventTimeout)
+		procErr := s.processEvent(pctx, ev.Type, ev.Created, json.RawMessage(ev.Payload))
+		cancel()
+
+		switch status, err := s.finishEvent(ctx, doc.Ref, ev, procErr); {
+		case err != nil:
+			log.Printf("stripe events: saving result of %s failed: %v", doc.Ref.ID, err)
+		case status == EventProcessed:
+			res.Processed++
+		case status == EventDeadLetter:
+			log.Printf("stripe events: %s (%s) dead-lettered after %d attempts: %v", doc.Ref.ID, ev.Type, ev.Attempts, procErr)
+			res.DeadLetter++
+		default:
+			res.Retrying++
+		}
+	}
+	return res, nil
+}
+
+// claimEvent leases a due event to this worker and counts the attempt
+func (s *Service) claimEvent(ctx context.Context, ref *firestore.DocumentRef) (*WebhookEvent, bool, error) {
+	var ev WebhookEvent
+	claimed := false
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&ev); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if (ev.Status != EventPending && ev.Status != EventProcessing) || ev.NextAttemptAt.After(now) {
+			return nil
+		}
+		ev.Status = EventProcessing
+		ev.Attempts++
+		ev.NextAttemptAt = now.Add(eventLease)
+		claimed = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: ev.Status},
+			{Path: "attempts", Value: ev.Attempts},
+			{Path: "nextAttemptAt", Value: ev.NextAttemptAt},
+		})
+	})
+	ev.ID = ref.ID
+	return &ev, claimed, err
+}
+
+// finishEvent records the outcome of an attempt and returns the new status
+func (s *Service) finishEvent(ctx context.Context, ref *firestore.DocumentRef, ev *WebhookEvent, procErr error) (string, error) {
+	now := time.Now().UTC()
+	if procErr == nil {
+		_, err := ref.Update(ctx, []firestore.Update{
+			{Path: "status", Value: EventProcessed},
+			{Path: "processedAt", Value: now},
+			{Path: "expireAt", Value: now.Add(processedEventRetention)},
+			{Path: "lastError", Value: firestore.Delete},
+		})
+		return EventProcessed, err
+	}
+
+	status := EventPending
+	next := now.Add(eventBackoff(ev.Attempts))
+	if ev.Attempts >= maxEventAttempts {
+		status = EventDeadLetter
+	}
+	_, err := ref.Update(ctx, []firestore.Update{
+		{Path: "status", Value: status},
+		{Path: "nextAttemptAt", Value: next},
+		{Path: "lastError", Value: procErr.Error()},
+	})
+	return status, err
+}
+
+// staleSubscriptionEvent reports whether an event created at is older than
+// the last one applied to the subscription. Events queued before created
+// was stored (zero at) are never stale.
+func (s *Service) staleSubscriptionEvent(ctx context.Context, subscriptionID string, at time.Time) (bool, error) {
+	if at.IsZero() || subscriptionID == "" {
+		return false, nil
+	}
+	doc, err := s.fs.Collection("stripeSubscriptions").Doc(subscriptionID).Get(ctx)
+	if err != nil && doc == nil {
+		return false, fmt.Errorf("failed to read subscription event time: %w", err)
+	}
+	if !doc.Exists() {
+		return false, nil
+	}
+	last, _ := doc.Data()["lastEventAt"].(time.Time)
+	return at.Before(last), nil
+}
+
+// markSubscriptionEvent records at as the subscription's last applied event
+// time, unless a later one is already recorded
+func (s *Service) markSubscriptionEvent(ctx context.Context, subscriptionID string, at time.Time) error {
+	if at.IsZero() || subscriptionID == "" {
+		return nil
+	}
+	ref := s.fs.Collection("stripeSubscriptions").Doc(subscriptionID)
+	return s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return err
+		}
+		if doc.Exists() {
+			if last, _ := doc.Data()["lastEventAt"].(time.Time); !at.After(last) {
+				return nil
+			}
+		}
+		return tx.Set(ref, map[string]interface{}{
+			"lastEventAt": at,
+			"updatedAt":   time.Now().UTC(),
+		})
+	})
+}
+
+func eventBackoff(attempts int) time.Duration {
+	d := eventBaseBackoff
+	for i := 1; i < attempts && d < eventMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > eventMaxBackoff {
+		d = eventMaxBackoff
+	}
+	return d
+}
+
+// ListEvents lists queued events by status, newest first (admin)
+func (s *Service) ListEvents(ctx context.Context, status string, limit int) ([]WebhookEvent, error) {
+	status = strings.TrimSpace(status)
+	if status == "" {
+		status = EventDeadLetter
+	}
+	switch status {
+	case EventPending, EventProcessing, EventProcessed, EventDeadLetter:
+	default:
+		return nil, fmt.Errorf("%w: status must be one of: %s, %s, %s, %s", ErrBadRequest,
+			EventPending, EventProcessing, EventProcessed, EventDeadLetter)
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	iter := s.eventsCol().
+		Where("status", "==", status).
+		OrderBy("receivedAt", firestore.Desc).
+		Limit(limit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	out := []WebhookEvent{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list events: %w", err)
+		}
+		var ev WebhookEvent
+		if err := doc.DataTo(&ev); err != nil {
+			continue
+		}
+		ev.ID = doc.Ref.ID
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+// RetryEvent puts a dead-lettered (or any unfinished) event back in the queue (admin)
+func (s *Service) RetryEvent(ctx context.Context, eventID string) (*WebhookEvent, error) {
+	ref := s.eventsCol().Doc(strings.TrimSpace(eventID))
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: event not found", ErrNotFound)
+	}
+	var ev WebhookEvent
+	if err := doc.DataTo(&ev); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+	if ev.Status == EventProcessed {
+		return nil, fmt.Errorf("%w: event was already processed", ErrBadRequest)
+	}
+
+	now := time.Now().UTC()
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "status", Value: EventPending},
+		{Path: "attempts", Value: 0},
+		{Path: "nextAttemptAt", Value: now},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to requeue event: %w", err)
+	}
+	s.wakeEventWorker()
+
+	ev.ID = ref.ID
+	ev.Status = EventPending
+	ev.Attempts = 0
+	ev.NextAttemptAt = now
+	return &ev, nil
+}
@@ -0,0 +1,177 @@
+package stripe
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/charge"
+	"google.golang.org/api/iterator"
+)
+
+// maxJournalMonths keeps an export to about one tax year
+const maxJournalMonths = 12
+
+// JournalRow is one paid invoice in the accounting export. Fee and Net are
+// nil for payments recorded before fees were kept, or settled in another
+// currency.
+type JournalRow struct {
+	Month         string    `json:"month"` // YYYY-MM
+	Date          time.Time `json:"date"`
+	InvoiceNumber string    `json:"invoiceNumber"` // the invoice id when Stripe gave no number
+	Gross         int64     `json:"gross"`         // minor units
+	Tax           int64     `json:"tax"`           // included in gross
+	Fee           *int64    `json:"fee,omitempty"`
+	Net           *int64    `json:"net,omitempty"`
+	Currency      string    `json:"currency"`
+}
+
+// JournalMonth totals a month of the journal per currency
+type JournalMonth struct {
+	Month    string `json:"month"`
+	Currency string `json:"currency"`
+	Payments int    `json:"payments"`
+	Gross    int64  `json:"gross"`
+	Tax      int64  `json:"tax"`
+	Fee      int64  `json:"fee"` // of the payments with a known fee
+	Net      int64  `json:"net"` // gross less the known fees
+}
+
+// PaymentJournal lists the dojo's paid invoices from the first day of from
+// to the end of the month of to (UTC), oldest first, with monthly totals.
+// The router checks the caller owns the dojo.
+func (s *Service) PaymentJournal(ctx context.Context, dojoID string, from, to time.Time) ([]JournalRow, []JournalMonth, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	if !end.After(start) {
+		return nil, nil, fmt.Errorf("%w: to must not be before from", ErrBadRequest)
+	}
+	if end.After(start.AddDate(0, maxJournalMonths, 0)) {
+		return nil, nil, fmt.Errorf("%w: at most %d months per export", ErrBadRequest, maxJournalMonths)
+	}
+
+	iter := s.fs.Collection("dojos").Doc(dojoID).Collection("payments").
+		Where("createdAt", ">=", start).
+		Where("createdAt", "<", end).
+		OrderBy("createdAt", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	rows := []JournalRow{}
+	months := []JournalMonth{}
+	monthIndex := map[string]int{} // month and currency -> months index
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list payments: %w", err)
+		}
+		var p Payment
+		if err := doc.DataTo(&p); err != nil || p.Status != "succeeded" {
+			continue
+		}
+
+		row := JournalRow{
+			Month:         p.CreatedAt.UTC().Format("2006-01"),
+			Date:          p.CreatedAt.UTC(),
+			InvoiceNumber: p.InvoiceNumber,
+			Gross:         p.Amount,
+			Tax:           p.Tax,
+			Fee:           p.Fee,
+			Net:           p.Net,
+			Currency:      strings.ToLower(p.Currency),
+		}
+		if row.InvoiceNumber == "" {
+			row.InvoiceNumber = p.InvoiceID
+		}
+		rows = append(rows, row)
+
+		key := row.Month + " " + row.Currency
+		i, ok := monthIndex[key]
+		if !ok {
+			i = len(months)
+			monthIndex[key] = i
+			months = append(months, JournalMonth{Month: row.Month, Currency: row.Currency})
+		}
+		m := &months[i]
+		m.Payments++
+		m.Gross += row.Gross
+		m.Tax += row.Tax
+		m.Net += row.Gross
+		if row.Fee != nil {
+			m.Fee += *row.Fee
+			m.Net -= *row.Fee
+		}
+	}
+	return rows, months, nil
+}
+
+var JournalCSVHeader = []string{
+	"Month", "Date", "Invoice Number", "Gross", "Tax", "Stripe Fee", "Net", "Currency",
+}
+
+// WriteJournalCSV writes rows with amounts in major units ("49.00"), as
+// bookkeeping tools import them
+func WriteJournalCSV(w io.Writer, rows []JournalRow) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(JournalCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		fee, net := "", ""
+		if r.Fee != nil {
+			fee = decimalAmount(*r.Fee, r.Currency)
+		}
+		if r.Net != nil {
+			net = decimalAmount(*r.Net, r.Currency)
+		}
+		if err := cw.Write([]string{
+			r.Month,
+			r.Date.Format("2006-01-02"),
+			r.InvoiceNumber,
+			decimalAmount(r.Gross, r.Currency),
+			decimalAmount(r.Tax, r.Currency),
+			fee,
+			net,
+			strings.ToUpper(r.Currency),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// invoiceFee reads Stripe's fee on an invoice's charge from its balance
+// transaction. It is left unknown when the charge cannot be read or settled
+// in another currency than the invoice's.
+func invoiceFee(invoice *stripe.Invoice) (fee, net *int64) {
+	if invoice.Charge == nil || invoice.Charge.ID == "" {
+		return nil, nil
+	}
+	params := &stripe.ChargeParams{}
+	params.AddExpand("balance_transaction")
+	ch, err := charge.Get(invoice.Charge.ID, params)
+	if err != nil {
+		log.Printf("webhook: failed to read fee of charge %s: %v", invoice.Charge.ID, err)
+		return nil, nil
+	}
+	bt := ch.BalanceTransaction
+	if bt == nil || !strings.EqualFold(string(bt.Currency), string(invoice.Currency)) {
+		return nil, nil
+	}
+	n := invoice.AmountPaid - bt.Fee
+	return &bt.Fee, &n
+}
@@ -0,0 +1,83 @@
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"dojo-manager/backend/internal/planlimit"
+)
+
+// Service is the plan limiter of session, members and notifications
+var _ planlimit.PlanLimiter = (*Service)(nil)
+
+// planOrder ranks the plans from smallest to largest
+var planOrder = []string{PlanFree, PlanPro, PlanBusiness}
+
+// LimitError is a plan limit the dojo ran into. It wraps ErrLimitReached and
+// carries what the app needs to offer an upgrade instead of a raw message.
+type LimitError struct {
+	Resource      string     `json:"resource"` // member, staff, announcement, class, bulkSend
+	Current       int        `json:"current"`
+	Limit         int        `json:"limit"`
+	Plan          string     `json:"plan"`
+	SuggestedPlan string     `json:"suggestedPlan,omitempty"` // smallest plan with room; "" if none
+	UpgradeURL    string     `json:"upgradeUrl,omitempty"`
+	ResetsAt      *time.Time `json:"resetsAt,omitempty"` // rolling quotas: when room frees up without upgrading
+
+	msg string
+}
+
+func (e *LimitError) Error() string { return ErrLimitReached.Error() + ": " + e.msg }
+func (e *LimitError) Unwrap() error { return ErrLimitReached }
+
+// AsLimitError returns the LimitError in err's chain
+func AsLimitError(err error) (*LimitError, bool) {
+	var le *LimitError
+	ok := errors.As(err, &le)
+	return le, ok
+}
+
+// limitOf returns the limit of resource in limits, -1 for unlimited or
+// unknown resources
+func limitOf(limits PlanLimits, resource string) int {
+	switch resource {
+	case "member":
+		return limits.Members
+	case "staff":
+		return limits.Staff
+	case "announcement":
+		return limits.Announcements
+	case "class":
+		return limits.Classes
+	case "bulkSend":
+		return limits.BulkSendsPerWeek
+	default:
+		return -1
+	}
+}
+
+// newLimitError builds the error for a dojo on plan at current/limit of
+// resource, suggesting the smallest larger plan with room for one more
+func (s *Service) newLimitError(ctx context.Context, dojoID, plan, resource string, current, limit int, msg string) *LimitError {
+	e := &LimitError{Resource: resource, Current: current, Limit: limit, Plan: plan, msg: msg}
+	start := max(slices.Index(planOrder, plan), 0) + 1 // unknown plans are past free
+	for _, p := range planOrder[start:] {
+		if l := limitOf(s.PlanLimitsFor(ctx, p, ""), resource); l == -1 || l > current {
+			e.SuggestedPlan = p
+			e.UpgradeURL = s.CheckoutLink(dojoID, p)
+			break
+		}
+	}
+	return e
+}
+
+// CheckoutLink is the app page that starts a checkout of plan for the dojo.
+// It is absolute when AppURL is configured, otherwise a path in the web app.
+func (s *Service) CheckoutLink(dojoID, plan string) string {
+	q := url.Values{"plan": {plan}, "period": {"monthly"}}
+	return fmt.Sprintf("%s/dojos/%s/settings/billing/checkout?%s", s.config.AppURL, url.PathEscape(dojoID), q.Encode())
+}
@@ -18,9 +18,16 @@ type PlanLimits struct {
 	Staff         int
 	Announcements int
 	Classes       int
+
+	// BulkSendsPerWeek caps bulk announcement sends in a rolling 7-day window
+	BulkSendsPerWeek int
+
+	// MediaStorageMB caps gallery photo storage
+	MediaStorageMB int
 }
 
-// GetPlanLimits returns the limits for a given plan
+// GetPlanLimits returns the compiled default limits for a given plan.
+// Runtime limits come from planConfigs (see PlanLimitsFor); these are the fallback.
 func GetPlanLimits(plan string) PlanLimits {
 	switch plan {
 	case PlanPro:
@@ -29,6 +36,9 @@ func GetPlanLimits(plan string) PlanLimits {
 			Staff:         10,
 			Announcements: 20,
 			Classes:       30,
+
+			BulkSendsPerWeek: 20,
+			MediaStorageMB:   10 * 1024,
 		}
 	case PlanBusiness:
 		return PlanLimits{
@@ -36,6 +46,9 @@ func GetPlanLimits(plan string) PlanLimits {
 			Staff:         -1,
 			Announcements: -1,
 			Classes:       -1,
+
+			BulkSendsPerWeek: -1,
+			MediaStorageMB:   -1,
 		}
 	default: // free
 		return PlanLimits{
@@ -43,6 +56,9 @@ func GetPlanLimits(plan string) PlanLimits {
 			Staff:         2,
 			Announcements: 3,
 			Classes:       5,
+
+			BulkSendsPerWeek: 3,
+			MediaStorageMB:   500,
 		}
 	}
 }
@@ -59,6 +75,17 @@ type UsageInfo struct {
 	Staff         ResourceUsage `json:"staff"`
 	Announcements ResourceUsage `json:"announcements"`
 	Classes       ResourceUsage `json:"classes"`
+
+	// BulkSends is the rolling weekly announcement send quota
+	BulkSends RateUsage `json:"bulkSends"`
+}
+
+// RateUsage is usage of a rolling-window quota
+type RateUsage struct {
+	Current    int        `json:"current"`
+	Limit      int        `json:"limit"` // -1 = unlimited
+	WindowDays int        `json:"windowDays"`
+	ResetsAt   *time.Time `json:"resetsAt,omitempty"` // when the oldest counted send leaves the window
 }
 
 // SubscriptionInfo contains subscription details
@@ -68,6 +95,10 @@ type SubscriptionInfo struct {
 	PeriodEnd         *time.Time `json:"periodEnd,omitempty"`
 	CancelAtPeriodEnd bool       `json:"cancelAtPeriodEnd"`
 	Usage             UsageInfo  `json:"usage"`
+
+	// CardExpiry is set while the card paying for the plan is about to
+	// expire (see card_expiry.go)
+	CardExpiry *CardExpiry `json:"cardExpiry,omitempty"`
 }
 
 // CreateCheckoutInput is the input for creating a checkout session
@@ -91,11 +122,13 @@ func (i *CreateCheckoutInput) Trim() {
 type CreatePortalInput struct {
 	DojoID    string `json:"dojoId"`
 	ReturnURL string `json:"returnUrl"`
+	Flow      string `json:"flow,omitempty"` // "payment_method_update" opens the card update page
 }
 
 func (i *CreatePortalInput) Trim() {
 	i.DojoID = strings.TrimSpace(i.DojoID)
 	i.ReturnURL = strings.TrimSpace(i.ReturnURL)
+	i.Flow = strings.TrimSpace(i.Flow)
 }
 
 // DojoSubscription represents the subscription data stored in Firestore
@@ -112,8 +145,12 @@ type DojoSubscription struct {
 type Payment struct {
 	ID             string    `firestore:"-" json:"id"`
 	InvoiceID      string    `firestore:"invoiceId" json:"invoiceId"`
+	InvoiceNumber  string    `firestore:"invoiceNumber,omitempty" json:"invoiceNumber,omitempty"`
 	SubscriptionID string    `firestore:"subscriptionId" json:"subscriptionId"`
 	Amount         int64     `firestore:"amount" json:"amount"`
+	Tax            int64     `firestore:"tax,omitempty" json:"tax,omitempty"` // included in amount
+	Fee            *int64    `firestore:"fee,omitempty" json:"fee,omitempty"` // Stripe's fee, when its balance transaction could be read
+	Net            *int64    `firestore:"net,omitempty" json:"net,omitempty"` // amount less the fee
 	Currency       string    `firestore:"currency" json:"currency"`
 	Status         string    `firestore:"status" json:"status"`
 	InvoiceURL     string    `firestore:"invoiceUrl,omitempty" json:"invoiceUrl,omitempty"`
@@ -0,0 +1,101 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/stripe/stripe-go/v76"
+	checkoutsession "github.com/stripe/stripe-go/v76/checkout/session"
+)
+
+// MetadataKind routes a one-time payment checkout to its PaymentHandler
+const MetadataKind = "kind"
+
+// PaymentHandler fulfils a paid one-time checkout. It must be idempotent:
+// Stripe retries webhooks, so the same session can be delivered twice.
+type PaymentHandler func(ctx context.Context, checkoutSessionID string, metadata map[string]string) error
+
+// PaymentCheckoutInput describes a one-time (mode=payment) checkout
+type PaymentCheckoutInput struct {
+	Kind          string // handler key, stored as metadata["kind"]
+	Name          string // line item name shown on the Stripe page
+	AmountCents   int64
+	Currency      string
+	CustomerEmail string
+	SuccessURL    string
+	CancelURL     string
+	Metadata      map[string]string
+}
+
+// SetPaymentHandler registers the fulfilment handler for a checkout kind
+func (s *Service) SetPaymentHandler(kind string, h PaymentHandler) {
+	if s.paymentHandlers == nil {
+		s.paymentHandlers = map[string]PaymentHandler{}
+	}
+	s.paymentHandlers[kind] = h
+}
+
+// CreatePaymentCheckout creates a one-time payment checkout session and returns its URL
+func (s *Service) CreatePaymentCheckout(ctx context.Context, in PaymentCheckoutInput) (string, error) {
+	if in.Kind == "" || in.Name == "" || in.AmountCents <= 0 {
+		return "", fmt.Errorf("%w: kind, name and a positive amount are required", ErrBadRequest)
+	}
+	if in.SuccessURL == "" || in.CancelURL == "" {
+		return "", fmt.Errorf("%w: successUrl and cancelUrl are required", ErrBadRequest)
+	}
+
+	metadata := map[string]string{}
+	for k, v := range in.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataKind] = in.Kind
+	currency, taxRates := s.checkoutBilling(ctx, in.Currency, metadata)
+
+	params := &stripe.CheckoutSessionParams{
+		Mode: stripe.String(string(stripe.CheckoutSessionModePayment)),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency:   stripe.String(currency),
+					UnitAmount: stripe.Int64(in.AmountCents),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name: stripe.String(in.Name),
+					},
+				},
+				TaxRates: taxRates,
+				Quantity: stripe.Int64(1),
+			},
+		},
+		SuccessURL: stripe.String(in.SuccessURL),
+		CancelURL:  stripe.String(in.CancelURL),
+		Metadata:   metadata,
+		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{
+			Metadata: metadata,
+		},
+	}
+	if in.CustomerEmail != "" {
+		params.CustomerEmail = stripe.String(in.CustomerEmail)
+	}
+
+	session, err := checkoutsession.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checkout session: %w", err)
+	}
+	return session.URL, nil
+}
+
+// handlePaymentCompleted dispatches a paid one-time checkout to its handler
+func (s *Service) handlePaymentCompleted(ctx context.Context, session *stripe.CheckoutSession) error {
+	if session.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		log.Printf("webhook: payment checkout %s not paid (status=%s), skipping", session.ID, session.PaymentStatus)
+		return nil
+	}
+	kind := session.Metadata[MetadataKind]
+	h, ok := s.paymentHandlers[kind]
+	if !ok {
+		return fmt.Errorf("no payment handler for kind %q", kind)
+	}
+	log.Printf("webhook: payment checkout completed kind=%s session=%s", kind, session.ID)
+	return h(ctx, session.ID, session.Metadata)
+}
@@ -0,0 +1,156 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// planConfigCacheTTL is how long a planConfigs document is trusted before re-reading
+const planConfigCacheTTL = 5 * time.Minute
+
+// PlanConfig is a planConfigs/{id} document.
+// Doc id is the plan name ("free", "pro", "business") or a custom id that a dojo
+// references via its planConfigId field (experiments / grandfathered limits).
+// Missing fields fall back to the compiled defaults of GetPlanLimits.
+type PlanConfig struct {
+	Plan          string `firestore:"plan,omitempty"`
+	Members       *int   `firestore:"members,omitempty"`
+	Staff         *int   `firestore:"staff,omitempty"`
+	Announcements *int   `firestore:"announcements,omitempty"`
+	Classes       *int   `firestore:"classes,omitempty"`
+
+	BulkSendsPerWeek *int `firestore:"bulkSendsPerWeek,omitempty"`
+	MediaStorageMB   *int `firestore:"mediaStorageMb,omitempty"`
+}
+
+// apply overlays configured values on top of the fallback limits
+func (c PlanConfig) apply(base PlanLimits) PlanLimits {
+	if c.Members != nil {
+		base.Members = *c.Members
+	}
+	if c.Staff != nil {
+		base.Staff = *c.Staff
+	}
+	if c.Announcements != nil {
+		base.Announcements = *c.Announcements
+	}
+	if c.Classes != nil {
+		base.Classes = *c.Classes
+	}
+	if c.BulkSendsPerWeek != nil {
+		base.BulkSendsPerWeek = *c.BulkSendsPerWeek
+	}
+	if c.MediaStorageMB != nil {
+		base.MediaStorageMB = *c.MediaStorageMB
+	}
+	return base
+}
+
+type planConfigEntry struct {
+	limits    PlanLimits
+	fetchedAt time.Time
+}
+
+type planConfigCache struct {
+	mu      sync.RWMutex
+	entries map[string]planConfigEntry
+}
+
+func newPlanConfigCache() *planConfigCache {
+	return &planConfigCache{entries: make(map[string]planConfigEntry)}
+}
+
+func (c *planConfigCache) get(key string, now time.Time) (PlanLimits, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[key]
+	if !ok || now.Sub(e.fetchedAt) > planConfigCacheTTL {
+		return PlanLimits{}, false
+	}
+	return e.limits, true
+}
+
+func (c *planConfigCache) put(key string, limits PlanLimits, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = planConfigEntry{limits: limits, fetchedAt: now}
+}
+
+// InvalidatePlanConfigs drops cached plan configs (e.g. after editing planConfigs)
+func (s *Service) InvalidatePlanConfigs() {
+	s.planCache.mu.Lock()
+	defer s.planCache.mu.Unlock()
+	s.planCache.entries = make(map[string]planConfigEntry)
+}
+
+// PlanLimitsFor resolves limits for a plan, preferring planConfigs/{configID}
+// (if set) over planConfigs/{plan}, and either over the compiled defaults of
+// GetPlanLimits. A config id without a doc falls through to the plan's doc.
+// Only reads that succeeded or found no doc are cached.
+func (s *Service) PlanLimitsFor(ctx context.Context, plan, configID string) PlanLimits {
+	if plan == "" {
+		plan = PlanFree
+	}
+	key := plan + "/" + configID
+
+	now := time.Now()
+	if limits, ok := s.planCache.get(key, now); ok {
+		return limits
+	}
+
+	limits := GetPlanLimits(plan)
+	docIDs := []string{plan}
+	if configID != "" {
+		docIDs = []string{configID, plan}
+	}
+	for _, docID := range docIDs {
+		cfg, found, err := s.planConfig(ctx, docID)
+		if err != nil {
+			log.Printf("planConfigs/%s: %v, using defaults", docID, err)
+			return limits
+		}
+		if !found {
+			continue
+		}
+		// custom config ids may pin a different base plan
+		if docID == configID && cfg.Plan != "" {
+			limits = GetPlanLimits(cfg.Plan)
+		}
+		limits = cfg.apply(limits)
+		break
+	}
+
+	// cache missing docs too so they don't cost a read per request
+	s.planCache.put(key, limits, now)
+	return limits
+}
+
+// planConfig reads planConfigs/{docID}; found is false when there is no doc
+func (s *Service) planConfig(ctx context.Context, docID string) (cfg PlanConfig, found bool, err error) {
+	doc, err := s.fs.Collection("planConfigs").Doc(docID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return cfg, false, nil
+	}
+	if err != nil {
+		return cfg, false, fmt.Errorf("read failed: %w", err)
+	}
+	if err := doc.DataTo(&cfg); err != nil {
+		return cfg, false, fmt.Errorf("decode failed: %w", err)
+	}
+	return cfg, true, nil
+}
+
+// dojoPlanLimits resolves the plan name and limits for a dojo document
+func (s *Service) dojoPlanLimits(ctx context.Context, st dojoPlanState) (string, PlanLimits) {
+	plan := st.Plan
+	if plan == "" {
+		plan = PlanFree
+	}
+	return plan, s.PlanLimitsFor(ctx, plan, st.PlanConfigID)
+}
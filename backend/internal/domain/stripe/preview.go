@@ -0,0 +1,99 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PlanImpact is one resource measured against a target plan's limit
+type PlanImpact struct {
+	Resource string `json:"resource"` // member, staff, announcement, class, bulkSend, mediaStorageMB
+	Current  int    `json:"current"`
+	Limit    int    `json:"limit"` // -1 = unlimited
+	Over     int    `json:"over"`  // how far current exceeds the limit, 0 if within
+	// Restriction is what stops working on the target plan while over
+	Restriction string `json:"restriction,omitempty"`
+}
+
+// PlanPreview is what a dojo would run into on another plan. Nothing is
+// removed on a downgrade; resources over a cap stay but block new ones.
+type PlanPreview struct {
+	DojoID       string       `json:"dojoId"`
+	CurrentPlan  string       `json:"currentPlan"`
+	TargetPlan   string       `json:"targetPlan"`
+	Resources    []PlanImpact `json:"resources"`
+	Restrictions []string     `json:"restrictions"` // Restriction of every resource over its cap
+	WithinLimits bool         `json:"withinLimits"`
+}
+
+// restrictions says what a resource over its cap blocks
+var restrictions = map[string]string{
+	"member":         "new members cannot be added or approved",
+	"staff":          "no more staff, coaches or owners can be assigned",
+	"announcement":   "new announcements cannot be published",
+	"class":          "new classes cannot be created",
+	"bulkSend":       "bulk announcement sends are paused until the weekly window frees up",
+	"mediaStorageMB": "gallery uploads are blocked until storage drops under the quota",
+}
+
+// PreviewPlan compares the dojo's current usage (the same counters as
+// GetSubscriptionInfo) with the default limits of plan
+func (s *Service) PreviewPlan(ctx context.Context, dojoID, plan string) (*PlanPreview, error) {
+	plan = strings.ToLower(strings.TrimSpace(plan))
+	if !slices.Contains(planOrder, plan) {
+		return nil, fmt.Errorf("%w: plan must be one of %s", ErrBadRequest, strings.Join(planOrder, ", "))
+	}
+	dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	current, _ := s.dojoPlanLimits(ctx, readPlanState(dojoDoc))
+	target := s.PlanLimitsFor(ctx, plan, "")
+
+	memberCount, _ := s.countMembers(ctx, dojoID)
+	staffCount, _ := s.countStaff(ctx, dojoID)
+	announcementCount, _ := s.countAnnouncements(ctx, dojoID)
+	classCount, _ := s.countClasses(ctx, dojoID)
+	bulkSends := s.bulkSendUsage(ctx, dojoID, target.BulkSendsPerWeek)
+
+	out := &PlanPreview{
+		DojoID:       dojoID,
+		CurrentPlan:  current,
+		TargetPlan:   plan,
+		Restrictions: []string{},
+	}
+	add := func(resource string, current, limit int) {
+		impact := PlanImpact{Resource: resource, Current: current, Limit: limit}
+		if limit != -1 && current > limit {
+			impact.Over = current - limit
+			impact.Restriction = restrictions[resource]
+			out.Restrictions = append(out.Restrictions, impact.Restriction)
+		}
+		out.Resources = append(out.Resources, impact)
+	}
+	add("member", memberCount, target.Members)
+	add("staff", staffCount, target.Staff)
+	add("announcement", announcementCount, target.Announcements)
+	add("class", classCount, target.Classes)
+	add("bulkSend", bulkSends.Current, target.BulkSendsPerWeek)
+	add("mediaStorageMB", s.mediaStorageMB(ctx, dojoID), target.MediaStorageMB)
+	out.WithinLimits = len(out.Restrictions) == 0
+	return out, nil
+}
+
+// mediaStorageMB reads the gallery storage counter (dojos/{dojoId}/settings/mediaUsage,
+// kept by the media package), rounded up to whole MB
+func (s *Service) mediaStorageMB(ctx context.Context, dojoID string) int {
+	doc, err := s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("mediaUsage").Get(ctx)
+	if err != nil || !doc.Exists() {
+		return 0
+	}
+	v, err := doc.DataAt("bytes")
+	if err != nil {
+		return 0
+	}
+	bytes, _ := v.(int64)
+	return int((bytes + 1<<20 - 1) >> 20)
+}
@@ -0,0 +1,293 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/subscription"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/fsdoc"
+)
+
+// Reconciliation catches dojo plan state that drifted from Stripe because a
+// webhook was missed or dead-lettered. Stripe is the source of truth: every
+// live plan subscription is compared with its dojo doc, and every dojo that
+// still claims a live subscription is checked against Stripe.
+
+// Discrepancy kinds
+const (
+	DriftMismatch     = "mismatch"      // dojo fields differ from the Stripe subscription
+	DriftEnded        = "ended"         // dojo has a live subscription that Stripe has ended
+	DriftOrphan       = "orphan"        // Stripe subscription with no matching dojo
+	DriftLookupFailed = "lookup_failed" // the subscription could not be fetched from Stripe
+)
+
+// liveStatuses are subscription statuses that keep a dojo on a paid plan
+var liveStatuses = []string{"active", "trialing", "past_due", "unpaid", "incomplete"}
+
+// Discrepancy is one difference found by ReconcileSubscriptions
+type Discrepancy struct {
+	Kind           string   `firestore:"kind" json:"kind"`
+	DojoID         string   `firestore:"dojoId,omitempty" json:"dojoId,omitempty"`
+	SubscriptionID string   `firestore:"subscriptionId" json:"subscriptionId"`
+	Fields         []string `firestore:"fields,omitempty" json:"fields,omitempty"` // for mismatch
+	Detail         string   `firestore:"detail,omitempty" json:"detail,omitempty"`
+	Fixed          bool     `firestore:"fixed" json:"fixed"`
+}
+
+// ReconcileResult is the report of one run, also kept at stripeReconciliations/{id}
+type ReconcileResult struct {
+	ID                   string        `firestore:"-" json:"id,omitempty"`
+	DryRun               bool          `firestore:"dryRun" json:"dryRun"`
+	SubscriptionsChecked int           `firestore:"subscriptionsChecked" json:"subscriptionsChecked"`
+	DojosChecked         int           `firestore:"dojosChecked" json:"dojosChecked"`
+	Fixed                int           `firestore:"fixed" json:"fixed"`
+	Discrepancies        []Discrepancy `firestore:"discrepancies" json:"discrepancies"`
+	StartedAt            time.Time     `firestore:"startedAt" json:"startedAt"`
+	FinishedAt           time.Time     `firestore:"finishedAt" json:"finishedAt"`
+}
+
+// dojoPlanState is the subset of a dojo doc mirrored from its plan subscription
+type dojoPlanState struct {
+	SubscriptionID    string    `firestore:"subscriptionId"`
+	Status            string    `firestore:"subscriptionStatus"`
+	PriceID           string    `firestore:"subscriptionPriceId"`
+	Plan              string    `firestore:"plan"`
+	PeriodEnd         time.Time `firestore:"planPeriodEnd"`
+	CancelAtPeriodEnd bool      `firestore:"cancelAtPeriodEnd"`
+
+	// PlanConfigID pins the dojo to a custom plan config (see plan_config.go)
+	PlanConfigID string `firestore:"planConfigId"`
+
+	// CardExpiry is not mirrored from the subscription; see card_expiry.go
+	CardExpiry *CardExpiry `firestore:"cardExpiry"`
+}
+
+// readPlanState decodes the plan fields of a dojo doc. A malformed doc reads
+// as the zero state (logged and counted by fsdoc), which reconcile reports
+// as drift.
+func readPlanState(doc *firestore.DocumentSnapshot) dojoPlanState {
+	st, _ := fsdoc.As[dojoPlanState](doc)
+	return st
+}
+
+func (s *Service) planStateFor(sub *stripe.Subscription) dojoPlanState {
+	priceID := ""
+	if sub.Items != nil && len(sub.Items.Data) > 0 && sub.Items.Data[0].Price != nil {
+		priceID = sub.Items.Data[0].Price.ID
+	}
+	return dojoPlanState{
+		SubscriptionID:    sub.ID,
+		Status:            string(sub.Status),
+		PriceID:           priceID,
+		Plan:              s.GetPlanFromPriceID(priceID),
+		PeriodEnd:         time.Unix(sub.CurrentPeriodEnd, 0).UTC(),
+		CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+	}
+}
+
+// diffPlanState lists the dojo fields that differ from want
+func diffPlanState(have, want dojoPlanState) []string {
+	var fields []string
+	if have.SubscriptionID != want.SubscriptionID {
+		fields = append(fields, "subscriptionId")
+	}
+	if have.Status != want.Status {
+		fields = append(fields, "subscriptionStatus")
+	}
+	if have.PriceID != want.PriceID {
+		fields = append(fields, "subscriptionPriceId")
+	}
+	if have.Plan != want.Plan {
+		fields = append(fields, "plan")
+	}
+	if !have.PeriodEnd.Equal(want.PeriodEnd) {
+		fields = append(fields, "planPeriodEnd")
+	}
+	if have.CancelAtPeriodEnd != want.CancelAtPeriodEnd {
+		fields = append(fields, "cancelAtPeriodEnd")
+	}
+	return fields
+}
+
+// ReconcileSubscriptions compares Stripe with the dojo docs and, unless
+// dryRun, fixes what drifted. Meant to run nightly from Cloud Scheduler.
+func (s *Service) ReconcileSubscriptions(ctx context.Context, dryRun bool) (*ReconcileResult, error) {
+	res := &ReconcileResult{DryRun: dryRun, Discrepancies: []Discrepancy{}, StartedAt: time.Now().UTC()}
+
+	// 1. Every non-canceled plan subscription in Stripe
+	seen := map[string]bool{}
+	params := &stripe.SubscriptionListParams{}
+	params.Filters.AddFilter("limit", "", "100")
+	it := subscription.List(params)
+	for it.Next() {
+		sub := it.Subscription()
+		if sub.Metadata[MetadataKind] != "" {
+			continue // member-facing subscription, not a dojo plan
+		}
+		res.SubscriptionsChecked++
+		seen[sub.ID] = true
+
+		dojoID := sub.Metadata["dojoId"]
+		if dojoID == "" {
+			dojoID = s.findDojoBySubscription(ctx, sub.ID)
+		}
+		if dojoID == "" && sub.Customer != nil {
+			dojoID = s.findDojoByCustomer(ctx, sub.Customer.ID)
+		}
+		if dojoID == "" {
+			res.Discrepancies = append(res.Discrepancies, Discrepancy{
+				Kind:           DriftOrphan,
+				SubscriptionID: sub.ID,
+				Detail:         "no dojo matches this subscription",
+			})
+			continue
+		}
+		s.reconcileLive(ctx, res, dojoID, sub)
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list stripe subscriptions: %w", err)
+	}
+
+	// 2. Dojos that still think they have a live subscription Stripe did not list
+	iter := s.fs.Collection("dojos").Where("subscriptionStatus", "in", liveStatuses).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list subscribed dojos: %w", err)
+		}
+		res.DojosChecked++
+
+		have := readPlanState(doc)
+		if have.SubscriptionID == "" || seen[have.SubscriptionID] {
+			continue
+		}
+		seen[have.SubscriptionID] = true
+
+		sub, err := subscription.Get(have.SubscriptionID, nil)
+		if err != nil {
+			if se, ok := err.(*stripe.Error); !ok || se.HTTPStatusCode != 404 {
+				res.Discrepancies = append(res.Discrepancies, Discrepancy{
+					Kind:           DriftLookupFailed,
+					DojoID:         doc.Ref.ID,
+					SubscriptionID: have.SubscriptionID,
+					Detail:         err.Error(),
+				})
+				continue
+			}
+			sub = nil // deleted in Stripe
+		}
+		if sub != nil && sub.Status != stripe.SubscriptionStatusCanceled && sub.Status != stripe.SubscriptionStatusIncompleteExpired {
+			s.reconcileLive(ctx, res, doc.Ref.ID, sub)
+			continue
+		}
+		s.reconcileEnded(ctx, res, doc.Ref.ID, have.SubscriptionID)
+	}
+
+	res.FinishedAt = time.Now().UTC()
+	ref := s.fs.Collection("stripeReconciliations").NewDoc()
+	if _, err := ref.Set(ctx, res); err != nil {
+		log.Printf("reconcile: failed to save report: %v", err)
+	} else {
+		res.ID = ref.ID
+	}
+	log.Printf("reconcile: checked %d subscriptions, %d dojos; %d discrepancies, %d fixed (dryRun=%v)",
+		res.SubscriptionsChecked, res.DojosChecked, len(res.Discrepancies), res.Fixed, dryRun)
+	return res, nil
+}
+
+// reconcileLive brings the dojo doc in line with a live Stripe subscription
+func (s *Service) reconcileLive(ctx context.Context, res *ReconcileResult, dojoID string, sub *stripe.Subscription) {
+	doc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		res.Discrepancies = append(res.Discrepancies, Discrepancy{
+			Kind:           DriftOrphan,
+			DojoID:         dojoID,
+			SubscriptionID: sub.ID,
+			Detail:         "dojo not found",
+		})
+		return
+	}
+
+	want := s.planStateFor(sub)
+	fields := diffPlanState(readPlanState(doc), want)
+	if len(fields) == 0 {
+		return
+	}
+	d := Discrepancy{Kind: DriftMismatch, DojoID: dojoID, SubscriptionID: sub.ID, Fields: fields}
+	if !res.DryRun {
+		_, err := doc.Ref.Update(ctx, []firestore.Update{
+			{Path: "subscriptionId", Value: want.SubscriptionID},
+			{Path: "subscriptionStatus", Value: want.Status},
+			{Path: "subscriptionPriceId", Value: want.PriceID},
+			{Path: "plan", Value: want.Plan},
+			{Path: "planPeriodEnd", Value: want.PeriodEnd},
+			{Path: "cancelAtPeriodEnd", Value: want.CancelAtPeriodEnd},
+			{Path: "updatedAt", Value: time.Now().UTC()},
+		})
+		if err != nil {
+			d.Detail = err.Error()
+		} else {
+			d.Fixed = true
+			res.Fixed++
+			// events from before the reconcile are older than what it wrote
+			if err := s.markSubscriptionEvent(ctx, sub.ID, time.Now().UTC()); err != nil {
+				log.Printf("reconcile: failed to record event time of subscription %s: %v", sub.ID, err)
+			}
+			s.recordSubscriptionEvent(ctx, dojoID, SubscriptionEvent{
+				Type:              SubscriptionEventReconciled,
+				SubscriptionID:    sub.ID,
+				Status:            want.Status,
+				Plan:              want.Plan,
+				PriceID:           want.PriceID,
+				PeriodEnd:         want.PeriodEnd,
+				CancelAtPeriodEnd: want.CancelAtPeriodEnd,
+				CreatedAt:         time.Now().UTC(),
+			})
+		}
+	}
+	res.Discrepancies = append(res.Discrepancies, d)
+}
+
+// reconcileEnded resets a dojo whose subscription no longer exists in Stripe,
+// the same way a customer.subscription.deleted webhook would
+func (s *Service) reconcileEnded(ctx context.Context, res *ReconcileResult, dojoID, subscriptionID string) {
+	d := Discrepancy{Kind: DriftEnded, DojoID: dojoID, SubscriptionID: subscriptionID}
+	if !res.DryRun {
+		_, err := s.fs.Collection("dojos").Doc(dojoID).Update(ctx, []firestore.Update{
+			{Path: "subscriptionId", Value: nil},
+			{Path: "subscriptionStatus", Value: "canceled"},
+			{Path: "subscriptionPriceId", Value: nil},
+			{Path: "plan", Value: PlanFree},
+			{Path: "planPeriodEnd", Value: nil},
+			{Path: "cancelAtPeriodEnd", Value: false},
+			{Path: "updatedAt", Value: time.Now().UTC()},
+		})
+		if err != nil {
+			d.Detail = err.Error()
+		} else {
+			d.Fixed = true
+			res.Fixed++
+			if err := s.markSubscriptionEvent(ctx, subscriptionID, time.Now().UTC()); err != nil {
+				log.Printf("reconcile: failed to record event time of subscription %s: %v", subscriptionID, err)
+			}
+			s.recordSubscriptionEvent(ctx, dojoID, SubscriptionEvent{
+				Type:           SubscriptionEventReconciled,
+				SubscriptionID: subscriptionID,
+				Status:         "canceled",
+				Plan:           PlanFree,
+				CreatedAt:      time.Now().UTC(),
+			})
+		}
+	}
+	res.Discrepancies = append(res.Discrepancies, d)
+}
@@ -0,0 +1,102 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// bulkSendWindow is the rolling window of the bulk announcement send quota
+const bulkSendWindow = 7 * 24 * time.Hour
+
+// sendQuota is dojos/{dojoId}/settings/announcementQuota.
+// SentAt keeps the timestamps of bulk sends still inside the window.
+type sendQuota struct {
+	SentAt    []time.Time `firestore:"sentAt"`
+	UpdatedAt time.Time   `firestore:"updatedAt"`
+}
+
+// inWindow drops sends older than the window (oldest first)
+func (q sendQuota) inWindow(now time.Time) []time.Time {
+	cutoff := now.Add(-bulkSendWindow)
+	out := make([]time.Time, 0, len(q.SentAt))
+	for _, t := range q.SentAt {
+		if t.After(cutoff) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (s *Service) sendQuotaRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("announcementQuota")
+}
+
+// ConsumeBulkSend records one bulk announcement send against the dojo's rolling
+// weekly quota, or returns a *LimitError with the time the next send frees up.
+func (s *Service) ConsumeBulkSend(ctx context.Context, dojoID string) error {
+	dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		log.Printf("ConsumeBulkSend: dojo not found %s, allowing", dojoID)
+		return nil
+	}
+	plan, limits := s.dojoPlanLimits(ctx, readPlanState(dojoDoc))
+	limit := limits.BulkSendsPerWeek
+	if limit == -1 {
+		return nil
+	}
+
+	ref := s.sendQuotaRef(dojoID)
+	return s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var q sendQuota
+		doc, err := tx.Get(ref)
+		if err == nil && doc.Exists() {
+			if err := doc.DataTo(&q); err != nil {
+				return fmt.Errorf("failed to decode send quota: %w", err)
+			}
+		} else if err != nil && doc == nil {
+			return fmt.Errorf("failed to read send quota: %w", err)
+		}
+
+		now := time.Now().UTC()
+		sent := q.inWindow(now)
+		if len(sent) >= limit {
+			resetAt := sent[len(sent)-limit].Add(bulkSendWindow)
+			le := s.newLimitError(ctx, dojoID, plan, "bulkSend", len(sent), limit,
+				fmt.Sprintf("announcement send limit reached (%d/%d per week). Next send available at %s. Upgrade your plan to send more.",
+					len(sent), limit, resetAt.Format(time.RFC3339)))
+			le.ResetsAt = &resetAt
+			return le
+		}
+
+		return tx.Set(ref, sendQuota{
+			SentAt:    append(sent, now),
+			UpdatedAt: now,
+		})
+	})
+}
+
+// bulkSendUsage reports the rolling weekly send quota for GetSubscriptionInfo
+func (s *Service) bulkSendUsage(ctx context.Context, dojoID string, limit int) RateUsage {
+	usage := RateUsage{Limit: limit, WindowDays: int(bulkSendWindow / (24 * time.Hour))}
+
+	doc, err := s.sendQuotaRef(dojoID).Get(ctx)
+	if err != nil || !doc.Exists() {
+		return usage
+	}
+	var q sendQuota
+	if err := doc.DataTo(&q); err != nil {
+		return usage
+	}
+
+	sent := q.inWindow(time.Now().UTC())
+	usage.Current = len(sent)
+	if len(sent) > 0 {
+		resetAt := sent[0].Add(bulkSendWindow)
+		usage.ResetsAt = &resetAt
+	}
+	return usage
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -13,7 +12,12 @@ import (
 	checkoutsession "github.com/stripe/stripe-go/v76/checkout/session"
 	"github.com/stripe/stripe-go/v76/customer"
 	"github.com/stripe/stripe-go/v76/subscription"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/events"
+	"dojo-manager/backend/internal/firebase"
+	"dojo-manager/backend/internal/fsdoc"
 )
 
 type Config struct {
@@ -23,27 +27,36 @@ type Config struct {
 	PriceProYearly        string
 	PriceBusinessMonthly  string
 	PriceBusinessYearly   string
-}
 
-func LoadConfig() Config {
-	return Config{
-		SecretKey:             os.Getenv("STRIPE_SECRET_KEY"),
-		WebhookSecret:         os.Getenv("STRIPE_WEBHOOK_SECRET"),
-		PriceProMonthly:       os.Getenv("STRIPE_PRICE_PRO_MONTHLY"),
-		PriceProYearly:        os.Getenv("STRIPE_PRICE_PRO_YEARLY"),
-		PriceBusinessMonthly:  os.Getenv("STRIPE_PRICE_BUSINESS_MONTHLY"),
-		PriceBusinessYearly:   os.Getenv("STRIPE_PRICE_BUSINESS_YEARLY"),
-	}
+	// AppURL is the web app's origin, for absolute upgrade links
+	AppURL string
 }
 
 type Service struct {
-	fs     *firestore.Client
-	config Config
+	fs        *firestore.Client
+	dbs       firebase.ClientResolver // per-dojo database of classes (data residency)
+	config    Config
+	planCache *planConfigCache
+
+	paymentHandlers      map[string]PaymentHandler      // one-time checkout fulfilment by metadata kind
+	subscriptionHandlers map[string]SubscriptionHandler // member-facing subscriptions by metadata kind
+	eventWake            chan struct{}                  // nudges the webhook event worker
+	bus                  *events.Bus                    // plan payment events (optional)
 }
 
 func NewService(fs *firestore.Client, cfg Config) *Service {
 	stripe.Key = cfg.SecretKey
-	return &Service{fs: fs, config: cfg}
+	return &Service{fs: fs, dbs: firebase.DefaultResolver{Client: fs}, config: cfg, planCache: newPlanConfigCache(), eventWake: make(chan struct{}, 1)}
+}
+
+// SetClientResolver counts each dojo's classes in its own database
+func (s *Service) SetClientResolver(resolver firebase.ClientResolver) {
+	s.dbs = resolver
+}
+
+// SetEventBus publishes PlanPaymentFailed
+func (s *Service) SetEventBus(bus *events.Bus) {
+	s.bus = bus
 }
 
 func (s *Service) CreateCheckoutSession(ctx context.Context, userUID string, input CreateCheckoutInput) (string, error) {
@@ -97,21 +110,7 @@ func (s *Service) CreateCheckoutSession(ctx context.Context, userUID string, inp
 		}
 	}
 
-	var priceID string
-	if input.Plan == "pro" {
-		if input.Period == "yearly" {
-			priceID = s.config.PriceProYearly
-		} else {
-			priceID = s.config.PriceProMonthly
-		}
-	} else {
-		if input.Period == "yearly" {
-			priceID = s.config.PriceBusinessYearly
-		} else {
-			priceID = s.config.PriceBusinessMonthly
-		}
-	}
-
+	priceID := s.priceFor(input.Plan, input.Period)
 	if priceID == "" {
 		return "", fmt.Errorf("%w: price not configured for %s %s", ErrBadRequest, input.Plan, input.Period)
 	}
@@ -153,6 +152,9 @@ func (s *Service) CreatePortalSession(ctx context.Context, userUID string, input
 	if input.DojoID == "" {
 		return "", fmt.Errorf("%w: dojoId is required", ErrBadRequest)
 	}
+	if input.Flow != "" && input.Flow != PortalFlowPaymentMethodUpdate {
+		return "", fmt.Errorf("%w: flow must be %s", ErrBadRequest, PortalFlowPaymentMethodUpdate)
+	}
 
 	dojoDoc, err := s.fs.Collection("dojos").Doc(input.DojoID).Get(ctx)
 	if err != nil {
@@ -170,6 +172,9 @@ func (s *Service) CreatePortalSession(ctx context.Context, userUID string, input
 		Customer:  stripe.String(stripeCustomerID),
 		ReturnURL: stripe.String(input.ReturnURL),
 	}
+	if input.Flow != "" {
+		params.FlowData = &stripe.BillingPortalSessionFlowDataParams{Type: stripe.String(input.Flow)}
+	}
 
 	session, err := portalsession.New(params)
 	if err != nil {
@@ -179,37 +184,57 @@ func (s *Service) CreatePortalSession(ctx context.Context, userUID string, input
 	return session.URL, nil
 }
 
+// maxParallelCounts bounds the usage counts GetSubscriptionInfo runs at once
+const maxParallelCounts = 4
+
 func (s *Service) GetSubscriptionInfo(ctx context.Context, dojoID string) (*SubscriptionInfo, error) {
 	dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
 	}
 
-	dojoData := dojoDoc.Data()
-
-	plan, _ := dojoData["plan"].(string)
-	if plan == "" {
-		plan = "free"
-	}
+	st := readPlanState(dojoDoc)
+	plan, limits := s.dojoPlanLimits(ctx, st)
 
-	status, _ := dojoData["subscriptionStatus"].(string)
+	status := st.Status
 	if status == "" {
 		status = "none"
 	}
 
 	var periodEnd *time.Time
-	if pe, ok := dojoData["planPeriodEnd"].(time.Time); ok {
-		periodEnd = &pe
+	if !st.PeriodEnd.IsZero() {
+		periodEnd = &st.PeriodEnd
 	}
 
-	cancelAtPeriodEnd, _ := dojoData["cancelAtPeriodEnd"].(bool)
-
-	memberCount, _ := s.countMembers(ctx, dojoID)
-	staffCount, _ := s.countStaff(ctx, dojoID)
-	announcementCount, _ := s.countAnnouncements(ctx, dojoID)
-	classCount, _ := s.countClasses(ctx, dojoID)
+	cancelAtPeriodEnd := st.CancelAtPeriodEnd
 
-	limits := GetPlanLimits(plan)
+	// the usage counts are independent scans; run them side by side. Each is
+	// best effort: one that fails shows as zero.
+	var memberCount, staffCount, announcementCount, classCount int
+	var bulkSends RateUsage
+	var g errgroup.Group
+	g.SetLimit(maxParallelCounts)
+	g.Go(func() error {
+		memberCount, _ = s.countMembers(ctx, dojoID)
+		return nil
+	})
+	g.Go(func() error {
+		staffCount, _ = s.countStaff(ctx, dojoID)
+		return nil
+	})
+	g.Go(func() error {
+		announcementCount, _ = s.countAnnouncements(ctx, dojoID)
+		return nil
+	})
+	g.Go(func() error {
+		classCount, _ = s.countClasses(ctx, dojoID)
+		return nil
+	})
+	g.Go(func() error {
+		bulkSends = s.bulkSendUsage(ctx, dojoID, limits.BulkSendsPerWeek)
+		return nil
+	})
+	_ = g.Wait()
 
 	return &SubscriptionInfo{
 		Plan:              plan,
@@ -233,7 +258,9 @@ func (s *Service) GetSubscriptionInfo(ctx context.Context, dojoID string) (*Subs
 				Current: classCount,
 				Limit:   limits.Classes,
 			},
+			BulkSends: bulkSends,
 		},
+		CardExpiry: st.CardExpiry,
 	}, nil
 }
 
@@ -269,6 +296,25 @@ func (s *Service) CancelSubscription(ctx context.Context, userUID, dojoID string
 	return nil
 }
 
+// CancelSubscriptionNow cancels a dojo's subscription immediately (no proration).
+// Used when a dojo is purged; a dojo without a subscription is a no-op.
+func (s *Service) CancelSubscriptionNow(ctx context.Context, dojoID string) error {
+	dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+
+	subscriptionID, _ := dojoDoc.Data()["subscriptionId"].(string)
+	if subscriptionID == "" {
+		return nil
+	}
+
+	if _, err := subscription.Cancel(subscriptionID, nil); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
 func (s *Service) ResumeSubscription(ctx context.Context, userUID, dojoID string) error {
 	dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
 	if err != nil {
@@ -301,6 +347,8 @@ func (s *Service) ResumeSubscription(ctx context.Context, userUID, dojoID string
 	return nil
 }
 
+// CheckPlanLimit returns a *LimitError when the dojo's plan has no room for
+// another resource (member, staff, announcement, class)
 func (s *Service) CheckPlanLimit(ctx context.Context, dojoID, resource string) error {
 	dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
 	if err != nil {
@@ -308,45 +356,63 @@ func (s *Service) CheckPlanLimit(ctx context.Context, dojoID, resource string) e
 		return nil
 	}
 
-	dojoData := dojoDoc.Data()
-	plan, _ := dojoData["plan"].(string)
-	if plan == "" {
-		plan = "free"
-	}
-
-	limits := GetPlanLimits(plan)
-	var limit int
+	plan, limits := s.dojoPlanLimits(ctx, readPlanState(dojoDoc))
 	var current int
 
 	switch resource {
 	case "member":
-		limit = limits.Members
 		current, _ = s.countMembers(ctx, dojoID)
 	case "staff":
-		limit = limits.Staff
 		current, _ = s.countStaff(ctx, dojoID)
 	case "announcement":
-		limit = limits.Announcements
 		current, _ = s.countAnnouncements(ctx, dojoID)
 	case "class":
-		limit = limits.Classes
 		current, _ = s.countClasses(ctx, dojoID)
 	default:
 		return nil
 	}
 
+	limit := limitOf(limits, resource)
 	if limit == -1 {
 		return nil
 	}
 
 	if current >= limit {
-		return fmt.Errorf("%w: %s limit reached (%d/%d). Upgrade your plan to add more.",
-			ErrLimitReached, resource, current, limit)
+		return s.newLimitError(ctx, dojoID, plan, resource, current, limit,
+			fmt.Sprintf("%s limit reached (%d/%d). Upgrade your plan to add more.", resource, current, limit))
 	}
 
 	return nil
 }
 
+// MediaStorageLimit returns the dojo's gallery storage quota in bytes, -1 if unlimited
+func (s *Service) MediaStorageLimit(ctx context.Context, dojoID string) int64 {
+	dojoDoc, err := s.fs.Collection("dojos").Doc(dojoID).Get(ctx)
+	if err != nil {
+		log.Printf("MediaStorageLimit: dojo not found %s, using free plan", dojoID)
+		return int64(GetPlanLimits(PlanFree).MediaStorageMB) << 20
+	}
+	_, limits := s.dojoPlanLimits(ctx, readPlanState(dojoDoc))
+	if limits.MediaStorageMB < 0 {
+		return -1
+	}
+	return int64(limits.MediaStorageMB) << 20
+}
+
+// priceFor returns the configured price ID for a paid plan and billing period
+func (s *Service) priceFor(plan, period string) string {
+	if plan == PlanPro {
+		if period == "yearly" {
+			return s.config.PriceProYearly
+		}
+		return s.config.PriceProMonthly
+	}
+	if period == "yearly" {
+		return s.config.PriceBusinessYearly
+	}
+	return s.config.PriceBusinessMonthly
+}
+
 func (s *Service) GetPlanFromPriceID(priceID string) string {
 	switch priceID {
 	case s.config.PriceProMonthly, s.config.PriceProYearly:
@@ -389,11 +455,9 @@ func (s *Service) countAnnouncements(ctx context.Context, dojoID string) (int, e
 			return 0, err
 		}
 
-		data := doc.Data()
-		if expireAt, ok := data["expireAt"].(time.Time); ok {
-			if expireAt.Before(now) {
-				continue
-			}
+		notice, err := fsdoc.As[fsdoc.Notice](doc)
+		if err != nil || notice.Expired(now) {
+			continue // malformed notices are logged and counted by fsdoc
 		}
 		count++
 	}
@@ -401,7 +465,11 @@ func (s *Service) countAnnouncements(ctx context.Context, dojoID string) (int, e
 }
 
 func (s *Service) countClasses(ctx context.Context, dojoID string) (int, error) {
-	iter := s.fs.Collection("dojos").Doc(dojoID).Collection("timetableClasses").
+	db, err := s.dbs.ClientFor(ctx, dojoID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve dojo database: %w", err)
+	}
+	iter := db.Collection("dojos").Doc(dojoID).Collection("timetableClasses").
 		Where("isActive", "==", true).
 		Documents(ctx)
 	return countDocs(iter)
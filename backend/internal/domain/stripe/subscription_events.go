@@ -0,0 +1,108 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Subscription event types recorded in dojos/{dojoId}/subscriptionEvents
+const (
+	SubscriptionEventCreated    = "subscription_created"
+	SubscriptionEventUpdated    = "subscription_updated"
+	SubscriptionEventDeleted    = "subscription_deleted"
+	SubscriptionEventReconciled = "subscription_reconciled"
+)
+
+var subscriptionEventTypes = map[string]bool{
+	SubscriptionEventCreated:    true,
+	SubscriptionEventUpdated:    true,
+	SubscriptionEventDeleted:    true,
+	SubscriptionEventReconciled: true,
+}
+
+const (
+	defaultSubscriptionEventsLimit = 50
+	maxSubscriptionEventsLimit     = 200
+)
+
+// ListSubscriptionEventsInput filters the billing history of a dojo
+type ListSubscriptionEventsInput struct {
+	Types  []string   // empty = all types
+	Before *time.Time // cursor: events strictly older than this
+	Limit  int
+}
+
+// SubscriptionEventsPage is one page of the billing history, newest first
+type SubscriptionEventsPage struct {
+	Events     []SubscriptionEvent `json:"events"`
+	NextCursor string              `json:"nextCursor,omitempty"` // RFC3339Nano, pass back as ?before=
+}
+
+// ListSubscriptionEvents pages through the plan changes recorded for a dojo
+// by the webhook and the reconciler. The router checks the caller owns the
+// dojo.
+func (s *Service) ListSubscriptionEvents(ctx context.Context, dojoID string, in ListSubscriptionEventsInput) (*SubscriptionEventsPage, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+
+	var types []string
+	for _, t := range in.Types {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !subscriptionEventTypes[t] {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrBadRequest, t)
+		}
+		types = append(types, t)
+	}
+
+	limit := in.Limit
+	if limit <= 0 {
+		limit = defaultSubscriptionEventsLimit
+	}
+	if limit > maxSubscriptionEventsLimit {
+		limit = maxSubscriptionEventsLimit
+	}
+
+	q := s.fs.Collection("dojos").Doc(dojoID).Collection("subscriptionEvents").Query
+	if len(types) > 0 {
+		q = q.Where("type", "in", types)
+	}
+	if in.Before != nil {
+		q = q.Where("createdAt", "<", *in.Before)
+	}
+	// one extra to know whether there is a next page
+	iter := q.OrderBy("createdAt", firestore.Desc).Limit(limit + 1).Documents(ctx)
+	defer iter.Stop()
+
+	page := &SubscriptionEventsPage{Events: []SubscriptionEvent{}}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list subscription events: %w", err)
+		}
+		var e SubscriptionEvent
+		if err := doc.DataTo(&e); err != nil {
+			continue
+		}
+		e.ID = doc.Ref.ID
+		page.Events = append(page.Events, e)
+	}
+
+	if len(page.Events) > limit {
+		page.Events = page.Events[:limit]
+		page.NextCursor = page.Events[limit-1].CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return page, nil
+}
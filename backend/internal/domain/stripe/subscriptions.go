@@ -0,0 +1,180 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	checkoutsession "github.com/stripe/stripe-go/v76/checkout/session"
+	"github.com/stripe/stripe-go/v76/subscription"
+)
+
+// Member-facing subscriptions (e.g. family memberships) live next to the dojo
+// plan subscription on the same Stripe account. They carry metadata["kind"]
+// so the webhook hands them to their SubscriptionHandler instead of treating
+// them as a plan change of the dojo.
+
+// SubscriptionUpdate is the state of a kinded subscription after a webhook
+type SubscriptionUpdate struct {
+	SubscriptionID    string
+	CustomerID        string
+	Status            string
+	Quantity          int64
+	CurrentPeriodEnd  time.Time
+	CancelAtPeriodEnd bool
+	Deleted           bool
+	Metadata          map[string]string
+}
+
+// SubscriptionHandler applies a kinded subscription update. Must be idempotent.
+type SubscriptionHandler func(ctx context.Context, update SubscriptionUpdate) error
+
+// SubscriptionCheckoutInput describes a recurring checkout billed per unit
+type SubscriptionCheckoutInput struct {
+	Kind          string
+	Name          string // product name shown on the Stripe page
+	AmountCents   int64  // per unit
+	Currency      string
+	Interval      string // month / year
+	Quantity      int64
+	CustomerEmail string
+	SuccessURL    string
+	CancelURL     string
+	Metadata      map[string]string
+}
+
+// SetSubscriptionHandler registers the handler for a subscription kind
+func (s *Service) SetSubscriptionHandler(kind string, h SubscriptionHandler) {
+	if s.subscriptionHandlers == nil {
+		s.subscriptionHandlers = map[string]SubscriptionHandler{}
+	}
+	s.subscriptionHandlers[kind] = h
+}
+
+// CreateSubscriptionCheckout creates a recurring checkout session and returns its URL
+func (s *Service) CreateSubscriptionCheckout(ctx context.Context, in SubscriptionCheckoutInput) (string, error) {
+	if in.Kind == "" || in.Name == "" || in.AmountCents <= 0 || in.Quantity <= 0 {
+		return "", fmt.Errorf("%w: kind, name, a positive amount and quantity are required", ErrBadRequest)
+	}
+	if in.Interval != "month" && in.Interval != "year" {
+		return "", fmt.Errorf("%w: interval must be 'month' or 'year'", ErrBadRequest)
+	}
+	if in.SuccessURL == "" || in.CancelURL == "" {
+		return "", fmt.Errorf("%w: successUrl and cancelUrl are required", ErrBadRequest)
+	}
+
+	metadata := map[string]string{}
+	for k, v := range in.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataKind] = in.Kind
+	currency, taxRates := s.checkoutBilling(ctx, in.Currency, metadata)
+
+	params := &stripe.CheckoutSessionParams{
+		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency:   stripe.String(currency),
+					UnitAmount: stripe.Int64(in.AmountCents),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name: stripe.String(in.Name),
+					},
+					Recurring: &stripe.CheckoutSessionLineItemPriceDataRecurringParams{
+						Interval: stripe.String(in.Interval),
+					},
+				},
+				TaxRates: taxRates,
+				Quantity: stripe.Int64(in.Quantity),
+			},
+		},
+		SuccessURL: stripe.String(in.SuccessURL),
+		CancelURL:  stripe.String(in.CancelURL),
+		Metadata:   metadata,
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: metadata,
+		},
+	}
+	if in.CustomerEmail != "" {
+		params.CustomerEmail = stripe.String(in.CustomerEmail)
+	}
+
+	session, err := checkoutsession.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checkout session: %w", err)
+	}
+	return session.URL, nil
+}
+
+// UpdateSubscriptionQuantity changes the unit count of a single-item
+// subscription, prorating the difference on the next invoice
+func (s *Service) UpdateSubscriptionQuantity(ctx context.Context, subscriptionID string, quantity int64) error {
+	if subscriptionID == "" || quantity <= 0 {
+		return fmt.Errorf("%w: subscriptionId and a positive quantity are required", ErrBadRequest)
+	}
+	sub, err := subscription.Get(subscriptionID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if sub.Items == nil || len(sub.Items.Data) == 0 {
+		return fmt.Errorf("subscription %s has no items", subscriptionID)
+	}
+	item := sub.Items.Data[0]
+	if item.Quantity == quantity {
+		return nil
+	}
+
+	_, err = subscription.Update(subscriptionID, &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:       stripe.String(item.ID),
+				Quantity: stripe.Int64(quantity),
+			},
+		},
+		ProrationBehavior: stripe.String("create_prorations"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update subscription quantity: %w", err)
+	}
+	return nil
+}
+
+// CancelSubscriptionByID cancels a member-facing subscription immediately
+func (s *Service) CancelSubscriptionByID(ctx context.Context, subscriptionID string) error {
+	if _, err := subscription.Cancel(subscriptionID, nil); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
+// dispatchSubscription hands a kinded subscription to its handler.
+// Returns false for dojo plan subscriptions (no kind).
+func (s *Service) dispatchSubscription(ctx context.Context, sub *stripe.Subscription, deleted bool) (bool, error) {
+	kind := sub.Metadata[MetadataKind]
+	if kind == "" {
+		return false, nil
+	}
+	h, ok := s.subscriptionHandlers[kind]
+	if !ok {
+		return true, fmt.Errorf("no subscription handler for kind %q", kind)
+	}
+
+	update := SubscriptionUpdate{
+		SubscriptionID:    sub.ID,
+		Status:            string(sub.Status),
+		CurrentPeriodEnd:  time.Unix(sub.CurrentPeriodEnd, 0).UTC(),
+		CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+		Deleted:           deleted,
+		Metadata:          sub.Metadata,
+	}
+	if sub.Customer != nil {
+		update.CustomerID = sub.Customer.ID
+	}
+	if sub.Items != nil && len(sub.Items.Data) > 0 {
+		update.Quantity = sub.Items.Data[0].Quantity
+	}
+	log.Printf("webhook: %s subscription %s status=%s deleted=%v", kind, sub.ID, sub.Status, deleted)
+	return true, h(ctx, update)
+}
@@ -0,0 +1,288 @@
+package stripe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/customer"
+	"github.com/stripe/stripe-go/v76/paymentmethod"
+	"github.com/stripe/stripe-go/v76/subscription"
+	"github.com/stripe/stripe-go/v76/testhelpers/testclock"
+)
+
+// Test clocks let staging exercise renewals, cancel-at-period-end and dunning
+// without waiting a billing cycle. Stripe only binds a customer to a clock at
+// creation, so attaching a dojo gives it a fresh clock customer and parks the
+// real one under stripeCustomerIdBeforeTestClock until the clock is deleted.
+// Everything here refuses to run with a live key.
+
+// TestClock is a Stripe test clock
+type TestClock struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	FrozenTime   time.Time `json:"frozenTime"`
+	Status       string    `json:"status"` // ready, advancing, internal_failure
+	DeletesAfter time.Time `json:"deletesAfter"`
+}
+
+// CreateTestClockInput is the body of POST /v1/admin/stripe/test-clocks
+type CreateTestClockInput struct {
+	Name       string     `json:"name"`
+	FrozenTime *time.Time `json:"frozenTime"` // default now
+}
+
+// AttachTestClockInput puts a dojo on a test clock, optionally subscribing it
+type AttachTestClockInput struct {
+	DojoID string `json:"dojoId"`
+	// PaymentMethod is a Stripe test method, e.g. pm_card_visa, or
+	// pm_card_chargeCustomerFail to exercise dunning on renewal
+	PaymentMethod string `json:"paymentMethod"`
+	Plan          string `json:"plan"`   // "pro" or "business"; empty = attach only
+	Period        string `json:"period"` // "monthly" or "yearly"
+}
+
+// AdvanceTestClockInput moves a clock forward to FrozenTime, or by Days
+type AdvanceTestClockInput struct {
+	FrozenTime *time.Time `json:"frozenTime"`
+	Days       int        `json:"days"`
+}
+
+// AttachTestClockResult is returned when a dojo is attached
+type AttachTestClockResult struct {
+	DojoID         string `json:"dojoId"`
+	CustomerID     string `json:"customerId"`
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+}
+
+func (s *Service) requireTestMode() error {
+	key := s.config.SecretKey
+	if strings.HasPrefix(key, "sk_test_") || strings.HasPrefix(key, "rk_test_") {
+		return nil
+	}
+	return fmt.Errorf("%w: test clocks are disabled in live mode", ErrTestModeOnly)
+}
+
+func toTestClock(c *stripe.TestHelpersTestClock) *TestClock {
+	return &TestClock{
+		ID:           c.ID,
+		Name:         c.Name,
+		FrozenTime:   time.Unix(c.FrozenTime, 0).UTC(),
+		Status:       string(c.Status),
+		DeletesAfter: time.Unix(c.DeletesAfter, 0).UTC(),
+	}
+}
+
+// CreateTestClock creates a clock frozen at the given time (admin, test mode)
+func (s *Service) CreateTestClock(ctx context.Context, in CreateTestClockInput) (*TestClock, error) {
+	if err := s.requireTestMode(); err != nil {
+		return nil, err
+	}
+	frozen := time.Now().UTC()
+	if in.FrozenTime != nil {
+		frozen = in.FrozenTime.UTC()
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		name = "staging " + frozen.Format("2006-01-02 15:04")
+	}
+
+	c, err := testclock.New(&stripe.TestHelpersTestClockParams{
+		Name:       stripe.String(name),
+		FrozenTime: stripe.Int64(frozen.Unix()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create test clock: %w", err)
+	}
+	return toTestClock(c), nil
+}
+
+// GetTestClock returns a clock's current time and status (admin, test mode)
+func (s *Service) GetTestClock(ctx context.Context, clockID string) (*TestClock, error) {
+	if err := s.requireTestMode(); err != nil {
+		return nil, err
+	}
+	c, err := testclock.Get(strings.TrimSpace(clockID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: test clock not found", ErrNotFound)
+	}
+	return toTestClock(c), nil
+}
+
+// AttachTestClock gives the dojo a new customer on the clock and, when a plan
+// is given, subscribes it directly so no checkout is needed (admin, test mode)
+func (s *Service) AttachTestClock(ctx context.Context, clockID string, in AttachTestClockInput) (*AttachTestClockResult, error) {
+	if err := s.requireTestMode(); err != nil {
+		return nil, err
+	}
+	clockID = strings.TrimSpace(clockID)
+	in.DojoID = strings.TrimSpace(in.DojoID)
+	in.Plan = strings.TrimSpace(in.Plan)
+	in.Period = strings.TrimSpace(in.Period)
+	if in.DojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	var priceID string
+	if in.Plan != "" {
+		if in.Plan != PlanPro && in.Plan != PlanBusiness {
+			return nil, fmt.Errorf("%w: plan must be 'pro' or 'business'", ErrBadRequest)
+		}
+		if in.Period == "" {
+			in.Period = "monthly"
+		}
+		if in.Period != "monthly" && in.Period != "yearly" {
+			return nil, fmt.Errorf("%w: period must be 'monthly' or 'yearly'", ErrBadRequest)
+		}
+		if priceID = s.priceFor(in.Plan, in.Period); priceID == "" {
+			return nil, fmt.Errorf("%w: price not configured for %s %s", ErrBadRequest, in.Plan, in.Period)
+		}
+	}
+	paymentMethod := strings.TrimSpace(in.PaymentMethod)
+	if paymentMethod == "" {
+		paymentMethod = "pm_card_visa"
+	}
+
+	dojoRef := s.fs.Collection("dojos").Doc(in.DojoID)
+	dojoDoc, err := dojoRef.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	dojoData := dojoDoc.Data()
+	if _, onClock := dojoData["stripeTestClockId"].(string); onClock {
+		return nil, fmt.Errorf("%w: dojo is already on a test clock", ErrBadRequest)
+	}
+	dojoName, _ := dojoData["name"].(string)
+	previousCustomer, _ := dojoData["stripeCustomerId"].(string)
+
+	c, err := customer.New(&stripe.CustomerParams{
+		Name:      stripe.String(dojoName + " (test clock)"),
+		TestClock: stripe.String(clockID),
+		Metadata: map[string]string{
+			"dojoId":    in.DojoID,
+			"testClock": clockID,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create test clock customer: %w", err)
+	}
+
+	pm, err := paymentmethod.Attach(paymentMethod, &stripe.PaymentMethodAttachParams{
+		Customer: stripe.String(c.ID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to attach payment method: %v", ErrBadRequest, err)
+	}
+	if _, err := customer.Update(c.ID, &stripe.CustomerParams{
+		InvoiceSettings: &stripe.CustomerInvoiceSettingsParams{
+			DefaultPaymentMethod: stripe.String(pm.ID),
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to set default payment method: %w", err)
+	}
+
+	_, err = dojoRef.Set(ctx, map[string]interface{}{
+		"stripeCustomerId":                c.ID,
+		"stripeTestClockId":               clockID,
+		"stripeCustomerIdBeforeTestClock": previousCustomer,
+		"updatedAt":                       time.Now().UTC(),
+	}, firestore.MergeAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link test clock customer: %w", err)
+	}
+
+	out := &AttachTestClockResult{DojoID: in.DojoID, CustomerID: c.ID}
+	if priceID == "" {
+		return out, nil
+	}
+
+	// the customer.subscription.created webhook updates the dojo as usual
+	sub, err := subscription.New(&stripe.SubscriptionParams{
+		Customer: stripe.String(c.ID),
+		Items: []*stripe.SubscriptionItemsParams{
+			{Price: stripe.String(priceID)},
+		},
+		Metadata: map[string]string{
+			"dojoId": in.DojoID,
+			"plan":   in.Plan,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create test subscription: %w", err)
+	}
+	out.SubscriptionID = sub.ID
+	return out, nil
+}
+
+// AdvanceTestClock moves the clock forward; Stripe then fires the renewal,
+// cancellation and dunning webhooks due in between (admin, test mode)
+func (s *Service) AdvanceTestClock(ctx context.Context, clockID string, in AdvanceTestClockInput) (*TestClock, error) {
+	current, err := s.GetTestClock(ctx, clockID)
+	if err != nil {
+		return nil, err
+	}
+
+	var target time.Time
+	switch {
+	case in.FrozenTime != nil:
+		target = in.FrozenTime.UTC()
+	case in.Days > 0:
+		target = current.FrozenTime.AddDate(0, 0, in.Days)
+	default:
+		return nil, fmt.Errorf("%w: frozenTime or days is required", ErrBadRequest)
+	}
+	if !target.After(current.FrozenTime) {
+		return nil, fmt.Errorf("%w: test clocks only move forward", ErrBadRequest)
+	}
+
+	c, err := testclock.Advance(current.ID, &stripe.TestHelpersTestClockAdvanceParams{
+		FrozenTime: stripe.Int64(target.Unix()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to advance test clock: %v", ErrBadRequest, err)
+	}
+	return toTestClock(c), nil
+}
+
+// DeleteTestClock deletes the clock with its customers and subscriptions and
+// gives attached dojos back their previous customer (admin, test mode)
+func (s *Service) DeleteTestClock(ctx context.Context, clockID string) error {
+	if err := s.requireTestMode(); err != nil {
+		return err
+	}
+	clockID = strings.TrimSpace(clockID)
+	if _, err := testclock.Del(clockID, nil); err != nil {
+		return fmt.Errorf("%w: failed to delete test clock: %v", ErrNotFound, err)
+	}
+
+	docs, err := s.fs.Collection("dojos").Where("stripeTestClockId", "==", clockID).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list test clock dojos: %w", err)
+	}
+	for _, doc := range docs {
+		previous, _ := doc.Data()["stripeCustomerIdBeforeTestClock"].(string)
+		var customerID interface{} = previous
+		if previous == "" {
+			customerID = firestore.Delete
+		}
+		_, err := doc.Ref.Update(ctx, []firestore.Update{
+			{Path: "stripeCustomerId", Value: customerID},
+			{Path: "stripeTestClockId", Value: firestore.Delete},
+			{Path: "stripeCustomerIdBeforeTestClock", Value: firestore.Delete},
+			{Path: "subscriptionId", Value: nil},
+			{Path: "subscriptionStatus", Value: "canceled"},
+			{Path: "subscriptionPriceId", Value: nil},
+			{Path: "plan", Value: PlanFree},
+			{Path: "planPeriodEnd", Value: nil},
+			{Path: "cancelAtPeriodEnd", Value: false},
+			{Path: "updatedAt", Value: time.Now().UTC()},
+		})
+		if err != nil {
+			log.Printf("test clock: failed to restore dojo %s: %v", doc.Ref.ID, err)
+		}
+	}
+	return nil
+}
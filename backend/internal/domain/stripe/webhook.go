@@ -7,11 +7,14 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/webhook"
+
+	"dojo-manager/backend/internal/events"
 )
 
 // HandleWebhook processes incoming Stripe webhooks
@@ -35,87 +38,103 @@ func (s *Service) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
 	log.Printf("webhook: received event type=%s id=%s", event.Type, event.ID)
 
-	// Handle the event
-	switch event.Type {
+	// Persist first and acknowledge; the event worker does the Firestore work
+	// so slow processing never makes Stripe time out and retry
+	if err := s.enqueueEvent(r.Context(), event.ID, string(event.Type), time.Unix(event.Created, 0).UTC(), event.Data.Raw); err != nil {
+		log.Printf("webhook: failed to queue event %s: %v", event.ID, err)
+		http.Error(w, "failed to queue event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"received": true}`))
+}
+
+// processEvent applies one webhook event, created at created. Errors are
+// retried by the event worker.
+func (s *Service) processEvent(ctx context.Context, eventType string, created time.Time, raw json.RawMessage) error {
+	switch eventType {
 	case "checkout.session.completed":
 		var session stripe.CheckoutSession
-		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-			log.Printf("webhook: error parsing checkout session: %v", err)
-			http.Error(w, fmt.Sprintf("Error parsing webhook JSON: %v", err), http.StatusBadRequest)
-			return
-		}
-		if err := s.handleCheckoutCompleted(ctx, &session); err != nil {
-			log.Printf("webhook: error handling checkout completed: %v", err)
-			// Don't return error - acknowledge receipt to prevent retries
+		if err := json.Unmarshal(raw, &session); err != nil {
+			return fmt.Errorf("error parsing checkout session: %w", err)
 		}
+		return s.handleCheckoutCompleted(ctx, &session)
 
 	case "customer.subscription.created":
 		var sub stripe.Subscription
-		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-			log.Printf("webhook: error parsing subscription: %v", err)
-			http.Error(w, fmt.Sprintf("Error parsing webhook JSON: %v", err), http.StatusBadRequest)
-			return
-		}
-		if err := s.handleSubscriptionCreated(ctx, &sub); err != nil {
-			log.Printf("webhook: error handling subscription created: %v", err)
+		if err := json.Unmarshal(raw, &sub); err != nil {
+			return fmt.Errorf("error parsing subscription: %w", err)
 		}
+		return s.applySubscriptionEvent(ctx, &sub, created, s.handleSubscriptionCreated)
 
 	case "customer.subscription.updated":
 		var sub stripe.Subscription
-		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-			log.Printf("webhook: error parsing subscription: %v", err)
-			http.Error(w, fmt.Sprintf("Error parsing webhook JSON: %v", err), http.StatusBadRequest)
-			return
-		}
-		if err := s.handleSubscriptionUpdated(ctx, &sub); err != nil {
-			log.Printf("webhook: error handling subscription updated: %v", err)
+		if err := json.Unmarshal(raw, &sub); err != nil {
+			return fmt.Errorf("error parsing subscription: %w", err)
 		}
+		return s.applySubscriptionEvent(ctx, &sub, created, s.handleSubscriptionUpdated)
 
 	case "customer.subscription.deleted":
 		var sub stripe.Subscription
-		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
-			log.Printf("webhook: error parsing subscription: %v", err)
-			http.Error(w, fmt.Sprintf("Error parsing webhook JSON: %v", err), http.StatusBadRequest)
-			return
-		}
-		if err := s.handleSubscriptionDeleted(ctx, &sub); err != nil {
-			log.Printf("webhook: error handling subscription deleted: %v", err)
+		if err := json.Unmarshal(raw, &sub); err != nil {
+			return fmt.Errorf("error parsing subscription: %w", err)
 		}
+		return s.applySubscriptionEvent(ctx, &sub, created, s.handleSubscriptionDeleted)
 
 	case "invoice.payment_succeeded":
 		var invoice stripe.Invoice
-		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
-			log.Printf("webhook: error parsing invoice: %v", err)
-			http.Error(w, fmt.Sprintf("Error parsing webhook JSON: %v", err), http.StatusBadRequest)
-			return
-		}
-		if err := s.handlePaymentSucceeded(ctx, &invoice); err != nil {
-			log.Printf("webhook: error handling payment succeeded: %v", err)
+		if err := json.Unmarshal(raw, &invoice); err != nil {
+			return fmt.Errorf("error parsing invoice: %w", err)
 		}
+		return s.handlePaymentSucceeded(ctx, &invoice)
 
 	case "invoice.payment_failed":
 		var invoice stripe.Invoice
-		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
-			log.Printf("webhook: error parsing invoice: %v", err)
-			http.Error(w, fmt.Sprintf("Error parsing webhook JSON: %v", err), http.StatusBadRequest)
-			return
-		}
-		if err := s.handlePaymentFailed(ctx, &invoice); err != nil {
-			log.Printf("webhook: error handling payment failed: %v", err)
+		if err := json.Unmarshal(raw, &invoice); err != nil {
+			return fmt.Errorf("error parsing invoice: %w", err)
 		}
+		return s.handlePaymentFailed(ctx, &invoice)
 
 	default:
-		log.Printf("webhook: unhandled event type: %s", event.Type)
+		log.Printf("webhook: unhandled event type: %s", eventType)
+		return nil
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"received": true}`))
+// applySubscriptionEvent runs handle unless a newer event of the same
+// subscription was applied already, so a retried older event cannot
+// overwrite current state
+func (s *Service) applySubscriptionEvent(ctx context.Context, sub *stripe.Subscription, created time.Time, handle func(context.Context, *stripe.Subscription) error) error {
+	stale, err := s.staleSubscriptionEvent(ctx, sub.ID, created)
+	if err != nil {
+		return err
+	}
+	if stale {
+		log.Printf("webhook: skipping event of subscription %s from %s, a newer one was applied", sub.ID, created.Format(time.RFC3339))
+		return nil
+	}
+	if err := handle(ctx, sub); err != nil {
+		return err
+	}
+	if err := s.markSubscriptionEvent(ctx, sub.ID, created); err != nil {
+		log.Printf("webhook: failed to record event time of subscription %s: %v", sub.ID, err)
+	}
+	return nil
 }
 
 func (s *Service) handleCheckoutCompleted(ctx context.Context, session *stripe.CheckoutSession) error {
+	if session.Mode == stripe.CheckoutSessionModePayment {
+		return s.handlePaymentCompleted(ctx, session)
+	}
+	if kind := session.Metadata[MetadataKind]; kind != "" {
+		// member-facing subscription: customer.subscription.created does the work
+		log.Printf("webhook: %s checkout completed session=%s", kind, session.ID)
+		return nil
+	}
+
 	dojoID := session.Metadata["dojoId"]
 	if dojoID == "" {
 		return fmt.Errorf("missing dojoId in metadata")
@@ -138,6 +157,10 @@ func (s *Service) handleCheckoutCompleted(ctx context.Context, session *stripe.C
 }
 
 func (s *Service) handleSubscriptionCreated(ctx context.Context, sub *stripe.Subscription) error {
+	if handled, err := s.dispatchSubscription(ctx, sub, false); handled {
+		return err
+	}
+
 	dojoID := sub.Metadata["dojoId"]
 	if dojoID == "" {
 		// Try to find dojo by customer ID
@@ -173,7 +196,7 @@ func (s *Service) handleSubscriptionCreated(ctx context.Context, sub *stripe.Sub
 
 	// Record subscription event
 	s.recordSubscriptionEvent(ctx, dojoID, SubscriptionEvent{
-		Type:              "subscription_created",
+		Type:              SubscriptionEventCreated,
 		SubscriptionID:    sub.ID,
 		Status:            string(sub.Status),
 		Plan:              plan,
@@ -187,6 +210,10 @@ func (s *Service) handleSubscriptionCreated(ctx context.Context, sub *stripe.Sub
 }
 
 func (s *Service) handleSubscriptionUpdated(ctx context.Context, sub *stripe.Subscription) error {
+	if handled, err := s.dispatchSubscription(ctx, sub, false); handled {
+		return err
+	}
+
 	dojoID := sub.Metadata["dojoId"]
 	if dojoID == "" {
 		// Try to find dojo by subscription ID
@@ -226,7 +253,7 @@ func (s *Service) handleSubscriptionUpdated(ctx context.Context, sub *stripe.Sub
 
 	// Record event
 	s.recordSubscriptionEvent(ctx, dojoID, SubscriptionEvent{
-		Type:              "subscription_updated",
+		Type:              SubscriptionEventUpdated,
 		SubscriptionID:    sub.ID,
 		Status:            string(sub.Status),
 		Plan:              plan,
@@ -240,6 +267,10 @@ func (s *Service) handleSubscriptionUpdated(ctx context.Context, sub *stripe.Sub
 }
 
 func (s *Service) handleSubscriptionDeleted(ctx context.Context, sub *stripe.Subscription) error {
+	if handled, err := s.dispatchSubscription(ctx, sub, true); handled {
+		return err
+	}
+
 	dojoID := sub.Metadata["dojoId"]
 	if dojoID == "" {
 		// Try to find dojo by subscription ID
@@ -270,7 +301,7 @@ func (s *Service) handleSubscriptionDeleted(ctx context.Context, sub *stripe.Sub
 
 	// Record event
 	s.recordSubscriptionEvent(ctx, dojoID, SubscriptionEvent{
-		Type:           "subscription_deleted",
+		Type:           SubscriptionEventDeleted,
 		SubscriptionID: sub.ID,
 		Status:         string(sub.Status),
 		Plan:           PlanFree,
@@ -284,6 +315,9 @@ func (s *Service) handlePaymentSucceeded(ctx context.Context, invoice *stripe.In
 	if invoice.Subscription == nil {
 		return nil // Not a subscription invoice
 	}
+	if invoice.SubscriptionDetails != nil && invoice.SubscriptionDetails.Metadata[MetadataKind] != "" {
+		return nil // member-facing subscription, not the dojo plan
+	}
 
 	// Find dojo by subscription ID first
 	dojoID := s.findDojoBySubscription(ctx, invoice.Subscription.ID)
@@ -301,13 +335,18 @@ func (s *Service) handlePaymentSucceeded(ctx context.Context, invoice *stripe.In
 
 	log.Printf("webhook: payment succeeded dojo=%s amount=%d", dojoID, invoice.AmountPaid)
 
-	// Record payment
+	// Record payment, with Stripe's fee for the accounting export
+	fee, net := invoiceFee(invoice)
 	paymentDoc := s.fs.Collection("dojos").Doc(dojoID).Collection("payments").NewDoc()
 	_, err := paymentDoc.Set(ctx, Payment{
 		ID:             paymentDoc.ID,
 		InvoiceID:      invoice.ID,
+		InvoiceNumber:  invoice.Number,
 		SubscriptionID: invoice.Subscription.ID,
 		Amount:         invoice.AmountPaid,
+		Tax:            invoice.Tax,
+		Fee:            fee,
+		Net:            net,
 		Currency:       string(invoice.Currency),
 		Status:         "succeeded",
 		InvoiceURL:     invoice.HostedInvoiceURL,
@@ -325,6 +364,9 @@ func (s *Service) handlePaymentFailed(ctx context.Context, invoice *stripe.Invoi
 	if invoice.Subscription == nil {
 		return nil
 	}
+	if invoice.SubscriptionDetails != nil && invoice.SubscriptionDetails.Metadata[MetadataKind] != "" {
+		return nil // member-facing subscription, not the dojo plan
+	}
 
 	// Find dojo
 	dojoID := s.findDojoBySubscription(ctx, invoice.Subscription.ID)
@@ -363,9 +405,39 @@ func (s *Service) handlePaymentFailed(ctx context.Context, invoice *stripe.Invoi
 		return fmt.Errorf("failed to update dojo: %w", err)
 	}
 
+	// Stripe retries the charge and redelivers events, so this may repeat per invoice
+	s.bus.Publish(ctx, events.PlanPaymentFailed{
+		DojoID:    dojoID,
+		InvoiceID: invoice.ID,
+		Amount:    formatAmount(invoice.AmountDue, string(invoice.Currency)),
+	})
+
 	return nil
 }
 
+// zeroDecimal are the Stripe currencies without minor units
+var zeroDecimal = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// formatAmount renders a Stripe amount (minor units) as "49.00 USD"
+func formatAmount(amount int64, currency string) string {
+	return decimalAmount(amount, currency) + " " + strings.ToUpper(currency)
+}
+
+// decimalAmount renders a Stripe amount (minor units) as "49.00"
+func decimalAmount(amount int64, currency string) string {
+	if zeroDecimal[strings.ToLower(currency)] {
+		return fmt.Sprintf("%d", amount)
+	}
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
 // Helper functions
 
 func (s *Service) findDojoBySubscription(ctx context.Context, subscriptionID string) string {
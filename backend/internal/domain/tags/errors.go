@@ -0,0 +1,31 @@
+package tags
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrBadRequest = errors.New("bad request")
+	ErrConflict   = errors.New("conflict")
+	ErrUnknownTag = errors.New("unknown tag")
+	ErrNoClass    = errors.New("no class")
+)
+
+func IsErrNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsErrBadRequest(err error) bool {
+	return errors.Is(err, ErrBadRequest)
+}
+
+func IsErrConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+func IsErrUnknownTag(err error) bool {
+	return errors.Is(err, ErrUnknownTag)
+}
+
+func IsErrNoClass(err error) bool {
+	return errors.Is(err, ErrNoClass)
+}
@@ -0,0 +1,93 @@
+package tags
+
+import (
+	"strings"
+	"time"
+
+	"dojo-manager/backend/internal/domain/attendance"
+)
+
+// Outcomes of a tag read
+const (
+	ReadCheckedIn = "checked_in"
+	ReadUnknown   = "unknown_tag" // not registered; staff can assign it from the read log
+	ReadNoClass   = "no_class"
+	ReadRejected  = "rejected" // member can't check in, or the check-in failed
+)
+
+// Tag is dojos/{dojoId}/tags/{tagId}, an NFC/RFID card, fob or wristband
+// registered to a member. The doc id is the normalized tag id, so a tag
+// belongs to at most one member per dojo.
+type Tag struct {
+	ID         string     `firestore:"-" json:"tagId"`
+	MemberUID  string     `firestore:"memberUid" json:"memberUid"`
+	Label      string     `firestore:"label,omitempty" json:"label,omitempty"` // e.g. "blue wristband"
+	CreatedBy  string     `firestore:"createdBy" json:"createdBy"`
+	CreatedAt  time.Time  `firestore:"createdAt" json:"createdAt"`
+	LastReadAt *time.Time `firestore:"lastReadAt,omitempty" json:"lastReadAt,omitempty"`
+}
+
+// TagInput registers a tag to a member
+type TagInput struct {
+	MemberUID string `json:"memberUid"`
+	Label     string `json:"label,omitempty"`
+	// Reassign moves a tag already registered to another member
+	Reassign bool `json:"reassign,omitempty"`
+}
+
+func (in *TagInput) Trim() {
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	in.Label = strings.TrimSpace(in.Label)
+}
+
+// Settings is dojos/{dojoId}/settings/tags: how a read is matched to a class
+type Settings struct {
+	Timezone string `firestore:"timezone" json:"timezone"` // IANA name class start times are in, "" = UTC
+	// EarlyMinutes before a class starts a read already checks into it
+	EarlyMinutes int       `firestore:"earlyMinutes" json:"earlyMinutes"`
+	UpdatedAt    time.Time `firestore:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	UpdatedBy    string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdateSettingsInput updates the tag settings (nil fields are left unchanged)
+type UpdateSettingsInput struct {
+	Timezone     *string `json:"timezone,omitempty"`
+	EarlyMinutes *int    `json:"earlyMinutes,omitempty"`
+}
+
+// ReadInput is a reader's post: the tag it read and when
+type ReadInput struct {
+	TagID  string    `json:"tagId"`
+	ReadAt time.Time `json:"readAt"` // zero means now
+	// SessionInstanceID pins the class, for readers placed at one mat
+	SessionInstanceID string `json:"sessionInstanceId,omitempty"`
+}
+
+func (in *ReadInput) Trim() {
+	in.TagID = strings.TrimSpace(in.TagID)
+	in.SessionInstanceID = strings.TrimSpace(in.SessionInstanceID)
+}
+
+// Read is dojos/{dojoId}/tagReads/{id}, one read by a door reader
+type Read struct {
+	ID                string    `firestore:"-" json:"id"`
+	TagID             string    `firestore:"tagId" json:"tagId"`
+	DeviceID          string    `firestore:"deviceId" json:"deviceId"`
+	MemberUID         string    `firestore:"memberUid,omitempty" json:"memberUid,omitempty"`
+	SessionInstanceID string    `firestore:"sessionInstanceId,omitempty" json:"sessionInstanceId,omitempty"`
+	Outcome           string    `firestore:"outcome" json:"outcome"`
+	Detail            string    `firestore:"detail,omitempty" json:"detail,omitempty"`
+	ReadAt            time.Time `firestore:"readAt" json:"readAt"`
+	ReceivedAt        time.Time `firestore:"receivedAt" json:"receivedAt"`
+}
+
+// ReadResult tells the reader who was checked in, and into which class
+type ReadResult struct {
+	MemberUID         string                 `json:"memberUid"`
+	MemberNumber      int                    `json:"memberNumber,omitempty"`
+	DisplayName       string                 `json:"displayName"`
+	BeltRank          string                 `json:"beltRank"`
+	SessionInstanceID string                 `json:"sessionInstanceId"`
+	ClassTitle        string                 `json:"classTitle,omitempty"`
+	Attendance        *attendance.Attendance `json:"attendance"`
+}
@@ -0,0 +1,219 @@
+package tags
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	// maxReadAge lets a reader that lost its connection post buffered reads
+	maxReadAge = 24 * time.Hour
+	// maxReadAhead allows for a reader's clock running fast
+	maxReadAhead = 5 * time.Minute
+
+	// defaultClassMinutes is assumed for classes without a duration
+	defaultClassMinutes = 60
+
+	maxListReads = 200
+)
+
+// tagMember is the part of a member doc a read needs
+type tagMember struct {
+	fsdoc.Member
+	MemberNumber int `firestore:"memberNumber"`
+}
+
+func (m tagMember) canCheckIn() bool {
+	return m.Status != members.StatusPending && m.Status != members.StatusInactive
+}
+
+// RecordRead checks the holder of a tag read at the door into the class
+// running at the time of the read (or the one the reader is pinned to). Every
+// read is logged, including unknown tags, so staff can assign a new card by
+// tapping it on a reader.
+func (s *Service) RecordRead(ctx context.Context, deviceID, dojoID string, in ReadInput, now time.Time) (*ReadResult, error) {
+	in.Trim()
+	if dojoID == "" || in.TagID == "" {
+		return nil, fmt.Errorf("%w: tagId is required", ErrBadRequest)
+	}
+	tagID, err := NormalizeTagID(in.TagID)
+	if err != nil {
+		return nil, err
+	}
+	now = now.UTC()
+	if in.ReadAt.IsZero() {
+		in.ReadAt = now
+	}
+	in.ReadAt = in.ReadAt.UTC()
+	if in.ReadAt.After(now.Add(maxReadAhead)) || in.ReadAt.Before(now.Add(-maxReadAge)) {
+		return nil, fmt.Errorf("%w: readAt must be within the last %s", ErrBadRequest, maxReadAge)
+	}
+
+	entry := Read{TagID: tagID, DeviceID: deviceID, ReadAt: in.ReadAt, ReceivedAt: now}
+	fail := func(outcome string, err error) (*ReadResult, error) {
+		entry.Outcome = outcome
+		entry.Detail = err.Error()
+		s.logRead(ctx, dojoID, entry)
+		return nil, err
+	}
+
+	tagRef := s.tagsCol(dojoID).Doc(tagID)
+	doc, err := tagRef.Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to look up tag: %w", err)
+	}
+	if !doc.Exists() {
+		return fail(ReadUnknown, fmt.Errorf("%w: tag %s is not registered", ErrUnknownTag, tagID))
+	}
+	var tag Tag
+	if err := doc.DataTo(&tag); err != nil {
+		return nil, fmt.Errorf("failed to decode tag: %w", err)
+	}
+	entry.MemberUID = tag.MemberUID
+
+	mdoc, err := s.fs.Collection("dojos").Doc(dojoID).Collection("members").Doc(tag.MemberUID).Get(ctx)
+	if err != nil && mdoc == nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	if !mdoc.Exists() {
+		return fail(ReadRejected, fmt.Errorf("%w: tag holder is no longer a member", ErrUnknownTag))
+	}
+	var m tagMember
+	if err := fsdoc.Decode(mdoc, &m); err != nil {
+		return nil, err
+	}
+	if !m.canCheckIn() {
+		return fail(ReadRejected, fmt.Errorf("%w: membership is %s", ErrConflict, m.Status))
+	}
+
+	instanceID, title := in.SessionInstanceID, ""
+	if instanceID == "" {
+		if instanceID, title, err = s.classAt(ctx, dojoID, in.ReadAt); err != nil {
+			if IsErrNoClass(err) {
+				return fail(ReadNoClass, err)
+			}
+			return nil, err
+		}
+	}
+	entry.SessionInstanceID = instanceID
+
+	att, err := s.attendanceSvc.RecordCheckin(ctx, "device:"+deviceID, dojoID, instanceID, tag.MemberUID)
+	if err != nil {
+		return fail(ReadRejected, err)
+	}
+
+	entry.Outcome = ReadCheckedIn
+	s.logRead(ctx, dojoID, entry)
+	if _, err := tagRef.Update(ctx, []firestore.Update{{Path: "lastReadAt", Value: now}}); err != nil {
+		log.Printf("tags: lastReadAt of %s in dojo %s: %v", tagID, dojoID, err)
+	}
+	return &ReadResult{
+		MemberUID:         tag.MemberUID,
+		MemberNumber:      m.MemberNumber,
+		DisplayName:       m.DisplayName,
+		BeltRank:          m.Belt(),
+		SessionInstanceID: instanceID,
+		ClassTitle:        title,
+		Attendance:        att,
+	}, nil
+}
+
+// classAt finds the class a read at t belongs to: one held that day whose
+// start is at most EarlyMinutes away and which has not ended, the one
+// starting nearest t when classes overlap
+func (s *Service) classAt(ctx context.Context, dojoID string, t time.Time) (string, string, error) {
+	st, err := s.GetSettings(ctx, dojoID)
+	if err != nil {
+		return "", "", err
+	}
+	loc, err := time.LoadLocation(st.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+	dateKey := local.Format(instanceid.DateLayout)
+	minute := local.Hour()*60 + local.Minute()
+
+	classes, err := s.sessionSvc.ListByDay(ctx, dojoID, int(local.Weekday()))
+	if err != nil {
+		return "", "", err
+	}
+	best, bestGap := -1, 0
+	for i := range classes {
+		sess := &classes[i]
+		duration := sess.DurationMinute
+		if duration <= 0 {
+			duration = defaultClassMinutes
+		}
+		if minute < sess.StartMinute-st.EarlyMinutes || minute >= sess.StartMinute+duration || !sess.HeldOn(dateKey) {
+			continue
+		}
+		gap := minute - sess.StartMinute
+		if gap < 0 {
+			gap = -gap
+		}
+		if best < 0 || gap < bestGap {
+			best, bestGap = i, gap
+		}
+	}
+	if best < 0 {
+		return "", "", fmt.Errorf("%w: no class at %s", ErrNoClass, local.Format("Mon 15:04"))
+	}
+	return instanceid.New(dateKey, classes[best].ID), classes[best].Title, nil
+}
+
+func (s *Service) logRead(ctx context.Context, dojoID string, r Read) {
+	if _, _, err := s.fs.Collection("dojos").Doc(dojoID).Collection("tagReads").Add(ctx, r); err != nil {
+		log.Printf("tags: failed to log read of %s in dojo %s: %v", r.TagID, dojoID, err)
+	}
+}
+
+// ListReads returns the dojo's latest tag reads, newest first, optionally
+// only those with one outcome (e.g. unknown_tag to find a new card) (staff)
+func (s *Service) ListReads(ctx context.Context, dojoID, outcome string, limit int) ([]Read, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	switch outcome {
+	case "", ReadCheckedIn, ReadUnknown, ReadNoClass, ReadRejected:
+	default:
+		return nil, fmt.Errorf("%w: unknown outcome %q", ErrBadRequest, outcome)
+	}
+	if limit <= 0 || limit > maxListReads {
+		limit = maxListReads
+	}
+
+	q := s.fs.Collection("dojos").Doc(dojoID).Collection("tagReads").Query
+	if outcome != "" {
+		q = q.Where("outcome", "==", outcome)
+	}
+	iter := q.OrderBy("receivedAt", firestore.Desc).Limit(limit).Documents(ctx)
+	defer iter.Stop()
+
+	out := []Read{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tag reads: %w", err)
+		}
+		var r Read
+		if err := doc.DataTo(&r); err != nil {
+			continue
+		}
+		r.ID = doc.Ref.ID
+		out = append(out, r)
+	}
+	return out, nil
+}
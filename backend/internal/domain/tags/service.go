@@ -0,0 +1,244 @@
+package tags
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+)
+
+const (
+	minTagIDLength   = 4
+	maxTagIDLength   = 64
+	maxLabelLength   = 60
+	maxTagsPerMember = 5
+	maxListTags      = 1000
+
+	defaultEarlyMinutes = 30
+	maxEarlyMinutes     = 120
+)
+
+// Service registers NFC/RFID tags to members and turns reads posted by door
+// readers into attendance. Readers are kiosk devices (see the devices
+// domain), authenticated by their device token and a request signature.
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	sessionSvc    *session.Service
+	attendanceSvc *attendance.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, sessionSvc *session.Service, attendanceSvc *attendance.Service) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, sessionSvc: sessionSvc, attendanceSvc: attendanceSvc}
+}
+
+func (s *Service) tagsCol(dojoID string) *firestore.CollectionRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("tags")
+}
+
+func (s *Service) settingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("tags")
+}
+
+// NormalizeTagID uppercases a tag id and drops the separators readers put
+// between bytes ("04:a2:2b" and "04A22B" are the same tag)
+func NormalizeTagID(id string) (string, error) {
+	id = strings.ToUpper(strings.NewReplacer(":", "", "-", "", " ", "").Replace(strings.TrimSpace(id)))
+	if len(id) < minTagIDLength || len(id) > maxTagIDLength {
+		return "", fmt.Errorf("%w: tagId must be %d-%d characters", ErrBadRequest, minTagIDLength, maxTagIDLength)
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+			return "", fmt.Errorf("%w: tagId may only contain letters and digits", ErrBadRequest)
+		}
+	}
+	return id, nil
+}
+
+// Register assigns a tag to a member (staff). A tag registered to someone
+// else is only moved when Reassign is set.
+func (s *Service) Register(ctx context.Context, staffUID, dojoID, tagID string, in TagInput) (*Tag, error) {
+	in.Trim()
+	id, err := NormalizeTagID(tagID)
+	if err != nil {
+		return nil, err
+	}
+	if dojoID == "" || in.MemberUID == "" {
+		return nil, fmt.Errorf("%w: dojoId and memberUid are required", ErrBadRequest)
+	}
+	if utf8.RuneCountInString(in.Label) > maxLabelLength {
+		return nil, fmt.Errorf("%w: label is limited to %d characters", ErrBadRequest, maxLabelLength)
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, dojoID, in.MemberUID); err != nil {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+
+	owned, err := s.tagsCol(dojoID).Where("memberUid", "==", in.MemberUID).Select().Limit(maxTagsPerMember + 1).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tags: %w", err)
+	}
+	ref := s.tagsCol(dojoID).Doc(id)
+	count := 0
+	for _, doc := range owned {
+		if doc.Ref.ID != id {
+			count++
+		}
+	}
+	if count >= maxTagsPerMember {
+		return nil, fmt.Errorf("%w: at most %d tags per member", ErrBadRequest, maxTagsPerMember)
+	}
+
+	tag := Tag{
+		MemberUID: in.MemberUID,
+		Label:     in.Label,
+		CreatedBy: staffUID,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && doc == nil {
+			return err
+		}
+		if doc.Exists() {
+			holder, _ := doc.Data()["memberUid"].(string)
+			if holder != in.MemberUID && !in.Reassign {
+				return fmt.Errorf("%w: tag is registered to another member; set reassign to move it", ErrConflict)
+			}
+		}
+		return tx.Set(ref, tag)
+	})
+	if err != nil {
+		if IsErrConflict(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to register tag: %w", err)
+	}
+	tag.ID = id
+	return &tag, nil
+}
+
+// List returns the dojo's tags, or one member's with memberUID (staff)
+func (s *Service) List(ctx context.Context, dojoID, memberUID string) ([]Tag, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	q := s.tagsCol(dojoID).Limit(maxListTags)
+	if memberUID != "" {
+		q = s.tagsCol(dojoID).Where("memberUid", "==", memberUID).Limit(maxTagsPerMember)
+	}
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	out := []Tag{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		var t Tag
+		if err := doc.DataTo(&t); err != nil {
+			continue
+		}
+		t.ID = doc.Ref.ID
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// Delete unregisters a tag, e.g. a lost card (staff)
+func (s *Service) Delete(ctx context.Context, dojoID, tagID string) error {
+	id, err := NormalizeTagID(tagID)
+	if err != nil {
+		return err
+	}
+	ref := s.tagsCol(dojoID).Doc(id)
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return fmt.Errorf("failed to get tag: %w", err)
+	}
+	if !doc.Exists() {
+		return fmt.Errorf("%w: tag not found", ErrNotFound)
+	}
+	if _, err := ref.Delete(ctx); err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+	return nil
+}
+
+// ForgetMember unregisters the tags of a member who left
+func (s *Service) ForgetMember(ctx context.Context, dojoID, memberUID string) error {
+	docs, err := s.tagsCol(dojoID).Where("memberUid", "==", memberUID).Select().Limit(maxTagsPerMember).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list tags: %w", err)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	batch := s.fs.Batch()
+	for _, doc := range docs {
+		batch.Delete(doc.Ref)
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to delete tags: %w", err)
+	}
+	return nil
+}
+
+// GetSettings returns the dojo's tag settings, defaults if never saved (staff)
+func (s *Service) GetSettings(ctx context.Context, dojoID string) (*Settings, error) {
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.settingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load tag settings: %w", err)
+	}
+	st := &Settings{EarlyMinutes: defaultEarlyMinutes}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode tag settings: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// UpdateSettings sets how reads are matched to classes (staff)
+func (s *Service) UpdateSettings(ctx context.Context, staffUID, dojoID string, in UpdateSettingsInput) (*Settings, error) {
+	if in.Timezone != nil {
+		*in.Timezone = strings.TrimSpace(*in.Timezone)
+		if _, err := time.LoadLocation(*in.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrBadRequest, *in.Timezone)
+		}
+	}
+	if in.EarlyMinutes != nil && (*in.EarlyMinutes < 0 || *in.EarlyMinutes > maxEarlyMinutes) {
+		return nil, fmt.Errorf("%w: earlyMinutes must be 0-%d", ErrBadRequest, maxEarlyMinutes)
+	}
+
+	st, err := s.GetSettings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Timezone != nil {
+		st.Timezone = *in.Timezone
+	}
+	if in.EarlyMinutes != nil {
+		st.EarlyMinutes = *in.EarlyMinutes
+	}
+	st.UpdatedAt = time.Now().UTC()
+	st.UpdatedBy = staffUID
+	if _, err := s.settingsRef(dojoID).Set(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save tag settings: %w", err)
+	}
+	return st, nil
+}
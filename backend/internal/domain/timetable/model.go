@@ -0,0 +1,111 @@
+package timetable
+
+import (
+	"time"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/session"
+)
+
+const (
+	// frequencyWeeks is the window attendance frequency is measured over
+	frequencyWeeks = 12
+	// usualRate is the share of a class's instances a member attends for it
+	// to count as one of their usual classes
+	usualRate = 0.5
+)
+
+// MemberTimetable is the week ahead of a dojo's timetable from one member's
+// point of view
+type MemberTimetable struct {
+	From    string       `json:"from"`    // YYYY-MM-DD, today (UTC); the week runs 7 days from it
+	Weeks   int          `json:"weeks"`   // attendance frequency window
+	Classes []ClassEntry `json:"classes"` // in calendar order: by day from calendar.weekStart, then start time
+
+	Calendar dojo.CalendarHints `json:"calendar"`
+}
+
+// ClassEntry is one timetable class, by weekday and start time
+type ClassEntry struct {
+	Class session.Session `json:"class"`
+
+	// The class's next instance in the week; empty if it is cancelled or
+	// has ended
+	Date       string `json:"date,omitempty"` // YYYY-MM-DD
+	InstanceID string `json:"instanceId,omitempty"`
+
+	Eligible         bool   `json:"eligible"`
+	IneligibleReason string `json:"ineligibleReason,omitempty"`
+
+	Booking   string `json:"booking,omitempty"`   // reservation status of the next instance: confirmed or cancelled
+	Recurring string `json:"recurring,omitempty"` // recurring booking status, see recurring.Booking
+
+	Attended int     `json:"attended"` // check-ins over the window
+	Held     int     `json:"held"`     // instances held over the window
+	Rate     float64 `json:"rate"`     // attended / held
+	Usual    bool    `json:"usual"`    // one of the member's usual classes
+}
+
+// PublishSettings is dojos/{dojoId}/settings/timetablePublish: the opt-in
+// weekly "this week's classes" push to members, sent on Weekday at Hour in
+// the dojo's Timezone
+type PublishSettings struct {
+	Enabled   bool      `firestore:"enabled" json:"enabled"`
+	Weekday   int       `firestore:"weekday" json:"weekday"`   // 0=Sunday .. 6=Saturday
+	Hour      int       `firestore:"hour" json:"hour"`         // 0-23, local
+	Timezone  string    `firestore:"timezone" json:"timezone"` // IANA name, "" = UTC
+	UpdatedAt time.Time `firestore:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	UpdatedBy string    `firestore:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+// UpdatePublishSettingsInput updates the publish settings (nil fields are
+// left unchanged)
+type UpdatePublishSettingsInput struct {
+	Enabled  *bool   `json:"enabled,omitempty"`
+	Weekday  *int    `json:"weekday,omitempty"`
+	Hour     *int    `json:"hour,omitempty"`
+	Timezone *string `json:"timezone,omitempty"`
+}
+
+// Publish is dojos/{dojoId}/timetablePublishes/{week}, the week's timetable
+// as sent to members. Its deliveries subcollection links each recipient to
+// their notification, whose read flag gives the open rate.
+type Publish struct {
+	Week       string    `firestore:"week" json:"week"`       // first day, YYYY-MM-DD
+	WeekEnd    string    `firestore:"weekEnd" json:"weekEnd"` // last day, YYYY-MM-DD
+	Classes    int       `firestore:"classes" json:"classes"` // class instances in the week
+	Recipients int       `firestore:"recipients" json:"recipients"`
+	Pushed     int       `firestore:"pushed" json:"pushed"`                     // recipients reached by push as well
+	SentBy     string    `firestore:"sentBy,omitempty" json:"sentBy,omitempty"` // empty for the scheduler
+	SentAt     time.Time `firestore:"sentAt" json:"sentAt"`
+}
+
+// PublishDelivery is timetablePublishes/{week}/deliveries/{uid}
+type PublishDelivery struct {
+	UID            string    `firestore:"uid" json:"uid"`
+	NotificationID string    `firestore:"notificationId" json:"notificationId"`
+	UsualClasses   int       `firestore:"usualClasses" json:"usualClasses"` // highlighted in their push
+	Pushed         bool      `firestore:"pushed" json:"pushed"`
+	DeliveredAt    time.Time `firestore:"deliveredAt" json:"deliveredAt"`
+}
+
+// PublishStats is a publish with how many recipients opened it so far
+type PublishStats struct {
+	Publish
+	Read     int     `json:"read"`
+	ReadRate float64 `json:"readRate"` // 0..1
+	// PushReadRate is the open rate of recipients reached by push
+	PushReadRate float64 `json:"pushReadRate"`
+}
+
+// PublishRunResult summarizes a scheduler run
+type PublishRunResult struct {
+	DojosChecked int  `json:"dojosChecked"`
+	DojosEnabled int  `json:"dojosEnabled"`
+	Published    int  `json:"published"`
+	Skipped      int  `json:"skipped"` // not due, or this week already sent
+	Recipients   int  `json:"recipients"`
+	Pushed       int  `json:"pushed"`
+	Failed       int  `json:"failed"`
+	Partial      bool `json:"partial,omitempty"`
+}
@@ -0,0 +1,524 @@
+package timetable
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/fsdoc"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+const (
+	defaultPublishWeekday = int(time.Sunday)
+	defaultPublishHour    = 18
+
+	maxPublishMembers = 1000
+	maxPublishWrites  = 450
+	// maxListedClasses are named in the notification body
+	maxListedClasses = 4
+	maxPublishList   = 12
+)
+
+func (s *Service) publishSettingsRef(dojoID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("settings").Doc("timetablePublish")
+}
+
+func (s *Service) publishRef(dojoID, week string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("timetablePublishes").Doc(week)
+}
+
+// GetPublishSettings returns the dojo's weekly publish settings, disabled
+// defaults if never saved (staff)
+func (s *Service) GetPublishSettings(ctx context.Context, dojoID string) (*PublishSettings, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	doc, err := s.publishSettingsRef(dojoID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load publish settings: %w", err)
+	}
+	st := &PublishSettings{Weekday: defaultPublishWeekday, Hour: defaultPublishHour}
+	if doc.Exists() {
+		if err := doc.DataTo(st); err != nil {
+			return nil, fmt.Errorf("failed to decode publish settings: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// UpdatePublishSettings opts the dojo in or out of the weekly push and sets
+// when it goes out (staff)
+func (s *Service) UpdatePublishSettings(ctx context.Context, staffUID, dojoID string, in UpdatePublishSettingsInput) (*PublishSettings, error) {
+	if in.Weekday != nil && (*in.Weekday < 0 || *in.Weekday > 6) {
+		return nil, fmt.Errorf("%w: weekday must be 0-6", ErrBadRequest)
+	}
+	if in.Hour != nil && (*in.Hour < 0 || *in.Hour > 23) {
+		return nil, fmt.Errorf("%w: hour must be 0-23", ErrBadRequest)
+	}
+	if in.Timezone != nil {
+		*in.Timezone = strings.TrimSpace(*in.Timezone)
+		if _, err := time.LoadLocation(*in.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrBadRequest, *in.Timezone)
+		}
+	}
+
+	st, err := s.GetPublishSettings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if in.Enabled != nil {
+		st.Enabled = *in.Enabled
+	}
+	if in.Weekday != nil {
+		st.Weekday = *in.Weekday
+	}
+	if in.Hour != nil {
+		st.Hour = *in.Hour
+	}
+	if in.Timezone != nil {
+		st.Timezone = *in.Timezone
+	}
+	st.UpdatedAt = time.Now().UTC()
+	st.UpdatedBy = staffUID
+	if _, err := s.publishSettingsRef(dojoID).Set(ctx, st); err != nil {
+		return nil, fmt.Errorf("failed to save publish settings: %w", err)
+	}
+	return st, nil
+}
+
+// publishWeek is the calendar week containing the day after local: sent on
+// the last evening of a week it announces the next one, sent early in a week
+// the rest of that week
+func publishWeek(cal dojo.CalendarHints, local time.Time) (from, end time.Time) {
+	next := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	from = cal.WeekOf(next)
+	return from, from.AddDate(0, 0, 6)
+}
+
+// RunPublish sends the week's timetable for every opted-in dojo whose publish
+// time has come, in its own timezone. Meant to be triggered hourly by Cloud
+// Scheduler; each dojo's week is sent once.
+func (s *Service) RunPublish(ctx context.Context, now time.Time) (*PublishRunResult, error) {
+	res := &PublishRunResult{}
+
+	iter := s.fs.Collection("dojos").Select("status").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			return nil, fmt.Errorf("failed to list dojos: %w", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status == dojo.StatusPendingDelete {
+			continue
+		}
+		res.DojosChecked++
+		dojoID := doc.Ref.ID
+		st, err := s.GetPublishSettings(ctx, dojoID)
+		if err != nil || !st.Enabled {
+			continue
+		}
+		res.DojosEnabled++
+
+		loc, err := time.LoadLocation(st.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		local := now.In(loc)
+		if int(local.Weekday()) != st.Weekday || local.Hour() < st.Hour {
+			res.Skipped++
+			continue
+		}
+
+		p, err := s.publish(ctx, "", dojoID, local, now)
+		if err != nil {
+			// already sent this week, or no classes to announce
+			if IsErrConflict(err) || IsErrBadRequest(err) {
+				res.Skipped++
+				continue
+			}
+			if ctx.Err() != nil {
+				res.Partial = true
+				break
+			}
+			res.Failed++
+			log.Printf("timetable publish: dojo %s: %v", dojoID, err)
+			continue
+		}
+		res.Published++
+		res.Recipients += p.Recipients
+		res.Pushed += p.Pushed
+	}
+
+	log.Printf("timetable publish: %d dojos checked, %d enabled, %d published, %d skipped, %d recipients, %d pushed, %d failed (partial=%v)",
+		res.DojosChecked, res.DojosEnabled, res.Published, res.Skipped, res.Recipients, res.Pushed, res.Failed, res.Partial)
+	return res, nil
+}
+
+// Publish sends the week's timetable now, whether or not the dojo opted in
+// to the weekly push (staff). A week already sent gets ErrConflict.
+func (s *Service) Publish(ctx context.Context, staffUID, dojoID string, now time.Time) (*Publish, error) {
+	st, err := s.GetPublishSettings(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(st.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return s.publish(ctx, staffUID, dojoID, now.In(loc), now)
+}
+
+// weekClass is one class instance of the published week
+type weekClass struct {
+	sess    *session.Session
+	dateKey string
+}
+
+func (s *Service) publish(ctx context.Context, staffUID, dojoID string, local, now time.Time) (*Publish, error) {
+	cal := s.dojoRepo.Calendar(ctx, dojoID)
+	from, end := publishWeek(cal, local)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	classes, err := s.sessionSvc.List(ctx, dojoID, session.ListSessionsInput{ActiveOnly: true, Limit: 100})
+	if err != nil {
+		return nil, err
+	}
+	var week []weekClass
+	for d := from; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if d.Before(today) {
+			continue
+		}
+		dateKey := d.Format(instanceid.DateLayout)
+		for i := range classes {
+			if classes[i].HeldOn(dateKey) {
+				week = append(week, weekClass{sess: &classes[i], dateKey: dateKey})
+			}
+		}
+	}
+	sort.SliceStable(week, func(i, j int) bool {
+		if week[i].dateKey != week[j].dateKey {
+			return week[i].dateKey < week[j].dateKey
+		}
+		return week[i].sess.StartTime < week[j].sess.StartTime
+	})
+
+	p := &Publish{
+		Week:    from.Format(instanceid.DateLayout),
+		WeekEnd: end.Format(instanceid.DateLayout),
+		Classes: len(week),
+		SentBy:  staffUID,
+		SentAt:  now.UTC(),
+	}
+	if len(week) == 0 {
+		return nil, fmt.Errorf("%w: no classes on the timetable for the week of %s", ErrBadRequest, p.Week)
+	}
+	// Create is the claim: an overlapping run that stored it first wins
+	ref := s.publishRef(dojoID, p.Week)
+	if _, err := ref.Create(ctx, p); err != nil {
+		return nil, fmt.Errorf("%w: the week of %s was already published", ErrConflict, p.Week)
+	}
+
+	if err := s.fanOutWeek(ctx, dojoID, p, week, classes, today); err != nil {
+		return nil, err
+	}
+	if _, err := ref.Update(ctx, []firestore.Update{
+		{Path: "recipients", Value: p.Recipients},
+		{Path: "pushed", Value: p.Pushed},
+	}); err != nil {
+		log.Printf("timetable publish: dojo %s: failed to save counts: %v", dojoID, err)
+	}
+	return p, nil
+}
+
+// fanOutWeek writes each member's notification, highlighting the classes
+// they usually attend, records its delivery and pushes it to their devices
+func (s *Service) fanOutWeek(ctx context.Context, dojoID string, p *Publish, week []weekClass, classes []session.Session, today time.Time) error {
+	docs, err := s.fs.Collection("dojos").Doc(dojoID).Collection("members").Limit(maxPublishMembers).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to list members: %w", err)
+	}
+	held := make(map[string]int, len(classes))
+	for i := range classes {
+		held[classes[i].ID] = heldSince(&classes[i], today)
+	}
+	dojoName := ""
+	if d, err := s.dojoRepo.GetDojo(ctx, dojoID); err == nil {
+		dojoName = d.Name
+	}
+	title := "This week's classes"
+	if dojoName != "" {
+		title = dojoName + ": this week's classes"
+	}
+
+	type pending struct {
+		uid, notificationID string
+		body                string
+		usual               []string
+	}
+	var sent []pending
+	batch := s.fs.Batch()
+	writes := 0
+	deliveries := s.publishRef(dojoID, p.Week).Collection("deliveries")
+	for _, doc := range docs {
+		var m fsdoc.Member
+		if err := fsdoc.Decode(doc, &m); err != nil || m.Status == members.StatusPending || m.Status == members.StatusInactive {
+			continue
+		}
+		uid := doc.Ref.ID
+		attended, err := s.attendedByClass(ctx, dojoID, uid, today)
+		if err != nil {
+			return err
+		}
+		usual := map[string]bool{}
+		for id, n := range attended {
+			if held[id] > 0 && float64(n)/float64(held[id]) >= usualRate {
+				usual[id] = true
+			}
+		}
+		body, usualIDs := weekText(week, usual)
+
+		ref := s.fs.Collection("users").Doc(uid).Collection("notifications").NewDoc()
+		batch.Set(ref, map[string]interface{}{
+			"title": title,
+			"body":  body,
+			"type":  "timetable_week",
+			"data": map[string]interface{}{
+				"week":            p.Week,
+				"usualSessionIds": usualIDs,
+			},
+			"read":      false,
+			"dojoId":    dojoID,
+			"createdAt": p.SentAt,
+		})
+		batch.Set(deliveries.Doc(uid), PublishDelivery{
+			UID:            uid,
+			NotificationID: ref.ID,
+			UsualClasses:   len(usualIDs),
+			DeliveredAt:    p.SentAt,
+		})
+		writes += 2
+		sent = append(sent, pending{uid: uid, notificationID: ref.ID, body: body, usual: usualIDs})
+		if writes >= maxPublishWrites {
+			if _, err := batch.Commit(ctx); err != nil {
+				return fmt.Errorf("failed to send timetable: %w", err)
+			}
+			batch, writes = s.fs.Batch(), 0
+		}
+	}
+	if writes > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to send timetable: %w", err)
+		}
+	}
+	p.Recipients = len(sent)
+
+	if s.messaging == nil {
+		return nil
+	}
+	for _, r := range sent {
+		tokens := s.fcmTokens(ctx, r.uid)
+		if len(tokens) == 0 {
+			continue
+		}
+		data := map[string]string{
+			"type":            "timetable_week",
+			"dojoId":          dojoID,
+			"week":            p.Week,
+			"notificationId":  r.notificationID,
+			"usualSessionIds": strings.Join(r.usual, ","),
+		}
+		if err := s.push(ctx, r.uid, tokens, title, r.body, data); err != nil {
+			log.Printf("timetable publish: dojo %s: push to %s failed: %v", dojoID, r.uid, err)
+			continue
+		}
+		p.Pushed++
+		if _, err := deliveries.Doc(r.uid).Update(ctx, []firestore.Update{{Path: "pushed", Value: true}}); err != nil {
+			log.Printf("timetable publish: dojo %s: delivery of %s: %v", dojoID, r.uid, err)
+		}
+	}
+	return nil
+}
+
+// weekText is a member's notification body: their usual classes this week
+// first, then the size of the week. It returns the usual class ids.
+func weekText(week []weekClass, usual map[string]bool) (string, []string) {
+	var mine []string
+	seen := map[string]bool{}
+	var ids []string
+	for _, c := range week {
+		if !usual[c.sess.ID] {
+			continue
+		}
+		if !seen[c.sess.ID] {
+			seen[c.sess.ID] = true
+			ids = append(ids, c.sess.ID)
+		}
+		mine = append(mine, classLabel(c))
+	}
+
+	total := fmt.Sprintf("%d classes on the timetable this week.", len(week))
+	if len(week) == 1 {
+		total = "1 class on the timetable this week."
+	}
+	if len(mine) == 0 {
+		return fmt.Sprintf("%s First up: %s.", total, classLabel(week[0])), []string{}
+	}
+	if len(mine) > maxListedClasses {
+		mine = append(mine[:maxListedClasses], fmt.Sprintf("%d more", len(mine)-maxListedClasses))
+	}
+	return fmt.Sprintf("Your classes: %s. %s", strings.Join(mine, ", "), total), ids
+}
+
+// classLabel is e.g. "Mon 18:00 Fundamentals"
+func classLabel(c weekClass) string {
+	day := ""
+	if d, err := time.Parse(instanceid.DateLayout, c.dateKey); err == nil {
+		day = d.Weekday().String()[:3] + " "
+	}
+	return day + c.sess.StartTime + " " + c.sess.Title
+}
+
+func (s *Service) fcmTokens(ctx context.Context, uid string) []string {
+	doc, err := s.fs.Collection("users").Doc(uid).Get(ctx)
+	if err != nil || !doc.Exists() {
+		return nil
+	}
+	var tokens []string
+	if raw, ok := doc.Data()["fcmTokens"].([]interface{}); ok {
+		for _, t := range raw {
+			if tok, ok := t.(string); ok && tok != "" {
+				tokens = append(tokens, tok)
+			}
+		}
+	}
+	return tokens
+}
+
+func (s *Service) push(ctx context.Context, uid string, tokens []string, title, body string, data map[string]string) error {
+	resp, err := s.messaging.SendEachForMulticast(ctx, &messaging.MulticastMessage{
+		Tokens:       tokens,
+		Notification: &messaging.Notification{Title: title, Body: body},
+		Data:         data,
+	})
+	if err != nil {
+		return err
+	}
+	if s.tokens != nil {
+		if removed, err := s.tokens.RecordResults(ctx, uid, tokens, resp); err != nil {
+			log.Printf("timetable publish: %v", err)
+		} else if removed > 0 {
+			log.Printf("timetable publish: removed %d dead fcm tokens of %s", removed, uid)
+		}
+	}
+	if resp.SuccessCount == 0 {
+		return fmt.Errorf("all %d tokens failed", resp.FailureCount)
+	}
+	return nil
+}
+
+// ListPublishes returns the dojo's latest weekly publishes, newest first (staff)
+func (s *Service) ListPublishes(ctx context.Context, dojoID string) ([]Publish, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	docs, err := s.fs.Collection("dojos").Doc(dojoID).Collection("timetablePublishes").
+		OrderBy("sentAt", firestore.Desc).Limit(maxPublishList).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list publishes: %w", err)
+	}
+	out := []Publish{}
+	for _, doc := range docs {
+		var p Publish
+		if err := doc.DataTo(&p); err != nil {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// GetPublishStats returns a week's publish with its open rate, from the read
+// flag of each recipient's notification; deleted notifications count as read
+// (staff)
+func (s *Service) GetPublishStats(ctx context.Context, dojoID, week string) (*PublishStats, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	week = strings.TrimSpace(week)
+	if dojoID == "" || week == "" || strings.Contains(week, "/") {
+		return nil, fmt.Errorf("%w: dojoId and week are required", ErrBadRequest)
+	}
+	ref := s.publishRef(dojoID, week)
+	doc, err := ref.Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to load publish: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: the week of %s was not published", ErrNotFound, week)
+	}
+	out := &PublishStats{}
+	if err := doc.DataTo(&out.Publish); err != nil {
+		return nil, fmt.Errorf("failed to decode publish: %w", err)
+	}
+
+	docs, err := ref.Collection("deliveries").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	var list []PublishDelivery
+	var refs []*firestore.DocumentRef
+	for _, d := range docs {
+		var del PublishDelivery
+		if err := d.DataTo(&del); err != nil || del.NotificationID == "" {
+			continue
+		}
+		list = append(list, del)
+		refs = append(refs, s.fs.Collection("users").Doc(del.UID).Collection("notifications").Doc(del.NotificationID))
+	}
+	if len(refs) == 0 {
+		return out, nil
+	}
+	snaps, err := s.fs.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notifications: %w", err)
+	}
+	pushed, pushedRead := 0, 0
+	for i, snap := range snaps {
+		read := true
+		if snap.Exists() {
+			read, _ = snap.Data()["read"].(bool)
+		}
+		if list[i].Pushed {
+			pushed++
+		}
+		if read {
+			out.Read++
+			if list[i].Pushed {
+				pushedRead++
+			}
+		}
+	}
+	out.ReadRate = float64(out.Read) / float64(len(list))
+	if pushed > 0 {
+		out.PushReadRate = float64(pushedRead) / float64(pushed)
+	}
+	return out, nil
+}
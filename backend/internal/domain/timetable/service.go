@@ -0,0 +1,202 @@
+package timetable
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/messaging"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/pushtokens"
+	"dojo-manager/backend/internal/domain/recurring"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Service assembles a member's view of the timetable from the session,
+// attendance and recurring booking services, so the app needs one call, and
+// publishes the week's timetable to members
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	sessionSvc    *session.Service
+	attendanceSvc *attendance.Service
+	recurringSvc  *recurring.Service  // recurring booking status (optional)
+	messaging     *messaging.Client   // FCM for the weekly publish (optional)
+	tokens        *pushtokens.Service // drops dead FCM tokens (optional)
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, sessionSvc *session.Service, attendanceSvc *attendance.Service) *Service {
+	return &Service{fs: fs, dojoRepo: dojoRepo, sessionSvc: sessionSvc, attendanceSvc: attendanceSvc}
+}
+
+// SetRecurringService adds the member's recurring bookings to the timetable
+func (s *Service) SetRecurringService(recurringSvc *recurring.Service) {
+	s.recurringSvc = recurringSvc
+}
+
+// SetMessagingClient pushes the weekly publish to members' devices as well
+// as their in-app notifications
+func (s *Service) SetMessagingClient(msg *messaging.Client) {
+	s.messaging = msg
+}
+
+// SetTokenService lets push sends remove tokens FCM rejects
+func (s *Service) SetTokenService(tokens *pushtokens.Service) {
+	s.tokens = tokens
+}
+
+// ForMember returns the active classes of the week from now, each with
+// whether the caller may join it, their booking of its next instance and how
+// often they attended it lately
+func (s *Service) ForMember(ctx context.Context, uid, dojoID string, now time.Time) (*MemberTimetable, error) {
+	dojoID = strings.TrimSpace(dojoID)
+	if dojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, dojoID, uid); err != nil {
+		isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check staff status: %w", err)
+		}
+		if !isStaff {
+			return nil, fmt.Errorf("%w: only dojo members can view the timetable", ErrUnauthorized)
+		}
+	}
+
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	out := &MemberTimetable{
+		From:     today.Format(instanceid.DateLayout),
+		Weeks:    frequencyWeeks,
+		Classes:  []ClassEntry{},
+		Calendar: s.dojoRepo.Calendar(ctx, dojoID),
+	}
+
+	classes, err := s.sessionSvc.List(ctx, dojoID, session.ListSessionsInput{ActiveOnly: true, Limit: 100})
+	if err != nil {
+		return nil, err
+	}
+	if len(classes) == 0 {
+		return out, nil
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		if classes[i].DayOfWeek != classes[j].DayOfWeek {
+			return out.Calendar.DayIndex(classes[i].DayOfWeek) < out.Calendar.DayIndex(classes[j].DayOfWeek)
+		}
+		return classes[i].StartTime < classes[j].StartTime
+	})
+
+	check, err := s.sessionSvc.EligibilityFor(ctx, dojoID, uid)
+	if err != nil {
+		return nil, err
+	}
+	attended, err := s.attendedByClass(ctx, dojoID, uid, today)
+	if err != nil {
+		return nil, err
+	}
+
+	var instanceIDs []string
+	for i := range classes {
+		sess := &classes[i]
+		entry := ClassEntry{Class: *sess, Eligible: true}
+		for d := 0; d < 7; d++ {
+			dateKey := today.AddDate(0, 0, d).Format(instanceid.DateLayout)
+			if sess.HeldOn(dateKey) {
+				entry.Date = dateKey
+				entry.InstanceID = instanceid.New(dateKey, sess.ID)
+				instanceIDs = append(instanceIDs, entry.InstanceID)
+				break
+			}
+		}
+		if entry.Date != "" {
+			if err := check(sess, entry.Date); err != nil {
+				entry.Eligible = false
+				entry.IneligibleReason = strings.TrimPrefix(err.Error(), session.ErrIneligible.Error()+": ")
+			}
+		}
+
+		entry.Attended = attended[sess.ID]
+		entry.Held = heldSince(sess, today)
+		if entry.Held > 0 {
+			entry.Rate = float64(entry.Attended) / float64(entry.Held)
+			if entry.Rate > 1 {
+				entry.Rate = 1 // attendance recorded for an instance off the timetable
+			}
+		}
+		entry.Usual = entry.Held > 0 && entry.Rate >= usualRate
+		out.Classes = append(out.Classes, entry)
+	}
+
+	reservations, err := s.sessionSvc.MemberReservations(ctx, dojoID, uid, instanceIDs)
+	if err != nil {
+		return nil, err
+	}
+	holds := map[string]string{}
+	if s.recurringSvc != nil {
+		list, err := s.recurringSvc.List(ctx, uid, dojoID, recurring.ListInput{})
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range list {
+			if b.MemberUID == uid {
+				holds[b.SessionID] = b.Status
+			}
+		}
+	}
+	for i := range out.Classes {
+		entry := &out.Classes[i]
+		if r, ok := reservations[entry.InstanceID]; ok {
+			entry.Booking = r.Status
+		}
+		entry.Recurring = holds[entry.Class.ID]
+	}
+	return out, nil
+}
+
+// attendedByClass counts the member's check-ins per class over the window,
+// one per instance
+func (s *Service) attendedByClass(ctx context.Context, dojoID, uid string, today time.Time) (map[string]int, error) {
+	records, err := s.attendanceSvc.List(ctx, attendance.ListAttendanceInput{
+		DojoID:    dojoID,
+		MemberUID: uid,
+		Statuses:  []string{string(attendance.StatusPresent), string(attendance.StatusLate)},
+		From:      today.AddDate(0, 0, -7*frequencyWeeks).Format(instanceid.DateLayout),
+		Limit:     500,
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	out := map[string]int{}
+	for _, att := range records {
+		sessionID := instanceid.SessionID(att.SessionInstanceID)
+		if sessionID == "" || seen[att.SessionInstanceID] {
+			continue
+		}
+		seen[att.SessionInstanceID] = true
+		out[sessionID]++
+	}
+	return out, nil
+}
+
+// heldSince counts the instances of the class over the window before today,
+// from when the class was created
+func heldSince(sess *session.Session, today time.Time) int {
+	n := 0
+	for d := 1; d <= 7*frequencyWeeks; d++ {
+		day := today.AddDate(0, 0, -d)
+		if !sess.CreatedAt.IsZero() && day.Before(sess.CreatedAt.UTC().Truncate(24*time.Hour)) {
+			break
+		}
+		if sess.HeldOn(day.Format(instanceid.DateLayout)) {
+			n++
+		}
+	}
+	return n
+}
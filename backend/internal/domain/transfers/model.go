@@ -0,0 +1,92 @@
+package transfers
+
+import (
+	"strings"
+	"time"
+)
+
+// Transfer statuses
+const (
+	StatusPending   = "pending"
+	StatusAccepted  = "accepted"
+	StatusDeclined  = "declined"
+	StatusCancelled = "cancelled"
+)
+
+// Audit log types, one entry in each dojo's log
+const (
+	AuditTransferOut = "member.transfer_out"
+	AuditTransferIn  = "member.transfer_in"
+)
+
+// Directions for ListInput
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+const maxNoteLength = 500
+
+// Transfer is memberTransfers/{id}, a member moving from one dojo to
+// another. Belt, stripes and the attendance summary are as of initiation.
+type Transfer struct {
+	ID           string `firestore:"-" json:"id"`
+	MemberUID    string `firestore:"memberUid" json:"memberUid"`
+	MemberName   string `firestore:"memberName,omitempty" json:"memberName,omitempty"`
+	FromDojoID   string `firestore:"fromDojoId" json:"fromDojoId"`
+	FromDojoName string `firestore:"fromDojoName,omitempty" json:"fromDojoName,omitempty"`
+	ToDojoID     string `firestore:"toDojoId" json:"toDojoId"`
+	ToDojoName   string `firestore:"toDojoName,omitempty" json:"toDojoName,omitempty"`
+
+	BeltRank   string             `firestore:"beltRank,omitempty" json:"beltRank,omitempty"`
+	Stripes    int                `firestore:"stripes" json:"stripes"`
+	Attendance *AttendanceSummary `firestore:"attendance,omitempty" json:"attendance,omitempty"` // when included
+	Note       string             `firestore:"note,omitempty" json:"note,omitempty"`
+
+	Status        string     `firestore:"status" json:"status"`
+	InitiatedBy   string     `firestore:"initiatedBy" json:"initiatedBy"`
+	ReviewedBy    string     `firestore:"reviewedBy,omitempty" json:"reviewedBy,omitempty"`
+	ReviewedAt    *time.Time `firestore:"reviewedAt,omitempty" json:"reviewedAt,omitempty"`
+	ReviewNote    string     `firestore:"reviewNote,omitempty" json:"reviewNote,omitempty"`
+	HistoryCopied int        `firestore:"historyCopied,omitempty" json:"historyCopied,omitempty"` // rank history records
+	CreatedAt     time.Time  `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time  `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// AttendanceSummary is the member's check-ins at the origin dojo. The
+// records stay there; the summary is appended to priorAttendance on the
+// member doc in the destination.
+type AttendanceSummary struct {
+	FromDojoID   string     `firestore:"fromDojoId" json:"fromDojoId"`
+	FromDojoName string     `firestore:"fromDojoName,omitempty" json:"fromDojoName,omitempty"`
+	Checkins     int        `firestore:"checkins" json:"checkins"`
+	Late         int        `firestore:"late" json:"late"`
+	FirstAt      *time.Time `firestore:"firstAt,omitempty" json:"firstAt,omitempty"`
+	LastAt       *time.Time `firestore:"lastAt,omitempty" json:"lastAt,omitempty"`
+}
+
+// InitiateInput starts a transfer out of the dojo
+type InitiateInput struct {
+	MemberUID         string `json:"memberUid"`
+	ToDojoID          string `json:"toDojoId"`
+	IncludeAttendance bool   `json:"includeAttendance,omitempty"`
+	Note              string `json:"note,omitempty"`
+}
+
+func (in *InitiateInput) Trim() {
+	in.MemberUID = strings.TrimSpace(in.MemberUID)
+	in.ToDojoID = strings.TrimSpace(in.ToDojoID)
+	in.Note = strings.TrimSpace(in.Note)
+}
+
+// ReviewInput accepts or declines an incoming transfer
+type ReviewInput struct {
+	Note string `json:"note,omitempty"`
+}
+
+// ListInput filters a dojo's transfers; Direction is required
+type ListInput struct {
+	DojoID    string
+	Direction string
+	Status    string // all when empty
+}
@@ -0,0 +1,462 @@
+package transfers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/audit"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/fsdoc"
+)
+
+// Service moves members between dojos. Staff of the origin dojo initiate a
+// transfer and staff of the destination accept or decline it. On accepting,
+// the member joins the destination with their belt and rank history (and,
+// if the origin included it, a summary of their attendance), the origin
+// keeps them as an inactive member pointing at the new dojo, and both dojos'
+// audit logs record the move. The router checks the members permission.
+type Service struct {
+	fs            *firestore.Client
+	dojoRepo      *dojo.Repo
+	membersSvc    *members.Service
+	ranksRepo     *ranks.Repo
+	attendanceSvc *attendance.Service
+	auditSvc      *audit.Service
+}
+
+func NewService(fs *firestore.Client, dojoRepo *dojo.Repo, membersSvc *members.Service, ranksRepo *ranks.Repo, attendanceSvc *attendance.Service, auditSvc *audit.Service) *Service {
+	return &Service{
+		fs:            fs,
+		dojoRepo:      dojoRepo,
+		membersSvc:    membersSvc,
+		ranksRepo:     ranksRepo,
+		attendanceSvc: attendanceSvc,
+		auditSvc:      auditSvc,
+	}
+}
+
+func (s *Service) col() *firestore.CollectionRef {
+	return s.fs.Collection("memberTransfers")
+}
+
+func (s *Service) memberRef(dojoID, memberUID string) *firestore.DocumentRef {
+	return s.fs.Collection("dojos").Doc(dojoID).Collection("members").Doc(memberUID)
+}
+
+func (s *Service) requireStaff(ctx context.Context, dojoID, uid string) error {
+	isStaff, err := s.dojoRepo.IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return fmt.Errorf("failed to check staff status: %w", err)
+	}
+	if !isStaff {
+		return fmt.Errorf("%w: staff permission required", ErrUnauthorized)
+	}
+	return nil
+}
+
+// Initiate starts a transfer of one of the dojo's members to another dojo
+// on the platform. A member has at most one pending transfer.
+func (s *Service) Initiate(ctx context.Context, staffUID, dojoID string, in InitiateInput) (*Transfer, error) {
+	in.Trim()
+	if dojoID == "" || in.MemberUID == "" || in.ToDojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId, memberUid and toDojoId are required", ErrBadRequest)
+	}
+	if in.ToDojoID == dojoID {
+		return nil, fmt.Errorf("%w: toDojoId must be another dojo", ErrBadRequest)
+	}
+	if len(in.Note) > maxNoteLength {
+		return nil, fmt.Errorf("%w: note must be at most %d characters", ErrBadRequest, maxNoteLength)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.memberRef(dojoID, in.MemberUID).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: member not found", ErrNotFound)
+	}
+	m, err := fsdoc.As[fsdoc.Member](doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode member: %w", err)
+	}
+	if m.RoleName() == members.RoleOwner {
+		return nil, fmt.Errorf("%w: the dojo owner cannot be transferred", ErrBadRequest)
+	}
+	if moved, _ := doc.Data()["transferredTo"].(string); moved != "" {
+		return nil, fmt.Errorf("%w: member has already transferred to another dojo", ErrConflict)
+	}
+
+	from, err := s.dojoRepo.GetDojo(ctx, dojoID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dojo not found", ErrNotFound)
+	}
+	to, err := s.dojoRepo.GetDojo(ctx, in.ToDojoID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: destination dojo not found", ErrNotFound)
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, in.ToDojoID, in.MemberUID); err == nil {
+		return nil, fmt.Errorf("%w: member already belongs to the destination dojo", ErrConflict)
+	}
+	if pending, err := s.pendingFor(ctx, in.MemberUID); err != nil {
+		return nil, err
+	} else if pending != nil {
+		return nil, fmt.Errorf("%w: member already has a pending transfer to %s", ErrConflict, pending.ToDojoName)
+	}
+
+	now := time.Now().UTC()
+	t := &Transfer{
+		ID:           s.col().NewDoc().ID,
+		MemberUID:    in.MemberUID,
+		MemberName:   m.DisplayName,
+		FromDojoID:   dojoID,
+		FromDojoName: from.Name,
+		ToDojoID:     in.ToDojoID,
+		ToDojoName:   to.Name,
+		BeltRank:     m.BeltRank,
+		Stripes:      m.Stripes,
+		Note:         in.Note,
+		Status:       StatusPending,
+		InitiatedBy:  staffUID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if t.BeltRank == "" {
+		t.BeltRank = "white"
+	}
+	if in.IncludeAttendance {
+		if t.Attendance, err = s.attendanceSummary(ctx, dojoID, from.Name, in.MemberUID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.col().Doc(t.ID).Create(ctx, t); err != nil {
+		return nil, fmt.Errorf("failed to save transfer: %w", err)
+	}
+
+	if staff, err := s.dojoRepo.ListStaffUIDs(ctx, t.ToDojoID); err == nil {
+		body := fmt.Sprintf("%s is transferring from %s", memberLabel(t), t.FromDojoName)
+		for _, uid := range staff {
+			s.notify(ctx, uid, t.ToDojoID, "Member transfer requested", body, t)
+		}
+	} else {
+		log.Printf("transfers: failed to list staff of %s: %v", t.ToDojoID, err)
+	}
+	s.notify(ctx, t.MemberUID, t.FromDojoID, "Transfer started", "Your membership is being transferred to "+t.ToDojoName, t)
+	return t, nil
+}
+
+// attendanceSummary sums up the member's check-ins at the dojo
+func (s *Service) attendanceSummary(ctx context.Context, dojoID, dojoName, memberUID string) (*AttendanceSummary, error) {
+	list, err := s.attendanceSvc.MemberCheckins(ctx, dojoID, memberUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize attendance: %w", err)
+	}
+	sum := &AttendanceSummary{FromDojoID: dojoID, FromDojoName: dojoName, Checkins: len(list)}
+	for i, a := range list {
+		if a.Status == attendance.StatusLate {
+			sum.Late++
+		}
+		at := a.CreatedAt
+		if i == 0 {
+			sum.FirstAt = &at
+		}
+		if i == len(list)-1 {
+			sum.LastAt = &at
+		}
+	}
+	return sum, nil
+}
+
+// Accept completes an incoming transfer (staff of the destination). The
+// steps can be repeated, so a transfer that fails halfway is accepted again.
+func (s *Service) Accept(ctx context.Context, staffUID, dojoID, id string, in ReviewInput, ip, userAgent string) (*Transfer, error) {
+	in.Note = strings.TrimSpace(in.Note)
+	if len(in.Note) > maxNoteLength {
+		return nil, fmt.Errorf("%w: note must be at most %d characters", ErrBadRequest, maxNoteLength)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	t, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.ToDojoID != dojoID {
+		return nil, fmt.Errorf("%w: transfer not found", ErrNotFound)
+	}
+	if t.Status != StatusPending {
+		return nil, fmt.Errorf("%w: transfer is already %s", ErrConflict, t.Status)
+	}
+	if _, err := s.dojoRepo.GetMember(ctx, t.FromDojoID, t.MemberUID); err != nil {
+		return nil, fmt.Errorf("%w: member is no longer in %s", ErrConflict, t.FromDojoName)
+	}
+
+	// a retry finds the member already added
+	if _, err := s.dojoRepo.GetMember(ctx, t.ToDojoID, t.MemberUID); err != nil {
+		_, err := s.membersSvc.AddMember(ctx, staffUID, members.AddMemberInput{
+			DojoID:    t.ToDojoID,
+			MemberUID: t.MemberUID,
+			BeltRank:  t.BeltRank,
+			Stripes:   t.Stripes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	copied, err := s.ranksRepo.ApplyMemberTransfer(ctx, t.FromDojoID, t.FromDojoName, t.ToDojoID, t.MemberUID, staffUID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Attendance != nil {
+		_, err := s.memberRef(t.ToDojoID, t.MemberUID).Update(ctx, []firestore.Update{
+			{Path: "priorAttendance", Value: firestore.ArrayUnion(*t.Attendance)},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save attendance summary: %w", err)
+		}
+	}
+	if err := s.membersSvc.MarkTransferred(ctx, t.FromDojoID, t.MemberUID, t.ToDojoID, t.ToDojoName, staffUID); err != nil {
+		return nil, err
+	}
+
+	t, err = s.close(ctx, id, StatusAccepted, staffUID, in.Note, copied)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"transferId":    t.ID,
+		"fromDojoId":    t.FromDojoID,
+		"toDojoId":      t.ToDojoID,
+		"beltRank":      t.BeltRank,
+		"stripes":       t.Stripes,
+		"historyCopied": t.HistoryCopied,
+		"attendance":    t.Attendance != nil,
+	}
+	for _, e := range []audit.Entry{
+		{Type: AuditTransferOut, DojoID: t.FromDojoID, ActorUID: t.InitiatedBy},
+		{Type: AuditTransferIn, DojoID: t.ToDojoID, ActorUID: staffUID},
+	} {
+		e.UID = t.MemberUID
+		e.IP = ip
+		e.UserAgent = userAgent
+		e.Data = data
+		e.At = *t.ReviewedAt
+		if err := s.auditSvc.Record(ctx, e); err != nil {
+			log.Printf("transfers: failed to record %s for %s: %v", e.Type, t.ID, err)
+		}
+	}
+
+	s.notify(ctx, t.MemberUID, t.ToDojoID, "Welcome to "+t.ToDojoName, "Your membership, belt and rank history have moved to "+t.ToDojoName, t)
+	s.notify(ctx, t.InitiatedBy, t.FromDojoID, "Transfer accepted", fmt.Sprintf("%s has joined %s", memberLabel(t), t.ToDojoName), t)
+	return t, nil
+}
+
+// Decline turns down an incoming transfer (staff of the destination)
+func (s *Service) Decline(ctx context.Context, staffUID, dojoID, id string, in ReviewInput) (*Transfer, error) {
+	t, err := s.review(ctx, staffUID, dojoID, id, in, StatusDeclined)
+	if err != nil {
+		return nil, err
+	}
+	body := fmt.Sprintf("%s declined the transfer of %s", t.ToDojoName, memberLabel(t))
+	if t.ReviewNote != "" {
+		body += ": " + t.ReviewNote
+	}
+	s.notify(ctx, t.InitiatedBy, t.FromDojoID, "Transfer declined", body, t)
+	return t, nil
+}
+
+// Cancel withdraws an outgoing transfer (staff of the origin)
+func (s *Service) Cancel(ctx context.Context, staffUID, dojoID, id string, in ReviewInput) (*Transfer, error) {
+	return s.review(ctx, staffUID, dojoID, id, in, StatusCancelled)
+}
+
+// review closes a pending transfer without moving the member; declining is
+// for the destination, cancelling for the origin
+func (s *Service) review(ctx context.Context, staffUID, dojoID, id string, in ReviewInput, status string) (*Transfer, error) {
+	in.Note = strings.TrimSpace(in.Note)
+	if len(in.Note) > maxNoteLength {
+		return nil, fmt.Errorf("%w: note must be at most %d characters", ErrBadRequest, maxNoteLength)
+	}
+	if err := s.requireStaff(ctx, dojoID, staffUID); err != nil {
+		return nil, err
+	}
+	t, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	side := t.ToDojoID
+	if status == StatusCancelled {
+		side = t.FromDojoID
+	}
+	if side != dojoID {
+		return nil, fmt.Errorf("%w: transfer not found", ErrNotFound)
+	}
+	return s.close(ctx, id, status, staffUID, in.Note, 0)
+}
+
+// close moves a pending transfer to its final status
+func (s *Service) close(ctx context.Context, id, status, staffUID, note string, copied int) (*Transfer, error) {
+	ref := s.col().Doc(id)
+	var t Transfer
+	err := s.fs.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("failed to get transfer: %w", err)
+		}
+		if err := doc.DataTo(&t); err != nil {
+			return fmt.Errorf("failed to decode transfer: %w", err)
+		}
+		if t.Status != StatusPending {
+			return fmt.Errorf("%w: transfer is already %s", ErrConflict, t.Status)
+		}
+		now := time.Now().UTC()
+		t.Status = status
+		t.ReviewedBy = staffUID
+		t.ReviewedAt = &now
+		t.ReviewNote = note
+		t.HistoryCopied = copied
+		t.UpdatedAt = now
+		return tx.Set(ref, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.ID = id
+	return &t, nil
+}
+
+// Get returns a transfer from or to the dojo
+func (s *Service) Get(ctx context.Context, dojoID, id string) (*Transfer, error) {
+	t, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.FromDojoID != dojoID && t.ToDojoID != dojoID {
+		return nil, fmt.Errorf("%w: transfer not found", ErrNotFound)
+	}
+	return t, nil
+}
+
+// List returns the dojo's incoming or outgoing transfers, newest first
+func (s *Service) List(ctx context.Context, in ListInput) ([]Transfer, error) {
+	if in.DojoID == "" {
+		return nil, fmt.Errorf("%w: dojoId is required", ErrBadRequest)
+	}
+	field := "toDojoId"
+	switch in.Direction {
+	case DirectionIncoming:
+	case DirectionOutgoing:
+		field = "fromDojoId"
+	default:
+		return nil, fmt.Errorf("%w: direction must be incoming or outgoing", ErrBadRequest)
+	}
+	switch in.Status {
+	case "", StatusPending, StatusAccepted, StatusDeclined, StatusCancelled:
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, accepted, declined or cancelled", ErrBadRequest)
+	}
+
+	q := s.col().Where(field, "==", in.DojoID)
+	if in.Status != "" {
+		q = q.Where("status", "==", in.Status)
+	}
+	out, err := s.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	// ordered in memory: a createdAt order would need a composite index
+	slices.SortFunc(out, func(a, b Transfer) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return out, nil
+}
+
+// pendingFor returns the member's pending transfer, if any
+func (s *Service) pendingFor(ctx context.Context, memberUID string) (*Transfer, error) {
+	list, err := s.query(ctx, s.col().Where("memberUid", "==", memberUID).Where("status", "==", StatusPending).Limit(1))
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+func (s *Service) query(ctx context.Context, q firestore.Query) ([]Transfer, error) {
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	out := []Transfer{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list transfers: %w", err)
+		}
+		var t Transfer
+		if err := doc.DataTo(&t); err != nil {
+			continue
+		}
+		t.ID = doc.Ref.ID
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func (s *Service) get(ctx context.Context, id string) (*Transfer, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrBadRequest)
+	}
+	doc, err := s.col().Doc(id).Get(ctx)
+	if err != nil && doc == nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+	if !doc.Exists() {
+		return nil, fmt.Errorf("%w: transfer not found", ErrNotFound)
+	}
+	var t Transfer
+	if err := doc.DataTo(&t); err != nil {
+		return nil, fmt.Errorf("failed to decode transfer: %w", err)
+	}
+	t.ID = doc.Ref.ID
+	return &t, nil
+}
+
+func memberLabel(t *Transfer) string {
+	if t.MemberName != "" {
+		return t.MemberName
+	}
+	return "A member"
+}
+
+// notify writes an in-app notification (best effort)
+func (s *Service) notify(ctx context.Context, uid, dojoID, title, body string, t *Transfer) {
+	_, _, err := s.fs.Collection("users").Doc(uid).Collection("notifications").Add(ctx, map[string]interface{}{
+		"title": title,
+		"body":  body,
+		"type":  "member_transfer",
+		"data": map[string]interface{}{
+			"transferId": t.ID,
+			"memberUid":  t.MemberUID,
+			"status":     t.Status,
+		},
+		"read":      false,
+		"dojoId":    dojoID,
+		"createdAt": time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("transfers: failed to notify %s: %v", uid, err)
+	}
+}
@@ -0,0 +1,74 @@
+// Package events is an in-process bus for domain events. A domain publishes
+// what happened (an attendance record written, a join request filed) and
+// the domains that react subscribe to it, so the publisher does not import
+// or hold a reference to any of them.
+package events
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Event is a typed domain event; Name keys its subscribers
+type Event interface {
+	Name() string
+}
+
+type subscriber struct {
+	name   string // consumer name, for logs
+	handle func(ctx context.Context, e Event)
+}
+
+// Bus delivers events to their subscribers. A nil *Bus drops every event,
+// so services work unwired.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string][]subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[string][]subscriber{}}
+}
+
+// Subscribe registers fn for events of type E. consumer names the
+// subscriber in logs.
+func Subscribe[E Event](b *Bus, consumer string, fn func(ctx context.Context, e E)) {
+	var zero E
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[zero.Name()] = append(b.subs[zero.Name()], subscriber{
+		name: consumer,
+		handle: func(ctx context.Context, e Event) {
+			if typed, ok := e.(E); ok {
+				fn(ctx, typed)
+			}
+		},
+	})
+}
+
+// Publish runs the subscribers of e in the order they subscribed, on the
+// caller's goroutine, once the publisher's write has succeeded. Reactions
+// are side effects: a subscriber that panics is logged and the rest still
+// run. Subscribers doing slow I/O should hand it off themselves.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	subs := b.subs[e.Name()]
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		deliver(ctx, sub, e)
+	}
+}
+
+func deliver(ctx context.Context, sub subscriber, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("events: %s handling %s panicked: %v\n%s", sub.name, e.Name(), r, debug.Stack())
+		}
+	}()
+	sub.handle(ctx, e)
+}
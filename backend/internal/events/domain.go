@@ -0,0 +1,92 @@
+package events
+
+import "time"
+
+// AttendanceRecorded is published after one attendance record is created or
+// updated (staff roll call, kiosk or badge check-in)
+type AttendanceRecorded struct {
+	DojoID            string
+	SessionInstanceID string
+	MemberUID         string
+	Status            string
+	RecordedBy        string // staff uid or "device:{deviceId}"
+	Created           bool   // false when an existing record was updated
+}
+
+func (AttendanceRecorded) Name() string { return "attendance.recorded" }
+
+// Checkin reports whether the member is counted in the class (present or late)
+func (e AttendanceRecorded) Checkin() bool {
+	return e.Status == "present" || e.Status == "late"
+}
+
+// AttendanceSheetRecorded is published after a bulk roll call of one class
+// instance is written
+type AttendanceSheetRecorded struct {
+	DojoID            string
+	SessionInstanceID string
+	RecordedBy        string
+	NewCheckins       int      // check-ins among the records created (not updated)
+	CheckedIn         []string // members of those new check-ins
+	HasCheckins       bool     // the sheet marks anyone present or late
+}
+
+func (AttendanceSheetRecorded) Name() string { return "attendance.sheet_recorded" }
+
+// AttendanceCheckedOut is published after staff check a member out of a class
+type AttendanceCheckedOut struct {
+	DojoID            string
+	SessionInstanceID string
+	MemberUID         string
+	RecordedBy        string
+	At                time.Time
+}
+
+func (AttendanceCheckedOut) Name() string { return "attendance.checked_out" }
+
+// JoinRequested is published after someone asks to join a dojo
+type JoinRequested struct {
+	DojoID   string
+	UID      string
+	FullName string
+	Belt     string
+}
+
+func (JoinRequested) Name() string { return "dojo.join_requested" }
+
+// PlanPaymentFailed is published after Stripe fails to charge a dojo's plan
+type PlanPaymentFailed struct {
+	DojoID    string
+	InvoiceID string
+	Amount    string // formatted, e.g. "49.00 USD"
+}
+
+func (PlanPaymentFailed) Name() string { return "stripe.plan_payment_failed" }
+
+// AttendanceCorrected is published after staff edit an existing attendance
+// record
+type AttendanceCorrected struct {
+	DojoID       string
+	AttendanceID string
+	ChangedBy    string
+}
+
+func (AttendanceCorrected) Name() string { return "attendance.corrected" }
+
+// Member roster changes carried by MemberChanged
+const (
+	MemberAdded   = "added"
+	MemberUpdated = "updated"
+	MemberRemoved = "removed"
+)
+
+// MemberChanged is published after a member is added to, updated in or
+// removed from a dojo's roster
+type MemberChanged struct {
+	DojoID    string
+	MemberUID string
+	ChangedBy string
+	Change    string // MemberAdded, MemberUpdated or MemberRemoved
+}
+
+func (MemberChanged) Name() string { return "members.changed" }
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"dojo-manager/backend/internal/config"
+	"dojo-manager/backend/internal/fsreads"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go/v4"
@@ -15,11 +16,10 @@ import (
 func NewApp(ctx context.Context, cfg config.Config) (*firebase.App, error) {
 	// Prefer GOOGLE_APPLICATION_CREDENTIALS (service account json file path)
 	// Or FIREBASE_SERVICE_ACCOUNT_JSON (raw json content)
-	opts := []option.ClientOption{}
+	opts := CredentialOptions()
 
-	if json := getenv("FIREBASE_SERVICE_ACCOUNT_JSON", ""); json != "" {
-		opts = append(opts, option.WithCredentialsJSON([]byte(json)))
-	}
+	// Count Firestore reads per request for the X-Firestore-Reads debug header
+	opts = append(opts, fsreads.ClientOptions()...)
 
 	// If ProjectID is set, pass it (useful when running locally)
 	appCfg := &firebase.Config{}
@@ -27,10 +27,16 @@ func NewApp(ctx context.Context, cfg config.Config) (*firebase.App, error) {
 		appCfg.ProjectID = cfg.ProjectID
 	}
 
-	if len(opts) > 0 {
-		return firebase.NewApp(ctx, appCfg, opts...)
+	return firebase.NewApp(ctx, appCfg, opts...)
+}
+
+// CredentialOptions returns client options for FIREBASE_SERVICE_ACCOUNT_JSON (if set)
+func CredentialOptions() []option.ClientOption {
+	opts := []option.ClientOption{}
+	if json := getenv("FIREBASE_SERVICE_ACCOUNT_JSON", ""); json != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(json)))
 	}
-	return firebase.NewApp(ctx, appCfg)
+	return opts
 }
 
 func NewAuthClient(ctx context.Context, app *firebase.App) (*auth.Client, error) {
@@ -0,0 +1,165 @@
+package firebase
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/option"
+)
+
+// ClientResolver routes a dojo's documents to the Firestore database that holds them.
+// Repos that store dojo-scoped subcollections depend on this instead of a fixed client.
+type ClientResolver interface {
+	ClientFor(ctx context.Context, dojoID string) (*firestore.Client, error)
+}
+
+// DojoLocation is a dojoRegistry/{dojoId} document in the default database.
+// Empty ProjectID / DatabaseID mean the default project / "(default)" database.
+type DojoLocation struct {
+	Region     string `firestore:"region,omitempty" json:"region,omitempty"`
+	ProjectID  string `firestore:"projectId,omitempty" json:"projectId,omitempty"`
+	DatabaseID string `firestore:"databaseId,omitempty" json:"databaseId,omitempty"`
+}
+
+func (l DojoLocation) isDefault() bool {
+	return l.ProjectID == "" && (l.DatabaseID == "" || l.DatabaseID == firestore.DefaultDatabaseID)
+}
+
+// registryCacheTTL bounds how long a dojo -> database route is trusted
+const registryCacheTTL = 10 * time.Minute
+
+type registryEntry struct {
+	loc       DojoLocation
+	fetchedAt time.Time
+}
+
+// DojoRegistry resolves per-dojo data residency. Dojos without a registry
+// entry live in the default database; others get a (cached) client for their
+// regional database or project (Firestore multi-database).
+type DojoRegistry struct {
+	defaultClient *firestore.Client
+	projectID     string
+	opts          []option.ClientOption
+
+	mu      sync.Mutex
+	routes  map[string]registryEntry
+	clients map[string]*firestore.Client // "project/database" -> client
+}
+
+func NewDojoRegistry(defaultClient *firestore.Client, projectID string, opts ...option.ClientOption) *DojoRegistry {
+	return &DojoRegistry{
+		defaultClient: defaultClient,
+		projectID:     projectID,
+		opts:          opts,
+		routes:        make(map[string]registryEntry),
+		clients:       make(map[string]*firestore.Client),
+	}
+}
+
+// ClientFor returns the Firestore client holding the dojo's data
+func (r *DojoRegistry) ClientFor(ctx context.Context, dojoID string) (*firestore.Client, error) {
+	loc, err := r.Location(ctx, dojoID)
+	if err != nil {
+		return nil, err
+	}
+	if loc.isDefault() {
+		return r.defaultClient, nil
+	}
+	return r.clientFor(ctx, loc)
+}
+
+// Location reads dojoRegistry/{dojoId} (cached)
+func (r *DojoRegistry) Location(ctx context.Context, dojoID string) (DojoLocation, error) {
+	now := time.Now()
+	r.mu.Lock()
+	e, ok := r.routes[dojoID]
+	r.mu.Unlock()
+	if ok && now.Sub(e.fetchedAt) < registryCacheTTL {
+		return e.loc, nil
+	}
+
+	var loc DojoLocation
+	doc, err := r.defaultClient.Collection("dojoRegistry").Doc(dojoID).Get(ctx)
+	if err == nil && doc.Exists() {
+		if err := doc.DataTo(&loc); err != nil {
+			return DojoLocation{}, fmt.Errorf("dojoRegistry/%s: %w", dojoID, err)
+		}
+	} else if err != nil && doc == nil {
+		// a missing doc comes back as NotFound with a non-nil snapshot;
+		// anything else is a lookup failure and must not fall back to the default database
+		return DojoLocation{}, fmt.Errorf("dojoRegistry/%s: %w", dojoID, err)
+	}
+
+	r.mu.Lock()
+	r.routes[dojoID] = registryEntry{loc: loc, fetchedAt: now}
+	r.mu.Unlock()
+	return loc, nil
+}
+
+// SetLocation registers where a dojo's data lives (before any data is written)
+func (r *DojoRegistry) SetLocation(ctx context.Context, dojoID string, loc DojoLocation) error {
+	if _, err := r.defaultClient.Collection("dojoRegistry").Doc(dojoID).Set(ctx, loc); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.routes[dojoID] = registryEntry{loc: loc, fetchedAt: time.Now()}
+	r.mu.Unlock()
+	return nil
+}
+
+// DeleteLocation removes a dojo's registry entry, once its data is gone
+func (r *DojoRegistry) DeleteLocation(ctx context.Context, dojoID string) error {
+	if _, err := r.defaultClient.Collection("dojoRegistry").Doc(dojoID).Delete(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	delete(r.routes, dojoID)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *DojoRegistry) clientFor(ctx context.Context, loc DojoLocation) (*firestore.Client, error) {
+	project := loc.ProjectID
+	if project == "" {
+		project = r.projectID
+	}
+	database := loc.DatabaseID
+	if database == "" {
+		database = firestore.DefaultDatabaseID
+	}
+	key := project + "/" + database
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.clients[key]; ok {
+		return c, nil
+	}
+	c, err := firestore.NewClientWithDatabase(ctx, project, database, r.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("firestore client for %s: %w", key, err)
+	}
+	r.clients[key] = c
+	return c, nil
+}
+
+// Close closes the regional clients (the default client is owned by the caller)
+func (r *DojoRegistry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, c := range r.clients {
+		_ = c.Close()
+		delete(r.clients, key)
+	}
+}
+
+// DefaultResolver always returns the same client (single-database deployments)
+type DefaultResolver struct {
+	Client *firestore.Client
+}
+
+func (d DefaultResolver) ClientFor(context.Context, string) (*firestore.Client, error) {
+	return d.Client, nil
+}
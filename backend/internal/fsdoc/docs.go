@@ -0,0 +1,130 @@
+package fsdoc
+
+import (
+	"time"
+
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// Member is dojos/{dojoId}/members/{uid} as read by reports. Writers use
+// their own domain models; this covers the fields older clients also set.
+type Member struct {
+	UID         string    `firestore:"uid"`
+	RoleInDojo  string    `firestore:"roleInDojo"`
+	Role        string    `firestore:"role"` // older docs
+	Status      string    `firestore:"status"`
+	DisplayName string    `firestore:"displayName"`
+	Email       string    `firestore:"email"`
+	BeltRank    string    `firestore:"beltRank"`
+	Stripes     int       `firestore:"stripes"`
+	IsKids      bool      `firestore:"isKids"`
+	PhotoURL    string    `firestore:"photoURL"`
+	DateOfBirth string    `firestore:"dateOfBirth"` // YYYY-MM-DD, copied from the profile
+	JoinedAt    time.Time `firestore:"joinedAt"`
+	CreatedAt   time.Time `firestore:"createdAt"`
+
+	// Suspension dates, YYYY-MM-DD and inclusive; no end date means until
+	// lifted. Written by the members domain.
+	Suspension *struct {
+		StartDate string `firestore:"startDate"`
+		EndDate   string `firestore:"endDate"`
+	} `firestore:"suspension"`
+
+	// Last day (YYYY-MM-DD, inclusive) the member may not book classes after
+	// repeated no-shows. Written by the session domain.
+	BookingRestriction *struct {
+		Until string `firestore:"until"`
+	} `firestore:"bookingRestriction"`
+}
+
+// RoleName is roleInDojo, falling back to the older role field
+func (m Member) RoleName() string {
+	if m.RoleInDojo != "" {
+		return m.RoleInDojo
+	}
+	return m.Role
+}
+
+// Belt is the member's belt, white when unset
+func (m Member) Belt() string {
+	if m.BeltRank == "" {
+		return "white"
+	}
+	return m.BeltRank
+}
+
+// Since is when the member joined, falling back to when the doc was created
+func (m Member) Since() time.Time {
+	if !m.JoinedAt.IsZero() {
+		return m.JoinedAt
+	}
+	return m.CreatedAt
+}
+
+// SuspendedOn reports whether the member is suspended on dateKey (YYYY-MM-DD)
+func (m Member) SuspendedOn(dateKey string) bool {
+	sp := m.Suspension
+	return sp != nil && sp.StartDate != "" && sp.StartDate <= dateKey && (sp.EndDate == "" || dateKey <= sp.EndDate)
+}
+
+// BookingRestrictedOn reports whether the member may not book classes on
+// dateKey (YYYY-MM-DD) after repeated no-shows
+func (m Member) BookingRestrictedOn(dateKey string) bool {
+	br := m.BookingRestriction
+	return br != nil && br.Until != "" && dateKey <= br.Until
+}
+
+// Attendance is an attendance record, either dojos/{dojoId}/attendance or
+// the older dojos/{dojoId}/sessions/{sessionId}/attendance
+type Attendance struct {
+	MemberUID         string    `firestore:"memberUid"`
+	UID               string    `firestore:"uid"` // older session-level records
+	SessionInstanceID string    `firestore:"sessionInstanceId"`
+	SessionID         string    `firestore:"sessionId"`
+	Status            string    `firestore:"status"`
+	CreatedAt         time.Time `firestore:"createdAt"`
+}
+
+// Member is memberUid, falling back to the older uid field
+func (a Attendance) Member() string {
+	if a.MemberUID != "" {
+		return a.MemberUID
+	}
+	return a.UID
+}
+
+// IsCheckin reports whether the member was there (present or late)
+func (a Attendance) IsCheckin() bool {
+	return a.Status == "present" || a.Status == "late"
+}
+
+// Date is the YYYY-MM-DD of the class: the sessionInstanceId prefix
+// ("2025-01-15__classId"), else the day the record was created
+func (a Attendance) Date() string {
+	if d := instanceid.Date(a.SessionInstanceID); d != "" {
+		return d
+	}
+	if !a.CreatedAt.IsZero() {
+		return a.CreatedAt.Format("2006-01-02")
+	}
+	return ""
+}
+
+// SessionInstance is dojos/{dojoId}/sessions/{sessionId}, one held class
+type SessionInstance struct {
+	DateKey  string `firestore:"dateKey"`
+	Title    string `firestore:"title"`
+	IsActive bool   `firestore:"isActive"`
+}
+
+// Notice is dojos/{dojoId}/notices/{noticeId} as counted for plan limits
+type Notice struct {
+	Status    string     `firestore:"status"`
+	PublishAt time.Time  `firestore:"publishAt"`
+	ExpireAt  *time.Time `firestore:"expireAt"`
+}
+
+// Expired reports whether the notice has an expiry before now
+func (n Notice) Expired(now time.Time) bool {
+	return n.ExpireAt != nil && n.ExpireAt.Before(now)
+}
@@ -0,0 +1,68 @@
+// Package fsdoc decodes Firestore documents into typed structs shared across
+// domains. A document that does not fit its struct is logged and counted
+// per collection instead of being skipped silently.
+package fsdoc
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+)
+
+// ErrMalformed wraps every decode failure
+var ErrMalformed = errors.New("malformed document")
+
+// decodeErrors counts malformed documents per collection ID since boot
+var decodeErrors = expvar.NewMap("firestoreDecodeErrors")
+
+// Decode reads doc into dst, a pointer to a struct with firestore tags.
+// Missing fields and nulls leave zero values; a field of the wrong type is
+// an error.
+func Decode(doc *firestore.DocumentSnapshot, dst any) error {
+	if err := doc.DataTo(dst); err != nil {
+		collection := "unknown"
+		path := "unknown"
+		if doc.Ref != nil {
+			collection = doc.Ref.Parent.ID
+			path = doc.Ref.Path
+		}
+		decodeErrors.Add(collection, 1)
+		log.Printf("fsdoc: malformed %s: %v", path, err)
+		return fmt.Errorf("%w: %s: %v", ErrMalformed, path, err)
+	}
+	return nil
+}
+
+// As decodes doc into a new T
+func As[T any](doc *firestore.DocumentSnapshot) (T, error) {
+	var v T
+	err := Decode(doc, &v)
+	return v, err
+}
+
+// DecodeErrorCount is the number of malformed documents seen in a collection
+type DecodeErrorCount struct {
+	Collection string `json:"collection"`
+	Count      int64  `json:"count"`
+}
+
+// DecodeErrors returns the malformed document counts since boot, highest first
+func DecodeErrors() []DecodeErrorCount {
+	out := []DecodeErrorCount{}
+	decodeErrors.Do(func(kv expvar.KeyValue) {
+		if n, ok := kv.Value.(*expvar.Int); ok {
+			out = append(out, DecodeErrorCount{Collection: kv.Key, Count: n.Value()})
+		}
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Collection < out[j].Collection
+	})
+	return out
+}
@@ -0,0 +1,109 @@
+// Package fsreads counts the Firestore documents read on behalf of a
+// request. The Firestore client is built with ClientOptions, whose gRPC
+// interceptors add every document a call returns to the counter carried by
+// the call's context, so repositories need no changes to be measured.
+package fsreads
+
+import (
+	"context"
+	"sync/atomic"
+
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+type ctxKey struct{}
+
+type counter struct {
+	reads atomic.Int64
+}
+
+// WithCounter starts counting reads made with ctx or contexts derived from it
+func WithCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &counter{})
+}
+
+// Reads returns the reads counted so far, 0 when ctx has no counter
+func Reads(ctx context.Context) int64 {
+	if c, ok := ctx.Value(ctxKey{}).(*counter); ok {
+		return c.reads.Load()
+	}
+	return 0
+}
+
+func add(ctx context.Context, n int64) {
+	if n == 0 {
+		return
+	}
+	if c, ok := ctx.Value(ctxKey{}).(*counter); ok {
+		c.reads.Add(n)
+	}
+}
+
+// ClientOptions installs the counting interceptors on a Firestore client
+func ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(countUnary)),
+		option.WithGRPCDialOption(grpc.WithChainStreamInterceptor(countStream)),
+	}
+}
+
+func countUnary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if err == nil {
+		switch r := reply.(type) {
+		case *firestorepb.Document:
+			add(ctx, 1)
+		case *firestorepb.ListDocumentsResponse:
+			add(ctx, int64(len(r.GetDocuments())))
+		}
+	}
+	return err
+}
+
+func countStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil || ctx.Value(ctxKey{}) == nil {
+		return s, err
+	}
+	return &countingStream{ClientStream: s, ctx: ctx}, nil
+}
+
+// countingStream counts the documents in each streamed response. A query
+// that matches nothing is still billed one read, and so is counted as one.
+type countingStream struct {
+	grpc.ClientStream
+	ctx       context.Context
+	queryDocs int64
+	isQuery   bool
+}
+
+func (s *countingStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		if s.isQuery && s.queryDocs == 0 {
+			add(s.ctx, 1)
+			s.isQuery = false
+		}
+		return err
+	}
+	switch r := m.(type) {
+	case *firestorepb.BatchGetDocumentsResponse:
+		// missing documents are billed like found ones
+		if r.GetFound() != nil || r.GetMissing() != "" {
+			add(s.ctx, 1)
+		}
+	case *firestorepb.RunQueryResponse:
+		s.isQuery = true
+		if r.GetDocument() != nil {
+			s.queryDocs++
+			add(s.ctx, 1)
+		}
+	case *firestorepb.RunAggregationQueryResponse:
+		if r.GetResult() != nil {
+			add(s.ctx, 1)
+		}
+	}
+	return nil
+}
@@ -7,7 +7,9 @@ import (
 
 	"dojo-manager/backend/internal/authctx"
 	"dojo-manager/backend/internal/config"
+	"dojo-manager/backend/internal/domain/reminders"
 	"dojo-manager/backend/internal/firebase"
+	"dojo-manager/backend/internal/fsdoc"
 	"dojo-manager/backend/internal/httpjson"
 	"dojo-manager/backend/internal/middleware"
 	"dojo-manager/backend/internal/models"
@@ -384,8 +386,8 @@ func (h *Legacy) hasBookingConflict(ctx context.Context, dojoId, classId string,
 		if err != nil {
 			break
 		}
-		endAt, ok := snap.Data()["endAt"].(time.Time)
-		if ok && endAt.After(start) {
+		b, err := fsdoc.As[models.Booking](snap)
+		if err == nil && b.EndAt.After(start) {
 			count++
 		}
 	}
@@ -434,9 +436,12 @@ func (h *Legacy) RescheduleBooking(w http.ResponseWriter, r *http.Request) {
 		httpjson.Error(w, http.StatusNotFound, "booking not found")
 		return
 	}
-	data := snap.Data()
-	owner, _ := data["userId"].(string)
-	if owner != uid && !middleware.IsStaff(claims) {
+	booking, err := fsdoc.As[models.Booking](snap)
+	if err != nil {
+		httpjson.Error(w, http.StatusInternalServerError, "malformed booking")
+		return
+	}
+	if booking.UserID != uid && !middleware.IsStaff(claims) {
 		httpjson.Error(w, http.StatusForbidden, "not allowed")
 		return
 	}
@@ -579,7 +584,23 @@ func (h *Legacy) CreateChatMessage(w http.ResponseWriter, r *http.Request) {
 
 func (h *Legacy) SendBookingReminders(w http.ResponseWriter, r *http.Request) {
 	// In Firebase Functions TS, this was scheduled. In Go, trigger this via Cloud Scheduler hitting this endpoint.
-	httpjson.Write(w, http.StatusOK, map[string]interface{}{"todo": "send reminders (use FCM tokens + upcoming bookings)"})
+	var req reminders.RunInput
+	_ = httpjson.Read(r, &req) // body is optional
+
+	svc := reminders.NewService(h.clients.Firestore)
+	if h.clients.Messaging != nil {
+		svc.SetMessagingClient(h.clients.Messaging)
+	}
+	res, err := svc.SendBookingReminders(r.Context(), time.Now(), req)
+	if err != nil {
+		if reminders.IsErrBadRequest(err) {
+			httpjson.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		httpjson.Error(w, http.StatusInternalServerError, "send reminders failed")
+		return
+	}
+	httpjson.Write(w, http.StatusOK, res)
 }
 
 func (h *Legacy) SendNoticeReminders(w http.ResponseWriter, r *http.Request) {
@@ -849,8 +870,9 @@ func (h *Legacy) AddFcmToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	_, err := h.clients.Firestore.Collection("users").Doc(uid).Set(r.Context(), map[string]interface{}{
-		"fcmTokens": firestore.ArrayUnion(req.Token),
-		"updatedAt": time.Now(),
+		"fcmTokens":      firestore.ArrayUnion(req.Token),
+		"fcmTokenSeenAt": map[string]interface{}{req.Token: time.Now()},
+		"updatedAt":      time.Now(),
 	}, firestore.MergeAll)
 	if err != nil {
 		httpjson.Error(w, http.StatusInternalServerError, "failed")
@@ -867,8 +889,9 @@ func (h *Legacy) RemoveFcmToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	_, err := h.clients.Firestore.Collection("users").Doc(uid).Set(r.Context(), map[string]interface{}{
-		"fcmTokens": firestore.ArrayRemove(req.Token),
-		"updatedAt": time.Now(),
+		"fcmTokens":      firestore.ArrayRemove(req.Token),
+		"fcmTokenSeenAt": map[string]interface{}{req.Token: firestore.Delete},
+		"updatedAt":      time.Now(),
 	}, firestore.MergeAll)
 	if err != nil {
 		httpjson.Error(w, http.StatusInternalServerError, "failed")
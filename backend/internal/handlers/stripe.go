@@ -32,7 +32,7 @@ func NewStripe(cfg config.Config, clients *firebase.Clients) *Stripe {
 
 // Webhook handles Stripe webhook events.
 func (h *Stripe) Webhook(w http.ResponseWriter, r *http.Request) {
-	if h.cfg.StripeWebhookSecret == "" {
+	if h.cfg.Stripe.WebhookSecret == "" {
 		http.Error(w, "stripe webhook not configured", http.StatusNotImplemented)
 		return
 	}
@@ -44,7 +44,7 @@ func (h *Stripe) Webhook(w http.ResponseWriter, r *http.Request) {
 	}
 	r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-	event, err := webhook.ConstructEvent(body, r.Header.Get("Stripe-Signature"), h.cfg.StripeWebhookSecret)
+	event, err := webhook.ConstructEvent(body, r.Header.Get("Stripe-Signature"), h.cfg.Stripe.WebhookSecret)
 	if err != nil {
 		http.Error(w, "signature verification failed", http.StatusBadRequest)
 		return
@@ -71,11 +71,11 @@ type checkoutReq struct {
 }
 
 func (h *Stripe) CreateCheckoutSession(w http.ResponseWriter, r *http.Request) {
-	if h.cfg.StripeSecretKey == "" {
+	if h.cfg.Stripe.SecretKey == "" {
 		httpjson.Error(w, http.StatusNotImplemented, "STRIPE_SECRET_KEY not set")
 		return
 	}
-	stripe.Key = h.cfg.StripeSecretKey
+	stripe.Key = h.cfg.Stripe.SecretKey
 
 	var req checkoutReq
 	if err := httpjson.Read(r, &req); err != nil {
@@ -130,11 +130,11 @@ type refundReq struct {
 }
 
 func (h *Stripe) IssueRefund(w http.ResponseWriter, r *http.Request) {
-	if h.cfg.StripeSecretKey == "" {
+	if h.cfg.Stripe.SecretKey == "" {
 		httpjson.Error(w, http.StatusNotImplemented, "STRIPE_SECRET_KEY not set")
 		return
 	}
-	stripe.Key = h.cfg.StripeSecretKey
+	stripe.Key = h.cfg.Stripe.SecretKey
 
 	var req refundReq
 	if err := httpjson.Read(r, &req); err != nil || req.PaymentIntentID == "" {
@@ -177,11 +177,11 @@ type createSetupIntentResp struct {
 
 // CreateSetupIntent: アプリ内カード入力用に SetupIntent を作る
 func (h *Stripe) CreateSetupIntent(w http.ResponseWriter, r *http.Request) {
-	if h.cfg.StripeSecretKey == "" {
+	if h.cfg.Stripe.SecretKey == "" {
 		httpjson.Error(w, http.StatusNotImplemented, "STRIPE_SECRET_KEY not set")
 		return
 	}
-	stripe.Key = h.cfg.StripeSecretKey
+	stripe.Key = h.cfg.Stripe.SecretKey
 
 	var req createSetupIntentReq
 	if err := httpjson.Read(r, &req); err != nil || req.DojoID == "" {
@@ -255,11 +255,11 @@ type setDefaultPMReq struct {
 
 // SetDefaultPaymentMethod: Customer の default_payment_method を更新
 func (h *Stripe) SetDefaultPaymentMethod(w http.ResponseWriter, r *http.Request) {
-	if h.cfg.StripeSecretKey == "" {
+	if h.cfg.Stripe.SecretKey == "" {
 		httpjson.Error(w, http.StatusNotImplemented, "STRIPE_SECRET_KEY not set")
 		return
 	}
-	stripe.Key = h.cfg.StripeSecretKey
+	stripe.Key = h.cfg.Stripe.SecretKey
 
 	var req setDefaultPMReq
 	if err := httpjson.Read(r, &req); err != nil || req.DojoID == "" || req.PaymentMethodID == "" {
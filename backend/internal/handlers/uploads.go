@@ -2,66 +2,75 @@ package handlers
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"net/http"
 	"time"
 
+	"dojo-manager/backend/internal/authctx"
+	"dojo-manager/backend/internal/blob"
 	"dojo-manager/backend/internal/config"
+	"dojo-manager/backend/internal/domain/dojo"
 	"dojo-manager/backend/internal/firebase"
 	"dojo-manager/backend/internal/httpjson"
-
-	credentials "cloud.google.com/go/iam/credentials/apiv1"
-	credentialspb "cloud.google.com/go/iam/credentials/apiv1/credentialspb"
-	"cloud.google.com/go/storage"
 )
 
 type Uploads struct {
 	cfg     config.Config
 	clients *firebase.Clients
-	iam     *credentials.IamCredentialsClient
+	store   blob.Store // nil when storage is not configured
 }
 
-func NewUploads(cfg config.Config, clients *firebase.Clients) *Uploads {
-	// IAM client is optional; only needed for signed URLs.
-	iamClient, _ := credentials.NewIamCredentialsClient(context.Background())
-	return &Uploads{cfg: cfg, clients: clients, iam: iamClient}
+func NewUploads(cfg config.Config, clients *firebase.Clients, store blob.Store) *Uploads {
+	return &Uploads{cfg: cfg, clients: clients, store: store}
 }
 
 type signedURLReq struct {
-	ObjectPath     string `json:"objectPath"` // e.g. "dojos/{dojoId}/logos/logo.png"
+	DojoID         string `json:"dojoId"`
+	ObjectPath     string `json:"objectPath"` // under dojos/{dojoId}/, e.g. "dojos/{dojoId}/logos/logo.png"
 	ContentType    string `json:"contentType,omitempty"`
 	ExpiresSeconds int64  `json:"expiresSeconds,omitempty"` // default 900
 }
 
 type signedURLResp struct {
-	URL       string `json:"url"`
-	Method    string `json:"method"`
-	ExpiresAt int64  `json:"expiresAt"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ExpiresAt int64             `json:"expiresAt"`
 }
 
 func (h *Uploads) CreateSignedUploadURL(w http.ResponseWriter, r *http.Request) {
 	var req signedURLReq
-	if err := httpjson.Read(r, &req); err != nil || req.ObjectPath == "" {
-		httpjson.Error(w, http.StatusBadRequest, "objectPath is required")
+	if err := httpjson.Read(r, &req); err != nil || req.DojoID == "" || req.ObjectPath == "" {
+		httpjson.Error(w, http.StatusBadRequest, "dojoId and objectPath are required")
+		return
+	}
+	objects, status, err := h.dojoObjects(r.Context(), req.DojoID)
+	if err != nil {
+		httpjson.Error(w, status, err.Error())
 		return
 	}
-	url, exp, err := h.signedURL(r.Context(), req.ObjectPath, req.ContentType, req.ExpiresSeconds)
+	u, err := h.signedURL(objects, req)
 	if err != nil {
 		httpjson.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	httpjson.Write(w, http.StatusOK, signedURLResp{URL: url, Method: "PUT", ExpiresAt: exp.Unix()})
+	httpjson.Write(w, http.StatusOK, signedURLResp{URL: u.URL, Method: u.Method, Headers: u.Headers, ExpiresAt: u.ExpiresAt.Unix()})
 }
 
 type signedURLsReq struct {
-	Items []signedURLReq `json:"items"`
+	DojoID string         `json:"dojoId"`
+	Items  []signedURLReq `json:"items"`
 }
 
 func (h *Uploads) CreateSignedUploadURLs(w http.ResponseWriter, r *http.Request) {
 	var req signedURLsReq
-	if err := httpjson.Read(r, &req); err != nil || len(req.Items) == 0 {
-		httpjson.Error(w, http.StatusBadRequest, "items is required")
+	if err := httpjson.Read(r, &req); err != nil || req.DojoID == "" || len(req.Items) == 0 {
+		httpjson.Error(w, http.StatusBadRequest, "dojoId and items are required")
+		return
+	}
+	objects, status, err := h.dojoObjects(r.Context(), req.DojoID)
+	if err != nil {
+		httpjson.Error(w, status, err.Error())
 		return
 	}
 	out := make([]signedURLResp, 0, len(req.Items))
@@ -69,66 +78,48 @@ func (h *Uploads) CreateSignedUploadURLs(w http.ResponseWriter, r *http.Request)
 		if it.ObjectPath == "" {
 			continue
 		}
-		url, exp, err := h.signedURL(r.Context(), it.ObjectPath, it.ContentType, it.ExpiresSeconds)
+		u, err := h.signedURL(objects, it)
 		if err != nil {
 			// return partial success info (keep it simple)
-			out = append(out, signedURLResp{URL: "", Method: "PUT", ExpiresAt: 0})
+			out = append(out, signedURLResp{URL: "", Method: http.MethodPut, ExpiresAt: 0})
 			continue
 		}
-		out = append(out, signedURLResp{URL: url, Method: "PUT", ExpiresAt: exp.Unix()})
+		out = append(out, signedURLResp{URL: u.URL, Method: u.Method, Headers: u.Headers, ExpiresAt: u.ExpiresAt.Unix()})
 	}
 	httpjson.Write(w, http.StatusOK, map[string]interface{}{"items": out})
 }
 
-func (h *Uploads) signedURL(ctx context.Context, objectPath, contentType string, expiresSeconds int64) (string, time.Time, error) {
-	if h.cfg.StorageBucket == "" {
-		return "", time.Time{}, fmt.Errorf("FIREBASE_STORAGE_BUCKET is not set")
-	}
-	if h.cfg.SignedURLServiceAccountEmail == "" {
-		return "", time.Time{}, fmt.Errorf("SIGNED_URL_SERVICE_ACCOUNT_EMAIL is not set")
+// dojoObjects returns the dojo's part of the store if the caller is its staff
+func (h *Uploads) dojoObjects(ctx context.Context, dojoID string) (blob.Store, int, error) {
+	if h.store == nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("storage is not configured")
 	}
-	if h.iam == nil {
-		return "", time.Time{}, fmt.Errorf("IAM credentials client not available")
+	uid, _ := authctx.UID(ctx)
+	ok, err := dojo.NewRepo(h.clients.Firestore).IsStaff(ctx, dojoID, uid)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to check staff role")
 	}
-	if expiresSeconds <= 0 || expiresSeconds > 3600 {
-		expiresSeconds = 900
+	if !ok {
+		return nil, http.StatusForbidden, fmt.Errorf("staff role required")
 	}
-	exp := time.Now().Add(time.Duration(expiresSeconds) * time.Second)
-
-	// V4 signed URL for PUT (upload).
-	opts := &storage.SignedURLOptions{
-		Scheme:         storage.SigningSchemeV4,
-		Method:         "PUT",
-		Expires:        exp,
-		ContentType:    contentType,
-		GoogleAccessID: h.cfg.SignedURLServiceAccountEmail,
-		SignBytes: func(b []byte) ([]byte, error) {
-			name := fmt.Sprintf("projects/-/serviceAccounts/%s", h.cfg.SignedURLServiceAccountEmail)
-			resp, err := h.iam.SignBlob(ctx, &credentialspb.SignBlobRequest{
-				Name:    name,
-				Payload: b,
-			})
-			if err != nil {
-				return nil, err
-			}
-			// resp.SignedBlob is raw bytes; keep as-is.
-			return resp.SignedBlob, nil
-		},
+	objects, err := blob.ForDojo(h.store, dojoID)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
 	}
+	return objects, 0, nil
+}
 
-	// Some clients like to know the expected Content-Type; if blank, omit to allow any.
-	if opts.ContentType == "" {
-		opts.ContentType = "application/octet-stream"
+func (h *Uploads) signedURL(objects blob.Store, req signedURLReq) (*blob.SignedURL, error) {
+	if req.ExpiresSeconds <= 0 || req.ExpiresSeconds > 3600 {
+		req.ExpiresSeconds = 900
 	}
-
-	url, err := storage.SignedURL(h.cfg.StorageBucket, objectPath, opts)
-	if err != nil {
-		// Helpful error message for common misconfigs.
-		return "", time.Time{}, fmt.Errorf("failed to sign url (check service account + permissions): %v", err)
+	// The upload must send the signed Content-Type; default to a generic one.
+	if req.ContentType == "" {
+		req.ContentType = "application/octet-stream"
 	}
-
-	// Optional: include base64 of path as debug for clients (not required)
-	_ = base64.StdEncoding.EncodeToString([]byte(objectPath))
-
-	return url, exp, nil
+	return objects.SignedURL(req.ObjectPath, blob.URLOptions{
+		Method:      http.MethodPut,
+		Expires:     time.Now().Add(time.Duration(req.ExpiresSeconds) * time.Second),
+		ContentType: req.ContentType,
+	})
 }
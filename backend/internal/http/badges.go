@@ -0,0 +1,54 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+
+	"dojo-manager/backend/internal/domain/badges"
+)
+
+// writeBadges answers with badges as a PNG QR code (one badge only), a
+// printable PDF or JSON. The file is rendered before any header is sent so a
+// failure still gets a proper error response.
+func writeBadges(w http.ResponseWriter, format string, list []badges.Badge) {
+	if format == "json" {
+		if len(list) == 1 {
+			WriteJSON(w, 200, list[0])
+			return
+		}
+		WriteJSON(w, 200, map[string]any{"badges": list})
+		return
+	}
+
+	var buf bytes.Buffer
+	var err error
+	contentType, filename := "application/pdf", "badges.pdf"
+	switch format {
+	case "", "png":
+		if len(list) != 1 {
+			Fail(w, 400, "png is only available for a single badge")
+			return
+		}
+		contentType, filename = "image/png", "badge-"+list[0].MemberUID+".png"
+		err = badges.PNG(&buf, &list[0])
+	case "pdf":
+		if len(list) == 1 {
+			filename = "badge-" + list[0].MemberUID + ".pdf"
+		}
+		err = badges.PDF(&buf, list)
+	default:
+		Fail(w, 400, "format must be png, pdf or json")
+		return
+	}
+	if err != nil {
+		status, msg := mapBadgesError(err)
+		Fail(w, status, msg)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(200)
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"dojo-manager/backend/internal/fsreads"
+	"dojo-manager/backend/internal/middleware"
+)
+
+// DebugReadsHeader opts a request into the Firestore read report
+const DebugReadsHeader = "X-Debug-Firestore"
+
+// debugReads adds X-Firestore-Reads and X-Duration-Ms to the responses of
+// staff requests that send "X-Debug-Firestore: 1", to spot N+1 reads (such
+// as one user doc fetched per member) during development. It runs right
+// after WithAuth so the rest of the chain is measured too.
+func debugReads() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			if r.Header.Get(DebugReadsHeader) != "1" || au == nil || !middleware.IsStaff(au.Claims) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := fsreads.WithCounter(r.Context())
+			dw := &debugWriter{ResponseWriter: w, r: r.WithContext(ctx), start: time.Now()}
+			next.ServeHTTP(dw, dw.r)
+			dw.stamp()
+		})
+	}
+}
+
+// debugWriter sets the report headers just before the status line goes out
+type debugWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	start   time.Time
+	stamped bool
+}
+
+func (w *debugWriter) stamp() {
+	if w.stamped {
+		return
+	}
+	w.stamped = true
+	h := w.ResponseWriter.Header()
+	h.Set("X-Firestore-Reads", strconv.FormatInt(fsreads.Reads(w.r.Context()), 10))
+	h.Set("X-Duration-Ms", strconv.FormatInt(time.Since(w.start).Milliseconds(), 10))
+}
+
+func (w *debugWriter) WriteHeader(status int) {
+	w.stamp()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *debugWriter) Write(p []byte) (int, error) {
+	w.stamp()
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/maintenance"
+	"dojo-manager/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// blockPendingDeleteWrites rejects mutating /v1/dojos/{dojoId}/... requests
+// while the dojo is in its deletion grace period or under maintenance. Reads
+// and the deletion endpoint itself (to restore the dojo) stay available.
+func blockPendingDeleteWrites(dojoSvc *dojo.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if dojoSvc == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			dojoId, rest := dojoIDFromPath(r.URL.Path)
+			if dojoId == "" || rest == "deletion" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := dojoSvc.EnsureWritable(r.Context(), dojoId); err != nil {
+				if dojo.IsErrMaintenance(err) {
+					w.Header().Set("Retry-After", maintenanceRetryAfter)
+				}
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maintenanceRetryAfter is the Retry-After hint (seconds) sent with the 503
+const maintenanceRetryAfter = "120"
+
+// blockWritesDuringMaintenance answers mutating requests with 503 while the
+// global maintenance switch is on. Reads keep working, and so do admin
+// routes, so operators can run jobs and turn the switch off again.
+func blockWritesDuringMaintenance(svc *maintenance.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if svc == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+				strings.HasPrefix(r.URL.Path, "/v1/admin/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if st := svc.Global(r.Context()); st.Active() {
+				w.Header().Set("Retry-After", maintenanceRetryAfter)
+				Fail(w, http.StatusServiceUnavailable, st.Notice())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// dojoIDFromPath extracts {dojoId} and the remaining path from /v1/dojos/{dojoId}/...
+// chi URL params are not resolved yet when group middleware runs.
+func dojoIDFromPath(path string) (string, string) {
+	rest, ok := strings.CutPrefix(path, "/v1/dojos/")
+	if !ok {
+		return "", ""
+	}
+	dojoId, tail, found := strings.Cut(rest, "/")
+	if !found || dojoId == "" {
+		// /v1/dojos/search etc. are not dojo-scoped
+		return "", ""
+	}
+	return dojoId, strings.Trim(tail, "/")
+}
+
+// requireDojoPermission enforces the dojo role permission matrix on a
+// /v1/dojos/{dojoId}/... route (use with pr.With so chi params are resolved).
+func requireDojoPermission(dojoRepo *dojo.Repo, perm dojo.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if dojoRepo == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			au, _ := middleware.GetAuthUser(r.Context())
+			dojoId := chi.URLParam(r, "dojoId")
+			if au == nil || dojoId == "" {
+				Fail(w, 400, "missing dojoId")
+				return
+			}
+
+			ok, err := dojoRepo.HasPermission(r.Context(), dojoId, au.UID, perm)
+			if err != nil {
+				Fail(w, 404, "dojo not found")
+				return
+			}
+			if !ok {
+				Fail(w, 403, "missing permission: "+string(perm))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"dojo-manager/backend/internal/domain/impersonation"
+	"dojo-manager/backend/internal/middleware"
+)
+
+// ImpersonationTokenHeader carries an impersonation session's token, sent
+// by an admin alongside their own ID token
+const ImpersonationTokenHeader = "X-Impersonation-Token"
+
+// impersonationPaths are the routes outside /v1/dojos/{dojoId} an
+// impersonated request may reach. Everything else about the member (their
+// other dojos, devices, profile, chats) is off limits: only the session's
+// dojo consented.
+var impersonationPaths = map[string]bool{
+	"/v1/me": true, // who the app is signed in as
+}
+
+// impersonationAllows reports whether an impersonation session in dojoID
+// may reach path
+func impersonationAllows(path, dojoID string) bool {
+	if impersonationPaths[path] {
+		return true
+	}
+	prefix := "/v1/dojos/" + dojoID
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// impersonate runs after WithAuth. An admin's request carrying the token of
+// one of their impersonation sessions is served as the impersonated member:
+// read-only, within the session's dojo (see impersonationPaths), logged to
+// the audit log and flagged in the response headers.
+func impersonate(svc *impersonation.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(ImpersonationTokenHeader)
+			au, _ := middleware.GetAuthUser(r.Context())
+			if token == "" || au == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if svc == nil {
+				Fail(w, 400, "impersonation is not available")
+				return
+			}
+			if !middleware.IsAdmin(au.Claims) {
+				Fail(w, 403, "admin privileges required")
+				return
+			}
+
+			sess, err := svc.Resolve(r.Context(), token, time.Now().UTC())
+			if err != nil {
+				status, msg := mapImpersonationError(err)
+				Fail(w, status, msg)
+				return
+			}
+			if sess.AdminUID != au.UID {
+				Fail(w, 403, "impersonation session belongs to another admin")
+				return
+			}
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				Fail(w, 403, "impersonation is read-only")
+				return
+			}
+			if !impersonationAllows(r.URL.Path, sess.DojoID) {
+				Fail(w, 403, "impersonation is limited to dojo "+sess.DojoID)
+				return
+			}
+
+			meta := requestMeta(r)
+			if err := svc.RecordRequest(r.Context(), sess, r.Method, r.URL.Path, meta.IP, meta.UserAgent); err != nil {
+				Fail(w, 500, "failed to record impersonated request")
+				return
+			}
+
+			claims := maps.Clone(sess.Claims)
+			if claims == nil {
+				claims = map[string]any{}
+			}
+			claims["impersonatedBy"] = au.UID
+			target := &middleware.AuthUser{
+				UID:            sess.TargetUID,
+				Email:          sess.TargetEmail,
+				Claims:         claims,
+				AuthTime:       sess.CreatedAt,
+				ImpersonatedBy: au.UID,
+			}
+
+			h := w.Header()
+			h.Set("X-Impersonated-User", sess.TargetUID)
+			h.Set("X-Impersonated-By", au.UID)
+			h.Set("X-Impersonation-Expires", sess.ExpiresAt.Format(time.RFC3339))
+			next.ServeHTTP(w, r.WithContext(middleware.WithAuthUser(r.Context(), target)))
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Request body limits. Every protected route gets defaultBodyLimit; routes
+// that legitimately take more raise it with pr.With(bodyLimit(n)).
+const (
+	defaultBodyLimit = int64(64 << 10)  // JSON mutations
+	bulkBodyLimit    = int64(512 << 10) // bulk attendance and similar batches
+	publicBodyLimit  = int64(16 << 10)  // public forms
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitBodies caps request bodies at limit and answers 413 with the standard
+// error envelope, whether the size is declared up front (Content-Length) or
+// only discovered while the handler reads the body.
+func limitBodies(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				failTooLarge(w, limit)
+				return
+			}
+			lw := &limitWriter{ResponseWriter: w}
+			r.Body = &limitedBody{rc: r.Body, limit: limit, w: lw}
+			next.ServeHTTP(lw, r)
+		})
+	}
+}
+
+// bodyLimit overrides the group limit for one route (use with pr.With)
+func bodyLimit(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, ok := r.Body.(*limitedBody)
+			if !ok {
+				limitBodies(limit)(next).ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > limit {
+				failTooLarge(w, limit)
+				return
+			}
+			b.limit = limit
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func failTooLarge(w http.ResponseWriter, limit int64) {
+	Fail(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body too large (max %d bytes)", limit))
+}
+
+// limitedBody stops reading one byte past the limit and sends the 413
+type limitedBody struct {
+	rc    io.ReadCloser
+	limit int64
+	read  int64
+	w     *limitWriter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit {
+		return 0, errBodyTooLarge
+	}
+	if max := b.limit + 1 - b.read; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := b.rc.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		b.w.tooLarge(b.limit)
+		return 0, errBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error { return b.rc.Close() }
+
+// limitWriter drops the handler's own response (usually "invalid json") once
+// the 413 has been written in its place
+type limitWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	rejected    bool
+}
+
+func (w *limitWriter) tooLarge(limit int64) {
+	if w.wroteHeader || w.rejected {
+		return
+	}
+	failTooLarge(w.ResponseWriter, limit)
+	w.rejected = true
+}
+
+func (w *limitWriter) WriteHeader(status int) {
+	if w.rejected {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.rejected {
+		return len(p), nil
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"net/http"
+
+	"dojo-manager/backend/internal/domain/logins"
+	"dojo-manager/backend/internal/middleware"
+)
+
+// countryHeaders are where edge proxies put the client's country
+var countryHeaders = []string{"CF-IPCountry", "X-Appengine-Country", "X-Client-Country"}
+
+// DeviceIDHeader is the per-install id the apps send to tell devices apart
+const DeviceIDHeader = "X-Device-Id"
+
+// trackLogins runs after WithAuth and feeds each request's device to the
+// logins service, which alerts staff about new devices and locations.
+// Requests from a revoked device get 401.
+func trackLogins(svc *logins.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			if svc == nil || au == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			meta := requestMeta(r)
+			sg := logins.Sighting{
+				UID:       au.UID,
+				IsStaff:   middleware.IsStaff(au.Claims),
+				AuthTime:  au.AuthTime,
+				DeviceID:  r.Header.Get(DeviceIDHeader),
+				IP:        meta.IP,
+				UserAgent: meta.UserAgent,
+			}
+			for _, h := range countryHeaders {
+				if c := r.Header.Get(h); c != "" {
+					sg.Country = c
+					break
+				}
+			}
+
+			if err := svc.Observe(r.Context(), sg); err != nil {
+				status, msg := mapLoginsError(err)
+				Fail(w, status, msg)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// publicPrefix is where the endpoints dojos embed in their own websites
+// live. They take no auth and answer any origin.
+const publicPrefix = "/public/"
+
+// corsByPath applies public to the /public/ endpoints and private to the
+// rest, so a dojo's site can post its contact form without the API opening
+// credentialed requests to every origin
+func corsByPath(private, public func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		priv, pub := private(next), public(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, publicPrefix) {
+				pub.ServeHTTP(w, r)
+				return
+			}
+			priv.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,10 +3,21 @@ package http
 import (
 	"encoding/json"
 	"net/http"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	stripedom "dojo-manager/backend/internal/domain/stripe"
 )
 
 type APIError struct {
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"` // set on errors the app handles specially
+}
+
+// PlanLimitError is the 402 body for a plan limit: the usual message plus
+// what the app needs to render an upgrade sheet
+type PlanLimitError struct {
+	Message string `json:"message"`
+	*stripedom.LimitError
 }
 
 func WriteJSON(w http.ResponseWriter, status int, v any) {
@@ -18,3 +29,26 @@ func WriteJSON(w http.ResponseWriter, status int, v any) {
 func Fail(w http.ResponseWriter, status int, msg string) {
 	WriteJSON(w, status, APIError{Message: msg})
 }
+
+// failPlanLimit answers 402 when err is a plan limit and reports whether it did
+func failPlanLimit(w http.ResponseWriter, err error) bool {
+	if le, ok := stripedom.AsLimitError(err); ok {
+		WriteJSON(w, 402, PlanLimitError{Message: err.Error(), LimitError: le})
+		return true
+	}
+	if stripedom.IsErrLimitReached(err) {
+		Fail(w, 402, err.Error())
+		return true
+	}
+	return false
+}
+
+// failEmailNotVerified answers 403 with code "email_not_verified" when the
+// dojo requires a verified email, and reports whether it did
+func failEmailNotVerified(w http.ResponseWriter, err error) bool {
+	if dojo.IsErrEmailNotVerified(err) {
+		WriteJSON(w, 403, APIError{Message: err.Error(), Code: "email_not_verified"})
+		return true
+	}
+	return false
+}
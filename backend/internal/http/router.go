@@ -8,18 +8,50 @@ import (
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"dojo-manager/backend/internal/blob"
 	"dojo-manager/backend/internal/config"
+	"dojo-manager/backend/internal/domain/activity"
 	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/audit"
+	"dojo-manager/backend/internal/domain/badges"
+	"dojo-manager/backend/internal/domain/benchmarks"
+	"dojo-manager/backend/internal/domain/birthdays"
+	"dojo-manager/backend/internal/domain/chat"
+	"dojo-manager/backend/internal/domain/chatops"
+	"dojo-manager/backend/internal/domain/claims"
+	"dojo-manager/backend/internal/domain/classgoals"
+	"dojo-manager/backend/internal/domain/dashboard"
+	"dojo-manager/backend/internal/domain/demo"
+	"dojo-manager/backend/internal/domain/devices"
+	"dojo-manager/backend/internal/domain/digest"
 	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/families"
+	"dojo-manager/backend/internal/domain/impersonation"
+	"dojo-manager/backend/internal/domain/inbound"
+	"dojo-manager/backend/internal/domain/leads"
+	"dojo-manager/backend/internal/domain/logins"
+	"dojo-manager/backend/internal/domain/maintenance"
+	"dojo-manager/backend/internal/domain/media"
 	"dojo-manager/backend/internal/domain/members"
+	"dojo-manager/backend/internal/domain/memberships"
 	"dojo-manager/backend/internal/domain/notifications"
+	"dojo-manager/backend/internal/domain/packages"
 	"dojo-manager/backend/internal/domain/profile"
+	"dojo-manager/backend/internal/domain/pushtokens"
 	"dojo-manager/backend/internal/domain/ranks"
+	"dojo-manager/backend/internal/domain/recurring"
+	"dojo-manager/backend/internal/domain/reminders"
 	"dojo-manager/backend/internal/domain/retention"
 	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/domain/sheets"
+	"dojo-manager/backend/internal/domain/shop"
 	"dojo-manager/backend/internal/domain/stats"
 	stripedom "dojo-manager/backend/internal/domain/stripe"
+	"dojo-manager/backend/internal/domain/tags"
+	"dojo-manager/backend/internal/domain/timetable"
+	"dojo-manager/backend/internal/domain/transfers"
 	"dojo-manager/backend/internal/domain/user"
+	"dojo-manager/backend/internal/fsdoc"
 	"dojo-manager/backend/internal/middleware"
 
 	"firebase.google.com/go/v4/auth"
@@ -42,24 +74,182 @@ type RouterDeps struct {
 	ProfileSvc       *profile.Service
 	StripeSvc        *stripedom.Service
 	RetentionSvc     *retention.Service
+	DashboardSvc     *dashboard.Service
+	RemindersSvc     *reminders.Service
+	PackagesSvc      *packages.Service
+	ShopSvc          *shop.Service
+	RecurringSvc     *recurring.Service
+	TimetableSvc     *timetable.Service
+	FamiliesSvc      *families.Service
+	BenchmarksSvc    *benchmarks.Service
+	MembershipsSvc   *memberships.Service
+	PushTokensSvc    *pushtokens.Service
+	MaintenanceSvc   *maintenance.Service
+	ClassGoalsSvc    *classgoals.Service
+	ChatSvc          *chat.Service
+	DevicesSvc       *devices.Service
+	AuditSvc         *audit.Service
+	LoginsSvc        *logins.Service
+	MediaSvc         *media.Service
+	BadgesSvc        *badges.Service
+	BirthdaysSvc     *birthdays.Service
+	DigestSvc        *digest.Service
+	ChatOpsSvc       *chatops.Service
+	InboundSvc       *inbound.Service
+	LeadsSvc         *leads.Service
+	SheetsSvc        *sheets.Service // nil when Google Sheets is not configured
+	ImpersonationSvc *impersonation.Service
+	DemoSvc          *demo.Service
+	TransfersSvc     *transfers.Service
+	ActivitySvc      *activity.Service
+	ClaimsSvc        *claims.Service
+	TagsSvc          *tags.Service
+	Storage          blob.Store
 }
 
 func NewRouter(d RouterDeps) http.Handler {
 	r := chi.NewRouter()
 
-	r.Use(middleware.CORS(d.Cfg.AllowedOrigins))
+	r.Use(corsByPath(middleware.CORS(d.Cfg.AllowedOrigins), middleware.PublicCORS()))
 	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		WriteJSON(w, 200, map[string]any{"ok": true, "ts": time.Now().UTC().Format(time.RFC3339)})
 	})
 
+	// Global maintenance switch, so clients can show a banner before sign-in
+	if d.MaintenanceSvc != nil {
+		r.Get("/v1/maintenance", func(w http.ResponseWriter, r *http.Request) {
+			WriteJSON(w, 200, d.MaintenanceSvc.Global(r.Context()))
+		})
+	}
+
 	// ===== Stripe Webhook (no auth required) =====
 	if d.StripeSvc != nil {
 		r.Post("/v1/stripe/webhook", d.StripeSvc.HandleWebhook)
 	}
 
+	// ===== Inbound email webhook (provider secret or signature instead of a user) =====
+	if d.InboundSvc != nil {
+		r.With(withTimeout(d.Cfg.HTTP.SlowRequestTimeout)).Post("/v1/inbound-email", func(w http.ResponseWriter, r *http.Request) {
+			out, err := d.InboundSvc.Receive(r)
+			if err != nil {
+				status, msg := mapInboundError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, out)
+		})
+	}
+
+	// ===== Local storage (dev): the signed URLs of a LOCAL_STORAGE_DIR store =====
+	if local, ok := d.Storage.(*blob.Local); ok {
+		r.Handle(blob.LocalPath+"/*", http.StripPrefix(blob.LocalPath, local.Handler()))
+	}
+
+	// ===== Public contact form (captcha and rate limits instead of a user) =====
+	if d.LeadsSvc != nil {
+		r.Group(func(pub chi.Router) {
+			pub.Use(limitBodies(publicBodyLimit))
+			pub.Use(withTimeout(d.Cfg.HTTP.RequestTimeout))
+			pub.Use(blockWritesDuringMaintenance(d.MaintenanceSvc))
+
+			pub.Post("/public/dojos/{slug}/contact", func(w http.ResponseWriter, r *http.Request) {
+				var in leads.ContactInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				meta := leads.RequestMeta{IP: requestMeta(r).IP, Origin: r.Header.Get("Origin")}
+				if err := d.LeadsSvc.Contact(r.Context(), chi.URLParam(r, "slug"), in, meta); err != nil {
+					status, msg := mapLeadsError(err)
+					if status == 429 {
+						w.Header().Set("Retry-After", "3600")
+					}
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, map[string]any{"received": true})
+			})
+		})
+	}
+
+	// ===== Kiosk devices (device token instead of a user) =====
+	if d.DevicesSvc != nil {
+		r.Group(func(kr chi.Router) {
+			kr.Use(limitBodies(defaultBodyLimit))
+			kr.Use(withTimeout(d.Cfg.HTTP.RequestTimeout))
+			kr.Use(requireDevice(d.DevicesSvc))
+
+			// Kiosks call this periodically; it keeps lastSeen and the activity log current
+			kr.Post("/v1/devices/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+				dev := deviceFrom(r.Context())
+				WriteJSON(w, 200, map[string]any{
+					"deviceId": dev.ID,
+					"dojoId":   dev.DojoID,
+					"name":     dev.Name,
+					"location": dev.Location,
+				})
+			})
+
+			// Kiosk camera scanned a member badge
+			if d.BadgesSvc != nil {
+				kr.Post("/v1/devices/badge-checkin", func(w http.ResponseWriter, r *http.Request) {
+					dev := deviceFrom(r.Context())
+					var in badges.CheckinInput
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+
+					out, err := d.BadgesSvc.CheckInFromDevice(r.Context(), dev.ID, dev.DojoID, in)
+					if err != nil {
+						status, msg := mapBadgesError(err)
+						Fail(w, status, msg)
+						return
+					}
+					WriteJSON(w, 200, out)
+				})
+			}
+
+			// Door NFC/RFID reader read a tag; the post is signed as well
+			if d.TagsSvc != nil {
+				kr.With(requireDeviceSignature).Post("/v1/devices/tag-reads", func(w http.ResponseWriter, r *http.Request) {
+					dev := deviceFrom(r.Context())
+					var in tags.ReadInput
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+
+					out, err := d.TagsSvc.RecordRead(r.Context(), dev.ID, dev.DojoID, in, time.Now())
+					if err != nil {
+						status, msg := mapTagsError(err)
+						Fail(w, status, msg)
+						return
+					}
+					WriteJSON(w, 200, out)
+				})
+			}
+		})
+	}
+
 	// Protected routes
 	r.Group(func(pr chi.Router) {
 		pr.Use(middleware.WithAuth(d.AuthClient))
+		pr.Use(debugReads())
+		pr.Use(trackLogins(d.LoginsSvc))
+		pr.Use(limitBodies(defaultBodyLimit))
+		pr.Use(withTimeout(d.Cfg.HTTP.RequestTimeout))
+		pr.Use(impersonate(d.ImpersonationSvc))
+		pr.Use(blockWritesDuringMaintenance(d.MaintenanceSvc))
+		pr.Use(blockPendingDeleteWrites(d.DojoSvc))
+
+		// per-route dojo permission (role matrix + per-dojo overrides)
+		perm := func(p dojo.Permission) func(http.Handler) http.Handler {
+			return requireDojoPermission(d.DojoRepo, p)
+		}
+		// scan-heavy endpoints and scheduler jobs get the longer deadline
+		slow := timeout(d.Cfg.HTTP.SlowRequestTimeout)
 
 		pr.Get("/v1/me", func(w http.ResponseWriter, r *http.Request) {
 			au, _ := middleware.GetAuthUser(r.Context())
@@ -70,6 +260,110 @@ func NewRouter(d RouterDeps) http.Handler {
 			})
 		})
 
+		// ===== App opens (dashboard adoption, retention signal) =====
+		if d.ActivitySvc != nil {
+			// The app calls this when it opens or comes to the foreground
+			pr.Post("/v1/me/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				out, err := d.ActivitySvc.Heartbeat(r.Context(), au.UID, time.Now())
+				if err != nil {
+					status, msg := mapActivityError(err)
+					if status == 429 {
+						w.Header().Set("Retry-After", "60")
+					}
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Custom claims (claims.dojoRoles follows per-dojo staff roles) =====
+		if d.ClaimsSvc != nil {
+			// Resync the caller's claims; refresh the ID token when changed
+			pr.Post("/v1/me/claims/sync", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				out, err := d.ClaimsSvc.SyncUser(r.Context(), au.UID)
+				if err != nil {
+					status, msg := mapClaimsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Resync a member's claims after a role change made outside the API;
+			// only the role in this dojo is returned
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/members/{memberUid}/claims/sync", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.ClaimsSvc.SyncUser(r.Context(), chi.URLParam(r, "memberUid"))
+				if err != nil {
+					status, msg := mapClaimsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{
+					"uid":     out.UID,
+					"role":    out.DojoRoles[chi.URLParam(r, "dojoId")],
+					"changed": out.Changed,
+				})
+			})
+
+			// Sync every user's claims a page at a time (admin only; pass the
+			// returned nextCursor as ?after= until it comes back empty)
+			pr.With(slow).Post("/v1/admin/claims/backfill", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+				out, err := d.ClaimsSvc.Backfill(r.Context(), r.URL.Query().Get("after"), limit)
+				if err != nil {
+					status, msg := mapClaimsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== My dojos (role, next class and attendance per membership) =====
+		if d.MembershipsSvc != nil {
+			pr.Get("/v1/me/dojos", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				out, err := d.MembershipsSvc.ListMine(r.Context(), au.UID)
+				if err != nil {
+					status, msg := mapMembershipsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"dojos": out})
+			})
+
+			// Repair users/{uid}/dojoMemberships from the members subcollections
+			// (admin only, called by scheduler; ?dryRun=true only reports)
+			pr.With(slow).Post("/v1/admin/memberships/check-indexes", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+				dryRun := r.URL.Query().Get("dryRun") == "true"
+
+				out, err := d.MembershipsSvc.CheckIndexes(r.Context(), dryRun)
+				if err != nil {
+					status, msg := mapMembershipsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
 		// ===== Auth: Reset email verified (for per-login verification) =====
 		pr.Post("/v1/auth/reset-email-verified", func(w http.ResponseWriter, r *http.Request) {
 			au, _ := middleware.GetAuthUser(r.Context())
@@ -126,50 +420,38 @@ func NewRouter(d RouterDeps) http.Handler {
 			WriteJSON(w, 200, out)
 		})
 
-		pr.Post("/v1/dojos/{dojoId}/joinRequests", func(w http.ResponseWriter, r *http.Request) {
+		// ===== Dojo deletion (owner only, 30-day grace period) =====
+		pr.Get("/v1/dojos/{dojoId}/deletion", func(w http.ResponseWriter, r *http.Request) {
 			au, _ := middleware.GetAuthUser(r.Context())
 			dojoId := chi.URLParam(r, "dojoId")
-			if dojoId == "" {
-				Fail(w, 400, "missing dojoId")
-				return
-			}
-
-			var in dojo.CreateJoinRequestInput
-			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-				Fail(w, 400, "invalid json")
-				return
-			}
-			in.Trim()
 
-			out, err := d.DojoSvc.CreateJoinRequest(r.Context(), au.UID, dojoId, in)
+			out, err := d.DojoSvc.GetDeletionStatus(r.Context(), au.UID, dojoId)
 			if err != nil {
 				status, msg := mapDojoError(err)
 				Fail(w, status, msg)
 				return
 			}
-			WriteJSON(w, 201, out)
+			WriteJSON(w, 200, out)
 		})
 
-		pr.Post("/v1/dojos/{dojoId}/joinRequests/{studentUid}/approve", func(w http.ResponseWriter, r *http.Request) {
+		pr.Post("/v1/dojos/{dojoId}/deletion", func(w http.ResponseWriter, r *http.Request) {
 			au, _ := middleware.GetAuthUser(r.Context())
 			dojoId := chi.URLParam(r, "dojoId")
-			studentUid := chi.URLParam(r, "studentUid")
-			if dojoId == "" || studentUid == "" {
-				Fail(w, 400, "missing dojoId or studentUid")
+
+			out, err := d.DojoSvc.RequestDeletion(r.Context(), au.UID, dojoId)
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
 				return
 			}
+			WriteJSON(w, 202, out)
+		})
 
-			// ★ Check plan limit before approving (adds a member)
-			if d.StripeSvc != nil {
-				if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "member"); err != nil {
-					if stripedom.IsErrLimitReached(err) {
-						Fail(w, 402, err.Error())
-						return
-					}
-				}
-			}
+		pr.Delete("/v1/dojos/{dojoId}/deletion", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			dojoId := chi.URLParam(r, "dojoId")
 
-			out, err := d.DojoSvc.ApproveJoinRequest(r.Context(), au.UID, dojoId, studentUid)
+			out, err := d.DojoSvc.CancelDeletion(r.Context(), au.UID, dojoId)
 			if err != nil {
 				status, msg := mapDojoError(err)
 				Fail(w, status, msg)
@@ -178,523 +460,4435 @@ func NewRouter(d RouterDeps) http.Handler {
 			WriteJSON(w, 200, out)
 		})
 
-		// ===== Session (Class) CRUD routes =====
-		if d.SessionSvc != nil {
-			// Create session
-			pr.Post("/v1/dojos/{dojoId}/sessions", func(w http.ResponseWriter, r *http.Request) {
+		// ===== Demo data (owner only, for trying out a new dojo) =====
+		if d.DemoSvc != nil {
+			pr.Get("/v1/dojos/{dojoId}/seed-demo", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
-					return
-				}
-
-				// ★ Check plan limit before creating class
-				if d.StripeSvc != nil {
-					if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "class"); err != nil {
-						if stripedom.IsErrLimitReached(err) {
-							Fail(w, 402, err.Error())
-							return
-						}
-					}
-				}
-
-				var in session.CreateSessionInput
-				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-					Fail(w, 400, "invalid json")
+				out, err := d.DemoSvc.GetStatus(r.Context(), au.UID, chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapDemoError(err)
+					Fail(w, status, msg)
 					return
 				}
-				in.Trim()
+				WriteJSON(w, 200, out)
+			})
 
-				out, err := d.SessionSvc.Create(r.Context(), au.UID, dojoId, in)
+			// Seed an empty dojo with demo members, classes, attendance and ranks
+			pr.With(slow).Post("/v1/dojos/{dojoId}/seed-demo", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.DemoSvc.Seed(r.Context(), au.UID, chi.URLParam(r, "dojoId"))
 				if err != nil {
-					status, msg := mapSessionError(err)
+					status, msg := mapDemoError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 201, out)
 			})
 
-			// List sessions
-			pr.Get("/v1/dojos/{dojoId}/sessions", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+			// Wipe the demo data before going live
+			pr.With(slow).Delete("/v1/dojos/{dojoId}/seed-demo", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.DemoSvc.Wipe(r.Context(), au.UID, chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapDemoError(err)
+					Fail(w, status, msg)
 					return
 				}
+				WriteJSON(w, 200, out)
+			})
+		}
 
-				// Parse query params
-				var input session.ListSessionsInput
-				if dayStr := r.URL.Query().Get("dayOfWeek"); dayStr != "" {
-					if day, err := strconv.Atoi(dayStr); err == nil {
-						input.DayOfWeek = &day
-					}
-				}
-				if r.URL.Query().Get("activeOnly") == "true" {
-					input.ActiveOnly = true
-				}
-				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-					if limit, err := strconv.ParseInt(limitStr, 10, 64); err == nil {
-						input.Limit = limit
-					}
-				}
+		// Effective configuration with secrets masked (admin only)
+		pr.Get("/v1/admin/config", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			if !middleware.IsAdmin(au.Claims) {
+				Fail(w, 403, "admin privileges required")
+				return
+			}
+			WriteJSON(w, 200, d.Cfg.Redacted())
+		})
 
-				out, err := d.SessionSvc.List(r.Context(), dojoId, input)
-				if err != nil {
-					status, msg := mapSessionError(err)
-					Fail(w, status, msg)
+		// Firestore docs that failed to decode since boot, per collection
+		pr.Get("/v1/admin/decode-errors", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			if !middleware.IsAdmin(au.Claims) {
+				Fail(w, 403, "admin privileges required")
+				return
+			}
+			WriteJSON(w, 200, map[string]any{"collections": fsdoc.DecodeErrors()})
+		})
+
+		// ===== Maintenance switches (admin only) =====
+		if d.MaintenanceSvc != nil {
+			// Make the whole API read-only
+			pr.Put("/v1/admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"sessions": out})
-			})
 
-			// Get session
-			pr.Get("/v1/dojos/{dojoId}/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				sessionId := chi.URLParam(r, "sessionId")
-				if dojoId == "" || sessionId == "" {
-					Fail(w, 400, "missing dojoId or sessionId")
+				var in maintenance.UpdateInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
 					return
 				}
 
-				out, err := d.SessionSvc.Get(r.Context(), dojoId, sessionId)
+				out, err := d.MaintenanceSvc.SetGlobal(r.Context(), au.UID, in)
 				if err != nil {
-					status, msg := mapSessionError(err)
+					status, msg := mapMaintenanceError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
 
-			// Update session
-			pr.Put("/v1/dojos/{dojoId}/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+			// Make one dojo read-only
+			pr.Put("/v1/admin/dojos/{dojoId}/maintenance", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				sessionId := chi.URLParam(r, "sessionId")
-				if dojoId == "" || sessionId == "" {
-					Fail(w, 400, "missing dojoId or sessionId")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
 
-				var in session.UpdateSessionInput
+				var in maintenance.UpdateInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-				in.Trim()
 
-				out, err := d.SessionSvc.Update(r.Context(), au.UID, dojoId, sessionId, in)
+				out, err := d.MaintenanceSvc.SetDojo(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
 				if err != nil {
-					status, msg := mapSessionError(err)
+					status, msg := mapMaintenanceError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
+		}
 
-			// Delete session
-			pr.Delete("/v1/dojos/{dojoId}/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+		// ===== Account security (sign-in devices, audit log) =====
+		if d.LoginsSvc != nil {
+			pr.Get("/v1/me/login-devices", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				sessionId := chi.URLParam(r, "sessionId")
-				if dojoId == "" || sessionId == "" {
-					Fail(w, 400, "missing dojoId or sessionId")
+				out, err := d.LoginsSvc.List(r.Context(), au.UID)
+				if err != nil {
+					status, msg := mapLoginsError(err)
+					Fail(w, status, msg)
 					return
 				}
+				WriteJSON(w, 200, map[string]any{"devices": out})
+			})
 
-				err := d.SessionSvc.Delete(r.Context(), au.UID, dojoId, sessionId)
+			// Stop trusting a device; it has to sign in again (and alerts again)
+			pr.Post("/v1/me/login-devices/{deviceId}/revoke", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				meta := requestMeta(r)
+				out, err := d.LoginsSvc.Revoke(r.Context(), au.UID, chi.URLParam(r, "deviceId"), meta.IP, meta.UserAgent)
 				if err != nil {
-					status, msg := mapSessionError(err)
+					status, msg := mapLoginsError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"ok": true, "deleted": sessionId})
+				WriteJSON(w, 200, out)
 			})
 		}
 
-		// ===== Attendance routes =====
-		if d.AttendanceSvc != nil {
-			// List attendance
-			pr.Get("/v1/dojos/{dojoId}/attendance", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+		if d.AuditSvc != nil {
+			// The caller's own security events
+			pr.Get("/v1/me/security-events", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				in, ok := auditListInput(w, r)
+				if !ok {
 					return
 				}
+				in.UID = au.UID
+				in.Type = ""
 
-				input := attendance.ListAttendanceInput{
-					DojoID:            dojoId,
-					SessionInstanceID: r.URL.Query().Get("sessionInstanceId"),
-					MemberUID:         r.URL.Query().Get("memberUid"),
-				}
-				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-					if limit, err := strconv.Atoi(limitStr); err == nil {
-						input.Limit = limit
-					}
-				}
-
-				out, err := d.AttendanceSvc.List(r.Context(), input)
+				out, err := d.AuditSvc.List(r.Context(), in)
 				if err != nil {
-					status, msg := mapAttendanceError(err)
+					status, msg := mapAuditError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"attendance": out})
+				WriteJSON(w, 200, map[string]any{"events": out})
 			})
 
-			// Record attendance
-			pr.Post("/v1/dojos/{dojoId}/attendance", func(w http.ResponseWriter, r *http.Request) {
+			// Audit log by ?uid= or ?type= (admin only)
+			pr.Get("/v1/admin/audit", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
-
-				var in attendance.RecordAttendanceInput
-				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-					Fail(w, 400, "invalid json")
+				in, ok := auditListInput(w, r)
+				if !ok {
 					return
 				}
-				in.DojoID = dojoId
-				in.Trim()
 
-				out, err := d.AttendanceSvc.Record(r.Context(), au.UID, in)
+				out, err := d.AuditSvc.List(r.Context(), in)
 				if err != nil {
-					status, msg := mapAttendanceError(err)
+					status, msg := mapAuditError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 201, out)
+				WriteJSON(w, 200, map[string]any{"entries": out})
 			})
+		}
 
-			// Update attendance
-			pr.Put("/v1/dojos/{dojoId}/attendance/{attendanceId}", func(w http.ResponseWriter, r *http.Request) {
+		// ===== Impersonation (admins seeing the app as a member, for support) =====
+		if d.ImpersonationSvc != nil {
+			// Start a session; the token goes in X-Impersonation-Token
+			pr.Post("/v1/admin/impersonations", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				attendanceId := chi.URLParam(r, "attendanceId")
-				if dojoId == "" || attendanceId == "" {
-					Fail(w, 400, "missing dojoId or attendanceId")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
-
-				var in attendance.UpdateAttendanceInput
+				var in impersonation.StartInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-				in.DojoID = dojoId
-				in.ID = attendanceId
-				in.Trim()
 
-				out, err := d.AttendanceSvc.Update(r.Context(), au.UID, in)
+				meta := requestMeta(r)
+				out, err := d.ImpersonationSvc.Start(r.Context(), au.UID, in, meta.IP, meta.UserAgent)
 				if err != nil {
-					status, msg := mapAttendanceError(err)
+					status, msg := mapImpersonationError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, out)
+				WriteJSON(w, 201, out)
 			})
 
-			// Bulk attendance
-			pr.Post("/v1/dojos/{dojoId}/attendance/bulk", func(w http.ResponseWriter, r *http.Request) {
+			// ?mine=true&active=true&limit=
+			pr.Get("/v1/admin/impersonations", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
-
-				var in attendance.BulkAttendanceInput
-				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-					Fail(w, 400, "invalid json")
-					return
+				q := r.URL.Query()
+				in := impersonation.ListInput{Active: q.Get("active") == "true"}
+				if q.Get("mine") == "true" {
+					in.AdminUID = au.UID
+				}
+				if v := q.Get("limit"); v != "" {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						Fail(w, 400, "limit must be a number")
+						return
+					}
+					in.Limit = n
 				}
-				in.DojoID = dojoId
 
-				results, err := d.AttendanceSvc.BulkRecord(r.Context(), au.UID, in)
+				out, err := d.ImpersonationSvc.List(r.Context(), in)
 				if err != nil {
-					status, msg := mapAttendanceError(err)
+					status, msg := mapImpersonationError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true, "processed": len(results), "results": results})
+				WriteJSON(w, 200, map[string]any{"impersonations": out})
 			})
-		}
 
-		// ===== Ranks routes =====
-		if d.RanksSvc != nil {
-			// Update member rank
-			pr.Post("/v1/dojos/{dojoId}/members/{memberUid}/rank", func(w http.ResponseWriter, r *http.Request) {
+			pr.Delete("/v1/admin/impersonations/{id}", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				memberUid := chi.URLParam(r, "memberUid")
-				if dojoId == "" || memberUid == "" {
-					Fail(w, 400, "missing dojoId or memberUid")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
 
-				var in ranks.UpdateMemberRankInput
-				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-					Fail(w, 400, "invalid json")
+				meta := requestMeta(r)
+				out, err := d.ImpersonationSvc.End(r.Context(), au.UID, chi.URLParam(r, "id"), meta.IP, meta.UserAgent)
+				if err != nil {
+					status, msg := mapImpersonationError(err)
+					Fail(w, status, msg)
 					return
 				}
-				in.DojoID = dojoId
-				in.MemberUID = memberUid
-				in.Trim()
+				WriteJSON(w, 200, out)
+			})
 
-				out, err := d.RanksSvc.UpdateMemberRank(r.Context(), au.UID, in)
+			// Whether platform admins may impersonate the dojo's members
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/impersonation-consent", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.ImpersonationSvc.GetConsent(r.Context(), chi.URLParam(r, "dojoId"))
 				if err != nil {
-					status, msg := mapRanksError(err)
+					status, msg := mapImpersonationError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
 
-			// Add stripe
-			pr.Post("/v1/dojos/{dojoId}/members/{memberUid}/stripe", func(w http.ResponseWriter, r *http.Request) {
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/impersonation-consent", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				memberUid := chi.URLParam(r, "memberUid")
-				if dojoId == "" || memberUid == "" {
-					Fail(w, 400, "missing dojoId or memberUid")
-					return
-				}
-
-				var in ranks.AddStripeInput
+				var in impersonation.UpdateConsentInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-				in.DojoID = dojoId
-				in.MemberUID = memberUid
-				in.Trim()
 
-				out, err := d.RanksSvc.AddStripe(r.Context(), au.UID, in)
+				meta := requestMeta(r)
+				out, err := d.ImpersonationSvc.UpdateConsent(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in, meta.IP, meta.UserAgent)
 				if err != nil {
-					status, msg := mapRanksError(err)
+					status, msg := mapImpersonationError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
+		}
 
-			// Get rank history
-			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/rankHistory", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				memberUid := chi.URLParam(r, "memberUid")
-				if dojoId == "" || memberUid == "" {
-					Fail(w, 400, "missing dojoId or memberUid")
-					return
-				}
+		// Purge dojos whose grace period has ended (admin only, called by scheduler)
+		pr.With(slow).Post("/v1/admin/dojos/purge", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			if !middleware.IsAdmin(au.Claims) {
+				Fail(w, 403, "admin privileges required")
+				return
+			}
 
-				out, err := d.RanksSvc.GetRankHistory(r.Context(), dojoId, memberUid)
-				if err != nil {
-					status, msg := mapRanksError(err)
-					Fail(w, status, msg)
-					return
-				}
-				WriteJSON(w, 200, map[string]any{"history": out})
-			})
+			out, err := d.DojoSvc.PurgeExpired(r.Context(), time.Now().UTC())
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, out)
+		})
 
-			// Get belt distribution
-			pr.Get("/v1/dojos/{dojoId}/beltDistribution", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+		// Drop FCM tokens unused for 270 days (admin only, called daily by scheduler)
+		if d.PushTokensSvc != nil {
+			pr.With(slow).Post("/v1/admin/push-tokens/prune", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
 
-				out, err := d.RanksSvc.GetBeltDistribution(r.Context(), dojoId)
+				out, err := d.PushTokensSvc.PruneStale(r.Context(), time.Now().UTC())
 				if err != nil {
-					status, msg := mapRanksError(err)
-					Fail(w, status, msg)
+					Fail(w, 500, err.Error())
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
 		}
 
-		// ===== Stats routes =====
-		if d.StatsSvc != nil {
-			// Get dojo stats
-			pr.Get("/v1/dojos/{dojoId}/stats", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
-					return
-				}
-
-				out, err := d.StatsSvc.GetDojoStats(r.Context(), dojoId)
-				if err != nil {
-					status, msg := mapStatsError(err)
-					Fail(w, status, msg)
+		// ===== Booking reminders =====
+		if d.RemindersSvc != nil {
+			// Send reminders for bookings starting soon (admin only, called by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/reminders/bookings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
-				WriteJSON(w, 200, out)
-			})
 
-			// Get member stats
-			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/stats", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				memberUid := chi.URLParam(r, "memberUid")
-				if dojoId == "" || memberUid == "" {
-					Fail(w, 400, "missing dojoId or memberUid")
-					return
+				var in reminders.RunInput
+				if r.ContentLength > 0 {
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
 				}
 
-				out, err := d.StatsSvc.GetMemberStats(r.Context(), dojoId, memberUid)
+				out, err := d.RemindersSvc.SendBookingReminders(r.Context(), time.Now().UTC(), in)
 				if err != nil {
-					status, msg := mapStatsError(err)
+					status, msg := mapRemindersError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
 
-			// Get attendance stats
-			pr.Get("/v1/dojos/{dojoId}/attendanceStats", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+			// Remind coaches of classes with no attendance yet (admin only, called by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/reminders/roll-call", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
-
-				period := r.URL.Query().Get("period")
-				sessionId := r.URL.Query().Get("sessionId")
-
-				out, err := d.StatsSvc.GetAttendanceStats(r.Context(), dojoId, period, sessionId)
+				out, err := d.RemindersSvc.SendRollCallReminders(r.Context(), time.Now().UTC())
 				if err != nil {
-					status, msg := mapStatsError(err)
+					status, msg := mapRemindersError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
-		}
-
-		// ===== Notifications routes =====
-		if d.NotificationsSvc != nil {
-			// Get notifications
-			pr.Get("/v1/notifications", func(w http.ResponseWriter, r *http.Request) {
-				au, _ := middleware.GetAuthUser(r.Context())
-				unreadOnly := r.URL.Query().Get("unreadOnly") == "true"
-				limit := 50
-				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-					if l, err := strconv.Atoi(limitStr); err == nil {
-						limit = l
-					}
-				}
 
-				out, err := d.NotificationsSvc.GetNotifications(r.Context(), au.UID, unreadOnly, limit)
+			// Roll-call reminder settings of a dojo
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/roll-call-reminders", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.RemindersSvc.GetRollCallSettings(r.Context(), chi.URLParam(r, "dojoId"))
 				if err != nil {
-					status, msg := mapNotificationsError(err)
+					status, msg := mapRemindersError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
 
-			// Mark notification as read
-			pr.Post("/v1/notifications/markRead", func(w http.ResponseWriter, r *http.Request) {
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/roll-call-reminders", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-
-				var in notifications.MarkReadInput
+				var in reminders.UpdateRollCallInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-
-				count, err := d.NotificationsSvc.MarkRead(r.Context(), au.UID, in)
+				out, err := d.RemindersSvc.UpdateRollCallSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
 				if err != nil {
-					status, msg := mapNotificationsError(err)
+					status, msg := mapRemindersError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true, "marked": count})
+				WriteJSON(w, 200, out)
 			})
 
-			// Create notification (staff only)
-			pr.Post("/v1/notifications", func(w http.ResponseWriter, r *http.Request) {
+			// Reminder opt-ins of the caller
+			pr.Get("/v1/reminders/preferences", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				if !middleware.IsStaff(au.Claims) {
-					Fail(w, 403, "staff permission required")
-					return
-				}
-
-				var in notifications.CreateNotificationInput
-				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-					Fail(w, 400, "invalid json")
-					return
-				}
-				in.Trim()
-
-				// ★ Check plan limit before creating announcement (if dojoId provided)
-				if in.DojoID != "" && d.StripeSvc != nil {
-					if err := d.StripeSvc.CheckPlanLimit(r.Context(), in.DojoID, "announcement"); err != nil {
-						if stripedom.IsErrLimitReached(err) {
-							Fail(w, 402, err.Error())
-							return
-						}
-					}
-				}
-
-				id, err := d.NotificationsSvc.CreateNotification(r.Context(), au.UID, in)
+				out, err := d.RemindersSvc.GetPreferences(r.Context(), au.UID)
 				if err != nil {
-					status, msg := mapNotificationsError(err)
+					status, msg := mapRemindersError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 201, map[string]any{"success": true, "id": id})
+				WriteJSON(w, 200, out)
 			})
 
-			// Send bulk notification (staff only)
-			pr.Post("/v1/notifications/bulk", func(w http.ResponseWriter, r *http.Request) {
+			pr.Put("/v1/reminders/preferences", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				if !middleware.IsStaff(au.Claims) {
-					Fail(w, 403, "staff permission required")
-					return
-				}
-
-				var in notifications.SendBulkNotificationInput
+				var in reminders.UpdatePreferencesInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-				in.Trim()
-
-				// ★ Check plan limit before sending bulk announcement
-				if d.StripeSvc != nil {
-					if err := d.StripeSvc.CheckPlanLimit(r.Context(), in.DojoID, "announcement"); err != nil {
-						if stripedom.IsErrLimitReached(err) {
-							Fail(w, 402, err.Error())
-							return
-						}
-					}
-				}
-
-				count, err := d.NotificationsSvc.SendBulkNotification(r.Context(), au.UID, in)
+				out, err := d.RemindersSvc.UpdatePreferences(r.Context(), au.UID, in)
 				if err != nil {
-					status, msg := mapNotificationsError(err)
+					status, msg := mapRemindersError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true, "sent": count})
+				WriteJSON(w, 200, out)
 			})
+		}
+
+		// ===== Dojo permissions (role matrix + overrides) =====
+		pr.Get("/v1/dojos/{dojoId}/permissions", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			dojoId := chi.URLParam(r, "dojoId")
+
+			out, err := d.DojoSvc.GetPermissions(r.Context(), au.UID, dojoId)
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, out)
+		})
+
+		pr.Put("/v1/dojos/{dojoId}/permissions", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			dojoId := chi.URLParam(r, "dojoId")
+
+			var in dojo.UpdatePermissionsInput
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				Fail(w, 400, "invalid json")
+				return
+			}
+
+			out, err := d.DojoSvc.UpdatePermissions(r.Context(), au.UID, dojoId, in)
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, out)
+		})
+
+		// ===== Dojo calendar (week start + locale formatting hints) =====
+		pr.Get("/v1/dojos/{dojoId}/calendar", func(w http.ResponseWriter, r *http.Request) {
+			out, err := d.DojoRepo.GetCalendarSettings(r.Context(), chi.URLParam(r, "dojoId"))
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, map[string]any{"settings": out, "calendar": out.Hints()})
+		})
+
+		pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/calendar", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			var in dojo.UpdateCalendarInput
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				Fail(w, 400, "invalid json")
+				return
+			}
+
+			out, err := d.DojoSvc.UpdateCalendarSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, map[string]any{"settings": out, "calendar": out.Hints()})
+		})
+
+		// ===== Join settings (verified email requirement) =====
+		pr.Get("/v1/dojos/{dojoId}/join-settings", func(w http.ResponseWriter, r *http.Request) {
+			out, err := d.DojoRepo.GetJoinSettings(r.Context(), chi.URLParam(r, "dojoId"))
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, out)
+		})
+
+		pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/join-settings", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			var in dojo.UpdateJoinSettingsInput
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				Fail(w, 400, "invalid json")
+				return
+			}
+
+			out, err := d.DojoSvc.UpdateJoinSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+			if err != nil {
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, out)
+		})
+
+		pr.Post("/v1/dojos/{dojoId}/joinRequests", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			dojoId := chi.URLParam(r, "dojoId")
+			if dojoId == "" {
+				Fail(w, 400, "missing dojoId")
+				return
+			}
+
+			var in dojo.CreateJoinRequestInput
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				Fail(w, 400, "invalid json")
+				return
+			}
+			in.Trim()
+
+			out, err := d.DojoSvc.CreateJoinRequest(r.Context(), au.UID, dojoId, in)
+			if err != nil {
+				if failEmailNotVerified(w, err) {
+					return
+				}
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 201, out)
+		})
+
+		pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/joinRequests/{studentUid}/approve", func(w http.ResponseWriter, r *http.Request) {
+			au, _ := middleware.GetAuthUser(r.Context())
+			dojoId := chi.URLParam(r, "dojoId")
+			studentUid := chi.URLParam(r, "studentUid")
+			if dojoId == "" || studentUid == "" {
+				Fail(w, 400, "missing dojoId or studentUid")
+				return
+			}
+
+			// ★ Check plan limit before approving (adds a member)
+			if d.StripeSvc != nil {
+				if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "member"); err != nil {
+					if failPlanLimit(w, err) {
+						return
+					}
+				}
+			}
+
+			out, err := d.DojoSvc.ApproveJoinRequest(r.Context(), au.UID, dojoId, studentUid)
+			if err != nil {
+				if failEmailNotVerified(w, err) {
+					return
+				}
+				status, msg := mapDojoError(err)
+				Fail(w, status, msg)
+				return
+			}
+			WriteJSON(w, 200, out)
+		})
+
+		// ===== Session (Class) CRUD routes =====
+		if d.SessionSvc != nil {
+			// Create session
+			pr.With(perm(dojo.PermSessionsWrite)).Post("/v1/dojos/{dojoId}/sessions", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				// ★ Check plan limit before creating class
+				if d.StripeSvc != nil {
+					if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "class"); err != nil {
+						if failPlanLimit(w, err) {
+							return
+						}
+					}
+				}
+
+				var in session.CreateSessionInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.Trim()
+
+				out, err := d.SessionSvc.Create(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					if failPlanLimit(w, err) {
+						return
+					}
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// List sessions
+			pr.Get("/v1/dojos/{dojoId}/sessions", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				// Parse query params
+				var input session.ListSessionsInput
+				if dayStr := r.URL.Query().Get("dayOfWeek"); dayStr != "" {
+					if day, err := strconv.Atoi(dayStr); err == nil {
+						input.DayOfWeek = &day
+					}
+				}
+				if r.URL.Query().Get("activeOnly") == "true" {
+					input.ActiveOnly = true
+				}
+				input.InstructorUID = strings.TrimSpace(r.URL.Query().Get("instructorUid"))
+				if tags := r.URL.Query().Get("tags"); tags != "" {
+					input.Tags = strings.Split(tags, ",")
+				}
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if limit, err := strconv.ParseInt(limitStr, 10, 64); err == nil {
+						input.Limit = limit
+					}
+				}
+
+				out, err := d.SessionSvc.List(r.Context(), dojoId, input)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"sessions": out})
+			})
+
+			// Tags classes may carry (defaults until the dojo sets its own)
+			pr.Get("/v1/dojos/{dojoId}/session-tags", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.SessionSvc.GetTagSet(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/session-tags", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in session.UpdateTagSetInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.SessionSvc.UpdateTagSet(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Classes taught by an instructor (teaching report)
+			pr.Get("/v1/dojos/{dojoId}/instructors/{instructorUid}/sessions", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				instructorUid := chi.URLParam(r, "instructorUid")
+				if dojoId == "" || instructorUid == "" {
+					Fail(w, 400, "missing dojoId or instructorUid")
+					return
+				}
+
+				out, err := d.SessionSvc.ListByInstructor(r.Context(), dojoId, instructorUid)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"sessions": out})
+			})
+
+			// Regular attendees of a class (roster suggestions for bulk attendance, with the class staff notes)
+			if d.AttendanceSvc != nil {
+				pr.With(perm(dojo.PermAttendanceWrite)).Get("/v1/dojos/{dojoId}/sessions/{sessionId}/regulars", func(w http.ResponseWriter, r *http.Request) {
+					dojoId := chi.URLParam(r, "dojoId")
+					sessionId := chi.URLParam(r, "sessionId")
+
+					var in attendance.RegularsInput
+					if v, err := strconv.Atoi(r.URL.Query().Get("weeks")); err == nil {
+						in.Weeks = v
+					}
+					if v, err := strconv.ParseFloat(r.URL.Query().Get("minRate"), 64); err == nil {
+						in.MinRate = v
+					}
+					if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+						in.Limit = v
+					}
+
+					out, err := d.AttendanceSvc.Regulars(r.Context(), dojoId, sessionId, in)
+					if err != nil {
+						status, msg := mapAttendanceError(err)
+						Fail(w, status, msg)
+						return
+					}
+					WriteJSON(w, 200, out)
+				})
+			}
+
+			// Instructor-only notes on a class (never shown to members; also on the roster)
+			pr.With(perm(dojo.PermSessionsWrite)).Get("/v1/dojos/{dojoId}/sessions/{sessionId}/staff-notes", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.SessionSvc.ListStaffNotes(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "sessionId"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"notes": out})
+			})
+
+			pr.With(perm(dojo.PermSessionsWrite)).Post("/v1/dojos/{dojoId}/sessions/{sessionId}/staff-notes", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in session.StaffNoteInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.SessionSvc.AddStaffNote(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "sessionId"), in)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermSessionsWrite)).Put("/v1/dojos/{dojoId}/sessions/{sessionId}/staff-notes/{noteId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in session.StaffNoteInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.SessionSvc.UpdateStaffNote(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "sessionId"), chi.URLParam(r, "noteId"), in)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSessionsWrite)).Delete("/v1/dojos/{dojoId}/sessions/{sessionId}/staff-notes/{noteId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				noteId := chi.URLParam(r, "noteId")
+				err := d.SessionSvc.DeleteStaffNote(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "sessionId"), noteId)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"ok": true, "deleted": noteId})
+			})
+
+			// Booking windows and cancellation policy of a dojo
+			pr.Get("/v1/dojos/{dojoId}/booking-policy", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.SessionSvc.GetBookingPolicy(r.Context(), au.UID, chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSessionsWrite)).Put("/v1/dojos/{dojoId}/booking-policy", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in session.UpdateBookingPolicyInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				out, err := d.SessionSvc.UpdateBookingPolicy(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// No-show penalties: members barred from booking, a member's record and staff overrides
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/booking-restrictions", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.SessionSvc.ListBookingRestrictions(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"members": out})
+			})
+
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/members/{memberUid}/booking-record", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.SessionSvc.GetBookingRecord(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermMembersWrite)).Delete("/v1/dojos/{dojoId}/members/{memberUid}/booking-restriction", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.SessionSvc.LiftBookingRestriction(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermMembersWrite)).Delete("/v1/dojos/{dojoId}/booking-strikes/{strikeId}", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.SessionSvc.ForgiveStrike(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "strikeId"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Mark no-shows of recently ended classes (admin only, called by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/bookings/no-shows", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+				out, err := d.SessionSvc.RunNoShows(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Resolve a session instance id to its class and date
+			pr.Get("/v1/dojos/{dojoId}/instances/{instanceId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				instanceId := chi.URLParam(r, "instanceId")
+
+				out, err := d.SessionSvc.ResolveInstance(r.Context(), au.UID, dojoId, instanceId)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Book the caller into a class instance within the dojo's booking window
+			pr.Post("/v1/dojos/{dojoId}/instances/{instanceId}/reservation", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.SessionSvc.Book(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "instanceId"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Cancel the caller's reservation (late cancellations are counted)
+			pr.Delete("/v1/dojos/{dojoId}/instances/{instanceId}/reservation", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.SessionSvc.CancelReservation(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "instanceId"))
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Lesson plan / post-class summary of a session instance ("YYYY-MM-DD__sessionId")
+			pr.Get("/v1/dojos/{dojoId}/instances/{instanceId}/notes", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				instanceId := chi.URLParam(r, "instanceId")
+
+				out, err := d.SessionSvc.GetInstanceNotes(r.Context(), au.UID, dojoId, instanceId)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSessionsWrite)).Put("/v1/dojos/{dojoId}/instances/{instanceId}/lessonPlan", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				instanceId := chi.URLParam(r, "instanceId")
+
+				var in session.LessonPlanInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.SessionSvc.PutLessonPlan(r.Context(), au.UID, dojoId, instanceId, in)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSessionsWrite)).Put("/v1/dojos/{dojoId}/instances/{instanceId}/summary", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				instanceId := chi.URLParam(r, "instanceId")
+
+				var in session.ClassSummaryInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.SessionSvc.PutSummary(r.Context(), au.UID, dojoId, instanceId, in)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Get session
+			pr.Get("/v1/dojos/{dojoId}/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				sessionId := chi.URLParam(r, "sessionId")
+				if dojoId == "" || sessionId == "" {
+					Fail(w, 400, "missing dojoId or sessionId")
+					return
+				}
+
+				out, err := d.SessionSvc.Get(r.Context(), dojoId, sessionId)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Update session
+			pr.With(perm(dojo.PermSessionsWrite)).Put("/v1/dojos/{dojoId}/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				sessionId := chi.URLParam(r, "sessionId")
+				if dojoId == "" || sessionId == "" {
+					Fail(w, 400, "missing dojoId or sessionId")
+					return
+				}
+
+				var in session.UpdateSessionInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.Trim()
+
+				out, err := d.SessionSvc.Update(r.Context(), au.UID, dojoId, sessionId, in)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Delete session
+			pr.With(perm(dojo.PermSessionsWrite)).Delete("/v1/dojos/{dojoId}/sessions/{sessionId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				sessionId := chi.URLParam(r, "sessionId")
+				if dojoId == "" || sessionId == "" {
+					Fail(w, 400, "missing dojoId or sessionId")
+					return
+				}
+
+				err := d.SessionSvc.Delete(r.Context(), au.UID, dojoId, sessionId)
+				if err != nil {
+					status, msg := mapSessionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"ok": true, "deleted": sessionId})
+			})
+		}
+
+		// ===== Attendance routes =====
+		if d.AttendanceSvc != nil {
+			// List attendance (?sessionInstanceId=&memberUid=&status=present,late&from=&to=YYYY-MM-DD&sort=asc|desc&limit=)
+			pr.Get("/v1/dojos/{dojoId}/attendance", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				input := attendance.ListAttendanceInput{
+					DojoID:            dojoId,
+					SessionInstanceID: r.URL.Query().Get("sessionInstanceId"),
+					MemberUID:         r.URL.Query().Get("memberUid"),
+					From:              r.URL.Query().Get("from"),
+					To:                r.URL.Query().Get("to"),
+					Sort:              r.URL.Query().Get("sort"),
+				}
+				if v := r.URL.Query().Get("status"); v != "" {
+					input.Statuses = strings.Split(v, ",")
+				}
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if limit, err := strconv.Atoi(limitStr); err == nil {
+						input.Limit = limit
+					}
+				}
+
+				out, err := d.AttendanceSvc.List(r.Context(), input)
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"attendance": out})
+			})
+
+			// Record attendance; the member is named by memberUid, memberNumber or memberEmail
+			pr.With(perm(dojo.PermAttendanceWrite)).Post("/v1/dojos/{dojoId}/attendance", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				var in attendance.RecordAttendanceInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+				in.Trim()
+
+				out, err := d.AttendanceSvc.Record(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Update attendance
+			pr.With(perm(dojo.PermAttendanceWrite)).Put("/v1/dojos/{dojoId}/attendance/{attendanceId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				attendanceId := chi.URLParam(r, "attendanceId")
+				if dojoId == "" || attendanceId == "" {
+					Fail(w, 400, "missing dojoId or attendanceId")
+					return
+				}
+
+				var in attendance.UpdateAttendanceInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+				in.ID = attendanceId
+				in.Trim()
+
+				out, err := d.AttendanceSvc.Update(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Check a member out of a class (guardians of kids are pushed)
+			pr.With(perm(dojo.PermAttendanceWrite)).Post("/v1/dojos/{dojoId}/attendance/{attendanceId}/check-out", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.AttendanceSvc.CheckOut(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "attendanceId"))
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Revision history of a record (previous status, who, when, reason)
+			pr.With(perm(dojo.PermAttendanceWrite)).Get("/v1/dojos/{dojoId}/attendance/{attendanceId}/revisions", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.AttendanceSvc.History(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "attendanceId"))
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Attendance retention policy: how many years of raw records are kept
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/attendance-retention", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.AttendanceSvc.GetRetentionPolicy(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/attendance-retention", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in attendance.UpdateRetentionPolicyInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				out, err := d.AttendanceSvc.UpdateRetentionPolicy(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Monthly summaries of archived attendance
+			pr.With(perm(dojo.PermAttendanceWrite)).Get("/v1/dojos/{dojoId}/attendance-archive", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.AttendanceSvc.ListMonthlySummaries(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"months": out})
+			})
+
+			// Archive attendance past each dojo's retention policy (admin only, called daily by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/attendance/archive", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+				out, err := d.AttendanceSvc.ArchiveOld(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Bulk attendance
+			pr.With(perm(dojo.PermAttendanceWrite), bodyLimit(bulkBodyLimit)).Post("/v1/dojos/{dojoId}/attendance/bulk", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				var in attendance.BulkAttendanceInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+
+				results, err := d.AttendanceSvc.BulkRecord(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapAttendanceError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true, "processed": len(results), "results": results})
+			})
+		}
+
+		// ===== Ranks routes =====
+		if d.RanksSvc != nil {
+			// Update member rank
+			pr.With(perm(dojo.PermRanksWrite)).Post("/v1/dojos/{dojoId}/members/{memberUid}/rank", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				var in ranks.UpdateMemberRankInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+				in.MemberUID = memberUid
+				in.Trim()
+
+				out, err := d.RanksSvc.UpdateMemberRank(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Correct a rank recorded by mistake, or demote (owner only)
+			pr.With(perm(dojo.PermRanksWrite)).Post("/v1/dojos/{dojoId}/members/{memberUid}/rank/corrections", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.CorrectRankInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.CorrectRank(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Add stripe
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/members/{memberUid}/stripe", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				var in ranks.AddStripeInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+				in.MemberUID = memberUid
+				in.Trim()
+
+				out, err := d.RanksSvc.AddStripe(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Get rank history
+			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/rankHistory", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				out, err := d.RanksSvc.GetRankHistory(r.Context(), dojoId, memberUid)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"history": out})
+			})
+
+			// Get belt distribution
+			pr.Get("/v1/dojos/{dojoId}/beltDistribution", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				out, err := d.RanksSvc.GetBeltDistribution(r.Context(), dojoId)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Belt promotions in a federation registry format (CSV by default)
+			pr.With(perm(dojo.PermRanksWrite), slow).Get("/v1/dojos/{dojoId}/ranks/registry-export", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				q := r.URL.Query()
+
+				now := time.Now().UTC()
+				in := ranks.RegistryExportInput{
+					From: time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC),
+					To:   now.AddDate(0, 0, 1).Truncate(24 * time.Hour),
+				}
+				if v := q.Get("from"); v != "" {
+					t, err := time.Parse("2006-01-02", v)
+					if err != nil {
+						Fail(w, 400, "from must be YYYY-MM-DD")
+						return
+					}
+					in.From = t
+				}
+				if v := q.Get("to"); v != "" {
+					t, err := time.Parse("2006-01-02", v)
+					if err != nil {
+						Fail(w, 400, "to must be YYYY-MM-DD")
+						return
+					}
+					in.To = t.AddDate(0, 0, 1) // inclusive day
+				}
+				if v := q.Get("belts"); v != "" {
+					for _, b := range strings.Split(v, ",") {
+						if b = strings.TrimSpace(b); b != "" {
+							in.Belts = append(in.Belts, b)
+						}
+					}
+				}
+
+				rows, err := d.RanksSvc.RegistryExport(r.Context(), dojoId, in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				if q.Get("format") == "json" {
+					WriteJSON(w, 200, map[string]any{"promotions": rows})
+					return
+				}
+
+				filename := "belt-registry-" + in.From.Format("20060102") + "-" + in.To.AddDate(0, 0, -1).Format("20060102") + ".csv"
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+				w.WriteHeader(200)
+				_ = ranks.WriteRegistryCSV(w, rows) // headers are sent; a failed write only truncates the file
+			})
+
+			// Rank claims: a member brings a rank from another dojo, staff verify it
+			pr.Post("/v1/dojos/{dojoId}/rank-claims", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.SubmitClaimInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.SubmitClaim(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermRanksWrite)).Get("/v1/dojos/{dojoId}/rank-claims", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.RanksSvc.ListClaims(r.Context(), chi.URLParam(r, "dojoId"), r.URL.Query().Get("status"))
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"claims": out})
+			})
+
+			pr.Get("/v1/dojos/{dojoId}/rank-claims/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.RanksSvc.GetClaim(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"))
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermRanksWrite)).Post("/v1/dojos/{dojoId}/rank-claims/{memberUid}/review", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.ReviewClaimInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.ReviewClaim(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Promotion ceremonies: confirming a grading applies the promotions,
+			// schedules the ceremony and invites the members and their families
+			pr.With(perm(dojo.PermRanksWrite)).Post("/v1/dojos/{dojoId}/ceremonies", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.CreateCeremonyInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.CreateCeremony(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Staff see every ceremony, members the ones they are invited to
+			pr.Get("/v1/dojos/{dojoId}/ceremonies", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.RanksSvc.ListCeremonies(r.Context(), au.UID, chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"ceremonies": out})
+			})
+
+			pr.Get("/v1/dojos/{dojoId}/ceremonies/{ceremonyId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.RanksSvc.GetCeremony(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "ceremonyId"))
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.Post("/v1/dojos/{dojoId}/ceremonies/{ceremonyId}/rsvp", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.RSVPInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.RSVP(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "ceremonyId"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Attach an uploaded photo, linked to the rank history of the members on it
+			pr.With(perm(dojo.PermRanksWrite)).Post("/v1/dojos/{dojoId}/ceremonies/{ceremonyId}/photos", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.AddCeremonyPhotoInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.AddCeremonyPhoto(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "ceremonyId"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Dual control: when requireApproval is on, only owners promote
+			// directly; coaches propose and an owner approves or rejects
+			pr.With(perm(dojo.PermRanksWrite)).Get("/v1/dojos/{dojoId}/promotion-settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.RanksSvc.GetPromotionSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/promotion-settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in struct {
+					RequireApproval bool `json:"requireApproval"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.UpdatePromotionSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in.RequireApproval)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermRanksWrite)).Post("/v1/dojos/{dojoId}/promotion-proposals", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.ProposePromotionInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RanksSvc.ProposePromotion(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermRanksWrite)).Get("/v1/dojos/{dojoId}/promotion-proposals", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.RanksSvc.ListProposals(r.Context(), au.UID, chi.URLParam(r, "dojoId"), r.URL.Query().Get("status"))
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"proposals": out})
+			})
+
+			// Approve applies the promotion and notifies the member (owner only)
+			pr.Post("/v1/dojos/{dojoId}/promotion-proposals/{proposalId}/approve", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.DecideProposalInput
+				if r.ContentLength != 0 {
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+				}
+
+				out, err := d.RanksSvc.ApproveProposal(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "proposalId"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.Post("/v1/dojos/{dojoId}/promotion-proposals/{proposalId}/reject", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in ranks.DecideProposalInput
+				if r.ContentLength != 0 {
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+				}
+
+				out, err := d.RanksSvc.RejectProposal(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "proposalId"), in)
+				if err != nil {
+					status, msg := mapRanksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Stats routes =====
+		if d.StatsSvc != nil {
+			// Get dojo stats
+			pr.With(slow).Get("/v1/dojos/{dojoId}/stats", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				out, err := d.StatsSvc.GetDojoStats(r.Context(), dojoId)
+				if err != nil {
+					status, msg := mapStatsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Get member stats
+			pr.With(slow).Get("/v1/dojos/{dojoId}/members/{memberUid}/stats", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				out, err := d.StatsSvc.GetMemberStats(r.Context(), dojoId, memberUid)
+				if err != nil {
+					status, msg := mapStatsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Get attendance stats (?period=day|week|month or ?from=&to=, &compare=true)
+			pr.With(slow).Get("/v1/dojos/{dojoId}/attendanceStats", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				q := r.URL.Query()
+				out, err := d.StatsSvc.GetAttendanceStats(r.Context(), dojoId, stats.AttendanceStatsQuery{
+					Period:    q.Get("period"),
+					From:      q.Get("from"),
+					To:        q.Get("to"),
+					SessionID: q.Get("sessionId"),
+					Compare:   q.Get("compare") == "true",
+				})
+				if err != nil {
+					status, msg := mapStatsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Members, belts, attendance and retention per class type and tag
+			// (?period=day|week|month or ?from=&to=)
+			pr.With(perm(dojo.PermMembersView), slow).Get("/v1/dojos/{dojoId}/stats/programs", func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				out, err := d.StatsSvc.GetProgramStats(r.Context(), chi.URLParam(r, "dojoId"), stats.AttendanceStatsQuery{
+					Period: q.Get("period"),
+					From:   q.Get("from"),
+					To:     q.Get("to"),
+				})
+				if err != nil {
+					status, msg := mapStatsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Recompute cohort retention curves (admin only, called daily by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/stats/cohorts/run", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.StatsSvc.RunCohorts(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapStatsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Retention curves of the members who joined in each month
+			pr.With(perm(dojo.PermMembersView), slow).Get("/v1/dojos/{dojoId}/stats/cohorts", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.StatsSvc.GetCohorts(r.Context(), chi.URLParam(r, "dojoId"), time.Now().UTC())
+				if err != nil {
+					status, msg := mapStatsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Average fill rate and trend of capped classes for capacity planning (?weeks=4)
+			pr.With(perm(dojo.PermSessionsWrite), slow).Get("/v1/dojos/{dojoId}/stats/fill-rate", func(w http.ResponseWriter, r *http.Request) {
+				weeks := 0
+				if v := r.URL.Query().Get("weeks"); v != "" {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						Fail(w, 400, "weeks must be a number")
+						return
+					}
+					weeks = n
+				}
+
+				out, err := d.StatsSvc.GetFillRates(r.Context(), chi.URLParam(r, "dojoId"), weeks, time.Now().UTC())
+				if err != nil {
+					status, msg := mapStatsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Owner dashboard =====
+		if d.DashboardSvc != nil {
+			// today's classes, weekly attendance, pending requests, at-risk members, plan usage, fill rates
+			pr.With(slow).Get("/v1/dojos/{dojoId}/dashboard", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				out, err := d.DashboardSvc.Get(r.Context(), au.UID, dojoId)
+				if err != nil {
+					status, msg := mapDashboardError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Class attendance goals =====
+		if d.ClassGoalsSvc != nil {
+			// Notify staff of classes that keep missing their goal (admin only,
+			// called weekly by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/class-goals/check", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.ClassGoalsSvc.CheckAll(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapClassGoalsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Goals vs. actual headcounts with consolidation suggestions (?weeks=4)
+			pr.With(perm(dojo.PermSessionsWrite), slow).Get("/v1/dojos/{dojoId}/class-goals", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				weeks := 0
+				if v := r.URL.Query().Get("weeks"); v != "" {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						Fail(w, 400, "weeks must be a number")
+						return
+					}
+					weeks = n
+				}
+
+				out, err := d.ClassGoalsSvc.GetReport(r.Context(), dojoId, weeks, time.Now().UTC())
+				if err != nil {
+					status, msg := mapClassGoalsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Benchmarking (opt-in, anonymized) =====
+		if d.BenchmarksSvc != nil {
+			// Recompute snapshots and cohorts (admin only, called daily by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/benchmarks/aggregate", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.BenchmarksSvc.Aggregate(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapBenchmarksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Compare the dojo with similar-sized gyms
+			pr.With(slow).Get("/v1/dojos/{dojoId}/benchmarks", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				out, err := d.BenchmarksSvc.Get(r.Context(), au.UID, dojoId)
+				if err != nil {
+					status, msg := mapBenchmarksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Opt-in settings
+			pr.Get("/v1/dojos/{dojoId}/benchmarks/settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				out, err := d.BenchmarksSvc.GetSettings(r.Context(), au.UID, dojoId)
+				if err != nil {
+					status, msg := mapBenchmarksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/benchmarks/settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				var in benchmarks.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.BenchmarksSvc.UpdateSettings(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapBenchmarksError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Notifications routes =====
+		if d.NotificationsSvc != nil {
+			// Get notifications
+			pr.Get("/v1/notifications", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				unreadOnly := r.URL.Query().Get("unreadOnly") == "true"
+				limit := 50
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if l, err := strconv.Atoi(limitStr); err == nil {
+						limit = l
+					}
+				}
+
+				out, err := d.NotificationsSvc.GetNotifications(r.Context(), au.UID, unreadOnly, limit)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Mark notification as read
+			pr.Post("/v1/notifications/markRead", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var in notifications.MarkReadInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				count, err := d.NotificationsSvc.MarkRead(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true, "marked": count})
+			})
+
+			// Create notification (staff only)
+			pr.Post("/v1/notifications", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsStaff(au.Claims) {
+					Fail(w, 403, "staff permission required")
+					return
+				}
+
+				var in notifications.CreateNotificationInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.Trim()
+
+				// ★ Check plan limit before creating announcement (if dojoId provided)
+				if in.DojoID != "" && d.StripeSvc != nil {
+					if err := d.StripeSvc.CheckPlanLimit(r.Context(), in.DojoID, "announcement"); err != nil {
+						if failPlanLimit(w, err) {
+							return
+						}
+					}
+				}
+
+				id, err := d.NotificationsSvc.CreateNotification(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, map[string]any{"success": true, "id": id})
+			})
+
+			// Send bulk notification (staff only)
+			pr.Post("/v1/notifications/bulk", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsStaff(au.Claims) {
+					Fail(w, 403, "staff permission required")
+					return
+				}
+
+				var in notifications.SendBulkNotificationInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.Trim()
+
+				// ★ Check plan limit before sending bulk announcement
+				if d.StripeSvc != nil {
+					if err := d.StripeSvc.CheckPlanLimit(r.Context(), in.DojoID, "announcement"); err != nil {
+						if failPlanLimit(w, err) {
+							return
+						}
+					}
+				}
+
+				count, err := d.NotificationsSvc.SendBulkNotification(r.Context(), au.UID, in)
+				if err != nil {
+					if failPlanLimit(w, err) {
+						return
+					}
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true, "sent": count})
+			})
+
+			// ===== Notices (dojo announcements) =====
+			pr.With(perm(dojo.PermNoticesWrite)).Post("/v1/dojos/{dojoId}/notices", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				var in notifications.CreateNoticeInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+				in.Trim()
+
+				id, err := d.NotificationsSvc.CreateNotice(r.Context(), au.UID, in)
+				if err != nil {
+					if failPlanLimit(w, err) {
+						return
+					}
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+
+				out, err := d.NotificationsSvc.GetNotice(r.Context(), dojoId, id)
+				if err != nil {
+					WriteJSON(w, 201, map[string]any{"id": id})
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// List notices (?filter=active|scheduled|expired|archived); members only see active ones
+			pr.Get("/v1/dojos/{dojoId}/notices", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				in := notifications.ListNoticesInput{Filter: r.URL.Query().Get("filter")}
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if limit, err := strconv.Atoi(limitStr); err == nil {
+						in.Limit = limit
+					}
+				}
+
+				canManage := false
+				if d.DojoRepo != nil {
+					canManage, _ = d.DojoRepo.HasPermission(r.Context(), dojoId, au.UID, dojo.PermNoticesWrite)
+				}
+				if !canManage {
+					if in.Filter != "" && in.Filter != notifications.NoticeFilterActive {
+						Fail(w, 403, "staff permission required")
+						return
+					}
+					in.Filter = notifications.NoticeFilterActive
+				}
+
+				out, err := d.NotificationsSvc.ListNotices(r.Context(), dojoId, in)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"notices": out})
+			})
+
+			pr.Get("/v1/dojos/{dojoId}/notices/{noticeId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				noticeId := chi.URLParam(r, "noticeId")
+
+				out, err := d.NotificationsSvc.GetNotice(r.Context(), dojoId, noticeId)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+
+				if out.State(time.Now().UTC()) != notifications.NoticeFilterActive {
+					canManage := false
+					if d.DojoRepo != nil {
+						canManage, _ = d.DojoRepo.HasPermission(r.Context(), dojoId, au.UID, dojo.PermNoticesWrite)
+					}
+					if !canManage {
+						Fail(w, 404, "notice not found")
+						return
+					}
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermNoticesWrite)).Put("/v1/dojos/{dojoId}/notices/{noticeId}", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				noticeId := chi.URLParam(r, "noticeId")
+
+				var in notifications.UpdateNoticeInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.NotificationsSvc.UpdateNotice(r.Context(), dojoId, noticeId, in)
+				if err != nil {
+					if failPlanLimit(w, err) {
+						return
+					}
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermNoticesWrite)).Post("/v1/dojos/{dojoId}/notices/{noticeId}/archive", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				noticeId := chi.URLParam(r, "noticeId")
+
+				out, err := d.NotificationsSvc.ArchiveNotice(r.Context(), dojoId, noticeId)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// ===== Notification templates ("Class cancelled: {{class}} on {{date}}") =====
+			pr.With(perm(dojo.PermNoticesWrite)).Get("/v1/dojos/{dojoId}/notification-templates", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.NotificationsSvc.ListTemplates(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"templates": out})
+			})
+
+			pr.With(perm(dojo.PermNoticesWrite)).Post("/v1/dojos/{dojoId}/notification-templates", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var in notifications.TemplateInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.NotificationsSvc.CreateTemplate(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermNoticesWrite)).Get("/v1/dojos/{dojoId}/notification-templates/{templateId}", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.NotificationsSvc.GetTemplate(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "templateId"))
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermNoticesWrite)).Put("/v1/dojos/{dojoId}/notification-templates/{templateId}", func(w http.ResponseWriter, r *http.Request) {
+				var in notifications.TemplateInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.NotificationsSvc.UpdateTemplate(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "templateId"), in)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermNoticesWrite)).Delete("/v1/dojos/{dojoId}/notification-templates/{templateId}", func(w http.ResponseWriter, r *http.Request) {
+				if err := d.NotificationsSvc.DeleteTemplate(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "templateId")); err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			// Preview a template with {"variables": {...}} before sending it via /v1/notifications/bulk
+			pr.With(perm(dojo.PermNoticesWrite)).Post("/v1/dojos/{dojoId}/notification-templates/{templateId}/render", func(w http.ResponseWriter, r *http.Request) {
+				var in struct {
+					Variables map[string]string `json:"variables"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.NotificationsSvc.RenderTemplate(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "templateId"), in.Variables)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Notice delivery / read stats (with unopened members for follow-up)
+			pr.With(perm(dojo.PermNoticesWrite)).Get("/v1/dojos/{dojoId}/notices/{noticeId}/stats", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				noticeId := chi.URLParam(r, "noticeId")
+				if dojoId == "" || noticeId == "" {
+					Fail(w, 400, "missing dojoId or noticeId")
+					return
+				}
+
+				out, err := d.NotificationsSvc.GetNoticeStats(r.Context(), dojoId, noticeId)
+				if err != nil {
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Delete notification
+			pr.Delete("/v1/notifications/{notificationId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				notificationId := chi.URLParam(r, "notificationId")
+				if notificationId == "" {
+					Fail(w, 400, "missing notificationId")
+					return
+				}
 
-			// Delete notification
-			pr.Delete("/v1/notifications/{notificationId}", func(w http.ResponseWriter, r *http.Request) {
-				au, _ := middleware.GetAuthUser(r.Context())
-				notificationId := chi.URLParam(r, "notificationId")
-				if notificationId == "" {
-					Fail(w, 400, "missing notificationId")
-					return
-				}
-
 				err := d.NotificationsSvc.DeleteNotification(r.Context(), au.UID, notificationId)
 				if err != nil {
-					status, msg := mapNotificationsError(err)
+					status, msg := mapNotificationsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+		}
+
+		// ===== Dojo chat (history, read markers, unread badges) =====
+		if d.ChatSvc != nil {
+			pr.Get("/v1/me/chat/summary", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.ChatSvc.Summary(r.Context(), au.UID)
+				if err != nil {
+					status, msg := mapChatError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.Get("/v1/dojos/{dojoId}/chat/messages", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in chat.HistoryInput
+				if b := r.URL.Query().Get("before"); b != "" {
+					before, err := time.Parse(time.RFC3339Nano, b)
+					if err != nil {
+						Fail(w, 400, "before must be an RFC3339 timestamp")
+						return
+					}
+					in.Before = &before
+				}
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if l, err := strconv.Atoi(limitStr); err == nil {
+						in.Limit = l
+					}
+				}
+
+				out, err := d.ChatSvc.History(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapChatError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.Post("/v1/dojos/{dojoId}/chat/messages", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in chat.SendMessageInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.ChatSvc.Send(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapChatError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Mark the channel read up to "at" (default now); the marker only moves forward
+			pr.Post("/v1/dojos/{dojoId}/chat/read", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in struct {
+					At *time.Time `json:"at"`
+				}
+				if r.ContentLength != 0 {
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+				}
+
+				out, err := d.ChatSvc.MarkRead(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in.At)
+				if err != nil {
+					status, msg := mapChatError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Kiosk / tablet device management =====
+		if d.DevicesSvc != nil {
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/devices", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.DevicesSvc.List(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapDevicesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"devices": out})
+			})
+
+			// The response carries the device token; it is not shown again
+			pr.With(perm(dojo.PermSettings)).Post("/v1/dojos/{dojoId}/devices", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in devices.DeviceInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.DevicesSvc.Register(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in, requestMeta(r))
+				if err != nil {
+					status, msg := mapDevicesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/devices/{deviceId}", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.DevicesSvc.Get(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "deviceId"))
+				if err != nil {
+					status, msg := mapDevicesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/devices/{deviceId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in devices.DeviceInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.DevicesSvc.Update(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "deviceId"), in, requestMeta(r))
+				if err != nil {
+					status, msg := mapDevicesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Remote revocation: the device's token stops working immediately
+			pr.With(perm(dojo.PermSettings)).Post("/v1/dojos/{dojoId}/devices/{deviceId}/revoke", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.DevicesSvc.Revoke(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "deviceId"), requestMeta(r))
+				if err != nil {
+					status, msg := mapDevicesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Post("/v1/dojos/{dojoId}/devices/{deviceId}/rotate-token", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.DevicesSvc.RotateToken(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "deviceId"), requestMeta(r))
+				if err != nil {
+					status, msg := mapDevicesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/devices/{deviceId}/activity", func(w http.ResponseWriter, r *http.Request) {
+				limit := 0
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if l, err := strconv.Atoi(limitStr); err == nil {
+						limit = l
+					}
+				}
+
+				out, err := d.DevicesSvc.Activity(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "deviceId"), limit)
+				if err != nil {
+					status, msg := mapDevicesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"activity": out})
+			})
+		}
+
+		// ===== NFC/RFID tags (attendance from door readers) =====
+		if d.TagsSvc != nil {
+			// ?memberUid= for one member's tags
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/tags", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.TagsSvc.List(r.Context(), chi.URLParam(r, "dojoId"), r.URL.Query().Get("memberUid"))
+				if err != nil {
+					status, msg := mapTagsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"tags": out})
+			})
+
+			pr.With(perm(dojo.PermMembersWrite)).Put("/v1/dojos/{dojoId}/tags/{tagId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in tags.TagInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.TagsSvc.Register(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "tagId"), in)
+				if err != nil {
+					status, msg := mapTagsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermMembersWrite)).Delete("/v1/dojos/{dojoId}/tags/{tagId}", func(w http.ResponseWriter, r *http.Request) {
+				if err := d.TagsSvc.Delete(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "tagId")); err != nil {
+					status, msg := mapTagsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"deleted": true})
+			})
+
+			// Latest reads; ?outcome=unknown_tag lists cards tapped but not yet registered
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/tag-reads", func(w http.ResponseWriter, r *http.Request) {
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+				out, err := d.TagsSvc.ListReads(r.Context(), chi.URLParam(r, "dojoId"), r.URL.Query().Get("outcome"), limit)
+				if err != nil {
+					status, msg := mapTagsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"reads": out})
+			})
+
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/tag-settings", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.TagsSvc.GetSettings(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapTagsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/tag-settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in tags.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.TagsSvc.UpdateSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapTagsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Media gallery routes =====
+		if d.MediaSvc != nil {
+			// Members see albums shared with members; staff see all
+			pr.Get("/v1/dojos/{dojoId}/albums", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				out, err := d.MediaSvc.ListAlbums(r.Context(), au.UID, chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"albums": out})
+			})
+
+			pr.With(perm(dojo.PermMediaWrite)).Post("/v1/dojos/{dojoId}/albums", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in media.AlbumInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MediaSvc.CreateAlbum(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Album with its photos; image URLs expire after an hour
+			pr.Get("/v1/dojos/{dojoId}/albums/{albumId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				album, photos, err := d.MediaSvc.GetAlbum(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "albumId"))
+				if err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"album": album, "photos": photos})
+			})
+
+			pr.With(perm(dojo.PermMediaWrite)).Put("/v1/dojos/{dojoId}/albums/{albumId}", func(w http.ResponseWriter, r *http.Request) {
+				var in media.AlbumInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MediaSvc.UpdateAlbum(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "albumId"), in)
+				if err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Deletes every image in the album from Storage as well
+			pr.With(perm(dojo.PermMediaWrite), slow).Delete("/v1/dojos/{dojoId}/albums/{albumId}", func(w http.ResponseWriter, r *http.Request) {
+				if err := d.MediaSvc.DeleteAlbum(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "albumId")); err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			// Step 1 of an upload: reserve the photo and get a signed PUT URL
+			pr.With(perm(dojo.PermMediaWrite)).Post("/v1/dojos/{dojoId}/albums/{albumId}/photos", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in media.UploadInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MediaSvc.CreateUpload(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "albumId"), in)
+				if err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Step 2: confirm the PUT finished so the photo shows in the album
+			pr.With(perm(dojo.PermMediaWrite)).Post("/v1/dojos/{dojoId}/albums/{albumId}/photos/{photoId}/complete", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.MediaSvc.CompleteUpload(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "albumId"), chi.URLParam(r, "photoId"))
+				if err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermMediaWrite)).Delete("/v1/dojos/{dojoId}/albums/{albumId}/photos/{photoId}", func(w http.ResponseWriter, r *http.Request) {
+				if err := d.MediaSvc.DeletePhoto(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "albumId"), chi.URLParam(r, "photoId")); err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			pr.With(perm(dojo.PermMediaWrite)).Get("/v1/dojos/{dojoId}/media/usage", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.MediaSvc.GetUsage(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapMediaError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Member QR badges =====
+		if d.BadgesSvc != nil {
+			// ?format=png (default), pdf (card-sized page) or json. Members may
+			// fetch their own badge.
+			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/badge", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				badge, err := d.BadgesSvc.Get(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"))
+				if err != nil {
+					status, msg := mapBadgesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				writeBadges(w, r.URL.Query().Get("format"), []badges.Badge{*badge})
+			})
+
+			// Invalidates the member's printed badge, e.g. a lost card
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/members/{memberUid}/badge/reissue", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.BadgesSvc.Reissue(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"))
+				if err != nil {
+					status, msg := mapBadgesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Every active member's badge on A4 sheets, ten per page
+			pr.With(perm(dojo.PermMembersView), slow).Get("/v1/dojos/{dojoId}/badges", func(w http.ResponseWriter, r *http.Request) {
+				list, err := d.BadgesSvc.List(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapBadgesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				format := r.URL.Query().Get("format")
+				if format == "" {
+					format = "pdf"
+				}
+				writeBadges(w, format, list)
+			})
+
+			// Invalidates every printed badge of the dojo
+			pr.With(perm(dojo.PermSettings)).Post("/v1/dojos/{dojoId}/badges/rotate-key", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if err := d.BadgesSvc.RotateKey(r.Context(), au.UID, chi.URLParam(r, "dojoId")); err != nil {
+					status, msg := mapBadgesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			// Front desk scanner signed in as staff
+			pr.With(perm(dojo.PermAttendanceWrite)).Post("/v1/dojos/{dojoId}/badge-checkin", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in badges.CheckinInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.BadgesSvc.CheckIn(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapBadgesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Birthdays =====
+		if d.BirthdaysSvc != nil {
+			// Greet today's birthdays in opted-in dojos (admin only, called
+			// daily by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/birthdays/send", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.BirthdaysSvc.SendGreetings(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapBirthdaysError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Members with a birthday in ?month=1-12 (default this month)
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/birthdays", func(w http.ResponseWriter, r *http.Request) {
+				month := 0
+				if v := r.URL.Query().Get("month"); v != "" {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						Fail(w, 400, "month must be a number")
+						return
+					}
+					month = n
+				}
+
+				out, err := d.BirthdaysSvc.List(r.Context(), chi.URLParam(r, "dojoId"), month, time.Now().UTC())
+				if err != nil {
+					status, msg := mapBirthdaysError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/birthday-settings", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.BirthdaysSvc.GetSettings(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapBirthdaysError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/birthday-settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in birthdays.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.BirthdaysSvc.UpdateSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapBirthdaysError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Staff digest routes =====
+		if d.DigestSvc != nil {
+			// Store and send last week's digest to each dojo's staff (admin
+			// only, called every Monday by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/digests/run", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.DigestSvc.Run(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapDigestError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// The digest of {week}: an ISO week (2026-W42) or any date in it
+			pr.With(perm(dojo.PermMembersView), slow).Get("/v1/dojos/{dojoId}/digests/{week}", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.DigestSvc.Get(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "week"), time.Now().UTC())
+				if err != nil {
+					status, msg := mapDigestError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Chat webhook (Slack/Discord) routes =====
+		if d.ChatOpsSvc != nil {
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/chat-webhook", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.ChatOpsSvc.GetSettings(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapChatOpsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/chat-webhook", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in chatops.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.ChatOpsSvc.UpdateSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapChatOpsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Post a test message to the configured webhook
+			pr.With(perm(dojo.PermSettings)).Post("/v1/dojos/{dojoId}/chat-webhook/test", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if err := d.ChatOpsSvc.TestSend(r.Context(), au.UID, chi.URLParam(r, "dojoId")); err != nil {
+					status, msg := mapChatOpsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+		}
+
+		// ===== Inbound email (announce by email) routes =====
+		if d.InboundSvc != nil {
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/inbound-email", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.InboundSvc.GetSettings(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapInboundError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/inbound-email", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in inbound.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.InboundSvc.UpdateSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapInboundError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Mail received at the dojo address, posted or rejected
+			pr.With(perm(dojo.PermNoticesWrite)).Get("/v1/dojos/{dojoId}/inbound-email/log", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.InboundSvc.ListEmails(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapInboundError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"emails": out})
+			})
+		}
+
+		// ===== Leads (contact form enquiries) routes =====
+		if d.LeadsSvc != nil {
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/contact-form", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.LeadsSvc.GetSettings(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapLeadsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/contact-form", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in leads.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.LeadsSvc.UpdateSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapLeadsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// ?status=new|contacted|converted|closed&limit=
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/leads", func(w http.ResponseWriter, r *http.Request) {
+				in := leads.ListInput{Status: r.URL.Query().Get("status")}
+				if v := r.URL.Query().Get("limit"); v != "" {
+					n, err := strconv.Atoi(v)
+					if err != nil {
+						Fail(w, 400, "limit must be a number")
+						return
+					}
+					in.Limit = n
+				}
+
+				out, err := d.LeadsSvc.List(r.Context(), chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapLeadsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"leads": out})
+			})
+
+			pr.With(perm(dojo.PermMembersWrite)).Put("/v1/dojos/{dojoId}/leads/{leadId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in leads.UpdateLeadInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.LeadsSvc.UpdateLead(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "leadId"), in)
+				if err != nil {
+					status, msg := mapLeadsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Google Sheets sync routes =====
+		if d.SheetsSvc != nil {
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/sheets", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.SheetsSvc.GetSettings(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapSheetsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/sheets", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in sheets.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.SheetsSvc.UpdateSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapSheetsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Push the roster and attendance to the linked sheet now
+			pr.With(perm(dojo.PermSettings), slow).Post("/v1/dojos/{dojoId}/sheets/sync", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.SheetsSvc.Sync(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapSheetsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Daily sync of every dojo that asked for it (admin only, called by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/sheets/sync", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+				out, err := d.SheetsSvc.RunScheduled(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapSheetsError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Members routes =====
+		if d.MembersSvc != nil {
+			// Copy user display fields onto member docs written before the sync
+			// (admin only; ?dojoId= for one dojo, otherwise all, resumable)
+			pr.With(slow).Post("/v1/admin/members/sync-user-fields", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.MembersSvc.BackfillUserFields(r.Context(), r.URL.Query().Get("dojoId"))
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Start due suspensions and end lapsed ones, notifying staff (admin only, called by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/suspensions/run", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.MembersSvc.RunSuspensions(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// List members
+			pr.Get("/v1/dojos/{dojoId}/members", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsStaff(au.Claims) {
+					Fail(w, 403, "staff permission required to list members")
+					return
+				}
+
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				input := members.ListMembersInput{
+					DojoID: dojoId,
+					Status: r.URL.Query().Get("status"),
+				}
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if l, err := strconv.Atoi(limitStr); err == nil {
+						input.Limit = l
+					}
+				}
+
+				out, err := d.MembersSvc.ListMembers(r.Context(), input)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				viewer := d.MembersSvc.ViewerFor(r.Context(), dojoId, au.UID)
+				WriteJSON(w, 200, map[string]any{"members": members.SerializeMembers(out, viewer)})
+			})
+
+			// Find an account by email for the add-member and rank flows (staff)
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/members/lookup", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				out, err := d.MembersSvc.LookupByEmail(r.Context(), dojoId, r.URL.Query().Get("email"))
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				if out.Member != nil {
+					viewer := d.MembersSvc.ViewerFor(r.Context(), dojoId, au.UID)
+					m := members.SerializeMember(*out.Member, viewer)
+					out.Member = &m
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Add member (staff only)
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/members", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsStaff(au.Claims) {
+					Fail(w, 403, "staff permission required to add members")
+					return
+				}
+
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				// ★ Check plan limit before adding member
+				if d.StripeSvc != nil {
+					if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "member"); err != nil {
+						if failPlanLimit(w, err) {
+							return
+						}
+					}
+				}
+
+				var in members.AddMemberInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+				in.Trim()
+
+				// ★ Check staff limit if adding staff role
+				if in.RoleInDojo == "staff" || in.RoleInDojo == "coach" || in.RoleInDojo == "owner" {
+					if d.StripeSvc != nil {
+						if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "staff"); err != nil {
+							if failPlanLimit(w, err) {
+								return
+							}
+						}
+					}
+				}
+
+				out, err := d.MembersSvc.AddMember(r.Context(), au.UID, in)
+				if err != nil {
+					if failPlanLimit(w, err) {
+						return
+					}
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Get member
+			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				out, err := d.MembersSvc.GetMember(r.Context(), dojoId, memberUid)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				viewer := d.MembersSvc.ViewerFor(r.Context(), dojoId, au.UID)
+				WriteJSON(w, 200, members.SerializeMember(*out, viewer))
+			})
+
+			// Update member
+			pr.With(perm(dojo.PermMembersWrite)).Put("/v1/dojos/{dojoId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				var in members.UpdateMemberInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				in.DojoID = dojoId
+				in.MemberUID = memberUid
+				in.Trim()
+
+				// ★ Check staff limit if promoting to staff role
+				if in.RoleInDojo != nil {
+					newRole := *in.RoleInDojo
+					if newRole == "staff" || newRole == "coach" || newRole == "owner" {
+						// Get current role to check if this is a promotion
+						currentMember, err := d.MembersSvc.GetMember(r.Context(), dojoId, memberUid)
+						if err == nil {
+							currentRole := currentMember.Member.RoleInDojo
+							isCurrentStaff := currentRole == "staff" || currentRole == "coach" || currentRole == "owner"
+							if !isCurrentStaff && d.StripeSvc != nil {
+								if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "staff"); err != nil {
+									if failPlanLimit(w, err) {
+										return
+									}
+								}
+							}
+						}
+					}
+				}
+
+				out, err := d.MembersSvc.UpdateMember(r.Context(), au.UID, in)
+				if err != nil {
+					if failPlanLimit(w, err) {
+						return
+					}
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Delete member
+			pr.With(perm(dojo.PermMembersDelete)).Delete("/v1/dojos/{dojoId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				err := d.MembersSvc.DeleteMember(r.Context(), au.UID, dojoId, memberUid)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"ok": true, "deleted": memberUid})
+			})
+
+			// Suspend a member (blocks check-in and booking; the reason is staff only)
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/members/{memberUid}/suspension", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				var in members.SuspendInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MembersSvc.Suspend(r.Context(), au.UID, dojoId, memberUid, in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Lift a member's suspension
+			pr.With(perm(dojo.PermMembersWrite)).Delete("/v1/dojos/{dojoId}/members/{memberUid}/suspension", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				out, err := d.MembersSvc.LiftSuspension(r.Context(), au.UID, dojoId, memberUid)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Progress timeline (staff or the member): ?type=promotion,competition&before=<cursor>&limit=
+			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/timeline", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				in := members.TimelineInput{}
+				if t := r.URL.Query().Get("type"); t != "" {
+					in.Types = strings.Split(t, ",")
+				}
+				if b := r.URL.Query().Get("before"); b != "" {
+					before, err := time.Parse(time.RFC3339Nano, b)
+					if err != nil {
+						Fail(w, 400, "before must be an RFC3339 timestamp")
+						return
+					}
+					in.Before = &before
+				}
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if l, err := strconv.Atoi(limitStr); err == nil {
+						in.Limit = l
+					}
+				}
+
+				out, err := d.MembersSvc.GetTimeline(r.Context(), au.UID, dojoId, memberUid, in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// ===== Private coach notes (staff only) =====
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/members/{memberUid}/notes", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				out, err := d.MembersSvc.ListNotes(r.Context(), au.UID, dojoId, memberUid)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"notes": out})
+			})
+
+			pr.With(perm(dojo.PermMembersView)).Post("/v1/dojos/{dojoId}/members/{memberUid}/notes", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				var in members.NoteInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MembersSvc.AddNote(r.Context(), au.UID, dojoId, memberUid, in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermMembersView)).Put("/v1/dojos/{dojoId}/members/{memberUid}/notes/{noteId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				noteId := chi.URLParam(r, "noteId")
+				if noteId == "" {
+					Fail(w, 400, "missing noteId")
+					return
+				}
+
+				var in members.NoteInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MembersSvc.UpdateNote(r.Context(), au.UID, dojoId, memberUid, noteId, in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermMembersView)).Delete("/v1/dojos/{dojoId}/members/{memberUid}/notes/{noteId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				noteId := chi.URLParam(r, "noteId")
+				if noteId == "" {
+					Fail(w, 400, "missing noteId")
+					return
+				}
+
+				if err := d.MembersSvc.DeleteNote(r.Context(), au.UID, dojoId, memberUid, noteId); err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"ok": true, "deleted": noteId})
+			})
+
+			// Competition results
+			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/competitions", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				if !d.MembersSvc.ViewerFor(r.Context(), dojoId, au.UID).CanSeePrivate(memberUid) {
+					Fail(w, 403, "only staff or the member can view competition results")
+					return
+				}
+				out, err := d.MembersSvc.ListCompetitionResults(r.Context(), dojoId, memberUid)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"competitions": out})
+			})
+
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/members/{memberUid}/competitions", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+				if dojoId == "" || memberUid == "" {
+					Fail(w, 400, "missing dojoId or memberUid")
+					return
+				}
+
+				var in members.AddCompetitionResultInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MembersSvc.AddCompetitionResult(r.Context(), au.UID, dojoId, memberUid, in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+		}
+
+		// ===== Member transfers between dojos (rank history moves with the member) =====
+		if d.TransfersSvc != nil {
+			// ?direction=incoming|outgoing&status=pending
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/transfers", func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				out, err := d.TransfersSvc.List(r.Context(), transfers.ListInput{
+					DojoID:    chi.URLParam(r, "dojoId"),
+					Direction: q.Get("direction"),
+					Status:    q.Get("status"),
+				})
+				if err != nil {
+					status, msg := mapTransfersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"transfers": out})
+			})
+
+			// Start a transfer of one of the dojo's members to another dojo
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/transfers", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in transfers.InitiateInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.TransfersSvc.Initiate(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapTransfersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermMembersView)).Get("/v1/dojos/{dojoId}/transfers/{transferId}", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.TransfersSvc.Get(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "transferId"))
+				if err != nil {
+					status, msg := mapTransfersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Accept an incoming transfer: the member joins with their belt and rank history
+			pr.With(perm(dojo.PermMembersWrite), slow).Post("/v1/dojos/{dojoId}/transfers/{transferId}/accept", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in transfers.ReviewInput
+				if r.ContentLength != 0 {
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+				}
+
+				meta := requestMeta(r)
+				out, err := d.TransfersSvc.Accept(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "transferId"), in, meta.IP, meta.UserAgent)
+				if err != nil {
+					status, msg := mapTransfersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/transfers/{transferId}/decline", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in transfers.ReviewInput
+				if r.ContentLength != 0 {
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+				}
+
+				out, err := d.TransfersSvc.Decline(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "transferId"), in)
+				if err != nil {
+					status, msg := mapTransfersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Withdraw an outgoing transfer before the destination answers
+			pr.With(perm(dojo.PermMembersWrite)).Post("/v1/dojos/{dojoId}/transfers/{transferId}/cancel", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in transfers.ReviewInput
+				if r.ContentLength != 0 {
+					if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+						Fail(w, 400, "invalid json")
+						return
+					}
+				}
+
+				out, err := d.TransfersSvc.Cancel(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "transferId"), in)
+				if err != nil {
+					status, msg := mapTransfersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Member goals (set by the member, reviewed by coaches) =====
+		if d.MembersSvc != nil {
+			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/goals", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				out, err := d.MembersSvc.ListGoals(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"))
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"goals": out})
+			})
+
+			pr.Post("/v1/dojos/{dojoId}/members/{memberUid}/goals", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var in members.GoalInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MembersSvc.CreateGoal(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"), in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.Put("/v1/dojos/{dojoId}/members/{memberUid}/goals/{goalId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var in members.UpdateGoalInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MembersSvc.UpdateGoal(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"), chi.URLParam(r, "goalId"), in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.Delete("/v1/dojos/{dojoId}/members/{memberUid}/goals/{goalId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				goalId := chi.URLParam(r, "goalId")
+
+				if err := d.MembersSvc.DeleteGoal(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"), goalId); err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"ok": true, "deleted": goalId})
+			})
+
+			// Coach comment, optionally with a progress update
+			pr.With(perm(dojo.PermMembersView)).Post("/v1/dojos/{dojoId}/members/{memberUid}/goals/{goalId}/comments", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var in members.GoalCommentInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.MembersSvc.CommentOnGoal(r.Context(), au.UID, chi.URLParam(r, "dojoId"), chi.URLParam(r, "memberUid"), chi.URLParam(r, "goalId"), in)
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Remind members of active goals (admin only, called daily by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/goals/remind", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.MembersSvc.SendGoalReminders(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapMembersError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Class packages (drop-ins / punch cards) =====
+		if d.PackagesSvc != nil {
+			// List packages (members see what is on sale, staff see all)
+			pr.Get("/v1/dojos/{dojoId}/packages", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				out, err := d.PackagesSvc.ListPackages(r.Context(), au.UID, dojoId)
+				if err != nil {
+					status, msg := mapPackagesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"packages": out})
+			})
+
+			// Create package
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/packages", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				var in packages.PackageInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.PackagesSvc.CreatePackage(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapPackagesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Update / archive package
+			pr.With(perm(dojo.PermBilling)).Put("/v1/dojos/{dojoId}/packages/{packageId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				packageId := chi.URLParam(r, "packageId")
+
+				var in packages.UpdatePackageInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.PackagesSvc.UpdatePackage(r.Context(), au.UID, dojoId, packageId, in)
+				if err != nil {
+					status, msg := mapPackagesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Buy a package (Stripe checkout)
+			pr.Post("/v1/dojos/{dojoId}/packages/{packageId}/checkout", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				packageId := chi.URLParam(r, "packageId")
+
+				var in packages.PurchaseInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				url, err := d.PackagesSvc.CreateCheckout(r.Context(), au.UID, dojoId, packageId, in)
+				if err != nil {
+					status, msg := mapPackagesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"url": url})
+			})
+
+			// Member credit balance + ledger (staff or self)
+			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}/credits", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				out, err := d.PackagesSvc.GetCredits(r.Context(), au.UID, dojoId, memberUid)
+				if err != nil {
+					status, msg := mapPackagesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Manual credit adjustment (cash sales, corrections)
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/members/{memberUid}/credits", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				var in packages.AdjustCreditsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.PackagesSvc.AdjustCredits(r.Context(), au.UID, dojoId, memberUid, in)
+				if err != nil {
+					status, msg := mapPackagesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Pro-shop orders (gis, belts, merch) =====
+		if d.ShopSvc != nil {
+			// List orders (?memberUid=&outstanding=true; members see their own)
+			pr.Get("/v1/dojos/{dojoId}/shop/orders", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				in := shop.ListOrdersInput{
+					MemberUID:   r.URL.Query().Get("memberUid"),
+					Outstanding: r.URL.Query().Get("outstanding") == "true",
+				}
+				if v := r.URL.Query().Get("limit"); v != "" {
+					in.Limit, _ = strconv.Atoi(v)
+				}
+
+				out, err := d.ShopSvc.ListOrders(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapShopError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"orders": out})
+			})
+
+			// Record an order
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/shop/orders", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				var in shop.CreateOrderInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.ShopSvc.CreateOrder(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapShopError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Edit an order / mark it paid or delivered
+			pr.With(perm(dojo.PermBilling)).Put("/v1/dojos/{dojoId}/shop/orders/{orderId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				orderId := chi.URLParam(r, "orderId")
+
+				var in shop.UpdateOrderInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.ShopSvc.UpdateOrder(r.Context(), au.UID, dojoId, orderId, in)
+				if err != nil {
+					status, msg := mapShopError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Delete an unpaid order
+			pr.With(perm(dojo.PermBilling)).Delete("/v1/dojos/{dojoId}/shop/orders/{orderId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				orderId := chi.URLParam(r, "orderId")
+
+				if err := d.ShopSvc.DeleteOrder(r.Context(), au.UID, dojoId, orderId); err != nil {
+					status, msg := mapShopError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"ok": true})
+			})
+
+			// Stripe payment link for an order
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/shop/orders/{orderId}/payment-link", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				orderId := chi.URLParam(r, "orderId")
+
+				var in shop.PaymentLinkInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.ShopSvc.CreatePaymentLink(r.Context(), au.UID, dojoId, orderId, in)
+				if err != nil {
+					status, msg := mapShopError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Member timetable and weekly publish =====
+		if d.TimetableSvc != nil {
+			// The week's classes with the caller's eligibility, bookings and attendance frequency
+			pr.Get("/v1/dojos/{dojoId}/timetable/me", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				out, err := d.TimetableSvc.ForMember(r.Context(), au.UID, dojoId, time.Now().UTC())
+				if err != nil {
+					status, msg := mapTimetableError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Weekly "this week's classes" push to members (opt-in)
+			pr.With(perm(dojo.PermSettings)).Get("/v1/dojos/{dojoId}/timetable/publish-settings", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.TimetableSvc.GetPublishSettings(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapTimetableError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/timetable/publish-settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				var in timetable.UpdatePublishSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.TimetableSvc.UpdatePublishSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
+				if err != nil {
+					status, msg := mapTimetableError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Send the week's timetable now instead of waiting for the schedule
+			pr.With(perm(dojo.PermNoticesWrite), slow).Post("/v1/dojos/{dojoId}/timetable/publishes", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				out, err := d.TimetableSvc.Publish(r.Context(), au.UID, chi.URLParam(r, "dojoId"), time.Now().UTC())
+				if err != nil {
+					status, msg := mapTimetableError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			pr.With(perm(dojo.PermNoticesWrite)).Get("/v1/dojos/{dojoId}/timetable/publishes", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.TimetableSvc.ListPublishes(r.Context(), chi.URLParam(r, "dojoId"))
+				if err != nil {
+					status, msg := mapTimetableError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"publishes": out})
+			})
+
+			// Open rate of one week's publish ({week} is its first day, YYYY-MM-DD)
+			pr.With(perm(dojo.PermNoticesWrite)).Get("/v1/dojos/{dojoId}/timetable/publishes/{week}", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.TimetableSvc.GetPublishStats(r.Context(), chi.URLParam(r, "dojoId"), chi.URLParam(r, "week"))
+				if err != nil {
+					status, msg := mapTimetableError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Send every opted-in dojo's timetable whose local publish time has
+			// come (admin only, called hourly by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/timetable/publish", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+				out, err := d.TimetableSvc.RunPublish(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapTimetableError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+		}
+
+		// ===== Recurring bookings (standing places in capacity-limited classes) =====
+		if d.RecurringSvc != nil {
+			// Generate reservations, promote waitlists and end pauses (admin only, called by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/recurring-bookings/run", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+				out, err := d.RecurringSvc.Run(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapRecurringError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// List recurring bookings (?sessionId= for staff; members see their own)
+			pr.Get("/v1/dojos/{dojoId}/recurring-bookings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				in := recurring.ListInput{SessionID: r.URL.Query().Get("sessionId")}
+				out, err := d.RecurringSvc.List(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapRecurringError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"bookings": out})
+			})
+
+			// Hold a class every week (members for themselves, staff for anyone)
+			pr.Post("/v1/dojos/{dojoId}/recurring-bookings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				var in recurring.CreateInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RecurringSvc.Create(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapRecurringError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Freeze a recurring booking until a date
+			pr.Post("/v1/dojos/{dojoId}/recurring-bookings/{bookingId}/pause", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				bookingId := chi.URLParam(r, "bookingId")
+
+				var in recurring.PauseInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.RecurringSvc.Pause(r.Context(), au.UID, dojoId, bookingId, in)
+				if err != nil {
+					status, msg := mapRecurringError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// End a freeze early
+			pr.Post("/v1/dojos/{dojoId}/recurring-bookings/{bookingId}/resume", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				bookingId := chi.URLParam(r, "bookingId")
+
+				out, err := d.RecurringSvc.Resume(r.Context(), au.UID, dojoId, bookingId)
+				if err != nil {
+					status, msg := mapRecurringError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Cancel a recurring booking, releasing its place
+			pr.Delete("/v1/dojos/{dojoId}/recurring-bookings/{bookingId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				bookingId := chi.URLParam(r, "bookingId")
+
+				if err := d.RecurringSvc.Cancel(r.Context(), au.UID, dojoId, bookingId); err != nil {
+					status, msg := mapRecurringError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+		}
+
+		// ===== Family memberships =====
+		if d.FamiliesSvc != nil {
+			// List families (staff: all, others: families they pay for)
+			pr.Get("/v1/dojos/{dojoId}/families", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				out, err := d.FamiliesSvc.ListFamilies(r.Context(), au.UID, dojoId)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"families": out})
+			})
+
+			// Create family
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/families", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				var in families.CreateFamilyInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.FamiliesSvc.CreateFamily(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 201, out)
+			})
+
+			// Family billing settings (per-member price)
+			pr.With(perm(dojo.PermBilling)).Get("/v1/dojos/{dojoId}/families/billing", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+
+				out, err := d.FamiliesSvc.GetBillingSettings(r.Context(), dojoId)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"billing": out})
+			})
+
+			pr.With(perm(dojo.PermBilling)).Put("/v1/dojos/{dojoId}/families/billing", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+
+				var in families.BillingSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.FamiliesSvc.UpdateBillingSettings(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"billing": out})
+			})
+
+			// Get family (staff or payer)
+			pr.Get("/v1/dojos/{dojoId}/families/{familyId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				familyId := chi.URLParam(r, "familyId")
+
+				out, err := d.FamiliesSvc.GetFamily(r.Context(), au.UID, dojoId, familyId)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Family view: everyone's attendance and ranks (staff or payer)
+			pr.Get("/v1/dojos/{dojoId}/families/{familyId}/view", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				familyId := chi.URLParam(r, "familyId")
+
+				out, err := d.FamiliesSvc.GetView(r.Context(), au.UID, dojoId, familyId)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Update family (name / payer)
+			pr.With(perm(dojo.PermBilling)).Put("/v1/dojos/{dojoId}/families/{familyId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				familyId := chi.URLParam(r, "familyId")
+
+				var in families.UpdateFamilyInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.FamiliesSvc.UpdateFamily(r.Context(), au.UID, dojoId, familyId, in)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Delete family (cancels its subscription)
+			pr.With(perm(dojo.PermBilling)).Delete("/v1/dojos/{dojoId}/families/{familyId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				familyId := chi.URLParam(r, "familyId")
+
+				if err := d.FamiliesSvc.DeleteFamily(r.Context(), au.UID, dojoId, familyId); err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			// Link / unlink a member
+			pr.With(perm(dojo.PermBilling)).Put("/v1/dojos/{dojoId}/families/{familyId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				familyId := chi.URLParam(r, "familyId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				out, err := d.FamiliesSvc.AddMember(r.Context(), au.UID, dojoId, familyId, memberUid)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(perm(dojo.PermBilling)).Delete("/v1/dojos/{dojoId}/families/{familyId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				familyId := chi.URLParam(r, "familyId")
+				memberUid := chi.URLParam(r, "memberUid")
+
+				out, err := d.FamiliesSvc.RemoveMember(r.Context(), au.UID, dojoId, familyId, memberUid)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Start the shared subscription (payer only)
+			pr.Post("/v1/dojos/{dojoId}/families/{familyId}/checkout", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				familyId := chi.URLParam(r, "familyId")
+
+				var in families.CheckoutInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				url, err := d.FamiliesSvc.CreateCheckout(r.Context(), au.UID, dojoId, familyId, in)
+				if err != nil {
+					status, msg := mapFamiliesError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"url": url})
+			})
+		}
+
+		// ===== Retention Alerts routes =====
+		if d.RetentionSvc != nil {
+			// Get retention alerts (staff only)
+			pr.With(slow).Get("/v1/dojos/{dojoId}/retention/alerts", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				out, err := d.RetentionSvc.GetAlerts(r.Context(), au.UID, dojoId)
+				if err != nil {
+					status, msg := mapRetentionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				// ?sort=churn orders outreach by predicted churn instead of risk level / days
+				if r.URL.Query().Get("sort") == "churn" {
+					retention.SortByChurn(out.Alerts)
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Post members newly past the critical threshold to chat webhooks
+			// (admin only; triggered daily by Cloud Scheduler)
+			pr.With(slow).Post("/v1/admin/retention/announce-critical", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.RetentionSvc.AnnounceCritical(r.Context(), time.Now().UTC())
+				if err != nil {
+					status, msg := mapRetentionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			// Get retention settings
+			pr.Get("/v1/dojos/{dojoId}/retention/settings", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				settings, err := d.RetentionSvc.GetSettings(r.Context(), dojoId)
+				if err != nil {
+					status, msg := mapRetentionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, settings)
+			})
+
+			// Update retention settings (staff only)
+			pr.With(perm(dojo.PermSettings)).Put("/v1/dojos/{dojoId}/retention/settings", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
+					return
+				}
+
+				var in retention.UpdateSettingsInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				settings, err := d.RetentionSvc.UpdateSettings(r.Context(), au.UID, dojoId, in)
+				if err != nil {
+					status, msg := mapRetentionError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, settings)
+			})
+		}
+
+		// ===== Profile routes =====
+		if d.ProfileSvc != nil {
+			// Get profile
+			pr.Get("/v1/profile", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				targetUid := r.URL.Query().Get("uid")
+				if targetUid == "" {
+					targetUid = au.UID
+				}
+
+				// Check permission for other users
+				if targetUid != au.UID && !middleware.IsStaff(au.Claims) {
+					Fail(w, 403, "permission denied")
+					return
+				}
+
+				out, err := d.ProfileSvc.GetProfile(r.Context(), targetUid)
+				if err != nil {
+					status, msg := mapProfileError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"uid": targetUid, "user": out})
+			})
+
+			// Update profile
+			pr.Put("/v1/profile", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var body struct {
+					Updates profile.UpdateProfileInput `json:"updates"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+				body.Updates.Trim()
+
+				err := d.ProfileSvc.UpdateProfile(r.Context(), au.UID, body.Updates)
+				if err != nil {
+					status, msg := mapProfileError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			// Profile photo: get an upload URL, upload the image to it, then
+			// process it, which checks the file and makes the thumbnails
+			pr.Post("/v1/profile/photo/upload", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var in profile.ProfilePhotoUploadInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				out, err := d.ProfileSvc.CreatePhotoUpload(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapProfileError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, out)
+			})
+
+			pr.With(slow).Post("/v1/profile/photo/{photoId}/process", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				out, err := d.ProfileSvc.ProcessPhoto(r.Context(), au.UID, chi.URLParam(r, "photoId"))
+				if err != nil {
+					status, msg := mapProfileError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"photo": out})
+			})
+
+			pr.Delete("/v1/profile/photo", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				if err := d.ProfileSvc.DeletePhoto(r.Context(), au.UID); err != nil {
+					status, msg := mapProfileError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			// Deactivate user (admin only)
+			pr.Post("/v1/admin/deactivateUser", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				var body struct {
+					UserID string `json:"userId"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				err := d.ProfileSvc.DeactivateUser(r.Context(), au.UID, body.UserID)
+				if err != nil {
+					status, msg := mapProfileError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, map[string]any{"success": true})
+			})
+
+			// Reactivate user (admin only)
+			pr.Post("/v1/admin/reactivateUser", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				var body struct {
+					UserID string `json:"userId"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					Fail(w, 400, "invalid json")
+					return
+				}
+
+				err := d.ProfileSvc.ReactivateUser(r.Context(), body.UserID)
+				if err != nil {
+					status, msg := mapProfileError(err)
 					Fail(w, status, msg)
 					return
 				}
@@ -702,185 +4896,198 @@ func NewRouter(d RouterDeps) http.Handler {
 			})
 		}
 
-		// ===== Members routes =====
-		if d.MembersSvc != nil {
-			// List members
-			pr.Get("/v1/dojos/{dojoId}/members", func(w http.ResponseWriter, r *http.Request) {
+		// ===== Stripe routes (protected) =====
+		if d.StripeSvc != nil {
+			// Create checkout session
+			pr.Post("/v1/stripe/create-checkout", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				if !middleware.IsStaff(au.Claims) {
-					Fail(w, 403, "staff permission required to list members")
+
+				var in stripedom.CreateCheckoutInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
 					return
 				}
+				in.Trim()
 
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+				url, err := d.StripeSvc.CreateCheckoutSession(r.Context(), au.UID, in)
+				if err != nil {
+					status, msg := mapStripeError(err)
+					Fail(w, status, msg)
 					return
 				}
+				WriteJSON(w, 200, map[string]any{"url": url})
+			})
 
-				input := members.ListMembersInput{
-					DojoID: dojoId,
-					Status: r.URL.Query().Get("status"),
-				}
-				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-					if l, err := strconv.Atoi(limitStr); err == nil {
-						input.Limit = l
-					}
+			// Create portal session
+			pr.Post("/v1/stripe/create-portal", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+
+				var in stripedom.CreatePortalInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+					Fail(w, 400, "invalid json")
+					return
 				}
+				in.Trim()
 
-				out, err := d.MembersSvc.ListMembers(r.Context(), input)
+				url, err := d.StripeSvc.CreatePortalSession(r.Context(), au.UID, in)
 				if err != nil {
-					status, msg := mapMembersError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"members": out})
+				WriteJSON(w, 200, map[string]any{"url": url})
 			})
 
-			// Add member (staff only)
-			pr.Post("/v1/dojos/{dojoId}/members", func(w http.ResponseWriter, r *http.Request) {
-				au, _ := middleware.GetAuthUser(r.Context())
-				if !middleware.IsStaff(au.Claims) {
-					Fail(w, 403, "staff permission required to add members")
+			// Get subscription info
+			pr.Get("/v1/dojos/{dojoId}/subscription", func(w http.ResponseWriter, r *http.Request) {
+				dojoId := chi.URLParam(r, "dojoId")
+				if dojoId == "" {
+					Fail(w, 400, "missing dojoId")
 					return
 				}
 
+				info, err := d.StripeSvc.GetSubscriptionInfo(r.Context(), dojoId)
+				if err != nil {
+					status, msg := mapStripeError(err)
+					Fail(w, status, msg)
+					return
+				}
+				WriteJSON(w, 200, info)
+			})
+
+			// Billing history (owner, or an admin for support): ?type=subscription_updated,subscription_deleted&before=<cursor>&limit=
+			pr.Get("/v1/dojos/{dojoId}/subscription/events", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
 				dojoId := chi.URLParam(r, "dojoId")
 				if dojoId == "" {
 					Fail(w, 400, "missing dojoId")
 					return
 				}
-
-				// ★ Check plan limit before adding member
-				if d.StripeSvc != nil {
-					if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "member"); err != nil {
-						if stripedom.IsErrLimitReached(err) {
-							Fail(w, 402, err.Error())
-							return
-						}
+				if !middleware.IsAdmin(au.Claims) {
+					dj, err := d.DojoRepo.GetDojo(r.Context(), dojoId)
+					if err != nil {
+						Fail(w, 404, "dojo not found")
+						return
+					}
+					if !dj.IsOwner(au.UID) {
+						Fail(w, 403, "only the dojo owner can view billing history")
+						return
 					}
 				}
 
-				var in members.AddMemberInput
-				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-					Fail(w, 400, "invalid json")
-					return
+				in := stripedom.ListSubscriptionEventsInput{}
+				if t := r.URL.Query().Get("type"); t != "" {
+					in.Types = strings.Split(t, ",")
 				}
-				in.DojoID = dojoId
-				in.Trim()
-
-				// ★ Check staff limit if adding staff role
-				if in.RoleInDojo == "staff" || in.RoleInDojo == "coach" || in.RoleInDojo == "owner" {
-					if d.StripeSvc != nil {
-						if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "staff"); err != nil {
-							if stripedom.IsErrLimitReached(err) {
-								Fail(w, 402, err.Error())
-								return
-							}
-						}
+				if b := r.URL.Query().Get("before"); b != "" {
+					before, err := time.Parse(time.RFC3339Nano, b)
+					if err != nil {
+						Fail(w, 400, "before must be an RFC3339 timestamp")
+						return
+					}
+					in.Before = &before
+				}
+				if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+					if l, err := strconv.Atoi(limitStr); err == nil {
+						in.Limit = l
 					}
 				}
 
-				out, err := d.MembersSvc.AddMember(r.Context(), au.UID, in)
+				out, err := d.StripeSvc.ListSubscriptionEvents(r.Context(), dojoId, in)
 				if err != nil {
-					status, msg := mapMembersError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 201, out)
+				WriteJSON(w, 200, out)
 			})
 
-			// Get member
-			pr.Get("/v1/dojos/{dojoId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				memberUid := chi.URLParam(r, "memberUid")
-				if dojoId == "" || memberUid == "" {
-					Fail(w, 400, "missing dojoId or memberUid")
-					return
-				}
-
-				out, err := d.MembersSvc.GetMember(r.Context(), dojoId, memberUid)
+			// Currency and tax of member billing
+			pr.With(perm(dojo.PermBilling)).Get("/v1/dojos/{dojoId}/billing-settings", func(w http.ResponseWriter, r *http.Request) {
+				out, err := d.StripeSvc.GetBillingSettings(r.Context(), chi.URLParam(r, "dojoId"))
 				if err != nil {
-					status, msg := mapMembersError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
 
-			// Update member
-			pr.Put("/v1/dojos/{dojoId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+			pr.With(perm(dojo.PermBilling)).Put("/v1/dojos/{dojoId}/billing-settings", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				memberUid := chi.URLParam(r, "memberUid")
-				if dojoId == "" || memberUid == "" {
-					Fail(w, 400, "missing dojoId or memberUid")
-					return
-				}
-
-				var in members.UpdateMemberInput
+				var in stripedom.UpdateBillingSettingsInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-				in.DojoID = dojoId
-				in.MemberUID = memberUid
-				in.Trim()
-
-				// ★ Check staff limit if promoting to staff role
-				if in.RoleInDojo != nil {
-					newRole := *in.RoleInDojo
-					if newRole == "staff" || newRole == "coach" || newRole == "owner" {
-						// Get current role to check if this is a promotion
-						currentMember, err := d.MembersSvc.GetMember(r.Context(), dojoId, memberUid)
-						if err == nil {
-							currentRole := currentMember.Member.RoleInDojo
-							isCurrentStaff := currentRole == "staff" || currentRole == "coach" || currentRole == "owner"
-							if !isCurrentStaff && d.StripeSvc != nil {
-								if err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, "staff"); err != nil {
-									if stripedom.IsErrLimitReached(err) {
-										Fail(w, 402, err.Error())
-										return
-									}
-								}
-							}
-						}
-					}
-				}
 
-				out, err := d.MembersSvc.UpdateMember(r.Context(), au.UID, in)
+				out, err := d.StripeSvc.UpdateBillingSettings(r.Context(), au.UID, chi.URLParam(r, "dojoId"), in)
 				if err != nil {
-					status, msg := mapMembersError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
 				WriteJSON(w, 200, out)
 			})
 
-			// Delete member
-			pr.Delete("/v1/dojos/{dojoId}/members/{memberUid}", func(w http.ResponseWriter, r *http.Request) {
+			// Accounting journal of paid invoices (owner, or an admin for support):
+			// ?from=YYYY-MM&to=YYYY-MM&format=csv|json, the previous month by default
+			pr.With(slow).Get("/v1/dojos/{dojoId}/payments/export", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
 				dojoId := chi.URLParam(r, "dojoId")
-				memberUid := chi.URLParam(r, "memberUid")
-				if dojoId == "" || memberUid == "" {
-					Fail(w, 400, "missing dojoId or memberUid")
-					return
+				if !middleware.IsAdmin(au.Claims) {
+					dj, err := d.DojoRepo.GetDojo(r.Context(), dojoId)
+					if err != nil {
+						Fail(w, 404, "dojo not found")
+						return
+					}
+					if !dj.IsOwner(au.UID) {
+						Fail(w, 403, "only the dojo owner can export payments")
+						return
+					}
 				}
 
-				err := d.MembersSvc.DeleteMember(r.Context(), au.UID, dojoId, memberUid)
+				q := r.URL.Query()
+				now := time.Now().UTC()
+				from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+				if v := q.Get("from"); v != "" {
+					t, err := time.Parse("2006-01", v)
+					if err != nil {
+						Fail(w, 400, "from must be YYYY-MM")
+						return
+					}
+					from = t
+				}
+				to := from
+				if v := q.Get("to"); v != "" {
+					t, err := time.Parse("2006-01", v)
+					if err != nil {
+						Fail(w, 400, "to must be YYYY-MM")
+						return
+					}
+					to = t
+				}
+
+				rows, months, err := d.StripeSvc.PaymentJournal(r.Context(), dojoId, from, to)
 				if err != nil {
-					status, msg := mapMembersError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"ok": true, "deleted": memberUid})
+				if q.Get("format") == "json" {
+					WriteJSON(w, 200, map[string]any{"payments": rows, "months": months})
+					return
+				}
+
+				filename := "payments-" + from.Format("200601") + "-" + to.Format("200601") + ".csv"
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+				w.WriteHeader(200)
+				_ = stripedom.WriteJournalCSV(w, rows) // headers are sent; a failed write only truncates the file
 			})
-		}
 
-		// ===== Retention Alerts routes =====
-		if d.RetentionSvc != nil {
-			// Get retention alerts (staff only)
-			pr.Get("/v1/dojos/{dojoId}/retention/alerts", func(w http.ResponseWriter, r *http.Request) {
+			// Cancel subscription
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/subscription/cancel", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
 				dojoId := chi.URLParam(r, "dojoId")
 				if dojoId == "" {
@@ -888,248 +5095,234 @@ func NewRouter(d RouterDeps) http.Handler {
 					return
 				}
 
-				out, err := d.RetentionSvc.GetAlerts(r.Context(), au.UID, dojoId)
+				err := d.StripeSvc.CancelSubscription(r.Context(), au.UID, dojoId)
 				if err != nil {
-					status, msg := mapRetentionError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, out)
+				WriteJSON(w, 200, map[string]any{"success": true})
 			})
 
-			// Get retention settings
-			pr.Get("/v1/dojos/{dojoId}/retention/settings", func(w http.ResponseWriter, r *http.Request) {
+			// Resume subscription
+			pr.With(perm(dojo.PermBilling)).Post("/v1/dojos/{dojoId}/subscription/resume", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
 				dojoId := chi.URLParam(r, "dojoId")
 				if dojoId == "" {
 					Fail(w, 400, "missing dojoId")
 					return
 				}
 
-				settings, err := d.RetentionSvc.GetSettings(r.Context(), dojoId)
+				err := d.StripeSvc.ResumeSubscription(r.Context(), au.UID, dojoId)
 				if err != nil {
-					status, msg := mapRetentionError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, settings)
+				WriteJSON(w, 200, map[string]any{"success": true})
 			})
 
-			// Update retention settings (staff only)
-			pr.Put("/v1/dojos/{dojoId}/retention/settings", func(w http.ResponseWriter, r *http.Request) {
+			// Webhook event queue (admin only): inspect, retry, drain
+			pr.Get("/v1/admin/stripe/events", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 
-				var in retention.UpdateSettingsInput
-				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-					Fail(w, 400, "invalid json")
+				out, err := d.StripeSvc.ListEvents(r.Context(), r.URL.Query().Get("status"), limit)
+				if err != nil {
+					status, msg := mapStripeError(err)
+					Fail(w, status, msg)
 					return
 				}
+				WriteJSON(w, 200, map[string]any{"events": out})
+			})
 
-				settings, err := d.RetentionSvc.UpdateSettings(r.Context(), au.UID, dojoId, in)
+			pr.Post("/v1/admin/stripe/events/{eventId}/retry", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
+
+				out, err := d.StripeSvc.RetryEvent(r.Context(), chi.URLParam(r, "eventId"))
 				if err != nil {
-					status, msg := mapRetentionError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, settings)
+				WriteJSON(w, 200, out)
 			})
-		}
 
-		// ===== Profile routes =====
-		if d.ProfileSvc != nil {
-			// Get profile
-			pr.Get("/v1/profile", func(w http.ResponseWriter, r *http.Request) {
+			// Compare plan subscriptions with Stripe and fix drift (admin only,
+			// called nightly by Cloud Scheduler; ?dryRun=true only reports)
+			pr.With(slow).Post("/v1/admin/stripe/reconcile", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				targetUid := r.URL.Query().Get("uid")
-				if targetUid == "" {
-					targetUid = au.UID
-				}
-
-				// Check permission for other users
-				if targetUid != au.UID && !middleware.IsStaff(au.Claims) {
-					Fail(w, 403, "permission denied")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
+				dryRun := r.URL.Query().Get("dryRun") == "true"
 
-				out, err := d.ProfileSvc.GetProfile(r.Context(), targetUid)
+				out, err := d.StripeSvc.ReconcileSubscriptions(r.Context(), dryRun)
 				if err != nil {
-					status, msg := mapProfileError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"uid": targetUid, "user": out})
+				WriteJSON(w, 200, out)
 			})
 
-			// Update profile
-			pr.Put("/v1/profile", func(w http.ResponseWriter, r *http.Request) {
+			// Warn owners whose plan card expires within 30 days (admin only,
+			// called daily by Cloud Scheduler; ?dryRun=true only reports)
+			pr.With(slow).Post("/v1/admin/stripe/card-expiry", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-
-				var body struct {
-					Updates profile.UpdateProfileInput `json:"updates"`
-				}
-				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-					Fail(w, 400, "invalid json")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
-				body.Updates.Trim()
+				dryRun := r.URL.Query().Get("dryRun") == "true"
 
-				err := d.ProfileSvc.UpdateProfile(r.Context(), au.UID, body.Updates)
+				out, err := d.StripeSvc.CheckCardExpiry(r.Context(), time.Now().UTC(), dryRun)
 				if err != nil {
-					status, msg := mapProfileError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true})
+				WriteJSON(w, 200, out)
 			})
 
-			// Deactivate user (admin only)
-			pr.Post("/v1/admin/deactivateUser", func(w http.ResponseWriter, r *http.Request) {
+			// Test clocks for lifecycle testing in staging (admin only, test key only)
+			pr.Post("/v1/admin/stripe/test-clocks", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
 				if !middleware.IsAdmin(au.Claims) {
 					Fail(w, 403, "admin privileges required")
 					return
 				}
 
-				var body struct {
-					UserID string `json:"userId"`
-				}
-				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				var in stripedom.CreateTestClockInput
+				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
 
-				err := d.ProfileSvc.DeactivateUser(r.Context(), au.UID, body.UserID)
+				out, err := d.StripeSvc.CreateTestClock(r.Context(), in)
 				if err != nil {
-					status, msg := mapProfileError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true})
+				WriteJSON(w, 201, out)
 			})
 
-			// Reactivate user (admin only)
-			pr.Post("/v1/admin/reactivateUser", func(w http.ResponseWriter, r *http.Request) {
+			pr.Get("/v1/admin/stripe/test-clocks/{clockId}", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
 				if !middleware.IsAdmin(au.Claims) {
 					Fail(w, 403, "admin privileges required")
 					return
 				}
 
-				var body struct {
-					UserID string `json:"userId"`
-				}
-				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-					Fail(w, 400, "invalid json")
-					return
-				}
-
-				err := d.ProfileSvc.ReactivateUser(r.Context(), body.UserID)
+				out, err := d.StripeSvc.GetTestClock(r.Context(), chi.URLParam(r, "clockId"))
 				if err != nil {
-					status, msg := mapProfileError(err)
+					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true})
+				WriteJSON(w, 200, out)
 			})
-		}
 
-		// ===== Stripe routes (protected) =====
-		if d.StripeSvc != nil {
-			// Create checkout session
-			pr.Post("/v1/stripe/create-checkout", func(w http.ResponseWriter, r *http.Request) {
+			pr.Post("/v1/admin/stripe/test-clocks/{clockId}/attach", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
 
-				var in stripedom.CreateCheckoutInput
+				var in stripedom.AttachTestClockInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-				in.Trim()
 
-				url, err := d.StripeSvc.CreateCheckoutSession(r.Context(), au.UID, in)
+				out, err := d.StripeSvc.AttachTestClock(r.Context(), chi.URLParam(r, "clockId"), in)
 				if err != nil {
 					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"url": url})
+				WriteJSON(w, 200, out)
 			})
 
-			// Create portal session
-			pr.Post("/v1/stripe/create-portal", func(w http.ResponseWriter, r *http.Request) {
+			pr.Post("/v1/admin/stripe/test-clocks/{clockId}/advance", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
+					return
+				}
 
-				var in stripedom.CreatePortalInput
+				var in stripedom.AdvanceTestClockInput
 				if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 					Fail(w, 400, "invalid json")
 					return
 				}
-				in.Trim()
 
-				url, err := d.StripeSvc.CreatePortalSession(r.Context(), au.UID, in)
+				out, err := d.StripeSvc.AdvanceTestClock(r.Context(), chi.URLParam(r, "clockId"), in)
 				if err != nil {
 					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"url": url})
+				WriteJSON(w, 200, out)
 			})
 
-			// Get subscription info
-			pr.Get("/v1/dojos/{dojoId}/subscription", func(w http.ResponseWriter, r *http.Request) {
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+			pr.Delete("/v1/admin/stripe/test-clocks/{clockId}", func(w http.ResponseWriter, r *http.Request) {
+				au, _ := middleware.GetAuthUser(r.Context())
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
 
-				info, err := d.StripeSvc.GetSubscriptionInfo(r.Context(), dojoId)
-				if err != nil {
+				if err := d.StripeSvc.DeleteTestClock(r.Context(), chi.URLParam(r, "clockId")); err != nil {
 					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, info)
+				WriteJSON(w, 200, map[string]any{"deleted": true})
 			})
 
-			// Cancel subscription
-			pr.Post("/v1/dojos/{dojoId}/subscription/cancel", func(w http.ResponseWriter, r *http.Request) {
+			pr.With(slow).Post("/v1/admin/stripe/events/process", func(w http.ResponseWriter, r *http.Request) {
 				au, _ := middleware.GetAuthUser(r.Context())
-				dojoId := chi.URLParam(r, "dojoId")
-				if dojoId == "" {
-					Fail(w, 400, "missing dojoId")
+				if !middleware.IsAdmin(au.Claims) {
+					Fail(w, 403, "admin privileges required")
 					return
 				}
 
-				err := d.StripeSvc.CancelSubscription(r.Context(), au.UID, dojoId)
+				out, err := d.StripeSvc.ProcessPendingEvents(r.Context())
 				if err != nil {
 					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true})
+				WriteJSON(w, 200, out)
 			})
 
-			// Resume subscription
-			pr.Post("/v1/dojos/{dojoId}/subscription/resume", func(w http.ResponseWriter, r *http.Request) {
-				au, _ := middleware.GetAuthUser(r.Context())
+			// Preview what a plan change would restrict (?plan=free)
+			pr.With(perm(dojo.PermBilling)).Get("/v1/dojos/{dojoId}/plan-preview", func(w http.ResponseWriter, r *http.Request) {
 				dojoId := chi.URLParam(r, "dojoId")
 				if dojoId == "" {
 					Fail(w, 400, "missing dojoId")
 					return
 				}
 
-				err := d.StripeSvc.ResumeSubscription(r.Context(), au.UID, dojoId)
+				out, err := d.StripeSvc.PreviewPlan(r.Context(), dojoId, r.URL.Query().Get("plan"))
 				if err != nil {
 					status, msg := mapStripeError(err)
 					Fail(w, status, msg)
 					return
 				}
-				WriteJSON(w, 200, map[string]any{"success": true})
+				WriteJSON(w, 200, out)
 			})
 
 			// Check plan limit
@@ -1143,8 +5336,12 @@ func NewRouter(d RouterDeps) http.Handler {
 
 				err := d.StripeSvc.CheckPlanLimit(r.Context(), dojoId, resource)
 				if err != nil {
-					if stripedom.IsErrLimitReached(err) {
-						WriteJSON(w, 200, map[string]any{"allowed": false, "error": err.Error()})
+					if le, ok := stripedom.AsLimitError(err); ok {
+						WriteJSON(w, 200, struct {
+							Allowed bool   `json:"allowed"`
+							Error   string `json:"error"`
+							*stripedom.LimitError
+						}{false, err.Error(), le})
 						return
 					}
 					status, msg := mapStripeError(err)
@@ -1156,171 +5353,684 @@ func NewRouter(d RouterDeps) http.Handler {
 		}
 	})
 
-	return r
+	return r
+}
+
+func mapDojoError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case dojo.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case dojo.IsErrNotFound(err):
+		return 404, err.Error()
+	case dojo.IsErrBadRequest(err):
+		return 400, err.Error()
+	case dojo.IsErrPendingDelete(err):
+		return 409, err.Error()
+	case dojo.IsErrMaintenance(err):
+		return 503, err.Error()
+	case dojo.IsErrEmailNotVerified(err):
+		return 403, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapSessionError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case session.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case session.IsErrNotFound(err):
+		return 404, err.Error()
+	case session.IsErrBadRequest(err):
+		return 400, err.Error()
+	case session.IsErrIneligible(err), session.IsErrRestricted(err):
+		return 403, err.Error()
+	case session.IsErrBookingClosed(err), session.IsErrClassFull(err):
+		return 409, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapAttendanceError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case attendance.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case attendance.IsErrNotFound(err):
+		return 404, err.Error()
+	case attendance.IsErrBadRequest(err):
+		return 400, err.Error()
+	case attendance.IsErrTooLarge(err):
+		return 413, err.Error()
+	case attendance.IsErrConflict(err):
+		return 409, err.Error()
+	case attendance.IsErrSuspended(err):
+		return 403, err.Error()
+	case packages.IsErrNoCredits(err):
+		return 402, err.Error()
+	case session.IsErrIneligible(err):
+		return 403, err.Error()
+	case session.IsErrNotFound(err):
+		return 404, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapRanksError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case ranks.IsErrUnauthorized(err), ranks.IsErrApprovalRequired(err):
+		return 403, err.Error()
+	case ranks.IsErrConflict(err):
+		return 409, err.Error()
+	case ranks.IsErrNotFound(err):
+		return 404, err.Error()
+	case ranks.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapStatsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case stats.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case stats.IsErrNotFound(err):
+		return 404, err.Error()
+	case stats.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapNotificationsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case notifications.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case notifications.IsErrNotFound(err):
+		return 404, err.Error()
+	case notifications.IsErrBadRequest(err):
+		return 400, err.Error()
+	case notifications.IsErrTooLarge(err):
+		return 413, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapMembersError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case members.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case members.IsErrNotFound(err):
+		return 404, err.Error()
+	case members.IsErrBadRequest(err):
+		return 400, err.Error()
+	case members.IsErrForbidden(err):
+		return 403, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapProfileError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case profile.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case profile.IsErrNotFound(err):
+		return 404, err.Error()
+	case profile.IsErrBadRequest(err):
+		return 400, err.Error()
+	case profile.IsErrTooManyUpdates(err):
+		return 429, err.Error()
+	case profile.IsErrInvalidPhoto(err):
+		return 422, err.Error()
+	case profile.IsErrUnavailable(err):
+		return 503, "profile photos are not configured"
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapStripeError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case stripedom.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case stripedom.IsErrNotFound(err):
+		return 404, err.Error()
+	case stripedom.IsErrBadRequest(err):
+		return 400, err.Error()
+	case stripedom.IsErrLimitReached(err):
+		return 402, err.Error()
+	case stripedom.IsErrTestModeOnly(err):
+		return 403, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapDashboardError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case dashboard.IsErrUnauthorized(err), retention.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case dashboard.IsErrBadRequest(err), session.IsErrBadRequest(err), attendance.IsErrBadRequest(err):
+		return 400, err.Error()
+	case stripedom.IsErrNotFound(err):
+		return 404, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapActivityError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case activity.IsErrBadRequest(err):
+		return 400, err.Error()
+	case activity.IsErrRateLimited(err):
+		return 429, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapClaimsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case claims.IsErrBadRequest(err):
+		return 400, err.Error()
+	case claims.IsErrNotFound(err):
+		return 404, err.Error()
+	default:
+		return 500, err.Error()
+	}
 }
 
-func mapDojoError(err error) (int, string) {
+func mapRemindersError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case dojo.IsErrUnauthorized(err):
+	case reminders.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapPackagesError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case packages.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case dojo.IsErrNotFound(err):
+	case packages.IsErrNotFound(err):
 		return 404, err.Error()
-	case dojo.IsErrBadRequest(err):
+	case packages.IsErrBadRequest(err), stripedom.IsErrBadRequest(err):
 		return 400, err.Error()
+	case packages.IsErrNoCredits(err):
+		return 402, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapSessionError(err error) (int, string) {
+func mapShopError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case session.IsErrUnauthorized(err):
+	case shop.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case session.IsErrNotFound(err):
+	case shop.IsErrNotFound(err):
 		return 404, err.Error()
-	case session.IsErrBadRequest(err):
+	case shop.IsErrBadRequest(err), stripedom.IsErrBadRequest(err):
 		return 400, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapAttendanceError(err error) (int, string) {
+func mapTimetableError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case attendance.IsErrUnauthorized(err):
+	case timetable.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case attendance.IsErrNotFound(err):
-		return 404, err.Error()
-	case attendance.IsErrBadRequest(err):
+	case timetable.IsErrBadRequest(err), attendance.IsErrBadRequest(err):
 		return 400, err.Error()
+	case timetable.IsErrNotFound(err), session.IsErrNotFound(err):
+		return 404, err.Error()
+	case timetable.IsErrConflict(err):
+		return 409, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapRanksError(err error) (int, string) {
+func mapRecurringError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case ranks.IsErrUnauthorized(err):
+	case recurring.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case ranks.IsErrNotFound(err):
+	case recurring.IsErrNotFound(err):
 		return 404, err.Error()
-	case ranks.IsErrBadRequest(err):
+	case recurring.IsErrBadRequest(err):
 		return 400, err.Error()
+	case recurring.IsErrConflict(err):
+		return 409, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapStatsError(err error) (int, string) {
+func mapFamiliesError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case stats.IsErrUnauthorized(err):
+	case families.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case stats.IsErrNotFound(err):
+	case families.IsErrNotFound(err):
 		return 404, err.Error()
-	case stats.IsErrBadRequest(err):
+	case families.IsErrConflict(err):
+		return 409, err.Error()
+	case families.IsErrBadRequest(err), stripedom.IsErrBadRequest(err):
 		return 400, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapNotificationsError(err error) (int, string) {
+func mapBenchmarksError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case notifications.IsErrUnauthorized(err):
+	case benchmarks.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case notifications.IsErrNotFound(err):
-		return 404, err.Error()
-	case notifications.IsErrBadRequest(err):
+	case benchmarks.IsErrNotOptedIn(err):
+		return 409, err.Error()
+	case benchmarks.IsErrBadRequest(err):
 		return 400, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapMembersError(err error) (int, string) {
+func mapRetentionError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case members.IsErrUnauthorized(err):
+	case retention.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case members.IsErrNotFound(err):
+	case retention.IsErrNotFound(err):
 		return 404, err.Error()
-	case members.IsErrBadRequest(err):
+	case retention.IsErrBadRequest(err):
 		return 400, err.Error()
-	case members.IsErrForbidden(err):
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapMembershipsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case memberships.IsErrUnauthorized(err):
+		return 401, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapMaintenanceError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case maintenance.IsErrNotFound(err):
+		return 404, err.Error()
+	case maintenance.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapClassGoalsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case classgoals.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapChatError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case chat.IsErrUnauthorized(err):
 		return 403, err.Error()
+	case chat.IsErrBadRequest(err):
+		return 400, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapProfileError(err error) (int, string) {
+func mapDevicesError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case profile.IsErrUnauthorized(err):
+	case devices.IsErrUnauthorized(err):
+		return 401, err.Error()
+	case devices.IsErrNotFound(err):
+		return 404, err.Error()
+	case devices.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+// auditListInput reads ?uid=, ?type=, ?before= (RFC3339) and ?limit=
+func auditListInput(w http.ResponseWriter, r *http.Request) (audit.ListInput, bool) {
+	q := r.URL.Query()
+	in := audit.ListInput{UID: q.Get("uid"), Type: q.Get("type")}
+	if b := q.Get("before"); b != "" {
+		before, err := time.Parse(time.RFC3339Nano, b)
+		if err != nil {
+			Fail(w, 400, "before must be an RFC3339 timestamp")
+			return in, false
+		}
+		in.Before = &before
+	}
+	if limitStr := q.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil {
+			in.Limit = l
+		}
+	}
+	return in, true
+}
+
+func mapAuditError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case audit.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapImpersonationError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case impersonation.IsErrBadRequest(err):
+		return 400, err.Error()
+	case impersonation.IsErrUnauthorized(err):
+		return 401, err.Error()
+	case impersonation.IsErrForbidden(err):
 		return 403, err.Error()
-	case profile.IsErrNotFound(err):
+	case impersonation.IsErrNotFound(err):
 		return 404, err.Error()
-	case profile.IsErrBadRequest(err):
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapLoginsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case logins.IsErrRevoked(err):
+		return 401, err.Error()
+	case logins.IsErrNotFound(err):
+		return 404, err.Error()
+	case logins.IsErrBadRequest(err):
 		return 400, err.Error()
-	case profile.IsErrTooManyUpdates(err):
-		return 429, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapStripeError(err error) (int, string) {
+func mapMediaError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case stripedom.IsErrUnauthorized(err):
+	case media.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case stripedom.IsErrNotFound(err):
+	case media.IsErrNotFound(err):
 		return 404, err.Error()
-	case stripedom.IsErrBadRequest(err):
+	case media.IsErrBadRequest(err):
 		return 400, err.Error()
-	case stripedom.IsErrLimitReached(err):
+	case media.IsErrQuotaExceeded(err):
 		return 402, err.Error()
+	case media.IsErrUnavailable(err):
+		return 503, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
 
-func mapRetentionError(err error) (int, string) {
+func mapBadgesError(err error) (int, string) {
 	if err == nil {
 		return 500, "unknown error"
 	}
 	switch {
-	case retention.IsErrUnauthorized(err):
+	case badges.IsErrUnauthorized(err):
 		return 403, err.Error()
-	case retention.IsErrNotFound(err):
+	case badges.IsErrNotFound(err):
 		return 404, err.Error()
-	case retention.IsErrBadRequest(err):
+	case badges.IsErrBadRequest(err):
+		return 400, err.Error()
+	case badges.IsErrInvalidBadge(err):
+		return 400, err.Error()
+	default:
+		// the check-in itself failed
+		return mapAttendanceError(err)
+	}
+}
+
+func mapTagsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case tags.IsErrNotFound(err):
+		return 404, err.Error()
+	case tags.IsErrUnknownTag(err):
+		return 404, err.Error()
+	case tags.IsErrNoClass(err):
+		return 404, err.Error()
+	case tags.IsErrBadRequest(err):
+		return 400, err.Error()
+	case tags.IsErrConflict(err):
+		return 409, err.Error()
+	default:
+		// the check-in itself failed
+		return mapAttendanceError(err)
+	}
+}
+
+func mapBirthdaysError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case birthdays.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapDigestError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case digest.IsErrBadRequest(err), ranks.IsErrBadRequest(err), notifications.IsErrBadRequest(err), attendance.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapChatOpsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case chatops.IsErrBadRequest(err):
+		return 400, err.Error()
+	case chatops.IsErrNotConfigured(err):
+		return 409, err.Error()
+	case chatops.IsErrDelivery(err):
+		return 502, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapLeadsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case leads.IsErrBadRequest(err):
+		return 400, err.Error()
+	case leads.IsErrForbidden(err):
+		return 403, err.Error()
+	case leads.IsErrNotFound(err):
+		return 404, err.Error()
+	case leads.IsErrRateLimited(err):
+		return 429, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapSheetsError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case sheets.IsErrBadRequest(err):
+		return 400, err.Error()
+	case sheets.IsErrNotConfigured(err):
+		return 409, err.Error()
+	case sheets.IsErrRateLimited(err):
+		return 429, err.Error()
+	case sheets.IsErrDelivery(err):
+		return 502, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapInboundError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case inbound.IsErrUnauthorized(err):
+		return 401, err.Error()
+	case inbound.IsErrBadRequest(err):
+		return 400, err.Error()
+	default:
+		return 500, err.Error()
+	}
+}
+
+func mapDemoError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case demo.IsErrBadRequest(err):
 		return 400, err.Error()
+	case demo.IsErrForbidden(err):
+		return 403, err.Error()
+	case demo.IsErrNotFound(err):
+		return 404, err.Error()
+	case demo.IsErrConflict(err):
+		return 409, err.Error()
 	default:
 		return 500, err.Error()
 	}
 }
+
+func mapTransfersError(err error) (int, string) {
+	if err == nil {
+		return 500, "unknown error"
+	}
+	switch {
+	case transfers.IsErrBadRequest(err):
+		return 400, err.Error()
+	case transfers.IsErrUnauthorized(err):
+		return 403, err.Error()
+	case transfers.IsErrNotFound(err):
+		return 404, err.Error()
+	case transfers.IsErrConflict(err):
+		return 409, err.Error()
+	default:
+		// adding the member at the destination can fail on its checks
+		return mapMembersError(err)
+	}
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// baseCtxKey holds the request context from before the group deadline, so a
+// route can replace the deadline instead of only shortening it
+type baseCtxKey struct{}
+
+// withTimeout gives every handler a context deadline. Firestore calls made
+// with r.Context() then fail in time for the handler to answer, instead of
+// the server cutting the connection at WriteTimeout. d <= 0 disables it.
+func withTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			base := r.Context()
+			ctx, cancel := context.WithTimeout(context.WithValue(base, baseCtxKey{}, base), d)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+		})
+	}
+}
+
+// timeout overrides the group deadline for one route (use with pr.With)
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			base, ok := r.Context().Value(baseCtxKey{}).(context.Context)
+			if !ok {
+				withTimeout(d)(next).ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(base, d)
+			defer cancel()
+
+			if tw, ok := w.(*timeoutWriter); ok {
+				tw.ctx = ctx
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// timeoutWriter turns the 500 a handler writes after its deadline passed into
+// a 504, so clients can tell a slow request from a broken one
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	replaced bool
+}
+
+func (w *timeoutWriter) WriteHeader(status int) {
+	if w.replaced {
+		return
+	}
+	if status >= 500 && w.ctx.Err() == context.DeadlineExceeded {
+		Fail(w.ResponseWriter, http.StatusGatewayTimeout, "request timed out")
+		w.replaced = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	if w.replaced {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
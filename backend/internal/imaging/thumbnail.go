@@ -0,0 +1,62 @@
+// Package imaging makes square thumbnails of decoded images, averaging the
+// source pixels each output pixel covers (a box filter). That is all profile
+// photos need, without an image processing dependency.
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail crops the centre square of src and scales it to side x side.
+// A source smaller than side is scaled up.
+func Thumbnail(src image.Image, side int) *image.RGBA {
+	b := src.Bounds()
+	crop := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-crop)/2
+	y0 := b.Min.Y + (b.Dy()-crop)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	if crop == 0 || side <= 0 {
+		return dst
+	}
+	for dy := 0; dy < side; dy++ {
+		sy0 := y0 + dy*crop/side
+		sy1 := max(y0+(dy+1)*crop/side, sy0+1)
+		for dx := 0; dx < side; dx++ {
+			sx0 := x0 + dx*crop/side
+			sx1 := max(x0+(dx+1)*crop/side, sx0+1)
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// Flatten draws img over a white background, for formats without alpha
+func Flatten(img *image.RGBA) *image.RGBA {
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := uint32(img.Pix[i+3])
+		if a == 0xff {
+			continue
+		}
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = uint8(uint32(img.Pix[i+c]) + (0xff - a))
+		}
+		img.Pix[i+3] = 0xff
+	}
+	return img
+}
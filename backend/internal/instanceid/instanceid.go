@@ -0,0 +1,59 @@
+// Package instanceid builds and parses session instance ids. An instance is
+// one occurrence of a timetable class, identified as "YYYY-MM-DD__sessionId"
+// with the date in the dojo's calendar. Older clients also wrote bare
+// "YYYY-MM-DD" ids and free-form instance doc ids, so Date is lenient while
+// Parse only accepts the canonical form.
+package instanceid
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// DateLayout is the layout of the date part
+	DateLayout = "2006-01-02"
+	// Delim separates the date from the session id
+	Delim = "__"
+)
+
+// New returns the instance id of a class on dateKey (YYYY-MM-DD)
+func New(dateKey, sessionID string) string {
+	return dateKey + Delim + sessionID
+}
+
+// ForDate returns the instance id of a class on the calendar day of t
+func ForDate(t time.Time, sessionID string) string {
+	return New(t.Format(DateLayout), sessionID)
+}
+
+// Parse splits a canonical id into its date and session id
+func Parse(id string) (dateKey, sessionID string, ok bool) {
+	dateKey, sessionID, found := strings.Cut(id, Delim)
+	if !found || sessionID == "" || strings.Contains(sessionID, "/") {
+		return "", "", false
+	}
+	if _, err := time.Parse(DateLayout, dateKey); err != nil {
+		return "", "", false
+	}
+	return dateKey, sessionID, true
+}
+
+// Date returns the YYYY-MM-DD prefix of any id that starts with a valid
+// date, canonical or not, and "" otherwise
+func Date(id string) string {
+	if len(id) < len(DateLayout) {
+		return ""
+	}
+	candidate := id[:len(DateLayout)]
+	if _, err := time.Parse(DateLayout, candidate); err != nil {
+		return ""
+	}
+	return candidate
+}
+
+// SessionID returns the session id of a canonical id, "" otherwise
+func SessionID(id string) string {
+	_, sessionID, _ := Parse(id)
+	return sessionID
+}
@@ -0,0 +1,35 @@
+// Package mailqueue sends plain-text email through the "mail" collection,
+// which the Firebase Trigger Email extension watches and delivers from.
+package mailqueue
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Email is one queued message. ReplyTo is optional.
+type Email struct {
+	To      string
+	ReplyTo string
+	Subject string
+	Text    string
+}
+
+// Queue adds e to the mail collection; createdAt is set to now
+func Queue(ctx context.Context, fs *firestore.Client, e Email, now time.Time) error {
+	doc := map[string]interface{}{
+		"to": e.To,
+		"message": map[string]interface{}{
+			"subject": e.Subject,
+			"text":    e.Text,
+		},
+		"createdAt": now,
+	}
+	if e.ReplyTo != "" {
+		doc["replyTo"] = e.ReplyTo
+	}
+	_, _, err := fs.Collection("mail").Add(ctx, doc)
+	return err
+}
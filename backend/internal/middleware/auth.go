@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"firebase.google.com/go/v4/auth"
 )
@@ -13,9 +14,13 @@ type ctxKey string
 const authUserKey ctxKey = "authUser"
 
 type AuthUser struct {
-	UID    string
-	Email  string
-	Claims map[string]any
+	UID      string
+	Email    string
+	Claims   map[string]any
+	AuthTime time.Time // when the user signed in; refreshed ID tokens keep it
+	// ImpersonatedBy is the admin acting as this user, when the request
+	// carries an impersonation token
+	ImpersonatedBy string
 }
 
 func WithAuth(authClient *auth.Client) func(http.Handler) http.Handler {
@@ -35,8 +40,9 @@ func WithAuth(authClient *auth.Client) func(http.Handler) http.Handler {
 			}
 
 			au := &AuthUser{
-				UID:    tok.UID,
-				Claims: tok.Claims,
+				UID:      tok.UID,
+				Claims:   tok.Claims,
+				AuthTime: time.Unix(tok.AuthTime, 0).UTC(),
 			}
 			if v, ok := tok.Claims["email"].(string); ok {
 				au.Email = v
@@ -57,6 +63,11 @@ func GetAuthUser(ctx context.Context) (*AuthUser, bool) {
 	return au, ok
 }
 
+// WithAuthUser replaces the request's user, for impersonation
+func WithAuthUser(ctx context.Context, au *AuthUser) context.Context {
+	return context.WithValue(ctx, authUserKey, au)
+}
+
 // IsAdmin checks if the user has admin role in their claims
 func IsAdmin(claims map[string]any) bool {
 	if claims == nil {
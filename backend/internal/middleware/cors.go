@@ -18,10 +18,21 @@ func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
 	return cors.Handler(cors.Options{
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Requested-With"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Requested-With", "X-Device-Id", "X-Device-Token", "X-Debug-Firestore", "X-Impersonation-Token"},
+		ExposedHeaders:   []string{"Link", "X-Firestore-Reads", "X-Duration-Ms", "X-Impersonated-User", "X-Impersonated-By", "X-Impersonation-Expires"},
 		AllowCredentials: true,
 		MaxAge:           300,
 		Debug:            false, // 本番ではfalse
 	})
 }
+
+// PublicCORS lets any site call the /public/ endpoints that dojos embed in
+// their own websites. Credentials are never sent there.
+func PublicCORS() func(http.Handler) http.Handler {
+	return cors.Handler(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Content-Type"},
+		MaxAge:         300,
+	})
+}
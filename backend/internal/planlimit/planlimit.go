@@ -0,0 +1,31 @@
+// Package planlimit is the contract between the services that create capped
+// resources (classes, members, staff, announcements, bulk sends) and billing.
+// Services take a PlanLimiter in their constructor; the Stripe service
+// implements it, and Unlimited stands in when billing is disabled.
+package planlimit
+
+import "context"
+
+// PlanLimiter enforces the dojo's plan caps. Both methods return an error
+// wrapping the stripe package's ErrLimitReached when the cap is hit.
+type PlanLimiter interface {
+	// CheckPlanLimit fails when the dojo cannot add one more resource
+	// ("member", "staff", "announcement", "class")
+	CheckPlanLimit(ctx context.Context, dojoID, resource string) error
+	// ConsumeBulkSend takes one bulk send from the dojo's weekly quota
+	ConsumeBulkSend(ctx context.Context, dojoID string) error
+}
+
+// Unlimited is the PlanLimiter when billing is disabled: nothing is capped
+type Unlimited struct{}
+
+func (Unlimited) CheckPlanLimit(context.Context, string, string) error { return nil }
+func (Unlimited) ConsumeBulkSend(context.Context, string) error        { return nil }
+
+// OrUnlimited returns l, or Unlimited when l is nil
+func OrUnlimited(l PlanLimiter) PlanLimiter {
+	if l == nil {
+		return Unlimited{}
+	}
+	return l
+}
@@ -0,0 +1,90 @@
+// Package scanbudget caps the documents a report reads. Reports stream their
+// scans and keep running totals, but a huge dojo can still hold a request
+// for longer than it has, and grow the per-member maps without bound. A scan
+// that spends its budget stops there and the report is flagged partial.
+package scanbudget
+
+import "sync"
+
+// Budget counts the documents read by one report. The zero limit, and a nil
+// Budget, are unlimited. Scans a report runs in parallel each take a share
+// from Split, so where a partial report stops does not depend on which scan
+// happens to read first.
+type Budget struct {
+	mu        sync.Mutex
+	limit     int
+	used      int
+	exhausted bool
+}
+
+// New returns a budget of limit documents
+func New(limit int) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Split divides the budget into n shares, one per parallel scan. Shares of
+// an unlimited budget are unlimited; a limited one is never split below one
+// document a share.
+func (b *Budget) Split(n int) []*Budget {
+	shares := make([]*Budget, n)
+	for i := range shares {
+		if b == nil {
+			continue
+		}
+		limit := b.limit / n
+		if i < b.limit%n {
+			limit++
+		}
+		if b.limit > 0 && limit == 0 {
+			limit = 1
+		}
+		shares[i] = New(limit)
+	}
+	return shares
+}
+
+// AnyExhausted reports whether a scan stopped at any of budgets
+func AnyExhausted(budgets ...*Budget) bool {
+	for _, b := range budgets {
+		if b.Exhausted() {
+			return true
+		}
+	}
+	return false
+}
+
+// Take counts one document. It returns false, and the scan should stop
+// without using the document, once the budget is spent.
+func (b *Budget) Take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.used >= b.limit {
+		b.exhausted = true
+		return false
+	}
+	b.used++
+	return true
+}
+
+// Exhausted reports whether a scan stopped at the budget
+func (b *Budget) Exhausted() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exhausted
+}
+
+// Used is the number of documents counted so far
+func (b *Budget) Used() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
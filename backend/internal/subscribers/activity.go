@@ -0,0 +1,31 @@
+package subscribers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dojo-manager/backend/internal/domain/activity"
+	"dojo-manager/backend/internal/events"
+)
+
+// activityCleanupTimeout bounds dropping a removed member's app activity,
+// which runs after the request has been answered
+const activityCleanupTimeout = 30 * time.Second
+
+// registerActivityCleanup drops members who leave from the dojo's app
+// activity, so adoption only counts the current roster
+func registerActivityCleanup(bus *events.Bus, activitySvc *activity.Service) {
+	events.Subscribe(bus, "app_activity", func(ctx context.Context, e events.MemberChanged) {
+		if e.Change != events.MemberRemoved {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), activityCleanupTimeout)
+		go func() {
+			defer cancel()
+			if err := activitySvc.ForgetMember(ctx, e.DojoID, e.MemberUID, time.Now()); err != nil {
+				log.Printf("app activity: forget %s/%s: %v", e.DojoID, e.MemberUID, err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,91 @@
+package subscribers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dojo-manager/backend/internal/domain/chatops"
+	"dojo-manager/backend/internal/events"
+	"dojo-manager/backend/internal/instanceid"
+)
+
+// headcountTimeout bounds the big-class check of one check-in or roll call,
+// which runs after the request has been answered
+const headcountTimeout = 30 * time.Second
+
+// registerChatOps posts join requests, big classes and failed plan payments
+// to the dojo's chat webhook
+func registerChatOps(bus *events.Bus, d Deps) {
+	events.Subscribe(bus, "chatops", func(ctx context.Context, e events.JoinRequested) {
+		line := e.FullName + " asked to join."
+		if e.Belt != "" {
+			line = e.FullName + " (" + e.Belt + " belt) asked to join."
+		}
+		d.ChatOps.Notify(ctx, e.DojoID, chatops.EventJoinRequest, chatops.Message{
+			Title: "New join request",
+			Lines: []string{line},
+		})
+	})
+
+	events.Subscribe(bus, "chatops", func(ctx context.Context, e events.PlanPaymentFailed) {
+		// once per invoice: Stripe retries the charge and redelivers events
+		d.ChatOps.NotifyOnce(ctx, e.DojoID, chatops.EventPaymentFailed, e.InvoiceID, chatops.Message{
+			Title: "Plan payment failed",
+			Lines: []string{
+				"A payment of " + e.Amount + " could not be charged.",
+				"Update the card in billing settings to keep the plan active.",
+			},
+		})
+	})
+
+	if d.Attendance == nil {
+		return
+	}
+	checkHeadcount := func(ctx context.Context, dojoID, instanceID string) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), headcountTimeout)
+		go func() {
+			defer cancel()
+			announceHeadcount(ctx, d, dojoID, instanceID)
+		}()
+	}
+	events.Subscribe(bus, "chatops", func(ctx context.Context, e events.AttendanceRecorded) {
+		if e.Checkin() {
+			checkHeadcount(ctx, e.DojoID, e.SessionInstanceID)
+		}
+	})
+	events.Subscribe(bus, "chatops", func(ctx context.Context, e events.AttendanceSheetRecorded) {
+		if e.HasCheckins {
+			checkHeadcount(ctx, e.DojoID, e.SessionInstanceID)
+		}
+	})
+}
+
+// announceHeadcount posts to the dojo's chat webhook the first time a class
+// instance reaches the big-class headcount
+func announceHeadcount(ctx context.Context, d Deps, dojoID, instanceID string) {
+	threshold := d.ChatOps.HeadcountThreshold(ctx, dojoID)
+	if threshold == 0 {
+		return
+	}
+	n, err := d.Attendance.CountCheckins(ctx, dojoID, instanceID)
+	if err != nil || n < threshold {
+		return
+	}
+
+	class := "A class"
+	dateKey, sessionID, ok := instanceid.Parse(instanceID)
+	if ok && d.Sessions != nil {
+		if sess, err := d.Sessions.Get(ctx, dojoID, sessionID); err == nil && sess.Title != "" {
+			class = sess.Title
+		}
+	}
+	line := fmt.Sprintf("%s has %d checked in.", class, n)
+	if ok {
+		line = fmt.Sprintf("%s on %s has %d checked in.", class, dateKey, n)
+	}
+	d.ChatOps.NotifyOnce(ctx, dojoID, chatops.EventBigClass, instanceID, chatops.Message{
+		Title: "Big class",
+		Lines: []string{line},
+	})
+}
@@ -0,0 +1,28 @@
+package subscribers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dojo-manager/backend/internal/domain/claims"
+	"dojo-manager/backend/internal/events"
+)
+
+// claimsSyncTimeout bounds resyncing a member's custom claims, which runs
+// after the request has been answered
+const claimsSyncTimeout = 30 * time.Second
+
+// registerClaimsSync rewrites the custom claims (dojoRoles) of members who
+// join, leave or change role, so their ID token follows Firestore
+func registerClaimsSync(bus *events.Bus, claimsSvc *claims.Service) {
+	events.Subscribe(bus, "custom_claims", func(ctx context.Context, e events.MemberChanged) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), claimsSyncTimeout)
+		go func() {
+			defer cancel()
+			if _, err := claimsSvc.SyncUser(ctx, e.MemberUID); err != nil && !claims.IsErrNotFound(err) {
+				log.Printf("custom claims: sync %s after change in dojo %s: %v", e.MemberUID, e.DojoID, err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,32 @@
+package subscribers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dojo-manager/backend/internal/domain/digest"
+	"dojo-manager/backend/internal/events"
+)
+
+// digestDepartureTimeout bounds noting a departure, which runs after the
+// request has been answered
+const digestDepartureTimeout = 30 * time.Second
+
+// registerDigestDepartures logs members removed from a dojo for the weekly
+// staff digest, since their member doc is gone by the time it is built
+func registerDigestDepartures(bus *events.Bus, digestSvc *digest.Service) {
+	events.Subscribe(bus, "digest", func(ctx context.Context, e events.MemberChanged) {
+		if e.Change != events.MemberRemoved {
+			return
+		}
+		at := time.Now().UTC()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), digestDepartureTimeout)
+		go func() {
+			defer cancel()
+			if err := digestSvc.RecordDeparture(ctx, e.DojoID, e.MemberUID, e.ChangedBy, at); err != nil {
+				log.Printf("digest: departure %s/%s: %v", e.DojoID, e.MemberUID, err)
+			}
+		}()
+	})
+}
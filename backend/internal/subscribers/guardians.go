@@ -0,0 +1,40 @@
+package subscribers
+
+import (
+	"context"
+	"time"
+
+	"dojo-manager/backend/internal/domain/reminders"
+	"dojo-manager/backend/internal/events"
+)
+
+// guardianPushTimeout bounds the pushes of one check-in or roll call, which
+// run after the request has been answered
+const guardianPushTimeout = 30 * time.Second
+
+// registerGuardianPushes tells guardians when their child is checked in to or
+// out of a kids class. Only new check-ins count, so corrections and
+// re-submitted sheets don't push twice.
+func registerGuardianPushes(bus *events.Bus, rem *reminders.Service) {
+	notify := func(ctx context.Context, kind, dojoID, instanceID string, children []string) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), guardianPushTimeout)
+		go func() {
+			defer cancel()
+			rem.NotifyGuardians(ctx, kind, dojoID, instanceID, children)
+		}()
+	}
+
+	events.Subscribe(bus, "guardians", func(ctx context.Context, e events.AttendanceRecorded) {
+		if e.Created && e.Checkin() {
+			notify(ctx, reminders.GuardianCheckin, e.DojoID, e.SessionInstanceID, []string{e.MemberUID})
+		}
+	})
+	events.Subscribe(bus, "guardians", func(ctx context.Context, e events.AttendanceSheetRecorded) {
+		if len(e.CheckedIn) > 0 {
+			notify(ctx, reminders.GuardianCheckin, e.DojoID, e.SessionInstanceID, e.CheckedIn)
+		}
+	})
+	events.Subscribe(bus, "guardians", func(ctx context.Context, e events.AttendanceCheckedOut) {
+		notify(ctx, reminders.GuardianCheckout, e.DojoID, e.SessionInstanceID, []string{e.MemberUID})
+	})
+}
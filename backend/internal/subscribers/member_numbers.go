@@ -0,0 +1,24 @@
+package subscribers
+
+import (
+	"context"
+	"log"
+
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/events"
+)
+
+// registerMemberNumbers numbers members as they are added to a dojo. It
+// runs before the publisher answers, so the member it returns already has
+// its number; members added by paths that publish nothing are numbered when
+// their badge or an export first needs it.
+func registerMemberNumbers(bus *events.Bus, dojoRepo *dojo.Repo) {
+	events.Subscribe(bus, "member_numbers", func(ctx context.Context, e events.MemberChanged) {
+		if e.Change != events.MemberAdded {
+			return
+		}
+		if _, err := dojoRepo.EnsureMemberNumber(ctx, e.DojoID, e.MemberUID); err != nil {
+			log.Printf("member numbers: number %s/%s: %v", e.DojoID, e.MemberUID, err)
+		}
+	})
+}
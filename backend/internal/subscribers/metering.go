@@ -0,0 +1,29 @@
+package subscribers
+
+import (
+	"context"
+
+	"dojo-manager/backend/internal/domain/metering"
+	"dojo-manager/backend/internal/events"
+)
+
+// registerMetering emits usage events for check-ins. Only newly created
+// check-ins count, so corrections and re-submitted sheets aren't metered twice.
+func registerMetering(bus *events.Bus, meter *metering.Recorder) {
+	events.Subscribe(bus, "metering", func(ctx context.Context, e events.AttendanceRecorded) {
+		if !e.Created || !e.Checkin() {
+			return
+		}
+		meter.Record(ctx, metering.EventCheckinRecorded, e.DojoID, e.RecordedBy, map[string]interface{}{
+			"sessionInstanceId": e.SessionInstanceID,
+			"memberUid":         e.MemberUID,
+		})
+	})
+
+	events.Subscribe(bus, "metering", func(ctx context.Context, e events.AttendanceSheetRecorded) {
+		meter.RecordN(ctx, metering.EventCheckinRecorded, e.DojoID, e.RecordedBy, e.NewCheckins, map[string]interface{}{
+			"sessionInstanceId": e.SessionInstanceID,
+			"bulk":              true,
+		})
+	})
+}
@@ -0,0 +1,31 @@
+package subscribers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dojo-manager/backend/internal/domain/recurring"
+	"dojo-manager/backend/internal/events"
+)
+
+// recurringCancelTimeout bounds releasing a removed member's places, which
+// runs after the request has been answered
+const recurringCancelTimeout = 60 * time.Second
+
+// registerRecurringBookings gives up the recurring places of members removed
+// from a dojo, so they go to the waitlist
+func registerRecurringBookings(bus *events.Bus, recurringSvc *recurring.Service) {
+	events.Subscribe(bus, "recurring", func(ctx context.Context, e events.MemberChanged) {
+		if e.Change != events.MemberRemoved {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recurringCancelTimeout)
+		go func() {
+			defer cancel()
+			if err := recurringSvc.CancelMember(ctx, e.DojoID, e.MemberUID); err != nil {
+				log.Printf("recurring bookings: cancel %s/%s: %v", e.DojoID, e.MemberUID, err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,31 @@
+package subscribers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/events"
+)
+
+// reservationReleaseTimeout bounds releasing a removed member's class
+// reservations, which runs after the request has been answered
+const reservationReleaseTimeout = 60 * time.Second
+
+// registerReservationRelease gives back the places removed members had
+// reserved in upcoming classes
+func registerReservationRelease(bus *events.Bus, sessions *session.Service) {
+	events.Subscribe(bus, "reservations", func(ctx context.Context, e events.MemberChanged) {
+		if e.Change != events.MemberRemoved {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reservationReleaseTimeout)
+		go func() {
+			defer cancel()
+			if _, err := sessions.ReleaseMemberReservations(ctx, e.DojoID, e.MemberUID, time.Now()); err != nil {
+				log.Printf("reservations: release %s/%s: %v", e.DojoID, e.MemberUID, err)
+			}
+		}()
+	})
+}
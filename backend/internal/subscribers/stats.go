@@ -0,0 +1,25 @@
+package subscribers
+
+import (
+	"context"
+
+	"dojo-manager/backend/internal/domain/stats"
+	"dojo-manager/backend/internal/events"
+)
+
+// registerStatsCache drops a dojo's cached stats after the attendance or
+// roster writes they are computed from
+func registerStatsCache(bus *events.Bus, statsSvc *stats.Service) {
+	events.Subscribe(bus, "stats", func(ctx context.Context, e events.AttendanceRecorded) {
+		statsSvc.Invalidate(e.DojoID)
+	})
+	events.Subscribe(bus, "stats", func(ctx context.Context, e events.AttendanceSheetRecorded) {
+		statsSvc.Invalidate(e.DojoID)
+	})
+	events.Subscribe(bus, "stats", func(ctx context.Context, e events.AttendanceCorrected) {
+		statsSvc.Invalidate(e.DojoID)
+	})
+	events.Subscribe(bus, "stats", func(ctx context.Context, e events.MemberChanged) {
+		statsSvc.Invalidate(e.DojoID)
+	})
+}
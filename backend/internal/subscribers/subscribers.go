@@ -0,0 +1,73 @@
+// Package subscribers connects the domains that react to events to the
+// domains that publish them. Publishers only know the events package; the
+// reactions, and the services they need, are registered here at startup.
+package subscribers
+
+import (
+	"dojo-manager/backend/internal/domain/activity"
+	"dojo-manager/backend/internal/domain/attendance"
+	"dojo-manager/backend/internal/domain/chatops"
+	"dojo-manager/backend/internal/domain/claims"
+	"dojo-manager/backend/internal/domain/digest"
+	"dojo-manager/backend/internal/domain/dojo"
+	"dojo-manager/backend/internal/domain/metering"
+	"dojo-manager/backend/internal/domain/recurring"
+	"dojo-manager/backend/internal/domain/reminders"
+	"dojo-manager/backend/internal/domain/session"
+	"dojo-manager/backend/internal/domain/stats"
+	"dojo-manager/backend/internal/domain/tags"
+	"dojo-manager/backend/internal/events"
+)
+
+// Deps are the services reactions call into; nil ones are skipped
+type Deps struct {
+	Meter      *metering.Recorder
+	ChatOps    *chatops.Service
+	Attendance *attendance.Service // headcounts for big-class announcements
+	Sessions   *session.Service    // class titles in announcements, removed members' reservations
+	Stats      *stats.Service      // cached stats to drop after writes
+	Reminders  *reminders.Service  // guardian check-in pushes
+	Recurring  *recurring.Service  // recurring bookings of members who leave
+	Digest     *digest.Service     // departures for the staff digest
+	Dojos      *dojo.Repo          // member numbers for new members
+	Activity   *activity.Service   // app opens of members who leave
+	Claims     *claims.Service     // custom claims of members whose role changes
+	Tags       *tags.Service       // NFC tags of members who leave
+}
+
+// Register subscribes every reaction whose service is present
+func Register(bus *events.Bus, d Deps) {
+	if d.Meter != nil {
+		registerMetering(bus, d.Meter)
+	}
+	if d.ChatOps != nil {
+		registerChatOps(bus, d)
+	}
+	if d.Stats != nil {
+		registerStatsCache(bus, d.Stats)
+	}
+	if d.Reminders != nil {
+		registerGuardianPushes(bus, d.Reminders)
+	}
+	if d.Recurring != nil {
+		registerRecurringBookings(bus, d.Recurring)
+	}
+	if d.Sessions != nil {
+		registerReservationRelease(bus, d.Sessions)
+	}
+	if d.Digest != nil {
+		registerDigestDepartures(bus, d.Digest)
+	}
+	if d.Dojos != nil {
+		registerMemberNumbers(bus, d.Dojos)
+	}
+	if d.Activity != nil {
+		registerActivityCleanup(bus, d.Activity)
+	}
+	if d.Claims != nil {
+		registerClaimsSync(bus, d.Claims)
+	}
+	if d.Tags != nil {
+		registerTagCleanup(bus, d.Tags)
+	}
+}
@@ -0,0 +1,31 @@
+package subscribers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dojo-manager/backend/internal/domain/tags"
+	"dojo-manager/backend/internal/events"
+)
+
+// tagCleanupTimeout bounds unregistering a removed member's tags, which runs
+// after the request has been answered
+const tagCleanupTimeout = 30 * time.Second
+
+// registerTagCleanup unregisters the NFC/RFID tags of members who leave, so
+// their card stops opening attendance and can be handed to someone else
+func registerTagCleanup(bus *events.Bus, tagsSvc *tags.Service) {
+	events.Subscribe(bus, "nfc_tags", func(ctx context.Context, e events.MemberChanged) {
+		if e.Change != events.MemberRemoved {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tagCleanupTimeout)
+		go func() {
+			defer cancel()
+			if err := tagsSvc.ForgetMember(ctx, e.DojoID, e.MemberUID); err != nil {
+				log.Printf("nfc tags: forget %s/%s: %v", e.DojoID, e.MemberUID, err)
+			}
+		}()
+	})
+}
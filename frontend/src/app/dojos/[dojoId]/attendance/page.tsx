@@ -26,6 +26,7 @@ type MemberDoc = {
   stripes?: number;
   createdAt?: any;
   status?: string;
+  suspended?: boolean;
 };
 
 type SessionDoc = {
@@ -330,10 +331,12 @@ export default function AttendanceDashboard() {
     }));
   }, [filteredAttendance]);
 
-  // Top members
+  // Top members (suspended members are left out)
   const topMembers = useMemo(() => {
+    const suspended = new Set(members.filter((m) => m.suspended).map((m) => m.uid));
     const counts = new Map<string, { name: string; count: number; uid: string }>();
     for (const a of filteredAttendance) {
+      if (suspended.has(a.uid)) continue;
       const prev = counts.get(a.uid) || { name: a.displayName, count: 0, uid: a.uid };
       prev.count++;
       counts.set(a.uid, prev);
@@ -341,7 +344,7 @@ export default function AttendanceDashboard() {
     return Array.from(counts.values())
       .sort((a, b) => b.count - a.count)
       .slice(0, 10);
-  }, [filteredAttendance]);
+  }, [filteredAttendance, members]);
 
   // Popular classes
   const popularClasses = useMemo(() => {